@@ -0,0 +1,78 @@
+// Command backfill rewrites dynamic unit items stored under an older schema
+// version so that every item matches the latest registered schema.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	internalConfig "github.com/steverhoton/unt-units-svc/internal/config"
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/internal/repository"
+)
+
+func main() {
+	log.SetPrefix("[UNT-UNITS-BACKFILL] ")
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	accountID := flag.String("account", "", "Only backfill units for this account (queries one partition instead of scanning)")
+	unitTypes := flag.String("unit-types", "", "Comma-separated unit types to backfill (default: all registered types)")
+	dryRun := flag.Bool("dry-run", false, "Count stale items without rewriting them")
+	pageSize := flag.Int("page-size", 100, "DynamoDB page size")
+	flag.Parse()
+
+	// Load configuration (TABLE_NAME, AWS_REGION, SCHEMA_DIR)
+	cfg, err := internalConfig.New()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	ctx := context.Background()
+
+	awsCfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(cfg.Region))
+	if err != nil {
+		log.Fatalf("Failed to load AWS configuration: %v", err)
+	}
+
+	schemaRegistry, err := models.DefaultSchemaRegistry()
+	if err != nil {
+		log.Fatalf("Failed to load schema registry: %v", err)
+	}
+	if cfg.SchemaDir != "" {
+		if err := schemaRegistry.LoadFrom(ctx, models.NewFSSchemaSource(os.DirFS(cfg.SchemaDir), ".")); err != nil {
+			log.Fatalf("Failed to load schemas from %s: %v", cfg.SchemaDir, err)
+		}
+	}
+
+	migrator := models.NewDefaultSchemaMigrator(schemaRegistry)
+	repo := repository.NewDynamoDBDynamicUnitRepository(dynamodb.NewFromConfig(awsCfg), cfg.TableName, migrator, true)
+
+	opts := repository.BackfillOptions{
+		AccountID: *accountID,
+		DryRun:    *dryRun,
+		PageSize:  int32(*pageSize),
+	}
+	for _, unitType := range strings.Split(*unitTypes, ",") {
+		if unitType = strings.TrimSpace(unitType); unitType != "" {
+			opts.UnitTypes = append(opts.UnitTypes, unitType)
+		}
+	}
+
+	log.Printf("Starting backfill on table %s (account=%q, unitTypes=%v, dryRun=%t)", cfg.TableName, opts.AccountID, opts.UnitTypes, opts.DryRun)
+
+	result, err := repo.Backfill(ctx, opts)
+	if err != nil {
+		log.Fatalf("Backfill failed after scanning %d items: %v", result.Scanned, err)
+	}
+
+	log.Printf("Backfill complete: scanned=%d stale=%d migrated=%d failed=%d", result.Scanned, result.Stale, result.Migrated, result.Failed)
+	if result.Failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,118 @@
+// Command export writes an account's live units to a CSV, NDJSON or Parquet file.
+// Unit types configured in DYNAMIC_UNIT_TYPES are exported with a column for each
+// property of their latest schema.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	internalConfig "github.com/steverhoton/unt-units-svc/internal/config"
+	"github.com/steverhoton/unt-units-svc/internal/exporter"
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/internal/repository"
+)
+
+// unitExporter is implemented by both unit repositories
+type unitExporter interface {
+	Export(ctx context.Context, opts repository.ExportOptions, w io.Writer) (*repository.ExportResult, error)
+}
+
+func main() {
+	log.SetPrefix("[UNT-UNITS-EXPORT] ")
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	accountID := flag.String("account", "", "Account whose units are exported (required)")
+	unitType := flag.String("unit-type", "", "Only export units of this type (required for dynamic unit types)")
+	out := flag.String("out", "-", "File to write, or - for standard output")
+	formatName := flag.String("format", "", "CSV, NDJSON or PARQUET (default: from the -out extension)")
+	pageSize := flag.Int("page-size", 100, "DynamoDB page size")
+	flag.Parse()
+
+	if *accountID == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	format, err := exportFormat(*formatName, *out)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	// Load configuration (TABLE_NAME, AWS_REGION, DYNAMIC_UNIT_TYPES, SCHEMA_DIR)
+	cfg, err := internalConfig.New()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	ctx := context.Background()
+
+	awsCfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(cfg.Region))
+	if err != nil {
+		log.Fatalf("Failed to load AWS configuration: %v", err)
+	}
+	client := dynamodb.NewFromConfig(awsCfg)
+
+	var repo unitExporter = repository.NewDynamoDBUnitRepository(client, cfg.TableName)
+	if cfg.IsDynamicUnitType(*unitType) {
+		schemaRegistry, err := models.DefaultSchemaRegistry()
+		if err != nil {
+			log.Fatalf("Failed to load schema registry: %v", err)
+		}
+		if cfg.SchemaDir != "" {
+			if err := schemaRegistry.LoadFrom(ctx, models.NewFSSchemaSource(os.DirFS(cfg.SchemaDir), ".")); err != nil {
+				log.Fatalf("Failed to load schemas from %s: %v", cfg.SchemaDir, err)
+			}
+		}
+		repo = repository.NewDynamoDBDynamicUnitRepository(client, cfg.TableName, models.NewDefaultSchemaMigrator(schemaRegistry), false)
+	}
+
+	var output io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("Failed to create %s: %v", *out, err)
+		}
+		defer f.Close()
+		output = f
+	}
+
+	log.Printf("Exporting units from table %s (account=%q, unitType=%q, format=%s)", cfg.TableName, *accountID, *unitType, format)
+
+	result, err := repo.Export(ctx, repository.ExportOptions{
+		AccountID: *accountID,
+		UnitType:  *unitType,
+		Format:    format,
+		PageSize:  int32(*pageSize),
+	}, output)
+	if err != nil {
+		count := 0
+		if result != nil {
+			count = result.Count
+		}
+		log.Fatalf("Export failed after %d units: %v", count, err)
+	}
+
+	log.Printf("Export complete: %d units", result.Count)
+}
+
+// exportFormat returns the format named by the -format flag, or the one implied
+// by the output file's extension
+func exportFormat(name, out string) (exporter.Format, error) {
+	if name != "" {
+		return exporter.ParseFormat(name)
+	}
+	if out == "-" {
+		return "", errors.New("-format is required when writing standard output")
+	}
+	return exporter.ParseFormat(strings.TrimPrefix(filepath.Ext(out), "."))
+}
@@ -0,0 +1,101 @@
+// Command import creates units in bulk from a CSV or NDJSON file and prints a JSON
+// report with the outcome of each row.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	internalConfig "github.com/steverhoton/unt-units-svc/internal/config"
+	"github.com/steverhoton/unt-units-svc/internal/importer"
+	"github.com/steverhoton/unt-units-svc/internal/repository"
+)
+
+func main() {
+	log.SetPrefix("[UNT-UNITS-IMPORT] ")
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	accountID := flag.String("account", "", "Account to create the units in (required)")
+	unitType := flag.String("unit-type", "", "Unit type of the created units (required)")
+	file := flag.String("file", "", "CSV or NDJSON file to import, or - for standard input (required)")
+	formatName := flag.String("format", "", "CSV or NDJSON (default: from the file extension)")
+	flag.Parse()
+
+	if *accountID == "" || *unitType == "" || *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	format, err := importFormat(*formatName, *file)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	// Load configuration (TABLE_NAME, AWS_REGION)
+	cfg, err := internalConfig.New()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	var input io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			log.Fatalf("Failed to open %s: %v", *file, err)
+		}
+		defer f.Close()
+		input = f
+	}
+
+	rows, err := importer.Parse(input, format)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", *file, err)
+	}
+	if len(rows) == 0 {
+		log.Fatalf("%s has no rows to import", *file)
+	}
+
+	ctx := context.Background()
+
+	awsCfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(cfg.Region))
+	if err != nil {
+		log.Fatalf("Failed to load AWS configuration: %v", err)
+	}
+
+	repo := repository.NewDynamoDBUnitRepository(dynamodb.NewFromConfig(awsCfg), cfg.TableName)
+
+	log.Printf("Importing %d rows from %s into table %s (account=%q, unitType=%q)", len(rows), *file, cfg.TableName, *accountID, *unitType)
+
+	report := importer.New(repo).Import(ctx, *accountID, *unitType, rows)
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Fatalf("Failed to write report: %v", err)
+	}
+
+	log.Printf("Import complete: total=%d succeeded=%d failed=%d", report.Total, report.Succeeded, report.Failed)
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// importFormat returns the format named by the -format flag, or the one implied
+// by the file extension
+func importFormat(name, file string) (importer.Format, error) {
+	if name != "" {
+		return importer.ParseFormat(name)
+	}
+	if file == "-" {
+		return "", errors.New("-format is required when reading standard input")
+	}
+	return importer.FormatFromFilename(file)
+}
@@ -5,24 +5,37 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 
+	"github.com/steverhoton/unt-units-svc/internal/auth"
+	"github.com/steverhoton/unt-units-svc/internal/blobstore"
 	internalConfig "github.com/steverhoton/unt-units-svc/internal/config"
+	"github.com/steverhoton/unt-units-svc/internal/decoder"
 	"github.com/steverhoton/unt-units-svc/internal/handlers"
+	"github.com/steverhoton/unt-units-svc/internal/models"
 	"github.com/steverhoton/unt-units-svc/internal/repository"
 	"github.com/steverhoton/unt-units-svc/pkg/appsync"
 )
 
 // Dependencies holds all the application dependencies
 type Dependencies struct {
-	Config    *internalConfig.Config
-	DDBClient *dynamodb.Client
-	Repo      repository.UnitRepository
-	Handlers  *handlers.UnitHandlers
+	Config          *internalConfig.Config
+	DDBClient       *dynamodb.Client
+	Repo            repository.UnitRepository
+	DynamicRepo     repository.DynamicUnitRepository
+	Handlers        *handlers.UnitHandlers
+	DynamicHandlers *handlers.DynamicUnitHandlers
+	SchemaRegistry  *models.SchemaRegistry
+	SchemaHandlers  *handlers.SchemaHandlers
+	WebhookHandlers *handlers.WebhookHandlers
+	Authorizer      *auth.Authorizer
+	FieldPolicies   *models.FieldPolicyRegistry
 }
 
 // Global dependencies - initialized once
@@ -57,20 +70,114 @@ func initializeDependencies() (*Dependencies, error) {
 	// Create DynamoDB client
 	ddbClient := dynamodb.NewFromConfig(awsCfg)
 
-	// Create repository
-	repo := repository.NewDynamoDBUnitRepository(ddbClient, cfg.TableName)
+	// Load unit type schemas: embedded first, then the optional schema directory
+	schemaRegistry, err := models.DefaultSchemaRegistry()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load schema registry: %w", err)
+	}
+	if cfg.SchemaDir != "" {
+		if err := schemaRegistry.LoadFrom(context.TODO(), models.NewFSSchemaSource(os.DirFS(cfg.SchemaDir), ".")); err != nil {
+			return nil, fmt.Errorf("failed to load schemas from %s: %w", cfg.SchemaDir, err)
+		}
+	}
+
+	// Load field policies the same way: embedded first, then the optional policy directory
+	fieldPolicies, err := models.DefaultFieldPolicyRegistry()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load field policies: %w", err)
+	}
+	if cfg.FieldPolicyDir != "" {
+		if err := fieldPolicies.LoadFrom(context.TODO(), models.NewFSSchemaSource(os.DirFS(cfg.FieldPolicyDir), ".")); err != nil {
+			return nil, fmt.Errorf("failed to load field policies from %s: %w", cfg.FieldPolicyDir, err)
+		}
+	}
+
+	// Create repositories
+	if cfg.PaginationTokenKey == "" {
+		log.Printf("PAGINATION_TOKEN_KEY is not set; nextToken values are only valid within this Lambda instance")
+	}
+	tokenSigner := repository.NewPaginationTokenSigner([]byte(cfg.PaginationTokenKey), cfg.PaginationTokenTTL)
+
+	repo := repository.NewDynamoDBUnitRepository(ddbClient, cfg.TableName).
+		WithDeletedRetention(cfg.DeletedRetention).
+		WithPaginationTokenSigner(tokenSigner).
+		WithHistory(cfg.UnitHistory).
+		WithOutbox(cfg.UnitEvents)
+	migrator := models.NewDefaultSchemaMigrator(schemaRegistry)
+	dynamicRepo := repository.NewDynamoDBDynamicUnitRepository(ddbClient, cfg.TableName, migrator, cfg.SchemaMigrationWriteBack).
+		WithDeletedRetention(cfg.DeletedRetention).
+		WithPaginationTokenSigner(tokenSigner).
+		WithHistory(cfg.UnitHistory)
 
 	// Create handlers
-	unitHandlers := handlers.NewUnitHandlers(repo)
+	vinDecoder := decoder.NewVPICDecoder(cfg.VinDecoderURL, &http.Client{Timeout: cfg.VinDecoderTimeout})
+	unitHandlers := handlers.NewUnitHandlers(repo).
+		WithAdminGroup(cfg.AdminGroup).
+		WithVinDecoder(vinDecoder)
+	dynamicHandlers := handlers.NewDynamicUnitHandlers(dynamicRepo).WithAdminGroup(cfg.AdminGroup)
+
+	// Exports are uploaded to S3 when a bucket is configured
+	if cfg.ExportBucket != "" {
+		s3Client := s3.NewFromConfig(awsCfg)
+		exportStore := blobstore.NewS3Store(s3Client, s3.NewPresignClient(s3Client), cfg.ExportBucket)
+		unitHandlers.WithExportStore(exportStore, cfg.ExportURLTTL)
+		dynamicHandlers.WithExportStore(exportStore, cfg.ExportURLTTL)
+	}
+	schemaHandlers := handlers.NewSchemaHandlers(schemaRegistry)
+
+	// Resolve the accounts each caller may act on from a membership table when
+	// one is configured, otherwise from a claim on their identity token
+	var accountResolver auth.AccountResolver = auth.NewClaimAccountResolver(cfg.AccountClaim)
+	if cfg.MembershipTableName != "" {
+		accountResolver = auth.NewMembershipAccountResolver(ddbClient, cfg.MembershipTableName)
+	}
+	authorizer := auth.NewAuthorizer(accountResolver, cfg.AdminGroup)
+
+	// Webhook subscriptions live in the units table beside the units they watch
+	webhookRepo := repository.NewDynamoDBWebhookRepository(ddbClient, cfg.TableName).
+		WithPaginationTokenSigner(tokenSigner).
+		WithDeliveryRetention(cfg.WebhookDeliveryRetention)
+	webhookHandlers := handlers.NewWebhookHandlers(webhookRepo, authorizer)
 
 	return &Dependencies{
-		Config:    cfg,
-		DDBClient: ddbClient,
-		Repo:      repo,
-		Handlers:  unitHandlers,
+		Config:          cfg,
+		DDBClient:       ddbClient,
+		Repo:            repo,
+		DynamicRepo:     dynamicRepo,
+		Handlers:        unitHandlers,
+		DynamicHandlers: dynamicHandlers,
+		SchemaRegistry:  schemaRegistry,
+		SchemaHandlers:  schemaHandlers,
+		WebhookHandlers: webhookHandlers,
+		Authorizer:      authorizer,
+		FieldPolicies:   fieldPolicies,
 	}, nil
 }
 
+// handlersFor selects the handler set for the unit type named in the event.
+// Unit types configured as dynamic are validated against their JSON schema;
+// everything else is served by the models.Unit handlers. Either set is wrapped
+// so the request's accountId is checked against the caller's identity first,
+// then the unit type's field policy is applied to the input and response.
+func (d *Dependencies) handlersFor(event *appsync.AppSyncEvent) *handlers.AuthorizedHandlers {
+	var unitHandlers handlers.CRUDHandlers = d.Handlers
+	if d.Config.IsDynamicUnitType(event.GetUnitType()) {
+		unitHandlers = d.DynamicHandlers
+	}
+
+	withPolicies := handlers.NewFieldPolicyHandlers(unitHandlers, d.FieldPolicies).WithAdminGroup(d.Config.AdminGroup)
+	return handlers.NewAuthorizedHandlers(withPolicies, d.Authorizer)
+}
+
+// actorFor identifies the caller of an AppSync request for the unit history
+func actorFor(identity appsync.Identity) models.Actor {
+	actor := models.Actor{Sub: identity.Sub, Username: identity.Username}
+	if len(identity.SourceIP) > 0 {
+		actor.SourceIP = identity.SourceIP[0]
+	}
+	return actor
+}
+
 // handler is the main lambda handler function
 func handler(ctx context.Context, event json.RawMessage) (*appsync.Response, error) {
 	log.Printf("Lambda invoked with event: %s", string(event))
@@ -85,27 +192,121 @@ func handler(ctx context.Context, event json.RawMessage) (*appsync.Response, err
 	// Always dump the event for debugging (as requested)
 	deps.Handlers.DumpEvent(ctx, &appSyncEvent)
 
+	// Writes record who made them in the unit's history
+	ctx = repository.WithActor(ctx, actorFor(appSyncEvent.Identity))
+
+	// Select the handler set for the unit type
+	unitHandlers := deps.handlersFor(&appSyncEvent)
+
 	// Route to appropriate handler based on operation type
 	switch appSyncEvent.GetOperationType() {
 	case appsync.OperationTypeCreate:
 		log.Println("Routing to Create handler")
-		return deps.Handlers.HandleCreate(ctx, &appSyncEvent)
+		return unitHandlers.HandleCreate(ctx, &appSyncEvent)
 
 	case appsync.OperationTypeRead:
 		log.Println("Routing to Read handler")
-		return deps.Handlers.HandleRead(ctx, &appSyncEvent)
+		return unitHandlers.HandleRead(ctx, &appSyncEvent)
+
+	case appsync.OperationTypeGetByID:
+		log.Println("Routing to GetByID handler")
+		return unitHandlers.HandleGetByID(ctx, &appSyncEvent)
+
+	case appsync.OperationTypeGetByVin:
+		log.Println("Routing to GetByVin handler")
+		return unitHandlers.HandleGetByVin(ctx, &appSyncEvent)
+
+	case appsync.OperationTypeSearchByVin:
+		log.Println("Routing to SearchByVin handler")
+		return unitHandlers.HandleSearchByVin(ctx, &appSyncEvent)
+
+	case appsync.OperationTypeImport:
+		log.Println("Routing to Import handler")
+		return unitHandlers.HandleImport(ctx, &appSyncEvent)
+
+	case appsync.OperationTypeExport:
+		log.Println("Routing to Export handler")
+		return unitHandlers.HandleExport(ctx, &appSyncEvent)
+
+	case appsync.OperationTypeBatchGet:
+		log.Println("Routing to BatchGet handler")
+		return unitHandlers.HandleBatchGet(ctx, &appSyncEvent)
+
+	case appsync.OperationTypeBatchCreate:
+		log.Println("Routing to BatchCreate handler")
+		return unitHandlers.HandleBatchCreate(ctx, &appSyncEvent)
+
+	case appsync.OperationTypeBatchDelete:
+		log.Println("Routing to BatchDelete handler")
+		return unitHandlers.HandleBatchDelete(ctx, &appSyncEvent)
+
+	case appsync.OperationTypeTransact:
+		log.Println("Routing to Transact handler")
+		return unitHandlers.HandleTransact(ctx, &appSyncEvent)
 
 	case appsync.OperationTypeUpdate:
 		log.Println("Routing to Update handler")
-		return deps.Handlers.HandleUpdate(ctx, &appSyncEvent)
+		return unitHandlers.HandleUpdate(ctx, &appSyncEvent)
 
 	case appsync.OperationTypeDelete:
 		log.Println("Routing to Delete handler")
-		return deps.Handlers.HandleDelete(ctx, &appSyncEvent)
+		return unitHandlers.HandleDelete(ctx, &appSyncEvent)
 
 	case appsync.OperationTypeList:
 		log.Println("Routing to List handler")
-		return deps.Handlers.HandleList(ctx, &appSyncEvent)
+		return unitHandlers.HandleList(ctx, &appSyncEvent)
+
+	case appsync.OperationTypeRestore:
+		log.Println("Routing to Restore handler")
+		return unitHandlers.HandleRestore(ctx, &appSyncEvent)
+
+	case appsync.OperationTypeListDeleted:
+		log.Println("Routing to ListDeleted handler")
+		return unitHandlers.HandleListDeleted(ctx, &appSyncEvent)
+
+	case appsync.OperationTypeGetHistory:
+		log.Println("Routing to GetHistory handler")
+		return unitHandlers.HandleGetHistory(ctx, &appSyncEvent)
+
+	case appsync.OperationTypePurge:
+		log.Println("Routing to Purge handler")
+		return unitHandlers.HandlePurge(ctx, &appSyncEvent)
+
+	case appsync.OperationTypeDecodeVin:
+		log.Println("Routing to DecodeVin handler")
+		return deps.Handlers.HandleDecodeVin(ctx, &appSyncEvent)
+
+	case appsync.OperationTypeListUnitTypes:
+		log.Println("Routing to ListUnitTypes handler")
+		return deps.SchemaHandlers.HandleListUnitTypes(ctx, &appSyncEvent)
+
+	case appsync.OperationTypeGetUnitTypeSchema:
+		log.Println("Routing to GetUnitTypeSchema handler")
+		return deps.SchemaHandlers.HandleGetUnitTypeSchema(ctx, &appSyncEvent)
+
+	case appsync.OperationTypeCreateWebhookSubscription:
+		log.Println("Routing to CreateWebhookSubscription handler")
+		return deps.WebhookHandlers.HandleCreateSubscription(ctx, &appSyncEvent)
+
+	case appsync.OperationTypeGetWebhookSubscription:
+		log.Println("Routing to GetWebhookSubscription handler")
+		return deps.WebhookHandlers.HandleGetSubscription(ctx, &appSyncEvent)
+
+	case appsync.OperationTypeListWebhookSubscriptions:
+		log.Println("Routing to ListWebhookSubscriptions handler")
+		return deps.WebhookHandlers.HandleListSubscriptions(ctx, &appSyncEvent)
+
+	case appsync.OperationTypeUpdateWebhookSubscription:
+		log.Println("Routing to UpdateWebhookSubscription handler")
+		return deps.WebhookHandlers.HandleUpdateSubscription(ctx, &appSyncEvent)
+
+	case appsync.OperationTypeDeleteWebhookSubscription:
+		log.Println("Routing to DeleteWebhookSubscription handler")
+		return deps.WebhookHandlers.HandleDeleteSubscription(ctx, &appSyncEvent)
+
+	case appsync.OperationTypeListWebhookDeliveries:
+		log.Println("Routing to ListWebhookDeliveries handler")
+		return deps.WebhookHandlers.HandleListDeliveries(ctx, &appSyncEvent)
 
 	default:
 		log.Printf("Unknown operation type: %s", appSyncEvent.FieldName)
@@ -125,6 +326,20 @@ func main() {
 	log.Printf("Table Name: %s", deps.Config.TableName)
 	log.Printf("Region: %s", deps.Config.Region)
 	log.Printf("Log Level: %s", deps.Config.LogLevel)
+	log.Printf("Dynamic Unit Types: %v", deps.Config.DynamicUnitTypes)
+	log.Printf("Deleted Unit Retention: %s", deps.Config.DeletedRetention)
+	if deps.Config.MembershipTableName != "" {
+		log.Printf("Account Authorization: membership table %s", deps.Config.MembershipTableName)
+	} else {
+		log.Printf("Account Authorization: claim %s", deps.Config.AccountClaim)
+	}
+	log.Printf("Registered Unit Types: %v", deps.SchemaRegistry.UnitTypes())
+	log.Printf("VIN Decoder: %s", deps.Config.VinDecoderURL)
+	if deps.Config.ExportBucket != "" {
+		log.Printf("Export Bucket: %s", deps.Config.ExportBucket)
+	} else {
+		log.Printf("Export Bucket: not configured; exportUnits is disabled")
+	}
 
 	// Check if running in local development mode
 	if os.Getenv("LOCAL_DEV") == "true" {
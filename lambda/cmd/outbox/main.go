@@ -0,0 +1,71 @@
+// Command outbox publishes the unit domain events waiting in the outbox to the
+// configured EventBridge event bus, removing each one once it is published.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+
+	internalConfig "github.com/steverhoton/unt-units-svc/internal/config"
+	"github.com/steverhoton/unt-units-svc/internal/events"
+	"github.com/steverhoton/unt-units-svc/internal/repository"
+)
+
+func main() {
+	log.SetPrefix("[UNT-UNITS-OUTBOX] ")
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	accountID := flag.String("account", "", "Only publish events for this account (queries one outbox instead of scanning)")
+	eventBus := flag.String("event-bus", "", "EventBridge event bus to publish to (default: EVENT_BUS_NAME)")
+	dryRun := flag.Bool("dry-run", false, "Count waiting events without publishing them")
+	pageSize := flag.Int("page-size", 100, "DynamoDB page size")
+	flag.Parse()
+
+	// Load configuration (TABLE_NAME, AWS_REGION, EVENT_BUS_NAME)
+	cfg, err := internalConfig.New()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	busName := cfg.EventBusName
+	if *eventBus != "" {
+		busName = *eventBus
+	}
+	if busName == "" && !*dryRun {
+		log.Fatalf("No event bus; set EVENT_BUS_NAME or -event-bus to publish unit events")
+	}
+
+	ctx := context.Background()
+
+	awsCfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(cfg.Region))
+	if err != nil {
+		log.Fatalf("Failed to load AWS configuration: %v", err)
+	}
+
+	publisher := events.NewEventBridgePublisher(eventbridge.NewFromConfig(awsCfg), busName)
+	relay := repository.NewOutboxRelay(dynamodb.NewFromConfig(awsCfg), cfg.TableName, publisher)
+
+	opts := repository.OutboxRelayOptions{
+		AccountID: *accountID,
+		DryRun:    *dryRun,
+		PageSize:  int32(*pageSize),
+	}
+
+	log.Printf("Starting outbox relay on table %s (account=%q, eventBus=%q, dryRun=%t)", cfg.TableName, opts.AccountID, busName, opts.DryRun)
+
+	result, err := relay.Relay(ctx, opts)
+	if err != nil {
+		log.Fatalf("Outbox relay failed after scanning %d items: %v", result.Scanned, err)
+	}
+
+	log.Printf("Outbox relay complete: scanned=%d waiting=%d published=%d failed=%d held=%d", result.Scanned, result.Waiting, result.Published, result.Failed, result.Held)
+	if result.Failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,70 @@
+// Command purge permanently removes units that have been soft deleted for longer
+// than the configured retention period.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	internalConfig "github.com/steverhoton/unt-units-svc/internal/config"
+	"github.com/steverhoton/unt-units-svc/internal/repository"
+)
+
+func main() {
+	log.SetPrefix("[UNT-UNITS-PURGE] ")
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	accountID := flag.String("account", "", "Only purge units for this account (queries one partition instead of scanning)")
+	retentionDays := flag.Int("retention-days", -1, "Days a unit must have been deleted before it is purged (default: DELETED_UNIT_RETENTION_DAYS)")
+	dryRun := flag.Bool("dry-run", false, "Count expired units without deleting them")
+	pageSize := flag.Int("page-size", 100, "DynamoDB page size")
+	flag.Parse()
+
+	// Load configuration (TABLE_NAME, AWS_REGION, DELETED_UNIT_RETENTION_DAYS)
+	cfg, err := internalConfig.New()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	retention := cfg.DeletedRetention
+	if *retentionDays >= 0 {
+		retention = time.Duration(*retentionDays) * 24 * time.Hour
+	}
+	if retention <= 0 {
+		log.Fatalf("Retention is disabled; set DELETED_UNIT_RETENTION_DAYS or -retention-days to purge deleted units")
+	}
+
+	ctx := context.Background()
+
+	awsCfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(cfg.Region))
+	if err != nil {
+		log.Fatalf("Failed to load AWS configuration: %v", err)
+	}
+
+	purger := repository.NewPurger(dynamodb.NewFromConfig(awsCfg), cfg.TableName)
+
+	opts := repository.PurgeOptions{
+		AccountID: *accountID,
+		Retention: retention,
+		DryRun:    *dryRun,
+		PageSize:  int32(*pageSize),
+	}
+
+	log.Printf("Starting purge on table %s (account=%q, retention=%s, dryRun=%t)", cfg.TableName, opts.AccountID, opts.Retention, opts.DryRun)
+
+	result, err := purger.PurgeExpired(ctx, opts)
+	if err != nil {
+		log.Fatalf("Purge failed after scanning %d items: %v", result.Scanned, err)
+	}
+
+	log.Printf("Purge complete: scanned=%d expired=%d purged=%d skipped=%d failed=%d", result.Scanned, result.Expired, result.Purged, result.Skipped, result.Failed)
+	if result.Failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,100 @@
+// Command streams is the Lambda that consumes the DynamoDB stream of the units
+// table and publishes each change of a unit to the sinks named in STREAM_SINKS.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+
+	internalConfig "github.com/steverhoton/unt-units-svc/internal/config"
+	"github.com/steverhoton/unt-units-svc/internal/events"
+	"github.com/steverhoton/unt-units-svc/internal/repository"
+	"github.com/steverhoton/unt-units-svc/internal/streams"
+	"github.com/steverhoton/unt-units-svc/internal/webhooks"
+)
+
+// webhookTimeout bounds each post of the webhook sink
+const webhookTimeout = 10 * time.Second
+
+// subscriptionTimeout bounds each post to an account's webhook subscription, which
+// may be retried several times within one invocation
+const subscriptionTimeout = 5 * time.Second
+
+// newSink builds the publisher of one sink named in STREAM_SINKS
+func newSink(name string, cfg *internalConfig.Config, awsCfg aws.Config) (events.Publisher, error) {
+	switch name {
+	case "sns":
+		if cfg.SNSTopicARN == "" {
+			return nil, fmt.Errorf("the sns sink requires SNS_TOPIC_ARN")
+		}
+		return events.NewSNSPublisher(sns.NewFromConfig(awsCfg), cfg.SNSTopicARN), nil
+	case "eventbridge":
+		if cfg.EventBusName == "" {
+			return nil, fmt.Errorf("the eventbridge sink requires EVENT_BUS_NAME")
+		}
+		return events.NewEventBridgePublisher(eventbridge.NewFromConfig(awsCfg), cfg.EventBusName), nil
+	case "webhook":
+		if cfg.StreamWebhookURL == "" {
+			return nil, fmt.Errorf("the webhook sink requires STREAM_WEBHOOK_URL")
+		}
+		return events.NewWebhookPublisher(cfg.StreamWebhookURL, &http.Client{Timeout: webhookTimeout}), nil
+	case "subscriptions":
+		store := repository.NewDynamoDBWebhookRepository(dynamodb.NewFromConfig(awsCfg), cfg.TableName).
+			WithDeliveryRetention(cfg.WebhookDeliveryRetention)
+		client := &http.Client{
+			Timeout: subscriptionTimeout,
+			// A redirect fails the delivery rather than sending the event somewhere the account did not subscribe
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		}
+		return webhooks.NewDeliverer(store, client).
+			WithRetry(cfg.WebhookMaxAttempts, webhooks.DefaultBaseDelay, webhooks.DefaultMaxDelay).
+			WithDisableAfter(cfg.WebhookDisableAfter), nil
+	default:
+		return nil, fmt.Errorf("unknown stream sink %q; use sns, eventbridge, webhook or subscriptions", name)
+	}
+}
+
+func main() {
+	log.SetPrefix("[UNT-UNITS-STREAMS] ")
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	// Load configuration (TABLE_NAME, AWS_REGION, STREAM_SINKS and the settings of each sink)
+	cfg, err := internalConfig.New()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if len(cfg.StreamSinks) == 0 {
+		log.Fatalf("No stream sinks; set STREAM_SINKS to sns, eventbridge, webhook and/or subscriptions")
+	}
+
+	awsCfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(cfg.Region))
+	if err != nil {
+		log.Fatalf("Failed to load AWS configuration: %v", err)
+	}
+
+	var sinks []events.Publisher
+	for _, name := range cfg.StreamSinks {
+		sink, err := newSink(name, cfg, awsCfg)
+		if err != nil {
+			log.Fatalf("Failed to configure stream sinks: %v", err)
+		}
+		sinks = append(sinks, sink)
+	}
+
+	log.Printf("Starting UNT Units Streams Lambda")
+	log.Printf("Table Name: %s", cfg.TableName)
+	log.Printf("Stream Sinks: %v", cfg.StreamSinks)
+
+	handler := streams.NewHandler(events.NewFanoutPublisher(sinks...))
+	lambda.Start(handler.Handle)
+}
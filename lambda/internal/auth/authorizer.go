@@ -0,0 +1,87 @@
+// Package auth decides which accounts an AppSync caller may act on.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/steverhoton/unt-units-svc/internal/config"
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+// ErrForbidden is returned when the caller may not act on the requested account
+var ErrForbidden = errors.New("forbidden")
+
+// AccountResolver resolves the accounts a caller is allowed to act on
+type AccountResolver interface {
+	AllowedAccounts(ctx context.Context, identity appsync.Identity) ([]string, error)
+}
+
+// Authorizer checks the accountId of a request against the caller's identity.
+// Members of the admin group may act on any account.
+type Authorizer struct {
+	resolver   AccountResolver
+	adminGroup string
+}
+
+// NewAuthorizer creates an authorizer that resolves accounts with resolver
+func NewAuthorizer(resolver AccountResolver, adminGroup string) *Authorizer {
+	return &Authorizer{
+		resolver:   resolver,
+		adminGroup: adminGroup,
+	}
+}
+
+// IsAdmin reports whether the caller may act across accounts
+func (a *Authorizer) IsAdmin(identity appsync.Identity) bool {
+	return a.adminGroup != "" && identity.InGroup(a.adminGroup)
+}
+
+// AllowedAccounts returns the accounts the caller may act on. Administrators get
+// a nil slice with admin set, since they are not limited to a list.
+func (a *Authorizer) AllowedAccounts(ctx context.Context, identity appsync.Identity) (accounts []string, admin bool, err error) {
+	if a.IsAdmin(identity) {
+		return nil, true, nil
+	}
+	accounts, err = a.resolver.AllowedAccounts(ctx, identity)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to resolve accounts for %s: %w", identity.Principal(), err)
+	}
+	return accounts, false, nil
+}
+
+// Authorize returns ErrForbidden unless the caller may act on accountID
+func (a *Authorizer) Authorize(ctx context.Context, identity appsync.Identity, accountID string) error {
+	accounts, admin, err := a.AllowedAccounts(ctx, identity)
+	if err != nil {
+		return err
+	}
+	if admin {
+		return nil
+	}
+	for _, account := range accounts {
+		if account == accountID {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q may not access account %s", ErrForbidden, identity.Principal(), accountID)
+}
+
+// ClaimAccountResolver reads the caller's accounts from a token claim
+type ClaimAccountResolver struct {
+	claim string
+}
+
+// NewClaimAccountResolver creates a resolver for the named claim, defaulting to config.DefaultAccountClaim
+func NewClaimAccountResolver(claim string) *ClaimAccountResolver {
+	if claim == "" {
+		claim = config.DefaultAccountClaim
+	}
+	return &ClaimAccountResolver{claim: claim}
+}
+
+// AllowedAccounts returns the values of the account claim
+func (r *ClaimAccountResolver) AllowedAccounts(_ context.Context, identity appsync.Identity) ([]string, error) {
+	return identity.Claims.Values(r.claim), nil
+}
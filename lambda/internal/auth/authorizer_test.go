@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+func claimIdentity(claims map[string]interface{}, groups ...string) appsync.Identity {
+	return appsync.Identity{
+		Sub:      "sub-1",
+		Username: "dispatcher",
+		Groups:   groups,
+		Claims:   appsync.Claims{Raw: claims},
+	}
+}
+
+func TestAuthorizer_Authorize(t *testing.T) {
+	authorizer := NewAuthorizer(NewClaimAccountResolver(""), "admin")
+
+	tests := []struct {
+		name      string
+		identity  appsync.Identity
+		accountID string
+		wantErr   bool
+	}{
+		{
+			name:      "account in claim",
+			identity:  claimIdentity(map[string]interface{}{"custom:accountId": "account-1,account-2"}),
+			accountID: "account-2",
+		},
+		{
+			name:      "account not in claim",
+			identity:  claimIdentity(map[string]interface{}{"custom:accountId": "account-1"}),
+			accountID: "account-2",
+			wantErr:   true,
+		},
+		{
+			name:      "no claim",
+			identity:  claimIdentity(nil),
+			accountID: "account-1",
+			wantErr:   true,
+		},
+		{
+			name:      "admin acts across accounts",
+			identity:  claimIdentity(nil, "admin"),
+			accountID: "account-9",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := authorizer.Authorize(context.Background(), tt.identity, tt.accountID)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrForbidden)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestAuthorizer_CustomClaimAndNoAdminGroup(t *testing.T) {
+	authorizer := NewAuthorizer(NewClaimAccountResolver("tenants"), "")
+	identity := claimIdentity(map[string]interface{}{
+		"tenants":          []interface{}{"account-3"},
+		"custom:accountId": "account-1",
+	}, "admin")
+
+	assert.NoError(t, authorizer.Authorize(context.Background(), identity, "account-3"))
+	assert.ErrorIs(t, authorizer.Authorize(context.Background(), identity, "account-1"), ErrForbidden)
+	assert.False(t, authorizer.IsAdmin(identity))
+}
+
+type fakeMembershipTable struct {
+	pages  []*dynamodb.QueryOutput
+	inputs []*dynamodb.QueryInput
+	err    error
+}
+
+func (f *fakeMembershipTable) Query(_ context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	f.inputs = append(f.inputs, params)
+	if f.err != nil {
+		return nil, f.err
+	}
+	page := f.pages[0]
+	f.pages = f.pages[1:]
+	return page, nil
+}
+
+func membership(accountID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{"accountId": &types.AttributeValueMemberS{Value: accountID}}
+}
+
+func TestMembershipAccountResolver(t *testing.T) {
+	lastKey := map[string]types.AttributeValue{"principal": &types.AttributeValueMemberS{Value: "sub-1"}}
+	table := &fakeMembershipTable{pages: []*dynamodb.QueryOutput{
+		{Items: []map[string]types.AttributeValue{membership("account-1")}, LastEvaluatedKey: lastKey},
+		{Items: []map[string]types.AttributeValue{membership("account-2")}},
+	}}
+	authorizer := NewAuthorizer(NewMembershipAccountResolver(table, "memberships"), "admin")
+
+	accounts, admin, err := authorizer.AllowedAccounts(context.Background(), claimIdentity(nil))
+	require.NoError(t, err)
+	assert.False(t, admin)
+	assert.Equal(t, []string{"account-1", "account-2"}, accounts)
+
+	require.Len(t, table.inputs, 2)
+	assert.Equal(t, "memberships", *table.inputs[0].TableName)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "sub-1"}, table.inputs[0].ExpressionAttributeValues[":principal"])
+	assert.Equal(t, lastKey, table.inputs[1].ExclusiveStartKey)
+}
+
+func TestMembershipAccountResolver_Errors(t *testing.T) {
+	table := &fakeMembershipTable{err: errors.New("throttled")}
+	authorizer := NewAuthorizer(NewMembershipAccountResolver(table, "memberships"), "admin")
+
+	err := authorizer.Authorize(context.Background(), claimIdentity(nil), "account-1")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrForbidden)
+	assert.Contains(t, err.Error(), "throttled")
+
+	// Callers without a principal have no memberships to look up
+	err = authorizer.Authorize(context.Background(), appsync.Identity{}, "account-1")
+	assert.ErrorIs(t, err, ErrForbidden)
+}
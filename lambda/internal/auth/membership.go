@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+// MembershipQueryAPI is the part of the DynamoDB client the membership lookup uses
+type MembershipQueryAPI interface {
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+}
+
+// MembershipAccountResolver looks the caller's accounts up in a membership table
+// keyed by principal (the identity's sub) with one item per accountId
+type MembershipAccountResolver struct {
+	client    MembershipQueryAPI
+	tableName string
+}
+
+// NewMembershipAccountResolver creates a resolver backed by the membership table
+func NewMembershipAccountResolver(client MembershipQueryAPI, tableName string) *MembershipAccountResolver {
+	return &MembershipAccountResolver{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+// AllowedAccounts queries every membership of the caller
+func (r *MembershipAccountResolver) AllowedAccounts(ctx context.Context, identity appsync.Identity) ([]string, error) {
+	principal := identity.Sub
+	if principal == "" {
+		principal = identity.UserArn
+	}
+	if principal == "" {
+		return nil, nil
+	}
+
+	var accounts []string
+	var startKey map[string]types.AttributeValue
+	for {
+		output, err := r.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(r.tableName),
+			KeyConditionExpression: aws.String("principal = :principal"),
+			ProjectionExpression:   aws.String("accountId"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":principal": &types.AttributeValueMemberS{Value: principal},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to query account memberships: %w", err)
+		}
+
+		for _, item := range output.Items {
+			if account, ok := item["accountId"].(*types.AttributeValueMemberS); ok && account.Value != "" {
+				accounts = append(accounts, account.Value)
+			}
+		}
+
+		if output.LastEvaluatedKey == nil {
+			return accounts, nil
+		}
+		startKey = output.LastEvaluatedKey
+	}
+}
@@ -0,0 +1,73 @@
+// Package blobstore stores files such as unit exports. The Lambda writes to S3;
+// tests and local tools use the in-memory store.
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Store writes objects under a key
+type Store interface {
+	// Put writes size bytes from body under key and returns the object's location
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) (string, error)
+}
+
+// URLSigner is implemented by stores that can hand out temporary download links
+type URLSigner interface {
+	// PresignGet returns a URL that downloads the object under key until ttl has passed
+	PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error)
+}
+
+// Object is an object held by a MemoryStore
+type Object struct {
+	Body        []byte
+	ContentType string
+}
+
+// MemoryStore is a Store that keeps objects in memory
+type MemoryStore struct {
+	mu      sync.Mutex
+	objects map[string]Object
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{objects: make(map[string]Object)}
+}
+
+// Put reads body into memory under key
+func (s *MemoryStore) Put(_ context.Context, key string, body io.Reader, size int64, contentType string) (string, error) {
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read object %s: %w", key, err)
+	}
+	if n != size {
+		return "", fmt.Errorf("object %s has %d bytes, expected %d", key, n, size)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = Object{Body: buf.Bytes(), ContentType: contentType}
+	return "memory://" + key, nil
+}
+
+// Get returns the object under key
+func (s *MemoryStore) Get(key string) (Object, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	object, ok := s.objects[key]
+	return object, ok
+}
+
+// Len returns the number of objects held
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.objects)
+}
@@ -0,0 +1,114 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	location, err := store.Put(context.Background(), "exports/a.csv", strings.NewReader("id\n"), 3, "text/csv")
+	require.NoError(t, err)
+	assert.Equal(t, "memory://exports/a.csv", location)
+
+	object, ok := store.Get("exports/a.csv")
+	require.True(t, ok)
+	assert.Equal(t, "id\n", string(object.Body))
+	assert.Equal(t, "text/csv", object.ContentType)
+	assert.Equal(t, 1, store.Len())
+
+	_, err = store.Put(context.Background(), "exports/b.csv", strings.NewReader("id\n"), 10, "text/csv")
+	assert.EqualError(t, err, "object exports/b.csv has 3 bytes, expected 10")
+}
+
+// fakeS3 records PutObject requests, with their bodies, and answers them with putObject
+type fakeS3 struct {
+	inputs    []*s3.PutObjectInput
+	bodies    []string
+	putObject func(input *s3.PutObjectInput) (*s3.PutObjectOutput, error)
+}
+
+func (f *fakeS3) PutObject(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.inputs = append(f.inputs, params)
+	f.bodies = append(f.bodies, string(body))
+	if f.putObject == nil {
+		return &s3.PutObjectOutput{}, nil
+	}
+	return f.putObject(params)
+}
+
+// testPresigner presigns with static credentials, which needs no network
+func testPresigner(region string) *s3.PresignClient {
+	client := s3.New(s3.Options{
+		Region:      region,
+		Credentials: credentials.NewStaticCredentialsProvider("AKIDEXAMPLE", "secret", "session"),
+	})
+	return s3.NewPresignClient(client)
+}
+
+func TestS3Store_Put(t *testing.T) {
+	client := &fakeS3{}
+	store := NewS3Store(client, testPresigner("us-east-1"), "exports-bucket")
+
+	location, err := store.Put(context.Background(), "exports/account 1/units.csv", strings.NewReader("id\nunit-1\n"), 10, "text/csv")
+	require.NoError(t, err)
+	assert.Equal(t, "s3://exports-bucket/exports/account 1/units.csv", location)
+
+	require.Len(t, client.inputs, 1)
+	input := client.inputs[0]
+	assert.Equal(t, "exports-bucket", aws.ToString(input.Bucket))
+	assert.Equal(t, "exports/account 1/units.csv", aws.ToString(input.Key))
+	assert.Equal(t, int64(10), aws.ToInt64(input.ContentLength))
+	assert.Equal(t, "text/csv", aws.ToString(input.ContentType))
+	assert.Equal(t, "id\nunit-1\n", client.bodies[0])
+}
+
+func TestS3Store_PutError(t *testing.T) {
+	client := &fakeS3{
+		putObject: func(*s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+			return nil, errors.New("AccessDenied")
+		},
+	}
+	store := NewS3Store(client, testPresigner("us-east-1"), "exports-bucket")
+
+	_, err := store.Put(context.Background(), "exports/units.csv", strings.NewReader("id\n"), 3, "text/csv")
+	assert.EqualError(t, err, "failed to upload exports/units.csv: AccessDenied")
+
+	_, err = store.Put(context.Background(), "", strings.NewReader(""), 0, "text/csv")
+	assert.EqualError(t, err, "key is required")
+}
+
+func TestS3Store_PresignGet(t *testing.T) {
+	store := NewS3Store(&fakeS3{}, testPresigner("eu-west-1"), "exports-bucket")
+
+	signed, err := store.PresignGet(context.Background(), "exports/account 1/units.csv", 15*time.Minute)
+	require.NoError(t, err)
+
+	u, err := url.Parse(signed)
+	require.NoError(t, err)
+	assert.Equal(t, "exports-bucket.s3.eu-west-1.amazonaws.com", u.Host)
+	assert.Equal(t, "/exports/account%201/units.csv", u.EscapedPath())
+	query := u.Query()
+	assert.Equal(t, "900", query.Get("X-Amz-Expires"))
+	assert.Equal(t, "AWS4-HMAC-SHA256", query.Get("X-Amz-Algorithm"))
+	assert.True(t, strings.HasPrefix(query.Get("X-Amz-Credential"), "AKIDEXAMPLE/"), query.Get("X-Amz-Credential"))
+	assert.NotEmpty(t, query.Get("X-Amz-Signature"))
+
+	_, err = store.PresignGet(context.Background(), "exports/units.csv", 8*24*time.Hour)
+	assert.Error(t, err)
+}
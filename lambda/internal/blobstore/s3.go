@@ -0,0 +1,77 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// maxPresignTTL is the longest lifetime S3 accepts for a presigned URL
+const maxPresignTTL = 7 * 24 * time.Hour
+
+// S3API is the part of the S3 client the store uses
+type S3API interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// S3PresignAPI is the part of the S3 presign client the store uses
+type S3PresignAPI interface {
+	PresignGetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
+}
+
+// S3Store is a Store that writes objects to an S3 bucket and presigns downloads of them
+type S3Store struct {
+	client    S3API
+	presigner S3PresignAPI
+	bucket    string
+}
+
+// NewS3Store creates a store writing to bucket with client and presigning URLs with presigner
+func NewS3Store(client S3API, presigner S3PresignAPI, bucket string) *S3Store {
+	return &S3Store{
+		client:    client,
+		presigner: presigner,
+		bucket:    bucket,
+	}
+}
+
+// Put uploads body under key with a single PutObject request and returns its s3:// location
+func (s *S3Store) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) (string, error) {
+	if key == "" {
+		return "", errors.New("key is required")
+	}
+
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+		ContentType:   aws.String(contentType),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	return "s3://" + s.bucket + "/" + key, nil
+}
+
+// PresignGet returns a GetObject URL for key that expires after ttl
+func (s *S3Store) PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	if ttl <= 0 || ttl > maxPresignTTL {
+		return "", fmt.Errorf("presigned URL lifetime must be between 1s and %s", maxPresignTTL)
+	}
+
+	request, err := s.presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign URL: %w", err)
+	}
+	return request.URL, nil
+}
@@ -3,6 +3,41 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultDeletedRetentionDays is how long soft deleted units are kept before they expire
+	DefaultDeletedRetentionDays = 30
+
+	// DefaultPaginationTokenTTLMinutes is how long a listing's nextToken stays valid
+	DefaultPaginationTokenTTLMinutes = 60
+
+	// DefaultAccountClaim is the identity token claim listing a caller's accounts
+	DefaultAccountClaim = "custom:accountId"
+
+	// DefaultAdminGroup is the identity group allowed to run administrative operations
+	DefaultAdminGroup = "admin"
+
+	// DefaultVinDecoderURL is the NHTSA vPIC vehicles API used to decode VINs
+	DefaultVinDecoderURL = "https://vpic.nhtsa.dot.gov/api/vehicles"
+
+	// DefaultVinDecoderTimeoutSeconds bounds each VIN decode request
+	DefaultVinDecoderTimeoutSeconds = 10
+
+	// DefaultExportURLTTLMinutes is how long an export's download link stays valid
+	DefaultExportURLTTLMinutes = 60
+
+	// DefaultWebhookMaxAttempts is how many times an event is posted to a webhook before it fails
+	DefaultWebhookMaxAttempts = 4
+
+	// DefaultWebhookDisableAfter is how many events in a row may fail before a webhook subscription is disabled
+	DefaultWebhookDisableAfter = 10
+
+	// DefaultWebhookDeliveryRetentionDays is how long webhook delivery attempts are kept
+	DefaultWebhookDeliveryRetentionDays = 14
 )
 
 // Config holds the application configuration
@@ -10,6 +45,89 @@ type Config struct {
 	TableName string
 	Region    string
 	LogLevel  string
+
+	// DynamicUnitTypes lists the unit types served by the schema-driven
+	// DynamicUnit handlers instead of the legacy models.Unit handlers
+	DynamicUnitTypes []string
+
+	// SchemaDir is an optional directory of additional unit type schemas
+	// loaded on top of the embedded ones
+	SchemaDir string
+
+	// FieldPolicyDir is an optional directory of additional field policies
+	// loaded on top of the embedded ones
+	FieldPolicyDir string
+
+	// SchemaMigrationWriteBack persists units upgraded to the latest schema
+	// version on read instead of only upgrading them in memory
+	SchemaMigrationWriteBack bool
+
+	// DeletedRetention is how long soft deleted units are kept before the DynamoDB
+	// TTL and the purge job remove them permanently; zero keeps them forever
+	DeletedRetention time.Duration
+
+	// AdminGroup is the identity group allowed to run administrative operations such as purgeUnit
+	AdminGroup string
+
+	// PaginationTokenKey is the HMAC key that signs nextToken values; it must be
+	// shared by every Lambda instance for tokens to survive between invocations
+	PaginationTokenKey string
+
+	// PaginationTokenTTL is how long a nextToken stays valid
+	PaginationTokenTTL time.Duration
+
+	// AccountClaim is the identity token claim listing the accounts a caller may act on
+	AccountClaim string
+
+	// MembershipTableName is an optional table of principal/accountId memberships; when
+	// set, callers' accounts are looked up there instead of read from AccountClaim
+	MembershipTableName string
+
+	// VinDecoderURL is the base URL of the vPIC-compatible API that decodes VINs
+	VinDecoderURL string
+
+	// VinDecoderTimeout bounds each VIN decode request
+	VinDecoderTimeout time.Duration
+
+	// ExportBucket is the S3 bucket exportUnits writes to; exports are disabled when it is empty
+	ExportBucket string
+
+	// ExportURLTTL is how long the presigned download link of an export stays valid
+	ExportURLTTL time.Duration
+
+	// UnitHistory records an immutable history item for every write to a unit; it is on
+	// unless UNIT_HISTORY_ENABLED is "false"
+	UnitHistory bool
+
+	// UnitEvents writes a domain event to the outbox with every write to a unit; it is
+	// off unless UNIT_EVENTS_ENABLED is "true"
+	UnitEvents bool
+
+	// EventBusName is the EventBridge bus the outbox relay and the eventbridge stream
+	// sink publish unit events to
+	EventBusName string
+
+	// StreamSinks names the sinks the streams Lambda publishes unit changes to:
+	// sns, eventbridge, webhook and subscriptions
+	StreamSinks []string
+
+	// SNSTopicARN is the topic the sns stream sink publishes to
+	SNSTopicARN string
+
+	// StreamWebhookURL is the URL the webhook stream sink posts each event to
+	StreamWebhookURL string
+
+	// WebhookMaxAttempts is how many times the subscriptions stream sink posts an
+	// event to a subscription's endpoint before the delivery fails
+	WebhookMaxAttempts int
+
+	// WebhookDisableAfter is how many events in a row may fail to reach a webhook
+	// subscription before it is disabled; zero never disables subscriptions
+	WebhookDisableAfter int
+
+	// WebhookDeliveryRetention is how long webhook delivery attempts are kept before
+	// their TTL expires; zero keeps them forever
+	WebhookDeliveryRetention time.Duration
 }
 
 // New creates a new configuration from environment variables
@@ -29,9 +147,144 @@ func New() (*Config, error) {
 		logLevel = "INFO" // Default log level
 	}
 
+	retentionDays := DefaultDeletedRetentionDays
+	if value := os.Getenv("DELETED_UNIT_RETENTION_DAYS"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 {
+			return nil, fmt.Errorf("DELETED_UNIT_RETENTION_DAYS must be a non-negative number of days, got %q", value)
+		}
+		retentionDays = days
+	}
+
+	tokenTTLMinutes := DefaultPaginationTokenTTLMinutes
+	if value := os.Getenv("PAGINATION_TOKEN_TTL_MINUTES"); value != "" {
+		minutes, err := strconv.Atoi(value)
+		if err != nil || minutes <= 0 {
+			return nil, fmt.Errorf("PAGINATION_TOKEN_TTL_MINUTES must be a positive number of minutes, got %q", value)
+		}
+		tokenTTLMinutes = minutes
+	}
+
+	adminGroup := os.Getenv("ADMIN_GROUP")
+	if adminGroup == "" {
+		adminGroup = DefaultAdminGroup
+	}
+
+	accountClaim := os.Getenv("ACCOUNT_CLAIM")
+	if accountClaim == "" {
+		accountClaim = DefaultAccountClaim
+	}
+
+	vinDecoderURL := os.Getenv("VIN_DECODER_URL")
+	if vinDecoderURL == "" {
+		vinDecoderURL = DefaultVinDecoderURL
+	}
+
+	vinDecoderTimeoutSeconds := DefaultVinDecoderTimeoutSeconds
+	if value := os.Getenv("VIN_DECODER_TIMEOUT_SECONDS"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			return nil, fmt.Errorf("VIN_DECODER_TIMEOUT_SECONDS must be a positive number of seconds, got %q", value)
+		}
+		vinDecoderTimeoutSeconds = seconds
+	}
+
+	exportURLTTLMinutes := DefaultExportURLTTLMinutes
+	if value := os.Getenv("EXPORT_URL_TTL_MINUTES"); value != "" {
+		minutes, err := strconv.Atoi(value)
+		if err != nil || minutes <= 0 {
+			return nil, fmt.Errorf("EXPORT_URL_TTL_MINUTES must be a positive number of minutes, got %q", value)
+		}
+		exportURLTTLMinutes = minutes
+	}
+
+	webhookMaxAttempts := DefaultWebhookMaxAttempts
+	if value := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); value != "" {
+		attempts, err := strconv.Atoi(value)
+		if err != nil || attempts <= 0 {
+			return nil, fmt.Errorf("WEBHOOK_MAX_ATTEMPTS must be a positive number of attempts, got %q", value)
+		}
+		webhookMaxAttempts = attempts
+	}
+
+	webhookDisableAfter := DefaultWebhookDisableAfter
+	if value := os.Getenv("WEBHOOK_DISABLE_AFTER_FAILURES"); value != "" {
+		failures, err := strconv.Atoi(value)
+		if err != nil || failures < 0 {
+			return nil, fmt.Errorf("WEBHOOK_DISABLE_AFTER_FAILURES must be a non-negative number of failures, got %q", value)
+		}
+		webhookDisableAfter = failures
+	}
+
+	webhookRetentionDays := DefaultWebhookDeliveryRetentionDays
+	if value := os.Getenv("WEBHOOK_DELIVERY_RETENTION_DAYS"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 {
+			return nil, fmt.Errorf("WEBHOOK_DELIVERY_RETENTION_DAYS must be a non-negative number of days, got %q", value)
+		}
+		webhookRetentionDays = days
+	}
+
 	return &Config{
-		TableName: tableName,
-		Region:    region,
-		LogLevel:  logLevel,
+		TableName:        tableName,
+		Region:           region,
+		LogLevel:         logLevel,
+		DynamicUnitTypes: splitList(os.Getenv("DYNAMIC_UNIT_TYPES")),
+		SchemaDir:        os.Getenv("SCHEMA_DIR"),
+		FieldPolicyDir:   os.Getenv("FIELD_POLICY_DIR"),
+
+		SchemaMigrationWriteBack: os.Getenv("SCHEMA_MIGRATION_WRITE_BACK") == "true",
+
+		DeletedRetention: time.Duration(retentionDays) * 24 * time.Hour,
+		AdminGroup:       adminGroup,
+
+		PaginationTokenKey: os.Getenv("PAGINATION_TOKEN_KEY"),
+		PaginationTokenTTL: time.Duration(tokenTTLMinutes) * time.Minute,
+
+		AccountClaim:        accountClaim,
+		MembershipTableName: os.Getenv("ACCOUNT_MEMBERSHIP_TABLE"),
+
+		VinDecoderURL:     vinDecoderURL,
+		VinDecoderTimeout: time.Duration(vinDecoderTimeoutSeconds) * time.Second,
+
+		ExportBucket: os.Getenv("EXPORT_BUCKET"),
+		ExportURLTTL: time.Duration(exportURLTTLMinutes) * time.Minute,
+
+		UnitHistory: os.Getenv("UNIT_HISTORY_ENABLED") != "false",
+
+		UnitEvents:   os.Getenv("UNIT_EVENTS_ENABLED") == "true",
+		EventBusName: os.Getenv("EVENT_BUS_NAME"),
+
+		StreamSinks:      splitList(os.Getenv("STREAM_SINKS")),
+		SNSTopicARN:      os.Getenv("SNS_TOPIC_ARN"),
+		StreamWebhookURL: os.Getenv("STREAM_WEBHOOK_URL"),
+
+		WebhookMaxAttempts:       webhookMaxAttempts,
+		WebhookDisableAfter:      webhookDisableAfter,
+		WebhookDeliveryRetention: time.Duration(webhookRetentionDays) * 24 * time.Hour,
 	}, nil
 }
+
+// IsDynamicUnitType reports whether the unit type is served by the dynamic handlers
+func (c *Config) IsDynamicUnitType(unitType string) bool {
+	if unitType == "" {
+		return false
+	}
+	for _, t := range c.DynamicUnitTypes {
+		if t == unitType {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList splits a comma-separated environment value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
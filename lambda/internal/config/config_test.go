@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -141,3 +142,262 @@ func TestConfig_Struct(t *testing.T) {
 	assert.Equal(t, "eu-west-1", config.Region)
 	assert.Equal(t, "WARN", config.LogLevel)
 }
+
+func TestNew_WithDynamicUnitTypes(t *testing.T) {
+	t.Setenv("TABLE_NAME", "test-units-table")
+	t.Setenv("DYNAMIC_UNIT_TYPES", "commercialVehicleType, trailerType,,")
+
+	config, err := New()
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"commercialVehicleType", "trailerType"}, config.DynamicUnitTypes)
+	assert.True(t, config.IsDynamicUnitType("commercialVehicleType"))
+	assert.True(t, config.IsDynamicUnitType("trailerType"))
+	assert.False(t, config.IsDynamicUnitType("otherType"))
+	assert.False(t, config.IsDynamicUnitType(""))
+}
+
+func TestNew_WithoutDynamicUnitTypes(t *testing.T) {
+	t.Setenv("TABLE_NAME", "test-units-table")
+	t.Setenv("DYNAMIC_UNIT_TYPES", "")
+
+	config, err := New()
+	require.NoError(t, err)
+
+	assert.Empty(t, config.DynamicUnitTypes)
+	assert.False(t, config.IsDynamicUnitType("commercialVehicleType"))
+}
+
+func TestNew_WithSchemaDir(t *testing.T) {
+	t.Setenv("TABLE_NAME", "test-units-table")
+	t.Setenv("SCHEMA_DIR", "/opt/schemas")
+
+	config, err := New()
+	require.NoError(t, err)
+
+	assert.Equal(t, "/opt/schemas", config.SchemaDir)
+}
+
+func TestNew_WithSchemaMigrationWriteBack(t *testing.T) {
+	t.Setenv("TABLE_NAME", "test-units-table")
+
+	t.Setenv("SCHEMA_MIGRATION_WRITE_BACK", "true")
+	config, err := New()
+	require.NoError(t, err)
+	assert.True(t, config.SchemaMigrationWriteBack)
+
+	t.Setenv("SCHEMA_MIGRATION_WRITE_BACK", "")
+	config, err = New()
+	require.NoError(t, err)
+	assert.False(t, config.SchemaMigrationWriteBack)
+}
+
+func TestNew_WithUnitHistory(t *testing.T) {
+	t.Setenv("TABLE_NAME", "test-units-table")
+
+	t.Setenv("UNIT_HISTORY_ENABLED", "")
+	config, err := New()
+	require.NoError(t, err)
+	assert.True(t, config.UnitHistory)
+
+	t.Setenv("UNIT_HISTORY_ENABLED", "false")
+	config, err = New()
+	require.NoError(t, err)
+	assert.False(t, config.UnitHistory)
+}
+
+func TestNew_WithUnitEvents(t *testing.T) {
+	t.Setenv("TABLE_NAME", "test-units-table")
+
+	t.Setenv("UNIT_EVENTS_ENABLED", "")
+	config, err := New()
+	require.NoError(t, err)
+	assert.False(t, config.UnitEvents)
+
+	t.Setenv("UNIT_EVENTS_ENABLED", "true")
+	t.Setenv("EVENT_BUS_NAME", "units-bus")
+	config, err = New()
+	require.NoError(t, err)
+	assert.True(t, config.UnitEvents)
+	assert.Equal(t, "units-bus", config.EventBusName)
+}
+
+func TestNew_WithStreamSinks(t *testing.T) {
+	t.Setenv("TABLE_NAME", "test-units-table")
+	t.Setenv("STREAM_SINKS", "sns, webhook")
+	t.Setenv("SNS_TOPIC_ARN", "arn:aws:sns:us-east-1:123456789012:unit-changes")
+	t.Setenv("STREAM_WEBHOOK_URL", "https://hooks.example.com/units")
+
+	config, err := New()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sns", "webhook"}, config.StreamSinks)
+	assert.Equal(t, "arn:aws:sns:us-east-1:123456789012:unit-changes", config.SNSTopicARN)
+	assert.Equal(t, "https://hooks.example.com/units", config.StreamWebhookURL)
+}
+
+func TestNew_WithDeletedRetention(t *testing.T) {
+	t.Setenv("TABLE_NAME", "test-units-table")
+
+	t.Setenv("DELETED_UNIT_RETENTION_DAYS", "")
+	config, err := New()
+	require.NoError(t, err)
+	assert.Equal(t, 30*24*time.Hour, config.DeletedRetention)
+
+	t.Setenv("DELETED_UNIT_RETENTION_DAYS", "7")
+	config, err = New()
+	require.NoError(t, err)
+	assert.Equal(t, 7*24*time.Hour, config.DeletedRetention)
+
+	t.Setenv("DELETED_UNIT_RETENTION_DAYS", "0")
+	config, err = New()
+	require.NoError(t, err)
+	assert.Zero(t, config.DeletedRetention)
+
+	t.Setenv("DELETED_UNIT_RETENTION_DAYS", "-1")
+	_, err = New()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "DELETED_UNIT_RETENTION_DAYS")
+}
+
+func TestNew_WithAdminGroup(t *testing.T) {
+	t.Setenv("TABLE_NAME", "test-units-table")
+
+	t.Setenv("ADMIN_GROUP", "")
+	config, err := New()
+	require.NoError(t, err)
+	assert.Equal(t, "admin", config.AdminGroup)
+
+	t.Setenv("ADMIN_GROUP", "support-admins")
+	config, err = New()
+	require.NoError(t, err)
+	assert.Equal(t, "support-admins", config.AdminGroup)
+}
+
+func TestNew_WithPaginationTokenSettings(t *testing.T) {
+	t.Setenv("TABLE_NAME", "test-units-table")
+
+	t.Setenv("PAGINATION_TOKEN_KEY", "")
+	t.Setenv("PAGINATION_TOKEN_TTL_MINUTES", "")
+	config, err := New()
+	require.NoError(t, err)
+	assert.Empty(t, config.PaginationTokenKey)
+	assert.Equal(t, time.Hour, config.PaginationTokenTTL)
+
+	t.Setenv("PAGINATION_TOKEN_KEY", "s3cret")
+	t.Setenv("PAGINATION_TOKEN_TTL_MINUTES", "15")
+	config, err = New()
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", config.PaginationTokenKey)
+	assert.Equal(t, 15*time.Minute, config.PaginationTokenTTL)
+
+	t.Setenv("PAGINATION_TOKEN_TTL_MINUTES", "0")
+	_, err = New()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "PAGINATION_TOKEN_TTL_MINUTES")
+}
+
+func TestNew_WithAccountAuthorizationSettings(t *testing.T) {
+	t.Setenv("TABLE_NAME", "test-units-table")
+
+	t.Setenv("ACCOUNT_CLAIM", "")
+	t.Setenv("ACCOUNT_MEMBERSHIP_TABLE", "")
+	config, err := New()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultAccountClaim, config.AccountClaim)
+	assert.Empty(t, config.MembershipTableName)
+
+	t.Setenv("ACCOUNT_CLAIM", "custom:tenants")
+	t.Setenv("ACCOUNT_MEMBERSHIP_TABLE", "account-memberships")
+	config, err = New()
+	require.NoError(t, err)
+	assert.Equal(t, "custom:tenants", config.AccountClaim)
+	assert.Equal(t, "account-memberships", config.MembershipTableName)
+}
+
+func TestNew_WithFieldPolicyDir(t *testing.T) {
+	t.Setenv("TABLE_NAME", "test-units-table")
+	t.Setenv("FIELD_POLICY_DIR", "/opt/policies")
+
+	config, err := New()
+	require.NoError(t, err)
+	assert.Equal(t, "/opt/policies", config.FieldPolicyDir)
+}
+
+func TestNew_WithVinDecoderSettings(t *testing.T) {
+	t.Setenv("TABLE_NAME", "test-units-table")
+
+	t.Setenv("VIN_DECODER_URL", "")
+	t.Setenv("VIN_DECODER_TIMEOUT_SECONDS", "")
+	config, err := New()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultVinDecoderURL, config.VinDecoderURL)
+	assert.Equal(t, 10*time.Second, config.VinDecoderTimeout)
+
+	t.Setenv("VIN_DECODER_URL", "http://vpic.internal/api/vehicles")
+	t.Setenv("VIN_DECODER_TIMEOUT_SECONDS", "3")
+	config, err = New()
+	require.NoError(t, err)
+	assert.Equal(t, "http://vpic.internal/api/vehicles", config.VinDecoderURL)
+	assert.Equal(t, 3*time.Second, config.VinDecoderTimeout)
+
+	t.Setenv("VIN_DECODER_TIMEOUT_SECONDS", "-1")
+	_, err = New()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "VIN_DECODER_TIMEOUT_SECONDS")
+}
+
+func TestNew_WithExportSettings(t *testing.T) {
+	t.Setenv("TABLE_NAME", "test-units-table")
+
+	t.Setenv("EXPORT_BUCKET", "")
+	t.Setenv("EXPORT_URL_TTL_MINUTES", "")
+	config, err := New()
+	require.NoError(t, err)
+	assert.Empty(t, config.ExportBucket)
+	assert.Equal(t, time.Hour, config.ExportURLTTL)
+
+	t.Setenv("EXPORT_BUCKET", "unit-exports")
+	t.Setenv("EXPORT_URL_TTL_MINUTES", "15")
+	config, err = New()
+	require.NoError(t, err)
+	assert.Equal(t, "unit-exports", config.ExportBucket)
+	assert.Equal(t, 15*time.Minute, config.ExportURLTTL)
+
+	t.Setenv("EXPORT_URL_TTL_MINUTES", "0")
+	_, err = New()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "EXPORT_URL_TTL_MINUTES")
+}
+
+func TestNew_WithWebhookSettings(t *testing.T) {
+	t.Setenv("TABLE_NAME", "test-units-table")
+
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "")
+	t.Setenv("WEBHOOK_DISABLE_AFTER_FAILURES", "")
+	t.Setenv("WEBHOOK_DELIVERY_RETENTION_DAYS", "")
+	config, err := New()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultWebhookMaxAttempts, config.WebhookMaxAttempts)
+	assert.Equal(t, DefaultWebhookDisableAfter, config.WebhookDisableAfter)
+	assert.Equal(t, 14*24*time.Hour, config.WebhookDeliveryRetention)
+
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "2")
+	t.Setenv("WEBHOOK_DISABLE_AFTER_FAILURES", "0")
+	t.Setenv("WEBHOOK_DELIVERY_RETENTION_DAYS", "3")
+	config, err = New()
+	require.NoError(t, err)
+	assert.Equal(t, 2, config.WebhookMaxAttempts)
+	assert.Equal(t, 0, config.WebhookDisableAfter)
+	assert.Equal(t, 72*time.Hour, config.WebhookDeliveryRetention)
+
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "0")
+	_, err = New()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "WEBHOOK_MAX_ATTEMPTS")
+
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "2")
+	t.Setenv("WEBHOOK_DISABLE_AFTER_FAILURES", "-1")
+	_, err = New()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "WEBHOOK_DISABLE_AFTER_FAILURES")
+}
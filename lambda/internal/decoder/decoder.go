@@ -0,0 +1,223 @@
+// Package decoder decodes VINs into unit details through an external VIN decoding
+// service such as the NHTSA vPIC API.
+package decoder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+)
+
+// ErrNoResult is returned when the decoding service has no result for a VIN
+var ErrNoResult = errors.New("no decode result for VIN")
+
+// VinDecoder decodes a VIN into the unit details it encodes. modelYear is optional
+// and helps the decoder tell apart VINs whose model year code is ambiguous.
+type VinDecoder interface {
+	DecodeVin(ctx context.Context, vin, modelYear string) (*models.Unit, error)
+}
+
+// vpicFields maps the variables of a vPIC DecodeVinValues result to the JSON names
+// of the unit fields they populate. Variables without a unit field are ignored.
+var vpicFields = map[string]string{
+	"ErrorCode":           "errorCode",
+	"PossibleValues":      "possibleValues",
+	"ErrorText":           "errorText",
+	"VehicleDescriptor":   "vehicleDescriptor",
+	"AdditionalErrorText": "additionalErrorText",
+	"DestinationMarket":   "destinationMarket",
+	"Note":                "note",
+
+	"Make":         "make",
+	"Manufacturer": "manufacturerName",
+	"Model":        "model",
+	"ModelYear":    "modelYear",
+	"Series":       "series",
+	"VehicleType":  "vehicleType",
+
+	"PlantCity":        "plantCity",
+	"PlantCountry":     "plantCountry",
+	"PlantState":       "plantState",
+	"PlantCompanyName": "plantCompanyName",
+
+	"Trim":    "trim",
+	"Trim2":   "trim2",
+	"Series2": "series2",
+
+	"BasePrice":  "basePrice",
+	"NonLandUse": "nonLandUse",
+
+	"BodyClass":     "bodyClass",
+	"Doors":         "doors",
+	"Windows":       "windows",
+	"WheelBaseType": "wheelBaseType",
+	"TrackWidth":    "trackWidthInches",
+
+	"GVWR":         "grossVehicleWeightRatingFrom",
+	"GVWR_to":      "grossVehicleWeightRatingTo",
+	"GCWR":         "grossCombinationWeightRatingFrom",
+	"GCWR_to":      "grossCombinationWeightRatingTo",
+	"CurbWeightLB": "curbWeightPounds",
+
+	"BedLengthIN":    "bedLengthInches",
+	"WheelBaseShort": "wheelBaseInchesFrom",
+	"WheelBaseLong":  "wheelBaseInchesTo",
+
+	"BedType":          "bedType",
+	"BodyCabType":      "cabType",
+	"TrailerType":      "trailerTypeConnection",
+	"TrailerBodyType":  "trailerBodyType",
+	"TrailerLength":    "trailerLengthFeet",
+	"OtherTrailerInfo": "otherTrailerInfo",
+
+	"Wheels":         "numberOfWheels",
+	"WheelSizeFront": "wheelSizeFrontInches",
+	"WheelSizeRear":  "wheelSizeRearInches",
+
+	"CustomMotorcycleType":     "customMotorcycleType",
+	"MotorcycleSuspensionType": "motorcycleSuspensionType",
+	"MotorcycleChassisType":    "motorcycleChassisType",
+	"OtherMotorcycleInfo":      "otherMotorcycleInfo",
+
+	"FuelTankType":     "fuelTankType",
+	"FuelTankMaterial": "fuelTankMaterial",
+
+	"CombinedBrakingSystem": "combinedBrakingSystem",
+	"WheelieMitigation":     "wheelieMitigation",
+
+	"BusLength":          "busLengthFeet",
+	"BusFloorConfigType": "busFloorConfigurationType",
+	"BusType":            "busType",
+	"OtherBusInfo":       "otherBusInfo",
+
+	"EntertainmentSystem": "entertainmentSystem",
+	"SteeringLocation":    "steeringLocation",
+	"Seats":               "numberOfSeats",
+	"SeatRows":            "numberOfSeatRows",
+
+	"TransmissionStyle":  "transmissionStyle",
+	"TransmissionSpeeds": "transmissionSpeeds",
+	"DriveType":          "driveType",
+	"Axles":              "axles",
+	"AxleConfiguration":  "axleConfiguration",
+
+	"BrakeSystemType": "brakeSystemType",
+	"BrakeSystemDesc": "brakeSystemDescription",
+
+	"BatteryInfo":    "otherBatteryInfo",
+	"BatteryType":    "batteryType",
+	"BatteryCells":   "numberOfBatteryCellsPerModule",
+	"BatteryA":       "batteryCurrentAmpsFrom",
+	"BatteryV":       "batteryVoltageVoltsFrom",
+	"BatteryKWh":     "batteryEnergyKwhFrom",
+	"EVDriveUnit":    "evDriveUnit",
+	"BatteryA_to":    "batteryCurrentAmpsTo",
+	"BatteryV_to":    "batteryVoltageVoltsTo",
+	"BatteryKWh_to":  "batteryEnergyKwhTo",
+	"BatteryModules": "numberOfBatteryModulesPerPack",
+	"BatteryPacks":   "numberOfBatteryPacksPerVehicle",
+	"ChargerLevel":   "chargerLevel",
+	"ChargerPowerKW": "chargerPowerKw",
+
+	"EngineCylinders":     "engineNumberOfCylinders",
+	"DisplacementCC":      "displacementCc",
+	"DisplacementCI":      "displacementCi",
+	"DisplacementL":       "displacementL",
+	"EngineCycles":        "engineStrokeCycles",
+	"EngineModel":         "engineModel",
+	"EngineKW":            "enginePowerKw",
+	"FuelTypePrimary":     "fuelTypePrimary",
+	"ValveTrainDesign":    "valveTrainDesign",
+	"EngineConfiguration": "engineConfiguration",
+	"FuelTypeSecondary":   "fuelTypeSecondary",
+
+	"FuelInjectionType":    "fuelDeliveryFuelInjectionType",
+	"EngineHP":             "engineBrakeHpFrom",
+	"CoolingType":          "coolingType",
+	"EngineHP_to":          "engineBrakeHpTo",
+	"ElectrificationLevel": "electrificationLevel",
+	"OtherEngineInfo":      "otherEngineInfo",
+	"Turbo":                "turbo",
+	"TopSpeedMPH":          "topSpeedMph",
+	"EngineManufacturer":   "engineManufacturer",
+
+	"Pretensioner":             "pretensioner",
+	"SeatBeltsAll":             "seatBeltType",
+	"OtherRestraintSystemInfo": "otherRestraintSystemInfo",
+
+	"AirBagLocCurtain":     "curtainAirBagLocations",
+	"AirBagLocSeatCushion": "seatCushionAirBagLocations",
+	"AirBagLocFront":       "frontAirBagLocations",
+	"AirBagLocKnee":        "kneeAirBagLocations",
+	"AirBagLocSide":        "sideAirBagLocations",
+
+	"ABS":             "antiLockBrakingSystem",
+	"ESC":             "electronicStabilityControl",
+	"TractionControl": "tractionControl",
+	"TPMS":            "tirePressureMonitoringSystemType",
+
+	"ActiveSafetySysNote":              "activeSafetySystemNote",
+	"AutoReverseSystem":                "autoReverseSystemForWindowsAndSunroofs",
+	"AutomaticPedestrianAlertingSound": "automaticPedestrianAlertingSound",
+	"EDR":                              "eventDataRecorder",
+	"KeylessIgnition":                  "keylessIgnition",
+	"SAEAutomationLevel":               "saeAutomationLevelFrom",
+	"SAEAutomationLevel_to":            "saeAutomationLevelTo",
+
+	"AdaptiveCruiseControl":               "adaptiveCruiseControl",
+	"CIB":                                 "crashImminentBraking",
+	"ForwardCollisionWarning":             "forwardCollisionWarning",
+	"DynamicBrakeSupport":                 "dynamicBrakeSupport",
+	"PedestrianAutomaticEmergencyBraking": "pedestrianAutomaticEmergencyBraking",
+	"BlindSpotMon":                        "blindSpotWarning",
+	"LaneDepartureWarning":                "laneDepartureWarning",
+	"LaneKeepSystem":                      "laneKeepingAssistance",
+	"BlindSpotIntervention":               "blindSpotIntervention",
+	"LaneCenteringAssistance":             "laneCenteringAssistance",
+
+	"RearVisibilitySystem":          "backupCamera",
+	"ParkAssist":                    "parkingAssist",
+	"RearCrossTrafficAlert":         "rearCrossTrafficAlert",
+	"RearAutomaticEmergencyBraking": "rearAutomaticEmergencyBraking",
+
+	"CAN_AACN": "automaticCrashNotification",
+
+	"DaytimeRunningLight":                "daytimeRunningLight",
+	"LowerBeamHeadlampLightSource":       "headlampLightSource",
+	"SemiautomaticHeadlampBeamSwitching": "semiautomaticHeadlampBeamSwitching",
+	"AdaptiveDrivingBeam":                "adaptiveDrivingBeam",
+}
+
+// unitFromValues builds a unit from the variables of a vPIC DecodeVinValues result.
+// Empty values are left unset. SuggestedVin holds the VIN vPIC suggests as a
+// correction when it has one, otherwise the decoded VIN.
+func unitFromValues(vin string, values map[string]interface{}) (*models.Unit, error) {
+	fields := make(map[string]string, len(vpicFields)+1)
+	for variable, field := range vpicFields {
+		if value, ok := values[variable].(string); ok {
+			if value = strings.TrimSpace(value); value != "" {
+				fields[field] = value
+			}
+		}
+	}
+
+	fields["suggestedVin"] = vin
+	if suggested, ok := values["SuggestedVIN"].(string); ok && strings.TrimSpace(suggested) != "" {
+		fields["suggestedVin"] = strings.TrimSpace(suggested)
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal decoded fields: %w", err)
+	}
+
+	var unit models.Unit
+	if err := json.Unmarshal(data, &unit); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal decoded fields: %w", err)
+	}
+	return &unit, nil
+}
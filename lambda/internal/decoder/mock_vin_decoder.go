@@ -0,0 +1,23 @@
+package decoder
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+)
+
+// MockVinDecoder is a mock implementation of VinDecoder for testing
+type MockVinDecoder struct {
+	mock.Mock
+}
+
+// DecodeVin mocks the DecodeVin method
+func (m *MockVinDecoder) DecodeVin(ctx context.Context, vin, modelYear string) (*models.Unit, error) {
+	args := m.Called(ctx, vin, modelYear)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Unit), args.Error(1)
+}
@@ -0,0 +1,101 @@
+package decoder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/internal/vin"
+)
+
+const (
+	// DefaultVPICBaseURL is the base URL of the NHTSA vPIC vehicles API
+	DefaultVPICBaseURL = "https://vpic.nhtsa.dot.gov/api/vehicles"
+
+	// DefaultTimeout bounds each decode request
+	DefaultTimeout = 10 * time.Second
+)
+
+// maxResponseBytes caps how much of a response body is read
+const maxResponseBytes = 1 << 20
+
+// VPICDecoder decodes VINs with the vPIC DecodeVinValues endpoint, or any service
+// that serves the same request and response format
+type VPICDecoder struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewVPICDecoder creates a decoder for the vPIC-compatible API at baseURL. An empty
+// baseURL uses DefaultVPICBaseURL and a nil httpClient uses one with DefaultTimeout.
+func NewVPICDecoder(baseURL string, httpClient *http.Client) *VPICDecoder {
+	if baseURL == "" {
+		baseURL = DefaultVPICBaseURL
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultTimeout}
+	}
+	return &VPICDecoder{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// vpicResponse is the body of a DecodeVinValues response
+type vpicResponse struct {
+	Count          int                      `json:"Count"`
+	Message        string                   `json:"Message"`
+	SearchCriteria string                   `json:"SearchCriteria"`
+	Results        []map[string]interface{} `json:"Results"`
+}
+
+// DecodeVin decodes a VIN with GET {baseURL}/DecodeVinValues/{vin}?format=json
+func (d *VPICDecoder) DecodeVin(ctx context.Context, vehicleVin, modelYear string) (*models.Unit, error) {
+	vehicleVin = vin.Normalize(vehicleVin)
+	if vehicleVin == "" {
+		return nil, errors.New("vin is required")
+	}
+
+	query := url.Values{"format": {"json"}}
+	if modelYear = strings.TrimSpace(modelYear); modelYear != "" {
+		query.Set("modelyear", modelYear)
+	}
+	endpoint := d.baseURL + "/DecodeVinValues/" + url.PathEscape(vehicleVin) + "?" + query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build decode request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call VIN decoder: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read VIN decoder response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("VIN decoder returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var decoded vpicResponse
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return nil, fmt.Errorf("failed to parse VIN decoder response: %w", err)
+	}
+	if len(decoded.Results) == 0 {
+		return nil, fmt.Errorf("%w %s", ErrNoResult, vehicleVin)
+	}
+
+	return unitFromValues(vehicleVin, decoded.Results[0])
+}
@@ -0,0 +1,143 @@
+package decoder
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeVinValuesResponse is a trimmed vPIC DecodeVinValues response
+const decodeVinValuesResponse = `{
+	"Count": 1,
+	"Message": "Results returned successfully. NOTE: Any missing decoded values should be interpreted as NHTSA does not have data on the specific variable.",
+	"SearchCriteria": "VIN:1HGBH41JXMN109186",
+	"Results": [{
+		"ABS": "",
+		"BodyClass": "Sedan/Saloon",
+		"Doors": "4",
+		"DisplacementL": "2.0",
+		"EngineCylinders": "4",
+		"ErrorCode": "0",
+		"ErrorText": "0 - VIN decoded clean. Check Digit (9th position) is correct",
+		"GVWR": "Class 1: 6,000 lb or less (2,722 kg or less)",
+		"Make": "HONDA",
+		"MakeID": "474",
+		"Manufacturer": "HONDA OF AMERICA MFG., INC.",
+		"Model": "Accord",
+		"ModelYear": "1991",
+		"PlantCity": "MARYSVILLE",
+		"PlantState": "OHIO",
+		"SuggestedVIN": "",
+		"Trim": " ",
+		"VIN": "1HGBH41JXMN109186",
+		"VehicleDescriptor": "1HGBH41J*MN"
+	}]
+}`
+
+func TestVPICDecoder_DecodeVin(t *testing.T) {
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(decodeVinValuesResponse))
+	}))
+	defer server.Close()
+
+	decoder := NewVPICDecoder(server.URL+"/api/vehicles/", server.Client())
+
+	unit, err := decoder.DecodeVin(context.Background(), " 1hgbh41jxmn-109186 ", "1991")
+	require.NoError(t, err)
+
+	require.Len(t, requests, 1)
+	assert.Equal(t, "/api/vehicles/DecodeVinValues/1HGBH41JXMN109186", requests[0].URL.Path)
+	assert.Equal(t, "json", requests[0].URL.Query().Get("format"))
+	assert.Equal(t, "1991", requests[0].URL.Query().Get("modelyear"))
+
+	assert.Equal(t, "1HGBH41JXMN109186", unit.SuggestedVin)
+	assert.Equal(t, "0", unit.ErrorCode)
+	assert.Equal(t, "1HGBH41J*MN", unit.VehicleDescriptor)
+	assert.Equal(t, "HONDA", unit.Make)
+	assert.Equal(t, "HONDA OF AMERICA MFG., INC.", unit.ManufacturerName)
+	assert.Equal(t, "Accord", unit.Model)
+	assert.Equal(t, "1991", unit.ModelYear)
+	assert.Equal(t, "Sedan/Saloon", unit.BodyClass)
+	assert.Equal(t, "4", unit.EngineNumberOfCylinders)
+	assert.Equal(t, "Class 1: 6,000 lb or less (2,722 kg or less)", unit.GrossVehicleWeightRatingFrom)
+	require.NotNil(t, unit.PlantState)
+	assert.Equal(t, "OHIO", *unit.PlantState)
+
+	// Blank values are left unset
+	assert.Nil(t, unit.Trim)
+	assert.Nil(t, unit.AntiLockBrakingSystem)
+
+	// No model year hint is sent when none is given
+	_, err = decoder.DecodeVin(context.Background(), "1HGBH41JXMN109186", "")
+	require.NoError(t, err)
+	assert.False(t, requests[1].URL.Query().Has("modelyear"))
+}
+
+func TestVPICDecoder_DecodeVinUsesSuggestedVin(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Count":1,"Results":[{"ErrorCode":"1","SuggestedVIN":"1HGBH41J!MN109186","VIN":"1HGBH41J1MN109186"}]}`))
+	}))
+	defer server.Close()
+
+	unit, err := NewVPICDecoder(server.URL, server.Client()).DecodeVin(context.Background(), "1HGBH41J1MN109186", "")
+	require.NoError(t, err)
+	assert.Equal(t, "1", unit.ErrorCode)
+	assert.Equal(t, "1HGBH41J!MN109186", unit.SuggestedVin)
+}
+
+func TestVPICDecoder_DecodeVinErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{name: "server error", status: http.StatusInternalServerError, body: "unavailable", wantErr: "VIN decoder returned status 500: unavailable"},
+		{name: "malformed body", status: http.StatusOK, body: "<html>", wantErr: "failed to parse VIN decoder response"},
+		{name: "no results", status: http.StatusOK, body: `{"Count":0,"Results":[]}`, wantErr: "no decode result for VIN 1HGBH41JXMN109186"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			_, err := NewVPICDecoder(server.URL, server.Client()).DecodeVin(context.Background(), "1HGBH41JXMN109186", "")
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+
+	_, err := NewVPICDecoder("http://127.0.0.1:1", nil).DecodeVin(context.Background(), " ", "")
+	assert.EqualError(t, err, "vin is required")
+}
+
+func TestVPICDecoder_DecodeVinTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := server.Client()
+	client.Timeout = 50 * time.Millisecond
+
+	_, err := NewVPICDecoder(server.URL, client).DecodeVin(context.Background(), "1HGBH41JXMN109186", "")
+	require.Error(t, err)
+	var timeout interface{ Timeout() bool }
+	require.True(t, errors.As(err, &timeout))
+	assert.True(t, timeout.Timeout())
+}
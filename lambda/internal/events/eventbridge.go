@@ -0,0 +1,99 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+// MaxPutEventsEntries is the most entries EventBridge accepts in one PutEvents request
+const MaxPutEventsEntries = 10
+
+// EventBridgeAPI is the part of the EventBridge client the publisher uses
+type EventBridgeAPI interface {
+	PutEvents(ctx context.Context, params *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error)
+}
+
+// EventBridgePublisher is a Publisher that sends events to an EventBridge event
+// bus with PutEvents. Each event's detail type is its Type and its detail the event.
+type EventBridgePublisher struct {
+	client  EventBridgeAPI
+	busName string
+}
+
+// NewEventBridgePublisher creates a publisher sending to the event bus named busName
+func NewEventBridgePublisher(client EventBridgeAPI, busName string) *EventBridgePublisher {
+	return &EventBridgePublisher{
+		client:  client,
+		busName: busName,
+	}
+}
+
+// Publish sends the events in PutEvents requests of up to MaxPutEventsEntries
+// entries. EventBridge may reject some entries of a request while accepting the
+// others; the returned *PublishError tells which.
+func (p *EventBridgePublisher) Publish(ctx context.Context, events []Event) error {
+	errs := make([]error, len(events))
+	failed := false
+	for start := 0; start < len(events); start += MaxPutEventsEntries {
+		end := min(start+MaxPutEventsEntries, len(events))
+		for i, err := range p.putEvents(ctx, events[start:end]) {
+			if err != nil {
+				errs[start+i] = err
+				failed = true
+			}
+		}
+	}
+	if failed {
+		return &PublishError{Errors: errs}
+	}
+	return nil
+}
+
+// putEvents sends one PutEvents request and returns one error per event
+func (p *EventBridgePublisher) putEvents(ctx context.Context, events []Event) []error {
+	errs := make([]error, len(events))
+	fail := func(err error) []error {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	entries := make([]types.PutEventsRequestEntry, len(events))
+	for i, event := range events {
+		detail, err := json.Marshal(event)
+		if err != nil {
+			return fail(fmt.Errorf("failed to marshal event: %w", err))
+		}
+		entries[i] = types.PutEventsRequestEntry{
+			Source:       aws.String(Source),
+			DetailType:   aws.String(string(event.Type)),
+			Detail:       aws.String(string(detail)),
+			EventBusName: aws.String(p.busName),
+			Time:         aws.Time(event.OccurredAt),
+		}
+	}
+
+	output, err := p.client.PutEvents(ctx, &eventbridge.PutEventsInput{Entries: entries})
+	if err != nil {
+		return fail(fmt.Errorf("failed to put events: %w", err))
+	}
+	if output.FailedEntryCount == 0 {
+		return errs
+	}
+	if len(output.Entries) != len(events) {
+		return fail(errors.New("PutEvents response does not match the request"))
+	}
+	for i, entry := range output.Entries {
+		if entry.ErrorCode != nil {
+			errs[i] = fmt.Errorf("%s: %s", aws.ToString(entry.ErrorCode), aws.ToString(entry.ErrorMessage))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,124 @@
+// Package events defines the domain events raised when units change and the
+// publishers that deliver them to other services.
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+)
+
+// Type names a kind of unit change
+type Type string
+
+const (
+	UnitCreated Type = "UnitCreated"
+	UnitUpdated Type = "UnitUpdated" // Also raised when a deleted unit is restored
+	UnitDeleted Type = "UnitDeleted"
+)
+
+// Source identifies this service as the origin of its events
+const Source = "unt.units"
+
+// eventTypes maps each kind of write to the event it raises
+var eventTypes = map[models.HistoryAction]Type{
+	models.HistoryCreate:  UnitCreated,
+	models.HistoryUpdate:  UnitUpdated,
+	models.HistoryDelete:  UnitDeleted,
+	models.HistoryRestore: UnitUpdated,
+}
+
+// TypeOf returns the type of the event raised by a kind of write
+func TypeOf(action models.HistoryAction) Type {
+	return eventTypes[action]
+}
+
+// IsType reports whether name is the name of an event type
+func IsType(name string) bool {
+	switch Type(name) {
+	case UnitCreated, UnitUpdated, UnitDeleted:
+		return true
+	default:
+		return false
+	}
+}
+
+// Event is a change to a unit. Before is the unit as it was, nil for a created
+// unit; After is the unit as the change left it, soft deleted for a deleted unit.
+type Event struct {
+	ID         string               `json:"id"`
+	Type       Type                 `json:"type"`
+	Action     models.HistoryAction `json:"action"` // The write that raised the event; tells a restore from an update
+	AccountID  string               `json:"accountId"`
+	UnitID     string               `json:"unitId"`
+	UnitType   string               `json:"unitType"`
+	Version    int64                `json:"version"`    // Unit version written by the change
+	OccurredAt time.Time            `json:"occurredAt"` // When the change was made
+	Actor      models.Actor         `json:"actor"`
+
+	Before *models.Unit `json:"before,omitempty"`
+	After  *models.Unit `json:"after"`
+}
+
+// NewUnitEvent returns an event with a new ID for a write that turned before into after
+func NewUnitEvent(action models.HistoryAction, before, after *models.Unit, actor models.Actor, at time.Time) *Event {
+	return &Event{
+		ID:         uuid.New().String(),
+		Type:       TypeOf(action),
+		Action:     action,
+		AccountID:  after.AccountID,
+		UnitID:     after.ID,
+		UnitType:   after.UnitType,
+		Version:    after.Version,
+		OccurredAt: at.UTC(),
+		Actor:      actor,
+		Before:     before,
+		After:      after,
+	}
+}
+
+// Publisher delivers events to their subscribers
+type Publisher interface {
+	// Publish delivers events in order. When some are not delivered the error is a
+	// *PublishError telling which.
+	Publish(ctx context.Context, events []Event) error
+}
+
+// PublishError reports the events a Publish call could not deliver. Errors holds
+// one entry per event: why it was not delivered, or nil if it was.
+type PublishError struct {
+	Errors []error
+}
+
+func (e *PublishError) Error() string {
+	var reasons []string
+	for i, err := range e.Errors {
+		if err != nil {
+			reasons = append(reasons, fmt.Sprintf("event %d: %v", i, err))
+		}
+	}
+	return "failed to publish events: " + strings.Join(reasons, "; ")
+}
+
+// Failed returns the errors of a failed Publish call per event. An error that is
+// not a *PublishError failed every event.
+func Failed(err error, count int) []error {
+	errs := make([]error, count)
+	if err == nil {
+		return errs
+	}
+	var publishErr *PublishError
+	if errors.As(err, &publishErr) && len(publishErr.Errors) == count {
+		return publishErr.Errors
+	}
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
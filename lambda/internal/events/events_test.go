@@ -0,0 +1,281 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+)
+
+// testEvents returns count UnitCreated events for units unit-0, unit-1, ...
+func testEvents(count int) []Event {
+	events := make([]Event, count)
+	for i := range events {
+		unit := &models.Unit{AccountID: "account-1", ID: fmt.Sprintf("unit-%d", i), UnitType: "commercialVehicleType", Version: 1}
+		events[i] = *NewUnitEvent(models.HistoryCreate, nil, unit, models.Actor{Username: "jo"}, time.Date(2026, 3, 1, 10, 0, i, 0, time.UTC))
+	}
+	return events
+}
+
+func TestNewUnitEvent(t *testing.T) {
+	before := &models.Unit{AccountID: "account-1", ID: "unit-1", UnitType: "commercialVehicleType", Version: 3, Note: "yard 4"}
+	after := &models.Unit{AccountID: "account-1", ID: "unit-1", UnitType: "commercialVehicleType", Version: 4, Note: "yard 7"}
+	at := time.Date(2026, 3, 1, 11, 0, 0, 0, time.FixedZone("CET", 3600))
+
+	event := NewUnitEvent(models.HistoryUpdate, before, after, models.Actor{Sub: "sub-1"}, at)
+
+	assert.NotEmpty(t, event.ID)
+	assert.Equal(t, "unit-1", event.UnitID)
+	assert.Equal(t, int64(4), event.Version)
+	assert.Equal(t, time.UTC, event.OccurredAt.Location())
+	assert.True(t, at.Equal(event.OccurredAt))
+	assert.NotEqual(t, event.ID, NewUnitEvent(models.HistoryUpdate, before, after, models.Actor{}, at).ID)
+
+	data, err := json.Marshal(NewUnitEvent(models.HistoryCreate, nil, after, models.Actor{}, at))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), `"before"`)
+}
+
+func TestFailed(t *testing.T) {
+	assert.Equal(t, []error{nil, nil}, Failed(nil, 2))
+
+	throttled := errors.New("throttled")
+	assert.Equal(t, []error{nil, throttled}, Failed(&PublishError{Errors: []error{nil, throttled}}, 2))
+
+	down := fmt.Errorf("failed to put events: %w", errors.New("connection refused"))
+	assert.Equal(t, []error{down, down}, Failed(down, 2))
+}
+
+func TestMemoryPublisher(t *testing.T) {
+	publisher := NewMemoryPublisher()
+	events := testEvents(3)
+	require.NoError(t, publisher.Publish(context.Background(), events[:1]))
+
+	publisher.Fail = func(event Event) error {
+		if event.UnitID == "unit-1" {
+			return errors.New("throttled")
+		}
+		return nil
+	}
+	err := publisher.Publish(context.Background(), events[1:])
+
+	var publishErr *PublishError
+	require.True(t, errors.As(err, &publishErr))
+	assert.EqualError(t, publishErr.Errors[0], "throttled")
+	assert.NoError(t, publishErr.Errors[1])
+	assert.Contains(t, err.Error(), "event 0: throttled")
+
+	published := publisher.Events()
+	require.Len(t, published, 2)
+	assert.Equal(t, "unit-0", published[0].UnitID)
+	assert.Equal(t, "unit-2", published[1].UnitID)
+}
+
+// fakeEventBridge records PutEvents requests and answers them with putEvents
+type fakeEventBridge struct {
+	inputs    []*eventbridge.PutEventsInput
+	putEvents func(input *eventbridge.PutEventsInput) (*eventbridge.PutEventsOutput, error)
+}
+
+func (f *fakeEventBridge) PutEvents(_ context.Context, params *eventbridge.PutEventsInput, _ ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	f.inputs = append(f.inputs, params)
+	return f.putEvents(params)
+}
+
+// fakeSNS records PublishBatch requests and answers them with publishBatch
+type fakeSNS struct {
+	inputs       []*sns.PublishBatchInput
+	publishBatch func(input *sns.PublishBatchInput) (*sns.PublishBatchOutput, error)
+}
+
+func (f *fakeSNS) PublishBatch(_ context.Context, params *sns.PublishBatchInput, _ ...func(*sns.Options)) (*sns.PublishBatchOutput, error) {
+	f.inputs = append(f.inputs, params)
+	return f.publishBatch(params)
+}
+
+func TestEventBridgePublisher_Publish(t *testing.T) {
+	client := &fakeEventBridge{}
+	client.putEvents = func(input *eventbridge.PutEventsInput) (*eventbridge.PutEventsOutput, error) {
+		// The second entry of the second request is rejected
+		if len(client.inputs) == 2 {
+			return &eventbridge.PutEventsOutput{
+				FailedEntryCount: 1,
+				Entries: []ebtypes.PutEventsResultEntry{
+					{EventId: aws.String("e-1")},
+					{ErrorCode: aws.String("ThrottlingException"), ErrorMessage: aws.String("Rate exceeded")},
+				},
+			}, nil
+		}
+		return &eventbridge.PutEventsOutput{}, nil
+	}
+
+	publisher := NewEventBridgePublisher(client, "units-bus")
+	events := testEvents(MaxPutEventsEntries + 2)
+	err := publisher.Publish(context.Background(), events)
+
+	errs := Failed(err, len(events))
+	for i, err := range errs {
+		if i == MaxPutEventsEntries+1 {
+			assert.EqualError(t, err, "ThrottlingException: Rate exceeded")
+		} else {
+			assert.NoError(t, err, "event %d", i)
+		}
+	}
+
+	require.Len(t, client.inputs, 2)
+	assert.Len(t, client.inputs[0].Entries, MaxPutEventsEntries)
+	assert.Len(t, client.inputs[1].Entries, 2)
+
+	entry := client.inputs[0].Entries[0]
+	assert.Equal(t, Source, aws.ToString(entry.Source))
+	assert.Equal(t, "UnitCreated", aws.ToString(entry.DetailType))
+	assert.Equal(t, "units-bus", aws.ToString(entry.EventBusName))
+	assert.Equal(t, events[0].OccurredAt, aws.ToTime(entry.Time))
+	var detail Event
+	require.NoError(t, json.Unmarshal([]byte(aws.ToString(entry.Detail)), &detail))
+	assert.Equal(t, events[0].ID, detail.ID)
+	assert.Equal(t, "jo", detail.Actor.Username)
+}
+
+func TestEventBridgePublisher_PublishError(t *testing.T) {
+	client := &fakeEventBridge{
+		putEvents: func(*eventbridge.PutEventsInput) (*eventbridge.PutEventsOutput, error) {
+			return nil, &ebtypes.ResourceNotFoundException{Message: aws.String("Event bus missing-bus does not exist.")}
+		},
+	}
+
+	publisher := NewEventBridgePublisher(client, "missing-bus")
+	err := publisher.Publish(context.Background(), testEvents(2))
+
+	errs := Failed(err, 2)
+	require.Error(t, errs[0])
+	var notFound *ebtypes.ResourceNotFoundException
+	assert.ErrorAs(t, errs[0], &notFound)
+	assert.Contains(t, errs[1].Error(), "ResourceNotFoundException")
+
+	// A response that does not account for every entry fails them all
+	client.putEvents = func(*eventbridge.PutEventsInput) (*eventbridge.PutEventsOutput, error) {
+		return &eventbridge.PutEventsOutput{FailedEntryCount: 1}, nil
+	}
+	errs = Failed(publisher.Publish(context.Background(), testEvents(2)), 2)
+	assert.EqualError(t, errs[0], "PutEvents response does not match the request")
+	assert.EqualError(t, errs[1], "PutEvents response does not match the request")
+}
+
+func TestSNSPublisher_Publish(t *testing.T) {
+	client := &fakeSNS{}
+	client.publishBatch = func(input *sns.PublishBatchInput) (*sns.PublishBatchOutput, error) {
+		// The first message of the second request is rejected
+		if len(client.inputs) == 2 {
+			return &sns.PublishBatchOutput{
+				Failed: []snstypes.BatchResultErrorEntry{{Id: aws.String("0"), Code: aws.String("InternalError"), Message: aws.String("try again")}},
+			}, nil
+		}
+		return &sns.PublishBatchOutput{}, nil
+	}
+
+	publisher := NewSNSPublisher(client, "arn:aws:sns:us-east-1:123456789012:unit-changes")
+	events := testEvents(MaxPublishBatchEntries + 1)
+	err := publisher.Publish(context.Background(), events)
+
+	errs := Failed(err, len(events))
+	for i, err := range errs {
+		if i == MaxPublishBatchEntries {
+			assert.EqualError(t, err, "InternalError: try again")
+		} else {
+			assert.NoError(t, err, "event %d", i)
+		}
+	}
+
+	require.Len(t, client.inputs, 2)
+	input := client.inputs[0]
+	assert.Equal(t, "arn:aws:sns:us-east-1:123456789012:unit-changes", aws.ToString(input.TopicArn))
+	require.Len(t, input.PublishBatchRequestEntries, MaxPublishBatchEntries)
+	entry := input.PublishBatchRequestEntries[0]
+	assert.Equal(t, "0", aws.ToString(entry.Id))
+	assert.Equal(t, "String", aws.ToString(entry.MessageAttributes["eventType"].DataType))
+	assert.Equal(t, "UnitCreated", aws.ToString(entry.MessageAttributes["eventType"].StringValue))
+	require.Len(t, client.inputs[1].PublishBatchRequestEntries, 1)
+	assert.Equal(t, "0", aws.ToString(client.inputs[1].PublishBatchRequestEntries[0].Id))
+
+	var message Event
+	require.NoError(t, json.Unmarshal([]byte(aws.ToString(entry.Message)), &message))
+	assert.Equal(t, events[0].ID, message.ID)
+}
+
+func TestSNSPublisher_PublishError(t *testing.T) {
+	client := &fakeSNS{
+		publishBatch: func(*sns.PublishBatchInput) (*sns.PublishBatchOutput, error) {
+			return &sns.PublishBatchOutput{
+				Failed: []snstypes.BatchResultErrorEntry{{Id: aws.String("7"), Code: aws.String("InternalError")}},
+			}, nil
+		},
+	}
+
+	publisher := NewSNSPublisher(client, "arn:aws:sns:us-east-1:123456789012:unit-changes")
+	errs := Failed(publisher.Publish(context.Background(), testEvents(2)), 2)
+	assert.EqualError(t, errs[0], "PublishBatch response does not match the request")
+	assert.EqualError(t, errs[1], "PublishBatch response does not match the request")
+}
+
+func TestWebhookPublisher_Publish(t *testing.T) {
+	var received []Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event Event
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, event.ID, r.Header.Get("X-Unit-Event-Id"))
+		if event.UnitID == "unit-1" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		received = append(received, event)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	err := NewWebhookPublisher(server.URL, server.Client()).Publish(context.Background(), testEvents(3))
+
+	errs := Failed(err, 3)
+	assert.NoError(t, errs[0])
+	require.Error(t, errs[1])
+	assert.Contains(t, errs[1].Error(), "503 Service Unavailable: unavailable")
+	assert.NoError(t, errs[2])
+
+	require.Len(t, received, 2)
+	assert.Equal(t, "unit-0", received[0].UnitID)
+	assert.Equal(t, "unit-2", received[1].UnitID)
+}
+
+func TestFanoutPublisher_Publish(t *testing.T) {
+	first := NewMemoryPublisher()
+	second := NewMemoryPublisher()
+	second.Fail = func(event Event) error {
+		if event.UnitID == "unit-0" {
+			return errors.New("throttled")
+		}
+		return nil
+	}
+
+	err := NewFanoutPublisher(first, second).Publish(context.Background(), testEvents(2))
+
+	errs := Failed(err, 2)
+	assert.EqualError(t, errs[0], "throttled")
+	assert.NoError(t, errs[1])
+	assert.Len(t, first.Events(), 2)
+	assert.Len(t, second.Events(), 1)
+}
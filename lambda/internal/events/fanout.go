@@ -0,0 +1,36 @@
+package events
+
+import (
+	"context"
+	"errors"
+)
+
+// FanoutPublisher is a Publisher that delivers every event to each of several
+// publishers. An event is delivered only when every publisher delivered it, so a
+// retried event may reach some publishers twice.
+type FanoutPublisher struct {
+	publishers []Publisher
+}
+
+// NewFanoutPublisher creates a publisher delivering to each of publishers
+func NewFanoutPublisher(publishers ...Publisher) *FanoutPublisher {
+	return &FanoutPublisher{publishers: publishers}
+}
+
+// Publish delivers the events to every publisher in turn
+func (p *FanoutPublisher) Publish(ctx context.Context, events []Event) error {
+	errs := make([]error, len(events))
+	failed := false
+	for _, publisher := range p.publishers {
+		for i, err := range Failed(publisher.Publish(ctx, events), len(events)) {
+			if err != nil {
+				errs[i] = errors.Join(errs[i], err)
+				failed = true
+			}
+		}
+	}
+	if failed {
+		return &PublishError{Errors: errs}
+	}
+	return nil
+}
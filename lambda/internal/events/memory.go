@@ -0,0 +1,50 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryPublisher keeps published events in memory, for tests and local runs
+type MemoryPublisher struct {
+	mu     sync.Mutex
+	events []Event
+
+	// Fail, when set, is asked about each event and the event is not delivered
+	// when it returns an error
+	Fail func(Event) error
+}
+
+// NewMemoryPublisher creates an empty in-memory publisher
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+// Publish records the events that Fail lets through
+func (p *MemoryPublisher) Publish(_ context.Context, events []Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	errs := make([]error, len(events))
+	failed := false
+	for i, event := range events {
+		if p.Fail != nil {
+			if errs[i] = p.Fail(event); errs[i] != nil {
+				failed = true
+				continue
+			}
+		}
+		p.events = append(p.events, event)
+	}
+	if failed {
+		return &PublishError{Errors: errs}
+	}
+	return nil
+}
+
+// Events returns the events published so far, in order
+func (p *MemoryPublisher) Events() []Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Event(nil), p.events...)
+}
@@ -0,0 +1,101 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+// MaxPublishBatchEntries is the most messages SNS accepts in one PublishBatch request
+const MaxPublishBatchEntries = 10
+
+// SNSAPI is the part of the SNS client the publisher uses
+type SNSAPI interface {
+	PublishBatch(ctx context.Context, params *sns.PublishBatchInput, optFns ...func(*sns.Options)) (*sns.PublishBatchOutput, error)
+}
+
+// SNSPublisher is a Publisher that sends events to an SNS topic with PublishBatch.
+// Each message is the event as JSON, with its Type in the eventType message
+// attribute so subscriptions can filter on it.
+type SNSPublisher struct {
+	client   SNSAPI
+	topicARN string
+}
+
+// NewSNSPublisher creates a publisher sending to the topic topicARN
+func NewSNSPublisher(client SNSAPI, topicARN string) *SNSPublisher {
+	return &SNSPublisher{
+		client:   client,
+		topicARN: topicARN,
+	}
+}
+
+// Publish sends the events in PublishBatch requests of up to MaxPublishBatchEntries
+// messages. SNS may reject some messages of a request while accepting the others;
+// the returned *PublishError tells which.
+func (p *SNSPublisher) Publish(ctx context.Context, events []Event) error {
+	errs := make([]error, len(events))
+	failed := false
+	for start := 0; start < len(events); start += MaxPublishBatchEntries {
+		end := min(start+MaxPublishBatchEntries, len(events))
+		for i, err := range p.publishBatch(ctx, events[start:end]) {
+			if err != nil {
+				errs[start+i] = err
+				failed = true
+			}
+		}
+	}
+	if failed {
+		return &PublishError{Errors: errs}
+	}
+	return nil
+}
+
+// publishBatch sends one PublishBatch request and returns one error per event.
+// Entries are identified by their index in the request.
+func (p *SNSPublisher) publishBatch(ctx context.Context, events []Event) []error {
+	errs := make([]error, len(events))
+	fail := func(err error) []error {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	entries := make([]types.PublishBatchRequestEntry, len(events))
+	for i, event := range events {
+		message, err := json.Marshal(event)
+		if err != nil {
+			return fail(fmt.Errorf("failed to marshal event: %w", err))
+		}
+		entries[i] = types.PublishBatchRequestEntry{
+			Id:      aws.String(strconv.Itoa(i)),
+			Message: aws.String(string(message)),
+			MessageAttributes: map[string]types.MessageAttributeValue{
+				"eventType": {DataType: aws.String("String"), StringValue: aws.String(string(event.Type))},
+			},
+		}
+	}
+
+	output, err := p.client.PublishBatch(ctx, &sns.PublishBatchInput{
+		TopicArn:                   aws.String(p.topicARN),
+		PublishBatchRequestEntries: entries,
+	})
+	if err != nil {
+		return fail(fmt.Errorf("failed to publish to SNS: %w", err))
+	}
+	for _, entry := range output.Failed {
+		i, err := strconv.Atoi(aws.ToString(entry.Id))
+		if err != nil || i < 0 || i >= len(events) {
+			return fail(errors.New("PublishBatch response does not match the request"))
+		}
+		errs[i] = fmt.Errorf("%s: %s", aws.ToString(entry.Code), aws.ToString(entry.Message))
+	}
+	return errs
+}
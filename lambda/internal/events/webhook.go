@@ -0,0 +1,72 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// WebhookPublisher is a Publisher that posts each event as JSON to a fixed URL.
+// Any 2xx response delivers the event.
+type WebhookPublisher struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookPublisher creates a publisher posting to url. A nil client uses http.DefaultClient.
+func NewWebhookPublisher(url string, client *http.Client) *WebhookPublisher {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &WebhookPublisher{
+		url:    url,
+		client: client,
+	}
+}
+
+// Publish posts the events one at a time, in order
+func (p *WebhookPublisher) Publish(ctx context.Context, events []Event) error {
+	errs := make([]error, len(events))
+	failed := false
+	for i, event := range events {
+		if errs[i] = p.post(ctx, event); errs[i] != nil {
+			failed = true
+		}
+	}
+	if failed {
+		return &PublishError{Errors: errs}
+	}
+	return nil
+}
+
+// post sends one event
+func (p *WebhookPublisher) post(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Unit-Event-Id", event.ID)
+	req.Header.Set("X-Unit-Event-Type", string(event.Type))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post event: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to post event: %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+// Package exporter encodes units as CSV, NDJSON or Parquet. Columns come from the
+// Unit struct for units, or from the latest schema of a schema-driven unit type.
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+)
+
+// ColumnType is the type a column is encoded as where the format is typed
+type ColumnType int
+
+const (
+	// ColumnString holds text
+	ColumnString ColumnType = iota
+	// ColumnInt64 holds whole numbers such as timestamps and versions
+	ColumnInt64
+	// ColumnJSON holds a list or object encoded as JSON text
+	ColumnJSON
+)
+
+// Column is one field of the exported units
+type Column struct {
+	Name string
+	Type ColumnType
+}
+
+// Record maps column names to the values of one unit, as decoded from its JSON
+// form with numbers kept as json.Number. Missing and nil values are empty.
+type Record map[string]interface{}
+
+// unitSkippedFields are Unit fields that only soft deleted units use; exports
+// cover live units only
+var unitSkippedFields = map[string]bool{
+	"deletedAt": true,
+	"deletedBy": true,
+	"expiresAt": true,
+}
+
+// UnitColumns returns a column for each exported Unit field, in struct order
+func UnitColumns() []Column {
+	unitType := reflect.TypeOf(models.Unit{})
+	columns := make([]Column, 0, unitType.NumField())
+	for i := 0; i < unitType.NumField(); i++ {
+		field := unitType.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" || unitSkippedFields[name] {
+			continue
+		}
+		columns = append(columns, Column{Name: name, Type: columnTypeOf(field.Type.Kind())})
+	}
+	return columns
+}
+
+// columnTypeOf maps a Go kind to the column type it is exported as
+func columnTypeOf(kind reflect.Kind) ColumnType {
+	switch kind {
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return ColumnInt64
+	case reflect.Slice, reflect.Map, reflect.Struct:
+		return ColumnJSON
+	default:
+		return ColumnString
+	}
+}
+
+// dynamicUnitColumns are the columns every schema-driven unit has, ahead of its data
+var dynamicUnitColumns = []Column{
+	{Name: "id", Type: ColumnString},
+	{Name: "accountId", Type: ColumnString},
+	{Name: "unitType", Type: ColumnString},
+	{Name: "schemaVersion", Type: ColumnInt64},
+	{Name: "createdAt", Type: ColumnInt64},
+	{Name: "updatedAt", Type: ColumnInt64},
+}
+
+// DynamicUnitColumns returns the core unit columns followed by a column for each
+// top-level property of the schema, typed from the property's JSON schema type
+func DynamicUnitColumns(schema *models.UnitTypeSchema) []Column {
+	var doc struct {
+		Properties map[string]struct {
+			Type interface{} `json:"type"`
+		} `json:"properties"`
+	}
+	_ = json.Unmarshal(schema.Schema, &doc)
+
+	columns := append([]Column(nil), dynamicUnitColumns...)
+	seen := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		seen[column.Name] = true
+	}
+
+	for _, name := range schema.PropertyNames() {
+		if seen[name] {
+			continue
+		}
+		columnType := ColumnJSON
+		switch doc.Properties[name].Type {
+		case "string":
+			columnType = ColumnString
+		case "integer":
+			columnType = ColumnInt64
+		}
+		columns = append(columns, Column{Name: name, Type: columnType})
+	}
+	return columns
+}
+
+// Without returns the columns whose names are not listed
+func Without(columns []Column, names []string) []Column {
+	if len(names) == 0 {
+		return columns
+	}
+	excluded := make(map[string]bool, len(names))
+	for _, name := range names {
+		excluded[name] = true
+	}
+
+	kept := make([]Column, 0, len(columns))
+	for _, column := range columns {
+		if !excluded[column.Name] {
+			kept = append(kept, column)
+		}
+	}
+	return kept
+}
+
+// UnitRecord returns the record of a unit
+func UnitRecord(unit *models.Unit) (Record, error) {
+	return recordOf(unit)
+}
+
+// DynamicUnitRecord returns the record of a schema-driven unit: its core fields
+// and the top-level properties of its data
+func DynamicUnitRecord(unit *models.DynamicUnit) (Record, error) {
+	record, err := recordOf(unit)
+	if err != nil {
+		return nil, err
+	}
+
+	data, _ := record["data"].(map[string]interface{})
+	delete(record, "data")
+	for name, value := range data {
+		if _, ok := record[name]; !ok {
+			record[name] = value
+		}
+	}
+	return record, nil
+}
+
+// recordOf decodes the JSON form of a value into a record
+func recordOf(value interface{}) (Record, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal unit: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var record Record
+	if err := decoder.Decode(&record); err != nil {
+		return nil, fmt.Errorf("failed to decode unit: %w", err)
+	}
+	return record, nil
+}
+
+// text returns a value as text: strings as they are, numbers and booleans in their
+// JSON form, and lists and objects as JSON. ok is false for an empty value.
+func text(value interface{}) (string, bool, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", false, nil
+	case string:
+		return v, true, nil
+	case json.Number:
+		return v.String(), true, nil
+	case bool:
+		if v {
+			return "true", true, nil
+		}
+		return "false", true, nil
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", false, err
+		}
+		return string(data), true, nil
+	}
+}
@@ -0,0 +1,163 @@
+package exporter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Format is the encoding of an export
+type Format string
+
+const (
+	// FormatCSV is comma separated values with a header row of column names
+	FormatCSV Format = "CSV"
+	// FormatNDJSON is one JSON object per unit per line
+	FormatNDJSON Format = "NDJSON"
+	// FormatParquet is an Apache Parquet file
+	FormatParquet Format = "PARQUET"
+)
+
+// ParseFormat parses a format name, ignoring case. "jsonl" is accepted for NDJSON.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "CSV":
+		return FormatCSV, nil
+	case "NDJSON", "JSONL":
+		return FormatNDJSON, nil
+	case "PARQUET":
+		return FormatParquet, nil
+	}
+	return "", fmt.Errorf("unknown export format %q; use %s, %s or %s", name, FormatCSV, FormatNDJSON, FormatParquet)
+}
+
+// Extension returns the file extension of the format, without a dot
+func (f Format) Extension() string {
+	switch f {
+	case FormatNDJSON:
+		return "ndjson"
+	case FormatParquet:
+		return "parquet"
+	default:
+		return "csv"
+	}
+}
+
+// ContentType returns the media type of the format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatParquet:
+		return "application/vnd.apache.parquet"
+	default:
+		return "text/csv"
+	}
+}
+
+// Encoder writes records in one format
+type Encoder interface {
+	// Encode writes one record
+	Encode(record Record) error
+	// Close writes anything buffered and the end of the file. It does not close
+	// the underlying writer.
+	Close() error
+}
+
+// NewEncoder returns an encoder writing records with the given columns to w
+func NewEncoder(w io.Writer, format Format, columns []Column) (Encoder, error) {
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("an export needs at least one column")
+	}
+
+	switch format {
+	case FormatCSV:
+		return newCSVEncoder(w, columns)
+	case FormatNDJSON:
+		return &ndjsonEncoder{w: bufio.NewWriter(w), columns: columns}, nil
+	case FormatParquet:
+		return newParquetEncoder(w, columns), nil
+	}
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+// csvEncoder writes a header row of column names followed by one row per record.
+// Lists and objects are written as JSON, as the importer reads them.
+type csvEncoder struct {
+	w       *csv.Writer
+	columns []Column
+	row     []string
+}
+
+func newCSVEncoder(w io.Writer, columns []Column) (*csvEncoder, error) {
+	encoder := &csvEncoder{w: csv.NewWriter(w), columns: columns, row: make([]string, len(columns))}
+
+	for i, column := range columns {
+		encoder.row[i] = column.Name
+	}
+	if err := encoder.w.Write(encoder.row); err != nil {
+		return nil, fmt.Errorf("failed to write CSV header: %w", err)
+	}
+	return encoder, nil
+}
+
+func (e *csvEncoder) Encode(record Record) error {
+	for i, column := range e.columns {
+		value, _, err := text(record[column.Name])
+		if err != nil {
+			return fmt.Errorf("column %s: %w", column.Name, err)
+		}
+		e.row[i] = value
+	}
+	return e.w.Write(e.row)
+}
+
+func (e *csvEncoder) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// ndjsonEncoder writes each record as a JSON object with its fields in column
+// order. Empty values are left out.
+type ndjsonEncoder struct {
+	w       *bufio.Writer
+	columns []Column
+	line    bytes.Buffer
+}
+
+func (e *ndjsonEncoder) Encode(record Record) error {
+	e.line.Reset()
+	e.line.WriteByte('{')
+	first := true
+	for _, column := range e.columns {
+		value := record[column.Name]
+		if value == nil {
+			continue
+		}
+
+		name, _ := json.Marshal(column.Name)
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", column.Name, err)
+		}
+		if !first {
+			e.line.WriteByte(',')
+		}
+		first = false
+		e.line.Write(name)
+		e.line.WriteByte(':')
+		e.line.Write(data)
+	}
+	e.line.WriteString("}\n")
+
+	_, err := e.w.Write(e.line.Bytes())
+	return err
+}
+
+func (e *ndjsonEncoder) Close() error {
+	return e.w.Flush()
+}
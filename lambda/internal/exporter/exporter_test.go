@@ -0,0 +1,210 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+)
+
+func testUnit() *models.Unit {
+	trim := "Sleeper"
+	return &models.Unit{
+		AccountID:    "acct-1",
+		ID:           "unit-1",
+		UnitType:     "commercialVehicleType",
+		SuggestedVin: "1XKAD49X5CJ123456",
+		Make:         "Kenworth",
+		ModelYear:    "2012",
+		Note:         "has a, comma",
+		Trim:         &trim,
+		CreatedAt:    1700000000,
+		Version:      3,
+		ExtendedAttributes: []models.ExtendedAttribute{
+			{AttributeName: "fleet", AttributeValue: "north"},
+		},
+	}
+}
+
+func columnNames(columns []Column) []string {
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.Name
+	}
+	return names
+}
+
+func TestUnitColumns(t *testing.T) {
+	columns := UnitColumns()
+	names := columnNames(columns)
+
+	assert.Equal(t, []string{"accountId", "id", "unitType"}, names[:3])
+	assert.Contains(t, names, "extendedAttributes")
+	assert.NotContains(t, names, "deletedAt")
+	assert.NotContains(t, names, "expiresAt")
+
+	types := make(map[string]ColumnType)
+	for _, column := range columns {
+		types[column.Name] = column.Type
+	}
+	assert.Equal(t, ColumnString, types["suggestedVin"])
+	assert.Equal(t, ColumnInt64, types["createdAt"])
+	assert.Equal(t, ColumnInt64, types["version"])
+	assert.Equal(t, ColumnJSON, types["acesAttributes"])
+
+	assert.Equal(t, []string{"accountId", "unitType"}, columnNames(Without(columns[:3], []string{"id"})))
+}
+
+func TestDynamicUnitColumns(t *testing.T) {
+	schema := &models.UnitTypeSchema{
+		UnitType: "trailer",
+		Schema: json.RawMessage(`{"type":"object","properties":{
+			"name":{"type":"string"},
+			"axles":{"type":"integer"},
+			"tags":{"type":"array"},
+			"id":{"type":"string"}
+		}}`),
+	}
+
+	columns := DynamicUnitColumns(schema)
+	assert.Equal(t, []string{"id", "accountId", "unitType", "schemaVersion", "createdAt", "updatedAt", "axles", "name", "tags"}, columnNames(columns))
+	assert.Equal(t, ColumnInt64, columns[6].Type)
+	assert.Equal(t, ColumnString, columns[7].Type)
+	assert.Equal(t, ColumnJSON, columns[8].Type)
+
+	record, err := DynamicUnitRecord(&models.DynamicUnit{
+		ID:        "unit-1",
+		AccountID: "acct-1",
+		UnitType:  "trailer",
+		Data:      map[string]interface{}{"name": "Flatbed", "axles": 2, "id": "ignored"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "unit-1", record["id"])
+	assert.Equal(t, "Flatbed", record["name"])
+	assert.Equal(t, json.Number("2"), record["axles"])
+	assert.NotContains(t, record, "data")
+}
+
+func TestCSVEncoder(t *testing.T) {
+	columns := []Column{{Name: "id"}, {Name: "make"}, {Name: "note"}, {Name: "trim"}, {Name: "createdAt", Type: ColumnInt64}, {Name: "extendedAttributes", Type: ColumnJSON}}
+
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, FormatCSV, columns)
+	require.NoError(t, err)
+	record, err := UnitRecord(testUnit())
+	require.NoError(t, err)
+	require.NoError(t, encoder.Encode(record))
+	require.NoError(t, encoder.Encode(Record{"id": "unit-2"}))
+	require.NoError(t, encoder.Close())
+
+	assert.Equal(t, "id,make,note,trim,createdAt,extendedAttributes\n"+
+		`unit-1,Kenworth,"has a, comma",Sleeper,1700000000,"[{""attributeName"":""fleet"",""attributeValue"":""north""}]"`+"\n"+
+		"unit-2,,,,,\n", buf.String())
+}
+
+func TestNDJSONEncoder(t *testing.T) {
+	columns := []Column{{Name: "id"}, {Name: "trim"}, {Name: "version", Type: ColumnInt64}, {Name: "extendedAttributes", Type: ColumnJSON}}
+
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, FormatNDJSON, columns)
+	require.NoError(t, err)
+	record, err := UnitRecord(testUnit())
+	require.NoError(t, err)
+	require.NoError(t, encoder.Encode(record))
+	require.NoError(t, encoder.Encode(Record{"id": "unit-2"}))
+	require.NoError(t, encoder.Close())
+
+	assert.Equal(t, `{"id":"unit-1","trim":"Sleeper","version":3,"extendedAttributes":[{"attributeName":"fleet","attributeValue":"north"}]}`+"\n"+
+		`{"id":"unit-2"}`+"\n", buf.String())
+}
+
+func TestNewEncoder(t *testing.T) {
+	_, err := NewEncoder(&bytes.Buffer{}, FormatCSV, nil)
+	assert.Error(t, err)
+	_, err = NewEncoder(&bytes.Buffer{}, "XLSX", UnitColumns())
+	assert.Error(t, err)
+
+	format, err := ParseFormat("parquet")
+	require.NoError(t, err)
+	assert.Equal(t, FormatParquet, format)
+	assert.Equal(t, "parquet", format.Extension())
+	_, err = ParseFormat("xlsx")
+	assert.Error(t, err)
+}
+
+func TestParquetEncoder(t *testing.T) {
+	columns := []Column{{Name: "id"}, {Name: "trim"}, {Name: "version", Type: ColumnInt64}, {Name: "extendedAttributes", Type: ColumnJSON}}
+
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, FormatParquet, columns)
+	require.NoError(t, err)
+	record, err := UnitRecord(testUnit())
+	require.NoError(t, err)
+	require.NoError(t, encoder.Encode(record))
+	require.NoError(t, encoder.Encode(Record{"id": "unit-2", "version": json.Number("7")}))
+	assert.Error(t, encoder.Encode(Record{"id": "unit-3", "version": "seven"}))
+	require.NoError(t, encoder.Close())
+
+	file := readParquet(t, buf.Bytes())
+	assert.Equal(t, int64(2), file.NumRows())
+
+	// The columns keep their export order, each optional and typed
+	schema := file.Metadata().Schema
+	require.Len(t, schema, 5)
+	names := make([]string, 0, 4)
+	for _, element := range schema[1:] {
+		names = append(names, element.Name)
+		require.NotNil(t, element.RepetitionType)
+		assert.Equal(t, format.Optional, *element.RepetitionType, element.Name)
+	}
+	assert.Equal(t, []string{"id", "trim", "version", "extendedAttributes"}, names)
+	assert.NotNil(t, schema[2].LogicalType.UTF8)
+	assert.Equal(t, format.Int64, *schema[3].Type)
+	assert.NotNil(t, schema[4].LogicalType.Json)
+
+	rows := make([]parquet.Row, 3)
+	reader := parquet.NewReader(file)
+	n, err := reader.ReadRows(rows)
+	if err != io.EOF {
+		require.NoError(t, err)
+	}
+	require.Equal(t, 2, n)
+
+	first, second := rows[0], rows[1]
+	assert.Equal(t, "unit-1", first[0].String())
+	assert.Equal(t, "Sleeper", first[1].String())
+	assert.Equal(t, int64(3), first[2].Int64())
+	assert.JSONEq(t, `[{"attributeName":"fleet","attributeValue":"north"}]`, string(first[3].ByteArray()))
+
+	// Empty values are null
+	assert.Equal(t, "unit-2", second[0].String())
+	assert.True(t, second[1].IsNull())
+	assert.Equal(t, int64(7), second[2].Int64())
+	assert.True(t, second[3].IsNull())
+}
+
+func TestParquetEncoderEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, FormatParquet, []Column{{Name: "id"}})
+	require.NoError(t, err)
+	require.NoError(t, encoder.Close())
+
+	file := readParquet(t, buf.Bytes())
+	assert.Equal(t, int64(0), file.NumRows())
+	assert.True(t, strings.HasPrefix(buf.String(), "PAR1"))
+}
+
+// readParquet opens an encoded Parquet file
+func readParquet(t *testing.T, data []byte) *parquet.File {
+	file, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	return file
+}
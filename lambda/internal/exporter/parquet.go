@@ -0,0 +1,134 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetRowGroupSize is how many rows are buffered before a row group is written
+const parquetRowGroupSize = 10000
+
+// parquetEncoder writes records as a Parquet file of flat optional columns, one
+// row group per parquetRowGroupSize records. Text is written as STRING, lists and
+// objects as JSON, and timestamps and versions as INT64.
+type parquetEncoder struct {
+	w       *parquet.Writer
+	columns []Column
+	row     []parquet.Row
+}
+
+func newParquetEncoder(w io.Writer, columns []Column) *parquetEncoder {
+	writer := parquet.NewWriter(w,
+		parquet.NewSchema("schema", newParquetColumns(columns)),
+		parquet.MaxRowsPerRowGroup(parquetRowGroupSize),
+	)
+	return &parquetEncoder{
+		w:       writer,
+		columns: columns,
+		row:     []parquet.Row{make(parquet.Row, len(columns))},
+	}
+}
+
+func (e *parquetEncoder) Encode(record Record) error {
+	// Convert every value before writing any, so a bad value leaves the row out whole
+	row := e.row[0]
+	for i, column := range e.columns {
+		value, err := parquetValue(column, record[column.Name])
+		if err != nil {
+			return fmt.Errorf("column %s: %w", column.Name, err)
+		}
+		definitionLevel := 1
+		if value.IsNull() {
+			definitionLevel = 0
+		}
+		row[i] = value.Level(0, definitionLevel, i)
+	}
+
+	_, err := e.w.WriteRows(e.row)
+	return err
+}
+
+func (e *parquetEncoder) Close() error {
+	return e.w.Close()
+}
+
+// parquetColumns is the root of the export schema. parquet.Group orders its
+// fields by name, so the fields are also kept in a slice to write the columns in
+// export order.
+type parquetColumns struct {
+	parquet.Group
+	fields []parquet.Field
+}
+
+func newParquetColumns(columns []Column) *parquetColumns {
+	root := &parquetColumns{Group: parquet.Group{}, fields: make([]parquet.Field, len(columns))}
+	for i, column := range columns {
+		node := parquet.Optional(parquetNode(column.Type))
+		root.Group[column.Name] = node
+		root.fields[i] = parquet.Group{column.Name: node}.Fields()[0]
+	}
+	return root
+}
+
+func (g *parquetColumns) Fields() []parquet.Field {
+	return g.fields
+}
+
+// parquetNode returns the Parquet type of a column
+func parquetNode(columnType ColumnType) parquet.Node {
+	switch columnType {
+	case ColumnInt64:
+		return parquet.Int(64)
+	case ColumnJSON:
+		return parquet.JSON()
+	default:
+		return parquet.String()
+	}
+}
+
+// parquetValue converts a value to the column's Parquet type, or a null value
+// for an empty value
+func parquetValue(column Column, value interface{}) (parquet.Value, error) {
+	if column.Type == ColumnInt64 {
+		if value == nil {
+			return parquet.NullValue(), nil
+		}
+		n, err := int64Value(value)
+		if err != nil {
+			return parquet.NullValue(), err
+		}
+		return parquet.Int64Value(n), nil
+	}
+
+	s, ok, err := text(value)
+	if err != nil || !ok {
+		return parquet.NullValue(), err
+	}
+	return parquet.ByteArrayValue([]byte(s)), nil
+}
+
+// int64Value converts a decoded JSON number to an integer
+func int64Value(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, nil
+		}
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+			return int64(f), nil
+		}
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<63 {
+			return int64(v), nil
+		}
+	case int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	}
+	return 0, fmt.Errorf("%v is not an integer", value)
+}
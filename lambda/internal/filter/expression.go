@@ -0,0 +1,175 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Expression is a compiled DynamoDB filter expression with its bound names and values
+type Expression struct {
+	Condition string
+	Names     map[string]string
+	Values    map[string]types.AttributeValue
+}
+
+// compiler accumulates placeholders while walking a filter
+type compiler struct {
+	names     map[string]string
+	nameByKey map[string]string
+	values    map[string]types.AttributeValue
+}
+
+// Compile turns a parsed filter into a DynamoDB filter expression.
+// Placeholders use the #flt/:flt prefixes so they never collide with the
+// names and values the repositories bind for their own conditions.
+func Compile(f *Filter) (*Expression, error) {
+	if f == nil {
+		return nil, &Error{Message: "filter cannot be nil"}
+	}
+
+	c := &compiler{
+		names:     make(map[string]string),
+		nameByKey: make(map[string]string),
+		values:    make(map[string]types.AttributeValue),
+	}
+	condition, err := c.compile(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Expression{
+		Condition: condition,
+		Names:     c.names,
+		Values:    c.values,
+	}, nil
+}
+
+// ParseAndCompile parses a raw filter document and compiles it in one step
+func ParseAndCompile(raw string) (*Expression, error) {
+	f, err := Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	return Compile(f)
+}
+
+func (c *compiler) compile(f *Filter) (string, error) {
+	switch {
+	case f.And != nil:
+		return c.compileGroup(f.And, " AND ")
+	case f.Or != nil:
+		return c.compileGroup(f.Or, " OR ")
+	default:
+		return c.compileCondition(f)
+	}
+}
+
+func (c *compiler) compileGroup(children []*Filter, joiner string) (string, error) {
+	parts := make([]string, 0, len(children))
+	for _, child := range children {
+		part, err := c.compile(child)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, part)
+	}
+	return "(" + strings.Join(parts, joiner) + ")", nil
+}
+
+func (c *compiler) compileCondition(f *Filter) (string, error) {
+	name := c.name(f.Field)
+
+	switch f.Op {
+	case OpEq:
+		value, err := scalarValue(f.Value)
+		if err != nil {
+			return "", &Error{Message: err.Error()}
+		}
+		return fmt.Sprintf("%s = %s", name, c.value(c.attributeValue(f.Field, value))), nil
+	case OpBeginsWith, OpContains:
+		var s string
+		if err := json.Unmarshal(f.Value, &s); err != nil {
+			return "", &Error{Message: fmt.Sprintf("%s requires a string value", f.Op)}
+		}
+		return fmt.Sprintf("%s(%s, %s)", f.Op, name, c.value(&types.AttributeValueMemberS{Value: s})), nil
+	case OpGt, OpGte, OpLt, OpLte:
+		n, err := integerValue(f.Value)
+		if err != nil {
+			return "", &Error{Message: err.Error()}
+		}
+		return c.numericComparison(name, f.Op, n), nil
+	case OpBetween:
+		low, high, err := rangeValue(f.Value)
+		if err != nil {
+			return "", &Error{Message: err.Error()}
+		}
+		return fmt.Sprintf("(%s AND %s)", c.numericComparison(name, OpGte, low), c.numericComparison(name, OpLte, high)), nil
+	default:
+		return "", &Error{Message: fmt.Sprintf("unsupported operator %q", f.Op)}
+	}
+}
+
+// numericComparison compares a digit string attribute against n by length and
+// then lexically, e.g. gte 9000 => size > 4 OR (size = 4 AND value >= "9000").
+// Empty strings are excluded so that missing years never satisfy an upper bound.
+func (c *compiler) numericComparison(name string, op Operator, n int64) string {
+	digits := formatInteger(n)
+	length := c.value(&types.AttributeValueMemberN{Value: strconv.Itoa(len(digits))})
+	bound := c.value(&types.AttributeValueMemberS{Value: digits})
+
+	var sizeOp, valueOp string
+	switch op {
+	case OpGt:
+		sizeOp, valueOp = ">", ">"
+	case OpGte:
+		sizeOp, valueOp = ">", ">="
+	case OpLt:
+		sizeOp, valueOp = "<", "<"
+	default:
+		sizeOp, valueOp = "<", "<="
+	}
+
+	comparison := fmt.Sprintf("(size(%s) %s %s OR (size(%s) = %s AND %s %s %s))", name, sizeOp, length, name, length, name, valueOp, bound)
+	if sizeOp == "<" {
+		empty := c.value(&types.AttributeValueMemberS{Value: ""})
+		comparison = fmt.Sprintf("(%s <> %s AND %s)", name, empty, comparison)
+	}
+	return comparison
+}
+
+// attributeValue converts an equality operand; numeric fields are stored as strings
+func (c *compiler) attributeValue(field string, value interface{}) types.AttributeValue {
+	switch v := value.(type) {
+	case bool:
+		return &types.AttributeValueMemberBOOL{Value: v}
+	case json.Number:
+		if NumericFields[field] {
+			return &types.AttributeValueMemberS{Value: v.String()}
+		}
+		return &types.AttributeValueMemberN{Value: v.String()}
+	default:
+		return &types.AttributeValueMemberS{Value: fmt.Sprint(v)}
+	}
+}
+
+// name returns the placeholder for a field, reusing it across conditions
+func (c *compiler) name(field string) string {
+	if placeholder, ok := c.nameByKey[field]; ok {
+		return placeholder
+	}
+	placeholder := fmt.Sprintf("#flt%d", len(c.names))
+	c.names[placeholder] = field
+	c.nameByKey[field] = placeholder
+	return placeholder
+}
+
+// value binds a new value placeholder
+func (c *compiler) value(av types.AttributeValue) string {
+	placeholder := fmt.Sprintf(":flt%d", len(c.values))
+	c.values[placeholder] = av
+	return placeholder
+}
@@ -0,0 +1,276 @@
+// Package filter implements the structured filter grammar accepted by listUnits
+// and compiles it into DynamoDB filter expressions.
+//
+// A filter is a JSON document made of condition and group nodes:
+//
+//	{"field": "make", "op": "eq", "value": "Ford"}
+//	{"field": "modelYear", "op": "between", "value": [2015, 2020]}
+//	{"and": [{...}, {"or": [{...}, {...}]}]}
+//
+// Field names and values are never interpolated into the expression; they are
+// always bound through ExpressionAttributeNames and ExpressionAttributeValues.
+package filter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Operator is a comparison supported by a filter condition
+type Operator string
+
+const (
+	OpEq         Operator = "eq"
+	OpBeginsWith Operator = "begins_with"
+	OpContains   Operator = "contains"
+	OpGt         Operator = "gt"
+	OpGte        Operator = "gte"
+	OpLt         Operator = "lt"
+	OpLte        Operator = "lte"
+	OpBetween    Operator = "between"
+)
+
+const (
+	// MaxDepth is the deepest nesting of and/or groups accepted in a filter
+	MaxDepth = 4
+	// MaxConditions is the largest number of field conditions accepted in a filter
+	MaxConditions = 20
+)
+
+// NumericFields are the fields that support numeric range operators.
+// They are stored as strings of digits, so ranges are compiled to compare by
+// length first and lexically second, which orders non-negative integers correctly.
+var NumericFields = map[string]bool{
+	"modelYear":                    true,
+	"grossVehicleWeightRatingFrom": true,
+	"grossVehicleWeightRatingTo":   true,
+}
+
+// Filter is one node of a parsed filter: either an and/or group or a field condition
+type Filter struct {
+	And   []*Filter       `json:"and,omitempty"`
+	Or    []*Filter       `json:"or,omitempty"`
+	Field string          `json:"field,omitempty"`
+	Op    Operator        `json:"op,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Error describes a malformed or disallowed filter
+type Error struct {
+	Path    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// Parse decodes and validates a filter document.
+// It checks structure, operators and values but not field names; see Validate.
+func Parse(raw string) (*Filter, error) {
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.DisallowUnknownFields()
+
+	var f Filter
+	if err := decoder.Decode(&f); err != nil {
+		return nil, &Error{Message: fmt.Sprintf("filter is not a valid filter document: %v", err)}
+	}
+	if decoder.More() {
+		return nil, &Error{Message: "filter must be a single JSON object"}
+	}
+
+	conditions := 0
+	if err := f.check("filter", 1, &conditions); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// check validates the node shape recursively
+func (f *Filter) check(path string, depth int, conditions *int) error {
+	if depth > MaxDepth {
+		return &Error{Path: path, Message: fmt.Sprintf("filter nesting exceeds %d levels", MaxDepth)}
+	}
+
+	isGroup := f.And != nil || f.Or != nil
+	isCondition := f.Field != "" || f.Op != "" || f.Value != nil
+
+	switch {
+	case isGroup && isCondition:
+		return &Error{Path: path, Message: "a node must be either an and/or group or a field condition"}
+	case f.And != nil && f.Or != nil:
+		return &Error{Path: path, Message: "a group must use either and or or, not both"}
+	case isGroup:
+		children, key := f.And, "and"
+		if f.Or != nil {
+			children, key = f.Or, "or"
+		}
+		if len(children) == 0 {
+			return &Error{Path: path, Message: fmt.Sprintf("%s must contain at least one filter", key)}
+		}
+		for i, child := range children {
+			if child == nil {
+				return &Error{Path: fmt.Sprintf("%s.%s[%d]", path, key, i), Message: "filter cannot be null"}
+			}
+			if err := child.check(fmt.Sprintf("%s.%s[%d]", path, key, i), depth+1, conditions); err != nil {
+				return err
+			}
+		}
+		return nil
+	case isCondition:
+		*conditions++
+		if *conditions > MaxConditions {
+			return &Error{Path: path, Message: fmt.Sprintf("filter exceeds %d conditions", MaxConditions)}
+		}
+		return f.checkCondition(path)
+	default:
+		return &Error{Path: path, Message: "filter cannot be empty"}
+	}
+}
+
+// checkCondition validates the operator and value of a field condition
+func (f *Filter) checkCondition(path string) error {
+	if f.Field == "" {
+		return &Error{Path: path, Message: "field is required"}
+	}
+	if f.Value == nil {
+		return &Error{Path: path, Message: "value is required"}
+	}
+
+	switch f.Op {
+	case OpEq:
+		if _, err := scalarValue(f.Value); err != nil {
+			return &Error{Path: path, Message: err.Error()}
+		}
+	case OpBeginsWith, OpContains:
+		var s string
+		if err := json.Unmarshal(f.Value, &s); err != nil || s == "" {
+			return &Error{Path: path, Message: fmt.Sprintf("%s requires a non-empty string value", f.Op)}
+		}
+	case OpGt, OpGte, OpLt, OpLte:
+		if err := f.checkNumericField(path); err != nil {
+			return err
+		}
+		if _, err := integerValue(f.Value); err != nil {
+			return &Error{Path: path, Message: fmt.Sprintf("%s %s", f.Op, err.Error())}
+		}
+	case OpBetween:
+		if err := f.checkNumericField(path); err != nil {
+			return err
+		}
+		low, high, err := rangeValue(f.Value)
+		if err != nil {
+			return &Error{Path: path, Message: err.Error()}
+		}
+		if low > high {
+			return &Error{Path: path, Message: "between lower bound must not exceed the upper bound"}
+		}
+	case "":
+		return &Error{Path: path, Message: "op is required"}
+	default:
+		return &Error{Path: path, Message: fmt.Sprintf("unsupported operator %q", f.Op)}
+	}
+	return nil
+}
+
+// checkNumericField rejects range operators on fields that are not numeric
+func (f *Filter) checkNumericField(path string) error {
+	if !NumericFields[f.Field] {
+		return &Error{Path: path, Message: fmt.Sprintf("operator %s is only supported on %s", f.Op, strings.Join(numericFieldNames(), ", "))}
+	}
+	return nil
+}
+
+// Validate rejects conditions on fields outside the allowed set
+func (f *Filter) Validate(allowed []string) error {
+	allowedSet := make(map[string]bool, len(allowed))
+	for _, name := range allowed {
+		allowedSet[name] = true
+	}
+	return f.validateFields("filter", allowedSet)
+}
+
+func (f *Filter) validateFields(path string, allowed map[string]bool) error {
+	for i, child := range f.And {
+		if err := child.validateFields(fmt.Sprintf("%s.and[%d]", path, i), allowed); err != nil {
+			return err
+		}
+	}
+	for i, child := range f.Or {
+		if err := child.validateFields(fmt.Sprintf("%s.or[%d]", path, i), allowed); err != nil {
+			return err
+		}
+	}
+	if f.Field != "" && !allowed[f.Field] {
+		return &Error{Path: path, Message: fmt.Sprintf("unknown field %q", f.Field)}
+	}
+	return nil
+}
+
+// scalarValue decodes an equality operand, which must be a string, number or boolean
+func scalarValue(raw json.RawMessage) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("invalid value: %v", err)
+	}
+	switch value.(type) {
+	case string, json.Number, bool:
+		return value, nil
+	default:
+		return nil, fmt.Errorf("eq requires a string, number or boolean value")
+	}
+}
+
+// integerValue decodes a numeric range operand, which must be a non-negative integer
+func integerValue(raw json.RawMessage) (int64, error) {
+	var n float64
+	if err := json.Unmarshal(raw, &n); err != nil {
+		return 0, fmt.Errorf("requires a numeric value")
+	}
+	if n < 0 || n != math.Trunc(n) || n > math.MaxInt32 {
+		return 0, fmt.Errorf("requires a non-negative integer value")
+	}
+	return int64(n), nil
+}
+
+// rangeValue decodes a between operand of the form [low, high]
+func rangeValue(raw json.RawMessage) (int64, int64, error) {
+	var bounds []json.RawMessage
+	if err := json.Unmarshal(raw, &bounds); err != nil || len(bounds) != 2 {
+		return 0, 0, fmt.Errorf("between requires a [low, high] array value")
+	}
+	low, err := integerValue(bounds[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("between %s", err.Error())
+	}
+	high, err := integerValue(bounds[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("between %s", err.Error())
+	}
+	return low, high, nil
+}
+
+func numericFieldNames() []string {
+	names := make([]string, 0, len(NumericFields))
+	for name := range NumericFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// formatInteger renders a range bound the way numeric fields are stored
+func formatInteger(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
@@ -0,0 +1,177 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse_Valid(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{name: "equality", raw: `{"field":"make","op":"eq","value":"Ford"}`},
+		{name: "begins_with", raw: `{"field":"model","op":"begins_with","value":"F-"}`},
+		{name: "contains", raw: `{"field":"note","op":"contains","value":"fleet"}`},
+		{name: "numeric range", raw: `{"field":"modelYear","op":"gte","value":2015}`},
+		{name: "between", raw: `{"field":"grossVehicleWeightRatingFrom","op":"between","value":[10000,26000]}`},
+		{name: "nested groups", raw: `{"and":[{"field":"make","op":"eq","value":"Ford"},{"or":[{"field":"modelYear","op":"lt","value":2000},{"field":"modelYear","op":"gt","value":2020}]}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Parse(tt.raw)
+			require.NoError(t, err)
+			assert.NotNil(t, f)
+		})
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr string
+	}{
+		{name: "not json", raw: `make = Ford`, wantErr: "not a valid filter document"},
+		{name: "unknown key", raw: `{"field":"make","operator":"eq","value":"Ford"}`, wantErr: "not a valid filter document"},
+		{name: "trailing document", raw: `{"field":"make","op":"eq","value":"Ford"} {}`, wantErr: "single JSON object"},
+		{name: "empty", raw: `{}`, wantErr: "cannot be empty"},
+		{name: "missing op", raw: `{"field":"make","value":"Ford"}`, wantErr: "op is required"},
+		{name: "missing value", raw: `{"field":"make","op":"eq"}`, wantErr: "value is required"},
+		{name: "unknown operator", raw: `{"field":"make","op":"like","value":"F%"}`, wantErr: `unsupported operator "like"`},
+		{name: "object equality", raw: `{"field":"make","op":"eq","value":{"a":1}}`, wantErr: "string, number or boolean"},
+		{name: "empty prefix", raw: `{"field":"make","op":"begins_with","value":""}`, wantErr: "non-empty string"},
+		{name: "range on text field", raw: `{"field":"make","op":"gt","value":1}`, wantErr: "only supported on"},
+		{name: "range with text value", raw: `{"field":"modelYear","op":"gt","value":"2015"}`, wantErr: "numeric value"},
+		{name: "negative range", raw: `{"field":"modelYear","op":"gt","value":-1}`, wantErr: "non-negative integer"},
+		{name: "between inverted", raw: `{"field":"modelYear","op":"between","value":[2020,2010]}`, wantErr: "lower bound"},
+		{name: "between wrong arity", raw: `{"field":"modelYear","op":"between","value":[2020]}`, wantErr: "[low, high]"},
+		{name: "empty group", raw: `{"and":[]}`, wantErr: "filter: and must contain at least one filter"},
+		{name: "mixed node", raw: `{"and":[{"field":"make","op":"eq","value":"Ford"}],"field":"model"}`, wantErr: "either an and/or group or a field condition"},
+		{name: "and with or", raw: `{"and":[{"field":"make","op":"eq","value":"A"}],"or":[{"field":"make","op":"eq","value":"B"}]}`, wantErr: "not both"},
+		{name: "too deep", raw: `{"and":[{"and":[{"and":[{"and":[{"field":"make","op":"eq","value":"A"}]}]}]}]}`, wantErr: "nesting exceeds"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.raw)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+
+			var filterErr *Error
+			assert.ErrorAs(t, err, &filterErr)
+		})
+	}
+}
+
+func TestParse_TooManyConditions(t *testing.T) {
+	raw := `{"or":[`
+	for i := 0; i <= MaxConditions; i++ {
+		if i > 0 {
+			raw += ","
+		}
+		raw += `{"field":"make","op":"eq","value":"Ford"}`
+	}
+	raw += `]}`
+
+	_, err := Parse(raw)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeds 20 conditions")
+}
+
+func TestFilter_Validate(t *testing.T) {
+	f, err := Parse(`{"and":[{"field":"make","op":"eq","value":"Ford"},{"or":[{"field":"colour","op":"eq","value":"red"}]}]}`)
+	require.NoError(t, err)
+
+	assert.NoError(t, f.Validate([]string{"make", "colour"}))
+
+	err = f.Validate([]string{"make", "model"})
+	require.Error(t, err)
+	assert.Equal(t, `filter.and[1].or[0]: unknown field "colour"`, err.Error())
+}
+
+func TestCompile_Conditions(t *testing.T) {
+	tests := []struct {
+		name          string
+		raw           string
+		wantCondition string
+		wantNames     map[string]string
+		wantValues    map[string]types.AttributeValue
+	}{
+		{
+			name:          "string equality",
+			raw:           `{"field":"make","op":"eq","value":"Ford"}`,
+			wantCondition: "#flt0 = :flt0",
+			wantNames:     map[string]string{"#flt0": "make"},
+			wantValues:    map[string]types.AttributeValue{":flt0": &types.AttributeValueMemberS{Value: "Ford"}},
+		},
+		{
+			name:          "numeric field equality is stored as a string",
+			raw:           `{"field":"modelYear","op":"eq","value":2020}`,
+			wantCondition: "#flt0 = :flt0",
+			wantNames:     map[string]string{"#flt0": "modelYear"},
+			wantValues:    map[string]types.AttributeValue{":flt0": &types.AttributeValueMemberS{Value: "2020"}},
+		},
+		{
+			name:          "begins_with",
+			raw:           `{"field":"model","op":"begins_with","value":"F-"}`,
+			wantCondition: "begins_with(#flt0, :flt0)",
+			wantNames:     map[string]string{"#flt0": "model"},
+			wantValues:    map[string]types.AttributeValue{":flt0": &types.AttributeValueMemberS{Value: "F-"}},
+		},
+		{
+			name:          "gte compares by length then value",
+			raw:           `{"field":"grossVehicleWeightRatingTo","op":"gte","value":9000}`,
+			wantCondition: "(size(#flt0) > :flt0 OR (size(#flt0) = :flt0 AND #flt0 >= :flt1))",
+			wantNames:     map[string]string{"#flt0": "grossVehicleWeightRatingTo"},
+			wantValues: map[string]types.AttributeValue{
+				":flt0": &types.AttributeValueMemberN{Value: "4"},
+				":flt1": &types.AttributeValueMemberS{Value: "9000"},
+			},
+		},
+		{
+			name:          "lt excludes empty values",
+			raw:           `{"field":"modelYear","op":"lt","value":2000}`,
+			wantCondition: "(#flt0 <> :flt2 AND (size(#flt0) < :flt0 OR (size(#flt0) = :flt0 AND #flt0 < :flt1)))",
+			wantNames:     map[string]string{"#flt0": "modelYear"},
+			wantValues: map[string]types.AttributeValue{
+				":flt0": &types.AttributeValueMemberN{Value: "4"},
+				":flt1": &types.AttributeValueMemberS{Value: "2000"},
+				":flt2": &types.AttributeValueMemberS{Value: ""},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := ParseAndCompile(tt.raw)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCondition, expr.Condition)
+			assert.Equal(t, tt.wantNames, expr.Names)
+			assert.Equal(t, tt.wantValues, expr.Values)
+		})
+	}
+}
+
+func TestCompile_GroupsReuseFieldPlaceholders(t *testing.T) {
+	expr, err := ParseAndCompile(`{"and":[{"field":"make","op":"eq","value":"Ford"},{"or":[{"field":"make","op":"eq","value":"Mack"},{"field":"modelYear","op":"between","value":[2015,2020]}]}]}`)
+	require.NoError(t, err)
+
+	assert.Equal(t,
+		"(#flt0 = :flt0 AND (#flt0 = :flt1 OR ((size(#flt1) > :flt2 OR (size(#flt1) = :flt2 AND #flt1 >= :flt3)) AND (#flt1 <> :flt6 AND (size(#flt1) < :flt4 OR (size(#flt1) = :flt4 AND #flt1 <= :flt5))))))",
+		expr.Condition)
+	assert.Equal(t, map[string]string{"#flt0": "make", "#flt1": "modelYear"}, expr.Names)
+	assert.Len(t, expr.Values, 7)
+}
+
+func TestCompile_UserInputIsNeverInterpolated(t *testing.T) {
+	expr, err := ParseAndCompile(`{"field":"make) OR (attribute_exists(pk","op":"eq","value":"x) OR (1 = 1"}`)
+	require.NoError(t, err)
+
+	assert.Equal(t, "#flt0 = :flt0", expr.Condition)
+	assert.Equal(t, "make) OR (attribute_exists(pk", expr.Names["#flt0"])
+}
@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/steverhoton/unt-units-svc/internal/auth"
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+// AuthorizedHandlers checks the accountId of every request against the caller's
+// identity before delegating to the wrapped handler set
+type AuthorizedHandlers struct {
+	next       CRUDHandlers
+	authorizer *auth.Authorizer
+}
+
+// NewAuthorizedHandlers wraps next with account authorization
+func NewAuthorizedHandlers(next CRUDHandlers, authorizer *auth.Authorizer) *AuthorizedHandlers {
+	return &AuthorizedHandlers{
+		next:       next,
+		authorizer: authorizer,
+	}
+}
+
+// authorize returns an error response when the caller may not act on the
+// requested account. Requests without an accountId are left to the wrapped
+// handler, which rejects them as invalid.
+func (h *AuthorizedHandlers) authorize(ctx context.Context, event *appsync.AppSyncEvent) *appsync.Response {
+	accountID := event.GetAccountID()
+	if accountID == "" {
+		return nil
+	}
+	return authorizeAccount(ctx, h.authorizer, event, accountID)
+}
+
+// authorizeAccount returns an error response when the caller of event may not act
+// on accountID
+func authorizeAccount(ctx context.Context, authorizer *auth.Authorizer, event *appsync.AppSyncEvent, accountID string) *appsync.Response {
+	if err := authorizer.Authorize(ctx, event.Identity, accountID); err != nil {
+		if errors.Is(err, auth.ErrForbidden) {
+			log.Printf("Rejected %s: %v", event.FieldName, err)
+			return appsync.NewErrorResponse("FORBIDDEN", "Not authorized for account "+accountID, "")
+		}
+		log.Printf("Error authorizing %s: %v", event.FieldName, err)
+		return appsync.NewErrorResponse("AUTHORIZATION_FAILED", "Failed to authorize request", err.Error())
+	}
+	return nil
+}
+
+// HandleCreate authorizes and delegates unit creation requests
+func (h *AuthorizedHandlers) HandleCreate(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	if response := h.authorize(ctx, event); response != nil {
+		return response, nil
+	}
+	return h.next.HandleCreate(ctx, event)
+}
+
+// HandleRead authorizes and delegates unit retrieval requests
+func (h *AuthorizedHandlers) HandleRead(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	if response := h.authorize(ctx, event); response != nil {
+		return response, nil
+	}
+	return h.next.HandleRead(ctx, event)
+}
+
+// HandleUpdate authorizes and delegates unit update requests
+func (h *AuthorizedHandlers) HandleUpdate(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	if response := h.authorize(ctx, event); response != nil {
+		return response, nil
+	}
+	return h.next.HandleUpdate(ctx, event)
+}
+
+// HandleDelete authorizes and delegates unit deletion requests
+func (h *AuthorizedHandlers) HandleDelete(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	if response := h.authorize(ctx, event); response != nil {
+		return response, nil
+	}
+	return h.next.HandleDelete(ctx, event)
+}
+
+// HandleList authorizes and delegates unit listing requests
+func (h *AuthorizedHandlers) HandleList(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	if response := h.authorize(ctx, event); response != nil {
+		return response, nil
+	}
+	return h.next.HandleList(ctx, event)
+}
+
+// HandleRestore authorizes and delegates unit restore requests
+func (h *AuthorizedHandlers) HandleRestore(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	if response := h.authorize(ctx, event); response != nil {
+		return response, nil
+	}
+	return h.next.HandleRestore(ctx, event)
+}
+
+// HandleListDeleted authorizes and delegates deleted unit listing requests
+func (h *AuthorizedHandlers) HandleListDeleted(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	if response := h.authorize(ctx, event); response != nil {
+		return response, nil
+	}
+	return h.next.HandleListDeleted(ctx, event)
+}
+
+// HandlePurge authorizes and delegates unit purge requests
+func (h *AuthorizedHandlers) HandlePurge(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	if response := h.authorize(ctx, event); response != nil {
+		return response, nil
+	}
+	return h.next.HandlePurge(ctx, event)
+}
+
+// HandleGetByID delegates a lookup by unit ID and keeps only the units in
+// accounts the caller may act on, so units in other accounts are not revealed
+func (h *AuthorizedHandlers) HandleGetByID(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	lookup, ok := h.next.(UnitIDHandler)
+	if !ok {
+		return appsync.NewErrorResponse("UNKNOWN_OPERATION", "Unknown operation: "+event.FieldName, ""), nil
+	}
+
+	accounts, admin, err := h.authorizer.AllowedAccounts(ctx, event.Identity)
+	if err != nil {
+		log.Printf("Error authorizing %s: %v", event.FieldName, err)
+		return appsync.NewErrorResponse("AUTHORIZATION_FAILED", "Failed to authorize request", err.Error()), nil
+	}
+
+	response, err := lookup.HandleGetByID(ctx, event)
+	if err != nil || response == nil || !response.Success || admin {
+		return response, err
+	}
+
+	result, ok := response.Data.(*appsync.ListUnitsResponse)
+	if !ok {
+		return response, nil
+	}
+
+	allowed := make(map[string]bool, len(accounts))
+	for _, account := range accounts {
+		allowed[account] = true
+	}
+	scoped := &appsync.ListUnitsResponse{Items: make([]models.Unit, 0, len(result.Items))}
+	for _, unit := range result.Items {
+		if allowed[unit.AccountID] {
+			scoped.Items = append(scoped.Items, unit)
+		}
+	}
+	scoped.Count = len(scoped.Items)
+
+	return appsync.NewSuccessResponse(scoped, fmt.Sprintf("Retrieved %d units", scoped.Count)), nil
+}
+
+// HandleGetByVin authorizes and delegates lookups by VIN
+func (h *AuthorizedHandlers) HandleGetByVin(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	lookup, ok := h.next.(VinHandler)
+	if !ok {
+		return appsync.NewErrorResponse("UNKNOWN_OPERATION", "Unknown operation: "+event.FieldName, ""), nil
+	}
+	if response := h.authorize(ctx, event); response != nil {
+		return response, nil
+	}
+	return lookup.HandleGetByVin(ctx, event)
+}
+
+// HandleSearchByVin authorizes and delegates searches by VIN prefix
+func (h *AuthorizedHandlers) HandleSearchByVin(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	lookup, ok := h.next.(VinHandler)
+	if !ok {
+		return appsync.NewErrorResponse("UNKNOWN_OPERATION", "Unknown operation: "+event.FieldName, ""), nil
+	}
+	if response := h.authorize(ctx, event); response != nil {
+		return response, nil
+	}
+	return lookup.HandleSearchByVin(ctx, event)
+}
+
+// HandleImport authorizes and delegates bulk imports
+func (h *AuthorizedHandlers) HandleImport(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	bulk, ok := h.next.(ImportHandler)
+	if !ok {
+		return appsync.NewErrorResponse("UNKNOWN_OPERATION", "Unknown operation: "+event.FieldName, ""), nil
+	}
+	if response := h.authorize(ctx, event); response != nil {
+		return response, nil
+	}
+	return bulk.HandleImport(ctx, event)
+}
+
+// HandleExport authorizes and delegates exports
+func (h *AuthorizedHandlers) HandleExport(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	exports, ok := h.next.(ExportHandler)
+	if !ok {
+		return appsync.NewErrorResponse("UNKNOWN_OPERATION", "Unknown operation: "+event.FieldName, ""), nil
+	}
+	if response := h.authorize(ctx, event); response != nil {
+		return response, nil
+	}
+	return exports.HandleExport(ctx, event)
+}
+
+// HandleBatchGet authorizes and delegates batch reads
+func (h *AuthorizedHandlers) HandleBatchGet(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	batch, ok := h.next.(BatchHandler)
+	if !ok {
+		return appsync.NewErrorResponse("UNKNOWN_OPERATION", "Unknown operation: "+event.FieldName, ""), nil
+	}
+	if response := h.authorize(ctx, event); response != nil {
+		return response, nil
+	}
+	return batch.HandleBatchGet(ctx, event)
+}
+
+// HandleBatchCreate authorizes and delegates batch creates
+func (h *AuthorizedHandlers) HandleBatchCreate(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	batch, ok := h.next.(BatchHandler)
+	if !ok {
+		return appsync.NewErrorResponse("UNKNOWN_OPERATION", "Unknown operation: "+event.FieldName, ""), nil
+	}
+	if response := h.authorize(ctx, event); response != nil {
+		return response, nil
+	}
+	return batch.HandleBatchCreate(ctx, event)
+}
+
+// HandleBatchDelete authorizes and delegates batch deletes
+func (h *AuthorizedHandlers) HandleBatchDelete(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	batch, ok := h.next.(BatchHandler)
+	if !ok {
+		return appsync.NewErrorResponse("UNKNOWN_OPERATION", "Unknown operation: "+event.FieldName, ""), nil
+	}
+	if response := h.authorize(ctx, event); response != nil {
+		return response, nil
+	}
+	return batch.HandleBatchDelete(ctx, event)
+}
+
+// HandleTransact authorizes and delegates transactions
+func (h *AuthorizedHandlers) HandleTransact(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	transact, ok := h.next.(TransactHandler)
+	if !ok {
+		return appsync.NewErrorResponse("UNKNOWN_OPERATION", "Unknown operation: "+event.FieldName, ""), nil
+	}
+	if response := h.authorize(ctx, event); response != nil {
+		return response, nil
+	}
+	return transact.HandleTransact(ctx, event)
+}
+
+// HandleGetHistory authorizes and delegates unit history reads
+func (h *AuthorizedHandlers) HandleGetHistory(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	history, ok := h.next.(HistoryHandler)
+	if !ok {
+		return appsync.NewErrorResponse("UNKNOWN_OPERATION", "Unknown operation: "+event.FieldName, ""), nil
+	}
+	if response := h.authorize(ctx, event); response != nil {
+		return response, nil
+	}
+	return history.HandleGetHistory(ctx, event)
+}
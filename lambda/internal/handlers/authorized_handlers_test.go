@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/steverhoton/unt-units-svc/internal/auth"
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/internal/repository"
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+func accountEvent(fieldName, accountID string, identity appsync.Identity) *appsync.AppSyncEvent {
+	args, _ := json.Marshal(map[string]string{
+		"id":        "unit-1",
+		"accountId": accountID,
+		"unitType":  "commercialVehicleType",
+	})
+	return &appsync.AppSyncEvent{
+		TypeName:  "Query",
+		FieldName: fieldName,
+		Arguments: args,
+		Identity:  identity,
+	}
+}
+
+func memberOf(accounts string, groups ...string) appsync.Identity {
+	return appsync.Identity{
+		Sub:      "sub-1",
+		Username: "dispatcher",
+		Groups:   groups,
+		Claims:   appsync.Claims{Raw: map[string]interface{}{"custom:accountId": accounts}},
+	}
+}
+
+func TestAuthorizedHandlers_Forbidden(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	authorizer := auth.NewAuthorizer(auth.NewClaimAccountResolver(""), "admin")
+	handlers := NewAuthorizedHandlers(NewUnitHandlers(mockRepo), authorizer)
+
+	operations := map[string]func(context.Context, *appsync.AppSyncEvent) (*appsync.Response, error){
+		"createUnit":       handlers.HandleCreate,
+		"getUnit":          handlers.HandleRead,
+		"updateUnit":       handlers.HandleUpdate,
+		"deleteUnit":       handlers.HandleDelete,
+		"listUnits":        handlers.HandleList,
+		"restoreUnit":      handlers.HandleRestore,
+		"listDeletedUnits": handlers.HandleListDeleted,
+		"purgeUnit":        handlers.HandlePurge,
+	}
+
+	for fieldName, handle := range operations {
+		t.Run(fieldName, func(t *testing.T) {
+			response, err := handle(context.Background(), accountEvent(fieldName, "account-2", memberOf("account-1")))
+
+			require.NoError(t, err)
+			require.NotNil(t, response.Error)
+			assert.Equal(t, "FORBIDDEN", response.Error.Code)
+			assert.Equal(t, "Not authorized for account account-2", response.Error.Message)
+		})
+	}
+
+	// The repository is never reached for another tenant's account
+	mockRepo.AssertExpectations(t)
+}
+
+func TestAuthorizedHandlers_AllowsMembersAndAdmins(t *testing.T) {
+	unit := &models.Unit{ID: "unit-1", AccountID: "account-2", UnitType: "commercialVehicleType"}
+	mockRepo := &repository.MockUnitRepository{}
+	mockRepo.On("GetByKey", mock.Anything, "account-2", "unit-1", "commercialVehicleType").Return(unit, nil).Twice()
+
+	authorizer := auth.NewAuthorizer(auth.NewClaimAccountResolver(""), "admin")
+	handlers := NewAuthorizedHandlers(NewUnitHandlers(mockRepo), authorizer)
+
+	for _, identity := range []appsync.Identity{memberOf("account-1,account-2"), memberOf("", "admin")} {
+		response, err := handlers.HandleRead(context.Background(), accountEvent("getUnit", "account-2", identity))
+
+		require.NoError(t, err)
+		assert.True(t, response.Success)
+		assert.Equal(t, unit, response.Data)
+	}
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestAuthorizedHandlers_MissingAccountIsValidated(t *testing.T) {
+	authorizer := auth.NewAuthorizer(auth.NewClaimAccountResolver(""), "admin")
+	handlers := NewAuthorizedHandlers(NewUnitHandlers(&repository.MockUnitRepository{}), authorizer)
+
+	response, err := handlers.HandleList(context.Background(), accountEvent("listUnits", "", memberOf("account-1")))
+
+	require.NoError(t, err)
+	require.NotNil(t, response.Error)
+	assert.Equal(t, "VALIDATION_ERROR", response.Error.Code)
+}
+
+type failingMembershipTable struct{}
+
+func (failingMembershipTable) Query(context.Context, *dynamodb.QueryInput, ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	return nil, errors.New("throttled")
+}
+
+func TestAuthorizedHandlers_LookupFailure(t *testing.T) {
+	authorizer := auth.NewAuthorizer(auth.NewMembershipAccountResolver(failingMembershipTable{}, "memberships"), "admin")
+	handlers := NewAuthorizedHandlers(NewUnitHandlers(&repository.MockUnitRepository{}), authorizer)
+
+	response, err := handlers.HandleRead(context.Background(), accountEvent("getUnit", "account-1", memberOf("account-1")))
+
+	require.NoError(t, err)
+	require.NotNil(t, response.Error)
+	assert.Equal(t, "AUTHORIZATION_FAILED", response.Error.Code)
+	assert.Contains(t, response.Error.Details, "throttled")
+}
+
+func TestAuthorizedHandlers_GetByIDScopesToCallerAccounts(t *testing.T) {
+	units := []models.Unit{
+		{ID: "unit-1", AccountID: "account-1", UnitType: "commercialVehicleType"},
+		{ID: "unit-1", AccountID: "account-2", UnitType: "commercialVehicleType"},
+		{ID: "unit-1", AccountID: "account-3", UnitType: "trailerType"},
+	}
+	mockRepo := &repository.MockUnitRepository{}
+	mockRepo.On("GetByUnitID", mock.Anything, "unit-1").Return(units, nil)
+
+	authorizer := auth.NewAuthorizer(auth.NewClaimAccountResolver(""), "admin")
+	handlers := NewAuthorizedHandlers(NewUnitHandlers(mockRepo), authorizer)
+	event := func(identity appsync.Identity) *appsync.AppSyncEvent {
+		return &appsync.AppSyncEvent{FieldName: "getUnitById", Arguments: json.RawMessage(`{"id":"unit-1"}`), Identity: identity}
+	}
+
+	response, err := handlers.HandleGetByID(context.Background(), event(memberOf("account-1,account-3")))
+	require.NoError(t, err)
+	require.True(t, response.Success)
+	result := response.Data.(*appsync.ListUnitsResponse)
+	assert.Equal(t, 2, result.Count)
+	assert.Equal(t, []models.Unit{units[0], units[2]}, result.Items)
+	assert.Equal(t, "Retrieved 2 units", response.Message)
+
+	// Units in other accounts are indistinguishable from missing ones
+	response, err = handlers.HandleGetByID(context.Background(), event(memberOf("account-9")))
+	require.NoError(t, err)
+	require.True(t, response.Success)
+	assert.Empty(t, response.Data.(*appsync.ListUnitsResponse).Items)
+
+	response, err = handlers.HandleGetByID(context.Background(), event(memberOf("", "admin")))
+	require.NoError(t, err)
+	assert.Equal(t, 3, response.Data.(*appsync.ListUnitsResponse).Count)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUnitHandlers_HandleGetByID_Errors(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	mockRepo.On("GetByUnitID", mock.Anything, "unit-1").Return(nil, errors.New("throttled"))
+	handlers := NewUnitHandlers(mockRepo)
+
+	response, err := handlers.HandleGetByID(context.Background(), &appsync.AppSyncEvent{FieldName: "getUnitById", Arguments: json.RawMessage(`{}`)})
+	require.NoError(t, err)
+	assert.Equal(t, "VALIDATION_ERROR", response.Error.Code)
+
+	response, err = handlers.HandleGetByID(context.Background(), &appsync.AppSyncEvent{FieldName: "getUnitById", Arguments: json.RawMessage(`{"id":"unit-1"}`)})
+	require.NoError(t, err)
+	assert.Equal(t, "READ_FAILED", response.Error.Code)
+
+	// Dynamic handler sets have no lookup by ID
+	authorizer := auth.NewAuthorizer(auth.NewClaimAccountResolver(""), "admin")
+	response, err = NewAuthorizedHandlers(NewDynamicUnitHandlers(&repository.MockDynamicUnitRepository{}), authorizer).
+		HandleGetByID(context.Background(), &appsync.AppSyncEvent{FieldName: "getUnitById", Arguments: json.RawMessage(`{"id":"unit-1"}`), Identity: memberOf("", "admin")})
+	require.NoError(t, err)
+	assert.Equal(t, "UNKNOWN_OPERATION", response.Error.Code)
+}
@@ -0,0 +1,514 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/steverhoton/unt-units-svc/internal/blobstore"
+	"github.com/steverhoton/unt-units-svc/internal/config"
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/internal/repository"
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+// DynamicUnitHandlers contains handlers for schema-driven unit CRUD operations.
+// Every create and update is validated against the unit type's JSON schema.
+type DynamicUnitHandlers struct {
+	repo repository.DynamicUnitRepository
+
+	// adminGroup is the identity group allowed to purge units
+	adminGroup string
+
+	// export is where exportUnits uploads its files
+	export exportTarget
+}
+
+// NewDynamicUnitHandlers creates a new instance of DynamicUnitHandlers
+func NewDynamicUnitHandlers(repo repository.DynamicUnitRepository) *DynamicUnitHandlers {
+	return &DynamicUnitHandlers{
+		repo:       repo,
+		adminGroup: config.DefaultAdminGroup,
+	}
+}
+
+// WithAdminGroup sets the identity group allowed to run administrative operations
+func (h *DynamicUnitHandlers) WithAdminGroup(group string) *DynamicUnitHandlers {
+	h.adminGroup = group
+	return h
+}
+
+// WithExportStore sets the store exportUnits uploads to. When the store can presign
+// URLs, responses include a download link valid for urlTTL.
+func (h *DynamicUnitHandlers) WithExportStore(store blobstore.Store, urlTTL time.Duration) *DynamicUnitHandlers {
+	h.export = exportTarget{store: store, urlTTL: urlTTL}
+	return h
+}
+
+// HandleCreate handles dynamic unit creation requests
+func (h *DynamicUnitHandlers) HandleCreate(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("DynamicUnitHandlers.HandleCreate called with event: %+v", event)
+
+	// Parse arguments
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error()), nil
+	}
+
+	input, ok := args.(appsync.CreateUnitInput)
+	if !ok {
+		log.Printf("Invalid input type for create operation")
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for create operation", ""), nil
+	}
+
+	// Validate required fields
+	if input.AccountID == "" {
+		log.Printf("Missing required field: accountId")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "AccountID is required", ""), nil
+	}
+	if input.UnitType == "" {
+		log.Printf("Missing required field: unitType")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "UnitType is required", ""), nil
+	}
+
+	unit, err := models.NewDynamicUnit(input.UnitType)
+	if err != nil {
+		log.Printf("Invalid unit type %s: %v", input.UnitType, err)
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "Invalid unit type", err.Error()), nil
+	}
+	unit.AccountID = input.AccountID
+	unit.GenerateID()
+
+	data := input.Data
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+
+	// Validate the payload against the unit type schema
+	if err := unit.ValidateAndSetData(data); err != nil {
+		log.Printf("Schema validation failed for unit type %s: %v", input.UnitType, err)
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "Unit data validation failed", err.Error()), nil
+	}
+
+	// Attempt to create the unit
+	err = h.repo.Create(ctx, unit)
+	if err != nil {
+		log.Printf("Error creating unit: %v", err)
+		return appsync.NewErrorResponse("CREATE_FAILED", "Failed to create unit", err.Error()), nil
+	}
+
+	log.Printf("Unit created successfully with ID: %s, type: %s for account: %s", unit.ID, unit.UnitType, unit.AccountID)
+	return appsync.NewSuccessResponse(unit, "Unit created successfully"), nil
+}
+
+// HandleRead handles dynamic unit retrieval requests
+func (h *DynamicUnitHandlers) HandleRead(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("DynamicUnitHandlers.HandleRead called with event: %+v", event)
+
+	// Parse arguments
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error()), nil
+	}
+
+	input, ok := args.(appsync.GetUnitInput)
+	if !ok {
+		log.Printf("Invalid input type for read operation")
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for read operation", ""), nil
+	}
+
+	// Validate required fields
+	if input.ID == "" {
+		log.Printf("Missing required field: id")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "ID is required", ""), nil
+	}
+	if input.AccountID == "" {
+		log.Printf("Missing required field: accountId")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "AccountID is required", ""), nil
+	}
+	if input.UnitType == "" {
+		log.Printf("Missing required field: unitType")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "UnitType is required", ""), nil
+	}
+	if input.AsOf != nil && *input.AsOf != "" {
+		return h.readAsOf(ctx, input)
+	}
+
+	// Retrieve the unit
+	unit, err := h.repo.GetByKey(ctx, input.AccountID, input.ID, input.UnitType)
+	if err != nil {
+		log.Printf("Error retrieving unit: %v", err)
+		return appsync.NewErrorResponse("READ_FAILED", "Failed to retrieve unit", err.Error()), nil
+	}
+
+	if unit == nil {
+		log.Printf("Unit not found with ID: %s, type: %s for account: %s", input.ID, input.UnitType, input.AccountID)
+		return appsync.NewErrorResponse("NOT_FOUND", "Unit not found", ""), nil
+	}
+
+	log.Printf("Unit retrieved successfully with ID: %s, type: %s for account: %s", unit.ID, unit.UnitType, unit.AccountID)
+	return appsync.NewSuccessResponse(unit, "Unit retrieved successfully"), nil
+}
+
+// HandleUpdate handles dynamic unit update requests. Provided data keys are merged
+// over the stored data and the merged result is re-validated against the schema. The
+// update only applies while the unit is still at the expectedVersion the client read.
+func (h *DynamicUnitHandlers) HandleUpdate(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("DynamicUnitHandlers.HandleUpdate called with event: %+v", event)
+
+	// Parse arguments
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error()), nil
+	}
+
+	input, ok := args.(appsync.UpdateUnitInput)
+	if !ok {
+		log.Printf("Invalid input type for update operation")
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for update operation", ""), nil
+	}
+
+	// Validate required fields for update
+	if input.ID == "" {
+		log.Printf("Missing required field: id")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "ID is required", ""), nil
+	}
+	if input.AccountID == "" {
+		log.Printf("Missing required field: accountId")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "AccountID is required", ""), nil
+	}
+	if input.UnitType == "" {
+		log.Printf("Missing required field: unitType")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "UnitType is required", ""), nil
+	}
+	if input.ExpectedVersion == nil {
+		log.Printf("Missing required field: expectedVersion")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "ExpectedVersion is required", ""), nil
+	}
+
+	// Check if the unit exists before attempting to update
+	existingUnit, err := h.repo.GetByKey(ctx, input.AccountID, input.ID, input.UnitType)
+	if err != nil {
+		log.Printf("Error checking if unit exists: %v", err)
+		return appsync.NewErrorResponse("UPDATE_FAILED", "Failed to verify unit existence", err.Error()), nil
+	}
+	if existingUnit == nil {
+		log.Printf("Unit not found with ID: %s, type: %s for account: %s", input.ID, input.UnitType, input.AccountID)
+		return appsync.NewErrorResponse("NOT_FOUND", "Unit not found", ""), nil
+	}
+	if existingUnit.Version != *input.ExpectedVersion {
+		log.Printf("Version conflict updating unit ID: %s (expected %d, current %d)", input.ID, *input.ExpectedVersion, existingUnit.Version)
+		return conflictResponse(&repository.VersionConflictError{ExpectedVersion: *input.ExpectedVersion, CurrentVersion: existingUnit.Version}), nil
+	}
+
+	// Merge the provided data over the existing data (partial update)
+	merged := make(map[string]interface{}, len(existingUnit.Data)+len(input.Data))
+	for key, value := range existingUnit.Data {
+		merged[key] = value
+	}
+	for key, value := range input.Data {
+		merged[key] = value
+	}
+
+	// Ensure the unit key matches the input
+	existingUnit.ID = input.ID
+	existingUnit.AccountID = input.AccountID
+	existingUnit.UnitType = input.UnitType
+
+	if err := existingUnit.ValidateAndSetData(merged); err != nil {
+		log.Printf("Schema validation failed for unit type %s: %v", input.UnitType, err)
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "Unit data validation failed", err.Error()), nil
+	}
+
+	// Replace the unit, conditioned on it still being at the version read above
+	err = h.repo.Update(ctx, existingUnit)
+	if err != nil {
+		var conflict *repository.VersionConflictError
+		if errors.As(err, &conflict) {
+			log.Printf("Version conflict updating unit ID: %s: %v", input.ID, err)
+			return conflictResponse(conflict), nil
+		}
+		if errors.Is(err, repository.ErrUnitNotFound) {
+			log.Printf("Unit not found with ID: %s, type: %s for account: %s", input.ID, input.UnitType, input.AccountID)
+			return appsync.NewErrorResponse("NOT_FOUND", "Unit not found", ""), nil
+		}
+		log.Printf("Error updating unit: %v", err)
+		return appsync.NewErrorResponse("UPDATE_FAILED", "Failed to update unit", err.Error()), nil
+	}
+
+	log.Printf("Unit updated successfully with ID: %s, type: %s for account: %s", existingUnit.ID, existingUnit.UnitType, existingUnit.AccountID)
+	return appsync.NewSuccessResponse(existingUnit, "Unit updated successfully"), nil
+}
+
+// HandleDelete handles dynamic unit deletion requests
+func (h *DynamicUnitHandlers) HandleDelete(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("DynamicUnitHandlers.HandleDelete called with event: %+v", event)
+
+	// Parse arguments
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error()), nil
+	}
+
+	input, ok := args.(appsync.DeleteUnitInput)
+	if !ok {
+		log.Printf("Invalid input type for delete operation")
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for delete operation", ""), nil
+	}
+
+	// Validate required fields
+	if input.ID == "" {
+		log.Printf("Missing required field: id")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "ID is required", ""), nil
+	}
+	if input.AccountID == "" {
+		log.Printf("Missing required field: accountId")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "AccountID is required", ""), nil
+	}
+	if input.UnitType == "" {
+		log.Printf("Missing required field: unitType")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "UnitType is required", ""), nil
+	}
+	if input.ExpectedVersion == nil {
+		log.Printf("Missing required field: expectedVersion")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "ExpectedVersion is required", ""), nil
+	}
+
+	// Attempt to delete the unit
+	err = h.repo.Delete(ctx, input.AccountID, input.ID, input.UnitType, *input.ExpectedVersion)
+	if err != nil {
+		var conflict *repository.VersionConflictError
+		switch {
+		case errors.Is(err, repository.ErrUnitNotFound):
+			log.Printf("Unit not found with ID: %s, type: %s for account: %s", input.ID, input.UnitType, input.AccountID)
+			return appsync.NewErrorResponse("NOT_FOUND", "Unit not found", ""), nil
+		case errors.Is(err, repository.ErrUnitAlreadyDeleted):
+			log.Printf("Unit already deleted with ID: %s, type: %s for account: %s", input.ID, input.UnitType, input.AccountID)
+			return appsync.NewErrorResponse("ALREADY_DELETED", "Unit is already deleted", ""), nil
+		case errors.As(err, &conflict):
+			log.Printf("Version conflict deleting unit ID: %s: %v", input.ID, err)
+			return conflictResponse(conflict), nil
+		}
+		log.Printf("Error deleting unit: %v", err)
+		return appsync.NewErrorResponse("DELETE_FAILED", "Failed to delete unit", err.Error()), nil
+	}
+
+	response := map[string]interface{}{
+		"id":        input.ID,
+		"accountId": input.AccountID,
+		"unitType":  input.UnitType,
+		"deleted":   true,
+	}
+
+	log.Printf("Unit deleted successfully with ID: %s, type: %s for account: %s", input.ID, input.UnitType, input.AccountID)
+	return appsync.NewSuccessResponse(response, "Unit deleted successfully"), nil
+}
+
+// HandleRestore handles requests to undelete a soft deleted dynamic unit
+func (h *DynamicUnitHandlers) HandleRestore(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("DynamicUnitHandlers.HandleRestore called with event: %+v", event)
+
+	// Parse arguments
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error()), nil
+	}
+
+	input, ok := args.(appsync.RestoreUnitInput)
+	if !ok {
+		log.Printf("Invalid input type for restore operation")
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for restore operation", ""), nil
+	}
+
+	// Validate required fields
+	if input.ID == "" {
+		log.Printf("Missing required field: id")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "ID is required", ""), nil
+	}
+	if input.AccountID == "" {
+		log.Printf("Missing required field: accountId")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "AccountID is required", ""), nil
+	}
+	if input.UnitType == "" {
+		log.Printf("Missing required field: unitType")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "UnitType is required", ""), nil
+	}
+	if input.ExpectedVersion == nil {
+		log.Printf("Missing required field: expectedVersion")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "ExpectedVersion is required", ""), nil
+	}
+
+	// Attempt to restore the unit
+	unit, err := h.repo.Restore(ctx, input.AccountID, input.ID, input.UnitType, *input.ExpectedVersion)
+	if err != nil {
+		var conflict *repository.VersionConflictError
+		switch {
+		case errors.Is(err, repository.ErrUnitNotFound):
+			log.Printf("Unit not found with ID: %s, type: %s for account: %s", input.ID, input.UnitType, input.AccountID)
+			return appsync.NewErrorResponse("NOT_FOUND", "Unit not found", ""), nil
+		case errors.Is(err, repository.ErrUnitNotDeleted):
+			log.Printf("Unit is not deleted with ID: %s, type: %s for account: %s", input.ID, input.UnitType, input.AccountID)
+			return appsync.NewErrorResponse("NOT_DELETED", "Unit is not deleted", ""), nil
+		case errors.As(err, &conflict):
+			log.Printf("Version conflict restoring unit ID: %s: %v", input.ID, err)
+			return conflictResponse(conflict), nil
+		}
+		log.Printf("Error restoring unit: %v", err)
+		return appsync.NewErrorResponse("RESTORE_FAILED", "Failed to restore unit", err.Error()), nil
+	}
+
+	log.Printf("Unit restored successfully with ID: %s, type: %s for account: %s", unit.ID, unit.UnitType, unit.AccountID)
+	return appsync.NewSuccessResponse(unit, "Unit restored successfully"), nil
+}
+
+// HandlePurge handles admin requests to permanently remove a soft deleted dynamic unit
+func (h *DynamicUnitHandlers) HandlePurge(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("DynamicUnitHandlers.HandlePurge called with event: %+v", event)
+
+	// Purging cannot be undone, so it is reserved for administrators
+	if !event.Identity.InGroup(h.adminGroup) {
+		log.Printf("Caller %q is not in the %s group", event.Identity.Principal(), h.adminGroup)
+		return appsync.NewErrorResponse("FORBIDDEN", "Purging units requires administrator access", ""), nil
+	}
+
+	// Parse arguments
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error()), nil
+	}
+
+	input, ok := args.(appsync.PurgeUnitInput)
+	if !ok {
+		log.Printf("Invalid input type for purge operation")
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for purge operation", ""), nil
+	}
+
+	// Validate required fields
+	if input.ID == "" {
+		log.Printf("Missing required field: id")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "ID is required", ""), nil
+	}
+	if input.AccountID == "" {
+		log.Printf("Missing required field: accountId")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "AccountID is required", ""), nil
+	}
+	if input.UnitType == "" {
+		log.Printf("Missing required field: unitType")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "UnitType is required", ""), nil
+	}
+
+	// Attempt to purge the unit
+	err = h.repo.Purge(ctx, input.AccountID, input.ID, input.UnitType)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrUnitNotFound):
+			log.Printf("Unit not found with ID: %s, type: %s for account: %s", input.ID, input.UnitType, input.AccountID)
+			return appsync.NewErrorResponse("NOT_FOUND", "Unit not found", ""), nil
+		case errors.Is(err, repository.ErrUnitNotDeleted):
+			log.Printf("Unit is not deleted with ID: %s, type: %s for account: %s", input.ID, input.UnitType, input.AccountID)
+			return appsync.NewErrorResponse("NOT_DELETED", "Only deleted units can be purged", ""), nil
+		}
+		log.Printf("Error purging unit: %v", err)
+		return appsync.NewErrorResponse("PURGE_FAILED", "Failed to purge unit", err.Error()), nil
+	}
+
+	response := map[string]interface{}{
+		"id":        input.ID,
+		"accountId": input.AccountID,
+		"unitType":  input.UnitType,
+		"purged":    true,
+	}
+
+	log.Printf("Unit purged by %s with ID: %s, type: %s for account: %s", event.Identity.Principal(), input.ID, input.UnitType, input.AccountID)
+	return appsync.NewSuccessResponse(response, "Unit purged successfully"), nil
+}
+
+// HandleList handles dynamic unit listing requests
+func (h *DynamicUnitHandlers) HandleList(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("DynamicUnitHandlers.HandleList called with event: %+v", event)
+
+	// Parse arguments
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error()), nil
+	}
+
+	input, ok := args.(appsync.ListUnitsInput)
+	if !ok {
+		log.Printf("Invalid input type for list operation")
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for list operation", ""), nil
+	}
+
+	// Validate required fields
+	if input.AccountID == "" {
+		log.Printf("Missing required field: accountId")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "AccountID is required", ""), nil
+	}
+	if resp := validateListFilter(&input); resp != nil {
+		return resp, nil
+	}
+
+	// Retrieve the list of units
+	result, err := h.repo.List(ctx, &input)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidPaginationToken) {
+			log.Printf("Rejected pagination token: %v", err)
+			return appsync.NewErrorResponse("VALIDATION_ERROR", "Invalid nextToken", err.Error()), nil
+		}
+		log.Printf("Error listing units: %v", err)
+		return appsync.NewErrorResponse("LIST_FAILED", "Failed to list units", err.Error()), nil
+	}
+
+	log.Printf("Units listed successfully: %d items", result.Count)
+	return appsync.NewSuccessResponse(result, fmt.Sprintf("Retrieved %d units", result.Count)), nil
+}
+
+// HandleListDeleted handles requests to list the soft deleted dynamic units of an account
+func (h *DynamicUnitHandlers) HandleListDeleted(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("DynamicUnitHandlers.HandleListDeleted called with event: %+v", event)
+
+	// Parse arguments
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error()), nil
+	}
+
+	input, ok := args.(appsync.ListUnitsInput)
+	if !ok {
+		log.Printf("Invalid input type for list deleted operation")
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for list deleted operation", ""), nil
+	}
+
+	// Validate required fields
+	if input.AccountID == "" {
+		log.Printf("Missing required field: accountId")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "AccountID is required", ""), nil
+	}
+	if resp := validateListFilter(&input); resp != nil {
+		return resp, nil
+	}
+
+	// Retrieve the list of deleted units
+	result, err := h.repo.ListDeleted(ctx, &input)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidPaginationToken) {
+			log.Printf("Rejected pagination token: %v", err)
+			return appsync.NewErrorResponse("VALIDATION_ERROR", "Invalid nextToken", err.Error()), nil
+		}
+		log.Printf("Error listing deleted units: %v", err)
+		return appsync.NewErrorResponse("LIST_FAILED", "Failed to list deleted units", err.Error()), nil
+	}
+
+	log.Printf("Deleted units listed successfully: %d items", result.Count)
+	return appsync.NewSuccessResponse(result, fmt.Sprintf("Retrieved %d deleted units", result.Count)), nil
+}
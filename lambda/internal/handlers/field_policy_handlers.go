@@ -0,0 +1,486 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+
+	"github.com/steverhoton/unt-units-svc/internal/config"
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+// requestKeyArguments identify the unit being written rather than its fields
+var requestKeyArguments = map[string]bool{
+	"id":              true,
+	"accountId":       true,
+	"unitType":        true,
+	"expectedVersion": true,
+	"data":            true,
+}
+
+// FieldPolicyHandlers enforces the field policy of each unit type: writes to
+// fields the caller's groups may not write are rejected, and fields they may
+// not read are cleared from the response. Members of the admin group bypass
+// the policies.
+type FieldPolicyHandlers struct {
+	next       CRUDHandlers
+	policies   *models.FieldPolicyRegistry
+	adminGroup string
+}
+
+// NewFieldPolicyHandlers wraps next with the field policies in the registry
+func NewFieldPolicyHandlers(next CRUDHandlers, policies *models.FieldPolicyRegistry) *FieldPolicyHandlers {
+	return &FieldPolicyHandlers{
+		next:       next,
+		policies:   policies,
+		adminGroup: config.DefaultAdminGroup,
+	}
+}
+
+// WithAdminGroup sets the identity group exempt from field policies
+func (h *FieldPolicyHandlers) WithAdminGroup(group string) *FieldPolicyHandlers {
+	h.adminGroup = group
+	return h
+}
+
+// HandleCreate rejects restricted fields in new units
+func (h *FieldPolicyHandlers) HandleCreate(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	if response := h.checkWrites(event, false); response != nil {
+		return response, nil
+	}
+	return h.redact(event)(h.next.HandleCreate(ctx, event))
+}
+
+// HandleRead redacts the unit read
+func (h *FieldPolicyHandlers) HandleRead(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	return h.redact(event)(h.next.HandleRead(ctx, event))
+}
+
+// HandleUpdate rejects updates to restricted fields, including clearing them
+func (h *FieldPolicyHandlers) HandleUpdate(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	if response := h.checkWrites(event, true); response != nil {
+		return response, nil
+	}
+	return h.redact(event)(h.next.HandleUpdate(ctx, event))
+}
+
+// HandleDelete delegates unit deletion requests
+func (h *FieldPolicyHandlers) HandleDelete(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	return h.redact(event)(h.next.HandleDelete(ctx, event))
+}
+
+// HandleList redacts every listed unit
+func (h *FieldPolicyHandlers) HandleList(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	return h.redact(event)(h.next.HandleList(ctx, event))
+}
+
+// HandleRestore redacts the restored unit
+func (h *FieldPolicyHandlers) HandleRestore(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	return h.redact(event)(h.next.HandleRestore(ctx, event))
+}
+
+// HandleListDeleted redacts every listed deleted unit
+func (h *FieldPolicyHandlers) HandleListDeleted(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	return h.redact(event)(h.next.HandleListDeleted(ctx, event))
+}
+
+// HandlePurge delegates unit purge requests
+func (h *FieldPolicyHandlers) HandlePurge(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	return h.redact(event)(h.next.HandlePurge(ctx, event))
+}
+
+// HandleGetByID redacts the units found by a lookup by ID
+func (h *FieldPolicyHandlers) HandleGetByID(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	lookup, ok := h.next.(UnitIDHandler)
+	if !ok {
+		return appsync.NewErrorResponse("UNKNOWN_OPERATION", "Unknown operation: "+event.FieldName, ""), nil
+	}
+	return h.redact(event)(lookup.HandleGetByID(ctx, event))
+}
+
+// HandleGetByVin redacts the unit found by a lookup by VIN
+func (h *FieldPolicyHandlers) HandleGetByVin(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	lookup, ok := h.next.(VinHandler)
+	if !ok {
+		return appsync.NewErrorResponse("UNKNOWN_OPERATION", "Unknown operation: "+event.FieldName, ""), nil
+	}
+	return h.redact(event)(lookup.HandleGetByVin(ctx, event))
+}
+
+// HandleSearchByVin redacts the units found by a search by VIN prefix
+func (h *FieldPolicyHandlers) HandleSearchByVin(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	lookup, ok := h.next.(VinHandler)
+	if !ok {
+		return appsync.NewErrorResponse("UNKNOWN_OPERATION", "Unknown operation: "+event.FieldName, ""), nil
+	}
+	return h.redact(event)(lookup.HandleSearchByVin(ctx, event))
+}
+
+// HandleImport rejects an import when any row sets a field the caller may not write
+func (h *FieldPolicyHandlers) HandleImport(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	bulk, ok := h.next.(ImportHandler)
+	if !ok {
+		return appsync.NewErrorResponse("UNKNOWN_OPERATION", "Unknown operation: "+event.FieldName, ""), nil
+	}
+	if response := h.checkImportWrites(event); response != nil {
+		return response, nil
+	}
+	return bulk.HandleImport(ctx, event)
+}
+
+// HandleExport leaves the fields the caller may not read out of the export. Without
+// a unit type the export spans every type, so fields any policy hides are left out.
+func (h *FieldPolicyHandlers) HandleExport(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	exports, ok := h.next.(ExportHandler)
+	if !ok {
+		return appsync.NewErrorResponse("UNKNOWN_OPERATION", "Unknown operation: "+event.FieldName, ""), nil
+	}
+	if h.exempt(event.Identity) {
+		return exports.HandleExport(ctx, event)
+	}
+
+	var hidden []string
+	if unitType := event.GetUnitType(); unitType != "" {
+		hidden = h.policies.Get(unitType).UnreadableFields(event.Identity.Groups)
+	} else {
+		hidden = h.policies.AllUnreadableFields(event.Identity.Groups)
+	}
+	return exports.HandleExport(withExcludedFields(ctx, hidden), event)
+}
+
+// HandleBatchGet redacts every unit read
+func (h *FieldPolicyHandlers) HandleBatchGet(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	batch, ok := h.next.(BatchHandler)
+	if !ok {
+		return appsync.NewErrorResponse("UNKNOWN_OPERATION", "Unknown operation: "+event.FieldName, ""), nil
+	}
+	return h.redact(event)(batch.HandleBatchGet(ctx, event))
+}
+
+// HandleBatchCreate rejects a batch when any unit sets a field the caller may not
+// write, and redacts the units created
+func (h *FieldPolicyHandlers) HandleBatchCreate(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	batch, ok := h.next.(BatchHandler)
+	if !ok {
+		return appsync.NewErrorResponse("UNKNOWN_OPERATION", "Unknown operation: "+event.FieldName, ""), nil
+	}
+	if response := h.checkBatchCreateWrites(event); response != nil {
+		return response, nil
+	}
+	return h.redact(event)(batch.HandleBatchCreate(ctx, event))
+}
+
+// HandleBatchDelete delegates batch deletes
+func (h *FieldPolicyHandlers) HandleBatchDelete(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	batch, ok := h.next.(BatchHandler)
+	if !ok {
+		return appsync.NewErrorResponse("UNKNOWN_OPERATION", "Unknown operation: "+event.FieldName, ""), nil
+	}
+	return batch.HandleBatchDelete(ctx, event)
+}
+
+// HandleTransact rejects a transaction when any operation writes a field the caller
+// may not write, and redacts the units created
+func (h *FieldPolicyHandlers) HandleTransact(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	transact, ok := h.next.(TransactHandler)
+	if !ok {
+		return appsync.NewErrorResponse("UNKNOWN_OPERATION", "Unknown operation: "+event.FieldName, ""), nil
+	}
+	if response := h.checkTransactWrites(event); response != nil {
+		return response, nil
+	}
+	return h.redact(event)(transact.HandleTransact(ctx, event))
+}
+
+// HandleGetHistory redacts the recorded changes of fields the caller may not read
+func (h *FieldPolicyHandlers) HandleGetHistory(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	history, ok := h.next.(HistoryHandler)
+	if !ok {
+		return appsync.NewErrorResponse("UNKNOWN_OPERATION", "Unknown operation: "+event.FieldName, ""), nil
+	}
+	return h.redact(event)(history.HandleGetHistory(ctx, event))
+}
+
+// exempt reports whether the caller bypasses field policies
+func (h *FieldPolicyHandlers) exempt(identity appsync.Identity) bool {
+	return h.adminGroup != "" && identity.InGroup(h.adminGroup)
+}
+
+// checkWrites returns a FORBIDDEN response when the request sets a field the
+// caller may not write. On create, empty values are not counted as writes; on
+// update every field present is, since an empty value clears the stored one.
+func (h *FieldPolicyHandlers) checkWrites(event *appsync.AppSyncEvent, includeEmpty bool) *appsync.Response {
+	policy := h.policies.Get(event.GetUnitType())
+	if policy == nil || h.exempt(event.Identity) {
+		return nil
+	}
+
+	// Malformed arguments are left to the wrapped handler to report
+	fields, err := writtenFields(event.Arguments, includeEmpty)
+	if err != nil {
+		return nil
+	}
+
+	if denied := policy.UnwritableFields(fields, event.Identity.Groups); len(denied) > 0 {
+		log.Printf("Caller %q may not write fields %v of %s", event.Identity.Principal(), denied, policy.UnitType)
+		return appsync.NewErrorResponse("FORBIDDEN", "Not allowed to write fields: "+strings.Join(denied, ", "), "")
+	}
+	return nil
+}
+
+// checkImportWrites returns a FORBIDDEN response when any row of an import sets a
+// field the caller may not write
+func (h *FieldPolicyHandlers) checkImportWrites(event *appsync.AppSyncEvent) *appsync.Response {
+	policy := h.policies.Get(event.GetUnitType())
+	if policy == nil || h.exempt(event.Identity) {
+		return nil
+	}
+
+	// Malformed arguments and payloads are left to the wrapped handler to report
+	var input appsync.ImportUnitsInput
+	if err := json.Unmarshal(event.Arguments, &input); err != nil {
+		return nil
+	}
+	rows, response := parseImportPayload(input)
+	if response != nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var fields []string
+	for _, row := range rows {
+		for _, field := range row.Fields {
+			if !seen[field] {
+				seen[field] = true
+				fields = append(fields, field)
+			}
+		}
+	}
+
+	if denied := policy.UnwritableFields(fields, event.Identity.Groups); len(denied) > 0 {
+		log.Printf("Caller %q may not write fields %v of %s", event.Identity.Principal(), denied, policy.UnitType)
+		return appsync.NewErrorResponse("FORBIDDEN", "Not allowed to write fields: "+strings.Join(denied, ", "), "")
+	}
+	return nil
+}
+
+// checkBatchCreateWrites returns a FORBIDDEN response when any unit of a batch
+// create sets a field the caller may not write
+func (h *FieldPolicyHandlers) checkBatchCreateWrites(event *appsync.AppSyncEvent) *appsync.Response {
+	policy := h.policies.Get(event.GetUnitType())
+	if policy == nil || h.exempt(event.Identity) {
+		return nil
+	}
+
+	// Malformed arguments are left to the wrapped handler to report
+	var args struct {
+		Units []json.RawMessage `json:"units"`
+	}
+	if err := json.Unmarshal(event.Arguments, &args); err != nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var fields []string
+	for _, unit := range args.Units {
+		written, err := writtenFields(unit, false)
+		if err != nil {
+			return nil
+		}
+		for _, field := range written {
+			if !seen[field] {
+				seen[field] = true
+				fields = append(fields, field)
+			}
+		}
+	}
+
+	if denied := policy.UnwritableFields(fields, event.Identity.Groups); len(denied) > 0 {
+		log.Printf("Caller %q may not write fields %v of %s", event.Identity.Principal(), denied, policy.UnitType)
+		return appsync.NewErrorResponse("FORBIDDEN", "Not allowed to write fields: "+strings.Join(denied, ", "), "")
+	}
+	return nil
+}
+
+// checkTransactWrites returns a FORBIDDEN response when an operation of a
+// transaction writes a field the caller may not write under the policy of the
+// operation's unit type. Updates count every field present, as on updateUnit.
+func (h *FieldPolicyHandlers) checkTransactWrites(event *appsync.AppSyncEvent) *appsync.Response {
+	if h.exempt(event.Identity) {
+		return nil
+	}
+
+	// Malformed arguments are left to the wrapped handler to report
+	var input appsync.TransactUnitsInput
+	if err := json.Unmarshal(event.Arguments, &input); err != nil {
+		return nil
+	}
+
+	for _, operation := range input.Operations {
+		policy := h.policies.Get(operation.UnitType)
+		if policy == nil || isEmptyJSON(operation.Unit) {
+			continue
+		}
+		fields, err := writtenFields(operation.Unit, operation.Type == "UPDATE")
+		if err != nil {
+			return nil
+		}
+		if denied := policy.UnwritableFields(fields, event.Identity.Groups); len(denied) > 0 {
+			log.Printf("Caller %q may not write fields %v of %s", event.Identity.Principal(), denied, policy.UnitType)
+			return appsync.NewErrorResponse("FORBIDDEN", "Not allowed to write fields: "+strings.Join(denied, ", "), "")
+		}
+	}
+	return nil
+}
+
+// writtenFields returns the unit fields set by create or update arguments: the
+// top-level unit fields and the keys of a schema-driven data object. Argument
+// names are matched case-insensitively, as the handlers decode them, so a
+// restricted field cannot be written under a differently cased name.
+func writtenFields(arguments json.RawMessage, includeEmpty bool) ([]string, error) {
+	var args map[string]json.RawMessage
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var fields []string
+	add := func(name string, raw json.RawMessage) {
+		if (includeEmpty || !isEmptyJSON(raw)) && !seen[name] {
+			seen[name] = true
+			fields = append(fields, name)
+		}
+	}
+	for name, raw := range args {
+		name = canonicalArgument(name)
+		if name == "data" && !isEmptyJSON(raw) {
+			var data map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &data); err != nil {
+				return nil, err
+			}
+			for field, value := range data {
+				add(field, value)
+			}
+			continue
+		}
+		if !requestKeyArguments[name] {
+			add(name, raw)
+		}
+	}
+	return fields, nil
+}
+
+// canonicalArgument returns the name of the request argument or unit field that
+// encoding/json decodes a key into
+func canonicalArgument(name string) string {
+	for argument := range requestKeyArguments {
+		if strings.EqualFold(argument, name) {
+			return argument
+		}
+	}
+	return models.CanonicalUnitField(name)
+}
+
+// isEmptyJSON reports whether a raw JSON value is null or an empty string, list or object
+func isEmptyJSON(raw json.RawMessage) bool {
+	switch string(bytes.TrimSpace(raw)) {
+	case "", "null", `""`, "[]", "{}":
+		return true
+	}
+	return false
+}
+
+// redact returns a function that clears the fields the caller may not read from
+// a handler's response
+func (h *FieldPolicyHandlers) redact(event *appsync.AppSyncEvent) func(*appsync.Response, error) (*appsync.Response, error) {
+	return func(response *appsync.Response, err error) (*appsync.Response, error) {
+		if err != nil || response == nil || !response.Success || h.exempt(event.Identity) {
+			return response, err
+		}
+		response.Data = h.redactData(response.Data, event.Identity.Groups)
+		return response, nil
+	}
+}
+
+// redactData redacts each unit in response data using the policy of its own unit type
+func (h *FieldPolicyHandlers) redactData(data interface{}, groups []string) interface{} {
+	unreadable := func(unitType string) []string {
+		return h.policies.Get(unitType).UnreadableFields(groups)
+	}
+
+	switch v := data.(type) {
+	case models.Unit:
+		return *models.RedactUnit(&v, unreadable(v.UnitType))
+	case *models.Unit:
+		if v == nil {
+			return v
+		}
+		return models.RedactUnit(v, unreadable(v.UnitType))
+	case *models.DynamicUnit:
+		if v == nil {
+			return v
+		}
+		return models.RedactDynamicUnit(v, unreadable(v.UnitType))
+	case *appsync.ListUnitsResponse:
+		if v == nil {
+			return v
+		}
+		redacted := *v
+		redacted.Items = make([]models.Unit, len(v.Items))
+		for i := range v.Items {
+			redacted.Items[i] = *models.RedactUnit(&v.Items[i], unreadable(v.Items[i].UnitType))
+		}
+		return &redacted
+	case *appsync.BatchUnitsResponse:
+		if v == nil {
+			return v
+		}
+		redacted := *v
+		redacted.Results = make([]appsync.BatchUnitResult, len(v.Results))
+		for i, result := range v.Results {
+			if result.Unit != nil {
+				result.Unit = models.RedactUnit(result.Unit, unreadable(result.Unit.UnitType))
+			}
+			redacted.Results[i] = result
+		}
+		return &redacted
+	case *appsync.TransactUnitsResponse:
+		if v == nil {
+			return v
+		}
+		redacted := *v
+		redacted.Results = make([]appsync.TransactOperationResult, len(v.Results))
+		for i, result := range v.Results {
+			if result.Unit != nil {
+				result.Unit = models.RedactUnit(result.Unit, unreadable(result.Unit.UnitType))
+			}
+			redacted.Results[i] = result
+		}
+		return &redacted
+	case *appsync.UnitHistoryResponse:
+		if v == nil {
+			return v
+		}
+		redacted := *v
+		redacted.Items = make([]models.UnitHistoryEntry, len(v.Items))
+		for i := range v.Items {
+			redacted.Items[i] = *models.RedactHistoryEntry(&v.Items[i], unreadable(v.Items[i].UnitType))
+		}
+		return &redacted
+	case *appsync.ListDynamicUnitsResponse:
+		if v == nil {
+			return v
+		}
+		redacted := *v
+		redacted.Items = make([]models.DynamicUnit, len(v.Items))
+		for i := range v.Items {
+			redacted.Items[i] = *models.RedactDynamicUnit(&v.Items[i], unreadable(v.Items[i].UnitType))
+		}
+		return &redacted
+	default:
+		return data
+	}
+}
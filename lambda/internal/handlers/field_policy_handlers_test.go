@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/steverhoton/unt-units-svc/internal/blobstore"
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/internal/repository"
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+func testFieldPolicies(t *testing.T) *models.FieldPolicyRegistry {
+	registry := models.NewFieldPolicyRegistry()
+	require.NoError(t, registry.Register("commercialVehicleType", []byte(`{
+		"fields": {
+			"basePrice": {"read": ["pricing"], "write": ["pricing"]},
+			"note": {"read": ["support", "fleet-manager"], "write": ["fleet-manager"]}
+		}
+	}`)))
+	return registry
+}
+
+func policyEvent(fieldName, arguments string, groups ...string) *appsync.AppSyncEvent {
+	return &appsync.AppSyncEvent{
+		TypeName:  "Mutation",
+		FieldName: fieldName,
+		Arguments: json.RawMessage(arguments),
+		Identity:  appsync.Identity{Username: "dispatcher", Groups: groups},
+	}
+}
+
+func TestFieldPolicyHandlers_RejectsRestrictedWrites(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	handlers := NewFieldPolicyHandlers(NewUnitHandlers(mockRepo), testFieldPolicies(t))
+
+	tests := []struct {
+		name    string
+		handle  func(context.Context, *appsync.AppSyncEvent) (*appsync.Response, error)
+		event   *appsync.AppSyncEvent
+		message string
+	}{
+		{
+			name:    "create with price",
+			handle:  handlers.HandleCreate,
+			event:   policyEvent("createUnit", `{"accountId":"a-1","unitType":"commercialVehicleType","make":"Mack","basePrice":"1000","note":"x"}`, "support"),
+			message: "Not allowed to write fields: basePrice, note",
+		},
+		{
+			name:    "update clearing price",
+			handle:  handlers.HandleUpdate,
+			event:   policyEvent("updateUnit", `{"id":"u-1","accountId":"a-1","unitType":"commercialVehicleType","expectedVersion":1,"basePrice":null}`),
+			message: "Not allowed to write fields: basePrice",
+		},
+		{
+			name:    "dynamic data",
+			handle:  handlers.HandleCreate,
+			event:   policyEvent("createUnit", `{"accountId":"a-1","unitType":"commercialVehicleType","data":{"make":"Mack","basePrice":"1000"}}`),
+			message: "Not allowed to write fields: basePrice",
+		},
+		{
+			// Arguments are decoded case-insensitively, so this would set basePrice
+			name:    "create with differently cased price",
+			handle:  handlers.HandleCreate,
+			event:   policyEvent("createUnit", `{"accountId":"a-1","unitType":"commercialVehicleType","make":"Mack","BasePrice":"99999"}`, "support"),
+			message: "Not allowed to write fields: basePrice",
+		},
+		{
+			name:    "differently cased dynamic data",
+			handle:  handlers.HandleCreate,
+			event:   policyEvent("createUnit", `{"accountId":"a-1","unitType":"commercialVehicleType","Data":{"basePrice":"1000"}}`),
+			message: "Not allowed to write fields: basePrice",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := tt.handle(context.Background(), tt.event)
+
+			require.NoError(t, err)
+			require.NotNil(t, response.Error)
+			assert.Equal(t, "FORBIDDEN", response.Error.Code)
+			assert.Equal(t, tt.message, response.Error.Message)
+		})
+	}
+
+	// Nothing reached the repository
+	mockRepo.AssertExpectations(t)
+}
+
+func TestFieldPolicyHandlers_ImportChecksEveryRow(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	mockRepo.On("BatchCreate", mock.Anything, mock.Anything).Return([]error{nil, nil}).Once()
+	handlers := NewFieldPolicyHandlers(NewUnitHandlers(mockRepo), testFieldPolicies(t))
+
+	arguments := func(payload string) string {
+		encoded, _ := json.Marshal(payload)
+		return `{"accountId":"a-1","unitType":"commercialVehicleType","format":"NDJSON","payload":` + string(encoded) + `}`
+	}
+	payload := `{"suggestedVin":"1M1AN07Y9GM012345","make":"Mack"}
+{"suggestedVin":"1HGBH41JXMN109186","make":"Honda","note":"new"}
+`
+
+	response, err := handlers.HandleImport(context.Background(), policyEvent("importUnits", arguments(payload), "support"))
+	require.NoError(t, err)
+	require.NotNil(t, response.Error)
+	assert.Equal(t, "FORBIDDEN", response.Error.Code)
+	assert.Equal(t, "Not allowed to write fields: note", response.Error.Message)
+
+	response, err = handlers.HandleImport(context.Background(), policyEvent("importUnits", arguments(payload), "fleet-manager"))
+	require.NoError(t, err)
+	assert.True(t, response.Success)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestFieldPolicyHandlers_ExportLeavesOutUnreadableFields(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	handlers := NewFieldPolicyHandlers(NewUnitHandlers(mockRepo).WithExportStore(blobstore.NewMemoryStore(), 0), testFieldPolicies(t))
+
+	var excluded [][]string
+	mockRepo.On("Export", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		excluded = append(excluded, args.Get(1).(repository.ExportOptions).ExcludeFields)
+	}).Return(&repository.ExportResult{}, nil)
+
+	for _, groups := range [][]string{{"support"}, {"admin"}} {
+		response, err := handlers.HandleExport(context.Background(), policyEvent("exportUnits", `{"accountId":"a-1","unitType":"commercialVehicleType","format":"CSV"}`, groups...))
+		require.NoError(t, err)
+		require.True(t, response.Success)
+	}
+
+	// Without a unit type, fields hidden by any policy are left out
+	response, err := handlers.HandleExport(context.Background(), policyEvent("exportUnits", `{"accountId":"a-1","format":"CSV"}`))
+	require.NoError(t, err)
+	require.True(t, response.Success)
+
+	assert.Equal(t, [][]string{{"basePrice"}, nil, {"basePrice", "note"}}, excluded)
+}
+
+func TestFieldPolicyHandlers_AllowsPermittedWrites(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	mockRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.Unit")).Return(nil).Twice()
+	handlers := NewFieldPolicyHandlers(NewUnitHandlers(mockRepo), testFieldPolicies(t))
+
+	// Empty restricted fields on create are not writes
+	response, err := handlers.HandleCreate(context.Background(), policyEvent("createUnit",
+		`{"accountId":"a-1","unitType":"commercialVehicleType","suggestedVin":"1M1AN07Y9GM012345","make":"Mack","model":"Anthem","note":"","basePrice":null}`))
+	require.NoError(t, err)
+	assert.True(t, response.Success)
+
+	// Admins bypass the policy
+	response, err = handlers.HandleCreate(context.Background(), policyEvent("createUnit",
+		`{"accountId":"a-1","unitType":"commercialVehicleType","suggestedVin":"1M1AN07Y9GM012345","make":"Mack","model":"Anthem","basePrice":"1000"}`, "admin"))
+	require.NoError(t, err)
+	assert.True(t, response.Success)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestFieldPolicyHandlers_RedactsResponses(t *testing.T) {
+	price := "125000"
+	unit := &models.Unit{ID: "u-1", AccountID: "a-1", UnitType: "commercialVehicleType", Make: "Mack", Note: "yard 4", BasePrice: &price}
+
+	mockRepo := &repository.MockUnitRepository{}
+	mockRepo.On("GetByKey", mock.Anything, "a-1", "u-1", "commercialVehicleType").Return(unit, nil)
+	mockRepo.On("List", mock.Anything, mock.Anything).Return(&appsync.ListUnitsResponse{Items: []models.Unit{*unit}, Count: 1}, nil)
+	handlers := NewFieldPolicyHandlers(NewUnitHandlers(mockRepo), testFieldPolicies(t)).WithAdminGroup("ops")
+
+	args := `{"id":"u-1","accountId":"a-1","unitType":"commercialVehicleType"}`
+
+	response, err := handlers.HandleRead(context.Background(), policyEvent("getUnit", args, "support"))
+	require.NoError(t, err)
+	redacted := response.Data.(*models.Unit)
+	assert.Nil(t, redacted.BasePrice)
+	assert.Equal(t, "yard 4", redacted.Note)
+	assert.Equal(t, "Mack", redacted.Make)
+
+	response, err = handlers.HandleList(context.Background(), policyEvent("listUnits", `{"accountId":"a-1"}`))
+	require.NoError(t, err)
+	items := response.Data.(*appsync.ListUnitsResponse).Items
+	require.Len(t, items, 1)
+	assert.Nil(t, items[0].BasePrice)
+	assert.Empty(t, items[0].Note)
+
+	response, err = handlers.HandleRead(context.Background(), policyEvent("getUnit", args, "ops"))
+	require.NoError(t, err)
+	assert.Same(t, unit, response.Data)
+
+	// The stored unit is never modified
+	assert.Equal(t, &price, unit.BasePrice)
+}
+
+func TestFieldPolicyHandlers_RedactsDynamicUnits(t *testing.T) {
+	unit := &models.DynamicUnit{ID: "u-1", AccountID: "a-1", UnitType: "commercialVehicleType", Data: map[string]interface{}{"make": "Mack", "basePrice": "1000"}}
+
+	mockRepo := &repository.MockDynamicUnitRepository{}
+	mockRepo.On("GetByKey", mock.Anything, "a-1", "u-1", "commercialVehicleType").Return(unit, nil)
+	handlers := NewFieldPolicyHandlers(NewDynamicUnitHandlers(mockRepo), testFieldPolicies(t))
+
+	response, err := handlers.HandleRead(context.Background(), policyEvent("getUnit", `{"id":"u-1","accountId":"a-1","unitType":"commercialVehicleType"}`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"make": "Mack"}, response.Data.(*models.DynamicUnit).Data)
+}
+
+func TestFieldPolicyHandlers_BatchCreateChecksEveryUnit(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	mockRepo.On("BatchCreate", mock.Anything, mock.Anything).Return([]error{nil, nil}).Once()
+	handlers := NewFieldPolicyHandlers(NewUnitHandlers(mockRepo), testFieldPolicies(t))
+
+	arguments := `{"accountId":"a-1","unitType":"commercialVehicleType","units":[` +
+		`{"suggestedVin":"1M1AN07Y9GM012345","make":"Mack"},{"suggestedVin":"1HGBH41JXMN109186","make":"Honda","note":"new"}]}`
+
+	response, err := handlers.HandleBatchCreate(context.Background(), policyEvent("batchCreateUnits", arguments, "support"))
+	require.NoError(t, err)
+	require.NotNil(t, response.Error)
+	assert.Equal(t, "FORBIDDEN", response.Error.Code)
+	assert.Equal(t, "Not allowed to write fields: note", response.Error.Message)
+
+	response, err = handlers.HandleBatchCreate(context.Background(), policyEvent("batchCreateUnits", arguments, "fleet-manager"))
+	require.NoError(t, err)
+	assert.True(t, response.Success)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestFieldPolicyHandlers_BatchCreateChecksCaseVariantFields(t *testing.T) {
+	handlers := NewFieldPolicyHandlers(NewUnitHandlers(&repository.MockUnitRepository{}), testFieldPolicies(t))
+
+	// Each unit is decoded case-insensitively, so these keys would set note and basePrice
+	arguments := `{"accountId":"a-1","unitType":"commercialVehicleType","units":[` +
+		`{"suggestedVin":"1M1AN07Y9GM012345","make":"Mack","NOTE":"new"},{"suggestedVin":"1HGBH41JXMN109186","make":"Honda","BasePrice":"99999"}]}`
+
+	response, err := handlers.HandleBatchCreate(context.Background(), policyEvent("batchCreateUnits", arguments, "support"))
+	require.NoError(t, err)
+	require.NotNil(t, response.Error)
+	assert.Equal(t, "FORBIDDEN", response.Error.Code)
+	assert.Equal(t, "Not allowed to write fields: basePrice, note", response.Error.Message)
+
+	response, err = handlers.HandleBatchCreate(context.Background(), policyEvent("batchCreateUnits", arguments, "fleet-manager"))
+	require.NoError(t, err)
+	require.NotNil(t, response.Error)
+	assert.Equal(t, "Not allowed to write fields: basePrice", response.Error.Message)
+}
+
+func TestFieldPolicyHandlers_BatchGetRedactsUnits(t *testing.T) {
+	price := "1000"
+	mockRepo := &repository.MockUnitRepository{}
+	mockRepo.On("BatchGet", mock.Anything, "a-1", mock.Anything).Return(
+		[]*models.Unit{{ID: "unit-1", UnitType: "commercialVehicleType", Make: "Mack", BasePrice: &price, Note: "fleet"}, nil},
+		[]error{nil, nil},
+	)
+	handlers := NewFieldPolicyHandlers(NewUnitHandlers(mockRepo), testFieldPolicies(t))
+
+	arguments := `{"accountId":"a-1","keys":[{"id":"unit-1","unitType":"commercialVehicleType"},{"id":"unit-2","unitType":"commercialVehicleType"}]}`
+	response, err := handlers.HandleBatchGet(context.Background(), policyEvent("batchGetUnits", arguments, "support"))
+	require.NoError(t, err)
+	require.True(t, response.Success)
+
+	result := response.Data.(*appsync.BatchUnitsResponse)
+	require.NotNil(t, result.Results[0].Unit)
+	assert.Equal(t, "Mack", result.Results[0].Unit.Make)
+	assert.Nil(t, result.Results[0].Unit.BasePrice)
+	assert.Equal(t, "fleet", result.Results[0].Unit.Note)
+	assert.Equal(t, "NOT_FOUND", result.Results[1].Code)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestFieldPolicyHandlers_TransactChecksEveryOperation(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	mockRepo.On("TransactWrite", mock.Anything, "a-1", mock.Anything, mock.Anything).Return(nil).Once()
+	handlers := NewFieldPolicyHandlers(NewUnitHandlers(mockRepo), testFieldPolicies(t))
+
+	arguments := `{"accountId":"a-1","operations":[` +
+		`{"type":"DELETE","id":"unit-1","unitType":"commercialVehicleType","expectedVersion":1},` +
+		`{"type":"UPDATE","id":"unit-2","unitType":"commercialVehicleType","expectedVersion":1,"unit":{"basePrice":null}}]}`
+
+	response, err := handlers.HandleTransact(context.Background(), policyEvent("transactUnits", arguments, "support"))
+	require.NoError(t, err)
+	require.NotNil(t, response.Error)
+	assert.Equal(t, "FORBIDDEN", response.Error.Code)
+	assert.Equal(t, "Not allowed to write fields: basePrice", response.Error.Message)
+
+	response, err = handlers.HandleTransact(context.Background(), policyEvent("transactUnits", arguments, "pricing"))
+	require.NoError(t, err)
+	assert.True(t, response.Success)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestFieldPolicyHandlers_TransactChecksCaseVariantFields(t *testing.T) {
+	handlers := NewFieldPolicyHandlers(NewUnitHandlers(&repository.MockUnitRepository{}), testFieldPolicies(t))
+
+	arguments := `{"accountId":"a-1","operations":[` +
+		`{"type":"CREATE","unitType":"commercialVehicleType","unit":{"suggestedVin":"1M1AN07Y9GM012345","BasePrice":"99999"}}]}`
+
+	response, err := handlers.HandleTransact(context.Background(), policyEvent("transactUnits", arguments, "support"))
+	require.NoError(t, err)
+	require.NotNil(t, response.Error)
+	assert.Equal(t, "FORBIDDEN", response.Error.Code)
+	assert.Equal(t, "Not allowed to write fields: basePrice", response.Error.Message)
+}
+
+func TestFieldPolicyHandlers_GetHistoryRedactsChanges(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	mockRepo.On("GetHistory", mock.Anything, mock.Anything).Return(&appsync.UnitHistoryResponse{
+		Items: []models.UnitHistoryEntry{{UnitID: "unit-1", UnitType: "commercialVehicleType", Changes: models.FieldChanges{
+			"basePrice": {From: json.RawMessage(`"10"`), To: json.RawMessage(`"12"`)},
+			"note":      {From: json.RawMessage(`null`), To: json.RawMessage(`"moved"`)},
+		}}},
+		Count: 1,
+	}, nil)
+	handlers := NewFieldPolicyHandlers(NewUnitHandlers(mockRepo), testFieldPolicies(t))
+
+	arguments := `{"accountId":"a-1","id":"unit-1","unitType":"commercialVehicleType"}`
+	response, err := handlers.HandleGetHistory(context.Background(), policyEvent("getUnitHistory", arguments, "support"))
+	require.NoError(t, err)
+	require.True(t, response.Success)
+	changes := response.Data.(*appsync.UnitHistoryResponse).Items[0].Changes
+	assert.NotContains(t, changes, "basePrice")
+	assert.Contains(t, changes, "note")
+
+	response, err = handlers.HandleGetHistory(context.Background(), policyEvent("getUnitHistory", arguments, "pricing"))
+	require.NoError(t, err)
+	assert.Contains(t, response.Data.(*appsync.UnitHistoryResponse).Items[0].Changes, "basePrice")
+}
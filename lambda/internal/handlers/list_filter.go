@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"log"
+
+	"github.com/steverhoton/unt-units-svc/internal/filter"
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+// validateListFilter checks the optional listUnits filter and returns a
+// VALIDATION_ERROR response when it is malformed or names unknown fields
+func validateListFilter(input *appsync.ListUnitsInput) *appsync.Response {
+	if input.Filter == nil || *input.Filter == "" {
+		return nil
+	}
+
+	parsed, err := filter.Parse(*input.Filter)
+	if err != nil {
+		log.Printf("Invalid filter: %v", err)
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "Invalid filter", err.Error())
+	}
+
+	fields, err := filterableFields(input.UnitType)
+	if err != nil {
+		log.Printf("Error loading filterable fields: %v", err)
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "Invalid filter", err.Error())
+	}
+
+	if err := parsed.Validate(fields); err != nil {
+		log.Printf("Invalid filter: %v", err)
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "Invalid filter", err.Error())
+	}
+
+	return nil
+}
+
+// filterableFields returns the schema properties of the requested unit type, or of
+// every registered unit type when none is given. accountId is excluded because it
+// is the partition key every listing is already scoped to.
+func filterableFields(unitType *string) ([]string, error) {
+	registry, err := models.DefaultSchemaRegistry()
+	if err != nil {
+		return nil, err
+	}
+
+	unitTypes := registry.UnitTypes()
+	if unitType != nil && *unitType != "" {
+		unitTypes = []string{*unitType}
+	}
+
+	var fields []string
+	for _, name := range unitTypes {
+		schema, err := registry.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range schema.PropertyNames() {
+			if field != "accountId" {
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields, nil
+}
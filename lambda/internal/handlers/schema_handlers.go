@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+// SchemaHandlers contains handlers for unit type schema discovery
+type SchemaHandlers struct {
+	registry *models.SchemaRegistry
+}
+
+// NewSchemaHandlers creates a new instance of SchemaHandlers
+func NewSchemaHandlers(registry *models.SchemaRegistry) *SchemaHandlers {
+	return &SchemaHandlers{
+		registry: registry,
+	}
+}
+
+// HandleListUnitTypes handles requests listing the available unit types
+func (h *SchemaHandlers) HandleListUnitTypes(_ context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("HandleListUnitTypes called with event: %+v", event)
+
+	unitTypes := h.registry.UnitTypes()
+	items := make([]appsync.UnitTypeSummary, 0, len(unitTypes))
+	for _, unitType := range unitTypes {
+		latest, err := h.registry.Get(unitType)
+		if err != nil {
+			log.Printf("Error loading schema for unit type %s: %v", unitType, err)
+			return appsync.NewErrorResponse("LIST_FAILED", "Failed to list unit types", err.Error()), nil
+		}
+		items = append(items, appsync.UnitTypeSummary{
+			UnitType:      unitType,
+			Title:         latest.Title,
+			Description:   latest.Description,
+			LatestVersion: latest.Version,
+			Versions:      h.registry.Versions(unitType),
+		})
+	}
+
+	response := &appsync.ListUnitTypesResponse{
+		Items: items,
+		Count: len(items),
+	}
+
+	log.Printf("Unit types listed successfully: %d items", response.Count)
+	return appsync.NewSuccessResponse(response, fmt.Sprintf("Retrieved %d unit types", response.Count)), nil
+}
+
+// HandleGetUnitTypeSchema handles requests for a unit type's JSON schema
+func (h *SchemaHandlers) HandleGetUnitTypeSchema(_ context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("HandleGetUnitTypeSchema called with event: %+v", event)
+
+	// Parse arguments
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error()), nil
+	}
+
+	input, ok := args.(appsync.GetUnitTypeSchemaInput)
+	if !ok {
+		log.Printf("Invalid input type for get unit type schema operation")
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for get unit type schema operation", ""), nil
+	}
+
+	// Validate required fields
+	if input.UnitType == "" {
+		log.Printf("Missing required field: unitType")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "UnitType is required", ""), nil
+	}
+
+	var schema *models.UnitTypeSchema
+	if input.Version != nil {
+		schema, err = h.registry.GetVersion(input.UnitType, *input.Version)
+	} else {
+		schema, err = h.registry.Get(input.UnitType)
+	}
+	if err != nil {
+		log.Printf("Schema not found for unit type %s: %v", input.UnitType, err)
+		return appsync.NewErrorResponse("NOT_FOUND", "Unit type schema not found", err.Error()), nil
+	}
+
+	log.Printf("Schema retrieved successfully for unit type: %s, version: %d", schema.UnitType, schema.Version)
+	return appsync.NewSuccessResponse(schema, "Unit type schema retrieved successfully"), nil
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+const testSchemaDocument = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "title": "Trailer Type Unit",
+  "type": "object",
+  "properties": {"id": {"type": "string"}}
+}`
+
+func newTestSchemaRegistry(t *testing.T) *models.SchemaRegistry {
+	registry := models.NewSchemaRegistry()
+	require.NoError(t, registry.Register("trailerType", 1, []byte(testSchemaDocument)))
+	require.NoError(t, registry.Register("trailerType", 2, []byte(testSchemaDocument)))
+	return registry
+}
+
+func TestSchemaHandlers_HandleListUnitTypes(t *testing.T) {
+	handlers := NewSchemaHandlers(newTestSchemaRegistry(t))
+
+	event := &appsync.AppSyncEvent{
+		TypeName:  "Query",
+		FieldName: "listUnitTypes",
+		Arguments: json.RawMessage(`{}`),
+	}
+
+	response, err := handlers.HandleListUnitTypes(context.Background(), event)
+
+	require.NoError(t, err)
+	require.NotNil(t, response)
+	assert.True(t, response.Success)
+
+	result, ok := response.Data.(*appsync.ListUnitTypesResponse)
+	require.True(t, ok)
+	require.Len(t, result.Items, 1)
+	assert.Equal(t, "trailerType", result.Items[0].UnitType)
+	assert.Equal(t, "Trailer Type Unit", result.Items[0].Title)
+	assert.Equal(t, 2, result.Items[0].LatestVersion)
+	assert.Equal(t, []int{1, 2}, result.Items[0].Versions)
+}
+
+func TestSchemaHandlers_HandleGetUnitTypeSchema(t *testing.T) {
+	handlers := NewSchemaHandlers(newTestSchemaRegistry(t))
+
+	tests := []struct {
+		name        string
+		arguments   string
+		wantSuccess bool
+		wantCode    string
+		wantVersion int
+	}{
+		{name: "latest version", arguments: `{"unitType":"trailerType"}`, wantSuccess: true, wantVersion: 2},
+		{name: "specific version", arguments: `{"unitType":"trailerType","version":1}`, wantSuccess: true, wantVersion: 1},
+		{name: "missing unit type", arguments: `{}`, wantCode: "VALIDATION_ERROR"},
+		{name: "unknown unit type", arguments: `{"unitType":"unknownType"}`, wantCode: "NOT_FOUND"},
+		{name: "unknown version", arguments: `{"unitType":"trailerType","version":9}`, wantCode: "NOT_FOUND"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &appsync.AppSyncEvent{
+				TypeName:  "Query",
+				FieldName: "getUnitTypeSchema",
+				Arguments: json.RawMessage(tt.arguments),
+			}
+
+			response, err := handlers.HandleGetUnitTypeSchema(context.Background(), event)
+
+			require.NoError(t, err)
+			require.NotNil(t, response)
+			assert.Equal(t, tt.wantSuccess, response.Success)
+			if !tt.wantSuccess {
+				assert.Equal(t, tt.wantCode, response.Error.Code)
+				return
+			}
+
+			schema, ok := response.Data.(*models.UnitTypeSchema)
+			require.True(t, ok)
+			assert.Equal(t, tt.wantVersion, schema.Version)
+			assert.JSONEq(t, testSchemaDocument, string(schema.Schema))
+		})
+	}
+}
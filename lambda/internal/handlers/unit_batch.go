@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/steverhoton/unt-units-svc/internal/importer"
+	"github.com/steverhoton/unt-units-svc/internal/repository"
+	"github.com/steverhoton/unt-units-svc/internal/vin"
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+// maxBatchSize is the most keys or units one batch request may carry
+const maxBatchSize = 100
+
+// checkBatchSize returns a VALIDATION_ERROR response when a batch of n keys or units is empty or too large
+func checkBatchSize(n int, what string) *appsync.Response {
+	if n == 0 {
+		return appsync.NewErrorResponse("VALIDATION_ERROR", what+" are required", "")
+	}
+	if n > maxBatchSize {
+		return appsync.NewErrorResponse("VALIDATION_ERROR",
+			fmt.Sprintf("Request has %d %s; at most %d can be sent at once", n, strings.ToLower(what), maxBatchSize), "")
+	}
+	return nil
+}
+
+// batchKeyResult starts the result of a key, failing it when the key is incomplete
+func batchKeyResult(index int, key appsync.UnitKeyInput, requireVersion bool) appsync.BatchUnitResult {
+	result := appsync.BatchUnitResult{Index: index, ID: key.ID, UnitType: key.UnitType}
+	switch {
+	case key.ID == "":
+		result.Code, result.Error = "VALIDATION_ERROR", "ID is required"
+	case key.UnitType == "":
+		result.Code, result.Error = "VALIDATION_ERROR", "UnitType is required"
+	case requireVersion && key.ExpectedVersion == nil:
+		result.Code, result.Error = "VALIDATION_ERROR", "ExpectedVersion is required"
+	}
+	return result
+}
+
+// HandleBatchGet retrieves many units of an account with batched reads. The
+// response reports each key as found, not found or failed.
+func (h *UnitHandlers) HandleBatchGet(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("HandleBatchGet called for field %s", event.FieldName)
+
+	// Parse arguments
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error()), nil
+	}
+
+	input, ok := args.(appsync.BatchGetUnitsInput)
+	if !ok {
+		log.Printf("Invalid input type for batch get operation")
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for batch get operation", ""), nil
+	}
+
+	// Validate required fields
+	if input.AccountID == "" {
+		log.Printf("Missing required field: accountId")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "AccountID is required", ""), nil
+	}
+	if response := checkBatchSize(len(input.Keys), "Keys"); response != nil {
+		return response, nil
+	}
+
+	results := make([]appsync.BatchUnitResult, len(input.Keys))
+	var keys []repository.UnitKey
+	var positions []int
+	for i, key := range input.Keys {
+		results[i] = batchKeyResult(i, key, false)
+		if results[i].Code != "" {
+			continue
+		}
+		keys = append(keys, repository.UnitKey{ID: key.ID, UnitType: key.UnitType})
+		positions = append(positions, i)
+	}
+
+	units, errs := h.repo.BatchGet(ctx, input.AccountID, keys)
+	for j, i := range positions {
+		switch {
+		case j < len(errs) && errs[j] != nil:
+			results[i].Code, results[i].Error = "READ_FAILED", errs[j].Error()
+		case j >= len(units) || units[j] == nil:
+			results[i].Code, results[i].Error = "NOT_FOUND", "Unit not found"
+		default:
+			results[i].Success = true
+			results[i].Unit = units[j]
+		}
+	}
+
+	response := appsync.NewBatchUnitsResponse(results)
+	log.Printf("Batch get of %d units for account %s: %d found", response.Total, input.AccountID, response.Succeeded)
+	return appsync.NewSuccessResponse(response, fmt.Sprintf("Retrieved %d of %d units", response.Succeeded, response.Total)), nil
+}
+
+// HandleBatchCreate creates many units of one type. Each unit is validated like a
+// createUnit request and the valid ones are written with batched writes; the
+// response reports the outcome of each.
+func (h *UnitHandlers) HandleBatchCreate(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("HandleBatchCreate called for field %s", event.FieldName)
+
+	// Parse arguments
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error()), nil
+	}
+
+	input, ok := args.(appsync.BatchCreateUnitsInput)
+	if !ok {
+		log.Printf("Invalid input type for batch create operation")
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for batch create operation", ""), nil
+	}
+
+	// Validate required fields
+	if input.AccountID == "" {
+		log.Printf("Missing required field: accountId")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "AccountID is required", ""), nil
+	}
+	if input.UnitType == "" {
+		log.Printf("Missing required field: unitType")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "UnitType is required", ""), nil
+	}
+	if response := checkBatchSize(len(input.Units), "Units"); response != nil {
+		return response, nil
+	}
+
+	// The units are imported as rows numbered from 1 in request order
+	rows := make([]importer.Row, len(input.Units))
+	for i := range input.Units {
+		rows[i] = importer.Row{
+			Line:         i + 1,
+			Unit:         &input.Units[i].Unit,
+			VinExemption: vin.Exemption(input.Units[i].VinExemption),
+		}
+	}
+	report := importer.New(h.repo).Import(ctx, input.AccountID, input.UnitType, rows)
+
+	results := make([]appsync.BatchUnitResult, len(report.Rows))
+	for i, row := range report.Rows {
+		results[i] = appsync.BatchUnitResult{
+			Index:    i,
+			ID:       row.ID,
+			UnitType: input.UnitType,
+			Success:  row.Success,
+			Code:     row.Code,
+			Error:    row.Error,
+		}
+		if row.Success {
+			results[i].Unit = rows[i].Unit
+		}
+	}
+
+	response := appsync.NewBatchUnitsResponse(results)
+	return appsync.NewSuccessResponse(response, fmt.Sprintf("Created %d of %d units", response.Succeeded, response.Total)), nil
+}
+
+// HandleBatchDelete soft deletes many units of an account, each at its expected
+// version. The response reports the outcome of each key.
+func (h *UnitHandlers) HandleBatchDelete(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("HandleBatchDelete called for field %s", event.FieldName)
+
+	// Parse arguments
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error()), nil
+	}
+
+	input, ok := args.(appsync.BatchDeleteUnitsInput)
+	if !ok {
+		log.Printf("Invalid input type for batch delete operation")
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for batch delete operation", ""), nil
+	}
+
+	// Validate required fields
+	if input.AccountID == "" {
+		log.Printf("Missing required field: accountId")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "AccountID is required", ""), nil
+	}
+	if response := checkBatchSize(len(input.Keys), "Keys"); response != nil {
+		return response, nil
+	}
+
+	results := make([]appsync.BatchUnitResult, len(input.Keys))
+	var keys []repository.DeleteKey
+	var positions []int
+	for i, key := range input.Keys {
+		results[i] = batchKeyResult(i, key, true)
+		if results[i].Code != "" {
+			continue
+		}
+		keys = append(keys, repository.DeleteKey{
+			UnitKey:         repository.UnitKey{ID: key.ID, UnitType: key.UnitType},
+			ExpectedVersion: *key.ExpectedVersion,
+		})
+		positions = append(positions, i)
+	}
+
+	errs := h.repo.BatchDelete(ctx, input.AccountID, keys, event.Identity.Principal())
+	for j, i := range positions {
+		var err error
+		if j < len(errs) {
+			err = errs[j]
+		}
+
+		var conflict *repository.VersionConflictError
+		switch {
+		case err == nil:
+			results[i].Success = true
+		case errors.Is(err, repository.ErrUnitNotFound):
+			results[i].Code, results[i].Error = "NOT_FOUND", "Unit not found"
+		case errors.Is(err, repository.ErrUnitAlreadyDeleted):
+			results[i].Code, results[i].Error = "ALREADY_DELETED", "Unit is already deleted"
+		case errors.As(err, &conflict):
+			results[i].Code, results[i].Error = "CONFLICT", conflict.Error()
+		default:
+			results[i].Code, results[i].Error = "DELETE_FAILED", err.Error()
+		}
+	}
+
+	response := appsync.NewBatchUnitsResponse(results)
+	log.Printf("Batch delete of %d units for account %s: %d deleted", response.Total, input.AccountID, response.Succeeded)
+	return appsync.NewSuccessResponse(response, fmt.Sprintf("Deleted %d of %d units", response.Succeeded, response.Total)), nil
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/steverhoton/unt-units-svc/internal/blobstore"
+	"github.com/steverhoton/unt-units-svc/internal/exporter"
+	"github.com/steverhoton/unt-units-svc/internal/repository"
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+// excludedFieldsKey is the context key under which FieldPolicyHandlers passes the
+// fields an export must leave out
+type excludedFieldsKey struct{}
+
+// withExcludedFields returns a context carrying fields to leave out of an export
+func withExcludedFields(ctx context.Context, fields []string) context.Context {
+	return context.WithValue(ctx, excludedFieldsKey{}, fields)
+}
+
+// excludedFields returns the fields to leave out of an export, if any
+func excludedFields(ctx context.Context) []string {
+	fields, _ := ctx.Value(excludedFieldsKey{}).([]string)
+	return fields
+}
+
+// exportFunc writes an export of units to w
+type exportFunc func(ctx context.Context, opts repository.ExportOptions, w io.Writer) (*repository.ExportResult, error)
+
+// exportTarget is where exports are uploaded. It is shared by the unit and dynamic
+// unit handlers, which differ only in the repository that produces the file.
+type exportTarget struct {
+	store  blobstore.Store
+	urlTTL time.Duration
+}
+
+// handleExport writes an account's units to a temporary file with export and
+// uploads it to the export store. The file is staged on disk so exports larger
+// than memory can be uploaded with a known length.
+func (t exportTarget) handleExport(ctx context.Context, event *appsync.AppSyncEvent, requireUnitType bool, export exportFunc) (*appsync.Response, error) {
+	// Parse arguments
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error()), nil
+	}
+
+	input, ok := args.(appsync.ExportUnitsInput)
+	if !ok {
+		log.Printf("Invalid input type for export operation")
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for export operation", ""), nil
+	}
+
+	// Validate required fields
+	if input.AccountID == "" {
+		log.Printf("Missing required field: accountId")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "AccountID is required", ""), nil
+	}
+	unitType := ""
+	if input.UnitType != nil {
+		unitType = *input.UnitType
+	}
+	if requireUnitType && unitType == "" {
+		log.Printf("Missing required field: unitType")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "UnitType is required", ""), nil
+	}
+	format, err := exporter.ParseFormat(input.Format)
+	if err != nil {
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "Invalid export format", err.Error()), nil
+	}
+
+	if t.store == nil {
+		log.Printf("Export requested for account %s but no export store is configured", input.AccountID)
+		return appsync.NewErrorResponse("NOT_CONFIGURED", "Exports are not configured", ""), nil
+	}
+
+	file, err := os.CreateTemp("", "unit-export-*."+format.Extension())
+	if err != nil {
+		log.Printf("Error creating export file: %v", err)
+		return appsync.NewErrorResponse("EXPORT_FAILED", "Failed to export units", err.Error()), nil
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	opts := repository.ExportOptions{
+		AccountID:     input.AccountID,
+		UnitType:      unitType,
+		Format:        format,
+		ExcludeFields: excludedFields(ctx),
+	}
+	result, err := export(ctx, opts, file)
+	if err != nil {
+		log.Printf("Error exporting units for account %s: %v", input.AccountID, err)
+		return appsync.NewErrorResponse("EXPORT_FAILED", "Failed to export units", err.Error()), nil
+	}
+
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		log.Printf("Error rewinding export file: %v", err)
+		return appsync.NewErrorResponse("EXPORT_FAILED", "Failed to export units", err.Error()), nil
+	}
+
+	key := fmt.Sprintf("exports/%s/%s-%s.%s", input.AccountID, time.Now().UTC().Format("20060102T150405Z"), uuid.NewString(), format.Extension())
+	location, err := t.store.Put(ctx, key, file, size, format.ContentType())
+	if err != nil {
+		log.Printf("Error uploading export %s: %v", key, err)
+		return appsync.NewErrorResponse("EXPORT_FAILED", "Failed to upload export", err.Error()), nil
+	}
+
+	response := &appsync.ExportUnitsResponse{
+		Key:      key,
+		Location: location,
+		Format:   string(format),
+		Count:    result.Count,
+	}
+
+	// A download link is a convenience; the export is still usable from its location without one
+	if signer, ok := t.store.(blobstore.URLSigner); ok && t.urlTTL > 0 {
+		if url, err := signer.PresignGet(ctx, key, t.urlTTL); err != nil {
+			log.Printf("Error presigning export %s: %v", key, err)
+		} else {
+			response.URL = url
+		}
+	}
+
+	log.Printf("Exported %d units for account %s to %s", result.Count, input.AccountID, location)
+	return appsync.NewSuccessResponse(response, fmt.Sprintf("Exported %d units", result.Count)), nil
+}
+
+// HandleExport writes the account's live units, optionally of one unit type, to the export store
+func (h *UnitHandlers) HandleExport(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("HandleExport called for field %s", event.FieldName)
+	return h.export.handleExport(ctx, event, false, h.repo.Export)
+}
+
+// HandleExport writes the account's live units of one unit type to the export store
+func (h *DynamicUnitHandlers) HandleExport(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("HandleExport called for field %s", event.FieldName)
+	return h.export.handleExport(ctx, event, true, h.repo.Export)
+}
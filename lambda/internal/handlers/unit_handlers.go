@@ -3,25 +3,118 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"time"
 
+	"github.com/steverhoton/unt-units-svc/internal/blobstore"
+	"github.com/steverhoton/unt-units-svc/internal/config"
+	"github.com/steverhoton/unt-units-svc/internal/decoder"
+	"github.com/steverhoton/unt-units-svc/internal/models"
 	"github.com/steverhoton/unt-units-svc/internal/repository"
+	"github.com/steverhoton/unt-units-svc/internal/vin"
 	"github.com/steverhoton/unt-units-svc/pkg/appsync"
 )
 
+// CRUDHandlers is implemented by every handler set that serves the unit CRUD fields,
+// allowing the lambda entrypoint to select an implementation per unit type
+type CRUDHandlers interface {
+	HandleCreate(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error)
+	HandleRead(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error)
+	HandleUpdate(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error)
+	HandleDelete(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error)
+	HandleList(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error)
+	HandleRestore(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error)
+	HandleListDeleted(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error)
+	HandlePurge(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error)
+}
+
+// UnitIDHandler is implemented by handler sets that can look a unit up by its ID
+// alone, without the accountId and unitType that form its key
+type UnitIDHandler interface {
+	HandleGetByID(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error)
+}
+
+// VinHandler is implemented by handler sets that can look units up by VIN
+type VinHandler interface {
+	HandleGetByVin(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error)
+	HandleSearchByVin(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error)
+}
+
+// VinDecodeHandler is implemented by handler sets that can decode VINs
+type VinDecodeHandler interface {
+	HandleDecodeVin(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error)
+}
+
+// ImportHandler is implemented by handler sets that can create units in bulk
+type ImportHandler interface {
+	HandleImport(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error)
+}
+
+// BatchHandler is implemented by handler sets that can read, create and delete many units at once
+type BatchHandler interface {
+	HandleBatchGet(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error)
+	HandleBatchCreate(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error)
+	HandleBatchDelete(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error)
+}
+
+// TransactHandler is implemented by handler sets that can write many units in one transaction
+type TransactHandler interface {
+	HandleTransact(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error)
+}
+
+// ExportHandler is implemented by handler sets that can export an account's units to a file
+type ExportHandler interface {
+	HandleExport(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error)
+}
+
+// HistoryHandler is implemented by handler sets that can list the recorded changes to a unit
+type HistoryHandler interface {
+	HandleGetHistory(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error)
+}
+
 // UnitHandlers contains handlers for unit CRUD operations
 type UnitHandlers struct {
 	repo repository.UnitRepository
+
+	// adminGroup is the identity group allowed to purge units
+	adminGroup string
+
+	// vinDecoder decodes VINs for decodeVin and createUnit's decodeVin option
+	vinDecoder decoder.VinDecoder
+
+	// export is where exportUnits uploads its files
+	export exportTarget
 }
 
 // NewUnitHandlers creates a new instance of UnitHandlers
 func NewUnitHandlers(repo repository.UnitRepository) *UnitHandlers {
 	return &UnitHandlers{
-		repo: repo,
+		repo:       repo,
+		adminGroup: config.DefaultAdminGroup,
 	}
 }
 
+// WithAdminGroup sets the identity group allowed to run administrative operations
+func (h *UnitHandlers) WithAdminGroup(group string) *UnitHandlers {
+	h.adminGroup = group
+	return h
+}
+
+// WithVinDecoder sets the decoder used by decodeVin and createUnit's decodeVin option
+func (h *UnitHandlers) WithVinDecoder(vinDecoder decoder.VinDecoder) *UnitHandlers {
+	h.vinDecoder = vinDecoder
+	return h
+}
+
+// WithExportStore sets the store exportUnits uploads to. When the store can presign
+// URLs, responses include a download link valid for urlTTL.
+func (h *UnitHandlers) WithExportStore(store blobstore.Store, urlTTL time.Duration) *UnitHandlers {
+	h.export = exportTarget{store: store, urlTTL: urlTTL}
+	return h
+}
+
 // HandleCreate handles unit creation requests
 func (h *UnitHandlers) HandleCreate(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
 	log.Printf("HandleCreate called with event: %+v", event)
@@ -52,6 +145,32 @@ func (h *UnitHandlers) HandleCreate(ctx context.Context, event *appsync.AppSyncE
 		log.Printf("Missing required field: suggestedVin")
 		return appsync.NewErrorResponse("VALIDATION_ERROR", "SuggestedVin is required", ""), nil
 	}
+	if err := vin.Validate(vin.Vehicle{
+		VIN:       input.SuggestedVin,
+		Make:      input.Make,
+		ModelYear: input.ModelYear,
+		Exemption: vin.Exemption(input.VinExemption),
+	}); err != nil {
+		log.Printf("Invalid VIN for account %s: %v", input.AccountID, err)
+		return vinValidationResponse(err), nil
+	}
+
+	// Fill the fields the client left empty from the decoded VIN
+	if input.DecodeVin {
+		if h.vinDecoder == nil {
+			log.Printf("VIN decoding requested but no decoder is configured")
+			return appsync.NewErrorResponse("NOT_CONFIGURED", "VIN decoding is not configured", ""), nil
+		}
+		decoded, err := h.vinDecoder.DecodeVin(ctx, input.SuggestedVin, input.ModelYear)
+		if err != nil {
+			log.Printf("Error decoding VIN %s: %v", input.SuggestedVin, err)
+			return appsync.NewErrorResponse("DECODE_FAILED", "Failed to decode VIN", err.Error()), nil
+		}
+		// The submitted VIN is kept even when the decoder suggests a correction
+		decoded.SuggestedVin = ""
+		filled := input.Unit.FillEmptyFields(decoded)
+		log.Printf("Filled %d fields from decoded VIN %s", len(filled), input.SuggestedVin)
+	}
 
 	// Set the AccountID and UnitType in the embedded unit
 	input.Unit.AccountID = input.AccountID
@@ -60,6 +179,11 @@ func (h *UnitHandlers) HandleCreate(ctx context.Context, event *appsync.AppSyncE
 	// Attempt to create the unit
 	err = h.repo.Create(ctx, &input.Unit)
 	if err != nil {
+		var duplicateVin *repository.DuplicateVinError
+		if errors.As(err, &duplicateVin) {
+			log.Printf("Duplicate VIN creating unit for account %s: %v", input.AccountID, err)
+			return appsync.NewErrorResponse("DUPLICATE_VIN", "A unit with this VIN already exists in the account", err.Error()), nil
+		}
 		log.Printf("Error creating unit: %v", err)
 		return appsync.NewErrorResponse("CREATE_FAILED", "Failed to create unit", err.Error()), nil
 	}
@@ -99,6 +223,10 @@ func (h *UnitHandlers) HandleRead(ctx context.Context, event *appsync.AppSyncEve
 		return appsync.NewErrorResponse("VALIDATION_ERROR", "UnitType is required", ""), nil
 	}
 
+	if input.AsOf != nil && *input.AsOf != "" {
+		return h.readAsOf(ctx, input)
+	}
+
 	// Retrieve the unit
 	unit, err := h.repo.GetByKey(ctx, input.AccountID, input.ID, input.UnitType)
 	if err != nil {
@@ -115,6 +243,165 @@ func (h *UnitHandlers) HandleRead(ctx context.Context, event *appsync.AppSyncEve
 	return appsync.NewSuccessResponse(unit, "Unit retrieved successfully"), nil
 }
 
+// HandleGetByID handles requests to find a unit by ID across accounts and unit types.
+// It returns every match; callers are scoped to their accounts by AuthorizedHandlers.
+func (h *UnitHandlers) HandleGetByID(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("HandleGetByID called with event: %+v", event)
+
+	// Parse arguments
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error()), nil
+	}
+
+	input, ok := args.(appsync.GetUnitByIDInput)
+	if !ok {
+		log.Printf("Invalid input type for get by ID operation")
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for get by ID operation", ""), nil
+	}
+
+	// Validate required fields
+	if input.ID == "" {
+		log.Printf("Missing required field: id")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "ID is required", ""), nil
+	}
+
+	// Look the unit up in every account
+	units, err := h.repo.GetByUnitID(ctx, input.ID)
+	if err != nil {
+		log.Printf("Error retrieving units by ID: %v", err)
+		return appsync.NewErrorResponse("READ_FAILED", "Failed to retrieve unit", err.Error()), nil
+	}
+
+	log.Printf("Units retrieved by ID %s: %d items", input.ID, len(units))
+	return appsync.NewSuccessResponse(&appsync.ListUnitsResponse{Items: units, Count: len(units)}, fmt.Sprintf("Retrieved %d units", len(units))), nil
+}
+
+// HandleGetByVin handles requests to find the unit with a VIN in an account
+func (h *UnitHandlers) HandleGetByVin(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("HandleGetByVin called with event: %+v", event)
+
+	// Parse arguments
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error()), nil
+	}
+
+	input, ok := args.(appsync.GetUnitByVinInput)
+	if !ok {
+		log.Printf("Invalid input type for get by VIN operation")
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for get by VIN operation", ""), nil
+	}
+
+	// Validate required fields
+	if input.AccountID == "" {
+		log.Printf("Missing required field: accountId")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "AccountID is required", ""), nil
+	}
+	if models.NormalizeVin(input.Vin) == "" {
+		log.Printf("Missing required field: vin")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "VIN is required", ""), nil
+	}
+
+	// Retrieve the unit
+	unit, err := h.repo.GetByVin(ctx, input.AccountID, input.Vin)
+	if err != nil {
+		log.Printf("Error retrieving unit by VIN: %v", err)
+		return appsync.NewErrorResponse("READ_FAILED", "Failed to retrieve unit", err.Error()), nil
+	}
+
+	if unit == nil {
+		log.Printf("Unit not found with VIN: %s for account: %s", input.Vin, input.AccountID)
+		return appsync.NewErrorResponse("NOT_FOUND", "Unit not found", ""), nil
+	}
+
+	log.Printf("Unit retrieved by VIN with ID: %s, type: %s for account: %s", unit.ID, unit.UnitType, unit.AccountID)
+	return appsync.NewSuccessResponse(unit, "Unit retrieved successfully"), nil
+}
+
+// HandleSearchByVin handles requests to find the units whose VIN starts with a prefix
+func (h *UnitHandlers) HandleSearchByVin(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("HandleSearchByVin called with event: %+v", event)
+
+	// Parse arguments
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error()), nil
+	}
+
+	input, ok := args.(appsync.SearchUnitsByVinInput)
+	if !ok {
+		log.Printf("Invalid input type for search by VIN operation")
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for search by VIN operation", ""), nil
+	}
+
+	// Validate required fields
+	if input.AccountID == "" {
+		log.Printf("Missing required field: accountId")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "AccountID is required", ""), nil
+	}
+	if n := len(models.NormalizeVin(input.VinPrefix)); n < repository.MinVinPrefixLength || n > repository.MaxVinPrefixLength {
+		log.Printf("Invalid VIN prefix length: %d", n)
+		return appsync.NewErrorResponse("VALIDATION_ERROR",
+			fmt.Sprintf("VIN prefix must be %d to %d characters", repository.MinVinPrefixLength, repository.MaxVinPrefixLength), ""), nil
+	}
+
+	// Search the account's VIN index
+	result, err := h.repo.SearchByVin(ctx, &input)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidPaginationToken) {
+			log.Printf("Rejected pagination token: %v", err)
+			return appsync.NewErrorResponse("VALIDATION_ERROR", "Invalid nextToken", err.Error()), nil
+		}
+		log.Printf("Error searching units by VIN: %v", err)
+		return appsync.NewErrorResponse("LIST_FAILED", "Failed to search units", err.Error()), nil
+	}
+
+	log.Printf("Units found by VIN prefix: %d items", result.Count)
+	return appsync.NewSuccessResponse(result, fmt.Sprintf("Retrieved %d units", result.Count)), nil
+}
+
+// HandleDecodeVin handles requests to decode a VIN into unit details
+func (h *UnitHandlers) HandleDecodeVin(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("HandleDecodeVin called with event: %+v", event)
+
+	// Parse arguments
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error()), nil
+	}
+
+	input, ok := args.(appsync.DecodeVinInput)
+	if !ok {
+		log.Printf("Invalid input type for decode VIN operation")
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for decode VIN operation", ""), nil
+	}
+
+	// Validate required fields
+	if models.NormalizeVin(input.Vin) == "" {
+		log.Printf("Missing required field: vin")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "VIN is required", ""), nil
+	}
+
+	if h.vinDecoder == nil {
+		log.Printf("VIN decoding requested but no decoder is configured")
+		return appsync.NewErrorResponse("NOT_CONFIGURED", "VIN decoding is not configured", ""), nil
+	}
+
+	decoded, err := h.vinDecoder.DecodeVin(ctx, input.Vin, input.ModelYear)
+	if err != nil {
+		log.Printf("Error decoding VIN %s: %v", input.Vin, err)
+		return appsync.NewErrorResponse("DECODE_FAILED", "Failed to decode VIN", err.Error()), nil
+	}
+
+	log.Printf("VIN %s decoded with error code %q", input.Vin, decoded.ErrorCode)
+	return appsync.NewSuccessResponse(decoded, "VIN decoded successfully"), nil
+}
+
 // HandleUpdate handles unit update requests
 func (h *UnitHandlers) HandleUpdate(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
 	log.Printf("HandleUpdate called with event: %+v", event)
@@ -145,8 +432,23 @@ func (h *UnitHandlers) HandleUpdate(ctx context.Context, event *appsync.AppSyncE
 		log.Printf("Missing required field: unitType")
 		return appsync.NewErrorResponse("VALIDATION_ERROR", "UnitType is required", ""), nil
 	}
+	if input.ExpectedVersion == nil {
+		log.Printf("Missing required field: expectedVersion")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "ExpectedVersion is required", ""), nil
+	}
 	// Note: suggestedVin is not required for updates as they can be partial
 
+	// Only the fields present in the request are changed; null clears optional fields
+	patch, err := unitPatchFromArguments(event.Arguments)
+	if err != nil {
+		log.Printf("Invalid update fields: %v", err)
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "Invalid update", err.Error()), nil
+	}
+	if patch.IsEmpty() {
+		log.Printf("No fields to update for unit ID: %s", input.ID)
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "No fields to update", ""), nil
+	}
+
 	// Check if the unit exists before attempting to update
 	existingUnit, err := h.repo.GetByKey(ctx, input.AccountID, input.ID, input.UnitType)
 	if err != nil {
@@ -157,57 +459,24 @@ func (h *UnitHandlers) HandleUpdate(ctx context.Context, event *appsync.AppSyncE
 		log.Printf("Unit not found with ID: %s, type: %s for account: %s", input.ID, input.UnitType, input.AccountID)
 		return appsync.NewErrorResponse("NOT_FOUND", "Unit not found", ""), nil
 	}
-
-	// Merge the update data with the existing unit (partial update)
-	updatedUnit := *existingUnit // Copy existing unit
-
-	// Apply only the fields that were provided in the input
-	if input.SuggestedVin != "" {
-		updatedUnit.SuggestedVin = input.SuggestedVin
-	}
-	if input.ErrorCode != "" {
-		updatedUnit.ErrorCode = input.ErrorCode
-	}
-	if input.PossibleValues != "" {
-		updatedUnit.PossibleValues = input.PossibleValues
-	}
-	if input.ErrorText != "" {
-		updatedUnit.ErrorText = input.ErrorText
-	}
-	if input.VehicleDescriptor != "" {
-		updatedUnit.VehicleDescriptor = input.VehicleDescriptor
-	}
-	if input.Note != "" {
-		updatedUnit.Note = input.Note
-	}
-	if input.Make != "" {
-		updatedUnit.Make = input.Make
-	}
-	if input.ManufacturerName != "" {
-		updatedUnit.ManufacturerName = input.ManufacturerName
-	}
-	if input.Model != "" {
-		updatedUnit.Model = input.Model
-	}
-	if input.ModelYear != "" {
-		updatedUnit.ModelYear = input.ModelYear
-	}
-	if input.Series != "" {
-		updatedUnit.Series = input.Series
-	}
-	if input.VehicleType != "" {
-		updatedUnit.VehicleType = input.VehicleType
+	if existingUnit.Version != *input.ExpectedVersion {
+		log.Printf("Version conflict updating unit ID: %s (expected %d, current %d)", input.ID, *input.ExpectedVersion, existingUnit.Version)
+		return conflictResponse(&repository.VersionConflictError{ExpectedVersion: *input.ExpectedVersion, CurrentVersion: existingUnit.Version}), nil
 	}
-	// Add more fields as needed for the update...
 
-	// Ensure the unit key matches the input
-	updatedUnit.ID = input.ID
-	updatedUnit.AccountID = input.AccountID
-	updatedUnit.UnitType = input.UnitType
-
-	// Attempt to update the unit
-	err = h.repo.Update(ctx, &updatedUnit)
+	// Apply the patch with a single conditional UpdateItem
+	updatedUnit, err := h.repo.Patch(ctx, input.AccountID, input.ID, input.UnitType, *input.ExpectedVersion, patch)
 	if err != nil {
+		var conflict *repository.VersionConflictError
+		if errors.As(err, &conflict) {
+			log.Printf("Version conflict updating unit ID: %s: %v", input.ID, err)
+			return conflictResponse(conflict), nil
+		}
+		var duplicateVin *repository.DuplicateVinError
+		if errors.As(err, &duplicateVin) {
+			log.Printf("Duplicate VIN updating unit ID: %s: %v", input.ID, err)
+			return appsync.NewErrorResponse("DUPLICATE_VIN", "A unit with this VIN already exists in the account", err.Error()), nil
+		}
 		log.Printf("Error updating unit: %v", err)
 		return appsync.NewErrorResponse("UPDATE_FAILED", "Failed to update unit", err.Error()), nil
 	}
@@ -216,6 +485,44 @@ func (h *UnitHandlers) HandleUpdate(ctx context.Context, event *appsync.AppSyncE
 	return appsync.NewSuccessResponse(updatedUnit, "Unit updated successfully"), nil
 }
 
+// updateControlFields are update arguments that identify the unit rather than change it
+var updateControlFields = []string{"id", "accountId", "unitType", "expectedVersion", "data"}
+
+// unitPatchFromArguments builds a unit patch from the keys present in the raw update arguments
+func unitPatchFromArguments(arguments json.RawMessage) (*models.UnitPatch, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(arguments, &fields); err != nil {
+		return nil, fmt.Errorf("failed to parse update arguments: %w", err)
+	}
+	for _, name := range updateControlFields {
+		delete(fields, name)
+	}
+	return models.NewUnitPatch(fields)
+}
+
+// vinValidationResponse reports every issue found with a VIN so that clients can
+// highlight the offending fields
+func vinValidationResponse(err error) *appsync.Response {
+	response := appsync.NewErrorResponse("VALIDATION_ERROR", "Invalid VIN", err.Error())
+	var invalid *vin.ValidationError
+	if errors.As(err, &invalid) {
+		response.Data = map[string]interface{}{
+			"vinErrors": invalid.Issues,
+		}
+	}
+	return response
+}
+
+// conflictResponse reports a version conflict along with the unit's current version
+// so that clients can re-read and retry or merge
+func conflictResponse(conflict *repository.VersionConflictError) *appsync.Response {
+	response := appsync.NewErrorResponse("CONFLICT", "Unit was modified by another request", conflict.Error())
+	response.Data = map[string]interface{}{
+		"currentVersion": conflict.CurrentVersion,
+	}
+	return response
+}
+
 // HandleDelete handles unit deletion requests
 func (h *UnitHandlers) HandleDelete(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
 	log.Printf("HandleDelete called with event: %+v", event)
@@ -246,10 +553,26 @@ func (h *UnitHandlers) HandleDelete(ctx context.Context, event *appsync.AppSyncE
 		log.Printf("Missing required field: unitType")
 		return appsync.NewErrorResponse("VALIDATION_ERROR", "UnitType is required", ""), nil
 	}
+	if input.ExpectedVersion == nil {
+		log.Printf("Missing required field: expectedVersion")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "ExpectedVersion is required", ""), nil
+	}
 
 	// Attempt to delete the unit
-	err = h.repo.Delete(ctx, input.AccountID, input.ID, input.UnitType)
+	err = h.repo.Delete(ctx, input.AccountID, input.ID, input.UnitType, *input.ExpectedVersion, event.Identity.Principal())
 	if err != nil {
+		var conflict *repository.VersionConflictError
+		switch {
+		case errors.Is(err, repository.ErrUnitNotFound):
+			log.Printf("Unit not found with ID: %s, type: %s for account: %s", input.ID, input.UnitType, input.AccountID)
+			return appsync.NewErrorResponse("NOT_FOUND", "Unit not found", ""), nil
+		case errors.Is(err, repository.ErrUnitAlreadyDeleted):
+			log.Printf("Unit already deleted with ID: %s, type: %s for account: %s", input.ID, input.UnitType, input.AccountID)
+			return appsync.NewErrorResponse("ALREADY_DELETED", "Unit is already deleted", ""), nil
+		case errors.As(err, &conflict):
+			log.Printf("Version conflict deleting unit ID: %s: %v", input.ID, err)
+			return conflictResponse(conflict), nil
+		}
 		log.Printf("Error deleting unit: %v", err)
 		return appsync.NewErrorResponse("DELETE_FAILED", "Failed to delete unit", err.Error()), nil
 	}
@@ -265,6 +588,127 @@ func (h *UnitHandlers) HandleDelete(ctx context.Context, event *appsync.AppSyncE
 	return appsync.NewSuccessResponse(response, "Unit deleted successfully"), nil
 }
 
+// HandleRestore handles requests to undelete a soft deleted unit
+func (h *UnitHandlers) HandleRestore(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("HandleRestore called with event: %+v", event)
+
+	// Parse arguments
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error()), nil
+	}
+
+	input, ok := args.(appsync.RestoreUnitInput)
+	if !ok {
+		log.Printf("Invalid input type for restore operation")
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for restore operation", ""), nil
+	}
+
+	// Validate required fields
+	if input.ID == "" {
+		log.Printf("Missing required field: id")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "ID is required", ""), nil
+	}
+	if input.AccountID == "" {
+		log.Printf("Missing required field: accountId")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "AccountID is required", ""), nil
+	}
+	if input.UnitType == "" {
+		log.Printf("Missing required field: unitType")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "UnitType is required", ""), nil
+	}
+	if input.ExpectedVersion == nil {
+		log.Printf("Missing required field: expectedVersion")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "ExpectedVersion is required", ""), nil
+	}
+
+	// Attempt to restore the unit
+	unit, err := h.repo.Restore(ctx, input.AccountID, input.ID, input.UnitType, *input.ExpectedVersion)
+	if err != nil {
+		var conflict *repository.VersionConflictError
+		switch {
+		case errors.Is(err, repository.ErrUnitNotFound):
+			log.Printf("Unit not found with ID: %s, type: %s for account: %s", input.ID, input.UnitType, input.AccountID)
+			return appsync.NewErrorResponse("NOT_FOUND", "Unit not found", ""), nil
+		case errors.Is(err, repository.ErrUnitNotDeleted):
+			log.Printf("Unit is not deleted with ID: %s, type: %s for account: %s", input.ID, input.UnitType, input.AccountID)
+			return appsync.NewErrorResponse("NOT_DELETED", "Unit is not deleted", ""), nil
+		case errors.As(err, &conflict):
+			log.Printf("Version conflict restoring unit ID: %s: %v", input.ID, err)
+			return conflictResponse(conflict), nil
+		}
+		log.Printf("Error restoring unit: %v", err)
+		return appsync.NewErrorResponse("RESTORE_FAILED", "Failed to restore unit", err.Error()), nil
+	}
+
+	log.Printf("Unit restored successfully with ID: %s, type: %s for account: %s", unit.ID, unit.UnitType, unit.AccountID)
+	return appsync.NewSuccessResponse(unit, "Unit restored successfully"), nil
+}
+
+// HandlePurge handles admin requests to permanently remove a soft deleted unit
+func (h *UnitHandlers) HandlePurge(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("HandlePurge called with event: %+v", event)
+
+	// Purging cannot be undone, so it is reserved for administrators
+	if !event.Identity.InGroup(h.adminGroup) {
+		log.Printf("Caller %q is not in the %s group", event.Identity.Principal(), h.adminGroup)
+		return appsync.NewErrorResponse("FORBIDDEN", "Purging units requires administrator access", ""), nil
+	}
+
+	// Parse arguments
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error()), nil
+	}
+
+	input, ok := args.(appsync.PurgeUnitInput)
+	if !ok {
+		log.Printf("Invalid input type for purge operation")
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for purge operation", ""), nil
+	}
+
+	// Validate required fields
+	if input.ID == "" {
+		log.Printf("Missing required field: id")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "ID is required", ""), nil
+	}
+	if input.AccountID == "" {
+		log.Printf("Missing required field: accountId")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "AccountID is required", ""), nil
+	}
+	if input.UnitType == "" {
+		log.Printf("Missing required field: unitType")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "UnitType is required", ""), nil
+	}
+
+	// Attempt to purge the unit
+	err = h.repo.Purge(ctx, input.AccountID, input.ID, input.UnitType)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrUnitNotFound):
+			log.Printf("Unit not found with ID: %s, type: %s for account: %s", input.ID, input.UnitType, input.AccountID)
+			return appsync.NewErrorResponse("NOT_FOUND", "Unit not found", ""), nil
+		case errors.Is(err, repository.ErrUnitNotDeleted):
+			log.Printf("Unit is not deleted with ID: %s, type: %s for account: %s", input.ID, input.UnitType, input.AccountID)
+			return appsync.NewErrorResponse("NOT_DELETED", "Only deleted units can be purged", ""), nil
+		}
+		log.Printf("Error purging unit: %v", err)
+		return appsync.NewErrorResponse("PURGE_FAILED", "Failed to purge unit", err.Error()), nil
+	}
+
+	response := map[string]interface{}{
+		"id":        input.ID,
+		"accountId": input.AccountID,
+		"unitType":  input.UnitType,
+		"purged":    true,
+	}
+
+	log.Printf("Unit purged by %s with ID: %s, type: %s for account: %s", event.Identity.Principal(), input.ID, input.UnitType, input.AccountID)
+	return appsync.NewSuccessResponse(response, "Unit purged successfully"), nil
+}
+
 // HandleList handles unit listing requests
 func (h *UnitHandlers) HandleList(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
 	log.Printf("HandleList called with event: %+v", event)
@@ -287,10 +731,17 @@ func (h *UnitHandlers) HandleList(ctx context.Context, event *appsync.AppSyncEve
 		log.Printf("Missing required field: accountId")
 		return appsync.NewErrorResponse("VALIDATION_ERROR", "AccountID is required", ""), nil
 	}
+	if resp := validateListFilter(&input); resp != nil {
+		return resp, nil
+	}
 
 	// Retrieve the list of units
 	result, err := h.repo.List(ctx, &input)
 	if err != nil {
+		if errors.Is(err, repository.ErrInvalidPaginationToken) {
+			log.Printf("Rejected pagination token: %v", err)
+			return appsync.NewErrorResponse("VALIDATION_ERROR", "Invalid nextToken", err.Error()), nil
+		}
 		log.Printf("Error listing units: %v", err)
 		return appsync.NewErrorResponse("LIST_FAILED", "Failed to list units", err.Error()), nil
 	}
@@ -299,6 +750,47 @@ func (h *UnitHandlers) HandleList(ctx context.Context, event *appsync.AppSyncEve
 	return appsync.NewSuccessResponse(result, fmt.Sprintf("Retrieved %d units", result.Count)), nil
 }
 
+// HandleListDeleted handles requests to list the soft deleted units of an account
+func (h *UnitHandlers) HandleListDeleted(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("HandleListDeleted called with event: %+v", event)
+
+	// Parse arguments
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error()), nil
+	}
+
+	input, ok := args.(appsync.ListUnitsInput)
+	if !ok {
+		log.Printf("Invalid input type for list deleted operation")
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for list deleted operation", ""), nil
+	}
+
+	// Validate required fields
+	if input.AccountID == "" {
+		log.Printf("Missing required field: accountId")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "AccountID is required", ""), nil
+	}
+	if resp := validateListFilter(&input); resp != nil {
+		return resp, nil
+	}
+
+	// Retrieve the list of deleted units
+	result, err := h.repo.ListDeleted(ctx, &input)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidPaginationToken) {
+			log.Printf("Rejected pagination token: %v", err)
+			return appsync.NewErrorResponse("VALIDATION_ERROR", "Invalid nextToken", err.Error()), nil
+		}
+		log.Printf("Error listing deleted units: %v", err)
+		return appsync.NewErrorResponse("LIST_FAILED", "Failed to list deleted units", err.Error()), nil
+	}
+
+	log.Printf("Deleted units listed successfully: %d items", result.Count)
+	return appsync.NewSuccessResponse(result, fmt.Sprintf("Retrieved %d deleted units", result.Count)), nil
+}
+
 // DumpEvent logs the complete event for debugging purposes
 func (h *UnitHandlers) DumpEvent(ctx context.Context, event *appsync.AppSyncEvent) {
 	log.Printf("=== EVENT DUMP START ===")
@@ -3,25 +3,29 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 
+	"github.com/steverhoton/unt-units-svc/internal/blobstore"
+	"github.com/steverhoton/unt-units-svc/internal/exporter"
 	"github.com/steverhoton/unt-units-svc/internal/models"
 	"github.com/steverhoton/unt-units-svc/internal/repository"
 	"github.com/steverhoton/unt-units-svc/pkg/appsync"
 )
 
-func TestUnitHandlers_HandleCreate_Success_Dynamic(t *testing.T) {
-	mockRepo := &repository.MockUnitRepository{}
-	handlers := NewUnitHandlers(mockRepo)
+func TestDynamicUnitHandlers_HandleCreate_Success_Dynamic(t *testing.T) {
+	mockRepo := &repository.MockDynamicUnitRepository{}
+	handlers := NewDynamicUnitHandlers(mockRepo)
 
 	input := appsync.CreateUnitInput{
 		AccountID: "test-account-123",
 		UnitType:  "commercialVehicleType",
-		Data: map[string]interface{}{
+		Data:      map[string]interface{}{
 			// Only include data that is actually needed for the test
 			// The accountId and id will be injected automatically by ValidateAndSetData
 		},
@@ -52,9 +56,9 @@ func TestUnitHandlers_HandleCreate_Success_Dynamic(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
-func TestUnitHandlers_HandleCreate_ValidationError_Dynamic(t *testing.T) {
-	mockRepo := &repository.MockUnitRepository{}
-	handlers := NewUnitHandlers(mockRepo)
+func TestDynamicUnitHandlers_HandleCreate_ValidationError_Dynamic(t *testing.T) {
+	mockRepo := &repository.MockDynamicUnitRepository{}
+	handlers := NewDynamicUnitHandlers(mockRepo)
 
 	tests := []struct {
 		name          string
@@ -66,7 +70,7 @@ func TestUnitHandlers_HandleCreate_ValidationError_Dynamic(t *testing.T) {
 			input: appsync.CreateUnitInput{
 				AccountID: "", // Missing
 				UnitType:  "commercialVehicleType",
-				Data: map[string]interface{}{
+				Data:      map[string]interface{}{
 					// Empty data for validation tests
 				},
 			},
@@ -77,7 +81,7 @@ func TestUnitHandlers_HandleCreate_ValidationError_Dynamic(t *testing.T) {
 			input: appsync.CreateUnitInput{
 				AccountID: "test-account-123",
 				UnitType:  "", // Missing
-				Data: map[string]interface{}{
+				Data:      map[string]interface{}{
 					// Empty data for validation tests
 				},
 			},
@@ -88,7 +92,7 @@ func TestUnitHandlers_HandleCreate_ValidationError_Dynamic(t *testing.T) {
 			input: appsync.CreateUnitInput{
 				AccountID: "test-account-123",
 				UnitType:  "invalidType",
-				Data: map[string]interface{}{
+				Data:      map[string]interface{}{
 					// Empty data for validation tests
 				},
 			},
@@ -124,9 +128,9 @@ func TestUnitHandlers_HandleCreate_ValidationError_Dynamic(t *testing.T) {
 	}
 }
 
-func TestUnitHandlers_HandleRead_Success_Dynamic(t *testing.T) {
-	mockRepo := &repository.MockUnitRepository{}
-	handlers := NewUnitHandlers(mockRepo)
+func TestDynamicUnitHandlers_HandleRead_Success_Dynamic(t *testing.T) {
+	mockRepo := &repository.MockDynamicUnitRepository{}
+	handlers := NewDynamicUnitHandlers(mockRepo)
 
 	// Create a dynamic unit for testing
 	unit, err := models.NewDynamicUnit("commercialVehicleType")
@@ -155,7 +159,7 @@ func TestUnitHandlers_HandleRead_Success_Dynamic(t *testing.T) {
 	}
 
 	// Mock expectations
-	mockRepo.On("GetByID", mock.Anything, "test-account-123", "commercialVehicleType", unitID).Return(unit, nil)
+	mockRepo.On("GetByKey", mock.Anything, "test-account-123", unitID, "commercialVehicleType").Return(unit, nil)
 
 	// Execute
 	response, err := handlers.HandleRead(context.Background(), event)
@@ -170,9 +174,9 @@ func TestUnitHandlers_HandleRead_Success_Dynamic(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
-func TestUnitHandlers_HandleRead_ValidationError_Dynamic(t *testing.T) {
-	mockRepo := &repository.MockUnitRepository{}
-	handlers := NewUnitHandlers(mockRepo)
+func TestDynamicUnitHandlers_HandleRead_ValidationError_Dynamic(t *testing.T) {
+	mockRepo := &repository.MockDynamicUnitRepository{}
+	handlers := NewDynamicUnitHandlers(mockRepo)
 
 	tests := []struct {
 		name          string
@@ -231,21 +235,23 @@ func TestUnitHandlers_HandleRead_ValidationError_Dynamic(t *testing.T) {
 			assert.Contains(t, response.Error.Message, tt.expectedError)
 
 			// No repository calls should be made
-			mockRepo.AssertNotCalled(t, "GetByID")
+			mockRepo.AssertNotCalled(t, "GetByKey")
 		})
 	}
 }
 
-func TestUnitHandlers_HandleUpdate_Success_Dynamic(t *testing.T) {
-	mockRepo := &repository.MockUnitRepository{}
-	handlers := NewUnitHandlers(mockRepo)
+func TestDynamicUnitHandlers_HandleUpdate_Success_Dynamic(t *testing.T) {
+	mockRepo := &repository.MockDynamicUnitRepository{}
+	handlers := NewDynamicUnitHandlers(mockRepo)
 
 	unitID := "550e8400-e29b-41d4-a716-446655440001" // Valid UUID
+	version := int64(2)
 	input := appsync.UpdateUnitInput{
-		ID:        unitID,
-		AccountID: "test-account-123",
-		UnitType:  "commercialVehicleType",
-		Data: map[string]interface{}{
+		ID:              unitID,
+		AccountID:       "test-account-123",
+		UnitType:        "commercialVehicleType",
+		ExpectedVersion: &version,
+		Data:            map[string]interface{}{
 			// Minimal data for update test
 		},
 	}
@@ -258,16 +264,19 @@ func TestUnitHandlers_HandleUpdate_Success_Dynamic(t *testing.T) {
 		Arguments: argsJSON,
 	}
 
-	// Existing unit to be returned by GetByID
+	// Existing unit to be returned by GetByKey
 	existingUnit, err := models.NewDynamicUnit("commercialVehicleType")
 	require.NoError(t, err)
 	existingUnit.ID = unitID
 	existingUnit.AccountID = "test-account-123"
 	existingUnit.UnitType = "commercialVehicleType"
+	existingUnit.Version = 2
 
 	// Mock expectations
-	mockRepo.On("GetByID", mock.Anything, "test-account-123", "commercialVehicleType", unitID).Return(existingUnit, nil)
-	mockRepo.On("Update", mock.Anything, mock.AnythingOfType("*models.DynamicUnit")).Return(nil)
+	mockRepo.On("GetByKey", mock.Anything, "test-account-123", unitID, "commercialVehicleType").Return(existingUnit, nil)
+	mockRepo.On("Update", mock.Anything, mock.MatchedBy(func(unit *models.DynamicUnit) bool {
+		return unit.Version == 2
+	})).Return(nil)
 
 	// Execute
 	response, err := handlers.HandleUpdate(context.Background(), event)
@@ -282,15 +291,17 @@ func TestUnitHandlers_HandleUpdate_Success_Dynamic(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
-func TestUnitHandlers_HandleDelete_Success_Dynamic(t *testing.T) {
-	mockRepo := &repository.MockUnitRepository{}
-	handlers := NewUnitHandlers(mockRepo)
+func TestDynamicUnitHandlers_HandleDelete_Success_Dynamic(t *testing.T) {
+	mockRepo := &repository.MockDynamicUnitRepository{}
+	handlers := NewDynamicUnitHandlers(mockRepo)
 
 	unitID := "550e8400-e29b-41d4-a716-446655440002" // Valid UUID
+	version := int64(4)
 	input := appsync.DeleteUnitInput{
-		ID:        unitID,
-		AccountID: "test-account-123",
-		UnitType:  "commercialVehicleType",
+		ID:              unitID,
+		AccountID:       "test-account-123",
+		UnitType:        "commercialVehicleType",
+		ExpectedVersion: &version,
 	}
 	argsJSON, err := json.Marshal(input)
 	require.NoError(t, err)
@@ -301,8 +312,8 @@ func TestUnitHandlers_HandleDelete_Success_Dynamic(t *testing.T) {
 		Arguments: argsJSON,
 	}
 
-	// Mock expectations - only Delete is called, not GetByID
-	mockRepo.On("Delete", mock.Anything, "test-account-123", "commercialVehicleType", unitID).Return(nil)
+	// Mock expectations - only Delete is called, not GetByKey
+	mockRepo.On("Delete", mock.Anything, "test-account-123", unitID, "commercialVehicleType", int64(4)).Return(nil)
 
 	// Execute
 	response, err := handlers.HandleDelete(context.Background(), event)
@@ -324,9 +335,92 @@ func TestUnitHandlers_HandleDelete_Success_Dynamic(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
-func TestUnitHandlers_HandleList_Success_Dynamic(t *testing.T) {
-	mockRepo := &repository.MockUnitRepository{}
-	handlers := NewUnitHandlers(mockRepo)
+func TestDynamicUnitHandlers_HandleDelete_Failures(t *testing.T) {
+	unitID := "550e8400-e29b-41d4-a716-446655440009"
+	version := int64(4)
+
+	tests := []struct {
+		name     string
+		err      error
+		wantCode string
+	}{
+		{name: "missing unit", err: fmt.Errorf("%w: unit with id %s", repository.ErrUnitNotFound, unitID), wantCode: "NOT_FOUND"},
+		{name: "already deleted", err: fmt.Errorf("%w: unit with id %s", repository.ErrUnitAlreadyDeleted, unitID), wantCode: "ALREADY_DELETED"},
+		{name: "concurrent update", err: &repository.VersionConflictError{ExpectedVersion: 4, CurrentVersion: 5}, wantCode: "CONFLICT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &repository.MockDynamicUnitRepository{}
+			handlers := NewDynamicUnitHandlers(mockRepo)
+
+			argsJSON, err := json.Marshal(appsync.DeleteUnitInput{
+				ID:              unitID,
+				AccountID:       "test-account-123",
+				UnitType:        "commercialVehicleType",
+				ExpectedVersion: &version,
+			})
+			require.NoError(t, err)
+
+			mockRepo.On("Delete", mock.Anything, "test-account-123", unitID, "commercialVehicleType", int64(4)).Return(tt.err)
+
+			response, err := handlers.HandleDelete(context.Background(), &appsync.AppSyncEvent{
+				TypeName:  "Mutation",
+				FieldName: "deleteUnit",
+				Arguments: argsJSON,
+			})
+
+			require.NoError(t, err)
+			require.NotNil(t, response)
+			assert.False(t, response.Success)
+			assert.Equal(t, tt.wantCode, response.Error.Code)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestDynamicUnitHandlers_HandleRestore_Dynamic(t *testing.T) {
+	mockRepo := &repository.MockDynamicUnitRepository{}
+	handlers := NewDynamicUnitHandlers(mockRepo)
+
+	unitID := "550e8400-e29b-41d4-a716-446655440002"
+	version := int64(5)
+	argsJSON, err := json.Marshal(appsync.RestoreUnitInput{
+		ID:              unitID,
+		AccountID:       "test-account-123",
+		UnitType:        "commercialVehicleType",
+		ExpectedVersion: &version,
+	})
+	require.NoError(t, err)
+
+	event := &appsync.AppSyncEvent{
+		TypeName:  "Mutation",
+		FieldName: "restoreUnit",
+		Arguments: argsJSON,
+	}
+
+	restored := &models.DynamicUnit{ID: unitID, AccountID: "test-account-123", UnitType: "commercialVehicleType"}
+	mockRepo.On("Restore", mock.Anything, "test-account-123", unitID, "commercialVehicleType", int64(5)).Return(restored, nil).Once()
+	mockRepo.On("Restore", mock.Anything, "test-account-123", unitID, "commercialVehicleType", int64(5)).
+		Return(nil, fmt.Errorf("%w: unit with id %s", repository.ErrUnitNotDeleted, unitID)).Once()
+
+	response, err := handlers.HandleRestore(context.Background(), event)
+	require.NoError(t, err)
+	assert.True(t, response.Success)
+	assert.Equal(t, restored, response.Data)
+
+	// Restoring again finds a live unit
+	response, err = handlers.HandleRestore(context.Background(), event)
+	require.NoError(t, err)
+	assert.False(t, response.Success)
+	assert.Equal(t, "NOT_DELETED", response.Error.Code)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestDynamicUnitHandlers_HandleList_Success_Dynamic(t *testing.T) {
+	mockRepo := &repository.MockDynamicUnitRepository{}
+	handlers := NewDynamicUnitHandlers(mockRepo)
 
 	// Create dynamic units for testing
 	unit1, err := models.NewDynamicUnit("commercialVehicleType")
@@ -349,21 +443,14 @@ func TestUnitHandlers_HandleList_Success_Dynamic(t *testing.T) {
 		"accountId": "test-account-123",
 	}
 
-	units := []*models.DynamicUnit{unit1, unit2}
+	units := []models.DynamicUnit{*unit1, *unit2}
 
-	listResponse := &appsync.ListUnitsResponse{
-		Items:     make([]map[string]interface{}, len(units)),
+	listResponse := &appsync.ListDynamicUnitsResponse{
+		Items:     units,
 		Count:     len(units),
 		NextToken: nil,
 	}
 
-	// Convert units to maps for response
-	for i, unit := range units {
-		unitMap, err := unit.ToMap()
-		require.NoError(t, err)
-		listResponse.Items[i] = unitMap
-	}
-
 	unitType := "commercialVehicleType"
 	limit := 25
 	input := appsync.ListUnitsInput{
@@ -404,7 +491,7 @@ func TestUnitHandlers_DumpEvent_Dynamic(t *testing.T) {
 	input := appsync.CreateUnitInput{
 		AccountID: "test-account-123",
 		UnitType:  "commercialVehicleType",
-		Data: map[string]interface{}{
+		Data:      map[string]interface{}{
 			// Minimal data for DumpEvent test
 		},
 	}
@@ -440,9 +527,9 @@ func TestUnitHandlers_DumpEvent_Dynamic(t *testing.T) {
 	})
 }
 
-func TestUnitHandlers_HandleCreate_SchemaValidationError_Dynamic(t *testing.T) {
-	mockRepo := &repository.MockUnitRepository{}
-	handlers := NewUnitHandlers(mockRepo)
+func TestDynamicUnitHandlers_HandleCreate_SchemaValidationError_Dynamic(t *testing.T) {
+	mockRepo := &repository.MockDynamicUnitRepository{}
+	handlers := NewDynamicUnitHandlers(mockRepo)
 
 	input := appsync.CreateUnitInput{
 		AccountID: "test-account-123",
@@ -473,4 +560,242 @@ func TestUnitHandlers_HandleCreate_SchemaValidationError_Dynamic(t *testing.T) {
 
 	// No repository calls should be made for validation errors
 	mockRepo.AssertNotCalled(t, "Create")
-}
\ No newline at end of file
+}
+
+func TestDynamicUnitHandlers_HandleUpdate_SchemaValidationError(t *testing.T) {
+	mockRepo := &repository.MockDynamicUnitRepository{}
+	handlers := NewDynamicUnitHandlers(mockRepo)
+
+	unitID := "550e8400-e29b-41d4-a716-446655440005"
+	version := int64(1)
+	input := appsync.UpdateUnitInput{
+		ID:              unitID,
+		AccountID:       "test-account-123",
+		UnitType:        "commercialVehicleType",
+		ExpectedVersion: &version,
+		Data: map[string]interface{}{
+			"invalidField": "not in schema",
+		},
+	}
+	argsJSON, err := json.Marshal(input)
+	require.NoError(t, err)
+
+	event := &appsync.AppSyncEvent{
+		TypeName:  "Mutation",
+		FieldName: "updateUnit",
+		Arguments: argsJSON,
+	}
+
+	existingUnit, err := models.NewDynamicUnit("commercialVehicleType")
+	require.NoError(t, err)
+	existingUnit.ID = unitID
+	existingUnit.AccountID = "test-account-123"
+	existingUnit.Data = map[string]interface{}{"make": "Freightliner"}
+	existingUnit.Version = 1
+
+	mockRepo.On("GetByKey", mock.Anything, "test-account-123", unitID, "commercialVehicleType").Return(existingUnit, nil)
+
+	// Execute
+	response, err := handlers.HandleUpdate(context.Background(), event)
+
+	// Assertions
+	require.NoError(t, err)
+	require.NotNil(t, response)
+	assert.False(t, response.Success)
+	assert.Equal(t, "VALIDATION_ERROR", response.Error.Code)
+	assert.Contains(t, response.Error.Details, "invalidField")
+
+	mockRepo.AssertNotCalled(t, "Update")
+}
+
+func TestDynamicUnitHandlers_HandleUpdate_VersionConflict(t *testing.T) {
+	unitID := "550e8400-e29b-41d4-a716-446655440007"
+	version := int64(3)
+
+	tests := []struct {
+		name          string
+		storedVersion int64
+		updateErr     error
+	}{
+		{name: "stale read", storedVersion: 4},
+		{name: "concurrent write", storedVersion: 3, updateErr: &repository.VersionConflictError{ExpectedVersion: 3, CurrentVersion: 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &repository.MockDynamicUnitRepository{}
+			handlers := NewDynamicUnitHandlers(mockRepo)
+
+			argsJSON, err := json.Marshal(appsync.UpdateUnitInput{
+				ID:              unitID,
+				AccountID:       "test-account-123",
+				UnitType:        "commercialVehicleType",
+				ExpectedVersion: &version,
+			})
+			require.NoError(t, err)
+
+			existingUnit, err := models.NewDynamicUnit("commercialVehicleType")
+			require.NoError(t, err)
+			existingUnit.ID = unitID
+			existingUnit.AccountID = "test-account-123"
+			existingUnit.Version = tt.storedVersion
+
+			mockRepo.On("GetByKey", mock.Anything, "test-account-123", unitID, "commercialVehicleType").Return(existingUnit, nil)
+			if tt.updateErr != nil {
+				mockRepo.On("Update", mock.Anything, mock.AnythingOfType("*models.DynamicUnit")).Return(tt.updateErr)
+			}
+
+			response, err := handlers.HandleUpdate(context.Background(), &appsync.AppSyncEvent{
+				TypeName:  "Mutation",
+				FieldName: "updateUnit",
+				Arguments: argsJSON,
+			})
+
+			require.NoError(t, err)
+			require.NotNil(t, response)
+			assert.False(t, response.Success)
+			assert.Equal(t, "CONFLICT", response.Error.Code)
+			assert.Equal(t, map[string]interface{}{"currentVersion": int64(4)}, response.Data)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestDynamicUnitHandlers_HandleUpdate_MissingExpectedVersion(t *testing.T) {
+	mockRepo := &repository.MockDynamicUnitRepository{}
+	handlers := NewDynamicUnitHandlers(mockRepo)
+
+	argsJSON, err := json.Marshal(appsync.UpdateUnitInput{
+		ID:        "550e8400-e29b-41d4-a716-446655440008",
+		AccountID: "test-account-123",
+		UnitType:  "commercialVehicleType",
+	})
+	require.NoError(t, err)
+
+	response, err := handlers.HandleUpdate(context.Background(), &appsync.AppSyncEvent{
+		TypeName:  "Mutation",
+		FieldName: "updateUnit",
+		Arguments: argsJSON,
+	})
+
+	require.NoError(t, err)
+	require.NotNil(t, response)
+	assert.False(t, response.Success)
+	assert.Equal(t, "VALIDATION_ERROR", response.Error.Code)
+	mockRepo.AssertNotCalled(t, "GetByKey")
+}
+
+func TestDynamicUnitHandlers_HandleRead_NotFound(t *testing.T) {
+	mockRepo := &repository.MockDynamicUnitRepository{}
+	handlers := NewDynamicUnitHandlers(mockRepo)
+
+	unitID := "550e8400-e29b-41d4-a716-446655440006"
+	argsJSON, err := json.Marshal(appsync.GetUnitInput{
+		ID:        unitID,
+		AccountID: "test-account-123",
+		UnitType:  "commercialVehicleType",
+	})
+	require.NoError(t, err)
+
+	event := &appsync.AppSyncEvent{
+		TypeName:  "Query",
+		FieldName: "getUnit",
+		Arguments: argsJSON,
+	}
+
+	mockRepo.On("GetByKey", mock.Anything, "test-account-123", unitID, "commercialVehicleType").Return(nil, nil)
+
+	response, err := handlers.HandleRead(context.Background(), event)
+
+	require.NoError(t, err)
+	require.NotNil(t, response)
+	assert.False(t, response.Success)
+	assert.Equal(t, "NOT_FOUND", response.Error.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestDynamicUnitHandlers_HandleExport(t *testing.T) {
+	mockRepo := &repository.MockDynamicUnitRepository{}
+	store := blobstore.NewMemoryStore()
+	handlers := NewDynamicUnitHandlers(mockRepo).WithExportStore(store, 0)
+
+	// Schema-driven units are exported one unit type at a time
+	response, err := handlers.HandleExport(context.Background(), &appsync.AppSyncEvent{
+		FieldName: "exportUnits",
+		Arguments: json.RawMessage(`{"accountId":"a-1","format":"NDJSON"}`),
+	})
+	require.NoError(t, err)
+	require.NotNil(t, response.Error)
+	assert.Equal(t, "UnitType is required", response.Error.Message)
+
+	mockRepo.On("Export", mock.Anything, repository.ExportOptions{AccountID: "a-1", UnitType: "trailerType", Format: exporter.FormatNDJSON}, mock.Anything).
+		Return(&repository.ExportResult{Count: 0}, nil)
+	response, err = handlers.HandleExport(context.Background(), &appsync.AppSyncEvent{
+		FieldName: "exportUnits",
+		Arguments: json.RawMessage(`{"accountId":"a-1","unitType":"trailerType","format":"NDJSON"}`),
+	})
+	require.NoError(t, err)
+	require.True(t, response.Success)
+	assert.Equal(t, 1, store.Len())
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestDynamicUnitHandlers_HandleReadAsOf(t *testing.T) {
+	mockRepo := &repository.MockDynamicUnitRepository{}
+	handlers := NewDynamicUnitHandlers(mockRepo)
+
+	asOf := time.Date(2026, 2, 10, 8, 0, 0, 0, time.UTC)
+	unit := &models.DynamicUnit{ID: "unit-1", AccountID: "test-account-123", UnitType: "trailerType", Version: 2,
+		Data: map[string]interface{}{"paint": "red"}}
+	mockRepo.On("GetAsOf", mock.Anything, "test-account-123", "unit-1", "trailerType", mock.MatchedBy(asOf.Equal)).Return(unit, nil).Once()
+
+	event := &appsync.AppSyncEvent{
+		FieldName: "getUnit",
+		Arguments: json.RawMessage(`{"id":"unit-1","accountId":"test-account-123","unitType":"trailerType","asOf":"2026-02-10T09:00:00+01:00"}`),
+	}
+	response, err := handlers.HandleRead(context.Background(), event)
+	require.NoError(t, err)
+	require.True(t, response.Success)
+	assert.Equal(t, unit, response.Data)
+
+	mockRepo.On("GetAsOf", mock.Anything, "test-account-123", "unit-1", "trailerType", mock.Anything).Return(nil, nil).Once()
+	response, err = handlers.HandleRead(context.Background(), event)
+	require.NoError(t, err)
+	require.NotNil(t, response.Error)
+	assert.Equal(t, "NOT_FOUND", response.Error.Code)
+
+	mockRepo.On("GetAsOf", mock.Anything, "test-account-123", "unit-1", "trailerType", mock.Anything).Return(nil, repository.ErrHistoryIncomplete).Once()
+	response, err = handlers.HandleRead(context.Background(), event)
+	require.NoError(t, err)
+	require.NotNil(t, response.Error)
+	assert.Equal(t, "HISTORY_UNAVAILABLE", response.Error.Code)
+
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "GetByKey", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDynamicUnitHandlers_HandleGetHistory(t *testing.T) {
+	mockRepo := &repository.MockDynamicUnitRepository{}
+	handlers := NewDynamicUnitHandlers(mockRepo)
+
+	history := &appsync.UnitHistoryResponse{
+		Items: []models.UnitHistoryEntry{{UnitID: "unit-1", UnitType: "trailerType", Action: models.HistoryCreate, Version: 1}},
+		Count: 1,
+	}
+	mockRepo.On("GetHistory", mock.Anything, &appsync.GetUnitHistoryInput{
+		AccountID: "test-account-123", ID: "unit-1", UnitType: "trailerType",
+	}).Return(history, nil)
+
+	event := &appsync.AppSyncEvent{
+		TypeName:  "Query",
+		FieldName: "getUnitHistory",
+		Arguments: json.RawMessage(`{"accountId":"test-account-123","id":"unit-1","unitType":"trailerType"}`),
+	}
+	response, err := handlers.HandleGetHistory(context.Background(), event)
+	require.NoError(t, err)
+	require.True(t, response.Success)
+	assert.Equal(t, history, response.Data)
+
+	mockRepo.AssertExpectations(t)
+}
@@ -4,14 +4,23 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 
+	"github.com/steverhoton/unt-units-svc/internal/blobstore"
+	"github.com/steverhoton/unt-units-svc/internal/decoder"
+	"github.com/steverhoton/unt-units-svc/internal/exporter"
+	"github.com/steverhoton/unt-units-svc/internal/importer"
 	"github.com/steverhoton/unt-units-svc/internal/models"
 	"github.com/steverhoton/unt-units-svc/internal/repository"
+	"github.com/steverhoton/unt-units-svc/internal/vin"
 	"github.com/steverhoton/unt-units-svc/pkg/appsync"
 )
 
@@ -334,25 +343,17 @@ func TestUnitHandlers_HandleUpdate_Success(t *testing.T) {
 	mockRepo := &repository.MockUnitRepository{}
 	handlers := NewUnitHandlers(mockRepo)
 
-	unit := models.Unit{
-		SuggestedVin: "1HGBH41JXMN109186",
-		Make:         "Honda",
-		Model:        "Accord", // Updated model
-	}
-
-	input := appsync.UpdateUnitInput{
-		ID:        "test-unit-id",
-		AccountID: "test-account-123",
-		UnitType:  "commercialVehicleType",
-		Unit:      unit,
-	}
-	argsJSON, err := json.Marshal(input)
-	require.NoError(t, err)
-
 	event := &appsync.AppSyncEvent{
 		TypeName:  "Mutation",
 		FieldName: "updateUnit",
-		Arguments: argsJSON,
+		Arguments: updateArguments(t, map[string]interface{}{
+			"id":              "test-unit-id",
+			"accountId":       "test-account-123",
+			"unitType":        "commercialVehicleType",
+			"expectedVersion": 3,
+			"suggestedVin":    "1HGBH41JXMN109186",
+			"model":           "Accord", // Updated model
+		}),
 	}
 
 	// Existing unit to be returned by GetByKey
@@ -363,15 +364,22 @@ func TestUnitHandlers_HandleUpdate_Success(t *testing.T) {
 		SuggestedVin: "OLD_VIN_123",
 		Make:         "Honda",
 		Model:        "Civic",
+		Version:      3,
 	}
 
-	// Mock expectations
-	expectedUnit := unit
-	expectedUnit.ID = input.ID
-	expectedUnit.AccountID = input.AccountID
-	expectedUnit.UnitType = input.UnitType
+	// Only the provided fields are patched; make is left untouched
+	expectedPatch := &models.UnitPatch{
+		Set: map[string]interface{}{
+			"suggestedVin": "1HGBH41JXMN109186",
+			"vin":          "1HGBH41JXMN109186",
+			"model":        "Accord",
+		},
+	}
+	updatedUnit := *existingUnit
+	expectedPatch.ApplyTo(&updatedUnit)
+
 	mockRepo.On("GetByKey", mock.Anything, "test-account-123", "test-unit-id", "commercialVehicleType").Return(existingUnit, nil)
-	mockRepo.On("Update", mock.Anything, &expectedUnit).Return(nil)
+	mockRepo.On("Patch", mock.Anything, "test-account-123", "test-unit-id", "commercialVehicleType", int64(3), expectedPatch).Return(&updatedUnit, nil)
 
 	// Execute
 	response, err := handlers.HandleUpdate(context.Background(), event)
@@ -381,11 +389,112 @@ func TestUnitHandlers_HandleUpdate_Success(t *testing.T) {
 	require.NotNil(t, response)
 	assert.True(t, response.Success)
 	assert.Equal(t, "Unit updated successfully", response.Message)
+	assert.Equal(t, &updatedUnit, response.Data)
+	assert.Equal(t, "Honda", updatedUnit.Make)
 
 	// Verify mock expectations
 	mockRepo.AssertExpectations(t)
 }
 
+func TestUnitHandlers_HandleUpdate_ClearsAndSetsEveryField(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	handlers := NewUnitHandlers(mockRepo)
+
+	event := &appsync.AppSyncEvent{
+		TypeName:  "Mutation",
+		FieldName: "updateUnit",
+		Arguments: json.RawMessage(`{
+			"id": "test-unit-id",
+			"accountId": "test-account-123",
+			"unitType": "commercialVehicleType",
+			"expectedVersion": 3,
+			"note": "",
+			"trim": null,
+			"adaptiveDrivingBeam": "Standard",
+			"extendedAttributes": [{"attributeName": "fleet", "attributeValue": "north"}],
+			"acesAttributes": null
+		}`),
+	}
+
+	existingUnit := &models.Unit{ID: "test-unit-id", AccountID: "test-account-123", UnitType: "commercialVehicleType", Version: 3}
+	expectedPatch := &models.UnitPatch{
+		Set: map[string]interface{}{
+			"note":                "",
+			"adaptiveDrivingBeam": "Standard",
+			"extendedAttributes":  []models.ExtendedAttribute{{AttributeName: "fleet", AttributeValue: "north"}},
+		},
+		Remove: []string{"acesAttributes", "trim"},
+	}
+
+	mockRepo.On("GetByKey", mock.Anything, "test-account-123", "test-unit-id", "commercialVehicleType").Return(existingUnit, nil)
+	mockRepo.On("Patch", mock.Anything, "test-account-123", "test-unit-id", "commercialVehicleType", int64(3), expectedPatch).Return(existingUnit, nil)
+
+	response, err := handlers.HandleUpdate(context.Background(), event)
+
+	require.NoError(t, err)
+	require.NotNil(t, response)
+	assert.True(t, response.Success)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUnitHandlers_HandleUpdate_InvalidPatch(t *testing.T) {
+	tests := []struct {
+		name          string
+		arguments     string
+		expectedError string
+		expectedInfo  string
+	}{
+		{
+			name:          "unknown field",
+			arguments:     `{"id": "u", "accountId": "a", "unitType": "t", "expectedVersion": 1, "colour": "red"}`,
+			expectedError: "Invalid update",
+			expectedInfo:  "unknown field colour",
+		},
+		{
+			name:          "null required field",
+			arguments:     `{"id": "u", "accountId": "a", "unitType": "t", "expectedVersion": 1, "make": null}`,
+			expectedError: "Invalid update",
+			expectedInfo:  "field make is required and cannot be cleared",
+		},
+		{
+			name:          "read-only field",
+			arguments:     `{"id": "u", "accountId": "a", "unitType": "t", "expectedVersion": 1, "createdAt": 0}`,
+			expectedError: "Invalid update",
+			expectedInfo:  "field createdAt cannot be updated",
+		},
+		{
+			name:          "nothing to update",
+			arguments:     `{"id": "u", "accountId": "a", "unitType": "t", "expectedVersion": 1}`,
+			expectedError: "No fields to update",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &repository.MockUnitRepository{}
+			handlers := NewUnitHandlers(mockRepo)
+
+			event := &appsync.AppSyncEvent{
+				TypeName:  "Mutation",
+				FieldName: "updateUnit",
+				Arguments: json.RawMessage(tt.arguments),
+			}
+
+			response, err := handlers.HandleUpdate(context.Background(), event)
+
+			require.NoError(t, err)
+			require.NotNil(t, response)
+			assert.False(t, response.Success)
+			assert.Equal(t, "VALIDATION_ERROR", response.Error.Code)
+			assert.Equal(t, tt.expectedError, response.Error.Message)
+			assert.Contains(t, response.Error.Details, tt.expectedInfo)
+
+			mockRepo.AssertNotCalled(t, "GetByKey")
+			mockRepo.AssertNotCalled(t, "Patch")
+		})
+	}
+}
+
 func TestUnitHandlers_HandleUpdate_ValidationError(t *testing.T) {
 	mockRepo := &repository.MockUnitRepository{}
 	handlers := NewUnitHandlers(mockRepo)
@@ -433,6 +542,15 @@ func TestUnitHandlers_HandleUpdate_ValidationError(t *testing.T) {
 			},
 			expectedError: "UnitType is required",
 		},
+		{
+			name: "missing expectedVersion",
+			input: appsync.UpdateUnitInput{
+				ID:        "test-unit-id",
+				AccountID: "test-account-123",
+				UnitType:  "commercialVehicleType",
+			},
+			expectedError: "ExpectedVersion is required",
+		},
 	}
 
 	for _, tt := range tests {
@@ -459,7 +577,7 @@ func TestUnitHandlers_HandleUpdate_ValidationError(t *testing.T) {
 
 			// No repository calls should be made for validation errors
 			mockRepo.AssertNotCalled(t, "GetByKey")
-			mockRepo.AssertNotCalled(t, "Update")
+			mockRepo.AssertNotCalled(t, "Patch")
 		})
 	}
 }
@@ -468,25 +586,17 @@ func TestUnitHandlers_HandleUpdate_NotFound(t *testing.T) {
 	mockRepo := &repository.MockUnitRepository{}
 	handlers := NewUnitHandlers(mockRepo)
 
-	unit := models.Unit{
-		SuggestedVin: "1HGBH41JXMN109186",
-		Make:         "Honda",
-		Model:        "Accord",
-	}
-
-	input := appsync.UpdateUnitInput{
-		ID:        "non-existent-id",
-		AccountID: "test-account-123",
-		UnitType:  "commercialVehicleType",
-		Unit:      unit,
-	}
-	argsJSON, err := json.Marshal(input)
-	require.NoError(t, err)
-
 	event := &appsync.AppSyncEvent{
 		TypeName:  "Mutation",
 		FieldName: "updateUnit",
-		Arguments: argsJSON,
+		Arguments: updateArguments(t, map[string]interface{}{
+			"id":              "non-existent-id",
+			"accountId":       "test-account-123",
+			"unitType":        "commercialVehicleType",
+			"expectedVersion": 3,
+			"suggestedVin":    "1HGBH41JXMN109186",
+			"model":           "Accord",
+		}),
 	}
 
 	// Mock expectations - unit not found
@@ -504,7 +614,7 @@ func TestUnitHandlers_HandleUpdate_NotFound(t *testing.T) {
 	assert.Equal(t, "Unit not found", response.Error.Message)
 
 	// GetByKey should be called, but Update should not
-	mockRepo.AssertNotCalled(t, "Update")
+	mockRepo.AssertNotCalled(t, "Patch")
 	mockRepo.AssertExpectations(t)
 }
 
@@ -512,25 +622,17 @@ func TestUnitHandlers_HandleUpdate_ExistenceCheckError(t *testing.T) {
 	mockRepo := &repository.MockUnitRepository{}
 	handlers := NewUnitHandlers(mockRepo)
 
-	unit := models.Unit{
-		SuggestedVin: "1HGBH41JXMN109186",
-		Make:         "Honda",
-		Model:        "Accord",
-	}
-
-	input := appsync.UpdateUnitInput{
-		ID:        "test-unit-id",
-		AccountID: "test-account-123",
-		UnitType:  "commercialVehicleType",
-		Unit:      unit,
-	}
-	argsJSON, err := json.Marshal(input)
-	require.NoError(t, err)
-
 	event := &appsync.AppSyncEvent{
 		TypeName:  "Mutation",
 		FieldName: "updateUnit",
-		Arguments: argsJSON,
+		Arguments: updateArguments(t, map[string]interface{}{
+			"id":              "test-unit-id",
+			"accountId":       "test-account-123",
+			"unitType":        "commercialVehicleType",
+			"expectedVersion": 3,
+			"suggestedVin":    "1HGBH41JXMN109186",
+			"model":           "Accord",
+		}),
 	}
 
 	// Mock expectations - GetByKey returns error
@@ -548,7 +650,7 @@ func TestUnitHandlers_HandleUpdate_ExistenceCheckError(t *testing.T) {
 	assert.Equal(t, "Failed to verify unit existence", response.Error.Message)
 
 	// GetByKey should be called, but Update should not
-	mockRepo.AssertNotCalled(t, "Update")
+	mockRepo.AssertNotCalled(t, "Patch")
 	mockRepo.AssertExpectations(t)
 }
 
@@ -556,25 +658,17 @@ func TestUnitHandlers_HandleUpdate_RepositoryError(t *testing.T) {
 	mockRepo := &repository.MockUnitRepository{}
 	handlers := NewUnitHandlers(mockRepo)
 
-	unit := models.Unit{
-		SuggestedVin: "1HGBH41JXMN109186",
-		Make:         "Honda",
-		Model:        "Accord",
-	}
-
-	input := appsync.UpdateUnitInput{
-		ID:        "test-unit-id",
-		AccountID: "test-account-123",
-		UnitType:  "commercialVehicleType",
-		Unit:      unit,
-	}
-	argsJSON, err := json.Marshal(input)
-	require.NoError(t, err)
-
 	event := &appsync.AppSyncEvent{
 		TypeName:  "Mutation",
 		FieldName: "updateUnit",
-		Arguments: argsJSON,
+		Arguments: updateArguments(t, map[string]interface{}{
+			"id":              "test-unit-id",
+			"accountId":       "test-account-123",
+			"unitType":        "commercialVehicleType",
+			"expectedVersion": 3,
+			"suggestedVin":    "1HGBH41JXMN109186",
+			"model":           "Accord",
+		}),
 	}
 
 	// Existing unit to be returned by GetByKey
@@ -585,15 +679,12 @@ func TestUnitHandlers_HandleUpdate_RepositoryError(t *testing.T) {
 		SuggestedVin: "OLD_VIN_123",
 		Make:         "Honda",
 		Model:        "Civic",
+		Version:      3,
 	}
 
 	// Mock expectations
-	expectedUnit := unit
-	expectedUnit.ID = input.ID
-	expectedUnit.AccountID = input.AccountID
-	expectedUnit.UnitType = input.UnitType
 	mockRepo.On("GetByKey", mock.Anything, "test-account-123", "test-unit-id", "commercialVehicleType").Return(existingUnit, nil)
-	mockRepo.On("Update", mock.Anything, &expectedUnit).Return(errors.New("database update failed"))
+	mockRepo.On("Patch", mock.Anything, "test-account-123", "test-unit-id", "commercialVehicleType", int64(3), mock.AnythingOfType("*models.UnitPatch")).Return(nil, errors.New("database update failed"))
 
 	// Execute
 	response, err := handlers.HandleUpdate(context.Background(), event)
@@ -610,14 +701,71 @@ func TestUnitHandlers_HandleUpdate_RepositoryError(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
+func TestUnitHandlers_HandleUpdate_Conflict(t *testing.T) {
+	tests := []struct {
+		name           string
+		storedVersion  int64
+		patchErr       error
+		currentVersion int64
+	}{
+		{
+			name:           "stale version detected on read",
+			storedVersion:  4,
+			currentVersion: 4,
+		},
+		{
+			name:           "concurrent write detected on update",
+			storedVersion:  3,
+			patchErr:       &repository.VersionConflictError{ExpectedVersion: 3, CurrentVersion: 5},
+			currentVersion: 5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &repository.MockUnitRepository{}
+			handlers := NewUnitHandlers(mockRepo)
+
+			event := &appsync.AppSyncEvent{
+				TypeName:  "Mutation",
+				FieldName: "updateUnit",
+				Arguments: updateArguments(t, map[string]interface{}{
+					"id":              "test-unit-id",
+					"accountId":       "test-account-123",
+					"unitType":        "commercialVehicleType",
+					"expectedVersion": 3,
+					"model":           "Accord",
+				}),
+			}
+
+			existingUnit := &models.Unit{ID: "test-unit-id", AccountID: "test-account-123", UnitType: "commercialVehicleType", Version: tt.storedVersion}
+			mockRepo.On("GetByKey", mock.Anything, "test-account-123", "test-unit-id", "commercialVehicleType").Return(existingUnit, nil)
+			if tt.patchErr != nil {
+				mockRepo.On("Patch", mock.Anything, "test-account-123", "test-unit-id", "commercialVehicleType", int64(3), mock.AnythingOfType("*models.UnitPatch")).Return(nil, tt.patchErr)
+			}
+
+			response, err := handlers.HandleUpdate(context.Background(), event)
+
+			require.NoError(t, err)
+			require.NotNil(t, response)
+			assert.False(t, response.Success)
+			assert.Equal(t, "CONFLICT", response.Error.Code)
+			assert.Equal(t, map[string]interface{}{"currentVersion": tt.currentVersion}, response.Data)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
 func TestUnitHandlers_HandleDelete_Success(t *testing.T) {
 	mockRepo := &repository.MockUnitRepository{}
 	handlers := NewUnitHandlers(mockRepo)
 
+	version := int64(2)
 	input := appsync.DeleteUnitInput{
-		ID:        "test-unit-id",
-		AccountID: "test-account-123",
-		UnitType:  "commercialVehicleType",
+		ID:              "test-unit-id",
+		AccountID:       "test-account-123",
+		UnitType:        "commercialVehicleType",
+		ExpectedVersion: &version,
 	}
 	argsJSON, err := json.Marshal(input)
 	require.NoError(t, err)
@@ -626,10 +774,11 @@ func TestUnitHandlers_HandleDelete_Success(t *testing.T) {
 		TypeName:  "Mutation",
 		FieldName: "deleteUnit",
 		Arguments: argsJSON,
+		Identity:  appsync.Identity{Sub: "user-sub-123", Username: "fleet-admin"},
 	}
 
 	// Mock expectations
-	mockRepo.On("Delete", mock.Anything, "test-account-123", "test-unit-id", "commercialVehicleType").Return(nil)
+	mockRepo.On("Delete", mock.Anything, "test-account-123", "test-unit-id", "commercialVehicleType", int64(2), "fleet-admin").Return(nil)
 
 	// Execute
 	response, err := handlers.HandleDelete(context.Background(), event)
@@ -685,6 +834,15 @@ func TestUnitHandlers_HandleDelete_ValidationError(t *testing.T) {
 			},
 			expectedError: "UnitType is required",
 		},
+		{
+			name: "missing expectedVersion",
+			input: appsync.DeleteUnitInput{
+				ID:        "test-unit-id",
+				AccountID: "test-account-123",
+				UnitType:  "commercialVehicleType",
+			},
+			expectedError: "ExpectedVersion is required",
+		},
 	}
 
 	for _, tt := range tests {
@@ -719,10 +877,12 @@ func TestUnitHandlers_HandleDelete_RepositoryError(t *testing.T) {
 	mockRepo := &repository.MockUnitRepository{}
 	handlers := NewUnitHandlers(mockRepo)
 
+	version := int64(2)
 	input := appsync.DeleteUnitInput{
-		ID:        "test-unit-id",
-		AccountID: "test-account-123",
-		UnitType:  "commercialVehicleType",
+		ID:              "test-unit-id",
+		AccountID:       "test-account-123",
+		UnitType:        "commercialVehicleType",
+		ExpectedVersion: &version,
 	}
 	argsJSON, err := json.Marshal(input)
 	require.NoError(t, err)
@@ -734,7 +894,7 @@ func TestUnitHandlers_HandleDelete_RepositoryError(t *testing.T) {
 	}
 
 	// Mock expectations - repository returns error
-	mockRepo.On("Delete", mock.Anything, "test-account-123", "test-unit-id", "commercialVehicleType").Return(errors.New("database connection failed"))
+	mockRepo.On("Delete", mock.Anything, "test-account-123", "test-unit-id", "commercialVehicleType", int64(2), "").Return(errors.New("database connection failed"))
 
 	// Execute
 	response, err := handlers.HandleDelete(context.Background(), event)
@@ -755,10 +915,12 @@ func TestUnitHandlers_HandleDelete_UnitNotFound(t *testing.T) {
 	mockRepo := &repository.MockUnitRepository{}
 	handlers := NewUnitHandlers(mockRepo)
 
+	version := int64(2)
 	input := appsync.DeleteUnitInput{
-		ID:        "non-existent-id",
-		AccountID: "test-account-123",
-		UnitType:  "commercialVehicleType",
+		ID:              "non-existent-id",
+		AccountID:       "test-account-123",
+		UnitType:        "commercialVehicleType",
+		ExpectedVersion: &version,
 	}
 	argsJSON, err := json.Marshal(input)
 	require.NoError(t, err)
@@ -770,7 +932,8 @@ func TestUnitHandlers_HandleDelete_UnitNotFound(t *testing.T) {
 	}
 
 	// Mock expectations - unit not found
-	mockRepo.On("Delete", mock.Anything, "test-account-123", "non-existent-id", "commercialVehicleType").Return(errors.New("unit with id non-existent-id not found for account test-account-123"))
+	mockRepo.On("Delete", mock.Anything, "test-account-123", "non-existent-id", "commercialVehicleType", int64(2), "").
+		Return(fmt.Errorf("%w: unit with id non-existent-id", repository.ErrUnitNotFound))
 
 	// Execute
 	response, err := handlers.HandleDelete(context.Background(), event)
@@ -780,8 +943,8 @@ func TestUnitHandlers_HandleDelete_UnitNotFound(t *testing.T) {
 	require.NotNil(t, response)
 	assert.False(t, response.Success)
 	assert.NotNil(t, response.Error)
-	assert.Equal(t, "DELETE_FAILED", response.Error.Code)
-	assert.Equal(t, "Failed to delete unit", response.Error.Message)
+	assert.Equal(t, "NOT_FOUND", response.Error.Code)
+	assert.Equal(t, "Unit not found", response.Error.Message)
 
 	// Verify mock expectations
 	mockRepo.AssertExpectations(t)
@@ -840,6 +1003,41 @@ func TestUnitHandlers_HandleList_Success(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
+func TestUnitHandlers_HandleList_InvalidNextToken(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	handlers := NewUnitHandlers(mockRepo)
+
+	token := "forged"
+	input := appsync.ListUnitsInput{
+		AccountID: "test-account-123",
+		NextToken: &token,
+	}
+	argsJSON, err := json.Marshal(input)
+	require.NoError(t, err)
+
+	event := &appsync.AppSyncEvent{
+		TypeName:  "Query",
+		FieldName: "listUnits",
+		Arguments: argsJSON,
+	}
+
+	// Mock expectations
+	mockRepo.On("List", mock.Anything, &input).Return(nil, fmt.Errorf("%w: signature mismatch", repository.ErrInvalidPaginationToken))
+
+	// Execute
+	response, err := handlers.HandleList(context.Background(), event)
+
+	// Assertions
+	require.NoError(t, err)
+	require.NotNil(t, response)
+	assert.False(t, response.Success)
+	assert.Equal(t, "VALIDATION_ERROR", response.Error.Code)
+	assert.Equal(t, "Invalid nextToken", response.Error.Message)
+
+	// Verify mock expectations
+	mockRepo.AssertExpectations(t)
+}
+
 func TestUnitHandlers_HandleList_ValidationError(t *testing.T) {
 	mockRepo := &repository.MockUnitRepository{}
 	handlers := NewUnitHandlers(mockRepo)
@@ -872,6 +1070,79 @@ func TestUnitHandlers_HandleList_ValidationError(t *testing.T) {
 	mockRepo.AssertNotCalled(t, "List")
 }
 
+func TestUnitHandlers_HandleList_InvalidFilter(t *testing.T) {
+	tests := []struct {
+		name        string
+		filter      string
+		wantDetails string
+	}{
+		{name: "malformed", filter: `{"field":"make","op":"like","value":"F%"}`, wantDetails: "unsupported operator"},
+		{name: "unknown field", filter: `{"field":"colour","op":"eq","value":"red"}`, wantDetails: `unknown field "colour"`},
+		{name: "account id is not filterable", filter: `{"field":"accountId","op":"eq","value":"other"}`, wantDetails: `unknown field "accountId"`},
+		{name: "range on text field", filter: `{"field":"make","op":"gt","value":1}`, wantDetails: "only supported on"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &repository.MockUnitRepository{}
+			handlers := NewUnitHandlers(mockRepo)
+
+			input := appsync.ListUnitsInput{
+				AccountID: "test-account-123",
+				Filter:    &tt.filter,
+			}
+			argsJSON, err := json.Marshal(input)
+			require.NoError(t, err)
+
+			event := &appsync.AppSyncEvent{
+				TypeName:  "Query",
+				FieldName: "listUnits",
+				Arguments: argsJSON,
+			}
+
+			response, err := handlers.HandleList(context.Background(), event)
+
+			require.NoError(t, err)
+			require.NotNil(t, response)
+			assert.False(t, response.Success)
+			assert.Equal(t, "VALIDATION_ERROR", response.Error.Code)
+			assert.Equal(t, "Invalid filter", response.Error.Message)
+			assert.Contains(t, response.Error.Details, tt.wantDetails)
+
+			mockRepo.AssertNotCalled(t, "List")
+		})
+	}
+}
+
+func TestUnitHandlers_HandleList_WithFilter(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	handlers := NewUnitHandlers(mockRepo)
+
+	filter := `{"and":[{"field":"make","op":"eq","value":"Ford"},{"field":"modelYear","op":"between","value":[2015,2020]}]}`
+	input := appsync.ListUnitsInput{
+		AccountID: "test-account-123",
+		Filter:    &filter,
+	}
+	argsJSON, err := json.Marshal(input)
+	require.NoError(t, err)
+
+	event := &appsync.AppSyncEvent{
+		TypeName:  "Query",
+		FieldName: "listUnits",
+		Arguments: argsJSON,
+	}
+
+	listResponse := &appsync.ListUnitsResponse{Items: []models.Unit{}, Count: 0}
+	mockRepo.On("List", mock.Anything, &input).Return(listResponse, nil)
+
+	response, err := handlers.HandleList(context.Background(), event)
+
+	require.NoError(t, err)
+	require.NotNil(t, response)
+	assert.True(t, response.Success)
+	mockRepo.AssertExpectations(t)
+}
+
 func TestUnitHandlers_DumpEvent(t *testing.T) {
 	mockRepo := &repository.MockUnitRepository{}
 	handlers := NewUnitHandlers(mockRepo)
@@ -924,3 +1195,912 @@ func TestNewUnitHandlers(t *testing.T) {
 	assert.NotNil(t, handlers)
 	assert.Equal(t, mockRepo, handlers.repo)
 }
+
+// updateArguments builds raw updateUnit arguments containing only the given fields
+func updateArguments(t *testing.T, fields map[string]interface{}) json.RawMessage {
+	argsJSON, err := json.Marshal(fields)
+	require.NoError(t, err)
+	return argsJSON
+}
+
+func TestUnitHandlers_HandleDelete_Conflict(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	handlers := NewUnitHandlers(mockRepo)
+
+	version := int64(1)
+	input := appsync.DeleteUnitInput{
+		ID:              "test-unit-id",
+		AccountID:       "test-account-123",
+		UnitType:        "commercialVehicleType",
+		ExpectedVersion: &version,
+	}
+	argsJSON, err := json.Marshal(input)
+	require.NoError(t, err)
+
+	event := &appsync.AppSyncEvent{
+		TypeName:  "Mutation",
+		FieldName: "deleteUnit",
+		Arguments: argsJSON,
+	}
+
+	mockRepo.On("Delete", mock.Anything, "test-account-123", "test-unit-id", "commercialVehicleType", int64(1), "").
+		Return(&repository.VersionConflictError{ExpectedVersion: 1, CurrentVersion: 2})
+
+	response, err := handlers.HandleDelete(context.Background(), event)
+
+	require.NoError(t, err)
+	require.NotNil(t, response)
+	assert.False(t, response.Success)
+	assert.Equal(t, "CONFLICT", response.Error.Code)
+	assert.Contains(t, response.Error.Details, "current version is 2")
+	assert.Equal(t, map[string]interface{}{"currentVersion": int64(2)}, response.Data)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUnitHandlers_HandleDelete_AlreadyDeleted(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	handlers := NewUnitHandlers(mockRepo)
+
+	version := int64(4)
+	input := appsync.DeleteUnitInput{
+		ID:              "test-unit-id",
+		AccountID:       "test-account-123",
+		UnitType:        "commercialVehicleType",
+		ExpectedVersion: &version,
+	}
+	argsJSON, err := json.Marshal(input)
+	require.NoError(t, err)
+
+	event := &appsync.AppSyncEvent{
+		TypeName:  "Mutation",
+		FieldName: "deleteUnit",
+		Arguments: argsJSON,
+	}
+
+	mockRepo.On("Delete", mock.Anything, "test-account-123", "test-unit-id", "commercialVehicleType", int64(4), "").
+		Return(fmt.Errorf("%w: unit with id test-unit-id", repository.ErrUnitAlreadyDeleted))
+
+	response, err := handlers.HandleDelete(context.Background(), event)
+
+	require.NoError(t, err)
+	require.NotNil(t, response)
+	assert.False(t, response.Success)
+	assert.Equal(t, "ALREADY_DELETED", response.Error.Code)
+	assert.Equal(t, "Unit is already deleted", response.Error.Message)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUnitHandlers_HandleRestore(t *testing.T) {
+	tests := []struct {
+		name        string
+		repoErr     error
+		wantSuccess bool
+		wantCode    string
+	}{
+		{name: "restored", wantSuccess: true},
+		{name: "missing unit", repoErr: fmt.Errorf("%w: unit with id test-unit-id", repository.ErrUnitNotFound), wantCode: "NOT_FOUND"},
+		{name: "live unit", repoErr: fmt.Errorf("%w: unit with id test-unit-id", repository.ErrUnitNotDeleted), wantCode: "NOT_DELETED"},
+		{name: "concurrent write", repoErr: &repository.VersionConflictError{ExpectedVersion: 3, CurrentVersion: 4}, wantCode: "CONFLICT"},
+		{name: "repository failure", repoErr: errors.New("throttled"), wantCode: "RESTORE_FAILED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &repository.MockUnitRepository{}
+			handlers := NewUnitHandlers(mockRepo)
+
+			version := int64(3)
+			argsJSON, err := json.Marshal(appsync.RestoreUnitInput{
+				ID:              "test-unit-id",
+				AccountID:       "test-account-123",
+				UnitType:        "commercialVehicleType",
+				ExpectedVersion: &version,
+			})
+			require.NoError(t, err)
+
+			event := &appsync.AppSyncEvent{
+				TypeName:  "Mutation",
+				FieldName: "restoreUnit",
+				Arguments: argsJSON,
+			}
+
+			var restored *models.Unit
+			if tt.repoErr == nil {
+				restored = &models.Unit{ID: "test-unit-id", AccountID: "test-account-123", UnitType: "commercialVehicleType", Version: 4}
+			}
+			mockRepo.On("Restore", mock.Anything, "test-account-123", "test-unit-id", "commercialVehicleType", int64(3)).
+				Return(restored, tt.repoErr)
+
+			response, err := handlers.HandleRestore(context.Background(), event)
+
+			require.NoError(t, err)
+			require.NotNil(t, response)
+			assert.Equal(t, tt.wantSuccess, response.Success)
+			if tt.wantSuccess {
+				assert.Equal(t, "Unit restored successfully", response.Message)
+				assert.Equal(t, restored, response.Data)
+			} else {
+				assert.Equal(t, tt.wantCode, response.Error.Code)
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUnitHandlers_HandleRestore_RequiresExpectedVersion(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	handlers := NewUnitHandlers(mockRepo)
+
+	event := &appsync.AppSyncEvent{
+		TypeName:  "Mutation",
+		FieldName: "restoreUnit",
+		Arguments: json.RawMessage(`{"id":"test-unit-id","accountId":"test-account-123","unitType":"commercialVehicleType"}`),
+	}
+
+	response, err := handlers.HandleRestore(context.Background(), event)
+
+	require.NoError(t, err)
+	assert.False(t, response.Success)
+	assert.Equal(t, "VALIDATION_ERROR", response.Error.Code)
+	assert.Equal(t, "ExpectedVersion is required", response.Error.Message)
+	mockRepo.AssertNotCalled(t, "Restore")
+}
+
+func TestUnitHandlers_HandleListDeleted(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	handlers := NewUnitHandlers(mockRepo)
+
+	event := &appsync.AppSyncEvent{
+		TypeName:  "Query",
+		FieldName: "listDeletedUnits",
+		Arguments: json.RawMessage(`{"accountId":"test-account-123"}`),
+	}
+
+	deleted := &appsync.ListUnitsResponse{
+		Items: []models.Unit{{ID: "unit-1", AccountID: "test-account-123", DeletedAt: 1700000000, DeletedBy: "fleet-admin"}},
+		Count: 1,
+	}
+	mockRepo.On("ListDeleted", mock.Anything, &appsync.ListUnitsInput{AccountID: "test-account-123"}).Return(deleted, nil)
+
+	response, err := handlers.HandleListDeleted(context.Background(), event)
+
+	require.NoError(t, err)
+	assert.True(t, response.Success)
+	assert.Equal(t, deleted, response.Data)
+	assert.Equal(t, "Retrieved 1 deleted units", response.Message)
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "List")
+}
+
+func TestUnitHandlers_HandlePurge(t *testing.T) {
+	admin := appsync.Identity{Username: "ops", Groups: []string{"admin"}}
+	arguments := json.RawMessage(`{"id":"test-unit-id","accountId":"test-account-123","unitType":"commercialVehicleType"}`)
+
+	tests := []struct {
+		name        string
+		identity    appsync.Identity
+		repoErr     error
+		wantSuccess bool
+		wantCode    string
+	}{
+		{name: "admin purges deleted unit", identity: admin, wantSuccess: true},
+		{name: "non admin", identity: appsync.Identity{Username: "driver", Groups: []string{"dispatch"}}, wantCode: "FORBIDDEN"},
+		{name: "missing unit", identity: admin, repoErr: fmt.Errorf("%w: test-unit-id", repository.ErrUnitNotFound), wantCode: "NOT_FOUND"},
+		{name: "live unit", identity: admin, repoErr: fmt.Errorf("%w: test-unit-id", repository.ErrUnitNotDeleted), wantCode: "NOT_DELETED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &repository.MockUnitRepository{}
+			handlers := NewUnitHandlers(mockRepo)
+
+			event := &appsync.AppSyncEvent{
+				TypeName:  "Mutation",
+				FieldName: "purgeUnit",
+				Arguments: arguments,
+				Identity:  tt.identity,
+			}
+
+			if tt.wantCode != "FORBIDDEN" {
+				mockRepo.On("Purge", mock.Anything, "test-account-123", "test-unit-id", "commercialVehicleType").Return(tt.repoErr)
+			}
+
+			response, err := handlers.HandlePurge(context.Background(), event)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantSuccess, response.Success)
+			if tt.wantSuccess {
+				assert.Equal(t, "Unit purged successfully", response.Message)
+			} else {
+				assert.Equal(t, tt.wantCode, response.Error.Code)
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUnitHandlers_HandlePurge_CustomAdminGroup(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	handlers := NewUnitHandlers(mockRepo).WithAdminGroup("support")
+
+	event := &appsync.AppSyncEvent{
+		TypeName:  "Mutation",
+		FieldName: "purgeUnit",
+		Arguments: json.RawMessage(`{"id":"test-unit-id","accountId":"test-account-123","unitType":"commercialVehicleType"}`),
+		Identity:  appsync.Identity{Username: "ops", Groups: []string{"admin"}},
+	}
+
+	response, err := handlers.HandlePurge(context.Background(), event)
+
+	require.NoError(t, err)
+	assert.Equal(t, "FORBIDDEN", response.Error.Code)
+	mockRepo.AssertNotCalled(t, "Purge")
+}
+
+func TestUnitHandlers_HandleCreate_DuplicateVin(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	handlers := NewUnitHandlers(mockRepo)
+
+	event := &appsync.AppSyncEvent{
+		TypeName:  "Mutation",
+		FieldName: "createUnit",
+		Arguments: json.RawMessage(`{"accountId":"test-account-123","unitType":"commercialVehicleType","suggestedVin":"1HGBH41JXMN109186","make":"Honda","model":"Civic"}`),
+	}
+
+	mockRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.Unit")).
+		Return(fmt.Errorf("failed to create unit: %w", &repository.DuplicateVinError{Vin: "1HGBH41JXMN109186", UnitID: "unit-1"}))
+
+	response, err := handlers.HandleCreate(context.Background(), event)
+
+	require.NoError(t, err)
+	assert.False(t, response.Success)
+	assert.Equal(t, "DUPLICATE_VIN", response.Error.Code)
+	assert.Contains(t, response.Error.Details, "unit-1")
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUnitHandlers_HandleUpdate_DuplicateVin(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	handlers := NewUnitHandlers(mockRepo)
+
+	event := &appsync.AppSyncEvent{
+		TypeName:  "Mutation",
+		FieldName: "updateUnit",
+		Arguments: json.RawMessage(`{"accountId":"test-account-123","id":"test-unit-id","unitType":"commercialVehicleType","expectedVersion":3,"suggestedVin":"1HGBH41JXMN109186"}`),
+	}
+
+	existingUnit := &models.Unit{ID: "test-unit-id", AccountID: "test-account-123", UnitType: "commercialVehicleType", Version: 3}
+	mockRepo.On("GetByKey", mock.Anything, "test-account-123", "test-unit-id", "commercialVehicleType").Return(existingUnit, nil)
+	mockRepo.On("Patch", mock.Anything, "test-account-123", "test-unit-id", "commercialVehicleType", int64(3), mock.AnythingOfType("*models.UnitPatch")).
+		Return(nil, fmt.Errorf("failed to update unit: %w", &repository.DuplicateVinError{Vin: "1HGBH41JXMN109186", UnitID: "unit-1"}))
+
+	response, err := handlers.HandleUpdate(context.Background(), event)
+
+	require.NoError(t, err)
+	assert.False(t, response.Success)
+	assert.Equal(t, "DUPLICATE_VIN", response.Error.Code)
+	assert.Contains(t, response.Error.Details, "unit-1")
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUnitHandlers_HandleGetByVin(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	handlers := NewUnitHandlers(mockRepo)
+
+	event := func(args string) *appsync.AppSyncEvent {
+		return &appsync.AppSyncEvent{TypeName: "Query", FieldName: "getUnitByVin", Arguments: json.RawMessage(args)}
+	}
+	unit := &models.Unit{ID: "unit-1", AccountID: "test-account-123", UnitType: "commercialVehicleType", SuggestedVin: "1HGBH41JXMN109186"}
+
+	mockRepo.On("GetByVin", mock.Anything, "test-account-123", "1HGBH41JXMN109186").Return(unit, nil)
+	mockRepo.On("GetByVin", mock.Anything, "test-account-123", "1XKAD49X0RJ123456").Return(nil, nil)
+
+	response, err := handlers.HandleGetByVin(context.Background(), event(`{"accountId":"test-account-123","vin":"1HGBH41JXMN109186"}`))
+	require.NoError(t, err)
+	assert.True(t, response.Success)
+	assert.Equal(t, unit, response.Data)
+
+	response, err = handlers.HandleGetByVin(context.Background(), event(`{"accountId":"test-account-123","vin":"1XKAD49X0RJ123456"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "NOT_FOUND", response.Error.Code)
+
+	response, err = handlers.HandleGetByVin(context.Background(), event(`{"accountId":"test-account-123","vin":" - "}`))
+	require.NoError(t, err)
+	assert.Equal(t, "VALIDATION_ERROR", response.Error.Code)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUnitHandlers_HandleSearchByVin(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	handlers := NewUnitHandlers(mockRepo)
+
+	event := func(args string) *appsync.AppSyncEvent {
+		return &appsync.AppSyncEvent{TypeName: "Query", FieldName: "searchUnitsByVin", Arguments: json.RawMessage(args)}
+	}
+	result := &appsync.ListUnitsResponse{Items: []models.Unit{{ID: "unit-1"}}, Count: 1}
+
+	mockRepo.On("SearchByVin", mock.Anything, &appsync.SearchUnitsByVinInput{AccountID: "test-account-123", VinPrefix: "1HGBH41J"}).Return(result, nil)
+
+	response, err := handlers.HandleSearchByVin(context.Background(), event(`{"accountId":"test-account-123","vinPrefix":"1HGBH41J"}`))
+	require.NoError(t, err)
+	assert.True(t, response.Success)
+	assert.Equal(t, result, response.Data)
+	assert.Equal(t, "Retrieved 1 units", response.Message)
+
+	for _, prefix := range []string{"1HGBH41", "1HGBH41JXMN1"} {
+		response, err = handlers.HandleSearchByVin(context.Background(), event(`{"accountId":"test-account-123","vinPrefix":"`+prefix+`"}`))
+		require.NoError(t, err)
+		assert.Equal(t, "VALIDATION_ERROR", response.Error.Code, prefix)
+	}
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUnitHandlers_HandleCreate_InvalidVin(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	handlers := NewUnitHandlers(mockRepo)
+
+	event := &appsync.AppSyncEvent{
+		TypeName:  "Mutation",
+		FieldName: "createUnit",
+		Arguments: json.RawMessage(`{"accountId":"test-account-123","unitType":"commercialVehicleType","suggestedVin":"1HGBH41J1MN109186","make":"Honda","model":"Civic","modelYear":"2019"}`),
+	}
+
+	response, err := handlers.HandleCreate(context.Background(), event)
+
+	require.NoError(t, err)
+	assert.False(t, response.Success)
+	assert.Equal(t, "VALIDATION_ERROR", response.Error.Code)
+	assert.Equal(t, "Invalid VIN", response.Error.Message)
+
+	issues := response.Data.(map[string]interface{})["vinErrors"].([]vin.Issue)
+	require.Len(t, issues, 2)
+	assert.Equal(t, vin.CodeCheckDigitMismatch, issues[0].Code)
+	assert.Equal(t, vin.CodeModelYearMismatch, issues[1].Code)
+
+	// Nothing is written
+	mockRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestUnitHandlers_HandleCreate_VinExemption(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	handlers := NewUnitHandlers(mockRepo)
+
+	event := &appsync.AppSyncEvent{
+		TypeName:  "Mutation",
+		FieldName: "createUnit",
+		Arguments: json.RawMessage(`{"accountId":"test-account-123","unitType":"commercialVehicleType","suggestedVin":"F10GCR12345","make":"Ford","model":"F-100","modelYear":"1971","vinExemption":"PRE_1981"}`),
+	}
+
+	mockRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.Unit")).Return(nil)
+
+	response, err := handlers.HandleCreate(context.Background(), event)
+
+	require.NoError(t, err)
+	assert.True(t, response.Success)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUnitHandlers_HandleDecodeVin(t *testing.T) {
+	vinDecoder := &decoder.MockVinDecoder{}
+	handlers := NewUnitHandlers(&repository.MockUnitRepository{}).WithVinDecoder(vinDecoder)
+
+	event := func(args string) *appsync.AppSyncEvent {
+		return &appsync.AppSyncEvent{TypeName: "Query", FieldName: "decodeVin", Arguments: json.RawMessage(args)}
+	}
+	decoded := &models.Unit{SuggestedVin: "1HGBH41JXMN109186", ErrorCode: "0", Make: "HONDA", Model: "Accord"}
+
+	vinDecoder.On("DecodeVin", mock.Anything, "1HGBH41JXMN109186", "1991").Return(decoded, nil)
+	vinDecoder.On("DecodeVin", mock.Anything, "1XKAD49X4RJ123456", "").Return(nil, errors.New("VIN decoder returned status 503"))
+
+	response, err := handlers.HandleDecodeVin(context.Background(), event(`{"vin":"1HGBH41JXMN109186","modelYear":"1991"}`))
+	require.NoError(t, err)
+	assert.True(t, response.Success)
+	assert.Equal(t, decoded, response.Data)
+
+	response, err = handlers.HandleDecodeVin(context.Background(), event(`{"vin":"1XKAD49X4RJ123456"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "DECODE_FAILED", response.Error.Code)
+
+	response, err = handlers.HandleDecodeVin(context.Background(), event(`{"vin":""}`))
+	require.NoError(t, err)
+	assert.Equal(t, "VALIDATION_ERROR", response.Error.Code)
+
+	response, err = NewUnitHandlers(&repository.MockUnitRepository{}).HandleDecodeVin(context.Background(), event(`{"vin":"1HGBH41JXMN109186"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "NOT_CONFIGURED", response.Error.Code)
+
+	vinDecoder.AssertExpectations(t)
+}
+
+func TestUnitHandlers_HandleCreate_DecodeVinFillsEmptyFields(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	vinDecoder := &decoder.MockVinDecoder{}
+	handlers := NewUnitHandlers(mockRepo).WithVinDecoder(vinDecoder)
+
+	event := &appsync.AppSyncEvent{
+		TypeName:  "Mutation",
+		FieldName: "createUnit",
+		Arguments: json.RawMessage(`{"accountId":"test-account-123","unitType":"commercialVehicleType","suggestedVin":"1HGBH41JXMN109186","make":"Honda","decodeVin":true}`),
+	}
+
+	vinDecoder.On("DecodeVin", mock.Anything, "1HGBH41JXMN109186", "").
+		Return(&models.Unit{SuggestedVin: "1HGBH41JXMN109186", ErrorCode: "0", Make: "HONDA", Model: "Accord", ModelYear: "1991"}, nil)
+	mockRepo.On("Create", mock.Anything, mock.MatchedBy(func(unit *models.Unit) bool {
+		// Submitted fields win over decoded ones
+		return unit.Make == "Honda" && unit.Model == "Accord" && unit.ModelYear == "1991" &&
+			unit.ErrorCode == "0" && unit.SuggestedVin == "1HGBH41JXMN109186" && unit.AccountID == "test-account-123"
+	})).Return(nil)
+
+	response, err := handlers.HandleCreate(context.Background(), event)
+
+	require.NoError(t, err)
+	assert.True(t, response.Success)
+	mockRepo.AssertExpectations(t)
+	vinDecoder.AssertExpectations(t)
+}
+
+func TestUnitHandlers_HandleImport(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	handlers := NewUnitHandlers(mockRepo)
+
+	event := func(format, payload string) *appsync.AppSyncEvent {
+		arguments, _ := json.Marshal(map[string]string{
+			"accountId": "test-account-123",
+			"unitType":  "commercialVehicleType",
+			"format":    format,
+			"payload":   payload,
+		})
+		return &appsync.AppSyncEvent{TypeName: "Mutation", FieldName: "importUnits", Arguments: arguments}
+	}
+
+	mockRepo.On("BatchCreate", mock.Anything, mock.MatchedBy(func(units []*models.Unit) bool {
+		return len(units) == 1 && units[0].SuggestedVin == "1HGBH41JXMN109186" && units[0].AccountID == "test-account-123"
+	})).Run(func(args mock.Arguments) {
+		args.Get(1).([]*models.Unit)[0].ID = "unit-1"
+	}).Return([]error{nil})
+
+	response, err := handlers.HandleImport(context.Background(), event("csv", "suggestedVin,make\n1HGBH41JXMN109186,Honda\n1HGBH41JXMN109187,Honda\n"))
+	require.NoError(t, err)
+	require.True(t, response.Success)
+	assert.Equal(t, "Imported 1 of 2 units", response.Message)
+
+	report, ok := response.Data.(*importer.Report)
+	require.True(t, ok)
+	assert.Equal(t, 2, report.Total)
+	assert.Equal(t, importer.RowResult{Line: 2, Success: true, ID: "unit-1"}, report.Rows[0])
+	assert.Equal(t, importer.CodeValidationError, report.Rows[1].Code)
+
+	tests := map[string]*appsync.AppSyncEvent{
+		"Invalid import format":  event("xlsx", "suggestedVin\n1HGBH41JXMN109186\n"),
+		"Payload is required":    event("CSV", " "),
+		"Invalid import payload": event("CSV", "colour\nred\n"),
+		"Payload has no rows":    event("CSV", "suggestedVin\n"),
+	}
+	for message, event := range tests {
+		response, err := handlers.HandleImport(context.Background(), event)
+		require.NoError(t, err)
+		require.NotNil(t, response.Error, message)
+		assert.Equal(t, "VALIDATION_ERROR", response.Error.Code, message)
+		assert.Equal(t, message, response.Error.Message)
+	}
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUnitHandlers_HandleExport(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	store := blobstore.NewMemoryStore()
+	handlers := NewUnitHandlers(mockRepo).WithExportStore(store, 0)
+
+	mockRepo.On("Export", mock.Anything, repository.ExportOptions{
+		AccountID: "test-account-123",
+		UnitType:  "commercialVehicleType",
+		Format:    exporter.FormatCSV,
+	}, mock.Anything).Run(func(args mock.Arguments) {
+		_, _ = io.WriteString(args.Get(2).(io.Writer), "id\nunit-1\nunit-2\n")
+	}).Return(&repository.ExportResult{Count: 2}, nil)
+
+	event := &appsync.AppSyncEvent{
+		TypeName:  "Mutation",
+		FieldName: "exportUnits",
+		Arguments: json.RawMessage(`{"accountId":"test-account-123","unitType":"commercialVehicleType","format":"csv"}`),
+	}
+	response, err := handlers.HandleExport(context.Background(), event)
+	require.NoError(t, err)
+	require.True(t, response.Success)
+	assert.Equal(t, "Exported 2 units", response.Message)
+
+	result, ok := response.Data.(*appsync.ExportUnitsResponse)
+	require.True(t, ok)
+	assert.Equal(t, 2, result.Count)
+	assert.Equal(t, "CSV", result.Format)
+	assert.True(t, strings.HasPrefix(result.Key, "exports/test-account-123/"), result.Key)
+	assert.True(t, strings.HasSuffix(result.Key, ".csv"), result.Key)
+	assert.Equal(t, "memory://"+result.Key, result.Location)
+	assert.Empty(t, result.URL)
+
+	object, ok := store.Get(result.Key)
+	require.True(t, ok)
+	assert.Equal(t, "id\nunit-1\nunit-2\n", string(object.Body))
+	assert.Equal(t, "text/csv", object.ContentType)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUnitHandlers_HandleExport_Errors(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	mockRepo.On("Export", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("failed to query units: throttled"))
+	store := blobstore.NewMemoryStore()
+
+	tests := []struct {
+		name      string
+		handlers  *UnitHandlers
+		arguments string
+		code      string
+	}{
+		{"missing account", NewUnitHandlers(mockRepo).WithExportStore(store, 0), `{"format":"CSV"}`, "VALIDATION_ERROR"},
+		{"unknown format", NewUnitHandlers(mockRepo).WithExportStore(store, 0), `{"accountId":"a-1","format":"XLSX"}`, "VALIDATION_ERROR"},
+		{"no store", NewUnitHandlers(mockRepo), `{"accountId":"a-1","format":"CSV"}`, "NOT_CONFIGURED"},
+		{"repository failure", NewUnitHandlers(mockRepo).WithExportStore(store, 0), `{"accountId":"a-1","format":"CSV"}`, "EXPORT_FAILED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &appsync.AppSyncEvent{FieldName: "exportUnits", Arguments: json.RawMessage(tt.arguments)}
+			response, err := tt.handlers.HandleExport(context.Background(), event)
+			require.NoError(t, err)
+			require.NotNil(t, response.Error)
+			assert.Equal(t, tt.code, response.Error.Code)
+		})
+	}
+	assert.Equal(t, 0, store.Len())
+}
+
+func TestUnitHandlers_HandleBatchGet(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	handlers := NewUnitHandlers(mockRepo)
+
+	mockRepo.On("BatchGet", mock.Anything, "test-account-123", []repository.UnitKey{
+		{ID: "unit-1", UnitType: "commercialVehicleType"},
+		{ID: "unit-2", UnitType: "commercialVehicleType"},
+		{ID: "unit-3", UnitType: "commercialVehicleType"},
+	}).Return([]*models.Unit{{ID: "unit-1", UnitType: "commercialVehicleType", Make: "Mack"}, nil, nil}, []error{nil, nil, errors.New("throttled")})
+
+	event := &appsync.AppSyncEvent{
+		TypeName:  "Query",
+		FieldName: "batchGetUnits",
+		Arguments: json.RawMessage(`{"accountId":"test-account-123","keys":[` +
+			`{"id":"unit-1","unitType":"commercialVehicleType"},{"id":"unit-2","unitType":"commercialVehicleType"},` +
+			`{"id":"unit-9"},{"id":"unit-3","unitType":"commercialVehicleType"}]}`),
+	}
+	response, err := handlers.HandleBatchGet(context.Background(), event)
+	require.NoError(t, err)
+	require.True(t, response.Success)
+	assert.Equal(t, "Retrieved 1 of 4 units", response.Message)
+
+	result, ok := response.Data.(*appsync.BatchUnitsResponse)
+	require.True(t, ok)
+	assert.Equal(t, 1, result.Succeeded)
+	assert.Equal(t, 3, result.Failed)
+	require.Len(t, result.Results, 4)
+	assert.True(t, result.Results[0].Success)
+	assert.Equal(t, "Mack", result.Results[0].Unit.Make)
+	assert.Equal(t, appsync.BatchUnitResult{Index: 1, ID: "unit-2", UnitType: "commercialVehicleType", Code: "NOT_FOUND", Error: "Unit not found"}, result.Results[1])
+	assert.Equal(t, appsync.BatchUnitResult{Index: 2, ID: "unit-9", Code: "VALIDATION_ERROR", Error: "UnitType is required"}, result.Results[2])
+	assert.Equal(t, appsync.BatchUnitResult{Index: 3, ID: "unit-3", UnitType: "commercialVehicleType", Code: "READ_FAILED", Error: "throttled"}, result.Results[3])
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUnitHandlers_HandleBatchCreate(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	handlers := NewUnitHandlers(mockRepo)
+
+	mockRepo.On("BatchCreate", mock.Anything, mock.MatchedBy(func(units []*models.Unit) bool {
+		return len(units) == 2 && units[0].Make == "Honda" && units[1].Make == "Mack" &&
+			units[0].AccountID == "test-account-123" && units[1].UnitType == "commercialVehicleType"
+	})).Run(func(args mock.Arguments) {
+		args.Get(1).([]*models.Unit)[0].ID = "unit-1"
+		args.Get(1).([]*models.Unit)[1].ID = "unit-2"
+	}).Return([]error{nil, &repository.DuplicateVinError{Vin: "1M1AN07Y9GM012345", UnitID: "unit-0"}})
+
+	event := &appsync.AppSyncEvent{
+		TypeName:  "Mutation",
+		FieldName: "batchCreateUnits",
+		Arguments: json.RawMessage(`{"accountId":"test-account-123","unitType":"commercialVehicleType","units":[` +
+			`{"suggestedVin":"1HGBH41JXMN109186","make":"Honda"},` +
+			`{"suggestedVin":"1HGBH41JXMN109187","make":"Honda"},` +
+			`{"suggestedVin":"1M1AN07Y9GM012345","make":"Mack"}]}`),
+	}
+	response, err := handlers.HandleBatchCreate(context.Background(), event)
+	require.NoError(t, err)
+	require.True(t, response.Success)
+	assert.Equal(t, "Created 1 of 3 units", response.Message)
+
+	result, ok := response.Data.(*appsync.BatchUnitsResponse)
+	require.True(t, ok)
+	require.Len(t, result.Results, 3)
+	assert.True(t, result.Results[0].Success)
+	assert.Equal(t, "unit-1", result.Results[0].ID)
+	require.NotNil(t, result.Results[0].Unit)
+	assert.Equal(t, "test-account-123", result.Results[0].Unit.AccountID)
+	assert.Equal(t, "VALIDATION_ERROR", result.Results[1].Code)
+	assert.Nil(t, result.Results[1].Unit)
+	assert.Equal(t, 2, result.Results[2].Index)
+	assert.Equal(t, "DUPLICATE_VIN", result.Results[2].Code)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUnitHandlers_HandleBatchDelete(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	handlers := NewUnitHandlers(mockRepo)
+
+	key := func(id string) repository.DeleteKey {
+		return repository.DeleteKey{UnitKey: repository.UnitKey{ID: id, UnitType: "commercialVehicleType"}, ExpectedVersion: 2}
+	}
+	mockRepo.On("BatchDelete", mock.Anything, "test-account-123", []repository.DeleteKey{key("unit-1"), key("unit-2"), key("unit-3"), key("unit-4")}, "user-123").
+		Return([]error{
+			nil,
+			fmt.Errorf("%w: unit-2", repository.ErrUnitNotFound),
+			fmt.Errorf("%w: unit-3", repository.ErrUnitAlreadyDeleted),
+			&repository.VersionConflictError{ExpectedVersion: 2, CurrentVersion: 3},
+		})
+
+	event := &appsync.AppSyncEvent{
+		TypeName:  "Mutation",
+		FieldName: "batchDeleteUnits",
+		Arguments: json.RawMessage(`{"accountId":"test-account-123","keys":[` +
+			`{"id":"unit-1","unitType":"commercialVehicleType","expectedVersion":2},{"id":"unit-2","unitType":"commercialVehicleType","expectedVersion":2},` +
+			`{"id":"unit-3","unitType":"commercialVehicleType","expectedVersion":2},{"id":"unit-4","unitType":"commercialVehicleType","expectedVersion":2},` +
+			`{"id":"unit-5","unitType":"commercialVehicleType"}]}`),
+		Identity: appsync.Identity{Sub: "user-123"},
+	}
+	response, err := handlers.HandleBatchDelete(context.Background(), event)
+	require.NoError(t, err)
+	require.True(t, response.Success)
+	assert.Equal(t, "Deleted 1 of 5 units", response.Message)
+
+	result, ok := response.Data.(*appsync.BatchUnitsResponse)
+	require.True(t, ok)
+	require.Len(t, result.Results, 5)
+	assert.True(t, result.Results[0].Success)
+	assert.Equal(t, "NOT_FOUND", result.Results[1].Code)
+	assert.Equal(t, "ALREADY_DELETED", result.Results[2].Code)
+	assert.Equal(t, "CONFLICT", result.Results[3].Code)
+	assert.Equal(t, "version conflict: expected version 2 but current version is 3", result.Results[3].Error)
+	assert.Equal(t, "ExpectedVersion is required", result.Results[4].Error)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUnitHandlers_HandleBatch_Validation(t *testing.T) {
+	handlers := NewUnitHandlers(&repository.MockUnitRepository{})
+
+	keys := make([]string, maxBatchSize+1)
+	for i := range keys {
+		keys[i] = fmt.Sprintf(`{"id":"unit-%d","unitType":"commercialVehicleType"}`, i)
+	}
+
+	tests := []struct {
+		name    string
+		handle  func(context.Context, *appsync.AppSyncEvent) (*appsync.Response, error)
+		event   *appsync.AppSyncEvent
+		message string
+	}{
+		{"get without account", handlers.HandleBatchGet, policyEvent("batchGetUnits", `{"keys":[{"id":"unit-1","unitType":"commercialVehicleType"}]}`), "AccountID is required"},
+		{"get without keys", handlers.HandleBatchGet, policyEvent("batchGetUnits", `{"accountId":"a-1","keys":[]}`), "Keys are required"},
+		{"get too many keys", handlers.HandleBatchGet, policyEvent("batchGetUnits", `{"accountId":"a-1","keys":[`+strings.Join(keys, ",")+`]}`), "Request has 101 keys; at most 100 can be sent at once"},
+		{"create without unit type", handlers.HandleBatchCreate, policyEvent("batchCreateUnits", `{"accountId":"a-1","units":[{}]}`), "UnitType is required"},
+		{"create without units", handlers.HandleBatchCreate, policyEvent("batchCreateUnits", `{"accountId":"a-1","unitType":"commercialVehicleType"}`), "Units are required"},
+		{"delete without keys", handlers.HandleBatchDelete, policyEvent("batchDeleteUnits", `{"accountId":"a-1"}`), "Keys are required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := tt.handle(context.Background(), tt.event)
+			require.NoError(t, err)
+			require.NotNil(t, response.Error)
+			assert.Equal(t, "VALIDATION_ERROR", response.Error.Code)
+			assert.Equal(t, tt.message, response.Error.Message)
+		})
+	}
+}
+
+func TestUnitHandlers_HandleTransact(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	handlers := NewUnitHandlers(mockRepo)
+
+	mockRepo.On("TransactWrite", mock.Anything, "test-account-123", mock.MatchedBy(func(ops []repository.TransactOp) bool {
+		return len(ops) == 4 &&
+			ops[0].Type == repository.TransactCreate && ops[0].Unit.Make == "Mack" && ops[0].Unit.UnitType == "commercialVehicleType" &&
+			ops[1].Type == repository.TransactUpdate && ops[1].ExpectedVersion == 3 && ops[1].Patch != nil && !ops[1].Patch.IsEmpty() &&
+			ops[2].Type == repository.TransactDelete && ops[2].ID == "unit-3" &&
+			ops[3].Type == repository.TransactConditionCheck && ops[3].ExpectedVersion == 7
+	}), "user-123").Run(func(args mock.Arguments) {
+		unit := args.Get(2).([]repository.TransactOp)[0].Unit
+		unit.ID, unit.Version = "unit-1", 1
+	}).Return(nil)
+
+	event := &appsync.AppSyncEvent{
+		TypeName:  "Mutation",
+		FieldName: "transactUnits",
+		Arguments: json.RawMessage(`{"accountId":"test-account-123","operations":[` +
+			`{"type":"CREATE","unitType":"commercialVehicleType","unit":{"suggestedVin":"1M1AN07Y9GM012345","make":"Mack"}},` +
+			`{"type":"UPDATE","id":"unit-2","unitType":"commercialVehicleType","expectedVersion":3,"unit":{"note":"moved"}},` +
+			`{"type":"DELETE","id":"unit-3","unitType":"commercialVehicleType","expectedVersion":1},` +
+			`{"type":"CONDITION_CHECK","id":"unit-4","unitType":"commercialVehicleType","expectedVersion":7}]}`),
+		Identity: appsync.Identity{Sub: "user-123"},
+	}
+	response, err := handlers.HandleTransact(context.Background(), event)
+	require.NoError(t, err)
+	require.True(t, response.Success)
+	assert.Equal(t, "Applied 4 operations", response.Message)
+
+	result, ok := response.Data.(*appsync.TransactUnitsResponse)
+	require.True(t, ok)
+	require.Len(t, result.Results, 4)
+	assert.Equal(t, "unit-1", result.Results[0].ID)
+	assert.Equal(t, int64(1), result.Results[0].Version)
+	require.NotNil(t, result.Results[0].Unit)
+	assert.Equal(t, int64(4), result.Results[1].Version)
+	assert.Equal(t, int64(2), result.Results[2].Version)
+	assert.Equal(t, int64(7), result.Results[3].Version)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUnitHandlers_HandleTransact_Canceled(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	handlers := NewUnitHandlers(mockRepo)
+
+	mockRepo.On("TransactWrite", mock.Anything, "test-account-123", mock.Anything, "user-123").
+		Return(&repository.TransactionCanceledError{Errors: []error{
+			nil,
+			&repository.VersionConflictError{ExpectedVersion: 2, CurrentVersion: 3},
+			fmt.Errorf("%w: unit-3", repository.ErrUnitNotFound),
+		}})
+
+	event := &appsync.AppSyncEvent{
+		TypeName:  "Mutation",
+		FieldName: "transactUnits",
+		Arguments: json.RawMessage(`{"accountId":"test-account-123","operations":[` +
+			`{"type":"DELETE","id":"unit-1","unitType":"commercialVehicleType","expectedVersion":2},` +
+			`{"type":"DELETE","id":"unit-2","unitType":"commercialVehicleType","expectedVersion":2},` +
+			`{"type":"CONDITION_CHECK","id":"unit-3","unitType":"commercialVehicleType","expectedVersion":2}]}`),
+		Identity: appsync.Identity{Sub: "user-123"},
+	}
+	response, err := handlers.HandleTransact(context.Background(), event)
+	require.NoError(t, err)
+	require.NotNil(t, response.Error)
+	assert.Equal(t, "TRANSACTION_CANCELED", response.Error.Code)
+
+	failures := response.Data.(map[string]interface{})["failures"].([]appsync.TransactOperationResult)
+	require.Len(t, failures, 2)
+	assert.Equal(t, 1, failures[0].Index)
+	assert.Equal(t, "unit-2", failures[0].ID)
+	assert.Equal(t, "CONFLICT", failures[0].Code)
+	assert.Equal(t, 2, failures[1].Index)
+	assert.Equal(t, "NOT_FOUND", failures[1].Code)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUnitHandlers_HandleTransact_Validation(t *testing.T) {
+	handlers := NewUnitHandlers(&repository.MockUnitRepository{})
+
+	tests := []struct {
+		name      string
+		arguments string
+		message   string
+		failure   string
+	}{
+		{"without account", `{"operations":[{"type":"DELETE"}]}`, "AccountID is required", ""},
+		{"without operations", `{"accountId":"a-1","operations":[]}`, "Operations are required", ""},
+		{"unknown type", `{"accountId":"a-1","operations":[{"type":"UPSERT","unitType":"commercialVehicleType"}]}`, "Invalid transaction operations", `unsupported operation type "UPSERT"`},
+		{"create without vin", `{"accountId":"a-1","operations":[{"type":"CREATE","unitType":"commercialVehicleType","unit":{"make":"Mack"}}]}`, "Invalid transaction operations", "suggestedVin is required"},
+		{"create with differently cased field", `{"accountId":"a-1","operations":[{"type":"CREATE","unitType":"commercialVehicleType","unit":{"suggestedVin":"1M1AN07Y9GM012345","BasePrice":"99999"}}]}`, "Invalid transaction operations", "invalid unit: unknown field BasePrice"},
+		{"create setting service fields", `{"accountId":"a-1","operations":[{"type":"CREATE","unitType":"commercialVehicleType","unit":{"suggestedVin":"1M1AN07Y9GM012345","expiresAt":1}}]}`, "Invalid transaction operations", "invalid unit: field expiresAt cannot be set"},
+		{"update without version", `{"accountId":"a-1","operations":[{"type":"UPDATE","id":"unit-1","unitType":"commercialVehicleType","unit":{"note":"x"}}]}`, "Invalid transaction operations", "expectedVersion is required"},
+		{"empty update", `{"accountId":"a-1","operations":[{"type":"UPDATE","id":"unit-1","unitType":"commercialVehicleType","expectedVersion":1,"unit":{"id":"unit-1"}}]}`, "Invalid transaction operations", "no fields to update"},
+		{"delete without id", `{"accountId":"a-1","operations":[{"type":"DELETE","unitType":"commercialVehicleType","expectedVersion":1}]}`, "Invalid transaction operations", "id is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := handlers.HandleTransact(context.Background(), policyEvent("transactUnits", tt.arguments))
+			require.NoError(t, err)
+			require.NotNil(t, response.Error)
+			assert.Equal(t, "VALIDATION_ERROR", response.Error.Code)
+			assert.Equal(t, tt.message, response.Error.Message)
+			if tt.failure != "" {
+				failures := response.Data.(map[string]interface{})["failures"].([]appsync.TransactOperationResult)
+				require.Len(t, failures, 1)
+				assert.Equal(t, tt.failure, failures[0].Error)
+			}
+		})
+	}
+}
+
+func TestUnitHandlers_HandleGetHistory(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	handlers := NewUnitHandlers(mockRepo)
+
+	history := &appsync.UnitHistoryResponse{
+		Items: []models.UnitHistoryEntry{{UnitID: "unit-1", Action: models.HistoryUpdate, Version: 2}},
+		Count: 1,
+	}
+	mockRepo.On("GetHistory", mock.Anything, &appsync.GetUnitHistoryInput{
+		AccountID: "test-account-123", ID: "unit-1", UnitType: "commercialVehicleType",
+	}).Return(history, nil)
+
+	event := &appsync.AppSyncEvent{
+		TypeName:  "Query",
+		FieldName: "getUnitHistory",
+		Arguments: json.RawMessage(`{"accountId":"test-account-123","id":"unit-1","unitType":"commercialVehicleType"}`),
+	}
+	response, err := handlers.HandleGetHistory(context.Background(), event)
+	require.NoError(t, err)
+	require.True(t, response.Success)
+	assert.Equal(t, "Retrieved 1 history entries", response.Message)
+	assert.Equal(t, history, response.Data)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUnitHandlers_HandleGetHistoryValidation(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	handlers := NewUnitHandlers(mockRepo)
+
+	event := &appsync.AppSyncEvent{
+		FieldName: "getUnitHistory",
+		Arguments: json.RawMessage(`{"accountId":"test-account-123","id":"unit-1"}`),
+	}
+	response, err := handlers.HandleGetHistory(context.Background(), event)
+	require.NoError(t, err)
+	require.NotNil(t, response.Error)
+	assert.Equal(t, "VALIDATION_ERROR", response.Error.Code)
+	assert.Equal(t, "UnitType is required", response.Error.Message)
+
+	mockRepo.On("GetHistory", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("%w: expired", repository.ErrInvalidPaginationToken))
+	event.Arguments = json.RawMessage(`{"accountId":"test-account-123","id":"unit-1","unitType":"commercialVehicleType","nextToken":"old"}`)
+	response, err = handlers.HandleGetHistory(context.Background(), event)
+	require.NoError(t, err)
+	require.NotNil(t, response.Error)
+	assert.Equal(t, "VALIDATION_ERROR", response.Error.Code)
+	assert.Equal(t, "Invalid nextToken", response.Error.Message)
+}
+
+func TestUnitHandlers_HandleReadAsOf(t *testing.T) {
+	mockRepo := &repository.MockUnitRepository{}
+	handlers := NewUnitHandlers(mockRepo)
+
+	asOf := time.Date(2026, 2, 10, 8, 0, 0, 0, time.UTC)
+	unit := &models.Unit{ID: "unit-1", AccountID: "test-account-123", UnitType: "commercialVehicleType", Note: "yard 7", Version: 2}
+	mockRepo.On("GetAsOf", mock.Anything, "test-account-123", "unit-1", "commercialVehicleType", mock.MatchedBy(asOf.Equal)).Return(unit, nil).Once()
+
+	event := &appsync.AppSyncEvent{
+		FieldName: "getUnit",
+		Arguments: json.RawMessage(`{"id":"unit-1","accountId":"test-account-123","unitType":"commercialVehicleType","asOf":"2026-02-10T09:00:00+01:00"}`),
+	}
+	response, err := handlers.HandleRead(context.Background(), event)
+	require.NoError(t, err)
+	require.True(t, response.Success)
+	assert.Equal(t, unit, response.Data)
+
+	mockRepo.On("GetAsOf", mock.Anything, "test-account-123", "unit-1", "commercialVehicleType", mock.Anything).Return(nil, repository.ErrHistoryIncomplete).Once()
+	response, err = handlers.HandleRead(context.Background(), event)
+	require.NoError(t, err)
+	require.NotNil(t, response.Error)
+	assert.Equal(t, "HISTORY_UNAVAILABLE", response.Error.Code)
+
+	event.Arguments = json.RawMessage(`{"id":"unit-1","accountId":"test-account-123","unitType":"commercialVehicleType","asOf":"last tuesday"}`)
+	response, err = handlers.HandleRead(context.Background(), event)
+	require.NoError(t, err)
+	require.NotNil(t, response.Error)
+	assert.Equal(t, "VALIDATION_ERROR", response.Error.Code)
+
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "GetByKey", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
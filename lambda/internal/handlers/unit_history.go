@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/steverhoton/unt-units-svc/internal/repository"
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+// HandleGetHistory handles requests to list the recorded changes to a unit, newest first
+func (h *UnitHandlers) HandleGetHistory(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("HandleGetHistory called with event: %+v", event)
+	return handleGetHistory(ctx, event, h.repo.GetHistory)
+}
+
+// HandleGetHistory handles requests to list the recorded changes to a dynamic unit, newest first
+func (h *DynamicUnitHandlers) HandleGetHistory(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("DynamicUnitHandlers.HandleGetHistory called with event: %+v", event)
+	return handleGetHistory(ctx, event, h.repo.GetHistory)
+}
+
+// handleGetHistory validates a getUnitHistory request and answers it with a page read by getHistory
+func handleGetHistory(ctx context.Context, event *appsync.AppSyncEvent, getHistory func(context.Context, *appsync.GetUnitHistoryInput) (*appsync.UnitHistoryResponse, error)) (*appsync.Response, error) {
+	// Parse arguments
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error()), nil
+	}
+
+	input, ok := args.(appsync.GetUnitHistoryInput)
+	if !ok {
+		log.Printf("Invalid input type for get history operation")
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for get history operation", ""), nil
+	}
+
+	// Validate required fields
+	if input.ID == "" {
+		log.Printf("Missing required field: id")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "ID is required", ""), nil
+	}
+	if input.AccountID == "" {
+		log.Printf("Missing required field: accountId")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "AccountID is required", ""), nil
+	}
+	if input.UnitType == "" {
+		log.Printf("Missing required field: unitType")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "UnitType is required", ""), nil
+	}
+
+	// Retrieve the history of the unit
+	result, err := getHistory(ctx, &input)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidPaginationToken) {
+			log.Printf("Rejected pagination token: %v", err)
+			return appsync.NewErrorResponse("VALIDATION_ERROR", "Invalid nextToken", err.Error()), nil
+		}
+		log.Printf("Error retrieving unit history: %v", err)
+		return appsync.NewErrorResponse("READ_FAILED", "Failed to retrieve unit history", err.Error()), nil
+	}
+
+	log.Printf("Unit history retrieved successfully: %d entries", result.Count)
+	return appsync.NewSuccessResponse(result, fmt.Sprintf("Retrieved %d history entries", result.Count)), nil
+}
+
+// readAsOf answers a getUnit with asOf by rebuilding the unit from its history
+func (h *UnitHandlers) readAsOf(ctx context.Context, input appsync.GetUnitInput) (*appsync.Response, error) {
+	asOf, err := time.Parse(time.RFC3339Nano, *input.AsOf)
+	if err != nil {
+		log.Printf("Invalid asOf %q: %v", *input.AsOf, err)
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "asOf must be an RFC 3339 timestamp", err.Error()), nil
+	}
+
+	unit, err := h.repo.GetAsOf(ctx, input.AccountID, input.ID, input.UnitType, asOf)
+	if err != nil {
+		if errors.Is(err, repository.ErrHistoryIncomplete) {
+			log.Printf("Unit %s has no history from its creation", input.ID)
+			return appsync.NewErrorResponse("HISTORY_UNAVAILABLE", "Unit history does not cover the requested time", err.Error()), nil
+		}
+		log.Printf("Error rebuilding unit from history: %v", err)
+		return appsync.NewErrorResponse("READ_FAILED", "Failed to retrieve unit", err.Error()), nil
+	}
+
+	if unit == nil {
+		log.Printf("Unit not found with ID: %s, type: %s for account: %s as of %s", input.ID, input.UnitType, input.AccountID, *input.AsOf)
+		return appsync.NewErrorResponse("NOT_FOUND", "Unit not found", ""), nil
+	}
+
+	log.Printf("Unit rebuilt with ID: %s at version %d as of %s", unit.ID, unit.Version, *input.AsOf)
+	return appsync.NewSuccessResponse(unit, "Unit retrieved successfully"), nil
+}
+
+// readAsOf answers a getUnit with asOf for a dynamic unit by rebuilding it from its history
+func (h *DynamicUnitHandlers) readAsOf(ctx context.Context, input appsync.GetUnitInput) (*appsync.Response, error) {
+	asOf, err := time.Parse(time.RFC3339Nano, *input.AsOf)
+	if err != nil {
+		log.Printf("Invalid asOf %q: %v", *input.AsOf, err)
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "asOf must be an RFC 3339 timestamp", err.Error()), nil
+	}
+
+	unit, err := h.repo.GetAsOf(ctx, input.AccountID, input.ID, input.UnitType, asOf)
+	if err != nil {
+		if errors.Is(err, repository.ErrHistoryIncomplete) {
+			log.Printf("Unit %s has no history from its creation", input.ID)
+			return appsync.NewErrorResponse("HISTORY_UNAVAILABLE", "Unit history does not cover the requested time", err.Error()), nil
+		}
+		log.Printf("Error rebuilding unit from history: %v", err)
+		return appsync.NewErrorResponse("READ_FAILED", "Failed to retrieve unit", err.Error()), nil
+	}
+
+	if unit == nil {
+		log.Printf("Unit not found with ID: %s, type: %s for account: %s as of %s", input.ID, input.UnitType, input.AccountID, *input.AsOf)
+		return appsync.NewErrorResponse("NOT_FOUND", "Unit not found", ""), nil
+	}
+
+	log.Printf("Unit rebuilt with ID: %s at version %d as of %s", unit.ID, unit.Version, *input.AsOf)
+	return appsync.NewSuccessResponse(unit, "Unit retrieved successfully"), nil
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/steverhoton/unt-units-svc/internal/importer"
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+// parseImportPayload reads the rows of an importUnits payload, returning an error
+// response when the payload as a whole is unusable
+func parseImportPayload(input appsync.ImportUnitsInput) ([]importer.Row, *appsync.Response) {
+	format, err := importer.ParseFormat(input.Format)
+	if err != nil {
+		return nil, appsync.NewErrorResponse("VALIDATION_ERROR", "Invalid import format", err.Error())
+	}
+	if strings.TrimSpace(input.Payload) == "" {
+		return nil, appsync.NewErrorResponse("VALIDATION_ERROR", "Payload is required", "")
+	}
+
+	rows, err := importer.Parse(strings.NewReader(input.Payload), format)
+	if err != nil {
+		return nil, appsync.NewErrorResponse("VALIDATION_ERROR", "Invalid import payload", err.Error())
+	}
+	if len(rows) == 0 {
+		return nil, appsync.NewErrorResponse("VALIDATION_ERROR", "Payload has no rows", "")
+	}
+	if len(rows) > importer.MaxRows {
+		return nil, appsync.NewErrorResponse("VALIDATION_ERROR",
+			fmt.Sprintf("Payload has %d rows; at most %d can be imported at once", len(rows), importer.MaxRows), "")
+	}
+	return rows, nil
+}
+
+// HandleImport creates units in bulk from a CSV or NDJSON payload. Rows are
+// validated and written independently; the response reports the outcome of each.
+func (h *UnitHandlers) HandleImport(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("HandleImport called for field %s", event.FieldName)
+
+	// Parse arguments
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error()), nil
+	}
+
+	input, ok := args.(appsync.ImportUnitsInput)
+	if !ok {
+		log.Printf("Invalid input type for import operation")
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for import operation", ""), nil
+	}
+
+	// Validate required fields
+	if input.AccountID == "" {
+		log.Printf("Missing required field: accountId")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "AccountID is required", ""), nil
+	}
+	if input.UnitType == "" {
+		log.Printf("Missing required field: unitType")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "UnitType is required", ""), nil
+	}
+
+	rows, response := parseImportPayload(input)
+	if response != nil {
+		log.Printf("Rejected import for account %s: %s", input.AccountID, response.Error.Message)
+		return response, nil
+	}
+
+	report := importer.New(h.repo).Import(ctx, input.AccountID, input.UnitType, rows)
+
+	return appsync.NewSuccessResponse(report, fmt.Sprintf("Imported %d of %d units", report.Succeeded, report.Total)), nil
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/internal/repository"
+	"github.com/steverhoton/unt-units-svc/internal/vin"
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+// transactOperation turns an operation of a transactUnits request into a repository
+// operation, validating it like the single-unit mutation of the same kind
+func transactOperation(input appsync.TransactOperationInput) (repository.TransactOp, error) {
+	op := repository.TransactOp{
+		Type:    repository.TransactOpType(input.Type),
+		UnitKey: repository.UnitKey{ID: input.ID, UnitType: input.UnitType},
+	}
+	if input.UnitType == "" {
+		return op, errors.New("unitType is required")
+	}
+
+	switch op.Type {
+	case repository.TransactCreate:
+		if isEmptyJSON(input.Unit) {
+			return op, errors.New("unit is required")
+		}
+		// Field names must match exactly and service-maintained fields cannot be set,
+		// as in updates, so field policies see every field that is written
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(input.Unit, &fields); err != nil {
+			return op, fmt.Errorf("invalid unit: %w", err)
+		}
+		unit, err := models.UnitFromFields(fields)
+		if err != nil {
+			return op, fmt.Errorf("invalid unit: %w", err)
+		}
+		if unit.SuggestedVin == "" {
+			return op, errors.New("suggestedVin is required")
+		}
+		if err := vin.Validate(vin.Vehicle{
+			VIN:       unit.SuggestedVin,
+			Make:      unit.Make,
+			ModelYear: unit.ModelYear,
+			Exemption: vin.Exemption(input.VinExemption),
+		}); err != nil {
+			return op, err
+		}
+		unit.UnitType = input.UnitType
+		op.Unit = unit
+		return op, nil
+
+	case repository.TransactUpdate, repository.TransactDelete, repository.TransactConditionCheck:
+		if input.ID == "" {
+			return op, errors.New("id is required")
+		}
+		if input.ExpectedVersion == nil {
+			return op, errors.New("expectedVersion is required")
+		}
+		op.ExpectedVersion = *input.ExpectedVersion
+		if op.Type != repository.TransactUpdate {
+			return op, nil
+		}
+
+		// Only the fields present in the update are changed; null clears optional fields
+		var fields map[string]json.RawMessage
+		if !isEmptyJSON(input.Unit) {
+			if err := json.Unmarshal(input.Unit, &fields); err != nil {
+				return op, fmt.Errorf("invalid unit: %w", err)
+			}
+		}
+		for _, name := range updateControlFields {
+			delete(fields, name)
+		}
+		patch, err := models.NewUnitPatch(fields)
+		if err != nil {
+			return op, err
+		}
+		if patch.IsEmpty() {
+			return op, errors.New("no fields to update")
+		}
+		op.Patch = patch
+		return op, nil
+
+	default:
+		return op, fmt.Errorf("unsupported operation type %q", input.Type)
+	}
+}
+
+// transactErrorCode returns the error code of an operation that caused a transaction
+// to be canceled, matching the codes of the single-unit mutations
+func transactErrorCode(err error) string {
+	var conflict *repository.VersionConflictError
+	var duplicateVin *repository.DuplicateVinError
+	switch {
+	case errors.As(err, &conflict):
+		return "CONFLICT"
+	case errors.As(err, &duplicateVin):
+		return "DUPLICATE_VIN"
+	case errors.Is(err, repository.ErrUnitNotFound):
+		return "NOT_FOUND"
+	case errors.Is(err, repository.ErrUnitAlreadyDeleted):
+		return "ALREADY_DELETED"
+	case errors.Is(err, repository.ErrUnitAlreadyExists):
+		return "ALREADY_EXISTS"
+	case errors.Is(err, repository.ErrTransactionConflict):
+		return "TRANSACTION_CONFLICT"
+	}
+	return "WRITE_FAILED"
+}
+
+// transactFailureResponse reports the operations that failed a transaction so that
+// clients can highlight them
+func transactFailureResponse(code, message, details string, failures []appsync.TransactOperationResult) *appsync.Response {
+	response := appsync.NewErrorResponse(code, message, details)
+	response.Data = map[string]interface{}{
+		"failures": failures,
+	}
+	return response
+}
+
+// HandleTransact applies creates, updates, deletes and condition checks to units of
+// an account in one transaction, so either all of them are applied or none is. A
+// canceled transaction reports why each operation at fault failed.
+func (h *UnitHandlers) HandleTransact(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("HandleTransact called for field %s", event.FieldName)
+
+	// Parse arguments
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error()), nil
+	}
+
+	input, ok := args.(appsync.TransactUnitsInput)
+	if !ok {
+		log.Printf("Invalid input type for transact operation")
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for transact operation", ""), nil
+	}
+
+	// Validate required fields
+	if input.AccountID == "" {
+		log.Printf("Missing required field: accountId")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "AccountID is required", ""), nil
+	}
+	if len(input.Operations) == 0 {
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "Operations are required", ""), nil
+	}
+	if len(input.Operations) > repository.MaxTransactItems {
+		return appsync.NewErrorResponse("VALIDATION_ERROR",
+			fmt.Sprintf("Transaction has %d operations; at most %d are allowed", len(input.Operations), repository.MaxTransactItems), ""), nil
+	}
+
+	results := make([]appsync.TransactOperationResult, len(input.Operations))
+	ops := make([]repository.TransactOp, len(input.Operations))
+	var invalid []appsync.TransactOperationResult
+	for i, operation := range input.Operations {
+		results[i] = appsync.TransactOperationResult{Index: i, Type: operation.Type, ID: operation.ID, UnitType: operation.UnitType}
+		op, err := transactOperation(operation)
+		if err != nil {
+			failure := results[i]
+			failure.Code, failure.Error = "VALIDATION_ERROR", err.Error()
+			invalid = append(invalid, failure)
+			continue
+		}
+		ops[i] = op
+	}
+	if len(invalid) > 0 {
+		log.Printf("Rejected transaction for account %s: %d invalid operations", input.AccountID, len(invalid))
+		return transactFailureResponse("VALIDATION_ERROR", "Invalid transaction operations", "", invalid), nil
+	}
+
+	err = h.repo.TransactWrite(ctx, input.AccountID, ops, event.Identity.Principal())
+	if err != nil {
+		var canceled *repository.TransactionCanceledError
+		if !errors.As(err, &canceled) {
+			log.Printf("Error writing transaction for account %s: %v", input.AccountID, err)
+			return appsync.NewErrorResponse("TRANSACT_FAILED", "Failed to write transaction", err.Error()), nil
+		}
+
+		var failures []appsync.TransactOperationResult
+		for i, opErr := range canceled.Errors {
+			if opErr == nil || i >= len(results) {
+				continue
+			}
+			failure := results[i]
+			failure.Code, failure.Error = transactErrorCode(opErr), opErr.Error()
+			failures = append(failures, failure)
+		}
+		log.Printf("Transaction canceled for account %s: %v", input.AccountID, err)
+		return transactFailureResponse("TRANSACTION_CANCELED", "Transaction was canceled", err.Error(), failures), nil
+	}
+
+	for i, op := range ops {
+		switch op.Type {
+		case repository.TransactCreate:
+			results[i].ID = op.Unit.ID
+			results[i].Version = op.Unit.Version
+			results[i].Unit = op.Unit
+		case repository.TransactConditionCheck:
+			results[i].Version = op.ExpectedVersion
+		default:
+			results[i].Version = op.ExpectedVersion + 1
+		}
+	}
+
+	log.Printf("Transaction of %d operations applied for account %s", len(ops), input.AccountID)
+	return appsync.NewSuccessResponse(&appsync.TransactUnitsResponse{Results: results},
+		fmt.Sprintf("Applied %d operations", len(ops))), nil
+}
@@ -0,0 +1,371 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/steverhoton/unt-units-svc/internal/auth"
+	"github.com/steverhoton/unt-units-svc/internal/events"
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/internal/repository"
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+// WebhookHandlers contains handlers for accounts' webhook subscriptions. The
+// accountId of every request is checked against the caller's identity before
+// anything is read or written.
+type WebhookHandlers struct {
+	repo       repository.WebhookRepository
+	authorizer *auth.Authorizer
+}
+
+// NewWebhookHandlers creates a new instance of WebhookHandlers
+func NewWebhookHandlers(repo repository.WebhookRepository, authorizer *auth.Authorizer) *WebhookHandlers {
+	return &WebhookHandlers{
+		repo:       repo,
+		authorizer: authorizer,
+	}
+}
+
+// HandleCreateSubscription handles requests subscribing an endpoint to an account's
+// unit changes. The response is the only one that includes the signing secret.
+func (h *WebhookHandlers) HandleCreateSubscription(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("HandleCreateSubscription called for field: %s", event.FieldName)
+
+	// Parse arguments
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error()), nil
+	}
+
+	input, ok := args.(appsync.CreateWebhookSubscriptionInput)
+	if !ok {
+		log.Printf("Invalid input type for create webhook subscription operation")
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for create webhook subscription operation", ""), nil
+	}
+
+	// Validate required fields
+	if input.AccountID == "" {
+		log.Printf("Missing required field: accountId")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "AccountID is required", ""), nil
+	}
+	if response := authorizeAccount(ctx, h.authorizer, event, input.AccountID); response != nil {
+		return response, nil
+	}
+	if err := validateSubscriptionFilters(input.EventTypes, input.UnitTypes); err != nil {
+		log.Printf("Invalid webhook subscription filters: %v", err)
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "Invalid webhook subscription", err.Error()), nil
+	}
+
+	subscription, err := models.NewWebhookSubscription(input.AccountID, input.URL, input.Secret, input.EventTypes, input.UnitTypes)
+	if err != nil {
+		log.Printf("Error creating webhook subscription: %v", err)
+		return appsync.NewErrorResponse("CREATE_FAILED", "Failed to create webhook subscription", err.Error()), nil
+	}
+	if err := subscription.Validate(); err != nil {
+		log.Printf("Invalid webhook subscription: %v", err)
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "Invalid webhook subscription", err.Error()), nil
+	}
+
+	if err := h.repo.Create(ctx, subscription); err != nil {
+		log.Printf("Error creating webhook subscription: %v", err)
+		return appsync.NewErrorResponse("CREATE_FAILED", "Failed to create webhook subscription", err.Error()), nil
+	}
+
+	log.Printf("Webhook subscription created successfully with ID: %s for account: %s", subscription.ID, subscription.AccountID)
+	return appsync.NewSuccessResponse(subscription, "Webhook subscription created successfully"), nil
+}
+
+// HandleGetSubscription handles requests for one webhook subscription
+func (h *WebhookHandlers) HandleGetSubscription(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("HandleGetSubscription called for field: %s", event.FieldName)
+
+	input, response := h.subscriptionKey(ctx, event)
+	if response != nil {
+		return response, nil
+	}
+
+	subscription, err := h.repo.Get(ctx, input.AccountID, input.ID)
+	if err != nil {
+		log.Printf("Error retrieving webhook subscription: %v", err)
+		return appsync.NewErrorResponse("READ_FAILED", "Failed to retrieve webhook subscription", err.Error()), nil
+	}
+	if subscription == nil {
+		log.Printf("Webhook subscription not found: %s for account: %s", input.ID, input.AccountID)
+		return appsync.NewErrorResponse("NOT_FOUND", "Webhook subscription not found", ""), nil
+	}
+
+	log.Printf("Webhook subscription retrieved successfully: %s", subscription.ID)
+	return appsync.NewSuccessResponse(subscription.Redacted(), "Webhook subscription retrieved successfully"), nil
+}
+
+// HandleListSubscriptions handles requests listing an account's webhook subscriptions
+func (h *WebhookHandlers) HandleListSubscriptions(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("HandleListSubscriptions called for field: %s", event.FieldName)
+
+	// Parse arguments
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error()), nil
+	}
+
+	input, ok := args.(appsync.ListWebhookSubscriptionsInput)
+	if !ok {
+		log.Printf("Invalid input type for list webhook subscriptions operation")
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for list webhook subscriptions operation", ""), nil
+	}
+
+	// Validate required fields
+	if input.AccountID == "" {
+		log.Printf("Missing required field: accountId")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "AccountID is required", ""), nil
+	}
+	if response := authorizeAccount(ctx, h.authorizer, event, input.AccountID); response != nil {
+		return response, nil
+	}
+
+	result, err := h.repo.List(ctx, &input)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidPaginationToken) {
+			log.Printf("Rejected pagination token: %v", err)
+			return appsync.NewErrorResponse("VALIDATION_ERROR", "Invalid nextToken", err.Error()), nil
+		}
+		log.Printf("Error listing webhook subscriptions: %v", err)
+		return appsync.NewErrorResponse("LIST_FAILED", "Failed to list webhook subscriptions", err.Error()), nil
+	}
+	for i := range result.Items {
+		result.Items[i] = result.Items[i].Redacted()
+	}
+
+	log.Printf("Webhook subscriptions listed successfully: %d items", result.Count)
+	return appsync.NewSuccessResponse(result, fmt.Sprintf("Retrieved %d webhook subscriptions", result.Count)), nil
+}
+
+// HandleUpdateSubscription handles requests changing a webhook subscription. A
+// rotated secret is returned in the response; it cannot be read again later.
+func (h *WebhookHandlers) HandleUpdateSubscription(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("HandleUpdateSubscription called for field: %s", event.FieldName)
+
+	// Parse arguments
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error()), nil
+	}
+
+	input, ok := args.(appsync.UpdateWebhookSubscriptionInput)
+	if !ok {
+		log.Printf("Invalid input type for update webhook subscription operation")
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for update webhook subscription operation", ""), nil
+	}
+
+	// Validate required fields
+	if input.ID == "" {
+		log.Printf("Missing required field: id")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "ID is required", ""), nil
+	}
+	if input.AccountID == "" {
+		log.Printf("Missing required field: accountId")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "AccountID is required", ""), nil
+	}
+	if response := authorizeAccount(ctx, h.authorizer, event, input.AccountID); response != nil {
+		return response, nil
+	}
+
+	patch, err := subscriptionPatch(input)
+	if err != nil {
+		log.Printf("Invalid webhook subscription update: %v", err)
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "Invalid webhook subscription update", err.Error()), nil
+	}
+
+	subscription, err := h.repo.Update(ctx, input.AccountID, input.ID, patch)
+	if err != nil {
+		if errors.Is(err, repository.ErrWebhookSubscriptionNotFound) {
+			log.Printf("Webhook subscription not found: %s for account: %s", input.ID, input.AccountID)
+			return appsync.NewErrorResponse("NOT_FOUND", "Webhook subscription not found", ""), nil
+		}
+		log.Printf("Error updating webhook subscription: %v", err)
+		return appsync.NewErrorResponse("UPDATE_FAILED", "Failed to update webhook subscription", err.Error()), nil
+	}
+
+	result := subscription.Redacted()
+	if input.RotateSecret {
+		result.Secret = *patch.Secret
+	}
+
+	log.Printf("Webhook subscription updated successfully: %s", subscription.ID)
+	return appsync.NewSuccessResponse(result, "Webhook subscription updated successfully"), nil
+}
+
+// HandleDeleteSubscription handles requests removing a webhook subscription
+func (h *WebhookHandlers) HandleDeleteSubscription(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("HandleDeleteSubscription called for field: %s", event.FieldName)
+
+	input, response := h.subscriptionKey(ctx, event)
+	if response != nil {
+		return response, nil
+	}
+
+	if err := h.repo.Delete(ctx, input.AccountID, input.ID); err != nil {
+		if errors.Is(err, repository.ErrWebhookSubscriptionNotFound) {
+			log.Printf("Webhook subscription not found: %s for account: %s", input.ID, input.AccountID)
+			return appsync.NewErrorResponse("NOT_FOUND", "Webhook subscription not found", ""), nil
+		}
+		log.Printf("Error deleting webhook subscription: %v", err)
+		return appsync.NewErrorResponse("DELETE_FAILED", "Failed to delete webhook subscription", err.Error()), nil
+	}
+
+	result := map[string]interface{}{
+		"id":        input.ID,
+		"accountId": input.AccountID,
+		"deleted":   true,
+	}
+
+	log.Printf("Webhook subscription deleted successfully: %s for account: %s", input.ID, input.AccountID)
+	return appsync.NewSuccessResponse(result, "Webhook subscription deleted successfully"), nil
+}
+
+// HandleListDeliveries handles requests listing a webhook subscription's delivery attempts, newest first
+func (h *WebhookHandlers) HandleListDeliveries(ctx context.Context, event *appsync.AppSyncEvent) (*appsync.Response, error) {
+	log.Printf("HandleListDeliveries called for field: %s", event.FieldName)
+
+	// Parse arguments
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error()), nil
+	}
+
+	input, ok := args.(appsync.ListWebhookDeliveriesInput)
+	if !ok {
+		log.Printf("Invalid input type for list webhook deliveries operation")
+		return appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for list webhook deliveries operation", ""), nil
+	}
+
+	// Validate required fields
+	if input.ID == "" {
+		log.Printf("Missing required field: id")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "ID is required", ""), nil
+	}
+	if input.AccountID == "" {
+		log.Printf("Missing required field: accountId")
+		return appsync.NewErrorResponse("VALIDATION_ERROR", "AccountID is required", ""), nil
+	}
+	if response := authorizeAccount(ctx, h.authorizer, event, input.AccountID); response != nil {
+		return response, nil
+	}
+
+	result, err := h.repo.ListDeliveries(ctx, &input)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidPaginationToken) {
+			log.Printf("Rejected pagination token: %v", err)
+			return appsync.NewErrorResponse("VALIDATION_ERROR", "Invalid nextToken", err.Error()), nil
+		}
+		log.Printf("Error listing webhook deliveries: %v", err)
+		return appsync.NewErrorResponse("LIST_FAILED", "Failed to list webhook deliveries", err.Error()), nil
+	}
+
+	log.Printf("Webhook deliveries listed successfully: %d items", result.Count)
+	return appsync.NewSuccessResponse(result, fmt.Sprintf("Retrieved %d webhook deliveries", result.Count)), nil
+}
+
+// subscriptionKey parses, validates and authorizes the key of a get or delete
+// request, returning an error response when it is not acceptable
+func (h *WebhookHandlers) subscriptionKey(ctx context.Context, event *appsync.AppSyncEvent) (appsync.WebhookSubscriptionKeyInput, *appsync.Response) {
+	args, err := event.ParseArguments()
+	if err != nil {
+		log.Printf("Error parsing arguments: %v", err)
+		return appsync.WebhookSubscriptionKeyInput{}, appsync.NewErrorResponse("INVALID_INPUT", "Invalid input parameters", err.Error())
+	}
+
+	input, ok := args.(appsync.WebhookSubscriptionKeyInput)
+	if !ok {
+		log.Printf("Invalid input type for %s operation", event.FieldName)
+		return input, appsync.NewErrorResponse("INVALID_INPUT", "Invalid input type for "+event.FieldName+" operation", "")
+	}
+
+	if input.ID == "" {
+		log.Printf("Missing required field: id")
+		return input, appsync.NewErrorResponse("VALIDATION_ERROR", "ID is required", "")
+	}
+	if input.AccountID == "" {
+		log.Printf("Missing required field: accountId")
+		return input, appsync.NewErrorResponse("VALIDATION_ERROR", "AccountID is required", "")
+	}
+	return input, authorizeAccount(ctx, h.authorizer, event, input.AccountID)
+}
+
+// subscriptionPatch validates an update request and returns the changes it makes
+func subscriptionPatch(input appsync.UpdateWebhookSubscriptionInput) (*models.WebhookSubscriptionPatch, error) {
+	patch := &models.WebhookSubscriptionPatch{
+		URL:        input.URL,
+		Secret:     input.Secret,
+		EventTypes: input.EventTypes,
+		UnitTypes:  input.UnitTypes,
+	}
+
+	if input.URL != nil {
+		if err := models.ValidateWebhookURL(*input.URL); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case input.RotateSecret && input.Secret != nil:
+		return nil, errors.New("secret and rotateSecret cannot both be given")
+	case input.RotateSecret:
+		secret, err := models.GenerateWebhookSecret()
+		if err != nil {
+			return nil, err
+		}
+		patch.Secret = &secret
+	case input.Secret != nil:
+		if err := models.ValidateWebhookSecret(*input.Secret); err != nil {
+			return nil, err
+		}
+	}
+
+	var eventTypes, unitTypes []string
+	if input.EventTypes != nil {
+		eventTypes = *input.EventTypes
+	}
+	if input.UnitTypes != nil {
+		unitTypes = *input.UnitTypes
+	}
+	if err := validateSubscriptionFilters(eventTypes, unitTypes); err != nil {
+		return nil, err
+	}
+
+	if input.Enabled != nil {
+		status := models.WebhookDisabled
+		if *input.Enabled {
+			status = models.WebhookActive
+		}
+		patch.Status = &status
+	}
+
+	if patch.URL == nil && patch.Secret == nil && patch.EventTypes == nil && patch.UnitTypes == nil && patch.Status == nil {
+		return nil, errors.New("nothing to update")
+	}
+	return patch, nil
+}
+
+// validateSubscriptionFilters checks that a subscription's event types are known
+// and its unit types are not blank
+func validateSubscriptionFilters(eventTypes, unitTypes []string) error {
+	for _, eventType := range eventTypes {
+		if !events.IsType(eventType) {
+			return fmt.Errorf("unknown event type %q; use %s, %s or %s", eventType, events.UnitCreated, events.UnitUpdated, events.UnitDeleted)
+		}
+	}
+	for _, unitType := range unitTypes {
+		if strings.TrimSpace(unitType) == "" {
+			return errors.New("unit types must not be blank")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+// Package importer creates units in bulk from CSV or NDJSON payloads. Each row is
+// validated like a createUnit request, the valid rows are written with batched
+// writes, and the outcome of every row is reported.
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/internal/repository"
+	"github.com/steverhoton/unt-units-svc/internal/vin"
+)
+
+// MaxRows is the most rows one importUnits request may carry. The CLI has no limit.
+const MaxRows = 1000
+
+// Row outcome codes, matching the error codes of createUnit
+const (
+	CodeValidationError = "VALIDATION_ERROR"
+	CodeDuplicateVin    = "DUPLICATE_VIN"
+	CodeCreateFailed    = "CREATE_FAILED"
+)
+
+// RowResult is the outcome of importing one row
+type RowResult struct {
+	Line    int    `json:"line"`
+	Success bool   `json:"success"`
+	ID      string `json:"id,omitempty"`    // ID of the created unit
+	Code    string `json:"code,omitempty"`  // Why the row failed
+	Error   string `json:"error,omitempty"` // Details of the failure
+}
+
+// Report is the outcome of an import, with one result per row in payload order
+type Report struct {
+	Total     int         `json:"total"`
+	Succeeded int         `json:"succeeded"`
+	Failed    int         `json:"failed"`
+	Rows      []RowResult `json:"rows"`
+}
+
+// Importer writes parsed rows to a unit repository
+type Importer struct {
+	repo repository.UnitRepository
+}
+
+// New creates an importer writing to repo
+func New(repo repository.UnitRepository) *Importer {
+	return &Importer{repo: repo}
+}
+
+// Import validates rows and creates a unit of unitType in accountID for each valid
+// one. Rows that fail validation are reported without being written.
+func (i *Importer) Import(ctx context.Context, accountID, unitType string, rows []Row) *Report {
+	results := make([]RowResult, len(rows))
+	var units []*models.Unit
+	var positions []int
+
+	vins := make(map[string]int, len(rows))
+	for n, row := range rows {
+		results[n] = RowResult{Line: row.Line}
+		if err := validateRow(row, vins); err != nil {
+			results[n].Code = CodeValidationError
+			results[n].Error = err.Error()
+			continue
+		}
+
+		row.Unit.AccountID = accountID
+		row.Unit.UnitType = unitType
+		units = append(units, row.Unit)
+		positions = append(positions, n)
+	}
+
+	if len(units) > 0 {
+		errs := i.repo.BatchCreate(ctx, units)
+		for j, n := range positions {
+			var err error
+			if j < len(errs) {
+				err = errs[j]
+			}
+			if err == nil {
+				results[n].Success = true
+				results[n].ID = units[j].ID
+				continue
+			}
+
+			results[n].Code = CodeCreateFailed
+			var duplicateVin *repository.DuplicateVinError
+			if errors.As(err, &duplicateVin) {
+				results[n].Code = CodeDuplicateVin
+			}
+			results[n].Error = err.Error()
+		}
+	}
+
+	report := &Report{Total: len(rows), Rows: results}
+	for _, result := range results {
+		if result.Success {
+			report.Succeeded++
+		} else {
+			report.Failed++
+		}
+	}
+
+	log.Printf("Import of %d rows for account %s: %d succeeded, %d failed", report.Total, accountID, report.Succeeded, report.Failed)
+	return report
+}
+
+// validateRow applies the createUnit checks to a row and rejects a VIN that an
+// earlier row of the payload already uses. vins maps each VIN seen to its line.
+func validateRow(row Row, vins map[string]int) error {
+	if row.Err != nil {
+		return row.Err
+	}
+	if row.Unit == nil {
+		return errors.New("row has no unit")
+	}
+	if row.Unit.SuggestedVin == "" {
+		return errors.New("suggestedVin is required")
+	}
+
+	if err := vin.Validate(vin.Vehicle{
+		VIN:       row.Unit.SuggestedVin,
+		Make:      row.Unit.Make,
+		ModelYear: row.Unit.ModelYear,
+		Exemption: row.VinExemption,
+	}); err != nil {
+		return err
+	}
+
+	normalized := models.NormalizeVin(row.Unit.SuggestedVin)
+	if line, ok := vins[normalized]; ok {
+		return fmt.Errorf("VIN %s is already used on line %d", normalized, line)
+	}
+	vins[normalized] = row.Line
+	return nil
+}
@@ -0,0 +1,67 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/internal/repository"
+)
+
+func TestImporter_Import(t *testing.T) {
+	payload := `{"suggestedVin": "1M1AN07Y9GM012345", "make": "Mack"}
+{"suggestedVin": "1M1AN07Y9GM012346", "make": "Mack"}
+{"make": "Mack"}
+{"suggestedVin": "1m1an07y9gm012345"}
+{"suggestedVin": "1HGBH41JXMN109186", "make": "Honda"}
+{"suggestedVin": "1XKAD49X5CJ123456", "make": "Kenworth"}
+`
+	rows, err := Parse(strings.NewReader(payload), FormatNDJSON)
+	require.NoError(t, err)
+
+	repo := new(repository.MockUnitRepository)
+	repo.On("BatchCreate", mock.Anything, mock.MatchedBy(func(units []*models.Unit) bool {
+		return len(units) == 3 && units[0].AccountID == "account-1" && units[0].UnitType == "commercialVehicleType"
+	})).Run(func(args mock.Arguments) {
+		for n, unit := range args.Get(1).([]*models.Unit) {
+			unit.ID = []string{"unit-1", "unit-5", "unit-6"}[n]
+		}
+	}).Return([]error{
+		nil,
+		&repository.DuplicateVinError{Vin: "1HGBH41JXMN109186", UnitID: "unit-9"},
+		errors.New("throttled"),
+	})
+
+	report := New(repo).Import(context.Background(), "account-1", "commercialVehicleType", rows)
+
+	assert.Equal(t, 6, report.Total)
+	assert.Equal(t, 1, report.Succeeded)
+	assert.Equal(t, 5, report.Failed)
+	require.Len(t, report.Rows, 6)
+
+	assert.Equal(t, RowResult{Line: 1, Success: true, ID: "unit-1"}, report.Rows[0])
+
+	assert.Equal(t, CodeValidationError, report.Rows[1].Code)
+	assert.Contains(t, report.Rows[1].Error, "check digit")
+	assert.Equal(t, RowResult{Line: 3, Code: CodeValidationError, Error: "suggestedVin is required"}, report.Rows[2])
+	assert.Equal(t, RowResult{Line: 4, Code: CodeValidationError, Error: "VIN 1M1AN07Y9GM012345 is already used on line 1"}, report.Rows[3])
+	assert.Equal(t, RowResult{Line: 5, Code: CodeDuplicateVin, Error: "VIN 1HGBH41JXMN109186 is already used by unit unit-9"}, report.Rows[4])
+	assert.Equal(t, RowResult{Line: 6, Code: CodeCreateFailed, Error: "throttled"}, report.Rows[5])
+
+	repo.AssertExpectations(t)
+}
+
+func TestImporter_ImportWithoutValidRows(t *testing.T) {
+	repo := new(repository.MockUnitRepository)
+
+	report := New(repo).Import(context.Background(), "account-1", "commercialVehicleType", []Row{{Line: 2, Err: errors.New("bad row")}})
+
+	assert.Equal(t, &Report{Total: 1, Failed: 1, Rows: []RowResult{{Line: 2, Code: CodeValidationError, Error: "bad row"}}}, report)
+	repo.AssertNotCalled(t, "BatchCreate", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,241 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/internal/vin"
+)
+
+// Format is the encoding of an import payload
+type Format string
+
+const (
+	// FormatCSV is comma separated values with a header row of unit field names
+	FormatCSV Format = "CSV"
+	// FormatNDJSON is one JSON object of unit fields per line
+	FormatNDJSON Format = "NDJSON"
+)
+
+// exemptionField is the column or key that carries a row's VIN exemption. It is
+// not a unit field, matching the vinExemption argument of createUnit.
+const exemptionField = "vinExemption"
+
+// jsonColumns are the CSV columns whose cells hold JSON rather than plain text
+var jsonColumns = map[string]bool{
+	"extendedAttributes": true,
+	"acesAttributes":     true,
+}
+
+// maxLineBytes caps the length of one NDJSON line
+const maxLineBytes = 1 << 20
+
+// ParseFormat parses a format name, ignoring case. "jsonl" is accepted for NDJSON.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "CSV":
+		return FormatCSV, nil
+	case "NDJSON", "JSONL":
+		return FormatNDJSON, nil
+	}
+	return "", fmt.Errorf("unknown import format %q; use %s or %s", name, FormatCSV, FormatNDJSON)
+}
+
+// FormatFromFilename picks the format from a file extension: .csv, .ndjson or .jsonl
+func FormatFromFilename(name string) (Format, error) {
+	ext := strings.TrimPrefix(filepath.Ext(name), ".")
+	if ext == "" {
+		return "", fmt.Errorf("cannot tell the import format of %s without an extension", name)
+	}
+	return ParseFormat(ext)
+}
+
+// Row is one unit read from an import payload
+type Row struct {
+	Line         int           // Line of the payload the row starts on
+	Unit         *models.Unit  // Nil when the row could not be read
+	Fields       []string      // Unit fields the row sets, sorted
+	VinExemption vin.Exemption // Opts the row out of VIN checks, as on createUnit
+	Err          error         // Why the row cannot be imported
+}
+
+// Parse reads the rows of a payload. Problems with a single row are recorded in
+// its Err; an error is returned only when the payload as a whole cannot be read,
+// such as a CSV header naming a field that does not exist.
+func Parse(r io.Reader, format Format) ([]Row, error) {
+	switch format {
+	case FormatCSV:
+		return parseCSV(r)
+	case FormatNDJSON:
+		return parseNDJSON(r)
+	}
+	return nil, fmt.Errorf("unknown import format %q", format)
+}
+
+// parseCSV reads a header row of unit field names followed by one unit per row.
+// Empty cells leave a field unset.
+func parseCSV(r io.Reader) ([]Row, error) {
+	reader := csv.NewReader(r)
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("CSV payload has no header row")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	columns, err := csvColumns(header)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []Row
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+
+		var line int
+		if record != nil {
+			line, _ = reader.FieldPos(0)
+		}
+		switch {
+		case errors.Is(err, csv.ErrFieldCount):
+			rows = append(rows, Row{Line: line, Err: fmt.Errorf("row has %d columns, header has %d", len(record), len(columns))})
+			continue
+		case err != nil:
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+
+		row := Row{Line: line}
+		fields := make(map[string]json.RawMessage, len(columns))
+		for i, column := range columns {
+			cell := strings.TrimSpace(record[i])
+			switch {
+			case cell == "":
+				continue
+			case column == exemptionField:
+				row.VinExemption = vin.Exemption(cell)
+			case jsonColumns[column]:
+				if !json.Valid([]byte(cell)) {
+					row.Err = fmt.Errorf("column %s must hold JSON", column)
+				}
+				fields[column] = json.RawMessage(cell)
+			default:
+				raw, _ := json.Marshal(cell)
+				fields[column] = raw
+			}
+		}
+		if row.Err == nil {
+			row.setFields(fields)
+		}
+		rows = append(rows, row)
+	}
+}
+
+// csvColumns checks that every header names a settable unit field, or the VIN
+// exemption, exactly once
+func csvColumns(header []string) ([]string, error) {
+	columns := make([]string, len(header))
+	seen := make(map[string]bool, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff") // Byte order mark
+		}
+
+		switch {
+		case name == "":
+			return nil, fmt.Errorf("CSV column %d has no name", i+1)
+		case seen[name]:
+			return nil, fmt.Errorf("CSV column %s appears more than once", name)
+		case models.IsReadOnlyUnitField(name):
+			return nil, fmt.Errorf("CSV column %s cannot be set", name)
+		case name != exemptionField && !models.IsWritableUnitField(name):
+			return nil, fmt.Errorf("unknown CSV column %s", name)
+		}
+		seen[name] = true
+		columns[i] = name
+	}
+	return columns, nil
+}
+
+// parseNDJSON reads one JSON object of unit fields per line. Blank lines are skipped.
+func parseNDJSON(r io.Reader) ([]Row, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineBytes)
+
+	var rows []Row
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		row := Row{Line: line}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(text, &fields); err != nil {
+			row.Err = fmt.Errorf("invalid JSON: %w", err)
+			rows = append(rows, row)
+			continue
+		}
+
+		if raw, ok := fields[exemptionField]; ok {
+			delete(fields, exemptionField)
+			var exemption string
+			if err := json.Unmarshal(raw, &exemption); err != nil && !isEmpty(raw) {
+				row.Err = fmt.Errorf("%s must be a string", exemptionField)
+			}
+			row.VinExemption = vin.Exemption(exemption)
+		}
+		for name, raw := range fields {
+			if isEmpty(raw) {
+				delete(fields, name)
+			}
+		}
+
+		if row.Err == nil {
+			row.setFields(fields)
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read NDJSON: %w", err)
+	}
+	return rows, nil
+}
+
+// setFields builds the row's unit from its fields
+func (row *Row) setFields(fields map[string]json.RawMessage) {
+	unit, err := models.UnitFromFields(fields)
+	if err != nil {
+		row.Err = err
+		return
+	}
+
+	row.Unit = unit
+	row.Fields = make([]string, 0, len(fields))
+	for name := range fields {
+		row.Fields = append(row.Fields, name)
+	}
+	sort.Strings(row.Fields)
+}
+
+// isEmpty reports whether a raw JSON value is null or an empty string
+func isEmpty(raw json.RawMessage) bool {
+	switch string(bytes.TrimSpace(raw)) {
+	case "null", `""`:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/internal/vin"
+)
+
+func TestParseFormat(t *testing.T) {
+	for name, expected := range map[string]Format{"csv": FormatCSV, "NDJSON": FormatNDJSON, "jsonl": FormatNDJSON} {
+		format, err := ParseFormat(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, expected, format, name)
+	}
+	_, err := ParseFormat("xlsx")
+	assert.EqualError(t, err, `unknown import format "xlsx"; use CSV or NDJSON`)
+
+	format, err := FormatFromFilename("/tmp/fleet.ndjson")
+	require.NoError(t, err)
+	assert.Equal(t, FormatNDJSON, format)
+	_, err = FormatFromFilename("fleet")
+	assert.Error(t, err)
+}
+
+func TestParseCSV(t *testing.T) {
+	payload := "\ufeffsuggestedVin,make,modelYear,trim,vinExemption,extendedAttributes\n" +
+		"1M1AN07Y9GM012345,Mack,1986,,,\"[{\"\"attributeName\"\":\"\"fleet\"\",\"\"attributeValue\"\":\"\"north\"\"}]\"\n" +
+		"\n" +
+		"ABC123,Ford,1975,Custom,PRE_1981,\n" +
+		"only,two\n" +
+		"1HGBH41JXMN109186,Honda,1991,,,not json\n"
+
+	rows, err := Parse(strings.NewReader(payload), FormatCSV)
+	require.NoError(t, err)
+	require.Len(t, rows, 4)
+
+	assert.Equal(t, 2, rows[0].Line)
+	require.NoError(t, rows[0].Err)
+	assert.Equal(t, "1M1AN07Y9GM012345", rows[0].Unit.SuggestedVin)
+	assert.Equal(t, "Mack", rows[0].Unit.Make)
+	assert.Nil(t, rows[0].Unit.Trim)
+	assert.Equal(t, []models.ExtendedAttribute{{AttributeName: "fleet", AttributeValue: "north"}}, rows[0].Unit.ExtendedAttributes)
+	assert.Equal(t, []string{"extendedAttributes", "make", "modelYear", "suggestedVin"}, rows[0].Fields)
+
+	assert.Equal(t, 4, rows[1].Line)
+	require.NoError(t, rows[1].Err)
+	assert.Equal(t, vin.ExemptionPre1981, rows[1].VinExemption)
+	require.NotNil(t, rows[1].Unit.Trim)
+	assert.Equal(t, "Custom", *rows[1].Unit.Trim)
+
+	assert.Equal(t, 5, rows[2].Line)
+	assert.EqualError(t, rows[2].Err, "row has 2 columns, header has 6")
+	assert.EqualError(t, rows[3].Err, "column extendedAttributes must hold JSON")
+}
+
+func TestParseCSVHeaderErrors(t *testing.T) {
+	tests := map[string]string{
+		"":                    "CSV payload has no header row",
+		"suggestedVin,colour": "unknown CSV column colour",
+		"suggestedVin,id":     "CSV column id cannot be set",
+		"make,make":           "CSV column make appears more than once",
+		"make,":               "CSV column 2 has no name",
+	}
+	for header, expected := range tests {
+		_, err := Parse(strings.NewReader(header), FormatCSV)
+		assert.EqualError(t, err, expected, header)
+	}
+}
+
+func TestParseNDJSON(t *testing.T) {
+	payload := `{"suggestedVin": "1M1AN07Y9GM012345", "make": "Mack", "trim": null, "series": ""}
+
+{"suggestedVin": "ABC123", "vinExemption": "PRE_1981"}
+{"suggestedVin": "1HGBH41JXMN109186", "colour": "red"}
+{"suggestedVin": "1HGBH41JXMN109186", "id": "unit-1"}
+not json
+`
+
+	rows, err := Parse(strings.NewReader(payload), FormatNDJSON)
+	require.NoError(t, err)
+	require.Len(t, rows, 5)
+
+	assert.Equal(t, 1, rows[0].Line)
+	require.NoError(t, rows[0].Err)
+	assert.Equal(t, []string{"make", "suggestedVin"}, rows[0].Fields)
+	assert.Equal(t, "", rows[0].Unit.Series)
+
+	assert.Equal(t, 3, rows[1].Line)
+	assert.Equal(t, vin.ExemptionPre1981, rows[1].VinExemption)
+	assert.Equal(t, []string{"suggestedVin"}, rows[1].Fields)
+
+	assert.EqualError(t, rows[2].Err, "unknown field colour")
+	assert.EqualError(t, rows[3].Err, "field id cannot be set")
+	assert.Equal(t, 6, rows[4].Line)
+	assert.ErrorContains(t, rows[4].Err, "invalid JSON")
+}
@@ -1,10 +1,8 @@
 package models
 
 import (
-	_ "embed"
 	"fmt"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
@@ -13,73 +11,103 @@ import (
 	"github.com/xeipuuv/gojsonschema"
 )
 
-//go:embed commercialVehicleType.json
-var commercialVehicleTypeSchema []byte
-
-// schemaCache caches compiled JSON schemas
-var schemaCache = make(map[string]*gojsonschema.Schema)
-var schemaCacheMutex sync.RWMutex
-
 // DynamicUnit represents a unit with dynamic structure based on schema
 type DynamicUnit struct {
 	// Core fields present in all units
-	ID        string `json:"id" dynamodbav:"id"`         // Unit UUID
-	AccountID string `json:"accountId" dynamodbav:"pk"`  // Primary Key
-	UnitType  string `json:"unitType" dynamodbav:"sk"`   // Sort Key (unitType#id)
-	
+	ID        string `json:"id" dynamodbav:"id"`        // Unit UUID
+	AccountID string `json:"accountId" dynamodbav:"pk"` // Primary Key
+	UnitType  string `json:"unitType" dynamodbav:"sk"`  // Sort Key (unitType#id)
+
+	// SchemaVersion is the version of the unit type schema the data conforms to.
+	// Items written before versioning was introduced have no version and are treated as version 1.
+	SchemaVersion int `json:"schemaVersion" dynamodbav:"schemaVersion"`
+
 	// Timestamp fields
 	CreatedAt int64 `json:"createdAt" dynamodbav:"createdAt"`
 	UpdatedAt int64 `json:"updatedAt" dynamodbav:"updatedAt"`
 	DeletedAt int64 `json:"deletedAt" dynamodbav:"deletedAt"`
-	
+	ExpiresAt int64 `json:"expiresAt,omitempty" dynamodbav:"expiresAt,omitempty"` // DynamoDB TTL for soft deleted units
+
+	// Optimistic concurrency version, incremented on every write
+	Version int64 `json:"version" dynamodbav:"version"`
+
 	// Dynamic data based on schema
 	Data map[string]interface{} `json:"data" dynamodbav:"data"`
-	
+
 	// Internal fields for processing
 	schema *gojsonschema.Schema `json:"-" dynamodbav:"-"`
 }
 
 // NewDynamicUnit creates a new dynamic unit with the specified unit type
+// bound to the latest version of its schema
 func NewDynamicUnit(unitType string) (*DynamicUnit, error) {
 	schema, err := loadSchema(unitType)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load schema for unit type %s: %w", unitType, err)
 	}
-	
+
 	return &DynamicUnit{
-		UnitType: unitType,
-		Data:     make(map[string]interface{}),
-		schema:   schema,
+		UnitType:      unitType,
+		SchemaVersion: schema.Version,
+		Data:          make(map[string]interface{}),
+		schema:        schema.Compiled(),
 	}, nil
 }
 
+// ensureSchema loads the compiled schema matching the unit's schema version.
+// Units without a version are bound to the latest schema.
+func (du *DynamicUnit) ensureSchema() error {
+	if du.schema != nil {
+		return nil
+	}
+
+	var schema *UnitTypeSchema
+	var err error
+	if du.SchemaVersion > 0 {
+		schema, err = loadSchemaVersion(du.UnitType, du.SchemaVersion)
+	} else {
+		schema, err = loadSchema(du.UnitType)
+	}
+	if err != nil {
+		return err
+	}
+
+	du.schema = schema.Compiled()
+	du.SchemaVersion = schema.Version
+	return nil
+}
+
+// EffectiveSchemaVersion returns the stored schema version, treating unversioned units as version 1
+func (du *DynamicUnit) EffectiveSchemaVersion() int {
+	if du.SchemaVersion < DefaultSchemaVersion {
+		return DefaultSchemaVersion
+	}
+	return du.SchemaVersion
+}
+
 // ValidateAndSetData validates the provided data against the schema and sets it
 func (du *DynamicUnit) ValidateAndSetData(data map[string]interface{}) error {
-	if du.schema == nil {
-		schema, err := loadSchema(du.UnitType)
-		if err != nil {
-			return fmt.Errorf("failed to load schema for validation: %w", err)
-		}
-		du.schema = schema
+	if err := du.ensureSchema(); err != nil {
+		return fmt.Errorf("failed to load schema for validation: %w", err)
 	}
-	
+
 	// Ensure accountId is present as it's required in all schemas
 	if du.AccountID != "" {
 		data["accountId"] = du.AccountID
 	}
-	
+
 	// Inject ID if not present
 	if du.ID != "" {
 		data["id"] = du.ID
 	}
-	
+
 	// Validate against schema
 	documentLoader := gojsonschema.NewGoLoader(data)
 	result, err := du.schema.Validate(documentLoader)
 	if err != nil {
 		return fmt.Errorf("schema validation error: %w", err)
 	}
-	
+
 	if !result.Valid() {
 		var errorMessages []string
 		for _, err := range result.Errors() {
@@ -87,49 +115,36 @@ func (du *DynamicUnit) ValidateAndSetData(data map[string]interface{}) error {
 		}
 		return fmt.Errorf("data validation failed: %s", strings.Join(errorMessages, "; "))
 	}
-	
+
 	du.Data = data
 	return nil
 }
 
-// loadSchema loads and caches a JSON schema from the embedded config
-func loadSchema(unitType string) (*gojsonschema.Schema, error) {
-	schemaCacheMutex.RLock()
-	schema, exists := schemaCache[unitType]
-	schemaCacheMutex.RUnlock()
-	
-	if exists {
-		return schema, nil
-	}
-	
-	// For now, we only support commercialVehicleType
-	if unitType != "commercialVehicleType" {
-		return nil, fmt.Errorf("unsupported unit type: %s", unitType)
-	}
-	
-	// Load schema from embedded data
-	schemaData := commercialVehicleTypeSchema
-	
-	// Parse and compile schema
-	schemaLoader := gojsonschema.NewBytesLoader(schemaData)
-	compiledSchema, err := gojsonschema.NewSchema(schemaLoader)
+// loadSchema returns the latest schema for a unit type from the default registry
+func loadSchema(unitType string) (*UnitTypeSchema, error) {
+	registry, err := DefaultSchemaRegistry()
 	if err != nil {
-		return nil, fmt.Errorf("failed to compile schema: %w", err)
-	}
-	
-	// Cache the compiled schema
-	schemaCacheMutex.Lock()
-	schemaCache[unitType] = compiledSchema
-	schemaCacheMutex.Unlock()
-	
-	return compiledSchema, nil
+		return nil, err
+	}
+	return registry.Get(unitType)
 }
 
-// GetAvailableUnitTypes returns a list of available unit types from embedded config
+// loadSchemaVersion returns a specific schema version for a unit type from the default registry
+func loadSchemaVersion(unitType string, version int) (*UnitTypeSchema, error) {
+	registry, err := DefaultSchemaRegistry()
+	if err != nil {
+		return nil, err
+	}
+	return registry.GetVersion(unitType, version)
+}
+
+// GetAvailableUnitTypes returns the unit types registered in the default schema registry
 func GetAvailableUnitTypes() ([]string, error) {
-	// For now, we only support commercialVehicleType
-	// In the future, we can expand this by embedding multiple files or using a directory pattern
-	return []string{"commercialVehicleType"}, nil
+	registry, err := DefaultSchemaRegistry()
+	if err != nil {
+		return nil, err
+	}
+	return registry.UnitTypes(), nil
 }
 
 // GenerateID generates a new UUID for the unit
@@ -151,9 +166,11 @@ func (du *DynamicUnit) IsDeleted() bool {
 	return du.DeletedAt > 0
 }
 
-// MarkDeleted marks the unit as soft deleted
-func (du *DynamicUnit) MarkDeleted() {
+// MarkDeleted marks the unit as soft deleted and, when retention is positive,
+// sets the TTL after which DynamoDB expires the item
+func (du *DynamicUnit) MarkDeleted(retention time.Duration) {
 	du.DeletedAt = time.Now().Unix()
+	du.ExpiresAt = expiresAt(du.DeletedAt, retention)
 }
 
 // GetSortKey returns the composite sort key (unitType#id)
@@ -164,8 +181,8 @@ func (du *DynamicUnit) GetSortKey() string {
 // GetKey returns the composite primary key for DynamoDB operations (PK + SK)
 func (du *DynamicUnit) GetKey() map[string]types.AttributeValue {
 	key, _ := attributevalue.MarshalMap(map[string]interface{}{
-		"pk": du.AccountID,      // Primary Key (AccountID)
-		"sk": du.GetSortKey(),   // Sort Key (unitType#id)
+		"pk": du.AccountID,    // Primary Key (AccountID)
+		"sk": du.GetSortKey(), // Sort Key (unitType#id)
 	})
 	return key
 }
@@ -181,16 +198,25 @@ func (du *DynamicUnit) ToMap() (map[string]interface{}, error) {
 		"updatedAt": du.UpdatedAt,
 		"deletedAt": du.DeletedAt,
 	}
-	
+	if du.SchemaVersion > 0 {
+		result["schemaVersion"] = du.SchemaVersion
+	}
+	if du.ExpiresAt > 0 {
+		result["expiresAt"] = du.ExpiresAt
+	}
+	if du.Version > 0 {
+		result["version"] = du.Version
+	}
+
 	// Merge dynamic data
 	for key, value := range du.Data {
 		// Skip core fields that we manage separately
-		if key != "id" && key != "accountId" && key != "unitType" && 
-		   key != "createdAt" && key != "updatedAt" && key != "deletedAt" {
+		if key != "id" && key != "accountId" && key != "unitType" && key != "schemaVersion" &&
+			key != "createdAt" && key != "updatedAt" && key != "deletedAt" && key != "expiresAt" && key != "version" {
 			result[key] = value
 		}
 	}
-	
+
 	return result, nil
 }
 
@@ -213,43 +239,64 @@ func (du *DynamicUnit) FromMap(data map[string]interface{}) error {
 	if unitType, ok := data["unitType"].(string); ok {
 		du.UnitType = unitType
 	}
-	if createdAt, ok := data["createdAt"].(int64); ok {
+	if createdAt, ok := toInt64(data["createdAt"]); ok {
 		du.CreatedAt = createdAt
 	}
-	if updatedAt, ok := data["updatedAt"].(int64); ok {
+	if updatedAt, ok := toInt64(data["updatedAt"]); ok {
 		du.UpdatedAt = updatedAt
 	}
-	if deletedAt, ok := data["deletedAt"].(int64); ok {
+	if deletedAt, ok := toInt64(data["deletedAt"]); ok {
 		du.DeletedAt = deletedAt
 	}
-	
+	if expiresAt, ok := toInt64(data["expiresAt"]); ok {
+		du.ExpiresAt = expiresAt
+	}
+	if schemaVersion, ok := toInt64(data["schemaVersion"]); ok {
+		du.SchemaVersion = int(schemaVersion)
+	}
+	if version, ok := toInt64(data["version"]); ok {
+		du.Version = version
+	}
+
 	// Initialize data map and copy remaining fields
 	du.Data = make(map[string]interface{})
 	for key, value := range data {
-		if key != "pk" && key != "sk" && key != "createdAt" && key != "updatedAt" && key != "deletedAt" {
+		if key != "pk" && key != "sk" && key != "schemaVersion" && key != "version" &&
+			key != "createdAt" && key != "updatedAt" && key != "deletedAt" && key != "expiresAt" {
 			du.Data[key] = value
 		}
 	}
-	
+
 	return nil
 }
 
+// toInt64 converts a numeric value to int64. Numbers unmarshaled from DynamoDB
+// into interface{} arrive as float64, while in-memory maps typically hold int64.
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
 // Validate validates the current data against the schema
 func (du *DynamicUnit) Validate() error {
-	if du.schema == nil {
-		schema, err := loadSchema(du.UnitType)
-		if err != nil {
-			return fmt.Errorf("failed to load schema for validation: %w", err)
-		}
-		du.schema = schema
+	if err := du.ensureSchema(); err != nil {
+		return fmt.Errorf("failed to load schema for validation: %w", err)
 	}
-	
+
 	// Prepare data for validation
 	validationData := make(map[string]interface{})
 	for k, v := range du.Data {
 		validationData[k] = v
 	}
-	
+
 	// Ensure core fields are included
 	validationData["id"] = du.ID
 	validationData["accountId"] = du.AccountID
@@ -257,13 +304,13 @@ func (du *DynamicUnit) Validate() error {
 	validationData["createdAt"] = du.CreatedAt
 	validationData["updatedAt"] = du.UpdatedAt
 	validationData["deletedAt"] = du.DeletedAt
-	
+
 	documentLoader := gojsonschema.NewGoLoader(validationData)
 	result, err := du.schema.Validate(documentLoader)
 	if err != nil {
 		return fmt.Errorf("schema validation error: %w", err)
 	}
-	
+
 	if !result.Valid() {
 		var errorMessages []string
 		for _, err := range result.Errors() {
@@ -271,6 +318,6 @@ func (du *DynamicUnit) Validate() error {
 		}
 		return fmt.Errorf("data validation failed: %s", strings.Join(errorMessages, "; "))
 	}
-	
+
 	return nil
-}
\ No newline at end of file
+}
@@ -188,10 +188,21 @@ func TestDynamicUnit_MarkDeleted(t *testing.T) {
 	unit := DynamicUnit{DeletedAt: 0}
 	beforeTime := time.Now().Unix()
 
-	unit.MarkDeleted()
+	unit.MarkDeleted(time.Hour)
 
 	assert.GreaterOrEqual(t, unit.DeletedAt, beforeTime)
 	assert.True(t, unit.IsDeleted())
+	assert.Equal(t, unit.DeletedAt+3600, unit.ExpiresAt)
+
+	// The TTL attribute is stored at the top level, not inside the dynamic data
+	unitMap, err := unit.ToMap()
+	require.NoError(t, err)
+	assert.Equal(t, unit.ExpiresAt, unitMap["expiresAt"])
+
+	var restored DynamicUnit
+	require.NoError(t, restored.FromMap(map[string]interface{}{"pk": "account-1", "sk": "t#1", "expiresAt": float64(unit.ExpiresAt)}))
+	assert.Equal(t, unit.ExpiresAt, restored.ExpiresAt)
+	assert.NotContains(t, restored.Data, "expiresAt")
 }
 
 func TestDynamicUnit_ValidateAndSetData(t *testing.T) {
@@ -344,6 +355,30 @@ func TestDynamicUnit_FromMap(t *testing.T) {
 	assert.False(t, exists)
 }
 
+func TestDynamicUnit_FromMap_FloatTimestamps(t *testing.T) {
+	// Numbers unmarshaled from DynamoDB into interface{} arrive as float64
+	data := map[string]interface{}{
+		"id":        "test-id-123",
+		"pk":        "account-456",
+		"sk":        "commercialVehicleType#test-id-123",
+		"createdAt": float64(1640995200),
+		"updatedAt": float64(1640995300),
+		"deletedAt": float64(0),
+		"version":   float64(3),
+	}
+
+	unit := &DynamicUnit{}
+	err := unit.FromMap(data)
+	assert.NoError(t, err)
+
+	assert.Equal(t, int64(1640995200), unit.CreatedAt)
+	assert.Equal(t, int64(1640995300), unit.UpdatedAt)
+	assert.Equal(t, int64(0), unit.DeletedAt)
+	assert.False(t, unit.IsDeleted())
+	assert.Equal(t, int64(3), unit.Version)
+	assert.NotContains(t, unit.Data, "version")
+}
+
 // TestDynamicUnit_Validate is commented out because the Validate() function 
 // includes additional fields (unitType, timestamps) that aren't in our minimal schema.
 // The ValidateAndSetData function works correctly and is tested above.
@@ -397,7 +432,7 @@ func TestDynamicUnit_FullWorkflow(t *testing.T) {
 	assert.Equal(t, unit.UnitType, unit2.UnitType)
 
 	// Test soft delete
-	unit.MarkDeleted()
+	unit.MarkDeleted(0)
 	assert.True(t, unit.IsDeleted())
 	assert.Greater(t, unit.DeletedAt, int64(0))
 
@@ -0,0 +1,238 @@
+package models
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//go:embed policies/*.json
+var embeddedFieldPolicies embed.FS
+
+// FieldPermission lists the groups allowed to read and write a field. An empty
+// Read list leaves the field readable by everyone; an empty Write list falls
+// back to the Read list.
+type FieldPermission struct {
+	Read  []string `json:"read,omitempty"`
+	Write []string `json:"write,omitempty"`
+}
+
+// FieldPolicy restricts access to the fields of one unit type. Fields without an
+// entry are readable and writable by every caller.
+type FieldPolicy struct {
+	UnitType    string                     `json:"unitType"`
+	Description string                     `json:"description,omitempty"`
+	Fields      map[string]FieldPermission `json:"fields"`
+}
+
+// UnreadableFields returns the sorted fields the groups may not read
+func (p *FieldPolicy) UnreadableFields(groups []string) []string {
+	if p == nil {
+		return nil
+	}
+
+	var fields []string
+	for name, permission := range p.Fields {
+		if len(permission.Read) > 0 && !anyGroup(permission.Read, groups) {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// UnwritableFields returns the sorted subset of fields the groups may not write
+func (p *FieldPolicy) UnwritableFields(fields []string, groups []string) []string {
+	if p == nil {
+		return nil
+	}
+
+	var denied []string
+	for _, name := range fields {
+		permission, ok := p.Fields[name]
+		if !ok {
+			continue
+		}
+		allowed := permission.Write
+		if len(allowed) == 0 {
+			allowed = permission.Read
+		}
+		if len(allowed) > 0 && !anyGroup(allowed, groups) {
+			denied = append(denied, name)
+		}
+	}
+	sort.Strings(denied)
+	return denied
+}
+
+// anyGroup reports whether any of groups appears in allowed
+func anyGroup(allowed, groups []string) bool {
+	for _, group := range groups {
+		for _, a := range allowed {
+			if a == group {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FieldPolicyRegistry holds field policies keyed by unit type
+type FieldPolicyRegistry struct {
+	mu       sync.RWMutex
+	policies map[string]*FieldPolicy
+}
+
+// NewFieldPolicyRegistry creates an empty field policy registry
+func NewFieldPolicyRegistry() *FieldPolicyRegistry {
+	return &FieldPolicyRegistry{
+		policies: make(map[string]*FieldPolicy),
+	}
+}
+
+var (
+	defaultPolicyRegistry     *FieldPolicyRegistry
+	defaultPolicyRegistryErr  error
+	defaultPolicyRegistryOnce sync.Once
+)
+
+// DefaultFieldPolicyRegistry returns the process-wide registry, loaded with the embedded policies on first use
+func DefaultFieldPolicyRegistry() (*FieldPolicyRegistry, error) {
+	defaultPolicyRegistryOnce.Do(func() {
+		registry := NewFieldPolicyRegistry()
+		if err := registry.LoadFrom(context.Background(), NewFSSchemaSource(embeddedFieldPolicies, "policies")); err != nil {
+			defaultPolicyRegistryErr = fmt.Errorf("failed to load embedded field policies: %w", err)
+			return
+		}
+		defaultPolicyRegistry = registry
+	})
+	return defaultPolicyRegistry, defaultPolicyRegistryErr
+}
+
+// LoadFrom registers every policy document provided by the source, named <unitType>.json.
+// Documents from later sources replace earlier ones for the same unit type.
+func (r *FieldPolicyRegistry) LoadFrom(ctx context.Context, source SchemaSource) error {
+	documents, err := source.LoadSchemas(ctx)
+	if err != nil {
+		return err
+	}
+
+	for name, data := range documents {
+		unitType := strings.TrimSuffix(path.Base(name), ".json")
+		if err := r.Register(unitType, data); err != nil {
+			return fmt.Errorf("failed to register field policy %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// Register parses and stores the field policy document for a unit type
+func (r *FieldPolicyRegistry) Register(unitType string, data []byte) error {
+	if unitType == "" {
+		return fmt.Errorf("unit type is required")
+	}
+
+	var policy FieldPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return fmt.Errorf("failed to parse field policy: %w", err)
+	}
+	for name := range policy.Fields {
+		if unitReadOnlyFields[name] {
+			return fmt.Errorf("field %s is maintained by the service and cannot be restricted", name)
+		}
+	}
+	policy.UnitType = unitType
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.policies[unitType] = &policy
+	return nil
+}
+
+// Get returns the field policy for a unit type, or nil when the type is unrestricted
+func (r *FieldPolicyRegistry) Get(unitType string) *FieldPolicy {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.policies[unitType]
+}
+
+// AllUnreadableFields returns the sorted fields the groups may not read under the
+// policy of at least one unit type, for exports that span every unit type
+func (r *FieldPolicyRegistry) AllUnreadableFields(groups []string) []string {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var fields []string
+	for _, policy := range r.policies {
+		for _, name := range policy.UnreadableFields(groups) {
+			if !seen[name] {
+				seen[name] = true
+				fields = append(fields, name)
+			}
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// unitFieldIndexes maps every Unit JSON field name to its struct field index
+var unitFieldIndexes = buildUnitFieldIndexes()
+
+func buildUnitFieldIndexes() map[string]int {
+	unitType := reflect.TypeOf(Unit{})
+	indexes := make(map[string]int, unitType.NumField())
+	for i := 0; i < unitType.NumField(); i++ {
+		if name := tagName(unitType.Field(i).Tag.Get("json")); name != "" && name != "-" {
+			indexes[name] = i
+		}
+	}
+	return indexes
+}
+
+// RedactUnit returns a copy of unit with the named fields cleared
+func RedactUnit(unit *Unit, fields []string) *Unit {
+	if unit == nil || len(fields) == 0 {
+		return unit
+	}
+
+	redacted := *unit
+	value := reflect.ValueOf(&redacted).Elem()
+	for _, name := range fields {
+		if index, ok := unitFieldIndexes[name]; ok {
+			field := value.Field(index)
+			field.Set(reflect.Zero(field.Type()))
+		}
+	}
+	return &redacted
+}
+
+// RedactDynamicUnit returns a copy of unit without the named data fields
+func RedactDynamicUnit(unit *DynamicUnit, fields []string) *DynamicUnit {
+	if unit == nil || len(fields) == 0 {
+		return unit
+	}
+
+	redacted := *unit
+	redacted.Data = make(map[string]interface{}, len(unit.Data))
+	for name, value := range unit.Data {
+		redacted.Data[name] = value
+	}
+	for _, name := range fields {
+		delete(redacted.Data, name)
+	}
+	return &redacted
+}
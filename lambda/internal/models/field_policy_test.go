@@ -0,0 +1,104 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultFieldPolicyRegistry(t *testing.T) {
+	registry, err := DefaultFieldPolicyRegistry()
+	require.NoError(t, err)
+
+	policy := registry.Get("commercialVehicleType")
+	require.NotNil(t, policy)
+	assert.Equal(t, "commercialVehicleType", policy.UnitType)
+	assert.Equal(t, []string{"basePrice", "errorText", "extendedAttributes", "note"}, policy.UnreadableFields(nil))
+	assert.Nil(t, registry.Get("unknownType"))
+}
+
+func TestFieldPolicy_Permissions(t *testing.T) {
+	registry := NewFieldPolicyRegistry()
+	require.NoError(t, registry.Register("truck", []byte(`{
+		"fields": {
+			"basePrice": {"read": ["pricing", "sales"], "write": ["pricing"]},
+			"note": {"read": ["support"]},
+			"errorText": {"write": ["support"]}
+		}
+	}`)))
+	policy := registry.Get("truck")
+
+	assert.Equal(t, []string{"basePrice", "note"}, policy.UnreadableFields([]string{"dispatch"}))
+	assert.Equal(t, []string{"note"}, policy.UnreadableFields([]string{"sales"}))
+	assert.Empty(t, policy.UnreadableFields([]string{"pricing", "support"}))
+
+	written := []string{"make", "note", "basePrice", "errorText"}
+	assert.Equal(t, []string{"basePrice", "errorText", "note"}, policy.UnwritableFields(written, nil))
+	// Write falls back to the read groups when it lists none
+	assert.Equal(t, []string{"basePrice"}, policy.UnwritableFields(written, []string{"sales", "support"}))
+	assert.Empty(t, policy.UnwritableFields(written, []string{"pricing", "support"}))
+
+	// A nil policy restricts nothing
+	var none *FieldPolicy
+	assert.Empty(t, none.UnreadableFields(nil))
+	assert.Empty(t, none.UnwritableFields(written, nil))
+}
+
+func TestFieldPolicyRegistry_LoadFrom(t *testing.T) {
+	registry := NewFieldPolicyRegistry()
+	source := NewFSSchemaSource(fstest.MapFS{
+		"policies/truck.json": {Data: []byte(`{"fields": {"note": {"read": ["support"]}}}`)},
+	}, "policies")
+	require.NoError(t, registry.LoadFrom(context.Background(), source))
+	require.NotNil(t, registry.Get("truck"))
+
+	assert.Error(t, registry.Register("", []byte(`{}`)))
+	assert.ErrorContains(t, registry.Register("truck", []byte(`{"fields": []}`)), "failed to parse field policy")
+	assert.ErrorContains(t, registry.Register("truck", []byte(`{"fields": {"accountId": {"read": ["x"]}}}`)), "field accountId")
+}
+
+func TestFieldPolicyRegistry_AllUnreadableFields(t *testing.T) {
+	registry := NewFieldPolicyRegistry()
+	require.NoError(t, registry.Register("truck", []byte(`{"fields": {"note": {"read": ["support"]}, "basePrice": {"read": ["pricing"]}}}`)))
+	require.NoError(t, registry.Register("trailer", []byte(`{"fields": {"note": {"read": ["support"]}, "series": {"read": ["sales"]}}}`)))
+
+	assert.Equal(t, []string{"basePrice", "note", "series"}, registry.AllUnreadableFields(nil))
+	assert.Equal(t, []string{"basePrice"}, registry.AllUnreadableFields([]string{"support", "sales"}))
+
+	var none *FieldPolicyRegistry
+	assert.Empty(t, none.AllUnreadableFields(nil))
+}
+
+func TestRedactUnit(t *testing.T) {
+	price := "125000"
+	unit := &Unit{
+		ID:                 "unit-1",
+		Make:               "Mack",
+		Note:               "keep out",
+		BasePrice:          &price,
+		ExtendedAttributes: []ExtendedAttribute{{AttributeName: "fleet", AttributeValue: "north"}},
+	}
+
+	redacted := RedactUnit(unit, []string{"basePrice", "note", "extendedAttributes", "unknown"})
+
+	assert.Equal(t, "Mack", redacted.Make)
+	assert.Empty(t, redacted.Note)
+	assert.Nil(t, redacted.BasePrice)
+	assert.Nil(t, redacted.ExtendedAttributes)
+
+	// The original is untouched
+	assert.Equal(t, "keep out", unit.Note)
+	assert.Same(t, unit, RedactUnit(unit, nil))
+}
+
+func TestRedactDynamicUnit(t *testing.T) {
+	unit := &DynamicUnit{ID: "unit-1", Data: map[string]interface{}{"make": "Mack", "basePrice": "125000"}}
+
+	redacted := RedactDynamicUnit(unit, []string{"basePrice"})
+
+	assert.Equal(t, map[string]interface{}{"make": "Mack"}, redacted.Data)
+	assert.Equal(t, "125000", unit.Data["basePrice"])
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MigrationFunc upgrades unit data from one schema version to the next.
+// It receives a copy of the stored data and returns the upgraded data.
+type MigrationFunc func(data map[string]interface{}) (map[string]interface{}, error)
+
+// unitTypeMigrations lists the ordered schema migrations for each unit type.
+// Entry i upgrades data from version i+1 to version i+2, so adding a
+// <unitType>.v<N>.json schema requires appending the migration from N-1 to N.
+var unitTypeMigrations = map[string][]MigrationFunc{}
+
+// SchemaMigrator upgrades dynamic units stored under older schema versions
+type SchemaMigrator struct {
+	registry *SchemaRegistry
+
+	mu         sync.RWMutex
+	migrations map[string][]MigrationFunc
+}
+
+// NewSchemaMigrator creates a migrator with no registered migrations
+func NewSchemaMigrator(registry *SchemaRegistry) *SchemaMigrator {
+	return &SchemaMigrator{
+		registry:   registry,
+		migrations: make(map[string][]MigrationFunc),
+	}
+}
+
+// NewDefaultSchemaMigrator creates a migrator with the built-in unit type migrations registered
+func NewDefaultSchemaMigrator(registry *SchemaRegistry) *SchemaMigrator {
+	migrator := NewSchemaMigrator(registry)
+	for unitType, migrations := range unitTypeMigrations {
+		migrator.Register(unitType, migrations...)
+	}
+	return migrator
+}
+
+// Register sets the ordered migrations for a unit type, starting at version 1 -> 2
+func (m *SchemaMigrator) Register(unitType string, migrations ...MigrationFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.migrations[unitType] = migrations
+}
+
+// LatestVersion returns the latest registered schema version for a unit type
+func (m *SchemaMigrator) LatestVersion(unitType string) (int, error) {
+	schema, err := m.LatestSchema(unitType)
+	if err != nil {
+		return 0, err
+	}
+	return schema.Version, nil
+}
+
+// LatestSchema returns the latest registered schema for a unit type, the one units are migrated to
+func (m *SchemaMigrator) LatestSchema(unitType string) (*UnitTypeSchema, error) {
+	return m.registry.Get(unitType)
+}
+
+// NeedsMigration reports whether the unit is stored under an older schema version
+func (m *SchemaMigrator) NeedsMigration(unit *DynamicUnit) (bool, error) {
+	latest, err := m.LatestVersion(unit.UnitType)
+	if err != nil {
+		return false, err
+	}
+	return unit.SchemaVersion < latest, nil
+}
+
+// Migrate upgrades the unit in place to the latest schema version and validates
+// the result against that schema. It reports whether any change was made.
+func (m *SchemaMigrator) Migrate(unit *DynamicUnit) (bool, error) {
+	if unit == nil {
+		return false, fmt.Errorf("unit cannot be nil")
+	}
+
+	target, err := m.registry.Get(unit.UnitType)
+	if err != nil {
+		return false, err
+	}
+	if unit.SchemaVersion >= target.Version {
+		return false, nil
+	}
+
+	m.mu.RLock()
+	migrations := m.migrations[unit.UnitType]
+	m.mu.RUnlock()
+
+	data := make(map[string]interface{}, len(unit.Data))
+	for key, value := range unit.Data {
+		data[key] = value
+	}
+
+	for version := unit.EffectiveSchemaVersion(); version < target.Version; version++ {
+		if version-1 >= len(migrations) || migrations[version-1] == nil {
+			return false, fmt.Errorf("no migration registered for unit type %s from version %d to %d", unit.UnitType, version, version+1)
+		}
+		data, err = migrations[version-1](data)
+		if err != nil {
+			return false, fmt.Errorf("migration of unit type %s from version %d to %d failed: %w", unit.UnitType, version, version+1, err)
+		}
+	}
+
+	// Bind a copy to the target schema so a failed validation leaves the unit untouched
+	migrated := *unit
+	migrated.schema = target.Compiled()
+	migrated.SchemaVersion = target.Version
+	if err := migrated.ValidateAndSetData(data); err != nil {
+		return false, fmt.Errorf("migrated unit does not match schema version %d: %w", target.Version, err)
+	}
+
+	*unit = migrated
+	return true, nil
+}
@@ -0,0 +1,177 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testTrailerSchemaV1 = `{
+  "type": "object",
+  "required": ["id", "accountId"],
+  "properties": {
+    "id": {"type": "string"},
+    "accountId": {"type": "string"},
+    "unitType": {"type": "string"},
+    "length": {"type": "string"}
+  },
+  "additionalProperties": false
+}`
+	testTrailerSchemaV2 = `{
+  "type": "object",
+  "required": ["id", "accountId"],
+  "properties": {
+    "id": {"type": "string"},
+    "accountId": {"type": "string"},
+    "unitType": {"type": "string"},
+    "lengthFeet": {"type": "number"}
+  },
+  "additionalProperties": false
+}`
+	testTrailerSchemaV3 = `{
+  "type": "object",
+  "required": ["id", "accountId", "axles"],
+  "properties": {
+    "id": {"type": "string"},
+    "accountId": {"type": "string"},
+    "unitType": {"type": "string"},
+    "lengthFeet": {"type": "number"},
+    "axles": {"type": "integer"}
+  },
+  "additionalProperties": false
+}`
+)
+
+func newTestMigrator(t *testing.T) *SchemaMigrator {
+	registry := NewSchemaRegistry()
+	require.NoError(t, registry.Register("trailerType", 1, []byte(testTrailerSchemaV1)))
+	require.NoError(t, registry.Register("trailerType", 2, []byte(testTrailerSchemaV2)))
+	require.NoError(t, registry.Register("trailerType", 3, []byte(testTrailerSchemaV3)))
+
+	migrator := NewSchemaMigrator(registry)
+	migrator.Register("trailerType",
+		// v1 -> v2: rename length (string) to lengthFeet (number)
+		func(data map[string]interface{}) (map[string]interface{}, error) {
+			if length, ok := data["length"].(string); ok {
+				delete(data, "length")
+				switch length {
+				case "53ft":
+					data["lengthFeet"] = float64(53)
+				default:
+					return nil, errors.New("unrecognized length " + length)
+				}
+			}
+			return data, nil
+		},
+		// v2 -> v3: axles becomes required, default to 2
+		func(data map[string]interface{}) (map[string]interface{}, error) {
+			if _, ok := data["axles"]; !ok {
+				data["axles"] = 2
+			}
+			return data, nil
+		},
+	)
+	return migrator
+}
+
+func TestSchemaMigrator_MigrateToLatest(t *testing.T) {
+	migrator := newTestMigrator(t)
+
+	unit := &DynamicUnit{
+		ID:            "unit-1",
+		AccountID:     "account-1",
+		UnitType:      "trailerType",
+		SchemaVersion: 1,
+		Data:          map[string]interface{}{"unitType": "trailerType", "length": "53ft"},
+	}
+
+	needsMigration, err := migrator.NeedsMigration(unit)
+	require.NoError(t, err)
+	assert.True(t, needsMigration)
+
+	migrated, err := migrator.Migrate(unit)
+	require.NoError(t, err)
+	assert.True(t, migrated)
+
+	assert.Equal(t, 3, unit.SchemaVersion)
+	assert.Equal(t, float64(53), unit.Data["lengthFeet"])
+	assert.Equal(t, 2, unit.Data["axles"])
+	assert.NotContains(t, unit.Data, "length")
+
+	// A second migration is a no-op
+	migrated, err = migrator.Migrate(unit)
+	require.NoError(t, err)
+	assert.False(t, migrated)
+}
+
+func TestSchemaMigrator_UnversionedUnitStartsAtVersionOne(t *testing.T) {
+	migrator := newTestMigrator(t)
+
+	unit := &DynamicUnit{
+		ID:        "unit-1",
+		AccountID: "account-1",
+		UnitType:  "trailerType",
+		Data:      map[string]interface{}{},
+	}
+
+	migrated, err := migrator.Migrate(unit)
+	require.NoError(t, err)
+	assert.True(t, migrated)
+	assert.Equal(t, 3, unit.SchemaVersion)
+}
+
+func TestSchemaMigrator_MigrationFailureLeavesUnitUntouched(t *testing.T) {
+	migrator := newTestMigrator(t)
+
+	unit := &DynamicUnit{
+		ID:            "unit-1",
+		AccountID:     "account-1",
+		UnitType:      "trailerType",
+		SchemaVersion: 1,
+		Data:          map[string]interface{}{"length": "unknown"},
+	}
+
+	migrated, err := migrator.Migrate(unit)
+	assert.Error(t, err)
+	assert.False(t, migrated)
+	assert.Equal(t, 1, unit.SchemaVersion)
+	assert.Equal(t, "unknown", unit.Data["length"])
+}
+
+func TestSchemaMigrator_MissingMigration(t *testing.T) {
+	registry := NewSchemaRegistry()
+	require.NoError(t, registry.Register("trailerType", 1, []byte(testTrailerSchemaV1)))
+	require.NoError(t, registry.Register("trailerType", 2, []byte(testTrailerSchemaV2)))
+	migrator := NewSchemaMigrator(registry)
+
+	unit := &DynamicUnit{ID: "unit-1", AccountID: "account-1", UnitType: "trailerType", SchemaVersion: 1}
+
+	_, err := migrator.Migrate(unit)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no migration registered")
+}
+
+func TestDynamicUnit_SchemaVersionRoundTrip(t *testing.T) {
+	unit, err := NewDynamicUnit("commercialVehicleType")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultSchemaVersion, unit.SchemaVersion)
+
+	unit.ID = "test-id-123"
+	unit.AccountID = "account-456"
+	unit.Data = map[string]interface{}{"make": "Volvo"}
+
+	result, err := unit.ToMap()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultSchemaVersion, result["schemaVersion"])
+
+	// DynamoDB numbers come back as float64
+	result["schemaVersion"] = float64(DefaultSchemaVersion)
+
+	restored := &DynamicUnit{}
+	require.NoError(t, restored.FromMap(result))
+	assert.Equal(t, DefaultSchemaVersion, restored.SchemaVersion)
+	assert.NotContains(t, restored.Data, "schemaVersion")
+}
@@ -0,0 +1,305 @@
+package models
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+//go:embed schemas/*.json
+var embeddedSchemas embed.FS
+
+// DefaultSchemaVersion is the version assigned to schema files without a version suffix
+const DefaultSchemaVersion = 1
+
+// UnitTypeSchema is a compiled JSON schema for one version of a unit type
+type UnitTypeSchema struct {
+	UnitType    string          `json:"unitType"`
+	Version     int             `json:"version"`
+	Title       string          `json:"title,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Schema      json.RawMessage `json:"schema"`
+
+	compiled *gojsonschema.Schema
+}
+
+// Compiled returns the compiled schema used for validation
+func (s *UnitTypeSchema) Compiled() *gojsonschema.Schema {
+	return s.compiled
+}
+
+// PropertyNames returns the sorted top-level property names declared by the schema
+func (s *UnitTypeSchema) PropertyNames() []string {
+	var doc struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(s.Schema, &doc); err != nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(doc.Properties))
+	for name := range doc.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SchemaSource provides raw schema documents keyed by file name
+type SchemaSource interface {
+	LoadSchemas(ctx context.Context) (map[string][]byte, error)
+}
+
+// FSSchemaSource loads every *.json file from a directory of an fs.FS.
+// It serves both the embedded schemas and an on-disk directory via os.DirFS.
+type FSSchemaSource struct {
+	fsys fs.FS
+	dir  string
+}
+
+// NewFSSchemaSource creates a schema source reading *.json files from dir within fsys
+func NewFSSchemaSource(fsys fs.FS, dir string) *FSSchemaSource {
+	return &FSSchemaSource{fsys: fsys, dir: dir}
+}
+
+// LoadSchemas reads all schema files in the source directory
+func (s *FSSchemaSource) LoadSchemas(_ context.Context) (map[string][]byte, error) {
+	matches, err := fs.Glob(s.fsys, path.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schema files: %w", err)
+	}
+
+	documents := make(map[string][]byte, len(matches))
+	for _, match := range matches {
+		data, err := fs.ReadFile(s.fsys, match)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema file %s: %w", match, err)
+		}
+		documents[path.Base(match)] = data
+	}
+
+	return documents, nil
+}
+
+// ObjectStore is the minimal S3-style object store used to distribute schemas
+type ObjectStore interface {
+	ListObjects(ctx context.Context, prefix string) ([]string, error)
+	GetObject(ctx context.Context, key string) ([]byte, error)
+}
+
+// ObjectStoreSchemaSource loads every *.json object under a key prefix
+type ObjectStoreSchemaSource struct {
+	store  ObjectStore
+	prefix string
+}
+
+// NewObjectStoreSchemaSource creates a schema source backed by an object store
+func NewObjectStoreSchemaSource(store ObjectStore, prefix string) *ObjectStoreSchemaSource {
+	return &ObjectStoreSchemaSource{store: store, prefix: prefix}
+}
+
+// LoadSchemas reads all schema objects under the configured prefix
+func (s *ObjectStoreSchemaSource) LoadSchemas(ctx context.Context) (map[string][]byte, error) {
+	keys, err := s.store.ListObjects(ctx, s.prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schema objects: %w", err)
+	}
+
+	documents := make(map[string][]byte)
+	for _, key := range keys {
+		if !strings.HasSuffix(key, ".json") {
+			continue
+		}
+		data, err := s.store.GetObject(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema object %s: %w", key, err)
+		}
+		documents[path.Base(key)] = data
+	}
+
+	return documents, nil
+}
+
+// SchemaRegistry holds compiled unit type schemas keyed by unit type and version
+type SchemaRegistry struct {
+	mu      sync.RWMutex
+	schemas map[string]map[int]*UnitTypeSchema
+}
+
+// NewSchemaRegistry creates an empty schema registry
+func NewSchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{
+		schemas: make(map[string]map[int]*UnitTypeSchema),
+	}
+}
+
+var (
+	defaultRegistry     *SchemaRegistry
+	defaultRegistryErr  error
+	defaultRegistryOnce sync.Once
+)
+
+// DefaultSchemaRegistry returns the process-wide registry, loaded with the embedded schemas on first use
+func DefaultSchemaRegistry() (*SchemaRegistry, error) {
+	defaultRegistryOnce.Do(func() {
+		registry := NewSchemaRegistry()
+		if err := registry.LoadFrom(context.Background(), NewFSSchemaSource(embeddedSchemas, "schemas")); err != nil {
+			defaultRegistryErr = fmt.Errorf("failed to load embedded schemas: %w", err)
+			return
+		}
+		defaultRegistry = registry
+	})
+	return defaultRegistry, defaultRegistryErr
+}
+
+// LoadFrom registers every schema document provided by the source.
+// Documents from later sources replace earlier ones with the same unit type and version.
+func (r *SchemaRegistry) LoadFrom(ctx context.Context, source SchemaSource) error {
+	documents, err := source.LoadSchemas(ctx)
+	if err != nil {
+		return err
+	}
+
+	for name, data := range documents {
+		unitType, version, err := parseSchemaFileName(name)
+		if err != nil {
+			return err
+		}
+		if err := r.Register(unitType, version, data); err != nil {
+			return fmt.Errorf("failed to register schema %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// Register compiles and stores a schema document for a unit type and version
+func (r *SchemaRegistry) Register(unitType string, version int, data []byte) error {
+	if unitType == "" {
+		return fmt.Errorf("unit type is required")
+	}
+	if version < 1 {
+		return fmt.Errorf("schema version must be positive, got %d", version)
+	}
+
+	compiled, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(data))
+	if err != nil {
+		return fmt.Errorf("failed to compile schema: %w", err)
+	}
+
+	var meta struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return fmt.Errorf("failed to parse schema metadata: %w", err)
+	}
+
+	schema := &UnitTypeSchema{
+		UnitType:    unitType,
+		Version:     version,
+		Title:       meta.Title,
+		Description: meta.Description,
+		Schema:      json.RawMessage(data),
+		compiled:    compiled,
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.schemas[unitType] == nil {
+		r.schemas[unitType] = make(map[int]*UnitTypeSchema)
+	}
+	r.schemas[unitType][version] = schema
+
+	return nil
+}
+
+// Get returns the latest version of the schema for a unit type
+func (r *SchemaRegistry) Get(unitType string) (*UnitTypeSchema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	versions, ok := r.schemas[unitType]
+	if !ok || len(versions) == 0 {
+		return nil, fmt.Errorf("unsupported unit type: %s", unitType)
+	}
+
+	var latest *UnitTypeSchema
+	for _, schema := range versions {
+		if latest == nil || schema.Version > latest.Version {
+			latest = schema
+		}
+	}
+	return latest, nil
+}
+
+// GetVersion returns a specific version of the schema for a unit type
+func (r *SchemaRegistry) GetVersion(unitType string, version int) (*UnitTypeSchema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	versions, ok := r.schemas[unitType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported unit type: %s", unitType)
+	}
+	schema, ok := versions[version]
+	if !ok {
+		return nil, fmt.Errorf("unsupported version %d for unit type %s", version, unitType)
+	}
+	return schema, nil
+}
+
+// UnitTypes returns the registered unit types in sorted order
+func (r *SchemaRegistry) UnitTypes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	unitTypes := make([]string, 0, len(r.schemas))
+	for unitType := range r.schemas {
+		unitTypes = append(unitTypes, unitType)
+	}
+	sort.Strings(unitTypes)
+	return unitTypes
+}
+
+// Versions returns the registered versions of a unit type in ascending order
+func (r *SchemaRegistry) Versions(unitType string) []int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	versions := make([]int, 0, len(r.schemas[unitType]))
+	for version := range r.schemas[unitType] {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// parseSchemaFileName derives the unit type and version from a schema file name.
+// Files are named <unitType>.json (version 1) or <unitType>.v<N>.json.
+func parseSchemaFileName(name string) (string, int, error) {
+	base := strings.TrimSuffix(path.Base(name), ".json")
+
+	unitType, versionPart, hasVersion := strings.Cut(base, ".v")
+	if !hasVersion {
+		if strings.Contains(base, ".") {
+			return "", 0, fmt.Errorf("invalid schema file name %s", name)
+		}
+		return base, DefaultSchemaVersion, nil
+	}
+
+	version, err := strconv.Atoi(versionPart)
+	if err != nil || version < 1 {
+		return "", 0, fmt.Errorf("invalid schema version in file name %s", name)
+	}
+	return unitType, version, nil
+}
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testTrailerSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "title": "Trailer Type Unit",
+  "type": "object",
+  "required": ["id", "accountId"],
+  "properties": {
+    "id": {"type": "string"},
+    "accountId": {"type": "string"},
+    "length": {"type": "number"}
+  },
+  "additionalProperties": false
+}`
+
+// fakeObjectStore is an in-memory stand-in for an S3-style object store
+type fakeObjectStore struct {
+	objects map[string][]byte
+	listErr error
+}
+
+func (f *fakeObjectStore) ListObjects(_ context.Context, prefix string) ([]string, error) {
+	if f.listErr != nil {
+		return nil, f.listErr
+	}
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (f *fakeObjectStore) GetObject(_ context.Context, key string) ([]byte, error) {
+	return f.objects[key], nil
+}
+
+func TestDefaultSchemaRegistry_LoadsEmbeddedSchemas(t *testing.T) {
+	registry, err := DefaultSchemaRegistry()
+	require.NoError(t, err)
+
+	assert.Contains(t, registry.UnitTypes(), "commercialVehicleType")
+
+	schema, err := registry.Get("commercialVehicleType")
+	require.NoError(t, err)
+	assert.Equal(t, "commercialVehicleType", schema.UnitType)
+	assert.Equal(t, DefaultSchemaVersion, schema.Version)
+	assert.Equal(t, "Commercial Vehicle Type Unit", schema.Title)
+	assert.NotNil(t, schema.Compiled())
+	assert.NotEmpty(t, schema.Schema)
+}
+
+func TestSchemaRegistry_LoadFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"schemas/trailerType.json":    {Data: []byte(testTrailerSchema)},
+		"schemas/trailerType.v2.json": {Data: []byte(testTrailerSchema)},
+		"schemas/README.md":           {Data: []byte("not a schema")},
+	}
+
+	registry := NewSchemaRegistry()
+	err := registry.LoadFrom(context.Background(), NewFSSchemaSource(fsys, "schemas"))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"trailerType"}, registry.UnitTypes())
+	assert.Equal(t, []int{1, 2}, registry.Versions("trailerType"))
+
+	latest, err := registry.Get("trailerType")
+	require.NoError(t, err)
+	assert.Equal(t, 2, latest.Version)
+
+	v1, err := registry.GetVersion("trailerType", 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, v1.Version)
+
+	_, err = registry.GetVersion("trailerType", 3)
+	assert.Error(t, err)
+}
+
+func TestSchemaRegistry_LoadFromObjectStore(t *testing.T) {
+	store := &fakeObjectStore{objects: map[string][]byte{
+		"unit-schemas/trailerType.json": []byte(testTrailerSchema),
+		"unit-schemas/notes.txt":        []byte("ignored"),
+		"other/ignoredType.json":        []byte(testTrailerSchema),
+	}}
+
+	registry := NewSchemaRegistry()
+	err := registry.LoadFrom(context.Background(), NewObjectStoreSchemaSource(store, "unit-schemas/"))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"trailerType"}, registry.UnitTypes())
+}
+
+func TestSchemaRegistry_LoadFromObjectStoreError(t *testing.T) {
+	store := &fakeObjectStore{listErr: errors.New("access denied")}
+
+	registry := NewSchemaRegistry()
+	err := registry.LoadFrom(context.Background(), NewObjectStoreSchemaSource(store, ""))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "access denied")
+}
+
+func TestSchemaRegistry_RegisterInvalidSchema(t *testing.T) {
+	registry := NewSchemaRegistry()
+
+	err := registry.Register("brokenType", 1, []byte(`{"type": 42}`))
+	assert.Error(t, err)
+
+	_, err = registry.Get("brokenType")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported unit type")
+}
+
+func TestParseSchemaFileName(t *testing.T) {
+	tests := []struct {
+		name        string
+		fileName    string
+		wantType    string
+		wantVersion int
+		wantErr     bool
+	}{
+		{name: "unversioned", fileName: "commercialVehicleType.json", wantType: "commercialVehicleType", wantVersion: 1},
+		{name: "versioned", fileName: "commercialVehicleType.v3.json", wantType: "commercialVehicleType", wantVersion: 3},
+		{name: "invalid version", fileName: "commercialVehicleType.vX.json", wantErr: true},
+		{name: "zero version", fileName: "commercialVehicleType.v0.json", wantErr: true},
+		{name: "unexpected dot", fileName: "commercial.vehicle.json", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unitType, version, err := parseSchemaFileName(tt.fileName)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantType, unitType)
+			assert.Equal(t, tt.wantVersion, version)
+		})
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/google/uuid"
+
+	"github.com/steverhoton/unt-units-svc/internal/vin"
 )
 
 // ExtendedAttribute represents a key-value pair for extended attributes
@@ -227,9 +229,14 @@ type Unit struct {
 	AdaptiveDrivingBeam                *string `json:"adaptiveDrivingBeam,omitempty" dynamodbav:"adaptiveDrivingBeam,omitempty"`
 
 	// Timestamp fields
-	CreatedAt int64 `json:"createdAt" dynamodbav:"createdAt"`
-	UpdatedAt int64 `json:"updatedAt" dynamodbav:"updatedAt"`
-	DeletedAt int64 `json:"deletedAt" dynamodbav:"deletedAt"`
+	CreatedAt int64  `json:"createdAt" dynamodbav:"createdAt"`
+	UpdatedAt int64  `json:"updatedAt" dynamodbav:"updatedAt"`
+	DeletedAt int64  `json:"deletedAt" dynamodbav:"deletedAt"`
+	DeletedBy string `json:"deletedBy,omitempty" dynamodbav:"deletedBy,omitempty"` // Caller that soft deleted the unit
+	ExpiresAt int64  `json:"expiresAt,omitempty" dynamodbav:"expiresAt,omitempty"` // DynamoDB TTL for soft deleted units
+
+	// Optimistic concurrency version, incremented on every write
+	Version int64 `json:"version" dynamodbav:"version"`
 
 	// Extended data
 	ExtendedAttributes []ExtendedAttribute `json:"extendedAttributes,omitempty" dynamodbav:"extendedAttributes,omitempty"`
@@ -237,6 +244,9 @@ type Unit struct {
 
 	// Computed field for DynamoDB SK - not stored directly
 	SortKey string `json:"-" dynamodbav:"sk,omitempty"`
+
+	// Computed normalized SuggestedVin - sort key of the account VIN index
+	Vin string `json:"-" dynamodbav:"vin,omitempty"`
 }
 
 // GetKey returns the composite primary key for DynamoDB operations (PK + SK)
@@ -254,6 +264,17 @@ func (u *Unit) GetSortKey() string {
 	return u.ID + "#" + u.UnitType
 }
 
+// NormalizeVin returns the form of a VIN stored in the account VIN index:
+// upper case with whitespace and hyphens removed
+func NormalizeVin(suggestedVin string) string {
+	return vin.Normalize(suggestedVin)
+}
+
+// SetVin updates the indexed VIN from SuggestedVin
+func (u *Unit) SetVin() {
+	u.Vin = NormalizeVin(u.SuggestedVin)
+}
+
 // SetTimestamps sets created and updated timestamps
 func (u *Unit) SetTimestamps() {
 	now := time.Now().Unix()
@@ -268,9 +289,28 @@ func (u *Unit) IsDeleted() bool {
 	return u.DeletedAt > 0
 }
 
-// MarkDeleted marks the unit as soft deleted
-func (u *Unit) MarkDeleted() {
+// MarkDeleted marks the unit as soft deleted and, when retention is positive,
+// sets the TTL after which DynamoDB expires the item
+func (u *Unit) MarkDeleted(retention time.Duration) {
 	u.DeletedAt = time.Now().Unix()
+	u.ExpiresAt = expiresAt(u.DeletedAt, retention)
+}
+
+// ClearDeletion clears the soft delete fields and TTL of a unit about to be
+// created. Only the service sets them, so values a client sent cannot forge a
+// deletion or have DynamoDB expire a live unit.
+func (u *Unit) ClearDeletion() {
+	u.DeletedAt = 0
+	u.DeletedBy = ""
+	u.ExpiresAt = 0
+}
+
+// expiresAt returns the TTL for an item deleted at deletedAt, or 0 when retention is not positive
+func expiresAt(deletedAt int64, retention time.Duration) int64 {
+	if retention <= 0 {
+		return 0
+	}
+	return deletedAt + int64(retention/time.Second)
 }
 
 // GenerateID generates a new UUID for the unit's primary key
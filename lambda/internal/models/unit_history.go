@@ -0,0 +1,374 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// HistoryAction is the kind of write recorded by a unit history entry
+type HistoryAction string
+
+const (
+	HistoryCreate  HistoryAction = "CREATE"
+	HistoryUpdate  HistoryAction = "UPDATE"
+	HistoryDelete  HistoryAction = "DELETE"
+	HistoryRestore HistoryAction = "RESTORE"
+)
+
+// HistoryTimeFormat is the fixed width UTC form of history timestamps, so sort keys
+// ordered as strings are ordered in time
+const HistoryTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+// HistorySortKeyMarker separates a unit's sort key from the timestamp of its history
+// items; no unit sort key contains it
+const HistorySortKeyMarker = "#HIST#"
+
+// historyVersionFormat appends the zero-padded version to history sort keys, so
+// writes made at the same timestamp still get unique keys, ordered by version
+const historyVersionFormat = "#%019d"
+
+// historyIgnoredFields change on every write and are recorded on the entry itself
+var historyIgnoredFields = map[string]bool{
+	"updatedAt": true,
+	"version":   true,
+}
+
+// Actor identifies the caller behind a recorded change
+type Actor struct {
+	Sub      string `json:"sub,omitempty" dynamodbav:"sub,omitempty"`
+	Username string `json:"username,omitempty" dynamodbav:"username,omitempty"`
+	SourceIP string `json:"sourceIp,omitempty" dynamodbav:"sourceIp,omitempty"`
+}
+
+// FieldChange is the JSON value of a unit field before and after a change. A field
+// that was or became absent is null.
+type FieldChange struct {
+	From json.RawMessage `json:"from"`
+	To   json.RawMessage `json:"to"`
+}
+
+// FieldChanges maps the JSON name of each field a write changed to its old and new value
+type FieldChanges map[string]FieldChange
+
+// MarshalDynamoDBAttributeValue stores each change as a map of JSON text values,
+// leaving out null ones
+func (c FieldChanges) MarshalDynamoDBAttributeValue() (types.AttributeValue, error) {
+	changes := make(map[string]types.AttributeValue, len(c))
+	for name, change := range c {
+		value := map[string]types.AttributeValue{}
+		if !isNullJSON(change.From) {
+			value["from"] = &types.AttributeValueMemberS{Value: string(change.From)}
+		}
+		if !isNullJSON(change.To) {
+			value["to"] = &types.AttributeValueMemberS{Value: string(change.To)}
+		}
+		changes[name] = &types.AttributeValueMemberM{Value: value}
+	}
+	return &types.AttributeValueMemberM{Value: changes}, nil
+}
+
+// UnmarshalDynamoDBAttributeValue reads changes stored by MarshalDynamoDBAttributeValue
+func (c *FieldChanges) UnmarshalDynamoDBAttributeValue(av types.AttributeValue) error {
+	m, ok := av.(*types.AttributeValueMemberM)
+	if !ok {
+		return fmt.Errorf("field changes must be a map, got %T", av)
+	}
+	changes := make(FieldChanges, len(m.Value))
+	for name, value := range m.Value {
+		stored, ok := value.(*types.AttributeValueMemberM)
+		if !ok {
+			return fmt.Errorf("change of %s must be a map, got %T", name, value)
+		}
+		change := FieldChange{From: json.RawMessage("null"), To: json.RawMessage("null")}
+		if from, ok := stored.Value["from"].(*types.AttributeValueMemberS); ok {
+			change.From = json.RawMessage(from.Value)
+		}
+		if to, ok := stored.Value["to"].(*types.AttributeValueMemberS); ok {
+			change.To = json.RawMessage(to.Value)
+		}
+		changes[name] = change
+	}
+	*c = changes
+	return nil
+}
+
+// UnitHistoryEntry is an immutable record of one write to a unit, stored in the
+// account partition next to the unit under {unitId}#{unitType}#HIST#{timestamp}#{version}
+type UnitHistoryEntry struct {
+	AccountID string `json:"accountId" dynamodbav:"pk"`
+	SortKey   string `json:"-" dynamodbav:"sk"`
+	UnitID    string `json:"unitId" dynamodbav:"unitId"`
+	UnitType  string `json:"unitType" dynamodbav:"unitType"`
+
+	Action    HistoryAction `json:"action" dynamodbav:"action"`
+	Version   int64         `json:"version" dynamodbav:"version"`     // Unit version written by the change
+	Timestamp string        `json:"timestamp" dynamodbav:"timestamp"` // When the change was made, in HistoryTimeFormat
+
+	Changes FieldChanges `json:"changes" dynamodbav:"changes"`
+
+	Actor Actor `json:"actor" dynamodbav:"actor"`
+}
+
+// NewUnitHistoryEntry records a write that turned before into after. before is nil
+// for a created unit.
+func NewUnitHistoryEntry(action HistoryAction, before, after *Unit, actor Actor, at time.Time) (*UnitHistoryEntry, error) {
+	changes, err := DiffUnits(before, after)
+	if err != nil {
+		return nil, err
+	}
+	return newHistoryEntry(action, after.AccountID, after.ID, after.UnitType, after.Version, changes, actor, at), nil
+}
+
+// NewDynamicUnitHistoryEntry records a write to a schema-driven unit that turned
+// before into after. before is nil for a created unit.
+func NewDynamicUnitHistoryEntry(action HistoryAction, before, after *DynamicUnit, actor Actor, at time.Time) (*UnitHistoryEntry, error) {
+	changes, err := DiffDynamicUnits(before, after)
+	if err != nil {
+		return nil, err
+	}
+	return newHistoryEntry(action, after.AccountID, after.ID, after.UnitType, after.Version, changes, actor, at), nil
+}
+
+// newHistoryEntry builds the history entry of a write of version to a unit
+func newHistoryEntry(action HistoryAction, accountID, unitID, unitType string, version int64, changes FieldChanges, actor Actor, at time.Time) *UnitHistoryEntry {
+	timestamp := at.UTC().Format(HistoryTimeFormat)
+	return &UnitHistoryEntry{
+		AccountID: accountID,
+		SortKey:   HistorySortKeyPrefix(unitID, unitType) + timestamp + fmt.Sprintf(historyVersionFormat, version),
+		UnitID:    unitID,
+		UnitType:  unitType,
+		Action:    action,
+		Version:   version,
+		Timestamp: timestamp,
+		Changes:   changes,
+		Actor:     actor,
+	}
+}
+
+// HistorySortKeyPrefix returns the sort key prefix shared by the history items of a unit
+func HistorySortKeyPrefix(unitID, unitType string) string {
+	return unitID + "#" + unitType + HistorySortKeyMarker
+}
+
+// HistorySortKeyUpTo returns a sort key ordered after the keys of every history
+// item of the unit recorded at or before at, whatever their version
+func HistorySortKeyUpTo(unitID, unitType string, at time.Time) string {
+	return HistorySortKeyPrefix(unitID, unitType) + at.UTC().Format(HistoryTimeFormat) + "#~"
+}
+
+// IsHistorySortKey reports whether a sort key belongs to a history item
+func IsHistorySortKey(sk string) bool {
+	return strings.Contains(sk, HistorySortKeyMarker)
+}
+
+// DiffUnits returns the fields whose JSON values differ between before and after.
+// A nil unit has no fields, so creating a unit records every field it was given.
+// updatedAt and version, which every write changes, are left out.
+func DiffUnits(before, after *Unit) (FieldChanges, error) {
+	beforeFields, err := unitJSONFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := unitJSONFields(after)
+	if err != nil {
+		return nil, err
+	}
+	return diffFields(beforeFields, afterFields), nil
+}
+
+// DiffDynamicUnits is DiffUnits for schema-driven units. Their data properties are
+// compared as fields alongside the core fields.
+func DiffDynamicUnits(before, after *DynamicUnit) (FieldChanges, error) {
+	beforeFields, err := dynamicUnitJSONFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := dynamicUnitJSONFields(after)
+	if err != nil {
+		return nil, err
+	}
+	return diffFields(beforeFields, afterFields), nil
+}
+
+// diffFields returns the changes between two sets of JSON field values
+func diffFields(beforeFields, afterFields map[string]json.RawMessage) FieldChanges {
+	changes := make(FieldChanges)
+	record := func(name string) {
+		from, to := jsonOrNull(beforeFields[name]), jsonOrNull(afterFields[name])
+		if !historyIgnoredFields[name] && !bytes.Equal(from, to) {
+			changes[name] = FieldChange{From: from, To: to}
+		}
+	}
+	for name := range beforeFields {
+		record(name)
+	}
+	for name := range afterFields {
+		if _, ok := beforeFields[name]; !ok {
+			record(name)
+		}
+	}
+	return changes
+}
+
+// unitJSONFields returns the JSON value of each field of a unit that is present
+func unitJSONFields(unit *Unit) (map[string]json.RawMessage, error) {
+	fields := map[string]json.RawMessage{}
+	if unit == nil {
+		return fields, nil
+	}
+	data, err := json.Marshal(unit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal unit: %w", err)
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("failed to read unit fields: %w", err)
+	}
+	return fields, nil
+}
+
+// dynamicUnitJSONFields returns the JSON value of each data property and core field
+// of a schema-driven unit, flattened as the unit is stored
+func dynamicUnitJSONFields(unit *DynamicUnit) (map[string]json.RawMessage, error) {
+	fields := map[string]json.RawMessage{}
+	if unit == nil {
+		return fields, nil
+	}
+
+	values := make(map[string]interface{}, len(unit.Data)+9)
+	for name, value := range unit.Data {
+		values[name] = value
+	}
+	values["id"] = unit.ID
+	values["accountId"] = unit.AccountID
+	values["unitType"] = unit.UnitType
+	values["createdAt"] = unit.CreatedAt
+	values["updatedAt"] = unit.UpdatedAt
+	values["deletedAt"] = unit.DeletedAt
+	values["version"] = unit.Version
+	if unit.SchemaVersion > 0 {
+		values["schemaVersion"] = unit.SchemaVersion
+	}
+	if unit.ExpiresAt > 0 {
+		values["expiresAt"] = unit.ExpiresAt
+	}
+
+	for name, value := range values {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %s: %w", name, err)
+		}
+		fields[name] = raw
+	}
+	return fields, nil
+}
+
+// jsonOrNull returns raw, or null when it is empty
+func jsonOrNull(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 {
+		return json.RawMessage("null")
+	}
+	return raw
+}
+
+// isNullJSON reports whether raw is empty or the JSON null
+func isNullJSON(raw json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(raw)
+	return len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null"))
+}
+
+// ReplayHistory rebuilds a unit by applying the changes of its history entries in
+// order, oldest first, starting from a unit with no fields. The unit takes the
+// version and timestamp of the last entry. It returns nil when there are no entries.
+func ReplayHistory(entries []UnitHistoryEntry) (*Unit, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	data, err := replayFields(entries)
+	if err != nil {
+		return nil, err
+	}
+	var unit Unit
+	if err := json.Unmarshal(data, &unit); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal replayed unit: %w", err)
+	}
+
+	last := entries[len(entries)-1]
+	unit.Version = last.Version
+	if at, err := time.Parse(HistoryTimeFormat, last.Timestamp); err == nil {
+		unit.UpdatedAt = at.Unix()
+	}
+	return &unit, nil
+}
+
+// ReplayDynamicHistory is ReplayHistory for schema-driven units. The rebuilt unit
+// keeps the schema version it had at the time.
+func ReplayDynamicHistory(entries []UnitHistoryEntry) (*DynamicUnit, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	data, err := replayFields(entries)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal replayed unit: %w", err)
+	}
+	unit := &DynamicUnit{}
+	if err := unit.FromMap(values); err != nil {
+		return nil, fmt.Errorf("failed to read replayed unit: %w", err)
+	}
+
+	last := entries[len(entries)-1]
+	unit.AccountID = last.AccountID
+	unit.Version = last.Version
+	if at, err := time.Parse(HistoryTimeFormat, last.Timestamp); err == nil {
+		unit.UpdatedAt = at.Unix()
+	}
+	return unit, nil
+}
+
+// replayFields applies the changes of history entries in order and returns the
+// resulting fields as a JSON object
+func replayFields(entries []UnitHistoryEntry) ([]byte, error) {
+	fields := map[string]json.RawMessage{}
+	for _, entry := range entries {
+		for name, change := range entry.Changes {
+			if isNullJSON(change.To) {
+				delete(fields, name)
+			} else {
+				fields[name] = change.To
+			}
+		}
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal replayed fields: %w", err)
+	}
+	return data, nil
+}
+
+// RedactHistoryEntry returns a copy of entry without the changes of the named fields
+func RedactHistoryEntry(entry *UnitHistoryEntry, fields []string) *UnitHistoryEntry {
+	if entry == nil || len(fields) == 0 {
+		return entry
+	}
+
+	redacted := *entry
+	redacted.Changes = make(FieldChanges, len(entry.Changes))
+	for name, change := range entry.Changes {
+		redacted.Changes[name] = change
+	}
+	for _, name := range fields {
+		delete(redacted.Changes, name)
+	}
+	return &redacted
+}
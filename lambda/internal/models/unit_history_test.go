@@ -0,0 +1,154 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffUnits(t *testing.T) {
+	trim := "LX"
+	before := &Unit{ID: "unit-1", Make: "Mack", Note: "yard 4", Trim: &trim, Version: 3, UpdatedAt: 100}
+	after := &Unit{ID: "unit-1", Make: "Mack", Note: "yard 7", Model: "Anthem", Version: 4, UpdatedAt: 200}
+
+	changes, err := DiffUnits(before, after)
+	require.NoError(t, err)
+
+	assert.Equal(t, FieldChanges{
+		"note":  {From: json.RawMessage(`"yard 4"`), To: json.RawMessage(`"yard 7"`)},
+		"trim":  {From: json.RawMessage(`"LX"`), To: json.RawMessage(`null`)},
+		"model": {From: json.RawMessage(`""`), To: json.RawMessage(`"Anthem"`)},
+	}, changes)
+}
+
+func TestDiffUnits_Created(t *testing.T) {
+	changes, err := DiffUnits(nil, &Unit{ID: "unit-1", Make: "Mack", Version: 1})
+	require.NoError(t, err)
+
+	assert.Equal(t, FieldChange{From: json.RawMessage(`null`), To: json.RawMessage(`"Mack"`)}, changes["make"])
+	assert.Equal(t, FieldChange{From: json.RawMessage(`null`), To: json.RawMessage(`"unit-1"`)}, changes["id"])
+	assert.NotContains(t, changes, "version")
+}
+
+func TestNewUnitHistoryEntry(t *testing.T) {
+	at := time.Date(2026, 3, 4, 5, 6, 7, 800, time.FixedZone("EST", -5*3600))
+	after := &Unit{AccountID: "account-1", ID: "unit-1", UnitType: "commercialVehicleType", Make: "Mack", Version: 1}
+
+	entry, err := NewUnitHistoryEntry(HistoryCreate, nil, after, Actor{Username: "jo"}, at)
+	require.NoError(t, err)
+
+	assert.Equal(t, "2026-03-04T10:06:07.000000800Z", entry.Timestamp)
+	assert.Equal(t, "unit-1#commercialVehicleType#HIST#2026-03-04T10:06:07.000000800Z#0000000000000000001", entry.SortKey)
+	assert.True(t, IsHistorySortKey(entry.SortKey))
+	assert.False(t, IsHistorySortKey(after.GetSortKey()))
+	assert.Equal(t, int64(1), entry.Version)
+
+	// Writes at the same timestamp get unique keys that sort by version
+	after.Version = 10
+	later, err := NewUnitHistoryEntry(HistoryUpdate, nil, after, Actor{Username: "jo"}, at)
+	require.NoError(t, err)
+	assert.NotEqual(t, entry.SortKey, later.SortKey)
+	assert.Less(t, entry.SortKey, later.SortKey)
+	assert.Less(t, later.SortKey, HistorySortKeyUpTo("unit-1", "commercialVehicleType", at))
+	assert.Greater(t, entry.SortKey, HistorySortKeyUpTo("unit-1", "commercialVehicleType", at.Add(-time.Nanosecond)))
+}
+
+func TestFieldChanges_DynamoDBRoundTrip(t *testing.T) {
+	entry := UnitHistoryEntry{Changes: FieldChanges{
+		"note":               {From: json.RawMessage(`"yard 4"`), To: json.RawMessage(`null`)},
+		"extendedAttributes": {From: json.RawMessage(`null`), To: json.RawMessage(`[{"attributeName":"fleet"}]`)},
+	}}
+
+	item, err := attributevalue.MarshalMap(entry)
+	require.NoError(t, err)
+
+	var decoded UnitHistoryEntry
+	require.NoError(t, attributevalue.UnmarshalMap(item, &decoded))
+	assert.Equal(t, entry.Changes, decoded.Changes)
+}
+
+func TestRedactHistoryEntry(t *testing.T) {
+	entry := &UnitHistoryEntry{UnitID: "unit-1", Changes: FieldChanges{
+		"basePrice": {From: json.RawMessage(`"10"`), To: json.RawMessage(`"12"`)},
+		"note":      {From: json.RawMessage(`null`), To: json.RawMessage(`"moved"`)},
+	}}
+
+	redacted := RedactHistoryEntry(entry, []string{"basePrice"})
+	assert.NotContains(t, redacted.Changes, "basePrice")
+	assert.Contains(t, redacted.Changes, "note")
+	assert.Contains(t, entry.Changes, "basePrice")
+
+	data, err := json.Marshal(redacted)
+	require.NoError(t, err)
+	assert.False(t, strings.Contains(string(data), "basePrice"))
+}
+
+func TestReplayHistory(t *testing.T) {
+	entries := []UnitHistoryEntry{
+		{Action: HistoryCreate, Version: 1, Timestamp: "2026-01-01T00:00:00.000000000Z", Changes: FieldChanges{
+			"id":   {From: json.RawMessage(`null`), To: json.RawMessage(`"unit-1"`)},
+			"make": {From: json.RawMessage(`null`), To: json.RawMessage(`"Mack"`)},
+			"trim": {From: json.RawMessage(`null`), To: json.RawMessage(`"LX"`)},
+		}},
+		{Action: HistoryUpdate, Version: 2, Timestamp: "2026-02-01T00:00:00.000000000Z", Changes: FieldChanges{
+			"note": {From: json.RawMessage(`""`), To: json.RawMessage(`"yard 7"`)},
+			"trim": {From: json.RawMessage(`"LX"`), To: json.RawMessage(`null`)},
+		}},
+	}
+
+	unit, err := ReplayHistory(entries)
+	require.NoError(t, err)
+	assert.Equal(t, "unit-1", unit.ID)
+	assert.Equal(t, "Mack", unit.Make)
+	assert.Equal(t, "yard 7", unit.Note)
+	assert.Nil(t, unit.Trim)
+	assert.Equal(t, int64(2), unit.Version)
+	assert.Equal(t, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC).Unix(), unit.UpdatedAt)
+
+	unit, err = ReplayHistory(nil)
+	require.NoError(t, err)
+	assert.Nil(t, unit)
+}
+
+func TestDynamicUnitHistory_RoundTrip(t *testing.T) {
+	created := &DynamicUnit{
+		ID: "unit-1", AccountID: "account-1", UnitType: "trailerType", SchemaVersion: 2, Version: 1,
+		CreatedAt: 1767225600, UpdatedAt: 1767225600,
+		Data: map[string]interface{}{"id": "unit-1", "accountId": "account-1", "paint": "red", "axles": float64(2)},
+	}
+	updated := *created
+	updated.Version = 2
+	updated.UpdatedAt = 1769904000
+	updated.Data = map[string]interface{}{"id": "unit-1", "accountId": "account-1", "paint": "blue"}
+
+	first, err := NewDynamicUnitHistoryEntry(HistoryCreate, nil, created, Actor{Username: "alice"}, time.Unix(created.UpdatedAt, 0))
+	require.NoError(t, err)
+	assert.Equal(t, "account-1", first.AccountID)
+	assert.Equal(t, "unit-1#trailerType#HIST#2026-01-01T00:00:00.000000000Z#0000000000000000001", first.SortKey)
+	assert.Equal(t, json.RawMessage(`"red"`), first.Changes["paint"].To)
+
+	second, err := NewDynamicUnitHistoryEntry(HistoryUpdate, created, &updated, Actor{Username: "bob"}, time.Unix(updated.UpdatedAt, 0))
+	require.NoError(t, err)
+	assert.Equal(t, FieldChanges{
+		"paint": {From: json.RawMessage(`"red"`), To: json.RawMessage(`"blue"`)},
+		"axles": {From: json.RawMessage(`2`), To: json.RawMessage(`null`)},
+	}, second.Changes)
+
+	unit, err := ReplayDynamicHistory([]UnitHistoryEntry{*first, *second})
+	require.NoError(t, err)
+	assert.Equal(t, "unit-1", unit.ID)
+	assert.Equal(t, "account-1", unit.AccountID)
+	assert.Equal(t, "trailerType", unit.UnitType)
+	assert.Equal(t, 2, unit.SchemaVersion)
+	assert.Equal(t, int64(2), unit.Version)
+	assert.Equal(t, updated.UpdatedAt, unit.UpdatedAt)
+	assert.Equal(t, created.CreatedAt, unit.CreatedAt)
+	assert.Equal(t, "blue", unit.Data["paint"])
+	assert.NotContains(t, unit.Data, "axles")
+	assert.False(t, unit.IsDeleted())
+}
@@ -0,0 +1,273 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// UnitPatch is a partial update to a Unit built from the fields present in a request.
+// Set maps DynamoDB attribute names to their new values and Remove lists the
+// attribute names of optional fields that were explicitly cleared with null.
+type UnitPatch struct {
+	Set    map[string]interface{}
+	Remove []string
+}
+
+// unitPatchField describes a Unit field that can be patched
+type unitPatchField struct {
+	index     int
+	attribute string
+	nullable  bool
+}
+
+// unitReadOnlyFields are maintained by the service and cannot be patched by clients
+var unitReadOnlyFields = map[string]bool{
+	"id":        true,
+	"accountId": true,
+	"unitType":  true,
+	"createdAt": true,
+	"updatedAt": true,
+	"deletedAt": true,
+	"deletedBy": true,
+	"expiresAt": true,
+	"version":   true,
+}
+
+// unitPatchFields indexes the patchable Unit fields by JSON name
+var unitPatchFields = buildUnitPatchFields()
+
+// unitFieldNames lists the JSON name of every Unit field, in declaration order
+var unitFieldNames = buildUnitFieldNames()
+
+func buildUnitFieldNames() []string {
+	unitType := reflect.TypeOf(Unit{})
+	names := make([]string, 0, unitType.NumField())
+	for i := 0; i < unitType.NumField(); i++ {
+		if name := tagName(unitType.Field(i).Tag.Get("json")); name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func buildUnitPatchFields() map[string]unitPatchField {
+	unitType := reflect.TypeOf(Unit{})
+	fields := make(map[string]unitPatchField, unitType.NumField())
+
+	for i := 0; i < unitType.NumField(); i++ {
+		field := unitType.Field(i)
+		jsonName := tagName(field.Tag.Get("json"))
+		attribute := tagName(field.Tag.Get("dynamodbav"))
+		if jsonName == "" || jsonName == "-" || attribute == "" || attribute == "-" || unitReadOnlyFields[jsonName] {
+			continue
+		}
+
+		kind := field.Type.Kind()
+		fields[jsonName] = unitPatchField{
+			index:     i,
+			attribute: attribute,
+			nullable:  kind == reflect.Ptr || kind == reflect.Slice,
+		}
+	}
+
+	return fields
+}
+
+// tagName returns the name portion of a struct tag value
+func tagName(tag string) string {
+	name, _, _ := strings.Cut(tag, ",")
+	return name
+}
+
+// NewUnitPatch builds a patch from the raw JSON value of each field present in an
+// update request. A present key is applied even when its value is empty; an
+// explicit null clears an optional field and is rejected for required fields.
+func NewUnitPatch(fields map[string]json.RawMessage) (*UnitPatch, error) {
+	patch := &UnitPatch{Set: make(map[string]interface{})}
+	unitType := reflect.TypeOf(Unit{})
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if unitReadOnlyFields[name] {
+			return nil, fmt.Errorf("field %s cannot be updated", name)
+		}
+		field, ok := unitPatchFields[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown field %s", name)
+		}
+
+		raw := bytes.TrimSpace(fields[name])
+		if bytes.Equal(raw, []byte("null")) {
+			if !field.nullable {
+				return nil, fmt.Errorf("field %s is required and cannot be cleared", name)
+			}
+			patch.Remove = append(patch.Remove, field.attribute)
+			continue
+		}
+
+		fieldType := unitType.Field(field.index).Type
+		value := reflect.New(fieldType)
+		if err := json.Unmarshal(raw, value.Interface()); err != nil {
+			return nil, fmt.Errorf("invalid value for field %s: %v", name, err)
+		}
+
+		switch fieldType.Kind() {
+		case reflect.Ptr:
+			patch.Set[field.attribute] = value.Elem().Elem().Interface()
+		case reflect.Slice:
+			// An empty list is stored the same way as a cleared one
+			if value.Elem().Len() == 0 {
+				patch.Remove = append(patch.Remove, field.attribute)
+				continue
+			}
+			patch.Set[field.attribute] = value.Elem().Interface()
+		default:
+			patch.Set[field.attribute] = value.Elem().Interface()
+		}
+	}
+
+	// Keep the indexed VIN in step with the VIN it is derived from
+	if vin, ok := patch.Set["suggestedVin"].(string); ok {
+		if normalized := NormalizeVin(vin); normalized != "" {
+			patch.Set["vin"] = normalized
+		} else {
+			patch.Remove = append(patch.Remove, "vin")
+		}
+	}
+
+	return patch, nil
+}
+
+// IsWritableUnitField reports whether a JSON field name is a Unit field clients can set
+func IsWritableUnitField(name string) bool {
+	_, ok := unitPatchFields[name]
+	return ok
+}
+
+// CanonicalUnitField returns the JSON name of the Unit field that encoding/json
+// decodes a key into, or the key itself when it matches no field. Decoding falls
+// back to a case-insensitive match, so "BasePrice" sets basePrice.
+func CanonicalUnitField(name string) string {
+	for _, field := range unitFieldNames {
+		if field == name {
+			return field
+		}
+	}
+	for _, field := range unitFieldNames {
+		if strings.EqualFold(field, name) {
+			return field
+		}
+	}
+	return name
+}
+
+// IsReadOnlyUnitField reports whether a JSON field name is a Unit field maintained by the service
+func IsReadOnlyUnitField(name string) bool {
+	return unitReadOnlyFields[name]
+}
+
+// UnitFromFields builds a new unit from the raw JSON value of each field of a record,
+// applying the same type checks as NewUnitPatch. Fields maintained by the service
+// cannot be set; null and empty values leave a field unset.
+func UnitFromFields(fields map[string]json.RawMessage) (*Unit, error) {
+	settable := make(map[string]json.RawMessage, len(fields))
+	for name, raw := range fields {
+		if IsReadOnlyUnitField(name) {
+			return nil, fmt.Errorf("field %s cannot be set", name)
+		}
+		if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+			continue
+		}
+		settable[name] = raw
+	}
+
+	patch, err := NewUnitPatch(settable)
+	if err != nil {
+		return nil, err
+	}
+
+	unit := &Unit{}
+	patch.ApplyTo(unit)
+	return unit, nil
+}
+
+// IsEmpty reports whether the patch changes nothing
+func (p *UnitPatch) IsEmpty() bool {
+	return len(p.Set) == 0 && len(p.Remove) == 0
+}
+
+// ChangesVin reports whether the patch sets or clears the indexed VIN
+func (p *UnitPatch) ChangesVin() bool {
+	if _, ok := p.Set["vin"]; ok {
+		return true
+	}
+	for _, attribute := range p.Remove {
+		if attribute == "vin" {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyTo applies the patch to a unit in memory, mirroring what the stored item receives
+func (p *UnitPatch) ApplyTo(unit *Unit) {
+	removed := make(map[string]bool, len(p.Remove))
+	for _, attribute := range p.Remove {
+		removed[attribute] = true
+	}
+
+	value := reflect.ValueOf(unit).Elem()
+	for _, field := range unitPatchFields {
+		target := value.Field(field.index)
+
+		newValue, ok := p.Set[field.attribute]
+		switch {
+		case removed[field.attribute]:
+			target.Set(reflect.Zero(target.Type()))
+		case ok && target.Kind() == reflect.Ptr:
+			ptr := reflect.New(target.Type().Elem())
+			ptr.Elem().Set(reflect.ValueOf(newValue))
+			target.Set(ptr)
+		case ok:
+			target.Set(reflect.ValueOf(newValue))
+		}
+	}
+}
+
+// FillEmptyFields copies each patchable field that is empty on the unit (an empty
+// string, nil pointer or empty list) from src, leaving fields the unit already has
+// untouched. It returns the JSON names of the fields it filled, sorted.
+func (u *Unit) FillEmptyFields(src *Unit) []string {
+	if src == nil {
+		return nil
+	}
+
+	target := reflect.ValueOf(u).Elem()
+	source := reflect.ValueOf(src).Elem()
+
+	var filled []string
+	for name, field := range unitPatchFields {
+		to := target.Field(field.index)
+		from := source.Field(field.index)
+		if !to.IsZero() || from.IsZero() {
+			continue
+		}
+		if to.Kind() == reflect.Slice && from.Len() == 0 {
+			continue
+		}
+		to.Set(from)
+		filled = append(filled, name)
+	}
+
+	sort.Strings(filled)
+	return filled
+}
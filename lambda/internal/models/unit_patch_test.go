@@ -0,0 +1,184 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rawFields(t *testing.T, doc string) map[string]json.RawMessage {
+	var fields map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal([]byte(doc), &fields))
+	return fields
+}
+
+func TestNewUnitPatch(t *testing.T) {
+	patch, err := NewUnitPatch(rawFields(t, `{
+		"make": "Mack",
+		"note": "",
+		"trim": "LX",
+		"series2": null,
+		"curbWeightPounds": "14000",
+		"extendedAttributes": [{"attributeName": "fleet", "attributeValue": "north"}],
+		"acesAttributes": []
+	}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]interface{}{
+		"make":               "Mack",
+		"note":               "",
+		"trim":               "LX",
+		"curbWeightPounds":   "14000",
+		"extendedAttributes": []ExtendedAttribute{{AttributeName: "fleet", AttributeValue: "north"}},
+	}, patch.Set)
+	assert.Equal(t, []string{"acesAttributes", "series2"}, patch.Remove)
+	assert.False(t, patch.IsEmpty())
+}
+
+func TestNewUnitPatch_CoversEveryUnitField(t *testing.T) {
+	// Every stored Unit field except the key (id, accountId, unitType, sk), the
+	// three timestamps, deletedBy, expiresAt, the version and the indexed vin
+	// must be patchable
+	assert.Len(t, unitPatchFields, reflect.TypeOf(Unit{}).NumField()-11)
+	assert.Contains(t, unitPatchFields, "adaptiveDrivingBeam")
+	assert.Contains(t, unitPatchFields, "acesAttributes")
+	assert.NotContains(t, unitPatchFields, "createdAt")
+}
+
+func TestNewUnitPatch_SetsIndexedVin(t *testing.T) {
+	patch, err := NewUnitPatch(rawFields(t, `{"suggestedVin": " 1xkad49x0rj-123456 "}`))
+	require.NoError(t, err)
+	assert.Equal(t, "1XKAD49X0RJ123456", patch.Set["vin"])
+
+	patch, err = NewUnitPatch(rawFields(t, `{"suggestedVin": ""}`))
+	require.NoError(t, err)
+	assert.NotContains(t, patch.Set, "vin")
+	assert.Equal(t, []string{"vin"}, patch.Remove)
+	assert.True(t, patch.ChangesVin())
+
+	patch, err = NewUnitPatch(rawFields(t, `{"make": "Mack"}`))
+	require.NoError(t, err)
+	assert.False(t, patch.ChangesVin())
+}
+
+func TestNewUnitPatch_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		wantErr string
+	}{
+		{name: "unknown field", doc: `{"colour": "red"}`, wantErr: "unknown field colour"},
+		{name: "read-only field", doc: `{"deletedAt": 0}`, wantErr: "field deletedAt cannot be updated"},
+		{name: "key field", doc: `{"accountId": "other"}`, wantErr: "field accountId cannot be updated"},
+		{name: "version", doc: `{"version": 7}`, wantErr: "field version cannot be updated"},
+		{name: "clear required field", doc: `{"make": null}`, wantErr: "field make is required and cannot be cleared"},
+		{name: "wrong type", doc: `{"trim": 7}`, wantErr: "invalid value for field trim"},
+		{name: "wrong list type", doc: `{"extendedAttributes": "fleet"}`, wantErr: "invalid value for field extendedAttributes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewUnitPatch(rawFields(t, tt.doc))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestUnitPatch_ApplyTo(t *testing.T) {
+	trim := "LX"
+	unit := &Unit{
+		ID:             "unit-1",
+		Make:           "Ford",
+		Model:          "F-150",
+		Trim:           &trim,
+		AcesAttributes: []AcesAttribute{{AttributeName: "a", AttributeValue: "b", AttributeKey: "c"}},
+	}
+
+	patch, err := NewUnitPatch(rawFields(t, `{"make": "Mack", "trim": null, "series2": "Day Cab", "acesAttributes": null}`))
+	require.NoError(t, err)
+	patch.ApplyTo(unit)
+
+	assert.Equal(t, "unit-1", unit.ID)
+	assert.Equal(t, "Mack", unit.Make)
+	assert.Equal(t, "F-150", unit.Model)
+	assert.Nil(t, unit.Trim)
+	require.NotNil(t, unit.Series2)
+	assert.Equal(t, "Day Cab", *unit.Series2)
+	assert.Nil(t, unit.AcesAttributes)
+}
+
+func TestUnit_FillEmptyFields(t *testing.T) {
+	trim := "LX"
+	decodedTrim := "EX"
+	plantState := "OHIO"
+	unit := &Unit{
+		ID:           "unit-1",
+		SuggestedVin: "1HGBH41JXMN109186",
+		Make:         "Honda",
+		Trim:         &trim,
+	}
+	decoded := &Unit{
+		ID:                 "ignored",
+		Make:               "HONDA",
+		Model:              "Accord",
+		ModelYear:          "1991",
+		Trim:               &decodedTrim,
+		PlantState:         &plantState,
+		ExtendedAttributes: []ExtendedAttribute{{AttributeName: "source", AttributeValue: "vpic"}},
+	}
+
+	filled := unit.FillEmptyFields(decoded)
+
+	assert.Equal(t, []string{"extendedAttributes", "model", "modelYear", "plantState"}, filled)
+	assert.Equal(t, "unit-1", unit.ID)
+	assert.Equal(t, "Honda", unit.Make)
+	assert.Equal(t, "Accord", unit.Model)
+	assert.Equal(t, "1991", unit.ModelYear)
+	assert.Equal(t, "LX", *unit.Trim)
+	assert.Equal(t, "OHIO", *unit.PlantState)
+	assert.Len(t, unit.ExtendedAttributes, 1)
+
+	assert.Nil(t, unit.FillEmptyFields(nil))
+}
+
+func TestUnitFromFields(t *testing.T) {
+	unit, err := UnitFromFields(rawFields(t, `{
+		"suggestedVin": "1HGBH41JXMN109186",
+		"make": "Honda",
+		"trim": "LX",
+		"series2": null,
+		"extendedAttributes": [{"attributeName": "fleet", "attributeValue": "north"}]
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, "1HGBH41JXMN109186", unit.SuggestedVin)
+	assert.Equal(t, "Honda", unit.Make)
+	require.NotNil(t, unit.Trim)
+	assert.Equal(t, "LX", *unit.Trim)
+	assert.Nil(t, unit.Series2)
+	assert.Equal(t, []ExtendedAttribute{{AttributeName: "fleet", AttributeValue: "north"}}, unit.ExtendedAttributes)
+
+	_, err = UnitFromFields(rawFields(t, `{"id": "unit-1"}`))
+	assert.EqualError(t, err, "field id cannot be set")
+	_, err = UnitFromFields(rawFields(t, `{"colour": "red"}`))
+	assert.EqualError(t, err, "unknown field colour")
+	_, err = UnitFromFields(rawFields(t, `{"doors": 4}`))
+	assert.ErrorContains(t, err, "invalid value for field doors")
+}
+
+func TestCanonicalUnitField(t *testing.T) {
+	assert.Equal(t, "basePrice", CanonicalUnitField("basePrice"))
+	assert.Equal(t, "basePrice", CanonicalUnitField("BasePrice"))
+	assert.Equal(t, "basePrice", CanonicalUnitField("BASEPRICE"))
+	assert.Equal(t, "expiresAt", CanonicalUnitField("ExpiresAt"))
+	assert.Equal(t, "colour", CanonicalUnitField("colour"))
+
+	// Decoding agrees on the field a differently cased key sets
+	var unit Unit
+	require.NoError(t, json.Unmarshal([]byte(`{"BASEPRICE":"1000"}`), &unit))
+	require.NotNil(t, unit.BasePrice)
+	assert.Equal(t, "1000", *unit.BasePrice)
+}
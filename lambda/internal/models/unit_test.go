@@ -210,10 +210,20 @@ func TestUnit_MarkDeleted(t *testing.T) {
 	unit := Unit{DeletedAt: 0}
 	beforeTime := time.Now().Unix()
 
-	unit.MarkDeleted()
+	unit.MarkDeleted(0)
 
 	assert.GreaterOrEqual(t, unit.DeletedAt, beforeTime)
 	assert.True(t, unit.IsDeleted())
+	assert.Zero(t, unit.ExpiresAt)
+}
+
+func TestUnit_MarkDeletedWithRetention(t *testing.T) {
+	unit := Unit{}
+
+	unit.MarkDeleted(30 * 24 * time.Hour)
+
+	assert.True(t, unit.IsDeleted())
+	assert.Equal(t, unit.DeletedAt+30*24*60*60, unit.ExpiresAt)
 }
 
 func TestExtendedAttribute(t *testing.T) {
@@ -319,6 +329,16 @@ func TestUnit_FullStructValidation(t *testing.T) {
 
 	// Test deletion
 	assert.False(t, unit.IsDeleted())
-	unit.MarkDeleted()
+	unit.MarkDeleted(0)
 	assert.True(t, unit.IsDeleted())
 }
+
+func TestNormalizeVin(t *testing.T) {
+	assert.Equal(t, "1XKAD49X0RJ123456", NormalizeVin("1xkad49x0rj123456"))
+	assert.Equal(t, "1XKAD49X0RJ123456", NormalizeVin(" 1XK-AD49X0 RJ123456\t"))
+	assert.Equal(t, "", NormalizeVin(" - "))
+
+	unit := &Unit{SuggestedVin: "1xkad49x0rj123456"}
+	unit.SetVin()
+	assert.Equal(t, "1XKAD49X0RJ123456", unit.Vin)
+}
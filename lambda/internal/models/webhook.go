@@ -0,0 +1,218 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WebhookStatus tells whether a webhook subscription receives deliveries
+type WebhookStatus string
+
+const (
+	WebhookActive   WebhookStatus = "ACTIVE"
+	WebhookDisabled WebhookStatus = "DISABLED" // By its owner, or automatically after repeated failed deliveries
+)
+
+// WebhookSubscriptionPrefix starts the partition key of an account's webhook
+// subscriptions, stored under WEBHOOK#{accountId} with the subscription ID as sort key
+const WebhookSubscriptionPrefix = "WEBHOOK#"
+
+// WebhookDeliveryPrefix starts the partition key of a subscription's delivery
+// attempts, stored under WEBHOOKDELIVERY#{accountId}#{subscriptionId}
+const WebhookDeliveryPrefix = "WEBHOOKDELIVERY#"
+
+// webhookSecretBytes is the length of generated signing secrets
+const webhookSecretBytes = 32
+
+// WebhookSubscription is an account's endpoint for unit change notifications.
+// Empty EventTypes or UnitTypes match every event type or unit type. The item
+// deliberately has no id or unitType attribute, so it never shows up in the
+// unit ID index or as a unit in the table's stream.
+type WebhookSubscription struct {
+	AccountID  string        `json:"accountId" dynamodbav:"accountId"`
+	ID         string        `json:"id" dynamodbav:"subscriptionId"`
+	URL        string        `json:"url" dynamodbav:"url"`
+	Secret     string        `json:"secret,omitempty" dynamodbav:"secret"` // Only returned when it is created or rotated
+	EventTypes []string      `json:"eventTypes" dynamodbav:"eventTypes"`
+	UnitTypes  []string      `json:"unitTypes" dynamodbav:"unitTypes"`
+	Status     WebhookStatus `json:"status" dynamodbav:"status"`
+
+	// Delivery health
+	ConsecutiveFailures int    `json:"consecutiveFailures" dynamodbav:"consecutiveFailures"`
+	LastDeliveredAt     int64  `json:"lastDeliveredAt,omitempty" dynamodbav:"lastDeliveredAt,omitempty"`
+	LastFailedAt        int64  `json:"lastFailedAt,omitempty" dynamodbav:"lastFailedAt,omitempty"`
+	DisabledAt          int64  `json:"disabledAt,omitempty" dynamodbav:"disabledAt,omitempty"`
+	DisabledReason      string `json:"disabledReason,omitempty" dynamodbav:"disabledReason,omitempty"`
+
+	CreatedAt int64 `json:"createdAt" dynamodbav:"createdAt"`
+	UpdatedAt int64 `json:"updatedAt" dynamodbav:"updatedAt"`
+
+	// Computed DynamoDB keys - set by SetKeys
+	PartitionKey string `json:"-" dynamodbav:"pk"`
+	SortKey      string `json:"-" dynamodbav:"sk"`
+}
+
+// NewWebhookSubscription returns an active subscription with a new ID, its keys
+// and timestamps set, and a generated secret when none is given
+func NewWebhookSubscription(accountID, endpoint, secret string, eventTypes, unitTypes []string) (*WebhookSubscription, error) {
+	if secret == "" {
+		generated, err := GenerateWebhookSecret()
+		if err != nil {
+			return nil, err
+		}
+		secret = generated
+	}
+	now := time.Now().Unix()
+	subscription := &WebhookSubscription{
+		AccountID:  accountID,
+		ID:         uuid.New().String(),
+		URL:        endpoint,
+		Secret:     secret,
+		EventTypes: nonNil(eventTypes),
+		UnitTypes:  nonNil(unitTypes),
+		Status:     WebhookActive,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	subscription.SetKeys()
+	return subscription, nil
+}
+
+// SetKeys sets the DynamoDB keys from the account and subscription ID
+func (s *WebhookSubscription) SetKeys() {
+	s.PartitionKey = WebhookSubscriptionPrefix + s.AccountID
+	s.SortKey = s.ID
+}
+
+// Validate checks the subscription's endpoint and secret
+func (s *WebhookSubscription) Validate() error {
+	if s.AccountID == "" {
+		return errors.New("accountId is required")
+	}
+	if err := ValidateWebhookURL(s.URL); err != nil {
+		return err
+	}
+	return ValidateWebhookSecret(s.Secret)
+}
+
+// IsActive reports whether the subscription receives deliveries
+func (s *WebhookSubscription) IsActive() bool {
+	return s.Status == WebhookActive
+}
+
+// Matches reports whether an event of eventType about a unit of unitType is
+// delivered to the subscription
+func (s *WebhookSubscription) Matches(eventType, unitType string) bool {
+	return matchesAny(s.EventTypes, eventType) && matchesAny(s.UnitTypes, unitType)
+}
+
+// Redacted returns a copy of the subscription without its secret
+func (s WebhookSubscription) Redacted() WebhookSubscription {
+	s.Secret = ""
+	return s
+}
+
+// ValidateWebhookURL checks that a webhook endpoint is an absolute https URL
+func ValidateWebhookURL(endpoint string) error {
+	if endpoint == "" {
+		return errors.New("url is required")
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("url is invalid: %w", err)
+	}
+	if parsed.Scheme != "https" || parsed.Host == "" {
+		return fmt.Errorf("url must be an absolute https URL, got %q", endpoint)
+	}
+	if parsed.User != nil {
+		return errors.New("url must not contain credentials")
+	}
+	return nil
+}
+
+// ValidateWebhookSecret checks that a signing secret is long enough to be hard to guess
+func ValidateWebhookSecret(secret string) error {
+	if len(secret) < 16 {
+		return errors.New("secret must be at least 16 characters")
+	}
+	return nil
+}
+
+// GenerateWebhookSecret returns a random signing secret
+func GenerateWebhookSecret() (string, error) {
+	secret := make([]byte, webhookSecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+// WebhookSubscriptionPatch holds the changes to a subscription; nil fields are left as they are
+type WebhookSubscriptionPatch struct {
+	URL        *string
+	Secret     *string
+	EventTypes *[]string
+	UnitTypes  *[]string
+	Status     *WebhookStatus // Setting ACTIVE re-enables a disabled subscription and clears its failures
+}
+
+// WebhookDelivery is one attempt to deliver an event to a subscription. Attempts
+// are stored newest last under the subscription's delivery partition and expire
+// with the table's TTL.
+type WebhookDelivery struct {
+	AccountID      string `json:"accountId" dynamodbav:"accountId"`
+	SubscriptionID string `json:"subscriptionId" dynamodbav:"subscriptionId"`
+	EventID        string `json:"eventId" dynamodbav:"eventId"`
+	EventType      string `json:"eventType" dynamodbav:"eventType"`
+	UnitID         string `json:"unitId" dynamodbav:"unitId"`
+	Attempt        int    `json:"attempt" dynamodbav:"attempt"` // 1 for the first try of an event
+	AttemptedAt    string `json:"attemptedAt" dynamodbav:"attemptedAt"`
+	Success        bool   `json:"success" dynamodbav:"success"`
+	StatusCode     int    `json:"statusCode,omitempty" dynamodbav:"statusCode,omitempty"` // Response status, absent when no response came back
+	Error          string `json:"error,omitempty" dynamodbav:"error,omitempty"`
+	DurationMs     int64  `json:"durationMs" dynamodbav:"durationMs"`
+
+	ExpiresAt int64 `json:"-" dynamodbav:"expiresAt,omitempty"` // DynamoDB TTL
+
+	// Computed DynamoDB keys - set by SetKeys
+	PartitionKey string `json:"-" dynamodbav:"pk"`
+	SortKey      string `json:"-" dynamodbav:"sk"`
+}
+
+// WebhookDeliveryPartition returns the partition key of a subscription's delivery attempts
+func WebhookDeliveryPartition(accountID, subscriptionID string) string {
+	return WebhookDeliveryPrefix + accountID + "#" + subscriptionID
+}
+
+// SetKeys sets the DynamoDB keys; attempts sort by time, then event and attempt number
+func (d *WebhookDelivery) SetKeys() {
+	d.PartitionKey = WebhookDeliveryPartition(d.AccountID, d.SubscriptionID)
+	d.SortKey = fmt.Sprintf("%s#%s#%03d", d.AttemptedAt, d.EventID, d.Attempt)
+}
+
+// matchesAny reports whether value is in filter, or filter is empty
+func matchesAny(filter []string, value string) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	for _, allowed := range filter {
+		if allowed == value {
+			return true
+		}
+	}
+	return false
+}
+
+// nonNil returns values, or an empty slice so it marshals to [] instead of null
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
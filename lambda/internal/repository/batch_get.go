@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// BatchGetChunkSize is the most keys DynamoDB accepts in one BatchGetItem call
+const BatchGetChunkSize = 100
+
+// batchGetItems reads the items with keys using BatchGetItem in chunks of
+// BatchGetChunkSize, retrying unprocessed keys with exponential backoff. It returns
+// one item and one error per key: the item is nil where no item has the key, and
+// the error is set where the key could not be read. Keys must be distinct.
+// Consistent reads see every write that completed before the call.
+func batchGetItems(ctx context.Context, client DynamoDBAPI, tableName string, keys []map[string]types.AttributeValue, consistent bool) ([]map[string]types.AttributeValue, []error) {
+	items := make([]map[string]types.AttributeValue, len(keys))
+	errs := make([]error, len(keys))
+	for start := 0; start < len(keys); start += BatchGetChunkSize {
+		end := start + BatchGetChunkSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		batchGetChunk(ctx, client, tableName, keys[start:end], consistent, items[start:end], errs[start:end])
+	}
+	return items, errs
+}
+
+// batchGetChunk reads up to BatchGetChunkSize keys and records the item or error
+// of each in items and errs
+func batchGetChunk(ctx context.Context, client DynamoDBAPI, tableName string, keys []map[string]types.AttributeValue, consistent bool, items []map[string]types.AttributeValue, errs []error) {
+	// Items and unprocessed keys come back without their position, so track them by key
+	pending := make(map[string]int, len(keys))
+	for i, key := range keys {
+		pending[itemKey(key)] = i
+	}
+
+	request := types.KeysAndAttributes{Keys: keys, ConsistentRead: aws.Bool(consistent)}
+	delay := batchRetryBaseDelay
+	for attempt := 1; ; attempt++ {
+		output, err := client.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+			RequestItems: map[string]types.KeysAndAttributes{tableName: request},
+		})
+		if err != nil {
+			for _, i := range pending {
+				errs[i] = fmt.Errorf("failed to read item: %w", err)
+			}
+			return
+		}
+
+		for _, item := range output.Responses[tableName] {
+			key := itemKey(item)
+			if i, ok := pending[key]; ok {
+				items[i] = item
+				delete(pending, key)
+			}
+		}
+
+		// Keys neither returned nor unprocessed have no item
+		request = output.UnprocessedKeys[tableName]
+		request.ConsistentRead = aws.Bool(consistent)
+		unprocessed := make(map[string]int, len(request.Keys))
+		for _, key := range request.Keys {
+			if i, ok := pending[itemKey(key)]; ok {
+				unprocessed[itemKey(key)] = i
+			}
+		}
+		pending = unprocessed
+		if len(pending) == 0 {
+			return
+		}
+
+		if attempt == batchMaxAttempts {
+			for _, i := range pending {
+				errs[i] = fmt.Errorf("key still unprocessed after %d attempts", batchMaxAttempts)
+			}
+			return
+		}
+
+		if err := waitToRetry(ctx, delay); err != nil {
+			for _, i := range pending {
+				errs[i] = fmt.Errorf("failed to read item: %w", err)
+			}
+			return
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// BatchWriteChunkSize is the most items DynamoDB accepts in one BatchWriteItem call
+const BatchWriteChunkSize = 25
+
+// batchMaxAttempts bounds how many times a chunk is sent while DynamoDB keeps
+// returning some of its items or keys as unprocessed
+const batchMaxAttempts = 5
+
+// batchRetryBaseDelay is the wait before the first retry of unprocessed items or keys; it
+// doubles on each further retry
+var batchRetryBaseDelay = 50 * time.Millisecond
+
+// batchPutItems writes items with BatchWriteItem in chunks of BatchWriteChunkSize,
+// retrying unprocessed items with exponential backoff. It returns one error per
+// item, nil where the item was written. Items in one call must have distinct keys.
+func batchPutItems(ctx context.Context, client DynamoDBAPI, tableName string, items []map[string]types.AttributeValue) []error {
+	errs := make([]error, len(items))
+	for start := 0; start < len(items); start += BatchWriteChunkSize {
+		end := start + BatchWriteChunkSize
+		if end > len(items) {
+			end = len(items)
+		}
+		batchPutChunk(ctx, client, tableName, items[start:end], errs[start:end])
+	}
+	return errs
+}
+
+// batchPutChunk writes up to BatchWriteChunkSize items and records the outcome of
+// each in errs
+func batchPutChunk(ctx context.Context, client DynamoDBAPI, tableName string, items []map[string]types.AttributeValue, errs []error) {
+	// Unprocessed items come back without their position, so track them by key
+	pending := make(map[string]int, len(items))
+	requests := make([]types.WriteRequest, 0, len(items))
+	for i, item := range items {
+		pending[itemKey(item)] = i
+		requests = append(requests, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}})
+	}
+
+	delay := batchRetryBaseDelay
+	for attempt := 1; ; attempt++ {
+		output, err := client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{tableName: requests},
+		})
+		if err != nil {
+			for _, i := range pending {
+				errs[i] = fmt.Errorf("failed to write item: %w", err)
+			}
+			return
+		}
+
+		requests = output.UnprocessedItems[tableName]
+		unprocessed := make(map[string]int, len(requests))
+		for _, request := range requests {
+			if request.PutRequest == nil {
+				continue
+			}
+			key := itemKey(request.PutRequest.Item)
+			if i, ok := pending[key]; ok {
+				unprocessed[key] = i
+			}
+		}
+		pending = unprocessed
+		if len(pending) == 0 {
+			return
+		}
+
+		if attempt == batchMaxAttempts {
+			for _, i := range pending {
+				errs[i] = fmt.Errorf("item still unprocessed after %d attempts", batchMaxAttempts)
+			}
+			return
+		}
+
+		if err := waitToRetry(ctx, delay); err != nil {
+			for _, i := range pending {
+				errs[i] = fmt.Errorf("failed to write item: %w", err)
+			}
+			return
+		}
+		delay *= 2
+	}
+}
+
+// itemKey identifies an item in a batch by its primary key
+func itemKey(item map[string]types.AttributeValue) string {
+	var pk, sk string
+	if value, ok := item["pk"].(*types.AttributeValueMemberS); ok {
+		pk = value.Value
+	}
+	if value, ok := item["sk"].(*types.AttributeValueMemberS); ok {
+		sk = value.Value
+	}
+	return pk + "\x00" + sk
+}
+
+// waitToRetry waits delay before a batch is retried, or returns the context's
+// error if it is done first
+func waitToRetry(ctx context.Context, delay time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// BackfillOptions controls a schema migration backfill run
+type BackfillOptions struct {
+	// AccountID restricts the run to one account partition (Query); empty scans the whole table
+	AccountID string
+	// UnitTypes restricts the run to these unit types; empty means every type known to the migrator
+	UnitTypes []string
+	// DryRun counts stale items without rewriting them
+	DryRun bool
+	// PageSize is the DynamoDB page size for each Query/Scan call
+	PageSize int32
+}
+
+// BackfillResult summarizes a backfill run
+type BackfillResult struct {
+	Scanned  int `json:"scanned"`
+	Stale    int `json:"stale"`
+	Migrated int `json:"migrated"`
+	Failed   int `json:"failed"`
+}
+
+// Backfill walks the table and rewrites dynamic unit items stored under an older schema version
+func (r *DynamoDBDynamicUnitRepository) Backfill(ctx context.Context, opts BackfillOptions) (*BackfillResult, error) {
+	if r.migrator == nil {
+		return nil, errors.New("backfill requires a schema migrator")
+	}
+
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+
+	unitTypes := make(map[string]bool, len(opts.UnitTypes))
+	for _, unitType := range opts.UnitTypes {
+		unitTypes[unitType] = true
+	}
+
+	result := &BackfillResult{}
+	var startKey map[string]types.AttributeValue
+
+	for {
+		items, lastKey, err := r.backfillPage(ctx, opts.AccountID, pageSize, startKey)
+		if err != nil {
+			return result, err
+		}
+
+		for _, item := range items {
+			result.Scanned++
+			r.backfillItem(ctx, item, unitTypes, opts.DryRun, result)
+		}
+
+		if lastKey == nil {
+			break
+		}
+		startKey = lastKey
+	}
+
+	return result, nil
+}
+
+// backfillPage reads one page of items, querying a single partition when an account is given
+func (r *DynamoDBDynamicUnitRepository) backfillPage(ctx context.Context, accountID string, pageSize int32, startKey map[string]types.AttributeValue) ([]map[string]types.AttributeValue, map[string]types.AttributeValue, error) {
+	if accountID != "" {
+		output, err := r.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(r.tableName),
+			KeyConditionExpression: aws.String("pk = :accountId"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":accountId": &types.AttributeValueMemberS{Value: accountID},
+			},
+			Limit:             aws.Int32(pageSize),
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to query units: %w", err)
+		}
+		return output.Items, output.LastEvaluatedKey, nil
+	}
+
+	output, err := r.client.Scan(ctx, &dynamodb.ScanInput{
+		TableName:         aws.String(r.tableName),
+		Limit:             aws.Int32(pageSize),
+		ExclusiveStartKey: startKey,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to scan units: %w", err)
+	}
+	return output.Items, output.LastEvaluatedKey, nil
+}
+
+// backfillItem migrates and rewrites a single item if it is a stale dynamic unit
+func (r *DynamoDBDynamicUnitRepository) backfillItem(ctx context.Context, item map[string]types.AttributeValue, unitTypes map[string]bool, dryRun bool, result *BackfillResult) {
+	unit, err := unmarshalDynamicUnit(item)
+	if err != nil {
+		log.Printf("Skipping unreadable item: %v", err)
+		result.Failed++
+		return
+	}
+
+	// Only dynamic unit items (sk = unitType#id) of the selected types are migrated
+	if !isDynamicUnitSortKey(item, unit.UnitType) {
+		return
+	}
+	if len(unitTypes) > 0 && !unitTypes[unit.UnitType] {
+		return
+	}
+
+	stale, err := r.migrator.NeedsMigration(unit)
+	if err != nil || !stale {
+		return
+	}
+	result.Stale++
+	if dryRun {
+		return
+	}
+
+	storedVersion := unit.SchemaVersion
+	if _, err := r.migrator.Migrate(unit); err != nil {
+		log.Printf("Failed to migrate unit %s for account %s: %v", unit.ID, unit.AccountID, err)
+		result.Failed++
+		return
+	}
+	if err := r.putMigrated(ctx, unit, storedVersion); err != nil {
+		log.Printf("Failed to rewrite unit %s for account %s: %v", unit.ID, unit.AccountID, err)
+		result.Failed++
+		return
+	}
+	result.Migrated++
+}
+
+// isDynamicUnitSortKey reports whether the stored sort key uses the dynamic unit layout (unitType#id)
+func isDynamicUnitSortKey(item map[string]types.AttributeValue, unitType string) bool {
+	sk, ok := item["sk"].(*types.AttributeValueMemberS)
+	return ok && unitType != "" && strings.HasPrefix(sk.Value, unitType+"#")
+}
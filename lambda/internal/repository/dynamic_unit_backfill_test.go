@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+)
+
+const (
+	backfillSchemaV1 = `{"type":"object","properties":{"id":{},"accountId":{},"unitType":{},"color":{"type":"string"}},"additionalProperties":false}`
+	backfillSchemaV2 = `{"type":"object","properties":{"id":{},"accountId":{},"unitType":{},"paint":{"type":"string"}},"additionalProperties":false}`
+)
+
+func newBackfillMigrator(t *testing.T) *models.SchemaMigrator {
+	registry := models.NewSchemaRegistry()
+	require.NoError(t, registry.Register("trailerType", 1, []byte(backfillSchemaV1)))
+	require.NoError(t, registry.Register("trailerType", 2, []byte(backfillSchemaV2)))
+
+	migrator := models.NewSchemaMigrator(registry)
+	migrator.Register("trailerType", func(data map[string]interface{}) (map[string]interface{}, error) {
+		if color, ok := data["color"]; ok {
+			data["paint"] = color
+			delete(data, "color")
+		}
+		return data, nil
+	})
+	return migrator
+}
+
+func mustMarshalItem(t *testing.T, item map[string]interface{}) map[string]types.AttributeValue {
+	av, err := attributevalue.MarshalMap(item)
+	require.NoError(t, err)
+	return av
+}
+
+func TestDynamoDBDynamicUnitRepository_Backfill(t *testing.T) {
+	staleItem := mustMarshalItem(t, map[string]interface{}{
+		"pk": "account-1", "sk": "trailerType#unit-1", "id": "unit-1", "unitType": "trailerType",
+		"schemaVersion": 1, "color": "red",
+	})
+	currentItem := mustMarshalItem(t, map[string]interface{}{
+		"pk": "account-1", "sk": "trailerType#unit-2", "id": "unit-2", "unitType": "trailerType",
+		"schemaVersion": 2, "paint": "blue",
+	})
+	legacyItem := mustMarshalItem(t, map[string]interface{}{
+		"pk": "account-1", "sk": "unit-3#trailerType", "id": "unit-3", "unitType": "trailerType",
+	})
+
+	scanCalls := 0
+	client := &fakeDynamoDB{
+		scan: func(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+			scanCalls++
+			if input.ExclusiveStartKey == nil {
+				return &dynamodb.ScanOutput{
+					Items:            []map[string]types.AttributeValue{staleItem, legacyItem},
+					LastEvaluatedKey: map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: "account-1"}},
+				}, nil
+			}
+			return &dynamodb.ScanOutput{Items: []map[string]types.AttributeValue{currentItem}}, nil
+		},
+	}
+
+	repo := NewDynamoDBDynamicUnitRepository(client, "units", newBackfillMigrator(t), false)
+	result, err := repo.Backfill(context.Background(), BackfillOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, scanCalls)
+	assert.Equal(t, &BackfillResult{Scanned: 3, Stale: 1, Migrated: 1}, result)
+
+	require.Len(t, client.putInputs, 1)
+	put := client.putInputs[0]
+	assert.Equal(t, "attribute_exists(pk) AND schemaVersion = :storedVersion", *put.ConditionExpression)
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "2"}, put.Item["schemaVersion"])
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "red"}, put.Item["paint"])
+	assert.NotContains(t, put.Item, "color")
+}
+
+func TestDynamoDBDynamicUnitRepository_BackfillDryRunByAccount(t *testing.T) {
+	staleItem := mustMarshalItem(t, map[string]interface{}{
+		"pk": "account-1", "sk": "trailerType#unit-1", "id": "unit-1", "unitType": "trailerType", "color": "red",
+	})
+
+	var queried string
+	client := &fakeDynamoDB{
+		query: func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+			queried = input.ExpressionAttributeValues[":accountId"].(*types.AttributeValueMemberS).Value
+			return &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{staleItem}}, nil
+		},
+	}
+
+	repo := NewDynamoDBDynamicUnitRepository(client, "units", newBackfillMigrator(t), false)
+	result, err := repo.Backfill(context.Background(), BackfillOptions{AccountID: "account-1", DryRun: true})
+	require.NoError(t, err)
+
+	assert.Equal(t, "account-1", queried)
+	assert.Equal(t, &BackfillResult{Scanned: 1, Stale: 1}, result)
+	assert.Empty(t, client.putInputs)
+}
+
+func TestDynamoDBDynamicUnitRepository_GetByKeyMigratesOnRead(t *testing.T) {
+	staleItem := mustMarshalItem(t, map[string]interface{}{
+		"pk": "account-1", "sk": "trailerType#unit-1", "id": "unit-1", "unitType": "trailerType",
+		"schemaVersion": 1, "color": "red",
+	})
+
+	tests := []struct {
+		name       string
+		writeBack  bool
+		wantWrites int
+	}{
+		{name: "in memory only", writeBack: false, wantWrites: 0},
+		{name: "with write-back", writeBack: true, wantWrites: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeDynamoDB{
+				getItem: func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+					return &dynamodb.GetItemOutput{Item: staleItem}, nil
+				},
+			}
+
+			repo := NewDynamoDBDynamicUnitRepository(client, "units", newBackfillMigrator(t), tt.writeBack)
+			unit, err := repo.GetByKey(context.Background(), "account-1", "unit-1", "trailerType")
+			require.NoError(t, err)
+			require.NotNil(t, unit)
+
+			assert.Equal(t, 2, unit.SchemaVersion)
+			assert.Equal(t, "red", unit.Data["paint"])
+			assert.Len(t, client.putInputs, tt.wantWrites)
+		})
+	}
+}
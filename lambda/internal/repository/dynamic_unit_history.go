@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+// recordedWrite applies a conditional write to a dynamic unit that turned before
+// into after together with the put of the history item recording it, in one
+// transaction. When the unit's condition fails the error is a
+// ConditionalCheckFailedException carrying the unit's current item, as the write
+// on its own would return.
+func (r *DynamoDBDynamicUnitRepository) recordedWrite(ctx context.Context, action models.HistoryAction, write types.TransactWriteItem, before, after *models.DynamicUnit) error {
+	entry, err := models.NewDynamicUnitHistoryEntry(action, before, after, actorFrom(ctx), time.Now())
+	if err != nil {
+		return err
+	}
+	put, err := historyEntryPut(r.tableName, entry)
+	if err != nil {
+		return err
+	}
+	return transactRecorded(ctx, r.client, write, []types.TransactWriteItem{{Put: put}})
+}
+
+// deleteRecorded applies a soft delete built by Delete and records it. A unit that
+// cannot be deleted fails as the conditional update would, without writing.
+func (r *DynamoDBDynamicUnitRepository) deleteRecorded(ctx context.Context, input *dynamodb.UpdateItemInput, expectedVersion int64) error {
+	item, before, err := r.storedUnit(ctx, input.Key)
+	if err != nil {
+		return err
+	}
+	if !isDynamicLiveAt(before, expectedVersion) {
+		return &types.ConditionalCheckFailedException{Item: item}
+	}
+	after := softDeletedDynamicUnit(before, input.ExpressionAttributeValues)
+	return r.recordedWrite(ctx, models.HistoryDelete, types.TransactWriteItem{Update: transactUpdate(input)}, before, after)
+}
+
+// restoreRecorded applies an undelete built by Restore, records it and returns the
+// restored unit. A unit that cannot be restored fails as the conditional update
+// would, without writing.
+func (r *DynamoDBDynamicUnitRepository) restoreRecorded(ctx context.Context, input *dynamodb.UpdateItemInput, expectedVersion int64) (*models.DynamicUnit, error) {
+	item, before, err := r.storedUnit(ctx, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	if before == nil || !before.IsDeleted() || before.Version != expectedVersion {
+		return nil, &types.ConditionalCheckFailedException{Item: item}
+	}
+	after := restoredDynamicUnit(before, input.ExpressionAttributeValues)
+	if err := r.recordedWrite(ctx, models.HistoryRestore, types.TransactWriteItem{Update: transactUpdate(input)}, before, after); err != nil {
+		return nil, err
+	}
+	return after, nil
+}
+
+// storedUnit reads the current item of a dynamic unit, deleted or not, with a
+// consistent read. Both results are nil when there is no such unit.
+func (r *DynamoDBDynamicUnitRepository) storedUnit(ctx context.Context, key map[string]types.AttributeValue) (map[string]types.AttributeValue, *models.DynamicUnit, error) {
+	output, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(r.tableName),
+		Key:            key,
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get unit: %w", err)
+	}
+	if output.Item == nil {
+		return nil, nil, nil
+	}
+
+	unit, err := unmarshalDynamicUnit(output.Item)
+	if err != nil {
+		return nil, nil, err
+	}
+	return output.Item, unit, nil
+}
+
+// isDynamicLiveAt reports whether a stored dynamic unit exists, is not deleted and is at expectedVersion
+func isDynamicLiveAt(unit *models.DynamicUnit, expectedVersion int64) bool {
+	return unit != nil && !unit.IsDeleted() && unit.Version == expectedVersion
+}
+
+// softDeletedDynamicUnit returns unit as the UpdateItem built by Delete leaves it
+func softDeletedDynamicUnit(unit *models.DynamicUnit, values map[string]types.AttributeValue) *models.DynamicUnit {
+	deleted := *unit
+	deleted.DeletedAt = expressionNumber(values, ":now")
+	deleted.UpdatedAt = deleted.DeletedAt
+	deleted.ExpiresAt = expressionNumber(values, ":expiresAt")
+	deleted.Version = expressionNumber(values, ":newVersion")
+	return &deleted
+}
+
+// restoredDynamicUnit returns unit as the UpdateItem built by Restore leaves it
+func restoredDynamicUnit(unit *models.DynamicUnit, values map[string]types.AttributeValue) *models.DynamicUnit {
+	restored := *unit
+	restored.DeletedAt = 0
+	restored.ExpiresAt = 0
+	restored.UpdatedAt = expressionNumber(values, ":now")
+	restored.Version = expressionNumber(values, ":newVersion")
+	return &restored
+}
+
+// GetHistory retrieves a page of a dynamic unit's history, newest change first.
+// Deleted and purged units keep their history.
+func (r *DynamoDBDynamicUnitRepository) GetHistory(ctx context.Context, input *appsync.GetUnitHistoryInput) (*appsync.UnitHistoryResponse, error) {
+	return queryHistory(ctx, r.client, r.tableName, r.tokens, input)
+}
+
+// GetAsOf rebuilds a dynamic unit as it was at asOf by replaying its history up to
+// that moment, at the schema version it had then. It returns nil when the unit had
+// not been created yet or was deleted at the time, and ErrHistoryIncomplete when its
+// history does not start with its creation.
+func (r *DynamoDBDynamicUnitRepository) GetAsOf(ctx context.Context, accountID, unitID, unitType string, asOf time.Time) (*models.DynamicUnit, error) {
+	entries, err := historyUpTo(ctx, r.client, r.tableName, accountID, unitID, unitType, asOf)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+
+	unit, err := models.ReplayDynamicHistory(entries)
+	if err != nil {
+		return nil, err
+	}
+	if unit.IsDeleted() {
+		return nil, nil
+	}
+	return unit, nil
+}
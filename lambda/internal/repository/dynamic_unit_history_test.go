@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+)
+
+// storedTrailer is the item of a live schema-driven unit at version 3
+func storedTrailer(t *testing.T) map[string]types.AttributeValue {
+	return mustMarshalItem(t, map[string]interface{}{
+		"pk": "account-1", "sk": "trailerType#unit-1", "id": "unit-1", "unitType": "trailerType", "accountId": "account-1",
+		"paint": "red", "version": 3, "deletedAt": 0, "createdAt": 1767225600, "updatedAt": 1767225600,
+	})
+}
+
+func TestDynamoDBDynamicUnitRepository_CreateRecordsHistory(t *testing.T) {
+	client := &fakeDynamoDB{}
+	repo := NewDynamoDBDynamicUnitRepository(client, "units", nil, false).WithHistory(true)
+	ctx := WithActor(context.Background(), models.Actor{Username: "jo"})
+
+	unit := &models.DynamicUnit{AccountID: "account-1", UnitType: "trailerType", Data: map[string]interface{}{"paint": "red"}}
+	require.NoError(t, repo.Create(ctx, unit))
+
+	assert.Empty(t, client.putInputs)
+	require.Len(t, client.transactInputs, 1)
+	items := client.transactInputs[0].TransactItems
+	require.Len(t, items, 2)
+	require.NotNil(t, items[0].Put)
+	assert.Equal(t, "attribute_not_exists(pk) AND attribute_not_exists(sk)", *items[0].Put.ConditionExpression)
+
+	entry := historyEntry(t, items[1])
+	assert.True(t, strings.HasPrefix(entry.SortKey, unit.ID+"#trailerType#HIST#"))
+	assert.Equal(t, models.HistoryCreate, entry.Action)
+	assert.Equal(t, int64(1), entry.Version)
+	assert.Equal(t, models.Actor{Username: "jo"}, entry.Actor)
+	assert.JSONEq(t, `"red"`, string(entry.Changes["paint"].To))
+}
+
+func TestDynamoDBDynamicUnitRepository_UpdateRecordsHistory(t *testing.T) {
+	var read *dynamodb.GetItemInput
+	client := &fakeDynamoDB{
+		getItem: func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			read = input
+			return &dynamodb.GetItemOutput{Item: storedTrailer(t)}, nil
+		},
+	}
+	repo := NewDynamoDBDynamicUnitRepository(client, "units", nil, false).WithHistory(true)
+
+	unit := &models.DynamicUnit{ID: "unit-1", AccountID: "account-1", UnitType: "trailerType", Version: 3, CreatedAt: 1767225600,
+		Data: map[string]interface{}{"id": "unit-1", "accountId": "account-1", "unitType": "trailerType", "paint": "blue"}}
+	require.NoError(t, repo.Update(context.Background(), unit))
+
+	require.NotNil(t, read)
+	assert.True(t, *read.ConsistentRead)
+	assert.Empty(t, client.putInputs)
+	require.Len(t, client.transactInputs, 1)
+	items := client.transactInputs[0].TransactItems
+	require.Len(t, items, 2)
+	require.NotNil(t, items[0].Put)
+	assert.Contains(t, *items[0].Put.ConditionExpression, "#version = :expectedVersion")
+
+	entry := historyEntry(t, items[1])
+	assert.Equal(t, models.HistoryUpdate, entry.Action)
+	assert.Equal(t, int64(4), entry.Version)
+	assert.Equal(t, models.FieldChanges{
+		"paint": {From: json.RawMessage(`"red"`), To: json.RawMessage(`"blue"`)},
+	}, entry.Changes)
+}
+
+func TestDynamoDBDynamicUnitRepository_UpdateWithHistoryFailsStaleVersion(t *testing.T) {
+	client := &fakeDynamoDB{
+		getItem: func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{Item: storedTrailer(t)}, nil
+		},
+	}
+	repo := NewDynamoDBDynamicUnitRepository(client, "units", nil, false).WithHistory(true)
+
+	unit := &models.DynamicUnit{ID: "unit-1", AccountID: "account-1", UnitType: "trailerType", Version: 2}
+	err := repo.Update(context.Background(), unit)
+
+	var conflict *VersionConflictError
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, int64(3), conflict.CurrentVersion)
+	assert.Equal(t, int64(2), unit.Version)
+	assert.Empty(t, client.transactInputs)
+}
+
+func TestDynamoDBDynamicUnitRepository_DeleteAndRestoreRecordHistory(t *testing.T) {
+	stored := storedTrailer(t)
+	client := &fakeDynamoDB{
+		getItem: func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{Item: stored}, nil
+		},
+	}
+	repo := NewDynamoDBDynamicUnitRepository(client, "units", nil, false).WithHistory(true)
+
+	require.NoError(t, repo.Delete(context.Background(), "account-1", "unit-1", "trailerType", 3))
+
+	require.Len(t, client.transactInputs, 1)
+	require.NotNil(t, client.transactInputs[0].TransactItems[0].Update)
+	entry := historyEntry(t, client.transactInputs[0].TransactItems[1])
+	assert.Equal(t, models.HistoryDelete, entry.Action)
+	assert.Equal(t, int64(4), entry.Version)
+	assert.Contains(t, entry.Changes, "deletedAt")
+
+	// Deleting again fails as the conditional update would, without writing
+	stored["deletedAt"] = &types.AttributeValueMemberN{Value: "1700000000"}
+	stored["version"] = &types.AttributeValueMemberN{Value: "4"}
+	err := repo.Delete(context.Background(), "account-1", "unit-1", "trailerType", 4)
+	assert.ErrorIs(t, err, ErrUnitAlreadyDeleted)
+	require.Len(t, client.transactInputs, 1)
+
+	unit, err := repo.Restore(context.Background(), "account-1", "unit-1", "trailerType", 4)
+	require.NoError(t, err)
+	assert.False(t, unit.IsDeleted())
+	assert.Equal(t, int64(5), unit.Version)
+
+	require.Len(t, client.transactInputs, 2)
+	entry = historyEntry(t, client.transactInputs[1].TransactItems[1])
+	assert.Equal(t, models.HistoryRestore, entry.Action)
+	assert.Equal(t, int64(5), entry.Version)
+	assert.JSONEq(t, `1700000000`, string(entry.Changes["deletedAt"].From))
+	assert.JSONEq(t, `0`, string(entry.Changes["deletedAt"].To))
+}
+
+func TestDynamoDBDynamicUnitRepository_GetAsOf(t *testing.T) {
+	item := func(action models.HistoryAction, version int64, timestamp string, changes models.FieldChanges) map[string]types.AttributeValue {
+		return mustMarshalItem(t, map[string]interface{}{
+			"pk": "account-1", "sk": "unit-1#trailerType#HIST#" + timestamp, "unitId": "unit-1", "unitType": "trailerType",
+			"action": action, "version": version, "timestamp": timestamp, "changes": changes,
+		})
+	}
+	var input *dynamodb.QueryInput
+	client := &fakeDynamoDB{
+		query: func(params *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+			input = params
+			return &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{
+				item(models.HistoryCreate, 1, "2026-01-01T00:00:00.000000000Z", models.FieldChanges{
+					"id":       {From: json.RawMessage(`null`), To: json.RawMessage(`"unit-1"`)},
+					"unitType": {From: json.RawMessage(`null`), To: json.RawMessage(`"trailerType"`)},
+					"paint":    {From: json.RawMessage(`null`), To: json.RawMessage(`"red"`)},
+				}),
+				item(models.HistoryUpdate, 2, "2026-02-01T00:00:00.000000000Z", models.FieldChanges{
+					"paint": {From: json.RawMessage(`"red"`), To: json.RawMessage(`"blue"`)},
+				}),
+			}}, nil
+		},
+	}
+	repo := NewDynamoDBDynamicUnitRepository(client, "units", nil, false)
+
+	unit, err := repo.GetAsOf(context.Background(), "account-1", "unit-1", "trailerType", time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+
+	require.NotNil(t, input)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "unit-1#trailerType#HIST#"}, input.ExpressionAttributeValues[":historyPrefix"])
+	require.NotNil(t, unit)
+	assert.Equal(t, "unit-1", unit.ID)
+	assert.Equal(t, "account-1", unit.AccountID)
+	assert.Equal(t, "trailerType", unit.UnitType)
+	assert.Equal(t, "blue", unit.Data["paint"])
+	assert.Equal(t, int64(2), unit.Version)
+}
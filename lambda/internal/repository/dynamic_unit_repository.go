@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+// DynamicUnitRepository defines the interface for schema-driven unit data operations
+type DynamicUnitRepository interface {
+	// Create creates a new dynamic unit in the repository
+	Create(ctx context.Context, unit *models.DynamicUnit) error
+
+	// GetByKey retrieves a dynamic unit by its composite primary key (accountID + unitType + unitID)
+	GetByKey(ctx context.Context, accountID, unitID, unitType string) (*models.DynamicUnit, error)
+
+	// Update updates an existing dynamic unit in the repository
+	Update(ctx context.Context, unit *models.DynamicUnit) error
+
+	// Delete soft deletes a dynamic unit (marks deletedAt timestamp) if it is still at expectedVersion
+	Delete(ctx context.Context, accountID, unitID, unitType string, expectedVersion int64) error
+
+	// Restore undeletes a soft deleted dynamic unit at expectedVersion and returns the restored unit
+	Restore(ctx context.Context, accountID, unitID, unitType string, expectedVersion int64) (*models.DynamicUnit, error)
+
+	// Purge permanently removes a soft deleted dynamic unit
+	Purge(ctx context.Context, accountID, unitID, unitType string) error
+
+	// List retrieves a paginated list of dynamic units for an account
+	List(ctx context.Context, input *appsync.ListUnitsInput) (*appsync.ListDynamicUnitsResponse, error)
+
+	// ListDeleted retrieves a paginated list of the soft deleted dynamic units for an account
+	ListDeleted(ctx context.Context, input *appsync.ListUnitsInput) (*appsync.ListDynamicUnitsResponse, error)
+
+	// GetHistory retrieves a paginated list of the recorded changes to a dynamic unit, newest first
+	GetHistory(ctx context.Context, input *appsync.GetUnitHistoryInput) (*appsync.UnitHistoryResponse, error)
+
+	// GetAsOf rebuilds a dynamic unit as it was at a point in time from its history
+	GetAsOf(ctx context.Context, accountID, unitID, unitType string, asOf time.Time) (*models.DynamicUnit, error)
+
+	// Export writes every live unit of one unit type in an account to w in the requested format
+	Export(ctx context.Context, opts ExportOptions, w io.Writer) (*ExportResult, error)
+}
@@ -0,0 +1,566 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+// DynamoDBDynamicUnitRepository implements DynamicUnitRepository using DynamoDB.
+// Items are stored as flat maps produced by DynamicUnit.ToMap so that every
+// schema property becomes a top-level attribute.
+type DynamoDBDynamicUnitRepository struct {
+	client    DynamoDBAPI
+	tableName string
+
+	// migrator lazily upgrades items stored under older schema versions on read;
+	// when writeBack is set the upgraded item is also persisted
+	migrator  *models.SchemaMigrator
+	writeBack bool
+
+	// deletedRetention is how long soft deleted units are kept before their TTL expires
+	deletedRetention time.Duration
+
+	// history records every write in a history item, in the same transaction
+	history bool
+
+	// tokens signs and verifies pagination tokens
+	tokens *PaginationTokenSigner
+}
+
+// NewDynamoDBDynamicUnitRepository creates a new DynamoDB dynamic unit repository.
+// A nil migrator disables schema migration on read. Pagination tokens are signed
+// with a per-process key until WithPaginationTokenSigner sets a shared one.
+func NewDynamoDBDynamicUnitRepository(client DynamoDBAPI, tableName string, migrator *models.SchemaMigrator, writeBack bool) *DynamoDBDynamicUnitRepository {
+	return &DynamoDBDynamicUnitRepository{
+		client:    client,
+		tableName: tableName,
+		migrator:  migrator,
+		writeBack: writeBack,
+		tokens:    NewPaginationTokenSigner(nil, 0),
+	}
+}
+
+// WithDeletedRetention sets how long soft deleted units are kept before DynamoDB
+// expires them. Zero, the default, keeps deleted units until they are purged.
+func (r *DynamoDBDynamicUnitRepository) WithDeletedRetention(retention time.Duration) *DynamoDBDynamicUnitRepository {
+	r.deletedRetention = retention
+	return r
+}
+
+// WithHistory turns recording of unit history on or off. When on, every create,
+// update, delete and restore also writes an immutable history item, in the same
+// transaction.
+func (r *DynamoDBDynamicUnitRepository) WithHistory(enabled bool) *DynamoDBDynamicUnitRepository {
+	r.history = enabled
+	return r
+}
+
+// WithPaginationTokenSigner sets the signer used to issue and verify nextToken values
+func (r *DynamoDBDynamicUnitRepository) WithPaginationTokenSigner(signer *PaginationTokenSigner) *DynamoDBDynamicUnitRepository {
+	r.tokens = signer
+	return r
+}
+
+// Create creates a new dynamic unit in DynamoDB
+func (r *DynamoDBDynamicUnitRepository) Create(ctx context.Context, unit *models.DynamicUnit) error {
+	if unit == nil {
+		return errors.New("unit cannot be nil")
+	}
+
+	// Validate required fields
+	if unit.AccountID == "" {
+		return errors.New("accountID is required")
+	}
+	if unit.UnitType == "" {
+		return errors.New("unitType is required")
+	}
+
+	// Generate UUID if not already set
+	if unit.ID == "" {
+		unit.GenerateID()
+	}
+
+	// Set timestamps and initial version
+	unit.SetTimestamps()
+	unit.Version = 1
+
+	item, err := marshalDynamicUnit(unit)
+	if err != nil {
+		return err
+	}
+
+	// Create the item with condition that it doesn't already exist
+	input := &dynamodb.PutItemInput{
+		TableName:           aws.String(r.tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(pk) AND attribute_not_exists(sk)"),
+	}
+
+	if r.history {
+		err = r.recordedWrite(ctx, models.HistoryCreate, types.TransactWriteItem{Put: transactPut(input)}, nil, unit)
+	} else {
+		_, err = r.client.PutItem(ctx, input)
+	}
+	if err != nil {
+		var conditionalCheckFailedException *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailedException) {
+			return fmt.Errorf("unit with id %s and type %s already exists for account %s", unit.ID, unit.UnitType, unit.AccountID)
+		}
+		return fmt.Errorf("failed to create unit: %w", err)
+	}
+
+	return nil
+}
+
+// GetByKey retrieves a dynamic unit by its composite primary key
+func (r *DynamoDBDynamicUnitRepository) GetByKey(ctx context.Context, accountID, unitID, unitType string) (*models.DynamicUnit, error) {
+	if accountID == "" {
+		return nil, errors.New("accountID is required")
+	}
+	if unitID == "" {
+		return nil, errors.New("unitID is required")
+	}
+	if unitType == "" {
+		return nil, errors.New("unitType is required")
+	}
+
+	keyUnit := &models.DynamicUnit{AccountID: accountID, ID: unitID, UnitType: unitType}
+
+	input := &dynamodb.GetItemInput{
+		TableName: aws.String(r.tableName),
+		Key:       keyUnit.GetKey(),
+	}
+
+	result, err := r.client.GetItem(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unit: %w", err)
+	}
+
+	if result.Item == nil {
+		return nil, nil // Unit not found
+	}
+
+	unit, err := unmarshalDynamicUnit(result.Item)
+	if err != nil {
+		return nil, err
+	}
+
+	// Don't return soft deleted units
+	if unit.IsDeleted() {
+		return nil, nil
+	}
+
+	if err := r.upgrade(ctx, unit); err != nil {
+		return nil, err
+	}
+
+	return unit, nil
+}
+
+// Update replaces an existing dynamic unit in DynamoDB. unit.Version must hold the
+// version the caller read; the write succeeds only if the stored unit is live and still
+// at that version, and unit.Version is advanced on success. It returns ErrUnitNotFound
+// when there is no live unit to update and a VersionConflictError when the unit changed.
+func (r *DynamoDBDynamicUnitRepository) Update(ctx context.Context, unit *models.DynamicUnit) error {
+	if unit == nil {
+		return errors.New("unit cannot be nil")
+	}
+
+	// Validate required fields
+	if unit.AccountID == "" {
+		return errors.New("accountID is required")
+	}
+	if unit.ID == "" {
+		return errors.New("unit ID is required")
+	}
+	if unit.UnitType == "" {
+		return errors.New("unitType is required")
+	}
+
+	// Update timestamp and version
+	unit.SetTimestamps()
+	expectedVersion := unit.Version
+	unit.Version = expectedVersion + 1
+
+	item, err := marshalDynamicUnit(unit)
+	if err != nil {
+		unit.Version = expectedVersion
+		return err
+	}
+
+	// Update the item with condition that it exists, is not deleted and is unchanged
+	names := map[string]string{}
+	values := map[string]types.AttributeValue{
+		":zero": &types.AttributeValueMemberN{Value: "0"},
+	}
+	condition := "attribute_exists(pk) AND attribute_exists(sk) AND (attribute_not_exists(deletedAt) OR deletedAt = :zero) AND " +
+		versionCondition(expectedVersion, names, values)
+
+	input := &dynamodb.PutItemInput{
+		TableName:                           aws.String(r.tableName),
+		Item:                                item,
+		ConditionExpression:                 aws.String(condition),
+		ExpressionAttributeNames:            names,
+		ExpressionAttributeValues:           values,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}
+
+	if r.history {
+		// Recording the replacement needs the stored unit. A unit that is missing,
+		// deleted or at another version fails as the conditional put would, without writing.
+		var stored map[string]types.AttributeValue
+		var before *models.DynamicUnit
+		stored, before, err = r.storedUnit(ctx, unit.GetKey())
+		switch {
+		case err != nil:
+		case isDynamicLiveAt(before, expectedVersion):
+			err = r.recordedWrite(ctx, models.HistoryUpdate, types.TransactWriteItem{Put: transactPut(input)}, before, unit)
+		default:
+			err = &types.ConditionalCheckFailedException{Item: stored}
+		}
+	} else {
+		_, err = r.client.PutItem(ctx, input)
+	}
+	if err != nil {
+		unit.Version = expectedVersion
+		var conditionalCheckFailedException *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailedException) {
+			return conditionFailure(conditionalCheckFailedException.Item, expectedVersion, unit.AccountID, unit.ID, unit.UnitType)
+		}
+		return fmt.Errorf("failed to update unit: %w", err)
+	}
+
+	return nil
+}
+
+// Delete soft deletes a dynamic unit with a single conditional UpdateItem that sets
+// deletedAt and, when a retention period is configured, the expiresAt TTL. It returns
+// ErrUnitNotFound or ErrUnitAlreadyDeleted when there is no live unit to delete, and a
+// VersionConflictError if the stored version is not expectedVersion.
+func (r *DynamoDBDynamicUnitRepository) Delete(ctx context.Context, accountID, unitID, unitType string, expectedVersion int64) error {
+	if accountID == "" {
+		return errors.New("accountID is required")
+	}
+	if unitID == "" {
+		return errors.New("unitID is required")
+	}
+	if unitType == "" {
+		return errors.New("unitType is required")
+	}
+
+	keyUnit := &models.DynamicUnit{AccountID: accountID, ID: unitID, UnitType: unitType}
+	keyUnit.MarkDeleted(r.deletedRetention)
+
+	names := map[string]string{}
+	values := map[string]types.AttributeValue{
+		":now":        &types.AttributeValueMemberN{Value: strconv.FormatInt(keyUnit.DeletedAt, 10)},
+		":newVersion": &types.AttributeValueMemberN{Value: strconv.FormatInt(expectedVersion+1, 10)},
+		":zero":       &types.AttributeValueMemberN{Value: "0"},
+	}
+	condition := "attribute_exists(pk) AND attribute_exists(sk) AND (attribute_not_exists(deletedAt) OR deletedAt = :zero) AND " +
+		versionCondition(expectedVersion, names, values)
+
+	updateExpression := "SET deletedAt = :now, updatedAt = :now, #version = :newVersion"
+	if keyUnit.ExpiresAt > 0 {
+		updateExpression += ", expiresAt = :expiresAt"
+		values[":expiresAt"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(keyUnit.ExpiresAt, 10)}
+	}
+
+	// Mark as deleted in place; the condition guards against deleting missing, already
+	// deleted or concurrently modified units
+	input := &dynamodb.UpdateItemInput{
+		TableName:                           aws.String(r.tableName),
+		Key:                                 keyUnit.GetKey(),
+		UpdateExpression:                    aws.String(updateExpression),
+		ConditionExpression:                 aws.String(condition),
+		ExpressionAttributeNames:            names,
+		ExpressionAttributeValues:           values,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}
+
+	var err error
+	if r.history {
+		err = r.deleteRecorded(ctx, input, expectedVersion)
+	} else {
+		_, err = r.client.UpdateItem(ctx, input)
+	}
+	if err != nil {
+		var conditionalCheckFailedException *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailedException) {
+			return deleteConditionFailure(conditionalCheckFailedException.Item, expectedVersion, accountID, unitID, unitType)
+		}
+		return fmt.Errorf("failed to delete unit: %w", err)
+	}
+
+	return nil
+}
+
+// Restore undeletes a soft deleted dynamic unit by clearing deletedAt and the expiresAt
+// TTL, and returns the restored unit. It returns ErrUnitNotFound or ErrUnitNotDeleted
+// when there is no deleted unit to restore, and a VersionConflictError if the stored
+// version is not expectedVersion.
+func (r *DynamoDBDynamicUnitRepository) Restore(ctx context.Context, accountID, unitID, unitType string, expectedVersion int64) (*models.DynamicUnit, error) {
+	if accountID == "" {
+		return nil, errors.New("accountID is required")
+	}
+	if unitID == "" {
+		return nil, errors.New("unitID is required")
+	}
+	if unitType == "" {
+		return nil, errors.New("unitType is required")
+	}
+
+	keyUnit := &models.DynamicUnit{AccountID: accountID, ID: unitID, UnitType: unitType}
+
+	names := map[string]string{}
+	values := map[string]types.AttributeValue{
+		":now":        &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+		":newVersion": &types.AttributeValueMemberN{Value: strconv.FormatInt(expectedVersion+1, 10)},
+		":zero":       &types.AttributeValueMemberN{Value: "0"},
+	}
+	condition := "attribute_exists(pk) AND attribute_exists(sk) AND deletedAt > :zero AND " +
+		versionCondition(expectedVersion, names, values)
+
+	// Clear the deletion marker in place; the condition only matches deleted units
+	input := &dynamodb.UpdateItemInput{
+		TableName:                           aws.String(r.tableName),
+		Key:                                 keyUnit.GetKey(),
+		UpdateExpression:                    aws.String("SET deletedAt = :zero, updatedAt = :now, #version = :newVersion REMOVE expiresAt"),
+		ConditionExpression:                 aws.String(condition),
+		ExpressionAttributeNames:            names,
+		ExpressionAttributeValues:           values,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}
+
+	var unit *models.DynamicUnit
+	var err error
+	if r.history {
+		unit, err = r.restoreRecorded(ctx, input, expectedVersion)
+	} else {
+		input.ReturnValues = types.ReturnValueAllNew
+		var output *dynamodb.UpdateItemOutput
+		if output, err = r.client.UpdateItem(ctx, input); err == nil {
+			unit, err = unmarshalDynamicUnit(output.Attributes)
+		}
+	}
+	if err != nil {
+		var conditionalCheckFailedException *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailedException) {
+			return nil, restoreConditionFailure(conditionalCheckFailedException.Item, expectedVersion, accountID, unitID, unitType)
+		}
+		return nil, fmt.Errorf("failed to restore unit: %w", err)
+	}
+
+	if err := r.upgrade(ctx, unit); err != nil {
+		return nil, err
+	}
+
+	return unit, nil
+}
+
+// Purge permanently removes a soft deleted dynamic unit. It returns ErrUnitNotFound when
+// the unit does not exist and ErrUnitNotDeleted when it has not been soft deleted.
+func (r *DynamoDBDynamicUnitRepository) Purge(ctx context.Context, accountID, unitID, unitType string) error {
+	if accountID == "" {
+		return errors.New("accountID is required")
+	}
+	if unitID == "" {
+		return errors.New("unitID is required")
+	}
+	if unitType == "" {
+		return errors.New("unitType is required")
+	}
+
+	keyUnit := &models.DynamicUnit{AccountID: accountID, ID: unitID, UnitType: unitType}
+	return purgeDeletedItem(ctx, r.client, r.tableName, keyUnit.GetKey(), accountID, unitID, unitType)
+}
+
+// List retrieves a paginated list of dynamic units, optionally restricted to a single unit type
+func (r *DynamoDBDynamicUnitRepository) List(ctx context.Context, input *appsync.ListUnitsInput) (*appsync.ListDynamicUnitsResponse, error) {
+	return r.list(ctx, input, "attribute_not_exists(deletedAt) OR deletedAt = :zero")
+}
+
+// ListDeleted retrieves a paginated list of soft deleted dynamic units, optionally restricted to a single unit type
+func (r *DynamoDBDynamicUnitRepository) ListDeleted(ctx context.Context, input *appsync.ListUnitsInput) (*appsync.ListDynamicUnitsResponse, error) {
+	return r.list(ctx, input, "deletedAt > :zero")
+}
+
+// list queries the dynamic units of an account that match deletedFilter, a condition
+// on deletedAt that may reference :zero
+func (r *DynamoDBDynamicUnitRepository) list(ctx context.Context, input *appsync.ListUnitsInput, deletedFilter string) (*appsync.ListDynamicUnitsResponse, error) {
+	if input == nil {
+		return nil, errors.New("input is required")
+	}
+	if input.AccountID == "" {
+		return nil, errors.New("accountID is required")
+	}
+
+	// Default limit
+	limit := int32(20)
+	if input.Limit != nil && *input.Limit > 0 && *input.Limit <= 100 {
+		limit = int32(*input.Limit)
+	}
+
+	keyCondition := "pk = :accountId"
+	expressionValues := map[string]types.AttributeValue{
+		":accountId": &types.AttributeValueMemberS{Value: input.AccountID},
+		":zero":      &types.AttributeValueMemberN{Value: "0"},
+	}
+
+	// Dynamic unit sort keys are prefixed with the unit type (unitType#id)
+	if input.UnitType != nil && *input.UnitType != "" {
+		keyCondition += " AND begins_with(sk, :unitTypePrefix)"
+		expressionValues[":unitTypePrefix"] = &types.AttributeValueMemberS{Value: *input.UnitType + "#"}
+	}
+
+	queryInput := &dynamodb.QueryInput{
+		TableName:                 aws.String(r.tableName),
+		KeyConditionExpression:    aws.String(keyCondition),
+		FilterExpression:          aws.String(withoutHistory(deletedFilter, expressionValues)),
+		ExpressionAttributeValues: expressionValues,
+		Limit:                     aws.Int32(limit),
+	}
+
+	if err := applyListFilter(queryInput, input.Filter); err != nil {
+		return nil, err
+	}
+
+	scope := listScope(input, deletedFilter)
+	if input.NextToken != nil && *input.NextToken != "" {
+		exclusiveStartKey, err := r.tokens.decode(*input.NextToken, scope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode pagination token: %w", err)
+		}
+		if exclusiveStartKey != nil {
+			queryInput.ExclusiveStartKey = exclusiveStartKey
+		}
+	}
+
+	result, err := r.client.Query(ctx, queryInput)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list units: %w", err)
+	}
+
+	// Initialize as empty slice to ensure it marshals to [] instead of null
+	units := make([]models.DynamicUnit, 0, len(result.Items))
+	for _, item := range result.Items {
+		unit, err := unmarshalDynamicUnit(item)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.upgrade(ctx, unit); err != nil {
+			return nil, err
+		}
+		units = append(units, *unit)
+	}
+
+	response := &appsync.ListDynamicUnitsResponse{
+		Items: units,
+		Count: len(units),
+	}
+
+	if result.LastEvaluatedKey != nil {
+		nextToken, err := r.tokens.encode(result.LastEvaluatedKey, scope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode pagination token: %w", err)
+		}
+		if nextToken != "" {
+			response.NextToken = &nextToken
+		}
+	}
+
+	return response, nil
+}
+
+// upgrade migrates a unit read from the table to the latest schema version and,
+// when write-back is enabled, persists the upgraded item
+func (r *DynamoDBDynamicUnitRepository) upgrade(ctx context.Context, unit *models.DynamicUnit) error {
+	if r.migrator == nil {
+		return nil
+	}
+
+	storedVersion := unit.SchemaVersion
+	migrated, err := r.migrator.Migrate(unit)
+	if err != nil {
+		return fmt.Errorf("failed to migrate unit %s: %w", unit.ID, err)
+	}
+	if !migrated || !r.writeBack {
+		return nil
+	}
+
+	// Write-back is best effort: a concurrent writer wins and the item is upgraded on a later read
+	if err := r.putMigrated(ctx, unit, storedVersion); err != nil {
+		log.Printf("Failed to write back migrated unit %s: %v", unit.ID, err)
+	}
+	return nil
+}
+
+// putMigrated writes a migrated unit, guarded on the stored schema version being unchanged
+func (r *DynamoDBDynamicUnitRepository) putMigrated(ctx context.Context, unit *models.DynamicUnit, storedVersion int) error {
+	item, err := marshalDynamicUnit(unit)
+	if err != nil {
+		return err
+	}
+
+	condition := "attribute_exists(pk) AND attribute_not_exists(schemaVersion)"
+	expressionValues := map[string]types.AttributeValue(nil)
+	if storedVersion > 0 {
+		condition = "attribute_exists(pk) AND schemaVersion = :storedVersion"
+		expressionValues = map[string]types.AttributeValue{
+			":storedVersion": &types.AttributeValueMemberN{Value: strconv.Itoa(storedVersion)},
+		}
+	}
+
+	_, err = r.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                 aws.String(r.tableName),
+		Item:                      item,
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeValues: expressionValues,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write migrated unit: %w", err)
+	}
+	return nil
+}
+
+// marshalDynamicUnit converts a dynamic unit into a DynamoDB item
+func marshalDynamicUnit(unit *models.DynamicUnit) (map[string]types.AttributeValue, error) {
+	unitMap, err := unit.ToMap()
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert unit to map: %w", err)
+	}
+
+	item, err := attributevalue.MarshalMap(unitMap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal unit: %w", err)
+	}
+
+	return item, nil
+}
+
+// unmarshalDynamicUnit converts a DynamoDB item into a dynamic unit
+func unmarshalDynamicUnit(item map[string]types.AttributeValue) (*models.DynamicUnit, error) {
+	var unitMap map[string]interface{}
+	if err := attributevalue.UnmarshalMap(item, &unitMap); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal unit: %w", err)
+	}
+
+	unit := &models.DynamicUnit{}
+	if err := unit.FromMap(unitMap); err != nil {
+		return nil, fmt.Errorf("failed to convert unit from map: %w", err)
+	}
+
+	return unit, nil
+}
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+)
+
+func TestDynamoDBDynamicUnitRepository_UpdateChecksVersion(t *testing.T) {
+	client := &fakeDynamoDB{
+		putItem: func(*dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+			return &dynamodb.PutItemOutput{}, nil
+		},
+	}
+	repo := NewDynamoDBDynamicUnitRepository(client, "units", nil, false)
+
+	unit := &models.DynamicUnit{ID: "unit-1", AccountID: "account-1", UnitType: "trailerType", Version: 2, Data: map[string]interface{}{"paint": "red"}}
+	require.NoError(t, repo.Update(context.Background(), unit))
+
+	assert.Equal(t, int64(3), unit.Version)
+	require.Len(t, client.putInputs, 1)
+	input := client.putInputs[0]
+	assert.Equal(t, "attribute_exists(pk) AND attribute_exists(sk) AND (attribute_not_exists(deletedAt) OR deletedAt = :zero) AND #version = :expectedVersion", *input.ConditionExpression)
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "2"}, input.ExpressionAttributeValues[":expectedVersion"])
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "3"}, input.Item["version"])
+	assert.Equal(t, types.ReturnValuesOnConditionCheckFailureAllOld, input.ReturnValuesOnConditionCheckFailure)
+}
+
+func TestDynamoDBDynamicUnitRepository_UpdateConditionFailures(t *testing.T) {
+	tests := []struct {
+		name      string
+		item      map[string]types.AttributeValue
+		wantErr   error
+		wantCheck func(t *testing.T, err error)
+	}{
+		{
+			name:    "missing unit",
+			item:    nil,
+			wantErr: ErrUnitNotFound,
+		},
+		{
+			name: "deleted unit",
+			item: map[string]types.AttributeValue{
+				"pk":        &types.AttributeValueMemberS{Value: "account-1"},
+				"deletedAt": &types.AttributeValueMemberN{Value: "1700000000"},
+				"version":   &types.AttributeValueMemberN{Value: "2"},
+			},
+			wantErr: ErrUnitNotFound,
+		},
+		{
+			// Schema-driven attributes need not fit models.Unit; doors is a string there
+			name: "concurrent update",
+			item: map[string]types.AttributeValue{
+				"pk":        &types.AttributeValueMemberS{Value: "account-1"},
+				"deletedAt": &types.AttributeValueMemberN{Value: "0"},
+				"version":   &types.AttributeValueMemberN{Value: "3"},
+				"doors":     &types.AttributeValueMemberN{Value: "4"},
+			},
+			wantCheck: func(t *testing.T, err error) {
+				var conflict *VersionConflictError
+				require.ErrorAs(t, err, &conflict)
+				assert.Equal(t, int64(2), conflict.ExpectedVersion)
+				assert.Equal(t, int64(3), conflict.CurrentVersion)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeDynamoDB{
+				putItem: func(*dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+					return nil, &types.ConditionalCheckFailedException{Item: tt.item}
+				},
+			}
+			repo := NewDynamoDBDynamicUnitRepository(client, "units", nil, false)
+
+			unit := &models.DynamicUnit{ID: "unit-1", AccountID: "account-1", UnitType: "trailerType", Version: 2}
+			err := repo.Update(context.Background(), unit)
+			require.Error(t, err)
+			assert.Equal(t, int64(2), unit.Version, "a failed update must leave the caller's version unchanged")
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+			if tt.wantCheck != nil {
+				tt.wantCheck(t, err)
+			}
+		})
+	}
+}
+
+func TestDynamoDBDynamicUnitRepository_Delete(t *testing.T) {
+	var captured *dynamodb.UpdateItemInput
+	client := &fakeDynamoDB{
+		updateItem: func(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+			captured = input
+			return &dynamodb.UpdateItemOutput{}, nil
+		},
+	}
+	repo := NewDynamoDBDynamicUnitRepository(client, "units", nil, false)
+
+	require.NoError(t, repo.Delete(context.Background(), "account-1", "unit-1", "trailerType", 2))
+
+	require.NotNil(t, captured)
+	assert.Equal(t, "SET deletedAt = :now, updatedAt = :now, #version = :newVersion", *captured.UpdateExpression)
+	assert.Equal(t, "attribute_exists(pk) AND attribute_exists(sk) AND (attribute_not_exists(deletedAt) OR deletedAt = :zero) AND #version = :expectedVersion", *captured.ConditionExpression)
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "3"}, captured.ExpressionAttributeValues[":newVersion"])
+	assert.Equal(t, types.ReturnValuesOnConditionCheckFailureAllOld, captured.ReturnValuesOnConditionCheckFailure)
+}
+
+func TestDynamoDBDynamicUnitRepository_DeleteConditionFailures(t *testing.T) {
+	tests := []struct {
+		name      string
+		item      map[string]types.AttributeValue
+		wantErr   error
+		wantCheck func(t *testing.T, err error)
+	}{
+		{
+			name:    "missing unit",
+			item:    nil,
+			wantErr: ErrUnitNotFound,
+		},
+		{
+			name: "already deleted",
+			item: map[string]types.AttributeValue{
+				"pk":        &types.AttributeValueMemberS{Value: "account-1"},
+				"deletedAt": &types.AttributeValueMemberN{Value: "1700000000"},
+				"version":   &types.AttributeValueMemberN{Value: "3"},
+			},
+			wantErr: ErrUnitAlreadyDeleted,
+		},
+		{
+			name: "concurrent update",
+			item: map[string]types.AttributeValue{
+				"pk":        &types.AttributeValueMemberS{Value: "account-1"},
+				"deletedAt": &types.AttributeValueMemberN{Value: "0"},
+				"version":   &types.AttributeValueMemberN{Value: "3"},
+			},
+			wantCheck: func(t *testing.T, err error) {
+				var conflict *VersionConflictError
+				require.ErrorAs(t, err, &conflict)
+				assert.Equal(t, int64(3), conflict.CurrentVersion)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeDynamoDB{
+				updateItem: func(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+					return nil, &types.ConditionalCheckFailedException{Item: tt.item}
+				},
+			}
+			repo := NewDynamoDBDynamicUnitRepository(client, "units", nil, false)
+
+			err := repo.Delete(context.Background(), "account-1", "unit-1", "trailerType", 2)
+			require.Error(t, err)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+			if tt.wantCheck != nil {
+				tt.wantCheck(t, err)
+			}
+		})
+	}
+}
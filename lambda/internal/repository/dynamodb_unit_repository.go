@@ -2,114 +2,135 @@ package repository
 
 import (
 	"context"
-	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 
+	"github.com/steverhoton/unt-units-svc/internal/filter"
 	"github.com/steverhoton/unt-units-svc/internal/models"
 	"github.com/steverhoton/unt-units-svc/pkg/appsync"
 )
 
 // DynamoDBUnitRepository implements UnitRepository using DynamoDB
 type DynamoDBUnitRepository struct {
-	client    *dynamodb.Client
+	client    DynamoDBAPI
 	tableName string
+
+	// deletedRetention is how long soft deleted units are kept before their TTL expires
+	deletedRetention time.Duration
+
+	// tokens signs and verifies pagination tokens
+	tokens *PaginationTokenSigner
+
+	// history records every write to a unit in a history item written with it
+	history bool
+
+	// outbox records every write to a unit as a domain event in an outbox item written with it
+	outbox bool
 }
 
-// NewDynamoDBUnitRepository creates a new DynamoDB unit repository
-func NewDynamoDBUnitRepository(client *dynamodb.Client, tableName string) *DynamoDBUnitRepository {
+// NewDynamoDBUnitRepository creates a new DynamoDB unit repository. Pagination tokens
+// are signed with a per-process key until WithPaginationTokenSigner sets a shared one.
+func NewDynamoDBUnitRepository(client DynamoDBAPI, tableName string) *DynamoDBUnitRepository {
 	return &DynamoDBUnitRepository{
 		client:    client,
 		tableName: tableName,
+		tokens:    NewPaginationTokenSigner(nil, 0),
 	}
 }
 
-// encodePaginationToken encodes the LastEvaluatedKey into a base64 token
-func (r *DynamoDBUnitRepository) encodePaginationToken(lastKey map[string]types.AttributeValue) (string, error) {
-	if lastKey == nil {
-		return "", nil
-	}
+// WithDeletedRetention sets how long soft deleted units are kept before DynamoDB
+// expires them. Zero, the default, keeps deleted units until they are purged.
+func (r *DynamoDBUnitRepository) WithDeletedRetention(retention time.Duration) *DynamoDBUnitRepository {
+	r.deletedRetention = retention
+	return r
+}
 
-	// Convert the LastEvaluatedKey to a simple map[string]interface{}
-	tokenData := make(map[string]interface{})
-	for key, value := range lastKey {
-		switch v := value.(type) {
-		case *types.AttributeValueMemberS:
-			tokenData[key] = v.Value
-		case *types.AttributeValueMemberN:
-			tokenData[key] = v.Value
-		default:
-			// For other types, convert to string representation
-			tokenData[key] = fmt.Sprintf("%v", value)
-		}
-	}
+// WithHistory turns recording of unit history on or off. When on, every create,
+// update, delete and restore also writes an item with the changed fields and the
+// caller from the context, in the same transaction.
+func (r *DynamoDBUnitRepository) WithHistory(enabled bool) *DynamoDBUnitRepository {
+	r.history = enabled
+	return r
+}
 
-	// Marshal to JSON
-	jsonBytes, err := json.Marshal(tokenData)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal token data: %w", err)
-	}
+// WithOutbox turns the event outbox on or off. When on, every create, update,
+// delete and restore also writes its domain event to an outbox item in the same
+// transaction, for the OutboxRelay to publish.
+func (r *DynamoDBUnitRepository) WithOutbox(enabled bool) *DynamoDBUnitRepository {
+	r.outbox = enabled
+	return r
+}
 
-	// Encode to base64
-	return base64.StdEncoding.EncodeToString(jsonBytes), nil
+// recording reports whether writes are recorded in history or outbox items, which
+// are written with the unit in one transaction
+func (r *DynamoDBUnitRepository) recording() bool {
+	return r.history || r.outbox
 }
 
-// decodePaginationToken decodes a base64 token back to LastEvaluatedKey format
-func (r *DynamoDBUnitRepository) decodePaginationToken(token string) (map[string]types.AttributeValue, error) {
-	if token == "" {
-		return nil, nil
+// WithPaginationTokenSigner sets the signer used to issue and verify nextToken values
+func (r *DynamoDBUnitRepository) WithPaginationTokenSigner(signer *PaginationTokenSigner) *DynamoDBUnitRepository {
+	r.tokens = signer
+	return r
+}
+
+// encodePaginationToken encodes the LastEvaluatedKey into a signed token bound to scope
+func (r *DynamoDBUnitRepository) encodePaginationToken(lastKey map[string]types.AttributeValue, scope paginationScope) (string, error) {
+	return r.tokens.encode(lastKey, scope)
+}
+
+// decodePaginationToken verifies a signed token against scope and returns its LastEvaluatedKey.
+// Tampered, expired or foreign tokens fail with ErrInvalidPaginationToken.
+func (r *DynamoDBUnitRepository) decodePaginationToken(token string, scope paginationScope) (map[string]types.AttributeValue, error) {
+	return r.tokens.decode(token, scope)
+}
+
+// applyListFilter narrows a list query with the client supplied filter, if any.
+// The compiled filter is ANDed with the query's existing filter expression.
+func applyListFilter(queryInput *dynamodb.QueryInput, rawFilter *string) error {
+	if rawFilter == nil || *rawFilter == "" {
+		return nil
 	}
 
-	// Decode from base64
-	jsonBytes, err := base64.StdEncoding.DecodeString(token)
+	expr, err := filter.ParseAndCompile(*rawFilter)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode token: %w", err)
+		return fmt.Errorf("invalid filter: %w", err)
 	}
 
-	// Unmarshal from JSON
-	var tokenData map[string]interface{}
-	err = json.Unmarshal(jsonBytes, &tokenData)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal token data: %w", err)
-	}
-
-	// Convert back to DynamoDB AttributeValue format
-	lastKey := make(map[string]types.AttributeValue)
-	for key, value := range tokenData {
-		switch v := value.(type) {
-		case string:
-			// Try to determine if it's a number or string
-			if key == "pk" || key == "sk" {
-				// These are typically strings
-				lastKey[key] = &types.AttributeValueMemberS{Value: v}
-			} else {
-				// For other fields, try to parse as number first
-				if _, err := strconv.ParseFloat(v, 64); err == nil {
-					lastKey[key] = &types.AttributeValueMemberN{Value: v}
-				} else {
-					lastKey[key] = &types.AttributeValueMemberS{Value: v}
-				}
-			}
-		case float64:
-			// JSON numbers become float64
-			lastKey[key] = &types.AttributeValueMemberN{Value: fmt.Sprintf("%.0f", v)}
-		default:
-			// Fallback to string representation
-			lastKey[key] = &types.AttributeValueMemberS{Value: fmt.Sprintf("%v", v)}
+	condition := expr.Condition
+	if queryInput.FilterExpression != nil && *queryInput.FilterExpression != "" {
+		condition = fmt.Sprintf("(%s) AND %s", *queryInput.FilterExpression, expr.Condition)
+	}
+	queryInput.FilterExpression = aws.String(condition)
+
+	if len(expr.Names) > 0 {
+		if queryInput.ExpressionAttributeNames == nil {
+			queryInput.ExpressionAttributeNames = make(map[string]string, len(expr.Names))
+		}
+		for placeholder, name := range expr.Names {
+			queryInput.ExpressionAttributeNames[placeholder] = name
 		}
 	}
+	if queryInput.ExpressionAttributeValues == nil {
+		queryInput.ExpressionAttributeValues = make(map[string]types.AttributeValue, len(expr.Values))
+	}
+	for placeholder, value := range expr.Values {
+		queryInput.ExpressionAttributeValues[placeholder] = value
+	}
 
-	return lastKey, nil
+	return nil
 }
 
-// Create creates a new unit in DynamoDB
+// Create creates a new unit in DynamoDB. A unit with a VIN fails with a
+// DuplicateVinError when another unit in the account already uses it.
 func (r *DynamoDBUnitRepository) Create(ctx context.Context, unit *models.Unit) error {
 	if unit == nil {
 		return errors.New("unit cannot be nil")
@@ -131,8 +152,13 @@ func (r *DynamoDBUnitRepository) Create(ctx context.Context, unit *models.Unit)
 	// Set timestamps
 	unit.SetTimestamps()
 
-	// Set the computed SK field for DynamoDB
+	// New units start live at version 1
+	unit.Version = 1
+	unit.ClearDeletion()
+
+	// Set the computed SK and indexed VIN fields for DynamoDB
 	unit.SortKey = unit.GetSortKey()
+	unit.SetVin()
 
 	// Marshal the unit to DynamoDB attribute map
 	item, err := attributevalue.MarshalMap(unit)
@@ -140,6 +166,23 @@ func (r *DynamoDBUnitRepository) Create(ctx context.Context, unit *models.Unit)
 		return fmt.Errorf("failed to marshal unit: %w", err)
 	}
 
+	return r.createItem(ctx, unit, item)
+}
+
+// createItem writes the item of a new unit prepared by Create or BatchCreate, with
+// the reservation of its VIN and the items recording it in the same transaction
+func (r *DynamoDBUnitRepository) createItem(ctx context.Context, unit *models.Unit, item map[string]types.AttributeValue) error {
+	// The history and outbox items are written in the same transaction as the unit
+	records, err := r.recordItems(ctx, models.HistoryCreate, nil, unit)
+	if err != nil {
+		return err
+	}
+
+	// Units with a VIN reserve it for the account in the same write
+	if unit.Vin != "" {
+		return r.createWithVinGuard(ctx, unit, item, records...)
+	}
+
 	// Create the item with condition that it doesn't already exist
 	input := &dynamodb.PutItemInput{
 		TableName:           aws.String(r.tableName),
@@ -147,7 +190,11 @@ func (r *DynamoDBUnitRepository) Create(ctx context.Context, unit *models.Unit)
 		ConditionExpression: aws.String("attribute_not_exists(pk) AND attribute_not_exists(sk)"),
 	}
 
-	_, err = r.client.PutItem(ctx, input)
+	if r.recording() {
+		err = r.putRecorded(ctx, input, records)
+	} else {
+		_, err = r.client.PutItem(ctx, input)
+	}
 	if err != nil {
 		var conditionalCheckFailedException *types.ConditionalCheckFailedException
 		if errors.As(err, &conditionalCheckFailedException) {
@@ -207,7 +254,10 @@ func (r *DynamoDBUnitRepository) GetByKey(ctx context.Context, accountID, unitID
 	return &unit, nil
 }
 
-// Update updates an existing unit in DynamoDB
+// Update replaces an existing unit in DynamoDB. unit.Version must hold the version
+// the caller read; the write fails with a VersionConflictError if it has changed.
+// A new VIN is reserved for the account, and the old one released, in the same
+// transaction; a VIN another unit uses fails with a DuplicateVinError.
 func (r *DynamoDBUnitRepository) Update(ctx context.Context, unit *models.Unit) error {
 	if unit == nil {
 		return errors.New("unit cannot be nil")
@@ -224,33 +274,57 @@ func (r *DynamoDBUnitRepository) Update(ctx context.Context, unit *models.Unit)
 		return errors.New("unitType is required")
 	}
 
-	// Update timestamp
+	// Update timestamp and version
 	unit.SetTimestamps()
+	expectedVersion := unit.Version
+	unit.Version = expectedVersion + 1
 
-	// Set the computed SK field for DynamoDB
+	// Set the computed SK and indexed VIN fields for DynamoDB
 	unit.SortKey = unit.GetSortKey()
+	unit.SetVin()
 
 	// Marshal the unit to DynamoDB attribute map
 	item, err := attributevalue.MarshalMap(unit)
 	if err != nil {
+		unit.Version = expectedVersion
 		return fmt.Errorf("failed to marshal unit: %w", err)
 	}
 
-	// Update the item with condition that it exists and is not deleted
-	input := &dynamodb.PutItemInput{
-		TableName:           aws.String(r.tableName),
-		Item:                item,
-		ConditionExpression: aws.String("attribute_exists(pk) AND attribute_exists(sk) AND (attribute_not_exists(deletedAt) OR deletedAt = :zero)"),
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":zero": &types.AttributeValueMemberN{Value: "0"},
-		},
+	// Update the item with condition that it exists, is not deleted and is unchanged
+	names := map[string]string{}
+	values := map[string]types.AttributeValue{
+		":zero": &types.AttributeValueMemberN{Value: "0"},
 	}
+	condition := "attribute_exists(pk) AND attribute_exists(sk) AND (attribute_not_exists(deletedAt) OR deletedAt = :zero) AND " +
+		versionCondition(expectedVersion, names, values)
 
-	_, err = r.client.PutItem(ctx, input)
+	input := &dynamodb.PutItemInput{
+		TableName:                           aws.String(r.tableName),
+		Item:                                item,
+		ConditionExpression:                 aws.String(condition),
+		ExpressionAttributeNames:            names,
+		ExpressionAttributeValues:           values,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}
+
+	// Recording the replacement, or moving the reservation of a VIN it changes,
+	// needs the stored unit. A unit that is missing, deleted or at another version
+	// fails as the conditional put would, without writing.
+	stored, before, err := r.storedUnit(ctx, unit.GetKey())
+	switch {
+	case err != nil:
+	case isLiveAt(before, expectedVersion) && (r.recording() || before.Vin != unit.Vin):
+		err = r.recordedWrite(ctx, models.HistoryUpdate, types.TransactWriteItem{Put: transactPut(input)}, before, unit)
+	case r.recording():
+		err = &types.ConditionalCheckFailedException{Item: stored}
+	default:
+		_, err = r.client.PutItem(ctx, input)
+	}
 	if err != nil {
+		unit.Version = expectedVersion
 		var conditionalCheckFailedException *types.ConditionalCheckFailedException
 		if errors.As(err, &conditionalCheckFailedException) {
-			return fmt.Errorf("unit with id %s and type %s does not exist or is deleted for account %s", unit.ID, unit.UnitType, unit.AccountID)
+			return conditionFailure(conditionalCheckFailedException.Item, expectedVersion, unit.AccountID, unit.ID, unit.UnitType)
 		}
 		return fmt.Errorf("failed to update unit: %w", err)
 	}
@@ -258,54 +332,346 @@ func (r *DynamoDBUnitRepository) Update(ctx context.Context, unit *models.Unit)
 	return nil
 }
 
-// Delete soft deletes a unit by setting deletedAt timestamp
-func (r *DynamoDBUnitRepository) Delete(ctx context.Context, accountID, unitID, unitType string) error {
+// Patch applies a partial update with a single UpdateItem: present fields are SET,
+// cleared optional fields are REMOVEd, and updatedAt and version are advanced.
+// The write fails with a VersionConflictError if the stored version is not expectedVersion.
+// A patch that changes the VIN moves its reservation in the same transaction, as Update does.
+func (r *DynamoDBUnitRepository) Patch(ctx context.Context, accountID, unitID, unitType string, expectedVersion int64, patch *models.UnitPatch) (*models.Unit, error) {
+	input, err := r.patchInput(accountID, unitID, unitType, expectedVersion, patch)
+	if err != nil {
+		return nil, err
+	}
+	if r.recording() || patch.ChangesVin() {
+		return r.patchRecorded(ctx, input, accountID, unitID, unitType, expectedVersion, patch)
+	}
+	input.ReturnValues = types.ReturnValueAllNew
+
+	output, err := r.client.UpdateItem(ctx, input)
+	if err != nil {
+		var conditionalCheckFailedException *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailedException) {
+			return nil, conditionFailure(conditionalCheckFailedException.Item, expectedVersion, accountID, unitID, unitType)
+		}
+		return nil, fmt.Errorf("failed to update unit: %w", err)
+	}
+
+	var unit models.Unit
+	if err := attributevalue.UnmarshalMap(output.Attributes, &unit); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal updated unit: %w", err)
+	}
+
+	return &unit, nil
+}
+
+// patchInput builds the conditional UpdateItem that applies a patch to a live unit at
+// expectedVersion. It is shared by Patch and transactions.
+func (r *DynamoDBUnitRepository) patchInput(accountID, unitID, unitType string, expectedVersion int64, patch *models.UnitPatch) (*dynamodb.UpdateItemInput, error) {
 	if accountID == "" {
-		return errors.New("accountID is required")
+		return nil, errors.New("accountID is required")
 	}
 	if unitID == "" {
-		return errors.New("unitID is required")
+		return nil, errors.New("unitID is required")
 	}
 	if unitType == "" {
-		return errors.New("unitType is required")
+		return nil, errors.New("unitType is required")
+	}
+	if patch == nil || patch.IsEmpty() {
+		return nil, errors.New("patch has no fields to update")
 	}
 
-	// First, check if the unit exists and get current data
-	unit, err := r.GetByKey(ctx, accountID, unitID, unitType)
-	if err != nil {
-		return fmt.Errorf("failed to check unit existence: %w", err)
+	names := map[string]string{"#updatedAt": "updatedAt"}
+	values := map[string]types.AttributeValue{
+		":updatedAt":  &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+		":newVersion": &types.AttributeValueMemberN{Value: strconv.FormatInt(expectedVersion+1, 10)},
+		":zero":       &types.AttributeValueMemberN{Value: "0"},
 	}
-	if unit == nil {
-		return fmt.Errorf("unit with id %s and type %s not found for account %s", unitID, unitType, accountID)
+	condition := "attribute_exists(pk) AND attribute_exists(sk) AND (attribute_not_exists(deletedAt) OR deletedAt = :zero) AND " +
+		versionCondition(expectedVersion, names, values)
+
+	// Sort attributes so the generated expression is deterministic
+	setAttributes := make([]string, 0, len(patch.Set))
+	for attribute := range patch.Set {
+		setAttributes = append(setAttributes, attribute)
 	}
+	sort.Strings(setAttributes)
 
-	// Mark as deleted
-	unit.MarkDeleted()
+	setClauses := []string{"#updatedAt = :updatedAt", "#version = :newVersion"}
+	for i, attribute := range setAttributes {
+		value, err := attributevalue.Marshal(patch.Set[attribute])
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %s: %w", attribute, err)
+		}
+		namePlaceholder := fmt.Sprintf("#set%d", i)
+		valuePlaceholder := fmt.Sprintf(":set%d", i)
+		names[namePlaceholder] = attribute
+		values[valuePlaceholder] = value
+		setClauses = append(setClauses, fmt.Sprintf("%s = %s", namePlaceholder, valuePlaceholder))
+	}
 
-	// Set the computed SK field for DynamoDB
-	unit.SortKey = unit.GetSortKey()
+	updateExpression := "SET " + strings.Join(setClauses, ", ")
 
-	// Update the item
-	item, err := attributevalue.MarshalMap(unit)
-	if err != nil {
-		return fmt.Errorf("failed to marshal unit: %w", err)
+	if len(patch.Remove) > 0 {
+		removeAttributes := append([]string(nil), patch.Remove...)
+		sort.Strings(removeAttributes)
+
+		removeClauses := make([]string, 0, len(removeAttributes))
+		for i, attribute := range removeAttributes {
+			namePlaceholder := fmt.Sprintf("#remove%d", i)
+			names[namePlaceholder] = attribute
+			removeClauses = append(removeClauses, namePlaceholder)
+		}
+		updateExpression += " REMOVE " + strings.Join(removeClauses, ", ")
 	}
 
-	input := &dynamodb.PutItemInput{
-		TableName: aws.String(r.tableName),
-		Item:      item,
+	key := (&models.Unit{AccountID: accountID, ID: unitID, UnitType: unitType}).GetKey()
+
+	return &dynamodb.UpdateItemInput{
+		TableName:                           aws.String(r.tableName),
+		Key:                                 key,
+		UpdateExpression:                    aws.String(updateExpression),
+		ConditionExpression:                 aws.String(condition),
+		ExpressionAttributeNames:            names,
+		ExpressionAttributeValues:           values,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}, nil
+}
+
+// Delete soft deletes a unit with a single conditional UpdateItem that sets deletedAt,
+// deletedBy and, when a retention period is configured, the expiresAt TTL. It returns ErrUnitNotFound or ErrUnitAlreadyDeleted when there is no
+// live unit to delete, and a VersionConflictError if the stored version is not expectedVersion.
+func (r *DynamoDBUnitRepository) Delete(ctx context.Context, accountID, unitID, unitType string, expectedVersion int64, deletedBy string) error {
+	input, err := r.softDeleteInput(accountID, unitID, unitType, expectedVersion, deletedBy)
+	if err != nil {
+		return err
 	}
 
-	_, err = r.client.PutItem(ctx, input)
+	if r.recording() {
+		err = r.deleteRecorded(ctx, input, expectedVersion, deletedBy)
+	} else {
+		_, err = r.client.UpdateItem(ctx, input)
+	}
 	if err != nil {
+		var conditionalCheckFailedException *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailedException) {
+			return deleteConditionFailure(conditionalCheckFailedException.Item, expectedVersion, accountID, unitID, unitType)
+		}
 		return fmt.Errorf("failed to delete unit: %w", err)
 	}
 
 	return nil
 }
 
+// softDeleteInput builds the conditional UpdateItem that soft deletes a live unit at
+// expectedVersion. It is shared by Delete and transactions.
+func (r *DynamoDBUnitRepository) softDeleteInput(accountID, unitID, unitType string, expectedVersion int64, deletedBy string) (*dynamodb.UpdateItemInput, error) {
+	if accountID == "" {
+		return nil, errors.New("accountID is required")
+	}
+	if unitID == "" {
+		return nil, errors.New("unitID is required")
+	}
+	if unitType == "" {
+		return nil, errors.New("unitType is required")
+	}
+
+	keyUnit := &models.Unit{AccountID: accountID, ID: unitID, UnitType: unitType}
+	keyUnit.MarkDeleted(r.deletedRetention)
+
+	names := map[string]string{}
+	values := map[string]types.AttributeValue{
+		":now":        &types.AttributeValueMemberN{Value: strconv.FormatInt(keyUnit.DeletedAt, 10)},
+		":deletedBy":  &types.AttributeValueMemberS{Value: deletedBy},
+		":newVersion": &types.AttributeValueMemberN{Value: strconv.FormatInt(expectedVersion+1, 10)},
+		":zero":       &types.AttributeValueMemberN{Value: "0"},
+	}
+	condition := "attribute_exists(pk) AND attribute_exists(sk) AND (attribute_not_exists(deletedAt) OR deletedAt = :zero) AND " +
+		versionCondition(expectedVersion, names, values)
+
+	updateExpression := "SET deletedAt = :now, deletedBy = :deletedBy, updatedAt = :now, #version = :newVersion"
+	if keyUnit.ExpiresAt > 0 {
+		updateExpression += ", expiresAt = :expiresAt"
+		values[":expiresAt"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(keyUnit.ExpiresAt, 10)}
+	}
+
+	return &dynamodb.UpdateItemInput{
+		TableName:                           aws.String(r.tableName),
+		Key:                                 keyUnit.GetKey(),
+		UpdateExpression:                    aws.String(updateExpression),
+		ConditionExpression:                 aws.String(condition),
+		ExpressionAttributeNames:            names,
+		ExpressionAttributeValues:           values,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}, nil
+}
+
+// deleteConditionFailure tells apart a missing, an already deleted and a concurrently modified unit
+func deleteConditionFailure(item map[string]types.AttributeValue, expectedVersion int64, accountID, unitID, unitType string) error {
+	if len(item) == 0 {
+		return fmt.Errorf("%w: unit with id %s and type %s for account %s", ErrUnitNotFound, unitID, unitType, accountID)
+	}
+
+	current, err := unmarshalUnitState(item)
+	if err != nil {
+		return err
+	}
+	if current.DeletedAt > 0 {
+		return fmt.Errorf("%w: unit with id %s and type %s for account %s", ErrUnitAlreadyDeleted, unitID, unitType, accountID)
+	}
+	return &VersionConflictError{ExpectedVersion: expectedVersion, CurrentVersion: current.Version}
+}
+
+// Restore undeletes a soft deleted unit with a single conditional UpdateItem that clears
+// deletedAt, deletedBy and the expiresAt TTL, and returns the restored unit. It returns ErrUnitNotFound or
+// ErrUnitNotDeleted when there is no deleted unit to restore, and a VersionConflictError
+// if the stored version is not expectedVersion.
+func (r *DynamoDBUnitRepository) Restore(ctx context.Context, accountID, unitID, unitType string, expectedVersion int64) (*models.Unit, error) {
+	input, err := r.restoreInput(accountID, unitID, unitType, expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+	if r.recording() {
+		return r.restoreRecorded(ctx, input, accountID, unitID, unitType, expectedVersion)
+	}
+	input.ReturnValues = types.ReturnValueAllNew
+
+	output, err := r.client.UpdateItem(ctx, input)
+	if err != nil {
+		var conditionalCheckFailedException *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailedException) {
+			return nil, restoreConditionFailure(conditionalCheckFailedException.Item, expectedVersion, accountID, unitID, unitType)
+		}
+		return nil, fmt.Errorf("failed to restore unit: %w", err)
+	}
+
+	var unit models.Unit
+	if err := attributevalue.UnmarshalMap(output.Attributes, &unit); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal restored unit: %w", err)
+	}
+
+	return &unit, nil
+}
+
+// restoreInput builds the conditional UpdateItem that undeletes a soft deleted unit at expectedVersion
+func (r *DynamoDBUnitRepository) restoreInput(accountID, unitID, unitType string, expectedVersion int64) (*dynamodb.UpdateItemInput, error) {
+	if accountID == "" {
+		return nil, errors.New("accountID is required")
+	}
+	if unitID == "" {
+		return nil, errors.New("unitID is required")
+	}
+	if unitType == "" {
+		return nil, errors.New("unitType is required")
+	}
+
+	names := map[string]string{}
+	values := map[string]types.AttributeValue{
+		":now":        &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+		":newVersion": &types.AttributeValueMemberN{Value: strconv.FormatInt(expectedVersion+1, 10)},
+		":zero":       &types.AttributeValueMemberN{Value: "0"},
+	}
+	condition := "attribute_exists(pk) AND attribute_exists(sk) AND deletedAt > :zero AND " +
+		versionCondition(expectedVersion, names, values)
+
+	key := (&models.Unit{AccountID: accountID, ID: unitID, UnitType: unitType}).GetKey()
+
+	return &dynamodb.UpdateItemInput{
+		TableName:                           aws.String(r.tableName),
+		Key:                                 key,
+		UpdateExpression:                    aws.String("SET deletedAt = :zero, updatedAt = :now, #version = :newVersion REMOVE deletedBy, expiresAt"),
+		ConditionExpression:                 aws.String(condition),
+		ExpressionAttributeNames:            names,
+		ExpressionAttributeValues:           values,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}, nil
+}
+
+// restoreConditionFailure tells apart a missing, a live and a concurrently modified unit
+func restoreConditionFailure(item map[string]types.AttributeValue, expectedVersion int64, accountID, unitID, unitType string) error {
+	if len(item) == 0 {
+		return fmt.Errorf("%w: unit with id %s and type %s for account %s", ErrUnitNotFound, unitID, unitType, accountID)
+	}
+
+	current, err := unmarshalUnitState(item)
+	if err != nil {
+		return err
+	}
+	if current.DeletedAt == 0 {
+		return fmt.Errorf("%w: unit with id %s and type %s for account %s", ErrUnitNotDeleted, unitID, unitType, accountID)
+	}
+	return &VersionConflictError{ExpectedVersion: expectedVersion, CurrentVersion: current.Version}
+}
+
+// Purge permanently removes a soft deleted unit. It returns ErrUnitNotFound when the
+// unit does not exist and ErrUnitNotDeleted when it has not been soft deleted.
+func (r *DynamoDBUnitRepository) Purge(ctx context.Context, accountID, unitID, unitType string) error {
+	if accountID == "" {
+		return errors.New("accountID is required")
+	}
+	if unitID == "" {
+		return errors.New("unitID is required")
+	}
+	if unitType == "" {
+		return errors.New("unitType is required")
+	}
+
+	key := (&models.Unit{AccountID: accountID, ID: unitID, UnitType: unitType}).GetKey()
+	return purgeDeletedItem(ctx, r.client, r.tableName, key, accountID, unitID, unitType)
+}
+
+// versionCondition adds the placeholders for an expected unit version and returns the
+// matching condition. Units written before versioning have no version attribute and
+// match version 0.
+func versionCondition(expectedVersion int64, names map[string]string, values map[string]types.AttributeValue) string {
+	names["#version"] = "version"
+	values[":expectedVersion"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(expectedVersion, 10)}
+	if expectedVersion == 0 {
+		return "(attribute_not_exists(#version) OR #version = :expectedVersion)"
+	}
+	return "#version = :expectedVersion"
+}
+
+// conditionFailure explains a failed conditional write using the item DynamoDB returned
+func conditionFailure(item map[string]types.AttributeValue, expectedVersion int64, accountID, unitID, unitType string) error {
+	current, err := unmarshalUnitState(item)
+	if err != nil {
+		return err
+	}
+	if len(item) == 0 || current.DeletedAt > 0 {
+		return fmt.Errorf("%w: unit with id %s and type %s does not exist or is deleted for account %s", ErrUnitNotFound, unitID, unitType, accountID)
+	}
+	return &VersionConflictError{ExpectedVersion: expectedVersion, CurrentVersion: current.Version}
+}
+
+// unitState holds the attributes the condition failure mappings inspect. Reading only
+// these keeps the mappings usable for schema-driven items, whose other attributes need
+// not fit models.Unit.
+type unitState struct {
+	DeletedAt int64 `dynamodbav:"deletedAt"`
+	Version   int64 `dynamodbav:"version"`
+}
+
+// unmarshalUnitState reads the deletion marker and version of a stored item
+func unmarshalUnitState(item map[string]types.AttributeValue) (*unitState, error) {
+	var state unitState
+	if err := attributevalue.UnmarshalMap(item, &state); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal current unit: %w", err)
+	}
+	return &state, nil
+}
+
 // List retrieves a paginated list of units
 func (r *DynamoDBUnitRepository) List(ctx context.Context, input *appsync.ListUnitsInput) (*appsync.ListUnitsResponse, error) {
+	return r.list(ctx, input, "attribute_not_exists(deletedAt) OR deletedAt = :zero")
+}
+
+// ListDeleted retrieves a paginated list of soft deleted units
+func (r *DynamoDBUnitRepository) ListDeleted(ctx context.Context, input *appsync.ListUnitsInput) (*appsync.ListUnitsResponse, error) {
+	return r.list(ctx, input, "deletedAt > :zero")
+}
+
+// list queries the units of an account that match deletedFilter, a condition on
+// deletedAt that may reference :zero
+func (r *DynamoDBUnitRepository) list(ctx context.Context, input *appsync.ListUnitsInput, deletedFilter string) (*appsync.ListUnitsResponse, error) {
 	if input == nil {
 		return nil, errors.New("input is required")
 	}
@@ -324,17 +690,22 @@ func (r *DynamoDBUnitRepository) List(ctx context.Context, input *appsync.ListUn
 	queryInput := &dynamodb.QueryInput{
 		TableName:              aws.String(r.tableName),
 		KeyConditionExpression: aws.String("pk = :accountId"),
-		FilterExpression:       aws.String("attribute_not_exists(deletedAt) OR deletedAt = :zero"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":accountId": &types.AttributeValueMemberS{Value: input.AccountID},
 			":zero":      &types.AttributeValueMemberN{Value: "0"},
 		},
 		Limit: aws.Int32(limit),
 	}
+	queryInput.FilterExpression = aws.String(withoutHistory(deletedFilter, queryInput.ExpressionAttributeValues))
+
+	if err := applyListFilter(queryInput, input.Filter); err != nil {
+		return nil, err
+	}
 
 	// Handle pagination with proper token decoding
+	scope := listScope(input, deletedFilter)
 	if input.NextToken != nil && *input.NextToken != "" {
-		exclusiveStartKey, err := r.decodePaginationToken(*input.NextToken)
+		exclusiveStartKey, err := r.decodePaginationToken(*input.NextToken, scope)
 		if err != nil {
 			return nil, fmt.Errorf("failed to decode pagination token: %w", err)
 		}
@@ -365,7 +736,7 @@ func (r *DynamoDBUnitRepository) List(ctx context.Context, input *appsync.ListUn
 
 	// Handle next token for pagination with proper encoding
 	if result.LastEvaluatedKey != nil {
-		nextToken, err := r.encodePaginationToken(result.LastEvaluatedKey)
+		nextToken, err := r.encodePaginationToken(result.LastEvaluatedKey, scope)
 		if err != nil {
 			return nil, fmt.Errorf("failed to encode pagination token: %w", err)
 		}
@@ -425,8 +796,8 @@ func (r *DynamoDBUnitRepository) Exists(ctx context.Context, accountID, unitID,
 	return true, nil
 }
 
-// GetByUnitID retrieves units by unit ID using the GSI
-// This will return all units with the given ID across all accounts and types
+// GetByUnitID retrieves units by unit ID using the GSI, reading every page of the
+// index so units in any number of accounts are returned
 func (r *DynamoDBUnitRepository) GetByUnitID(ctx context.Context, unitID string) ([]models.Unit, error) {
 	if unitID == "" {
 		return nil, errors.New("unitID is required")
@@ -444,17 +815,23 @@ func (r *DynamoDBUnitRepository) GetByUnitID(ctx context.Context, unitID string)
 		},
 	}
 
-	result, err := r.client.Query(ctx, queryInput)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query units by ID: %w", err)
-	}
-
 	// Initialize as empty slice to ensure it marshals to [] instead of null
 	units := make([]models.Unit, 0)
-	err = attributevalue.UnmarshalListOfMaps(result.Items, &units)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal units: %w", err)
-	}
+	for {
+		result, err := r.client.Query(ctx, queryInput)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query units by ID: %w", err)
+		}
+
+		var page []models.Unit
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal units: %w", err)
+		}
+		units = append(units, page...)
 
-	return units, nil
+		if result.LastEvaluatedKey == nil {
+			return units, nil
+		}
+		queryInput.ExclusiveStartKey = result.LastEvaluatedKey
+	}
 }
@@ -1,11 +1,14 @@
 package repository
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -15,7 +18,8 @@ import (
 )
 
 func TestDynamoDBUnitRepository_PaginationTokenEncoding(t *testing.T) {
-	repo := &DynamoDBUnitRepository{}
+	repo := NewDynamoDBUnitRepository(&fakeDynamoDB{}, "units")
+	scope := paginationScope{accountID: "account-456", filterHash: "none"}
 
 	tests := []struct {
 		name     string
@@ -52,12 +56,19 @@ func TestDynamoDBUnitRepository_PaginationTokenEncoding(t *testing.T) {
 			},
 			expected: true,
 		},
+		{
+			name: "unsupported attribute type",
+			lastKey: map[string]types.AttributeValue{
+				"pk": &types.AttributeValueMemberBOOL{Value: true},
+			},
+			expected: false,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Test encoding
-			token, err := repo.encodePaginationToken(tt.lastKey)
+			token, err := repo.encodePaginationToken(tt.lastKey, scope)
 			if tt.expected {
 				require.NoError(t, err)
 			} else {
@@ -75,20 +86,18 @@ func TestDynamoDBUnitRepository_PaginationTokenEncoding(t *testing.T) {
 			assert.NotEmpty(t, token)
 
 			// Test decoding
-			decodedKey, err := repo.decodePaginationToken(token)
+			decodedKey, err := repo.decodePaginationToken(token, scope)
 			require.NoError(t, err)
 
-			// Compare original and decoded keys
-			require.Equal(t, len(tt.lastKey), len(decodedKey))
-			for key := range tt.lastKey {
-				assert.Contains(t, decodedKey, key)
-			}
+			// Decoding restores the original key exactly
+			assert.Equal(t, tt.lastKey, decodedKey)
 		})
 	}
 }
 
 func TestDynamoDBUnitRepository_PaginationTokenDecoding(t *testing.T) {
-	repo := &DynamoDBUnitRepository{}
+	repo := NewDynamoDBUnitRepository(&fakeDynamoDB{}, "units")
+	scope := paginationScope{accountID: "account-123"}
 
 	tests := []struct {
 		name        string
@@ -106,18 +115,18 @@ func TestDynamoDBUnitRepository_PaginationTokenDecoding(t *testing.T) {
 			expectError: true,
 		},
 		{
-			name:        "valid base64 but invalid JSON",
-			token:       "aW52YWxpZCBqc29u", // "invalid json" in base64
+			name:        "unsigned legacy token",
+			token:       base64.StdEncoding.EncodeToString([]byte(`{"pk":"account-123","sk":"unit-1#commercialVehicleType"}`)),
 			expectError: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			decodedKey, err := repo.decodePaginationToken(tt.token)
+			decodedKey, err := repo.decodePaginationToken(tt.token, scope)
 
 			if tt.expectError {
-				assert.Error(t, err)
+				assert.ErrorIs(t, err, ErrInvalidPaginationToken)
 				assert.Nil(t, decodedKey)
 			} else {
 				assert.NoError(t, err)
@@ -130,7 +139,8 @@ func TestDynamoDBUnitRepository_PaginationTokenDecoding(t *testing.T) {
 }
 
 func TestDynamoDBUnitRepository_PaginationTokenRoundTrip(t *testing.T) {
-	repo := &DynamoDBUnitRepository{}
+	client := &fakeDynamoDB{}
+	repo := NewDynamoDBUnitRepository(client, "units")
 
 	// Create a comprehensive last key that represents what DynamoDB might return
 	originalKey := map[string]types.AttributeValue{
@@ -140,38 +150,26 @@ func TestDynamoDBUnitRepository_PaginationTokenRoundTrip(t *testing.T) {
 		"updatedAt": &types.AttributeValueMemberN{Value: "1640995200"},
 	}
 
-	// Encode to token
-	token, err := repo.encodePaginationToken(originalKey)
-	require.NoError(t, err)
-	require.NotEmpty(t, token)
+	var startKeys []map[string]types.AttributeValue
+	client.query = func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+		startKeys = append(startKeys, input.ExclusiveStartKey)
+		return &dynamodb.QueryOutput{LastEvaluatedKey: originalKey}, nil
+	}
 
-	// Decode back to key
-	decodedKey, err := repo.decodePaginationToken(token)
+	// The first page returns a token for the next one
+	input := &appsync.ListUnitsInput{AccountID: "account-123"}
+	first, err := repo.List(context.Background(), input)
 	require.NoError(t, err)
-	require.NotNil(t, decodedKey)
-
-	// Verify all keys are present
-	require.Equal(t, len(originalKey), len(decodedKey))
-
-	// Verify specific key-value pairs
-	assert.Contains(t, decodedKey, "pk")
-	assert.Contains(t, decodedKey, "sk")
-	assert.Contains(t, decodedKey, "createdAt")
-	assert.Contains(t, decodedKey, "updatedAt")
+	require.NotNil(t, first.NextToken)
 
-	// Verify string values are correctly handled
-	pkAttr, ok := decodedKey["pk"].(*types.AttributeValueMemberS)
-	require.True(t, ok)
-	assert.Equal(t, "account-123", pkAttr.Value)
-
-	skAttr, ok := decodedKey["sk"].(*types.AttributeValueMemberS)
-	require.True(t, ok)
-	assert.Equal(t, "550e8400-e29b-41d4-a716-446655440000#commercialVehicleType", skAttr.Value)
+	// Following the token resumes from the same key
+	input.NextToken = first.NextToken
+	_, err = repo.List(context.Background(), input)
+	require.NoError(t, err)
 
-	// Verify that the token is base64 encoded (robust check)
-	_, err = base64.StdEncoding.DecodeString(token)
-	require.NoError(t, err, "Token is not valid base64")
-	assert.NotEmpty(t, token, "Decoded token should not be empty")
+	require.Len(t, startKeys, 2)
+	assert.Nil(t, startKeys[0])
+	assert.Equal(t, originalKey, startKeys[1])
 }
 
 func TestUnit_SoftDeleteFunctionality(t *testing.T) {
@@ -190,7 +188,7 @@ func TestUnit_SoftDeleteFunctionality(t *testing.T) {
 	assert.Equal(t, int64(0), unit.DeletedAt)
 
 	// Mark unit as deleted
-	unit.MarkDeleted()
+	unit.MarkDeleted(0)
 
 	// After marking as deleted, unit should be considered deleted
 	assert.True(t, unit.IsDeleted())
@@ -357,3 +355,400 @@ func TestUnit_GetSortKey(t *testing.T) {
 	sk = unit.GetSortKey()
 	assert.Equal(t, "test-unit-id-123#someOtherType", sk)
 }
+
+func TestDynamoDBUnitRepository_ListWithFilter(t *testing.T) {
+	var captured *dynamodb.QueryInput
+	client := &fakeDynamoDB{
+		query: func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+			captured = input
+			return &dynamodb.QueryOutput{}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	filter := `{"or":[{"field":"make","op":"eq","value":"Ford"},{"field":"model","op":"begins_with","value":"F-"}]}`
+	_, err := repo.List(context.Background(), &appsync.ListUnitsInput{AccountID: "account-1", Filter: &filter})
+	require.NoError(t, err)
+
+	require.NotNil(t, captured)
+	assert.Equal(t, "((attribute_not_exists(deletedAt) OR deletedAt = :zero) AND NOT contains(sk, :historyMarker)) AND (#flt0 = :flt0 OR begins_with(#flt1, :flt1))", *captured.FilterExpression)
+	assert.Equal(t, map[string]string{"#flt0": "make", "#flt1": "model"}, captured.ExpressionAttributeNames)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "account-1"}, captured.ExpressionAttributeValues[":accountId"])
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "Ford"}, captured.ExpressionAttributeValues[":flt0"])
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "F-"}, captured.ExpressionAttributeValues[":flt1"])
+}
+
+func TestDynamoDBUnitRepository_ListRejectsMalformedFilter(t *testing.T) {
+	client := &fakeDynamoDB{}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	filter := `{"field":"make"}`
+	_, err := repo.List(context.Background(), &appsync.ListUnitsInput{AccountID: "account-1", Filter: &filter})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid filter")
+}
+
+func TestDynamoDBUnitRepository_Patch(t *testing.T) {
+	var captured *dynamodb.UpdateItemInput
+	client := &fakeDynamoDB{
+		updateItem: func(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+			captured = input
+			return &dynamodb.UpdateItemOutput{Attributes: map[string]types.AttributeValue{
+				"pk":       &types.AttributeValueMemberS{Value: "account-1"},
+				"id":       &types.AttributeValueMemberS{Value: "unit-1"},
+				"unitType": &types.AttributeValueMemberS{Value: "commercialVehicleType"},
+				"make":     &types.AttributeValueMemberS{Value: "Mack"},
+			}}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	patch := &models.UnitPatch{
+		Set:    map[string]interface{}{"make": "Mack", "note": ""},
+		Remove: []string{"trim"},
+	}
+	unit, err := repo.Patch(context.Background(), "account-1", "unit-1", "commercialVehicleType", 3, patch)
+	require.NoError(t, err)
+
+	require.NotNil(t, captured)
+	assert.Equal(t, "SET #updatedAt = :updatedAt, #version = :newVersion, #set0 = :set0, #set1 = :set1 REMOVE #remove0", *captured.UpdateExpression)
+	assert.Equal(t, map[string]string{"#updatedAt": "updatedAt", "#version": "version", "#set0": "make", "#set1": "note", "#remove0": "trim"}, captured.ExpressionAttributeNames)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "Mack"}, captured.ExpressionAttributeValues[":set0"])
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "3"}, captured.ExpressionAttributeValues[":expectedVersion"])
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "4"}, captured.ExpressionAttributeValues[":newVersion"])
+	assert.Contains(t, *captured.ConditionExpression, "attribute_exists(pk)")
+	assert.Contains(t, *captured.ConditionExpression, "#version = :expectedVersion")
+	assert.Equal(t, types.ReturnValueAllNew, captured.ReturnValues)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "unit-1#commercialVehicleType"}, captured.Key["sk"])
+
+	assert.Equal(t, "account-1", unit.AccountID)
+	assert.Equal(t, "Mack", unit.Make)
+}
+
+func TestDynamoDBUnitRepository_PatchMissingUnit(t *testing.T) {
+	client := &fakeDynamoDB{
+		updateItem: func(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+			return nil, &types.ConditionalCheckFailedException{}
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	_, err := repo.Patch(context.Background(), "account-1", "unit-1", "commercialVehicleType", 1, &models.UnitPatch{Set: map[string]interface{}{"make": "Mack"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not exist or is deleted")
+
+	_, err = repo.Patch(context.Background(), "account-1", "unit-1", "commercialVehicleType", 1, &models.UnitPatch{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no fields to update")
+}
+
+func TestDynamoDBUnitRepository_VersionConflict(t *testing.T) {
+	current := map[string]types.AttributeValue{
+		"pk":      &types.AttributeValueMemberS{Value: "account-1"},
+		"id":      &types.AttributeValueMemberS{Value: "unit-1"},
+		"version": &types.AttributeValueMemberN{Value: "5"},
+	}
+	client := &fakeDynamoDB{
+		updateItem: func(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+			assert.Equal(t, types.ReturnValuesOnConditionCheckFailureAllOld, input.ReturnValuesOnConditionCheckFailure)
+			return nil, &types.ConditionalCheckFailedException{Item: current}
+		},
+		putItem: func(*dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+			return nil, &types.ConditionalCheckFailedException{Item: current}
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	_, err := repo.Patch(context.Background(), "account-1", "unit-1", "commercialVehicleType", 4, &models.UnitPatch{Set: map[string]interface{}{"make": "Mack"}})
+	var conflict *VersionConflictError
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, int64(4), conflict.ExpectedVersion)
+	assert.Equal(t, int64(5), conflict.CurrentVersion)
+
+	unit := &models.Unit{AccountID: "account-1", ID: "unit-1", UnitType: "commercialVehicleType", Version: 4}
+	err = repo.Update(context.Background(), unit)
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, int64(5), conflict.CurrentVersion)
+	assert.Equal(t, int64(4), unit.Version, "failed update must not advance the caller's version")
+
+	put := client.putInputs[0]
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "5"}, put.Item["version"])
+	assert.Contains(t, *put.ConditionExpression, "#version = :expectedVersion")
+}
+
+func TestVersionCondition_UnversionedUnits(t *testing.T) {
+	names := map[string]string{}
+	values := map[string]types.AttributeValue{}
+
+	condition := versionCondition(0, names, values)
+
+	assert.Equal(t, "(attribute_not_exists(#version) OR #version = :expectedVersion)", condition)
+	assert.Equal(t, "version", names["#version"])
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "0"}, values[":expectedVersion"])
+}
+
+func TestDynamoDBUnitRepository_Delete(t *testing.T) {
+	var captured *dynamodb.UpdateItemInput
+	client := &fakeDynamoDB{
+		updateItem: func(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+			captured = input
+			return &dynamodb.UpdateItemOutput{}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	err := repo.Delete(context.Background(), "account-1", "unit-1", "commercialVehicleType", 2, "fleet-admin")
+	require.NoError(t, err)
+
+	require.NotNil(t, captured)
+	assert.Empty(t, client.putInputs, "soft delete must not rewrite the whole item")
+	assert.Equal(t, "SET deletedAt = :now, deletedBy = :deletedBy, updatedAt = :now, #version = :newVersion", *captured.UpdateExpression)
+	assert.Equal(t, "attribute_exists(pk) AND attribute_exists(sk) AND (attribute_not_exists(deletedAt) OR deletedAt = :zero) AND #version = :expectedVersion", *captured.ConditionExpression)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "fleet-admin"}, captured.ExpressionAttributeValues[":deletedBy"])
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "3"}, captured.ExpressionAttributeValues[":newVersion"])
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "unit-1#commercialVehicleType"}, captured.Key["sk"])
+}
+
+func TestDynamoDBUnitRepository_DeleteConditionFailures(t *testing.T) {
+	tests := []struct {
+		name      string
+		item      map[string]types.AttributeValue
+		wantErr   error
+		wantCheck func(t *testing.T, err error)
+	}{
+		{
+			name:    "missing unit",
+			item:    nil,
+			wantErr: ErrUnitNotFound,
+		},
+		{
+			name: "already deleted",
+			item: map[string]types.AttributeValue{
+				"pk":        &types.AttributeValueMemberS{Value: "account-1"},
+				"deletedAt": &types.AttributeValueMemberN{Value: "1700000000"},
+				"version":   &types.AttributeValueMemberN{Value: "2"},
+			},
+			wantErr: ErrUnitAlreadyDeleted,
+		},
+		{
+			name: "concurrent update",
+			item: map[string]types.AttributeValue{
+				"pk":        &types.AttributeValueMemberS{Value: "account-1"},
+				"deletedAt": &types.AttributeValueMemberN{Value: "0"},
+				"version":   &types.AttributeValueMemberN{Value: "3"},
+			},
+			wantCheck: func(t *testing.T, err error) {
+				var conflict *VersionConflictError
+				require.ErrorAs(t, err, &conflict)
+				assert.Equal(t, int64(3), conflict.CurrentVersion)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeDynamoDB{
+				updateItem: func(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+					return nil, &types.ConditionalCheckFailedException{Item: tt.item}
+				},
+			}
+			repo := NewDynamoDBUnitRepository(client, "units")
+
+			err := repo.Delete(context.Background(), "account-1", "unit-1", "commercialVehicleType", 2, "fleet-admin")
+			require.Error(t, err)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+			if tt.wantCheck != nil {
+				tt.wantCheck(t, err)
+			}
+		})
+	}
+}
+
+func TestDynamoDBUnitRepository_Restore(t *testing.T) {
+	var captured *dynamodb.UpdateItemInput
+	client := &fakeDynamoDB{
+		updateItem: func(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+			captured = input
+			return &dynamodb.UpdateItemOutput{Attributes: map[string]types.AttributeValue{
+				"id":        &types.AttributeValueMemberS{Value: "unit-1"},
+				"accountId": &types.AttributeValueMemberS{Value: "account-1"},
+				"deletedAt": &types.AttributeValueMemberN{Value: "0"},
+				"version":   &types.AttributeValueMemberN{Value: "4"},
+			}}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	unit, err := repo.Restore(context.Background(), "account-1", "unit-1", "commercialVehicleType", 3)
+	require.NoError(t, err)
+
+	assert.Equal(t, "unit-1", unit.ID)
+	assert.False(t, unit.IsDeleted())
+	assert.Equal(t, int64(4), unit.Version)
+
+	require.NotNil(t, captured)
+	assert.Equal(t, "SET deletedAt = :zero, updatedAt = :now, #version = :newVersion REMOVE deletedBy, expiresAt", *captured.UpdateExpression)
+	assert.Equal(t, "attribute_exists(pk) AND attribute_exists(sk) AND deletedAt > :zero AND #version = :expectedVersion", *captured.ConditionExpression)
+	assert.Equal(t, types.ReturnValueAllNew, captured.ReturnValues)
+}
+
+func TestDynamoDBUnitRepository_RestoreConditionFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		item    map[string]types.AttributeValue
+		wantErr error
+	}{
+		{name: "missing unit", item: nil, wantErr: ErrUnitNotFound},
+		{
+			name: "live unit",
+			item: map[string]types.AttributeValue{
+				"deletedAt": &types.AttributeValueMemberN{Value: "0"},
+				"version":   &types.AttributeValueMemberN{Value: "3"},
+			},
+			wantErr: ErrUnitNotDeleted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeDynamoDB{
+				updateItem: func(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+					return nil, &types.ConditionalCheckFailedException{Item: tt.item}
+				},
+			}
+			repo := NewDynamoDBUnitRepository(client, "units")
+
+			_, err := repo.Restore(context.Background(), "account-1", "unit-1", "commercialVehicleType", 3)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+
+	t.Run("concurrent update", func(t *testing.T) {
+		client := &fakeDynamoDB{
+			updateItem: func(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+				return nil, &types.ConditionalCheckFailedException{Item: map[string]types.AttributeValue{
+					"deletedAt": &types.AttributeValueMemberN{Value: "1700000000"},
+					"version":   &types.AttributeValueMemberN{Value: "5"},
+				}}
+			},
+		}
+		repo := NewDynamoDBUnitRepository(client, "units")
+
+		_, err := repo.Restore(context.Background(), "account-1", "unit-1", "commercialVehicleType", 3)
+		var conflict *VersionConflictError
+		require.ErrorAs(t, err, &conflict)
+		assert.Equal(t, int64(5), conflict.CurrentVersion)
+	})
+}
+
+func TestDynamoDBUnitRepository_ListDeleted(t *testing.T) {
+	var captured *dynamodb.QueryInput
+	client := &fakeDynamoDB{
+		query: func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+			captured = input
+			return &dynamodb.QueryOutput{}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	filter := `{"field":"make","op":"eq","value":"Ford"}`
+	result, err := repo.ListDeleted(context.Background(), &appsync.ListUnitsInput{AccountID: "account-1", Filter: &filter})
+	require.NoError(t, err)
+	assert.NotNil(t, result.Items)
+
+	require.NotNil(t, captured)
+	assert.Equal(t, "((deletedAt > :zero) AND NOT contains(sk, :historyMarker)) AND #flt0 = :flt0", *captured.FilterExpression)
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "0"}, captured.ExpressionAttributeValues[":zero"])
+}
+
+func TestDynamoDBUnitRepository_DeleteSetsTTL(t *testing.T) {
+	var captured *dynamodb.UpdateItemInput
+	client := &fakeDynamoDB{
+		updateItem: func(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+			captured = input
+			return &dynamodb.UpdateItemOutput{}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units").WithDeletedRetention(48 * time.Hour)
+
+	require.NoError(t, repo.Delete(context.Background(), "account-1", "unit-1", "commercialVehicleType", 2, "fleet-admin"))
+
+	require.NotNil(t, captured)
+	assert.Equal(t, "SET deletedAt = :now, deletedBy = :deletedBy, updatedAt = :now, #version = :newVersion, expiresAt = :expiresAt", *captured.UpdateExpression)
+
+	deletedAt, err := strconv.ParseInt(captured.ExpressionAttributeValues[":now"].(*types.AttributeValueMemberN).Value, 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, &types.AttributeValueMemberN{Value: strconv.FormatInt(deletedAt+48*60*60, 10)}, captured.ExpressionAttributeValues[":expiresAt"])
+}
+
+// Soft delete fields and TTLs sent by clients are not stored on new units
+func TestDynamoDBUnitRepository_CreateClearsDeletion(t *testing.T) {
+	client := &fakeDynamoDB{}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	forged := func() *models.Unit {
+		return &models.Unit{AccountID: "account-1", UnitType: "commercialVehicleType", Make: "Mack", DeletedAt: 1, DeletedBy: "someone-else", ExpiresAt: 1}
+	}
+	require.NoError(t, repo.Create(context.Background(), forged()))
+	require.NoError(t, repo.BatchCreate(context.Background(), []*models.Unit{forged()})[0])
+	require.NoError(t, repo.TransactWrite(context.Background(), "account-1", []TransactOp{{Type: TransactCreate, Unit: forged()}}, "user-1"))
+
+	require.Len(t, client.putInputs, 1)
+	require.Len(t, client.batchInputs, 1)
+	require.Len(t, client.transactInputs, 1)
+	items := []map[string]types.AttributeValue{
+		client.putInputs[0].Item,
+		client.batchInputs[0].RequestItems["units"][0].PutRequest.Item,
+		client.transactInputs[0].TransactItems[0].Put.Item,
+	}
+	for _, item := range items {
+		assert.Equal(t, &types.AttributeValueMemberN{Value: "0"}, item["deletedAt"])
+		assert.NotContains(t, item, "deletedBy")
+		// An expiresAt already in the past would have DynamoDB delete the live unit
+		assert.NotEqual(t, &types.AttributeValueMemberN{Value: "1"}, item["expiresAt"])
+	}
+}
+
+func TestDynamoDBUnitRepository_GetByUnitIDReadsEveryPage(t *testing.T) {
+	unitItem := func(accountID string) map[string]types.AttributeValue {
+		return map[string]types.AttributeValue{
+			"pk":       &types.AttributeValueMemberS{Value: accountID},
+			"sk":       &types.AttributeValueMemberS{Value: "unit-1#commercialVehicleType"},
+			"id":       &types.AttributeValueMemberS{Value: "unit-1"},
+			"unitType": &types.AttributeValueMemberS{Value: "commercialVehicleType"},
+		}
+	}
+	lastKey := map[string]types.AttributeValue{
+		"id": &types.AttributeValueMemberS{Value: "unit-1"},
+		"pk": &types.AttributeValueMemberS{Value: "account-1"},
+		"sk": &types.AttributeValueMemberS{Value: "unit-1#commercialVehicleType"},
+	}
+
+	var inputs []*dynamodb.QueryInput
+	client := &fakeDynamoDB{
+		query: func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+			inputs = append(inputs, input)
+			if input.ExclusiveStartKey == nil {
+				return &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{unitItem("account-1")}, LastEvaluatedKey: lastKey}, nil
+			}
+			return &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{unitItem("account-2")}}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	units, err := repo.GetByUnitID(context.Background(), "unit-1")
+	require.NoError(t, err)
+
+	require.Len(t, units, 2)
+	assert.Equal(t, "account-1", units[0].AccountID)
+	assert.Equal(t, "account-2", units[1].AccountID)
+
+	require.Len(t, inputs, 2)
+	assert.Equal(t, "unit-id-index", *inputs[0].IndexName)
+	assert.Equal(t, lastKey, inputs[1].ExclusiveStartKey)
+
+	_, err = repo.GetByUnitID(context.Background(), "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrUnitNotFound is returned when a write targets a unit that does not exist
+	ErrUnitNotFound = errors.New("unit not found")
+	// ErrUnitAlreadyDeleted is returned when soft deleting a unit that is already deleted
+	ErrUnitAlreadyDeleted = errors.New("unit already deleted")
+	// ErrUnitNotDeleted is returned when restoring a unit that is not soft deleted
+	ErrUnitNotDeleted = errors.New("unit not deleted")
+	// ErrUnitAlreadyExists is returned when a transaction creates a unit whose key is taken
+	ErrUnitAlreadyExists = errors.New("unit already exists")
+	// ErrTransactionConflict is returned for a transaction operation on a unit that
+	// another transaction was writing at the same time
+	ErrTransactionConflict = errors.New("unit is being written by another transaction")
+	// ErrHistoryIncomplete is returned when a unit's history does not start with its
+	// creation, as for units created before history was recorded, so it cannot be replayed
+	ErrHistoryIncomplete = errors.New("unit history does not start with its creation")
+	// ErrWebhookSubscriptionNotFound is returned when a write targets a webhook subscription that does not exist
+	ErrWebhookSubscriptionNotFound = errors.New("webhook subscription not found")
+)
+
+// VersionConflictError is returned when a write's expected version no longer
+// matches the stored unit because another writer changed it first
+type VersionConflictError struct {
+	ExpectedVersion int64
+	CurrentVersion  int64
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("version conflict: expected version %d but current version is %d", e.ExpectedVersion, e.CurrentVersion)
+}
+
+// DuplicateVinError is returned when creating a unit, or giving a unit a VIN, that
+// is already used by another unit in the same account
+type DuplicateVinError struct {
+	Vin    string
+	UnitID string
+}
+
+func (e *DuplicateVinError) Error() string {
+	return fmt.Sprintf("VIN %s is already used by unit %s", e.Vin, e.UnitID)
+}
+
+// TransactionCanceledError is returned when a transaction is canceled, either by
+// DynamoDB or before it is sent because an operation cannot succeed. Errors holds
+// one entry per operation: why it failed, or nil if it did not cause the cancellation.
+type TransactionCanceledError struct {
+	Errors []error
+}
+
+func (e *TransactionCanceledError) Error() string {
+	var reasons []string
+	for i, err := range e.Errors {
+		if err != nil {
+			reasons = append(reasons, fmt.Sprintf("operation %d: %v", i, err))
+		}
+	}
+	if len(reasons) == 0 {
+		return "transaction canceled"
+	}
+	return "transaction canceled: " + strings.Join(reasons, "; ")
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// fakeDynamoDB is a DynamoDBAPI stand-in whose behavior is supplied per test
+type fakeDynamoDB struct {
+	getItem    func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error)
+	putItem    func(*dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error)
+	updateItem func(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error)
+	deleteItem func(*dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error)
+	query      func(*dynamodb.QueryInput) (*dynamodb.QueryOutput, error)
+	scan       func(*dynamodb.ScanInput) (*dynamodb.ScanOutput, error)
+	batchGet   func(*dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error)
+	batchWrite func(*dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error)
+	transact   func(*dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error)
+
+	// mu guards the recorded inputs, as some repository methods write concurrently
+	mu             sync.Mutex
+	putInputs      []*dynamodb.PutItemInput
+	updateInputs   []*dynamodb.UpdateItemInput
+	deleteInputs   []*dynamodb.DeleteItemInput
+	batchGetInputs []*dynamodb.BatchGetItemInput
+	batchInputs    []*dynamodb.BatchWriteItemInput
+	transactInputs []*dynamodb.TransactWriteItemsInput
+}
+
+func (f *fakeDynamoDB) GetItem(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if f.getItem == nil {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	return f.getItem(params)
+}
+
+func (f *fakeDynamoDB) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	f.mu.Lock()
+	f.putInputs = append(f.putInputs, params)
+	f.mu.Unlock()
+	if f.putItem == nil {
+		return &dynamodb.PutItemOutput{}, nil
+	}
+	return f.putItem(params)
+}
+
+func (f *fakeDynamoDB) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	f.mu.Lock()
+	f.updateInputs = append(f.updateInputs, params)
+	f.mu.Unlock()
+	if f.updateItem == nil {
+		return &dynamodb.UpdateItemOutput{}, nil
+	}
+	return f.updateItem(params)
+}
+
+func (f *fakeDynamoDB) DeleteItem(_ context.Context, params *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	f.mu.Lock()
+	f.deleteInputs = append(f.deleteInputs, params)
+	f.mu.Unlock()
+	if f.deleteItem == nil {
+		return &dynamodb.DeleteItemOutput{}, nil
+	}
+	return f.deleteItem(params)
+}
+
+func (f *fakeDynamoDB) Query(_ context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	if f.query == nil {
+		return &dynamodb.QueryOutput{}, nil
+	}
+	return f.query(params)
+}
+
+func (f *fakeDynamoDB) Scan(_ context.Context, params *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	if f.scan == nil {
+		return &dynamodb.ScanOutput{}, nil
+	}
+	return f.scan(params)
+}
+
+func (f *fakeDynamoDB) BatchGetItem(_ context.Context, params *dynamodb.BatchGetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	f.mu.Lock()
+	f.batchGetInputs = append(f.batchGetInputs, params)
+	f.mu.Unlock()
+	if f.batchGet == nil {
+		return &dynamodb.BatchGetItemOutput{}, nil
+	}
+	return f.batchGet(params)
+}
+
+func (f *fakeDynamoDB) BatchWriteItem(_ context.Context, params *dynamodb.BatchWriteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	f.mu.Lock()
+	f.batchInputs = append(f.batchInputs, params)
+	f.mu.Unlock()
+	if f.batchWrite == nil {
+		return &dynamodb.BatchWriteItemOutput{}, nil
+	}
+	return f.batchWrite(params)
+}
+
+func (f *fakeDynamoDB) TransactWriteItems(_ context.Context, params *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	f.mu.Lock()
+	f.transactInputs = append(f.transactInputs, params)
+	f.mu.Unlock()
+	if f.transact == nil {
+		return &dynamodb.TransactWriteItemsOutput{}, nil
+	}
+	return f.transact(params)
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+// MockDynamicUnitRepository is a mock implementation of DynamicUnitRepository for testing
+type MockDynamicUnitRepository struct {
+	mock.Mock
+}
+
+// Create mocks the Create method
+func (m *MockDynamicUnitRepository) Create(ctx context.Context, unit *models.DynamicUnit) error {
+	args := m.Called(ctx, unit)
+	return args.Error(0)
+}
+
+// GetByKey mocks the GetByKey method
+func (m *MockDynamicUnitRepository) GetByKey(ctx context.Context, accountID, unitID, unitType string) (*models.DynamicUnit, error) {
+	args := m.Called(ctx, accountID, unitID, unitType)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.DynamicUnit), args.Error(1)
+}
+
+// Update mocks the Update method
+func (m *MockDynamicUnitRepository) Update(ctx context.Context, unit *models.DynamicUnit) error {
+	args := m.Called(ctx, unit)
+	return args.Error(0)
+}
+
+// Delete mocks the Delete method
+func (m *MockDynamicUnitRepository) Delete(ctx context.Context, accountID, unitID, unitType string, expectedVersion int64) error {
+	args := m.Called(ctx, accountID, unitID, unitType, expectedVersion)
+	return args.Error(0)
+}
+
+// Restore mocks the Restore method
+func (m *MockDynamicUnitRepository) Restore(ctx context.Context, accountID, unitID, unitType string, expectedVersion int64) (*models.DynamicUnit, error) {
+	args := m.Called(ctx, accountID, unitID, unitType, expectedVersion)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.DynamicUnit), args.Error(1)
+}
+
+// Purge mocks the Purge method
+func (m *MockDynamicUnitRepository) Purge(ctx context.Context, accountID, unitID, unitType string) error {
+	args := m.Called(ctx, accountID, unitID, unitType)
+	return args.Error(0)
+}
+
+// List mocks the List method
+func (m *MockDynamicUnitRepository) List(ctx context.Context, input *appsync.ListUnitsInput) (*appsync.ListDynamicUnitsResponse, error) {
+	args := m.Called(ctx, input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*appsync.ListDynamicUnitsResponse), args.Error(1)
+}
+
+// ListDeleted mocks the ListDeleted method
+func (m *MockDynamicUnitRepository) ListDeleted(ctx context.Context, input *appsync.ListUnitsInput) (*appsync.ListDynamicUnitsResponse, error) {
+	args := m.Called(ctx, input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*appsync.ListDynamicUnitsResponse), args.Error(1)
+}
+
+// GetHistory mocks the GetHistory method
+func (m *MockDynamicUnitRepository) GetHistory(ctx context.Context, input *appsync.GetUnitHistoryInput) (*appsync.UnitHistoryResponse, error) {
+	args := m.Called(ctx, input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*appsync.UnitHistoryResponse), args.Error(1)
+}
+
+// GetAsOf mocks the GetAsOf method
+func (m *MockDynamicUnitRepository) GetAsOf(ctx context.Context, accountID, unitID, unitType string, asOf time.Time) (*models.DynamicUnit, error) {
+	args := m.Called(ctx, accountID, unitID, unitType, asOf)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.DynamicUnit), args.Error(1)
+}
+
+// Export mocks the Export method
+func (m *MockDynamicUnitRepository) Export(ctx context.Context, opts ExportOptions, w io.Writer) (*ExportResult, error) {
+	args := m.Called(ctx, opts, w)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*ExportResult), args.Error(1)
+}
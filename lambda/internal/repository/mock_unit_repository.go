@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	"io"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 
@@ -35,8 +37,32 @@ func (m *MockUnitRepository) Update(ctx context.Context, unit *models.Unit) erro
 	return args.Error(0)
 }
 
+// Patch mocks the Patch method
+func (m *MockUnitRepository) Patch(ctx context.Context, accountID, unitID, unitType string, expectedVersion int64, patch *models.UnitPatch) (*models.Unit, error) {
+	args := m.Called(ctx, accountID, unitID, unitType, expectedVersion, patch)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Unit), args.Error(1)
+}
+
 // Delete mocks the Delete method
-func (m *MockUnitRepository) Delete(ctx context.Context, accountID, unitID, unitType string) error {
+func (m *MockUnitRepository) Delete(ctx context.Context, accountID, unitID, unitType string, expectedVersion int64, deletedBy string) error {
+	args := m.Called(ctx, accountID, unitID, unitType, expectedVersion, deletedBy)
+	return args.Error(0)
+}
+
+// Restore mocks the Restore method
+func (m *MockUnitRepository) Restore(ctx context.Context, accountID, unitID, unitType string, expectedVersion int64) (*models.Unit, error) {
+	args := m.Called(ctx, accountID, unitID, unitType, expectedVersion)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Unit), args.Error(1)
+}
+
+// Purge mocks the Purge method
+func (m *MockUnitRepository) Purge(ctx context.Context, accountID, unitID, unitType string) error {
 	args := m.Called(ctx, accountID, unitID, unitType)
 	return args.Error(0)
 }
@@ -50,6 +76,15 @@ func (m *MockUnitRepository) List(ctx context.Context, input *appsync.ListUnitsI
 	return args.Get(0).(*appsync.ListUnitsResponse), args.Error(1)
 }
 
+// ListDeleted mocks the ListDeleted method
+func (m *MockUnitRepository) ListDeleted(ctx context.Context, input *appsync.ListUnitsInput) (*appsync.ListUnitsResponse, error) {
+	args := m.Called(ctx, input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*appsync.ListUnitsResponse), args.Error(1)
+}
+
 // Exists mocks the Exists method
 func (m *MockUnitRepository) Exists(ctx context.Context, accountID, unitID, unitType string) (bool, error) {
 	args := m.Called(ctx, accountID, unitID, unitType)
@@ -64,3 +99,86 @@ func (m *MockUnitRepository) GetByUnitID(ctx context.Context, unitID string) ([]
 	}
 	return args.Get(0).([]models.Unit), args.Error(1)
 }
+
+// GetByVin mocks the GetByVin method
+func (m *MockUnitRepository) GetByVin(ctx context.Context, accountID, vin string) (*models.Unit, error) {
+	args := m.Called(ctx, accountID, vin)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Unit), args.Error(1)
+}
+
+// SearchByVin mocks the SearchByVin method
+func (m *MockUnitRepository) SearchByVin(ctx context.Context, input *appsync.SearchUnitsByVinInput) (*appsync.ListUnitsResponse, error) {
+	args := m.Called(ctx, input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*appsync.ListUnitsResponse), args.Error(1)
+}
+
+// BatchGet mocks the BatchGet method
+func (m *MockUnitRepository) BatchGet(ctx context.Context, accountID string, keys []UnitKey) ([]*models.Unit, []error) {
+	args := m.Called(ctx, accountID, keys)
+	var units []*models.Unit
+	if args.Get(0) != nil {
+		units = args.Get(0).([]*models.Unit)
+	}
+	var errs []error
+	if args.Get(1) != nil {
+		errs = args.Get(1).([]error)
+	}
+	return units, errs
+}
+
+// BatchCreate mocks the BatchCreate method
+func (m *MockUnitRepository) BatchCreate(ctx context.Context, units []*models.Unit) []error {
+	args := m.Called(ctx, units)
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).([]error)
+}
+
+// BatchDelete mocks the BatchDelete method
+func (m *MockUnitRepository) BatchDelete(ctx context.Context, accountID string, keys []DeleteKey, deletedBy string) []error {
+	args := m.Called(ctx, accountID, keys, deletedBy)
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).([]error)
+}
+
+// TransactWrite mocks the TransactWrite method
+func (m *MockUnitRepository) TransactWrite(ctx context.Context, accountID string, ops []TransactOp, deletedBy string) error {
+	args := m.Called(ctx, accountID, ops, deletedBy)
+	return args.Error(0)
+}
+
+// Export mocks the Export method
+func (m *MockUnitRepository) Export(ctx context.Context, opts ExportOptions, w io.Writer) (*ExportResult, error) {
+	args := m.Called(ctx, opts, w)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*ExportResult), args.Error(1)
+}
+
+// GetAsOf mocks the GetAsOf method
+func (m *MockUnitRepository) GetAsOf(ctx context.Context, accountID, unitID, unitType string, asOf time.Time) (*models.Unit, error) {
+	args := m.Called(ctx, accountID, unitID, unitType, asOf)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Unit), args.Error(1)
+}
+
+// GetHistory mocks the GetHistory method
+func (m *MockUnitRepository) GetHistory(ctx context.Context, input *appsync.GetUnitHistoryInput) (*appsync.UnitHistoryResponse, error) {
+	args := m.Called(ctx, input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*appsync.UnitHistoryResponse), args.Error(1)
+}
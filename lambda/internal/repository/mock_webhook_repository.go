@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+// MockWebhookRepository is a mock implementation of WebhookRepository for testing
+type MockWebhookRepository struct {
+	mock.Mock
+}
+
+// Create mocks the Create method
+func (m *MockWebhookRepository) Create(ctx context.Context, subscription *models.WebhookSubscription) error {
+	args := m.Called(ctx, subscription)
+	return args.Error(0)
+}
+
+// Get mocks the Get method
+func (m *MockWebhookRepository) Get(ctx context.Context, accountID, subscriptionID string) (*models.WebhookSubscription, error) {
+	args := m.Called(ctx, accountID, subscriptionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.WebhookSubscription), args.Error(1)
+}
+
+// List mocks the List method
+func (m *MockWebhookRepository) List(ctx context.Context, input *appsync.ListWebhookSubscriptionsInput) (*appsync.ListWebhookSubscriptionsResponse, error) {
+	args := m.Called(ctx, input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*appsync.ListWebhookSubscriptionsResponse), args.Error(1)
+}
+
+// ListActive mocks the ListActive method
+func (m *MockWebhookRepository) ListActive(ctx context.Context, accountID string) ([]models.WebhookSubscription, error) {
+	args := m.Called(ctx, accountID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.WebhookSubscription), args.Error(1)
+}
+
+// Update mocks the Update method
+func (m *MockWebhookRepository) Update(ctx context.Context, accountID, subscriptionID string, patch *models.WebhookSubscriptionPatch) (*models.WebhookSubscription, error) {
+	args := m.Called(ctx, accountID, subscriptionID, patch)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.WebhookSubscription), args.Error(1)
+}
+
+// Delete mocks the Delete method
+func (m *MockWebhookRepository) Delete(ctx context.Context, accountID, subscriptionID string) error {
+	args := m.Called(ctx, accountID, subscriptionID)
+	return args.Error(0)
+}
+
+// RecordDelivery mocks the RecordDelivery method
+func (m *MockWebhookRepository) RecordDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	args := m.Called(ctx, delivery)
+	return args.Error(0)
+}
+
+// ListDeliveries mocks the ListDeliveries method
+func (m *MockWebhookRepository) ListDeliveries(ctx context.Context, input *appsync.ListWebhookDeliveriesInput) (*appsync.ListWebhookDeliveriesResponse, error) {
+	args := m.Called(ctx, input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*appsync.ListWebhookDeliveriesResponse), args.Error(1)
+}
+
+// RecordSuccess mocks the RecordSuccess method
+func (m *MockWebhookRepository) RecordSuccess(ctx context.Context, accountID, subscriptionID string, at time.Time) error {
+	args := m.Called(ctx, accountID, subscriptionID, at)
+	return args.Error(0)
+}
+
+// RecordFailure mocks the RecordFailure method
+func (m *MockWebhookRepository) RecordFailure(ctx context.Context, accountID, subscriptionID string, at time.Time, disableAfter int) (*models.WebhookSubscription, error) {
+	args := m.Called(ctx, accountID, subscriptionID, at, disableAfter)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.WebhookSubscription), args.Error(1)
+}
@@ -0,0 +1,217 @@
+package repository
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+// DefaultPaginationTokenTTL is how long a pagination token stays valid
+const DefaultPaginationTokenTTL = time.Hour
+
+// ErrInvalidPaginationToken is returned when a nextToken is malformed, tampered with,
+// expired, or presented for a different account or filter than it was issued for
+var ErrInvalidPaginationToken = errors.New("invalid pagination token")
+
+// PaginationTokenSigner issues and verifies HMAC-signed pagination tokens. A token
+// carries the DynamoDB LastEvaluatedKey together with the account and filter it was
+// issued for and an expiry, so a caller cannot forge a token that starts a query
+// in another account's partition or at an arbitrary sort key.
+type PaginationTokenSigner struct {
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewPaginationTokenSigner creates a signer using key for the HMAC. An empty key is
+// replaced by a random one, which only verifies tokens issued by the same process.
+// A non-positive ttl uses DefaultPaginationTokenTTL.
+func NewPaginationTokenSigner(key []byte, ttl time.Duration) *PaginationTokenSigner {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic(fmt.Sprintf("failed to generate pagination token key: %v", err))
+		}
+	}
+	if ttl <= 0 {
+		ttl = DefaultPaginationTokenTTL
+	}
+	return &PaginationTokenSigner{
+		key: key,
+		ttl: ttl,
+		now: time.Now,
+	}
+}
+
+// paginationScope identifies the listing a token belongs to
+type paginationScope struct {
+	accountID  string
+	filterHash string
+}
+
+// listScope returns the scope of a list request: its account plus a hash of
+// everything else that shapes the query (unit type, filter and deleted state)
+func listScope(input *appsync.ListUnitsInput, deletedFilter string) paginationScope {
+	var unitType, rawFilter string
+	if input.UnitType != nil {
+		unitType = *input.UnitType
+	}
+	if input.Filter != nil {
+		rawFilter = *input.Filter
+	}
+
+	return paginationScope{
+		accountID:  input.AccountID,
+		filterHash: scopeHash(unitType, rawFilter, deletedFilter),
+	}
+}
+
+// vinSearchScope returns the scope of a VIN prefix search
+func vinSearchScope(accountID, prefix string) paginationScope {
+	return paginationScope{
+		accountID:  accountID,
+		filterHash: scopeHash("vin", prefix),
+	}
+}
+
+// historyScope returns the scope of a unit's history
+func historyScope(accountID, unitID, unitType string) paginationScope {
+	return paginationScope{
+		accountID:  accountID,
+		filterHash: scopeHash("history", unitID, unitType),
+	}
+}
+
+// webhookSubscriptionScope returns the scope of an account's webhook subscriptions
+func webhookSubscriptionScope(accountID string) paginationScope {
+	return paginationScope{
+		accountID:  accountID,
+		filterHash: scopeHash("webhook"),
+	}
+}
+
+// webhookDeliveryScope returns the scope of a webhook subscription's delivery attempts
+func webhookDeliveryScope(accountID, subscriptionID string) paginationScope {
+	return paginationScope{
+		accountID:  accountID,
+		filterHash: scopeHash("webhookDelivery", subscriptionID),
+	}
+}
+
+// scopeHash returns a short, stable hash of the parts that shape a query
+func scopeHash(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+// tokenPayload is the signed content of a pagination token
+type tokenPayload struct {
+	Key        map[string]tokenAttribute `json:"k"`
+	AccountID  string                    `json:"a"`
+	FilterHash string                    `json:"f"`
+	ExpiresAt  int64                     `json:"e"`
+}
+
+// tokenAttribute is a key attribute value with its DynamoDB type preserved
+type tokenAttribute struct {
+	S *string `json:"S,omitempty"`
+	N *string `json:"N,omitempty"`
+}
+
+// encode signs lastKey for the given scope. A nil lastKey yields an empty token.
+func (s *PaginationTokenSigner) encode(lastKey map[string]types.AttributeValue, scope paginationScope) (string, error) {
+	if lastKey == nil {
+		return "", nil
+	}
+
+	payload := tokenPayload{
+		Key:        make(map[string]tokenAttribute, len(lastKey)),
+		AccountID:  scope.accountID,
+		FilterHash: scope.filterHash,
+		ExpiresAt:  s.now().Add(s.ttl).Unix(),
+	}
+	for name, value := range lastKey {
+		switch v := value.(type) {
+		case *types.AttributeValueMemberS:
+			payload.Key[name] = tokenAttribute{S: &v.Value}
+		case *types.AttributeValueMemberN:
+			payload.Key[name] = tokenAttribute{N: &v.Value}
+		default:
+			return "", fmt.Errorf("unsupported key attribute type %T for %s", value, name)
+		}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal token data: %w", err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(body)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.sign(encoded)), nil
+}
+
+// decode verifies a token against the scope of the current request and returns the
+// ExclusiveStartKey it carries. An empty token yields a nil key.
+func (s *PaginationTokenSigner) decode(token string, scope paginationScope) (map[string]types.AttributeValue, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidPaginationToken)
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, s.sign(encoded)) {
+		return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidPaginationToken)
+	}
+
+	body, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidPaginationToken)
+	}
+	var payload tokenPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidPaginationToken)
+	}
+
+	switch {
+	case s.now().Unix() > payload.ExpiresAt:
+		return nil, fmt.Errorf("%w: token expired", ErrInvalidPaginationToken)
+	case payload.AccountID != scope.accountID:
+		return nil, fmt.Errorf("%w: token was issued for a different account", ErrInvalidPaginationToken)
+	case payload.FilterHash != scope.filterHash:
+		return nil, fmt.Errorf("%w: token was issued for a different filter", ErrInvalidPaginationToken)
+	}
+
+	lastKey := make(map[string]types.AttributeValue, len(payload.Key))
+	for name, value := range payload.Key {
+		switch {
+		case value.S != nil:
+			lastKey[name] = &types.AttributeValueMemberS{Value: *value.S}
+		case value.N != nil:
+			lastKey[name] = &types.AttributeValueMemberN{Value: *value.N}
+		default:
+			return nil, fmt.Errorf("%w: malformed key attribute %s", ErrInvalidPaginationToken, name)
+		}
+	}
+
+	return lastKey, nil
+}
+
+// sign returns the HMAC-SHA256 of the encoded payload
+func (s *PaginationTokenSigner) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+var tokenTestKey = map[string]types.AttributeValue{
+	"pk": &types.AttributeValueMemberS{Value: "account-1"},
+	"sk": &types.AttributeValueMemberS{Value: "unit-1#commercialVehicleType"},
+}
+
+func TestPaginationTokenSigner_Rejects(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	signer := NewPaginationTokenSigner([]byte("test-key"), time.Hour)
+	signer.now = func() time.Time { return now }
+
+	scope := listScope(&appsync.ListUnitsInput{AccountID: "account-1"}, "live")
+	token, err := signer.encode(tokenTestKey, scope)
+	require.NoError(t, err)
+
+	decoded, err := signer.decode(token, scope)
+	require.NoError(t, err)
+	assert.Equal(t, tokenTestKey, decoded)
+
+	payload, signature, _ := strings.Cut(token, ".")
+	filter := `{"field":"make","op":"eq","value":"Ford"}`
+
+	tests := []struct {
+		name    string
+		token   string
+		scope   paginationScope
+		now     time.Time
+		wantErr string
+	}{
+		{name: "tampered payload", token: "x" + payload[1:] + "." + signature, scope: scope, now: now, wantErr: "signature mismatch"},
+		{name: "missing signature", token: payload, scope: scope, now: now, wantErr: "malformed token"},
+		{name: "other key", token: mustEncode(t, NewPaginationTokenSigner([]byte("other-key"), time.Hour), scope), scope: scope, now: now, wantErr: "signature mismatch"},
+		{name: "expired", token: token, scope: scope, now: now.Add(time.Hour + time.Second), wantErr: "token expired"},
+		{name: "other account", token: token, scope: listScope(&appsync.ListUnitsInput{AccountID: "account-2"}, "live"), now: now, wantErr: "different account"},
+		{name: "other filter", token: token, scope: listScope(&appsync.ListUnitsInput{AccountID: "account-1", Filter: &filter}, "live"), now: now, wantErr: "different filter"},
+		{name: "deleted listing", token: token, scope: listScope(&appsync.ListUnitsInput{AccountID: "account-1"}, "deleted"), now: now, wantErr: "different filter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer.now = func() time.Time { return tt.now }
+
+			_, err := signer.decode(tt.token, tt.scope)
+			require.Error(t, err)
+			assert.ErrorIs(t, err, ErrInvalidPaginationToken)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func mustEncode(t *testing.T, signer *PaginationTokenSigner, scope paginationScope) string {
+	token, err := signer.encode(tokenTestKey, scope)
+	require.NoError(t, err)
+	return token
+}
+
+func TestDynamoDBUnitRepository_ListRejectsForeignToken(t *testing.T) {
+	signer := NewPaginationTokenSigner([]byte("shared-key"), time.Hour)
+	client := &fakeDynamoDB{
+		query: func(*dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+			return &dynamodb.QueryOutput{LastEvaluatedKey: tokenTestKey}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units").WithPaginationTokenSigner(signer)
+
+	page, err := repo.List(context.Background(), &appsync.ListUnitsInput{AccountID: "account-1"})
+	require.NoError(t, err)
+	require.NotNil(t, page.NextToken)
+
+	// A token issued to one account cannot be replayed against another
+	_, err = repo.List(context.Background(), &appsync.ListUnitsInput{AccountID: "account-2", NextToken: page.NextToken})
+	assert.ErrorIs(t, err, ErrInvalidPaginationToken)
+
+	// Nor can a live listing token page through deleted units
+	_, err = repo.ListDeleted(context.Background(), &appsync.ListUnitsInput{AccountID: "account-1", NextToken: page.NextToken})
+	assert.ErrorIs(t, err, ErrInvalidPaginationToken)
+}
@@ -0,0 +1,250 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+)
+
+// batchWriteConcurrency bounds how many single-unit writes BatchCreate and
+// BatchDelete have in flight
+const batchWriteConcurrency = 10
+
+// UnitKey identifies a unit within an account
+type UnitKey struct {
+	ID       string
+	UnitType string
+}
+
+// DeleteKey identifies a unit to soft delete and the version the caller read
+type DeleteKey struct {
+	UnitKey
+	ExpectedVersion int64
+}
+
+// BatchGet retrieves units of an account with BatchGetItem. It returns one unit
+// and one error per key: the unit is nil where there is no live unit with the
+// key, and the error is set where the key could not be read. A key repeated in
+// keys is read once.
+func (r *DynamoDBUnitRepository) BatchGet(ctx context.Context, accountID string, keys []UnitKey) ([]*models.Unit, []error) {
+	units := make([]*models.Unit, len(keys))
+	errs := make([]error, len(keys))
+	if accountID == "" {
+		for i := range errs {
+			errs[i] = errors.New("accountID is required")
+		}
+		return units, errs
+	}
+
+	// BatchGetItem rejects repeated keys, so each distinct key is requested once
+	var itemKeys []map[string]types.AttributeValue
+	var distinct []string
+	positions := make(map[string][]int, len(keys))
+	for i, key := range keys {
+		if key.ID == "" {
+			errs[i] = errors.New("unitID is required")
+			continue
+		}
+		if key.UnitType == "" {
+			errs[i] = errors.New("unitType is required")
+			continue
+		}
+		id := key.ID + "#" + key.UnitType
+		if _, ok := positions[id]; !ok {
+			itemKeys = append(itemKeys, (&models.Unit{AccountID: accountID, ID: key.ID, UnitType: key.UnitType}).GetKey())
+			distinct = append(distinct, id)
+		}
+		positions[id] = append(positions[id], i)
+	}
+
+	items, itemErrs := batchGetItems(ctx, r.client, r.tableName, itemKeys, false)
+	for j, id := range distinct {
+		var unit *models.Unit
+		err := itemErrs[j]
+		if err == nil && items[j] != nil {
+			unit = &models.Unit{}
+			if err = attributevalue.UnmarshalMap(items[j], unit); err != nil {
+				err = fmt.Errorf("failed to unmarshal unit: %w", err)
+			}
+		}
+
+		for _, i := range positions[id] {
+			switch {
+			case err != nil:
+				errs[i] = err
+			case unit != nil && !unit.IsDeleted():
+				found := *unit
+				units[i] = &found
+			}
+		}
+	}
+
+	return units, errs
+}
+
+// BatchCreate creates new units and returns one error per unit, nil where the
+// unit was created. Every unit is given a new ID, so a batch never overwrites an
+// existing unit.
+//
+// BatchWriteItem has no condition expressions and no transactions, so only units
+// without a VIN are written with it, and only when their creation is not recorded.
+// Every other unit is written as Create writes it, in one transaction with the
+// reservation of its VIN and its history and outbox items, up to
+// batchWriteConcurrency at a time.
+func (r *DynamoDBUnitRepository) BatchCreate(ctx context.Context, units []*models.Unit) []error {
+	errs := make([]error, len(units))
+	vins := make(map[string]int, len(units))
+
+	var pending []map[string]types.AttributeValue
+	var written []int
+	slots := make(chan struct{}, batchWriteConcurrency)
+	var wg sync.WaitGroup
+	for i, unit := range units {
+		item, err := prepareBatchUnit(unit)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		if unit.Vin != "" {
+			if first, ok := vins[unit.Vin]; ok {
+				errs[i] = &DuplicateVinError{Vin: unit.Vin, UnitID: units[first].ID}
+				continue
+			}
+			vins[unit.Vin] = i
+		}
+
+		if unit.Vin == "" && !r.recording() {
+			pending = append(pending, item)
+			written = append(written, i)
+			continue
+		}
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, unit *models.Unit, item map[string]types.AttributeValue) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			errs[i] = r.createItem(ctx, unit, item)
+		}(i, unit, item)
+	}
+
+	for j, err := range batchPutItems(ctx, r.client, r.tableName, pending) {
+		if err != nil {
+			errs[written[j]] = fmt.Errorf("failed to create unit: %w", err)
+		}
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	log.Printf("Created %d of %d units", len(units)-failed, len(units))
+
+	return errs
+}
+
+// BatchDelete soft deletes units of an account, each at its expected version, and
+// returns one error per key, nil where the unit was deleted. BatchWriteItem can
+// only put or remove whole items without conditions, so each unit is soft deleted
+// with Delete's conditional UpdateItem, up to batchWriteConcurrency at a time.
+func (r *DynamoDBUnitRepository) BatchDelete(ctx context.Context, accountID string, keys []DeleteKey, deletedBy string) []error {
+	errs := make([]error, len(keys))
+	slots := make(chan struct{}, batchWriteConcurrency)
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, key DeleteKey) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			errs[i] = r.Delete(ctx, accountID, key.ID, key.UnitType, key.ExpectedVersion, deletedBy)
+		}(i, key)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	log.Printf("Deleted %d of %d units", len(keys)-failed, len(keys))
+
+	return errs
+}
+
+// prepareBatchUnit sets the generated fields of a unit to batch create, as Create does,
+// and marshals it
+func prepareBatchUnit(unit *models.Unit) (map[string]types.AttributeValue, error) {
+	if unit == nil {
+		return nil, errors.New("unit cannot be nil")
+	}
+	if unit.AccountID == "" {
+		return nil, errors.New("accountID is required")
+	}
+	if unit.UnitType == "" {
+		return nil, errors.New("unitType is required")
+	}
+
+	unit.GenerateID()
+	unit.SetTimestamps()
+	unit.Version = 1
+	unit.ClearDeletion()
+	unit.SortKey = unit.GetSortKey()
+	unit.SetVin()
+
+	item, err := attributevalue.MarshalMap(unit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal unit: %w", err)
+	}
+	return item, nil
+}
+
+// vinHolder is the unit named by a VIN reservation
+type vinHolder struct {
+	Vin      string `dynamodbav:"sk"`
+	UnitID   string `dynamodbav:"unitId"`
+	UnitType string `dynamodbav:"unitType"`
+}
+
+// staleVinReservation reads the reservation of vin in an account. It returns nil
+// when the VIN is not reserved, the holder of a reservation that no unit holds any
+// more, and a DuplicateVinError when a unit still holds the VIN.
+func (r *DynamoDBUnitRepository) staleVinReservation(ctx context.Context, accountID, vin string) (*vinHolder, error) {
+	output, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(r.tableName),
+		Key:            vinGuardKey(accountID, vin),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to check VIN reservation: %w", err)
+	}
+	if output.Item == nil {
+		return nil, nil
+	}
+
+	var holder vinHolder
+	if err := attributevalue.UnmarshalMap(output.Item, &holder); err != nil {
+		return nil, fmt.Errorf("failed to read VIN reservation: %w", err)
+	}
+
+	held, err := r.holdsVin(ctx, accountID, holder.UnitID, holder.UnitType, vin)
+	if err != nil {
+		return nil, err
+	}
+	if held {
+		return nil, &DuplicateVinError{Vin: vin, UnitID: holder.UnitID}
+	}
+	return &holder, nil
+}
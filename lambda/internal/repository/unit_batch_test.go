@@ -0,0 +1,359 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+)
+
+func init() {
+	batchRetryBaseDelay = 0
+}
+
+func batchTestUnits(n int) []*models.Unit {
+	units := make([]*models.Unit, n)
+	for i := range units {
+		units[i] = &models.Unit{
+			AccountID: "account-1",
+			UnitType:  "commercialVehicleType",
+			Make:      "Mack",
+			Model:     fmt.Sprintf("Model %d", i),
+		}
+	}
+	return units
+}
+
+func TestDynamoDBUnitRepository_BatchCreateChunks(t *testing.T) {
+	client := &fakeDynamoDB{}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	units := batchTestUnits(60)
+	errs := repo.BatchCreate(context.Background(), units)
+
+	require.Len(t, errs, 60)
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+	require.Len(t, client.batchInputs, 3)
+	assert.Len(t, client.batchInputs[0].RequestItems["units"], 25)
+	assert.Len(t, client.batchInputs[1].RequestItems["units"], 25)
+	assert.Len(t, client.batchInputs[2].RequestItems["units"], 10)
+
+	for _, unit := range units {
+		assert.NotEmpty(t, unit.ID)
+		assert.Equal(t, int64(1), unit.Version)
+		assert.Equal(t, unit.ID+"#commercialVehicleType", unit.SortKey)
+	}
+}
+
+func TestDynamoDBUnitRepository_BatchCreateRetriesUnprocessed(t *testing.T) {
+	calls := 0
+	client := &fakeDynamoDB{}
+	client.batchWrite = func(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+		calls++
+		requests := input.RequestItems["units"]
+		if calls == 1 {
+			// Throttle all but the first item
+			return &dynamodb.BatchWriteItemOutput{
+				UnprocessedItems: map[string][]types.WriteRequest{"units": requests[1:]},
+			}, nil
+		}
+		return &dynamodb.BatchWriteItemOutput{}, nil
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	errs := repo.BatchCreate(context.Background(), batchTestUnits(3))
+
+	assert.Equal(t, []error{nil, nil, nil}, errs)
+	require.Len(t, client.batchInputs, 2)
+	assert.Len(t, client.batchInputs[1].RequestItems["units"], 2)
+}
+
+func TestDynamoDBUnitRepository_BatchCreateGivesUpOnUnprocessed(t *testing.T) {
+	client := &fakeDynamoDB{}
+	client.batchWrite = func(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+		// The last item is never processed
+		requests := input.RequestItems["units"]
+		return &dynamodb.BatchWriteItemOutput{
+			UnprocessedItems: map[string][]types.WriteRequest{"units": requests[len(requests)-1:]},
+		}, nil
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	errs := repo.BatchCreate(context.Background(), batchTestUnits(2))
+
+	require.Len(t, errs, 2)
+	assert.NoError(t, errs[0])
+	assert.EqualError(t, errs[1], "failed to create unit: item still unprocessed after 5 attempts")
+	assert.Len(t, client.batchInputs, batchMaxAttempts)
+}
+
+func TestDynamoDBUnitRepository_BatchCreateBatchError(t *testing.T) {
+	client := &fakeDynamoDB{}
+	client.batchWrite = func(*dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+		return nil, errors.New("boom")
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	units := batchTestUnits(2)
+	units[1].UnitType = ""
+	errs := repo.BatchCreate(context.Background(), units)
+
+	require.Len(t, errs, 2)
+	assert.EqualError(t, errs[0], "failed to create unit: failed to write item: boom")
+	assert.EqualError(t, errs[1], "unitType is required")
+}
+
+func TestDynamoDBUnitRepository_BatchCreateReservesVins(t *testing.T) {
+	client := &fakeDynamoDB{
+		transact: func(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+			// Reserved, after any check could have seen it free, by a unit that holds it
+			if input.TransactItems[1].Put.Item["sk"].(*types.AttributeValueMemberS).Value == "1M1AN07Y9GM012345" {
+				return nil, vinReservationCanceled("unit-1")
+			}
+			return &dynamodb.TransactWriteItemsOutput{}, nil
+		},
+		getItem: func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			if input.Key["sk"].(*types.AttributeValueMemberS).Value == "unit-1#commercialVehicleType" {
+				return &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{
+					"suggestedVin": &types.AttributeValueMemberS{Value: "1M1AN07Y9GM012345"},
+				}}, nil
+			}
+			return &dynamodb.GetItemOutput{}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	units := batchTestUnits(4)
+	units[0].SuggestedVin = "1hgbh41jxmn109186"
+	units[1].SuggestedVin = "1HGBH41JXMN109186"
+	units[2].SuggestedVin = "1M1AN07Y9GM012345"
+	errs := repo.BatchCreate(context.Background(), units)
+
+	require.Len(t, errs, 4)
+	assert.NoError(t, errs[0])
+	var duplicate *DuplicateVinError
+	require.ErrorAs(t, errs[1], &duplicate)
+	assert.Equal(t, units[0].ID, duplicate.UnitID)
+	require.ErrorAs(t, errs[2], &duplicate)
+	assert.Equal(t, "unit-1", duplicate.UnitID)
+	assert.NoError(t, errs[3])
+
+	// Each unit with a VIN is written with a conditional reservation in its own
+	// transaction; the unit without one is batch written
+	require.Len(t, client.transactInputs, 2)
+	for _, input := range client.transactInputs {
+		require.Len(t, input.TransactItems, 2)
+		guard := input.TransactItems[1].Put
+		assert.Equal(t, &types.AttributeValueMemberS{Value: "VIN#account-1"}, guard.Item["pk"])
+		assert.Equal(t, "attribute_not_exists(pk)", *guard.ConditionExpression)
+		assert.Equal(t, input.TransactItems[0].Put.Item["id"], guard.Item["unitId"])
+	}
+	require.Len(t, client.batchInputs, 1)
+	require.Len(t, client.batchInputs[0].RequestItems["units"], 1)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: units[3].ID}, client.batchInputs[0].RequestItems["units"][0].PutRequest.Item["id"])
+}
+
+func TestDynamoDBUnitRepository_BatchCreateReportsFailedTransactions(t *testing.T) {
+	client := &fakeDynamoDB{
+		transact: func(*dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+			return nil, errors.New("throttled")
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	units := batchTestUnits(2)
+	units[0].SuggestedVin = "1HGBH41JXMN109186"
+	errs := repo.BatchCreate(context.Background(), units)
+
+	require.Len(t, errs, 2)
+	assert.EqualError(t, errs[0], "failed to create unit: throttled")
+	assert.NoError(t, errs[1])
+}
+
+func TestDynamoDBUnitRepository_BatchCreateRecordsEachUnitAtomically(t *testing.T) {
+	client := &fakeDynamoDB{}
+	client.transact = func(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+		if input.TransactItems[0].Put.Item["model"].(*types.AttributeValueMemberS).Value == "Model 1" {
+			return nil, errors.New("throttled")
+		}
+		return &dynamodb.TransactWriteItemsOutput{}, nil
+	}
+	repo := NewDynamoDBUnitRepository(client, "units").WithHistory(true).WithOutbox(true)
+
+	units := batchTestUnits(2)
+	errs := repo.BatchCreate(context.Background(), units)
+
+	// A unit whose history or event cannot be written is not created either
+	require.Len(t, errs, 2)
+	assert.NoError(t, errs[0])
+	assert.EqualError(t, errs[1], "failed to create unit: throttled")
+	assert.Empty(t, client.batchInputs)
+
+	require.Len(t, client.transactInputs, 2)
+	for _, input := range client.transactInputs {
+		require.Len(t, input.TransactItems, 3)
+		id := input.TransactItems[0].Put.Item["id"].(*types.AttributeValueMemberS).Value
+		assert.True(t, strings.HasPrefix(input.TransactItems[1].Put.Item["sk"].(*types.AttributeValueMemberS).Value, id+"#commercialVehicleType#HIST#"))
+		assert.True(t, isOutboxItem(input.TransactItems[2].Put.Item))
+	}
+}
+
+// batchGetResponder returns a stored item for each requested key that has one
+func batchGetResponder(stored map[string]map[string]types.AttributeValue) func(*dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+	return func(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+		var items []map[string]types.AttributeValue
+		for _, key := range input.RequestItems["units"].Keys {
+			if item, ok := stored[key["sk"].(*types.AttributeValueMemberS).Value]; ok {
+				items = append(items, item)
+			}
+		}
+		return &dynamodb.BatchGetItemOutput{Responses: map[string][]map[string]types.AttributeValue{"units": items}}, nil
+	}
+}
+
+func TestDynamoDBUnitRepository_BatchGet(t *testing.T) {
+	stored := map[string]map[string]types.AttributeValue{
+		"unit-1#commercialVehicleType": mustMarshalItem(t, map[string]interface{}{
+			"pk": "account-1", "sk": "unit-1#commercialVehicleType", "id": "unit-1", "unitType": "commercialVehicleType", "make": "Mack",
+		}),
+		"unit-2#commercialVehicleType": mustMarshalItem(t, map[string]interface{}{
+			"pk": "account-1", "sk": "unit-2#commercialVehicleType", "id": "unit-2", "unitType": "commercialVehicleType", "deletedAt": 100,
+		}),
+	}
+	client := &fakeDynamoDB{batchGet: batchGetResponder(stored)}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	units, errs := repo.BatchGet(context.Background(), "account-1", []UnitKey{
+		{ID: "unit-1", UnitType: "commercialVehicleType"},
+		{ID: "unit-2", UnitType: "commercialVehicleType"},
+		{ID: "unit-3", UnitType: "commercialVehicleType"},
+		{ID: "", UnitType: "commercialVehicleType"},
+		{ID: "unit-1", UnitType: "commercialVehicleType"},
+	})
+
+	require.Len(t, units, 5)
+	require.Len(t, errs, 5)
+	require.NotNil(t, units[0])
+	assert.Equal(t, "Mack", units[0].Make)
+	assert.Nil(t, units[1], "soft deleted units are not returned")
+	assert.Nil(t, units[2])
+	assert.EqualError(t, errs[3], "unitID is required")
+	require.NotNil(t, units[4])
+	assert.Equal(t, "unit-1", units[4].ID)
+	assert.NotSame(t, units[0], units[4])
+	assert.Equal(t, []error{nil, nil, nil, errs[3], nil}, errs)
+
+	// Repeated keys are requested once
+	require.Len(t, client.batchGetInputs, 1)
+	assert.Len(t, client.batchGetInputs[0].RequestItems["units"].Keys, 3)
+}
+
+func TestDynamoDBUnitRepository_BatchGetChunksAndRetriesUnprocessed(t *testing.T) {
+	stored := make(map[string]map[string]types.AttributeValue)
+	keys := make([]UnitKey, 150)
+	for i := range keys {
+		id := fmt.Sprintf("unit-%d", i)
+		keys[i] = UnitKey{ID: id, UnitType: "commercialVehicleType"}
+		stored[id+"#commercialVehicleType"] = mustMarshalItem(t, map[string]interface{}{
+			"pk": "account-1", "sk": id + "#commercialVehicleType", "id": id, "unitType": "commercialVehicleType",
+		})
+	}
+
+	respond := batchGetResponder(stored)
+	client := &fakeDynamoDB{}
+	client.batchGet = func(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+		requested := input.RequestItems["units"].Keys
+		if len(client.batchGetInputs) == 1 {
+			// Throttle the last ten keys of the first chunk
+			output, err := respond(&dynamodb.BatchGetItemInput{RequestItems: map[string]types.KeysAndAttributes{
+				"units": {Keys: requested[:len(requested)-10]},
+			}})
+			output.UnprocessedKeys = map[string]types.KeysAndAttributes{"units": {Keys: requested[len(requested)-10:]}}
+			return output, err
+		}
+		return respond(input)
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	units, errs := repo.BatchGet(context.Background(), "account-1", keys)
+
+	for i := range keys {
+		require.NoError(t, errs[i])
+		require.NotNil(t, units[i])
+		assert.Equal(t, keys[i].ID, units[i].ID)
+	}
+	require.Len(t, client.batchGetInputs, 3)
+	assert.Len(t, client.batchGetInputs[0].RequestItems["units"].Keys, BatchGetChunkSize)
+	assert.Len(t, client.batchGetInputs[1].RequestItems["units"].Keys, 10)
+	assert.Len(t, client.batchGetInputs[2].RequestItems["units"].Keys, 50)
+}
+
+func TestDynamoDBUnitRepository_BatchGetErrors(t *testing.T) {
+	client := &fakeDynamoDB{}
+	client.batchGet = func(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+		if len(client.batchGetInputs) == 1 {
+			return nil, errors.New("boom")
+		}
+		// Every key stays unprocessed
+		return &dynamodb.BatchGetItemOutput{UnprocessedKeys: input.RequestItems}, nil
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+	keys := []UnitKey{{ID: "unit-1", UnitType: "commercialVehicleType"}}
+
+	_, errs := repo.BatchGet(context.Background(), "account-1", keys)
+	assert.EqualError(t, errs[0], "failed to read item: boom")
+
+	_, errs = repo.BatchGet(context.Background(), "account-1", keys)
+	assert.EqualError(t, errs[0], "key still unprocessed after 5 attempts")
+	assert.Len(t, client.batchGetInputs, 1+batchMaxAttempts)
+
+	_, errs = repo.BatchGet(context.Background(), "", keys)
+	assert.EqualError(t, errs[0], "accountID is required")
+}
+
+func TestDynamoDBUnitRepository_BatchDelete(t *testing.T) {
+	deleted := mustMarshalItem(t, map[string]interface{}{
+		"pk": "account-1", "sk": "unit-2#commercialVehicleType", "id": "unit-2", "unitType": "commercialVehicleType", "deletedAt": 100, "version": 3,
+	})
+	client := &fakeDynamoDB{
+		updateItem: func(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+			switch input.Key["sk"].(*types.AttributeValueMemberS).Value {
+			case "unit-2#commercialVehicleType":
+				return nil, &types.ConditionalCheckFailedException{Item: deleted}
+			case "unit-3#commercialVehicleType":
+				return nil, &types.ConditionalCheckFailedException{}
+			}
+			return &dynamodb.UpdateItemOutput{}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	keys := make([]DeleteKey, 25)
+	for i := range keys {
+		keys[i] = DeleteKey{UnitKey: UnitKey{ID: fmt.Sprintf("unit-%d", i), UnitType: "commercialVehicleType"}, ExpectedVersion: 1}
+	}
+	errs := repo.BatchDelete(context.Background(), "account-1", keys, "user-1")
+
+	require.Len(t, errs, 25)
+	assert.ErrorIs(t, errs[2], ErrUnitAlreadyDeleted)
+	assert.ErrorIs(t, errs[3], ErrUnitNotFound)
+	for i, err := range errs {
+		if i != 2 && i != 3 {
+			assert.NoError(t, err)
+		}
+	}
+	assert.Len(t, client.updateInputs, 25)
+	for _, input := range client.updateInputs {
+		assert.Equal(t, &types.AttributeValueMemberS{Value: "user-1"}, input.ExpressionAttributeValues[":deletedBy"])
+	}
+}
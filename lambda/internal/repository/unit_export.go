@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/steverhoton/unt-units-svc/internal/exporter"
+	"github.com/steverhoton/unt-units-svc/internal/models"
+)
+
+// ExportOptions controls an export of an account's units
+type ExportOptions struct {
+	// AccountID is the account whose units are exported
+	AccountID string
+	// UnitType restricts the export to one unit type. Schema-driven units are
+	// exported one unit type at a time, so it is required for them.
+	UnitType string
+	// Format is the encoding written
+	Format exporter.Format
+	// ExcludeFields are left out of the export, such as fields the caller may not read
+	ExcludeFields []string
+	// PageSize is the DynamoDB page size for each Query call
+	PageSize int32
+}
+
+// ExportResult summarizes an export
+type ExportResult struct {
+	Count int `json:"count"`
+}
+
+// exportPageSize is the default DynamoDB page size of an export
+const exportPageSize = 100
+
+// Export writes every live unit of an account to w, reading the account's
+// partition page by page so the whole account is never held in memory
+func (r *DynamoDBUnitRepository) Export(ctx context.Context, opts ExportOptions, w io.Writer) (*ExportResult, error) {
+	if opts.AccountID == "" {
+		return nil, errors.New("accountID is required")
+	}
+
+	columns := exporter.Without(exporter.UnitColumns(), opts.ExcludeFields)
+	encoder, err := exporter.NewEncoder(w, opts.Format, columns)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ExportResult{}
+	err = queryLiveUnits(ctx, r.client, r.tableName, opts, "", func(item map[string]types.AttributeValue) error {
+		var unit models.Unit
+		if err := attributevalue.UnmarshalMap(item, &unit); err != nil {
+			return fmt.Errorf("failed to unmarshal unit: %w", err)
+		}
+		// The partition also holds schema-driven units (sk = unitType#id)
+		if sk, ok := item["sk"].(*types.AttributeValueMemberS); !ok || sk.Value != unit.GetSortKey() {
+			return nil
+		}
+
+		record, err := exporter.UnitRecord(&unit)
+		if err != nil {
+			return err
+		}
+		if err := encoder.Encode(record); err != nil {
+			return fmt.Errorf("failed to write unit %s: %w", unit.ID, err)
+		}
+		result.Count++
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	if err := encoder.Close(); err != nil {
+		return result, fmt.Errorf("failed to finish export: %w", err)
+	}
+	return result, nil
+}
+
+// Export writes every live unit of one unit type in an account to w. Units are
+// upgraded to the latest schema version and exported with a column for each of
+// its top-level properties.
+func (r *DynamoDBDynamicUnitRepository) Export(ctx context.Context, opts ExportOptions, w io.Writer) (*ExportResult, error) {
+	if opts.AccountID == "" {
+		return nil, errors.New("accountID is required")
+	}
+	if opts.UnitType == "" {
+		return nil, errors.New("unitType is required")
+	}
+	if r.migrator == nil {
+		return nil, errors.New("export requires a schema migrator")
+	}
+
+	schema, err := r.migrator.LatestSchema(opts.UnitType)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := exporter.Without(exporter.DynamicUnitColumns(schema), opts.ExcludeFields)
+	encoder, err := exporter.NewEncoder(w, opts.Format, columns)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ExportResult{}
+	err = queryLiveUnits(ctx, r.client, r.tableName, opts, opts.UnitType+"#", func(item map[string]types.AttributeValue) error {
+		unit, err := unmarshalDynamicUnit(item)
+		if err != nil {
+			return err
+		}
+		if err := r.upgrade(ctx, unit); err != nil {
+			return err
+		}
+
+		record, err := exporter.DynamicUnitRecord(unit)
+		if err != nil {
+			return err
+		}
+		if err := encoder.Encode(record); err != nil {
+			return fmt.Errorf("failed to write unit %s: %w", unit.ID, err)
+		}
+		result.Count++
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	if err := encoder.Close(); err != nil {
+		return result, fmt.Errorf("failed to finish export: %w", err)
+	}
+	return result, nil
+}
+
+// queryLiveUnits calls fn with every live item of an account's partition, in sort
+// key order, following LastEvaluatedKey until the partition is exhausted. A sort
+// key prefix narrows the query; otherwise opts.UnitType is applied as a filter.
+func queryLiveUnits(ctx context.Context, client DynamoDBAPI, tableName string, opts ExportOptions, skPrefix string, fn func(map[string]types.AttributeValue) error) error {
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = exportPageSize
+	}
+
+	keyCondition := "pk = :accountId"
+	filter := "(attribute_not_exists(deletedAt) OR deletedAt = :zero)"
+	values := map[string]types.AttributeValue{
+		":accountId": &types.AttributeValueMemberS{Value: opts.AccountID},
+		":zero":      &types.AttributeValueMemberN{Value: "0"},
+	}
+	if skPrefix != "" {
+		keyCondition += " AND begins_with(sk, :skPrefix)"
+		values[":skPrefix"] = &types.AttributeValueMemberS{Value: skPrefix}
+	} else if opts.UnitType != "" {
+		filter += " AND unitType = :unitType"
+		values[":unitType"] = &types.AttributeValueMemberS{Value: opts.UnitType}
+	}
+	filter = withoutHistory(filter, values)
+
+	var startKey map[string]types.AttributeValue
+	for {
+		output, err := client.Query(ctx, &dynamodb.QueryInput{
+			TableName:                 aws.String(tableName),
+			KeyConditionExpression:    aws.String(keyCondition),
+			FilterExpression:          aws.String(filter),
+			ExpressionAttributeValues: values,
+			Limit:                     aws.Int32(pageSize),
+			ExclusiveStartKey:         startKey,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to query units: %w", err)
+		}
+
+		for _, item := range output.Items {
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+
+		if output.LastEvaluatedKey == nil {
+			return nil
+		}
+		startKey = output.LastEvaluatedKey
+	}
+}
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/steverhoton/unt-units-svc/internal/exporter"
+)
+
+func TestDynamoDBUnitRepository_Export(t *testing.T) {
+	unit1 := mustMarshalItem(t, map[string]interface{}{
+		"pk": "account-1", "sk": "unit-1#commercialVehicleType", "id": "unit-1", "unitType": "commercialVehicleType",
+		"make": "Mack", "note": "first", "createdAt": 100,
+	})
+	unit2 := mustMarshalItem(t, map[string]interface{}{
+		"pk": "account-1", "sk": "unit-2#commercialVehicleType", "id": "unit-2", "unitType": "commercialVehicleType",
+		"make": "Kenworth", "note": "second", "createdAt": 200,
+	})
+	dynamicUnit := mustMarshalItem(t, map[string]interface{}{
+		"pk": "account-1", "sk": "trailerType#unit-3", "id": "unit-3", "unitType": "trailerType",
+	})
+	lastKey := map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: "account-1"},
+		"sk": &types.AttributeValueMemberS{Value: "unit-1#commercialVehicleType"},
+	}
+
+	var inputs []*dynamodb.QueryInput
+	client := &fakeDynamoDB{
+		query: func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+			inputs = append(inputs, input)
+			if input.ExclusiveStartKey == nil {
+				return &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{unit1}, LastEvaluatedKey: lastKey}, nil
+			}
+			return &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{unit2, dynamicUnit}}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	var buf bytes.Buffer
+	result, err := repo.Export(context.Background(), ExportOptions{
+		AccountID:     "account-1",
+		Format:        exporter.FormatNDJSON,
+		ExcludeFields: []string{"note"},
+		PageSize:      1,
+	}, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Count)
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+	assert.Contains(t, string(lines[0]), `"id":"unit-1"`)
+	assert.Contains(t, string(lines[1]), `"make":"Kenworth"`)
+	assert.NotContains(t, buf.String(), `"note"`)
+	assert.NotContains(t, buf.String(), "unit-3")
+
+	require.Len(t, inputs, 2)
+	assert.Equal(t, "pk = :accountId", *inputs[0].KeyConditionExpression)
+	assert.Equal(t, "((attribute_not_exists(deletedAt) OR deletedAt = :zero)) AND NOT contains(sk, :historyMarker)", *inputs[0].FilterExpression)
+	assert.Equal(t, int32(1), *inputs[0].Limit)
+	assert.Equal(t, lastKey, inputs[1].ExclusiveStartKey)
+}
+
+func TestDynamoDBUnitRepository_ExportFiltersUnitType(t *testing.T) {
+	var input *dynamodb.QueryInput
+	client := &fakeDynamoDB{
+		query: func(in *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+			input = in
+			return &dynamodb.QueryOutput{}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	var buf bytes.Buffer
+	result, err := repo.Export(context.Background(), ExportOptions{AccountID: "account-1", UnitType: "commercialVehicleType", Format: exporter.FormatCSV}, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Count)
+	assert.Equal(t, "((attribute_not_exists(deletedAt) OR deletedAt = :zero) AND unitType = :unitType) AND NOT contains(sk, :historyMarker)", *input.FilterExpression)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "commercialVehicleType"}, input.ExpressionAttributeValues[":unitType"])
+	assert.Equal(t, int32(exportPageSize), *input.Limit)
+
+	// An empty export still has its header row
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte("accountId,id,unitType,")))
+}
+
+func TestDynamoDBUnitRepository_ExportErrors(t *testing.T) {
+	repo := NewDynamoDBUnitRepository(&fakeDynamoDB{}, "units")
+	_, err := repo.Export(context.Background(), ExportOptions{Format: exporter.FormatCSV}, &bytes.Buffer{})
+	assert.EqualError(t, err, "accountID is required")
+
+	_, err = repo.Export(context.Background(), ExportOptions{AccountID: "account-1", Format: "XLSX"}, &bytes.Buffer{})
+	assert.Error(t, err)
+
+	client := &fakeDynamoDB{
+		query: func(*dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+			return nil, errors.New("throttled")
+		},
+	}
+	repo = NewDynamoDBUnitRepository(client, "units")
+	_, err = repo.Export(context.Background(), ExportOptions{AccountID: "account-1", Format: exporter.FormatCSV}, &bytes.Buffer{})
+	assert.EqualError(t, err, "failed to query units: throttled")
+}
+
+func TestDynamoDBDynamicUnitRepository_Export(t *testing.T) {
+	staleItem := mustMarshalItem(t, map[string]interface{}{
+		"pk": "account-1", "sk": "trailerType#unit-1", "id": "unit-1", "unitType": "trailerType",
+		"schemaVersion": 1, "color": "red",
+	})
+	currentItem := mustMarshalItem(t, map[string]interface{}{
+		"pk": "account-1", "sk": "trailerType#unit-2", "id": "unit-2", "unitType": "trailerType",
+		"schemaVersion": 2, "paint": "blue",
+	})
+
+	var input *dynamodb.QueryInput
+	client := &fakeDynamoDB{
+		query: func(in *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+			input = in
+			return &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{staleItem, currentItem}}, nil
+		},
+	}
+	repo := NewDynamoDBDynamicUnitRepository(client, "units", newBackfillMigrator(t), false)
+
+	var buf bytes.Buffer
+	result, err := repo.Export(context.Background(), ExportOptions{AccountID: "account-1", UnitType: "trailerType", Format: exporter.FormatCSV}, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Count)
+
+	// Stale units are exported in the latest schema's shape
+	assert.Equal(t, "id,accountId,unitType,schemaVersion,createdAt,updatedAt,paint\n"+
+		"unit-1,account-1,trailerType,2,0,0,red\n"+
+		"unit-2,account-1,trailerType,2,0,0,blue\n", buf.String())
+
+	assert.Equal(t, "pk = :accountId AND begins_with(sk, :skPrefix)", *input.KeyConditionExpression)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "trailerType#"}, input.ExpressionAttributeValues[":skPrefix"])
+	assert.Empty(t, client.putInputs, "export does not write back migrated units")
+
+	_, err = repo.Export(context.Background(), ExportOptions{AccountID: "account-1", Format: exporter.FormatCSV}, &buf)
+	assert.EqualError(t, err, "unitType is required")
+	_, err = repo.Export(context.Background(), ExportOptions{AccountID: "account-1", UnitType: "boatType", Format: exporter.FormatCSV}, &buf)
+	assert.EqualError(t, err, "unsupported unit type: boatType")
+
+	repo = NewDynamoDBDynamicUnitRepository(client, "units", nil, false)
+	_, err = repo.Export(context.Background(), ExportOptions{AccountID: "account-1", UnitType: "trailerType", Format: exporter.FormatCSV}, &buf)
+	assert.EqualError(t, err, "export requires a schema migrator")
+}
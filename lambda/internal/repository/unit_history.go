@@ -0,0 +1,531 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+const (
+	// DefaultHistoryPageSize and MaxHistoryPageSize bound getUnitHistory pages
+	DefaultHistoryPageSize = 20
+	MaxHistoryPageSize     = 100
+)
+
+// actorKey is the context key of the caller recorded in unit history
+type actorKey struct{}
+
+// WithActor returns a context carrying the caller recorded in the history of the
+// units written with it
+func WithActor(ctx context.Context, actor models.Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// actorFrom returns the caller carried by ctx, or the zero Actor
+func actorFrom(ctx context.Context) models.Actor {
+	actor, _ := ctx.Value(actorKey{}).(models.Actor)
+	return actor
+}
+
+// withoutHistory narrows a filter on an account partition so history items, which
+// share the partition with the units, are left out
+func withoutHistory(filter string, values map[string]types.AttributeValue) string {
+	values[":historyMarker"] = &types.AttributeValueMemberS{Value: models.HistorySortKeyMarker}
+	return "(" + filter + ") AND NOT contains(sk, :historyMarker)"
+}
+
+// historyPut builds the put of the history item recording a write that turned
+// before into after. The item is never overwritten.
+func (r *DynamoDBUnitRepository) historyPut(ctx context.Context, action models.HistoryAction, before, after *models.Unit) (*types.Put, error) {
+	entry, err := models.NewUnitHistoryEntry(action, before, after, actorFrom(ctx), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return historyEntryPut(r.tableName, entry)
+}
+
+// historyEntryPut builds the put of a history item, which is never overwritten
+func historyEntryPut(tableName string, entry *models.UnitHistoryEntry) (*types.Put, error) {
+	item, err := attributevalue.MarshalMap(entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal history entry: %w", err)
+	}
+	return &types.Put{
+		TableName:           aws.String(tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(sk)"),
+	}, nil
+}
+
+// recordItems builds the puts of the history and outbox items recording a write
+// that turned before into after, for whichever of the two are turned on
+func (r *DynamoDBUnitRepository) recordItems(ctx context.Context, action models.HistoryAction, before, after *models.Unit) ([]types.TransactWriteItem, error) {
+	var records []types.TransactWriteItem
+	if r.history {
+		put, err := r.historyPut(ctx, action, before, after)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, types.TransactWriteItem{Put: put})
+	}
+	if r.outbox {
+		put, err := r.outboxPut(ctx, action, before, after)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, types.TransactWriteItem{Put: put})
+	}
+	return records, nil
+}
+
+// writeRecorded applies a conditional write to a unit together with the puts of
+// the items recording it, and the items moving its VIN reservation, in one
+// transaction. When the unit's condition fails the error is a
+// ConditionalCheckFailedException carrying the unit's current item, as the write
+// on its own would return, so callers explain it the same way. A VIN another unit
+// took meanwhile fails with a DuplicateVinError.
+func (r *DynamoDBUnitRepository) writeRecorded(ctx context.Context, write types.TransactWriteItem, records []types.TransactWriteItem) error {
+	err := transactRecorded(ctx, r.client, write, records)
+	var canceled *types.TransactionCanceledException
+	if !errors.As(err, &canceled) || len(canceled.CancellationReasons) != 1+len(records) {
+		return err
+	}
+	for k, record := range records {
+		reason := canceled.CancellationReasons[1+k]
+		if aws.ToString(reason.Code) != "ConditionalCheckFailed" {
+			continue
+		}
+		if vinErr := vinGuardFailure(record, reason); vinErr != nil {
+			return vinErr
+		}
+	}
+	return err
+}
+
+// transactRecorded applies a conditional write to a unit together with records in
+// one transaction. When the unit's condition fails the error is a
+// ConditionalCheckFailedException carrying the unit's current item; any other
+// failure is returned as DynamoDB reported it.
+func transactRecorded(ctx context.Context, client DynamoDBAPI, write types.TransactWriteItem, records []types.TransactWriteItem) error {
+	_, err := client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: append([]types.TransactWriteItem{write}, records...),
+	})
+	var canceled *types.TransactionCanceledException
+	if errors.As(err, &canceled) && len(canceled.CancellationReasons) == 1+len(records) &&
+		aws.ToString(canceled.CancellationReasons[0].Code) == "ConditionalCheckFailed" {
+		return &types.ConditionalCheckFailedException{
+			Message: canceled.CancellationReasons[0].Message,
+			Item:    canceled.CancellationReasons[0].Item,
+		}
+	}
+	return err
+}
+
+// recordedWrite applies a conditional write that turned before into after, recording
+// it in the unit's history and the event outbox and moving the reservation of a VIN
+// it changes
+func (r *DynamoDBUnitRepository) recordedWrite(ctx context.Context, action models.HistoryAction, write types.TransactWriteItem, before, after *models.Unit) error {
+	records, err := r.recordItems(ctx, action, before, after)
+	if err != nil {
+		return err
+	}
+	moves, err := r.vinMoveItems(ctx, before, after)
+	if err != nil {
+		return err
+	}
+	return r.writeRecorded(ctx, write, append(records, moves...))
+}
+
+// putRecorded creates a unit without a VIN together with the items recording it
+func (r *DynamoDBUnitRepository) putRecorded(ctx context.Context, input *dynamodb.PutItemInput, records []types.TransactWriteItem) error {
+	return r.writeRecorded(ctx, types.TransactWriteItem{Put: transactPut(input)}, records)
+}
+
+// patchRecorded applies a patch built by patchInput, recording the fields that
+// changed and moving the reservation of a VIN it changes, and returns the updated unit
+func (r *DynamoDBUnitRepository) patchRecorded(ctx context.Context, input *dynamodb.UpdateItemInput, accountID, unitID, unitType string, expectedVersion int64, patch *models.UnitPatch) (*models.Unit, error) {
+	item, before, err := r.storedUnit(ctx, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	if !isLiveAt(before, expectedVersion) {
+		return nil, conditionFailure(item, expectedVersion, accountID, unitID, unitType)
+	}
+
+	after, err := patchedUnit(before, patch, input.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.recordedWrite(ctx, models.HistoryUpdate, types.TransactWriteItem{Update: transactUpdate(input)}, before, after); err != nil {
+		var conditionalCheckFailedException *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailedException) {
+			return nil, conditionFailure(conditionalCheckFailedException.Item, expectedVersion, accountID, unitID, unitType)
+		}
+		return nil, fmt.Errorf("failed to update unit: %w", err)
+	}
+	return after, nil
+}
+
+// deleteRecorded applies a soft delete built by softDeleteInput and records it.
+// A unit that cannot be deleted fails as the conditional update would, without writing.
+func (r *DynamoDBUnitRepository) deleteRecorded(ctx context.Context, input *dynamodb.UpdateItemInput, expectedVersion int64, deletedBy string) error {
+	item, before, err := r.storedUnit(ctx, input.Key)
+	if err != nil {
+		return err
+	}
+	if !isLiveAt(before, expectedVersion) {
+		return &types.ConditionalCheckFailedException{Item: item}
+	}
+	after := softDeletedUnit(before, deletedBy, input.ExpressionAttributeValues)
+	return r.recordedWrite(ctx, models.HistoryDelete, types.TransactWriteItem{Update: transactUpdate(input)}, before, after)
+}
+
+// restoreRecorded applies an undelete built by restoreInput, records it and
+// returns the restored unit
+func (r *DynamoDBUnitRepository) restoreRecorded(ctx context.Context, input *dynamodb.UpdateItemInput, accountID, unitID, unitType string, expectedVersion int64) (*models.Unit, error) {
+	item, before, err := r.storedUnit(ctx, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	if before == nil || !before.IsDeleted() || before.Version != expectedVersion {
+		return nil, restoreConditionFailure(item, expectedVersion, accountID, unitID, unitType)
+	}
+
+	after := restoredUnit(before, input.ExpressionAttributeValues)
+	if err := r.recordedWrite(ctx, models.HistoryRestore, types.TransactWriteItem{Update: transactUpdate(input)}, before, after); err != nil {
+		var conditionalCheckFailedException *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailedException) {
+			return nil, restoreConditionFailure(conditionalCheckFailedException.Item, expectedVersion, accountID, unitID, unitType)
+		}
+		return nil, fmt.Errorf("failed to restore unit: %w", err)
+	}
+	return after, nil
+}
+
+// readTransactUnits reads, with consistent reads, the units a transaction updates
+// or deletes so that their changes can be recorded. It returns the stored unit of
+// each such operation, and an error for each operation on a unit that is missing,
+// deleted or at another version, as its conditional write would fail.
+func (r *DynamoDBUnitRepository) readTransactUnits(ctx context.Context, accountID string, ops []TransactOp) ([]*models.Unit, []error) {
+	stored := make([]*models.Unit, len(ops))
+	errs := make([]error, len(ops))
+
+	// BatchGetItem rejects repeated keys; a unit written twice fails later anyway
+	var keys []map[string]types.AttributeValue
+	var read []int
+	seen := make(map[string]bool, len(ops))
+	for i, op := range ops {
+		if op.Type != TransactUpdate && op.Type != TransactDelete {
+			continue
+		}
+		if op.ID == "" || op.UnitType == "" || seen[op.ID+"#"+op.UnitType] {
+			continue
+		}
+		seen[op.ID+"#"+op.UnitType] = true
+		keys = append(keys, (&models.Unit{AccountID: accountID, ID: op.ID, UnitType: op.UnitType}).GetKey())
+		read = append(read, i)
+	}
+	if len(keys) == 0 {
+		return stored, errs
+	}
+
+	items, itemErrs := batchGetItems(ctx, r.client, r.tableName, keys, true)
+	for j, i := range read {
+		op := ops[i]
+		if itemErrs[j] != nil {
+			errs[i] = fmt.Errorf("failed to read unit: %w", itemErrs[j])
+			continue
+		}
+
+		var unit *models.Unit
+		if items[j] != nil {
+			unit = &models.Unit{}
+			if err := attributevalue.UnmarshalMap(items[j], unit); err != nil {
+				errs[i] = fmt.Errorf("failed to unmarshal unit: %w", err)
+				continue
+			}
+		}
+		switch {
+		case isLiveAt(unit, op.ExpectedVersion):
+			stored[i] = unit
+		case op.Type == TransactDelete:
+			errs[i] = deleteConditionFailure(items[j], op.ExpectedVersion, accountID, op.ID, op.UnitType)
+		default:
+			errs[i] = conditionFailure(items[j], op.ExpectedVersion, accountID, op.ID, op.UnitType)
+		}
+	}
+	return stored, errs
+}
+
+// transactRecordItems builds the history and outbox items of operation i of a
+// transaction, whose write to the unit is write and whose stored unit before the
+// write is before
+func (r *DynamoDBUnitRepository) transactRecordItems(ctx context.Context, i int, op TransactOp, before *models.Unit, write types.TransactWriteItem, deletedBy string) ([]transactItem, error) {
+	var action models.HistoryAction
+	var after *models.Unit
+	var err error
+	switch op.Type {
+	case TransactCreate:
+		action, after = models.HistoryCreate, op.Unit
+	case TransactUpdate:
+		action = models.HistoryUpdate
+		after, err = patchedUnit(before, op.Patch, write.Update.ExpressionAttributeValues)
+	case TransactDelete:
+		action, after = models.HistoryDelete, softDeletedUnit(before, deletedBy, write.Update.ExpressionAttributeValues)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := r.recordItems(ctx, action, before, after)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]transactItem, 0, len(records))
+	for _, record := range records {
+		items = append(items, transactItem{op: i, record: true, writeItem: record})
+	}
+	return items, nil
+}
+
+// storedUnit reads the current item of a unit, deleted or not, with a consistent
+// read. Both results are nil when there is no such unit.
+func (r *DynamoDBUnitRepository) storedUnit(ctx context.Context, key map[string]types.AttributeValue) (map[string]types.AttributeValue, *models.Unit, error) {
+	output, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(r.tableName),
+		Key:            key,
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get unit: %w", err)
+	}
+	if output.Item == nil {
+		return nil, nil, nil
+	}
+
+	var unit models.Unit
+	if err := attributevalue.UnmarshalMap(output.Item, &unit); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal unit: %w", err)
+	}
+	return output.Item, &unit, nil
+}
+
+// isLiveAt reports whether a stored unit exists, is not deleted and is at expectedVersion
+func isLiveAt(unit *models.Unit, expectedVersion int64) bool {
+	return unit != nil && !unit.IsDeleted() && unit.Version == expectedVersion
+}
+
+// patchedUnit returns unit as the UpdateItem built by patchInput, with expression
+// attribute values values, leaves it
+func patchedUnit(unit *models.Unit, patch *models.UnitPatch, values map[string]types.AttributeValue) (*models.Unit, error) {
+	item, err := attributevalue.MarshalMap(unit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal unit: %w", err)
+	}
+	for attribute, value := range patch.Set {
+		av, err := attributevalue.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %s: %w", attribute, err)
+		}
+		item[attribute] = av
+	}
+	for _, attribute := range patch.Remove {
+		delete(item, attribute)
+	}
+
+	var patched models.Unit
+	if err := attributevalue.UnmarshalMap(item, &patched); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal updated unit: %w", err)
+	}
+	patched.UpdatedAt = expressionNumber(values, ":updatedAt")
+	patched.Version = expressionNumber(values, ":newVersion")
+	return &patched, nil
+}
+
+// softDeletedUnit returns unit as the UpdateItem built by softDeleteInput leaves it
+func softDeletedUnit(unit *models.Unit, deletedBy string, values map[string]types.AttributeValue) *models.Unit {
+	deleted := *unit
+	deleted.DeletedAt = expressionNumber(values, ":now")
+	deleted.UpdatedAt = deleted.DeletedAt
+	deleted.DeletedBy = deletedBy
+	deleted.ExpiresAt = expressionNumber(values, ":expiresAt")
+	deleted.Version = expressionNumber(values, ":newVersion")
+	return &deleted
+}
+
+// restoredUnit returns unit as the UpdateItem built by restoreInput leaves it
+func restoredUnit(unit *models.Unit, values map[string]types.AttributeValue) *models.Unit {
+	restored := *unit
+	restored.DeletedAt = 0
+	restored.DeletedBy = ""
+	restored.ExpiresAt = 0
+	restored.UpdatedAt = expressionNumber(values, ":now")
+	restored.Version = expressionNumber(values, ":newVersion")
+	return &restored
+}
+
+// expressionNumber returns a numeric placeholder value of a write built by this
+// repository, or 0 when the write does not set it
+func expressionNumber(values map[string]types.AttributeValue, placeholder string) int64 {
+	n, ok := values[placeholder].(*types.AttributeValueMemberN)
+	if !ok {
+		return 0
+	}
+	value, _ := strconv.ParseInt(n.Value, 10, 64)
+	return value
+}
+
+// GetHistory retrieves a page of a unit's history, newest change first. Deleted and
+// purged units keep their history.
+func (r *DynamoDBUnitRepository) GetHistory(ctx context.Context, input *appsync.GetUnitHistoryInput) (*appsync.UnitHistoryResponse, error) {
+	return queryHistory(ctx, r.client, r.tableName, r.tokens, input)
+}
+
+// queryHistory retrieves a page of the history items of a unit, newest first
+func queryHistory(ctx context.Context, client DynamoDBAPI, tableName string, tokens *PaginationTokenSigner, input *appsync.GetUnitHistoryInput) (*appsync.UnitHistoryResponse, error) {
+	if input == nil {
+		return nil, errors.New("input is required")
+	}
+	if input.AccountID == "" {
+		return nil, errors.New("accountID is required")
+	}
+	if input.ID == "" {
+		return nil, errors.New("unitID is required")
+	}
+	if input.UnitType == "" {
+		return nil, errors.New("unitType is required")
+	}
+
+	limit := int32(DefaultHistoryPageSize)
+	if input.Limit != nil && *input.Limit > 0 && *input.Limit <= MaxHistoryPageSize {
+		limit = int32(*input.Limit)
+	}
+
+	queryInput := &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		KeyConditionExpression: aws.String("pk = :accountId AND begins_with(sk, :historyPrefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":accountId":     &types.AttributeValueMemberS{Value: input.AccountID},
+			":historyPrefix": &types.AttributeValueMemberS{Value: models.HistorySortKeyPrefix(input.ID, input.UnitType)},
+		},
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int32(limit),
+	}
+
+	scope := historyScope(input.AccountID, input.ID, input.UnitType)
+	if input.NextToken != nil && *input.NextToken != "" {
+		exclusiveStartKey, err := tokens.decode(*input.NextToken, scope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode pagination token: %w", err)
+		}
+		queryInput.ExclusiveStartKey = exclusiveStartKey
+	}
+
+	result, err := client.Query(ctx, queryInput)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unit history: %w", err)
+	}
+
+	// Initialize as empty slice to ensure it marshals to [] instead of null
+	entries := make([]models.UnitHistoryEntry, 0, len(result.Items))
+	if err := attributevalue.UnmarshalListOfMaps(result.Items, &entries); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal unit history: %w", err)
+	}
+
+	response := &appsync.UnitHistoryResponse{
+		Items: entries,
+		Count: len(entries),
+	}
+	if result.LastEvaluatedKey != nil {
+		nextToken, err := tokens.encode(result.LastEvaluatedKey, scope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode pagination token: %w", err)
+		}
+		if nextToken != "" {
+			response.NextToken = &nextToken
+		}
+	}
+
+	return response, nil
+}
+
+// GetAsOf rebuilds a unit as it was at asOf by replaying its history up to that
+// moment. It returns nil when the unit had not been created yet or was deleted
+// at the time, and ErrHistoryIncomplete when its history does not start with its
+// creation.
+func (r *DynamoDBUnitRepository) GetAsOf(ctx context.Context, accountID, unitID, unitType string, asOf time.Time) (*models.Unit, error) {
+	entries, err := historyUpTo(ctx, r.client, r.tableName, accountID, unitID, unitType, asOf)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+
+	unit, err := models.ReplayHistory(entries)
+	if err != nil {
+		return nil, err
+	}
+	if unit.IsDeleted() {
+		return nil, nil
+	}
+	return unit, nil
+}
+
+// historyUpTo reads the history items of a unit recorded at or before asOf, oldest
+// first. It returns ErrHistoryIncomplete when they do not start with the unit's creation.
+func historyUpTo(ctx context.Context, client DynamoDBAPI, tableName, accountID, unitID, unitType string, asOf time.Time) ([]models.UnitHistoryEntry, error) {
+	if accountID == "" {
+		return nil, errors.New("accountID is required")
+	}
+	if unitID == "" {
+		return nil, errors.New("unitID is required")
+	}
+	if unitType == "" {
+		return nil, errors.New("unitType is required")
+	}
+
+	// Every sort key between the prefix and the key bounding asOf is a history item
+	// of the unit, as history timestamps sort in time and versions after them
+	prefix := models.HistorySortKeyPrefix(unitID, unitType)
+	queryInput := &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		KeyConditionExpression: aws.String("pk = :accountId AND sk BETWEEN :historyPrefix AND :asOf"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":accountId":     &types.AttributeValueMemberS{Value: accountID},
+			":historyPrefix": &types.AttributeValueMemberS{Value: prefix},
+			":asOf":          &types.AttributeValueMemberS{Value: models.HistorySortKeyUpTo(unitID, unitType, asOf)},
+		},
+	}
+
+	var entries []models.UnitHistoryEntry
+	for {
+		result, err := client.Query(ctx, queryInput)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query unit history: %w", err)
+		}
+
+		var page []models.UnitHistoryEntry
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal unit history: %w", err)
+		}
+		entries = append(entries, page...)
+
+		if result.LastEvaluatedKey == nil {
+			break
+		}
+		queryInput.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	if len(entries) > 0 && entries[0].Action != models.HistoryCreate {
+		return nil, ErrHistoryIncomplete
+	}
+	return entries, nil
+}
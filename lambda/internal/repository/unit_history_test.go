@@ -0,0 +1,346 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+// storedTractor is the item of a live unit at version 3
+func storedTractor(t *testing.T) map[string]types.AttributeValue {
+	return mustMarshalItem(t, map[string]interface{}{
+		"pk": "account-1", "sk": "unit-1#commercialVehicleType", "id": "unit-1", "unitType": "commercialVehicleType",
+		"make": "Mack", "note": "yard 4", "version": 3, "deletedAt": 0,
+	})
+}
+
+// historyEntry unmarshals the history item written by a transaction
+func historyEntry(t *testing.T, item types.TransactWriteItem) models.UnitHistoryEntry {
+	require.NotNil(t, item.Put)
+	assert.Equal(t, "attribute_not_exists(sk)", *item.Put.ConditionExpression)
+
+	var entry models.UnitHistoryEntry
+	require.NoError(t, attributevalue.UnmarshalMap(item.Put.Item, &entry))
+	return entry
+}
+
+func TestDynamoDBUnitRepository_CreateRecordsHistory(t *testing.T) {
+	client := &fakeDynamoDB{}
+	repo := NewDynamoDBUnitRepository(client, "units").WithHistory(true)
+	ctx := WithActor(context.Background(), models.Actor{Sub: "sub-1", Username: "jo", SourceIP: "10.0.0.1"})
+
+	unit := &models.Unit{AccountID: "account-1", UnitType: "commercialVehicleType", Make: "Mack"}
+	require.NoError(t, repo.Create(ctx, unit))
+
+	assert.Empty(t, client.putInputs)
+	require.Len(t, client.transactInputs, 1)
+	items := client.transactInputs[0].TransactItems
+	require.Len(t, items, 2)
+	require.NotNil(t, items[0].Put)
+
+	entry := historyEntry(t, items[1])
+	assert.Equal(t, "account-1", entry.AccountID)
+	assert.True(t, strings.HasPrefix(entry.SortKey, unit.ID+"#commercialVehicleType#HIST#"))
+	assert.Equal(t, models.HistoryCreate, entry.Action)
+	assert.Equal(t, int64(1), entry.Version)
+	assert.Equal(t, models.Actor{Sub: "sub-1", Username: "jo", SourceIP: "10.0.0.1"}, entry.Actor)
+	assert.JSONEq(t, `"Mack"`, string(entry.Changes["make"].To))
+	assert.JSONEq(t, `null`, string(entry.Changes["make"].From))
+	assert.NotContains(t, entry.Changes, "version")
+}
+
+func TestDynamoDBUnitRepository_PatchRecordsHistory(t *testing.T) {
+	var read *dynamodb.GetItemInput
+	client := &fakeDynamoDB{
+		getItem: func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			read = input
+			return &dynamodb.GetItemOutput{Item: storedTractor(t)}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units").WithHistory(true)
+
+	patch := &models.UnitPatch{Set: map[string]interface{}{"make": "Mack", "note": "yard 7"}}
+	unit, err := repo.Patch(context.Background(), "account-1", "unit-1", "commercialVehicleType", 3, patch)
+	require.NoError(t, err)
+
+	require.NotNil(t, read)
+	assert.True(t, *read.ConsistentRead)
+	assert.Empty(t, client.updateInputs)
+	assert.Equal(t, "yard 7", unit.Note)
+	assert.Equal(t, int64(4), unit.Version)
+
+	require.Len(t, client.transactInputs, 1)
+	items := client.transactInputs[0].TransactItems
+	require.Len(t, items, 2)
+	require.NotNil(t, items[0].Update)
+
+	entry := historyEntry(t, items[1])
+	assert.Equal(t, models.HistoryUpdate, entry.Action)
+	assert.Equal(t, int64(4), entry.Version)
+	assert.Equal(t, models.FieldChanges{
+		"note": {From: json.RawMessage(`"yard 4"`), To: json.RawMessage(`"yard 7"`)},
+	}, entry.Changes)
+}
+
+func TestDynamoDBUnitRepository_PatchWithHistoryFailsStaleVersion(t *testing.T) {
+	client := &fakeDynamoDB{
+		getItem: func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{Item: storedTractor(t)}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units").WithHistory(true)
+
+	_, err := repo.Patch(context.Background(), "account-1", "unit-1", "commercialVehicleType", 2,
+		&models.UnitPatch{Set: map[string]interface{}{"note": "yard 7"}})
+
+	var conflict *VersionConflictError
+	require.True(t, errors.As(err, &conflict))
+	assert.Equal(t, int64(3), conflict.CurrentVersion)
+	assert.Empty(t, client.transactInputs)
+}
+
+func TestDynamoDBUnitRepository_DeleteRecordsHistory(t *testing.T) {
+	client := &fakeDynamoDB{
+		getItem: func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{Item: storedTractor(t)}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units").WithHistory(true)
+
+	require.NoError(t, repo.Delete(context.Background(), "account-1", "unit-1", "commercialVehicleType", 3, "user-1"))
+
+	require.Len(t, client.transactInputs, 1)
+	entry := historyEntry(t, client.transactInputs[0].TransactItems[1])
+	assert.Equal(t, models.HistoryDelete, entry.Action)
+	assert.JSONEq(t, `"user-1"`, string(entry.Changes["deletedBy"].To))
+	assert.Contains(t, entry.Changes, "deletedAt")
+}
+
+func TestDynamoDBUnitRepository_DeleteWithHistoryFailsDeletedUnit(t *testing.T) {
+	deleted := storedTractor(t)
+	deleted["deletedAt"] = &types.AttributeValueMemberN{Value: "1700000000"}
+	client := &fakeDynamoDB{
+		getItem: func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{Item: deleted}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units").WithHistory(true)
+
+	err := repo.Delete(context.Background(), "account-1", "unit-1", "commercialVehicleType", 3, "user-1")
+	assert.ErrorIs(t, err, ErrUnitAlreadyDeleted)
+	assert.Empty(t, client.transactInputs)
+}
+
+func TestDynamoDBUnitRepository_RestoreRecordsHistory(t *testing.T) {
+	deleted := storedTractor(t)
+	deleted["deletedAt"] = &types.AttributeValueMemberN{Value: "1700000000"}
+	deleted["deletedBy"] = &types.AttributeValueMemberS{Value: "user-1"}
+	client := &fakeDynamoDB{
+		getItem: func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{Item: deleted}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units").WithHistory(true)
+
+	unit, err := repo.Restore(context.Background(), "account-1", "unit-1", "commercialVehicleType", 3)
+	require.NoError(t, err)
+	assert.False(t, unit.IsDeleted())
+	assert.Equal(t, int64(4), unit.Version)
+
+	require.Len(t, client.transactInputs, 1)
+	entry := historyEntry(t, client.transactInputs[0].TransactItems[1])
+	assert.Equal(t, models.HistoryRestore, entry.Action)
+	assert.JSONEq(t, `"user-1"`, string(entry.Changes["deletedBy"].From))
+	assert.JSONEq(t, `null`, string(entry.Changes["deletedBy"].To))
+}
+
+func TestDynamoDBUnitRepository_TransactWriteRecordsHistory(t *testing.T) {
+	client := &fakeDynamoDB{
+		batchGet: func(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+			assert.True(t, *input.RequestItems["units"].ConsistentRead)
+			tractor := storedTractor(t)
+			return &dynamodb.BatchGetItemOutput{Responses: map[string][]map[string]types.AttributeValue{"units": {tractor}}}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units").WithHistory(true)
+
+	ops := []TransactOp{
+		{Type: TransactUpdate, UnitKey: UnitKey{ID: "unit-1", UnitType: "commercialVehicleType"}, ExpectedVersion: 3,
+			Patch: &models.UnitPatch{Set: map[string]interface{}{"note": "yard 7"}}},
+		{Type: TransactCreate, Unit: &models.Unit{UnitType: "commercialVehicleType", Make: "Volvo"}},
+		{Type: TransactConditionCheck, UnitKey: UnitKey{ID: "unit-2", UnitType: "commercialVehicleType"}, ExpectedVersion: 1},
+	}
+	require.NoError(t, repo.TransactWrite(context.Background(), "account-1", ops, "user-1"))
+
+	require.Len(t, client.transactInputs, 1)
+	items := client.transactInputs[0].TransactItems
+	require.Len(t, items, 5)
+	assert.Equal(t, models.HistoryUpdate, historyEntry(t, items[1]).Action)
+	assert.Equal(t, models.HistoryCreate, historyEntry(t, items[3]).Action)
+	require.NotNil(t, items[4].ConditionCheck)
+}
+
+func TestDynamoDBUnitRepository_TransactWriteWithHistoryFailsStaleVersion(t *testing.T) {
+	client := &fakeDynamoDB{
+		batchGet: func(*dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+			return &dynamodb.BatchGetItemOutput{Responses: map[string][]map[string]types.AttributeValue{"units": {storedTractor(t)}}}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units").WithHistory(true)
+
+	ops := []TransactOp{
+		{Type: TransactDelete, UnitKey: UnitKey{ID: "unit-1", UnitType: "commercialVehicleType"}, ExpectedVersion: 2},
+	}
+	err := repo.TransactWrite(context.Background(), "account-1", ops, "user-1")
+
+	var canceled *TransactionCanceledError
+	require.True(t, errors.As(err, &canceled))
+	var conflict *VersionConflictError
+	assert.True(t, errors.As(canceled.Errors[0], &conflict))
+	assert.Empty(t, client.transactInputs)
+}
+
+func TestDynamoDBUnitRepository_GetHistory(t *testing.T) {
+	var inputs []*dynamodb.QueryInput
+	client := &fakeDynamoDB{
+		query: func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+			inputs = append(inputs, input)
+			item := mustMarshalItem(t, map[string]interface{}{
+				"pk": "account-1", "sk": "unit-1#commercialVehicleType#HIST#2026-01-02T03:04:05.000000000Z",
+				"unitId": "unit-1", "unitType": "commercialVehicleType", "action": "UPDATE", "version": 4,
+				"timestamp": "2026-01-02T03:04:05.000000000Z",
+			})
+			item["changes"] = &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+				"note": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+					"from": &types.AttributeValueMemberS{Value: `"yard 4"`},
+				}},
+			}}
+			return &dynamodb.QueryOutput{
+				Items:            []map[string]types.AttributeValue{item},
+				LastEvaluatedKey: map[string]types.AttributeValue{"pk": item["pk"], "sk": item["sk"]},
+			}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	input := &appsync.GetUnitHistoryInput{AccountID: "account-1", ID: "unit-1", UnitType: "commercialVehicleType"}
+	result, err := repo.GetHistory(context.Background(), input)
+	require.NoError(t, err)
+
+	require.Len(t, inputs, 1)
+	assert.Equal(t, "pk = :accountId AND begins_with(sk, :historyPrefix)", *inputs[0].KeyConditionExpression)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "unit-1#commercialVehicleType#HIST#"}, inputs[0].ExpressionAttributeValues[":historyPrefix"])
+	assert.False(t, *inputs[0].ScanIndexForward)
+	assert.Equal(t, int32(DefaultHistoryPageSize), *inputs[0].Limit)
+
+	require.Equal(t, 1, result.Count)
+	entry := result.Items[0]
+	assert.Equal(t, models.HistoryUpdate, entry.Action)
+	assert.JSONEq(t, `"yard 4"`, string(entry.Changes["note"].From))
+	assert.JSONEq(t, `null`, string(entry.Changes["note"].To))
+
+	require.NotNil(t, result.NextToken)
+	input.NextToken = result.NextToken
+	input.Limit = aws.Int(5)
+	_, err = repo.GetHistory(context.Background(), input)
+	require.NoError(t, err)
+	require.Len(t, inputs, 2)
+	assert.Equal(t, int32(5), *inputs[1].Limit)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "unit-1#commercialVehicleType#HIST#2026-01-02T03:04:05.000000000Z"}, inputs[1].ExclusiveStartKey["sk"])
+
+	// A token of another unit's history is rejected
+	_, err = repo.GetHistory(context.Background(), &appsync.GetUnitHistoryInput{
+		AccountID: "account-1", ID: "unit-2", UnitType: "commercialVehicleType", NextToken: result.NextToken,
+	})
+	assert.ErrorIs(t, err, ErrInvalidPaginationToken)
+}
+
+// historyItem is a stored history item of unit-1 with the given changes
+func historyItem(t *testing.T, action models.HistoryAction, version int64, timestamp string, changes models.FieldChanges) map[string]types.AttributeValue {
+	item, err := attributevalue.MarshalMap(models.UnitHistoryEntry{
+		AccountID: "account-1", SortKey: fmt.Sprintf("unit-1#commercialVehicleType#HIST#%s#%019d", timestamp, version),
+		UnitID: "unit-1", UnitType: "commercialVehicleType", Action: action, Version: version, Timestamp: timestamp, Changes: changes,
+	})
+	require.NoError(t, err)
+	return item
+}
+
+func TestDynamoDBUnitRepository_GetAsOf(t *testing.T) {
+	var inputs []*dynamodb.QueryInput
+	client := &fakeDynamoDB{
+		query: func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+			inputs = append(inputs, input)
+			if input.ExclusiveStartKey == nil {
+				return &dynamodb.QueryOutput{
+					Items: []map[string]types.AttributeValue{historyItem(t, models.HistoryCreate, 1, "2026-01-01T00:00:00.000000000Z", models.FieldChanges{
+						"id":   {From: json.RawMessage(`null`), To: json.RawMessage(`"unit-1"`)},
+						"note": {From: json.RawMessage(`null`), To: json.RawMessage(`"yard 4"`)},
+					})},
+					LastEvaluatedKey: map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: "account-1"}},
+				}, nil
+			}
+			return &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{
+				historyItem(t, models.HistoryUpdate, 2, "2026-02-01T00:00:00.000000000Z", models.FieldChanges{
+					"note": {From: json.RawMessage(`"yard 4"`), To: json.RawMessage(`"yard 7"`)},
+				}),
+			}}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	asOf := time.Date(2026, 2, 10, 9, 0, 0, 0, time.FixedZone("CET", 3600))
+	unit, err := repo.GetAsOf(context.Background(), "account-1", "unit-1", "commercialVehicleType", asOf)
+	require.NoError(t, err)
+
+	require.Len(t, inputs, 2)
+	assert.Equal(t, "pk = :accountId AND sk BETWEEN :historyPrefix AND :asOf", *inputs[0].KeyConditionExpression)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "unit-1#commercialVehicleType#HIST#2026-02-10T08:00:00.000000000Z#~"}, inputs[0].ExpressionAttributeValues[":asOf"])
+	require.NotNil(t, unit)
+	assert.Equal(t, "yard 7", unit.Note)
+	assert.Equal(t, int64(2), unit.Version)
+}
+
+func TestDynamoDBUnitRepository_GetAsOfDeletedOrIncomplete(t *testing.T) {
+	var items []map[string]types.AttributeValue
+	client := &fakeDynamoDB{
+		query: func(*dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+			return &dynamodb.QueryOutput{Items: items}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+	asOf := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	unit, err := repo.GetAsOf(context.Background(), "account-1", "unit-1", "commercialVehicleType", asOf)
+	require.NoError(t, err)
+	assert.Nil(t, unit)
+
+	items = []map[string]types.AttributeValue{
+		historyItem(t, models.HistoryCreate, 1, "2026-01-01T00:00:00.000000000Z", models.FieldChanges{
+			"id": {From: json.RawMessage(`null`), To: json.RawMessage(`"unit-1"`)},
+		}),
+		historyItem(t, models.HistoryDelete, 2, "2026-02-01T00:00:00.000000000Z", models.FieldChanges{
+			"deletedAt": {From: json.RawMessage(`0`), To: json.RawMessage(`1769904000`)},
+		}),
+	}
+	unit, err = repo.GetAsOf(context.Background(), "account-1", "unit-1", "commercialVehicleType", asOf)
+	require.NoError(t, err)
+	assert.Nil(t, unit)
+
+	items = items[1:]
+	_, err = repo.GetAsOf(context.Background(), "account-1", "unit-1", "commercialVehicleType", asOf)
+	assert.ErrorIs(t, err, ErrHistoryIncomplete)
+}
@@ -0,0 +1,258 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/steverhoton/unt-units-svc/internal/events"
+	"github.com/steverhoton/unt-units-svc/internal/models"
+)
+
+// outboxPrefix starts the partition key of the outbox items of an account. Outbox
+// items have no unitType, id or deletedAt, so unit queries, the GSIs, backfill and
+// purge never see them.
+const outboxPrefix = "OUTBOX#"
+
+// outboxItem is an event waiting in the outbox to be published, stored under
+// OUTBOX#{accountId} and {occurredAt}#{eventId} so an account's events sort in time
+type outboxItem struct {
+	PK        string `dynamodbav:"pk"`
+	SK        string `dynamodbav:"sk"`
+	EventID   string `dynamodbav:"eventId"`
+	EventType string `dynamodbav:"eventType"`
+	Event     string `dynamodbav:"event"` // The event as JSON
+}
+
+// outboxPut builds the put of the outbox item holding the event raised by a write
+// that turned before into after. The item is never overwritten.
+func (r *DynamoDBUnitRepository) outboxPut(ctx context.Context, action models.HistoryAction, before, after *models.Unit) (*types.Put, error) {
+	event := events.NewUnitEvent(action, before, after, actorFrom(ctx), time.Now())
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event: %w", err)
+	}
+	item, err := attributevalue.MarshalMap(outboxItem{
+		PK:        outboxPrefix + event.AccountID,
+		SK:        event.OccurredAt.Format(models.HistoryTimeFormat) + "#" + event.ID,
+		EventID:   event.ID,
+		EventType: string(event.Type),
+		Event:     string(data),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal outbox item: %w", err)
+	}
+	return &types.Put{
+		TableName:           aws.String(r.tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(sk)"),
+	}, nil
+}
+
+// isOutboxItem reports whether a table item is an outbox item
+func isOutboxItem(item map[string]types.AttributeValue) bool {
+	pk, ok := item["pk"].(*types.AttributeValueMemberS)
+	return ok && strings.HasPrefix(pk.Value, outboxPrefix)
+}
+
+// OutboxRelayOptions controls an outbox relay run
+type OutboxRelayOptions struct {
+	// AccountID restricts the run to one account's outbox (Query); empty scans the whole table
+	AccountID string
+	// DryRun counts waiting events without publishing them
+	DryRun bool
+	// PageSize is the DynamoDB page size for each Query/Scan call
+	PageSize int32
+}
+
+// OutboxRelayResult summarizes an outbox relay run
+type OutboxRelayResult struct {
+	Scanned   int `json:"scanned"`
+	Waiting   int `json:"waiting"`
+	Published int `json:"published"`
+	Failed    int `json:"failed"`
+	Held      int `json:"held"` // Events left behind an earlier failed event of their account
+}
+
+// OutboxRelay publishes the domain events written to the outbox with the units
+// they describe, and removes each event from the outbox once it is published.
+// An event that is published but not removed is published again by the next run,
+// so subscribers receive each event at least once and should dedupe on its ID.
+type OutboxRelay struct {
+	client    DynamoDBAPI
+	tableName string
+	publisher events.Publisher
+}
+
+// NewOutboxRelay creates a relay publishing the outbox of the units table with publisher
+func NewOutboxRelay(client DynamoDBAPI, tableName string, publisher events.Publisher) *OutboxRelay {
+	return &OutboxRelay{
+		client:    client,
+		tableName: tableName,
+		publisher: publisher,
+	}
+}
+
+// Relay walks the outbox and publishes the waiting events a page at a time. Within
+// an account, events are published in the order they occurred; an event that fails
+// stays in the outbox for the next run, and so do the account's later events.
+func (o *OutboxRelay) Relay(ctx context.Context, opts OutboxRelayOptions) (*OutboxRelayResult, error) {
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+
+	result := &OutboxRelayResult{}
+	blocked := map[string]bool{}
+	var startKey map[string]types.AttributeValue
+
+	for {
+		items, scanned, lastKey, err := o.outboxPage(ctx, opts.AccountID, pageSize, startKey)
+		if err != nil {
+			return result, err
+		}
+		result.Scanned += scanned
+		result.Waiting += len(items)
+
+		if !opts.DryRun && len(items) > 0 {
+			o.publishPage(ctx, items, blocked, result)
+		}
+
+		if lastKey == nil {
+			break
+		}
+		startKey = lastKey
+	}
+
+	return result, nil
+}
+
+// outboxPage reads one page of outbox items, querying a single account's outbox when an account is given
+func (o *OutboxRelay) outboxPage(ctx context.Context, accountID string, pageSize int32, startKey map[string]types.AttributeValue) ([]outboxItem, int, map[string]types.AttributeValue, error) {
+	var rawItems []map[string]types.AttributeValue
+	var scanned int
+	var lastKey map[string]types.AttributeValue
+
+	if accountID != "" {
+		output, err := o.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(o.tableName),
+			KeyConditionExpression: aws.String("pk = :outbox"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":outbox": &types.AttributeValueMemberS{Value: outboxPrefix + accountID},
+			},
+			Limit:             aws.Int32(pageSize),
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, 0, nil, fmt.Errorf("failed to query outbox: %w", err)
+		}
+		rawItems, scanned, lastKey = output.Items, int(output.ScannedCount), output.LastEvaluatedKey
+	} else {
+		output, err := o.client.Scan(ctx, &dynamodb.ScanInput{
+			TableName:        aws.String(o.tableName),
+			FilterExpression: aws.String("begins_with(pk, :outbox)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":outbox": &types.AttributeValueMemberS{Value: outboxPrefix},
+			},
+			Limit:             aws.Int32(pageSize),
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, 0, nil, fmt.Errorf("failed to scan outbox: %w", err)
+		}
+		rawItems, scanned, lastKey = output.Items, int(output.ScannedCount), output.LastEvaluatedKey
+	}
+
+	var items []outboxItem
+	if err := attributevalue.UnmarshalListOfMaps(rawItems, &items); err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to unmarshal outbox items: %w", err)
+	}
+	return items, scanned, lastKey, nil
+}
+
+// publishPage publishes the events of a page of outbox items and removes the
+// published ones. Each Publish call carries at most the next event of each account,
+// so no event is published before the earlier events of its account were. Once an
+// account's event fails, or cannot be read, the account is blocked and its later
+// events are held for the next run; an unreadable item is left for inspection.
+func (o *OutboxRelay) publishPage(ctx context.Context, items []outboxItem, blocked map[string]bool, result *OutboxRelayResult) {
+	// Outbox items of an account share its partition key, in the order they occurred
+	queues := map[string][]outboxItem{}
+	var accounts []string
+	for _, item := range items {
+		if blocked[item.PK] {
+			result.Held++
+			continue
+		}
+		if _, ok := queues[item.PK]; !ok {
+			accounts = append(accounts, item.PK)
+		}
+		queues[item.PK] = append(queues[item.PK], item)
+	}
+
+	// block holds the waiting events of an account after one of its events failed
+	block := func(account string) {
+		blocked[account] = true
+		result.Held += len(queues[account])
+		queues[account] = nil
+	}
+
+	for len(accounts) > 0 {
+		var pending []outboxItem
+		var batch []events.Event
+		for _, account := range accounts {
+			item := queues[account][0]
+			queues[account] = queues[account][1:]
+
+			var event events.Event
+			if err := json.Unmarshal([]byte(item.Event), &event); err != nil {
+				log.Printf("Failed to read outbox event %s: %v", item.EventID, err)
+				result.Failed++
+				block(account)
+				continue
+			}
+			pending = append(pending, item)
+			batch = append(batch, event)
+		}
+
+		if len(batch) > 0 {
+			errs := events.Failed(o.publisher.Publish(ctx, batch), len(batch))
+			for i, item := range pending {
+				if errs[i] != nil {
+					log.Printf("Failed to publish outbox event %s: %v", item.EventID, errs[i])
+					result.Failed++
+					block(item.PK)
+					continue
+				}
+				result.Published++
+
+				_, err := o.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+					TableName: aws.String(o.tableName),
+					Key: map[string]types.AttributeValue{
+						"pk": &types.AttributeValueMemberS{Value: item.PK},
+						"sk": &types.AttributeValueMemberS{Value: item.SK},
+					},
+				})
+				if err != nil {
+					log.Printf("Failed to remove published outbox event %s: %v", item.EventID, err)
+				}
+			}
+		}
+
+		remaining := accounts[:0]
+		for _, account := range accounts {
+			if len(queues[account]) > 0 {
+				remaining = append(remaining, account)
+			}
+		}
+		accounts = remaining
+	}
+}
@@ -0,0 +1,260 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/steverhoton/unt-units-svc/internal/events"
+	"github.com/steverhoton/unt-units-svc/internal/models"
+)
+
+// outboxEvent unmarshals the event held by the outbox item written by a transaction
+func outboxEvent(t *testing.T, item types.TransactWriteItem) events.Event {
+	require.NotNil(t, item.Put)
+	assert.Equal(t, "attribute_not_exists(sk)", *item.Put.ConditionExpression)
+
+	var stored outboxItem
+	require.NoError(t, attributevalue.UnmarshalMap(item.Put.Item, &stored))
+	assert.True(t, strings.HasPrefix(stored.PK, outboxPrefix))
+
+	var event events.Event
+	require.NoError(t, json.Unmarshal([]byte(stored.Event), &event))
+	assert.Equal(t, string(event.Type), stored.EventType)
+	assert.True(t, strings.HasSuffix(stored.SK, "#"+event.ID))
+	return event
+}
+
+// storedOutboxItem is an outbox item holding event
+func storedOutboxItem(t *testing.T, event events.Event) map[string]types.AttributeValue {
+	data, err := json.Marshal(event)
+	require.NoError(t, err)
+	item, err := attributevalue.MarshalMap(outboxItem{
+		PK:        outboxPrefix + event.AccountID,
+		SK:        event.OccurredAt.Format(models.HistoryTimeFormat) + "#" + event.ID,
+		EventID:   event.ID,
+		EventType: string(event.Type),
+		Event:     string(data),
+	})
+	require.NoError(t, err)
+	return item
+}
+
+func TestDynamoDBUnitRepository_CreateWritesOutboxEvent(t *testing.T) {
+	client := &fakeDynamoDB{}
+	repo := NewDynamoDBUnitRepository(client, "units").WithOutbox(true)
+	ctx := WithActor(context.Background(), models.Actor{Username: "jo"})
+
+	unit := &models.Unit{AccountID: "account-1", UnitType: "commercialVehicleType", Make: "Mack"}
+	require.NoError(t, repo.Create(ctx, unit))
+
+	assert.Empty(t, client.putInputs)
+	require.Len(t, client.transactInputs, 1)
+	items := client.transactInputs[0].TransactItems
+	require.Len(t, items, 2)
+
+	event := outboxEvent(t, items[1])
+	assert.Equal(t, outboxPrefix+"account-1", items[1].Put.Item["pk"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, events.UnitCreated, event.Type)
+	assert.Equal(t, unit.ID, event.UnitID)
+	assert.Equal(t, int64(1), event.Version)
+	assert.Equal(t, "jo", event.Actor.Username)
+	assert.Nil(t, event.Before)
+	require.NotNil(t, event.After)
+	assert.Equal(t, "Mack", event.After.Make)
+}
+
+func TestDynamoDBUnitRepository_PatchWritesHistoryAndOutboxEvent(t *testing.T) {
+	client := &fakeDynamoDB{
+		getItem: func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{Item: storedTractor(t)}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units").WithHistory(true).WithOutbox(true)
+
+	_, err := repo.Patch(context.Background(), "account-1", "unit-1", "commercialVehicleType", 3,
+		&models.UnitPatch{Set: map[string]interface{}{"note": "yard 7"}})
+	require.NoError(t, err)
+
+	require.Len(t, client.transactInputs, 1)
+	items := client.transactInputs[0].TransactItems
+	require.Len(t, items, 3)
+	require.NotNil(t, items[0].Update)
+	assert.Equal(t, models.HistoryUpdate, historyEntry(t, items[1]).Action)
+
+	event := outboxEvent(t, items[2])
+	assert.Equal(t, events.UnitUpdated, event.Type)
+	assert.Equal(t, int64(4), event.Version)
+	require.NotNil(t, event.Before)
+	assert.Equal(t, "yard 4", event.Before.Note)
+	assert.Equal(t, "yard 7", event.After.Note)
+}
+
+func TestDynamoDBUnitRepository_DeleteWritesOutboxEvent(t *testing.T) {
+	client := &fakeDynamoDB{
+		getItem: func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{Item: storedTractor(t)}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units").WithOutbox(true)
+
+	require.NoError(t, repo.Delete(context.Background(), "account-1", "unit-1", "commercialVehicleType", 3, "user-1"))
+
+	require.Len(t, client.transactInputs, 1)
+	event := outboxEvent(t, client.transactInputs[0].TransactItems[1])
+	assert.Equal(t, events.UnitDeleted, event.Type)
+	assert.False(t, event.Before.IsDeleted())
+	assert.True(t, event.After.IsDeleted())
+	assert.Equal(t, "user-1", event.After.DeletedBy)
+}
+
+func TestDynamoDBUnitRepository_TransactWriteWritesOutboxEvents(t *testing.T) {
+	client := &fakeDynamoDB{
+		batchGet: func(*dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+			return &dynamodb.BatchGetItemOutput{Responses: map[string][]map[string]types.AttributeValue{"units": {storedTractor(t)}}}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units").WithOutbox(true)
+
+	ops := []TransactOp{
+		{Type: TransactDelete, UnitKey: UnitKey{ID: "unit-1", UnitType: "commercialVehicleType"}, ExpectedVersion: 3},
+		{Type: TransactCreate, Unit: &models.Unit{UnitType: "commercialVehicleType", Make: "Volvo"}},
+	}
+	require.NoError(t, repo.TransactWrite(context.Background(), "account-1", ops, "user-1"))
+
+	require.Len(t, client.transactInputs, 1)
+	items := client.transactInputs[0].TransactItems
+	require.Len(t, items, 4)
+	assert.Equal(t, events.UnitDeleted, outboxEvent(t, items[1]).Type)
+	assert.Equal(t, events.UnitCreated, outboxEvent(t, items[3]).Type)
+}
+
+func TestOutboxRelay_Relay(t *testing.T) {
+	first := events.NewUnitEvent(models.HistoryCreate, nil, &models.Unit{AccountID: "account-1", ID: "unit-1", UnitType: "commercialVehicleType", Version: 1}, models.Actor{}, time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC))
+	second := events.NewUnitEvent(models.HistoryCreate, nil, &models.Unit{AccountID: "account-1", ID: "unit-2", UnitType: "commercialVehicleType", Version: 1}, models.Actor{}, time.Date(2026, 3, 1, 10, 0, 1, 0, time.UTC))
+	third := events.NewUnitEvent(models.HistoryCreate, nil, &models.Unit{AccountID: "account-1", ID: "unit-3", UnitType: "commercialVehicleType", Version: 1}, models.Actor{}, time.Date(2026, 3, 1, 10, 0, 2, 0, time.UTC))
+
+	var query *dynamodb.QueryInput
+	client := &fakeDynamoDB{
+		query: func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+			query = input
+			return &dynamodb.QueryOutput{
+				Items:        []map[string]types.AttributeValue{storedOutboxItem(t, *first), storedOutboxItem(t, *second), storedOutboxItem(t, *third)},
+				ScannedCount: 3,
+			}, nil
+		},
+	}
+	publisher := events.NewMemoryPublisher()
+	publisher.Fail = func(event events.Event) error {
+		if event.ID == second.ID {
+			return errors.New("throttled")
+		}
+		return nil
+	}
+
+	result, err := NewOutboxRelay(client, "units", publisher).Relay(context.Background(), OutboxRelayOptions{AccountID: "account-1"})
+	require.NoError(t, err)
+
+	require.NotNil(t, query)
+	assert.Equal(t, outboxPrefix+"account-1", query.ExpressionAttributeValues[":outbox"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, &OutboxRelayResult{Scanned: 3, Waiting: 3, Published: 1, Failed: 1, Held: 1}, result)
+
+	// The event after the failed one is held so the account's events stay in order
+	published := publisher.Events()
+	require.Len(t, published, 1)
+	assert.Equal(t, first.ID, published[0].ID)
+
+	// Only the published event leaves the outbox
+	require.Len(t, client.deleteInputs, 1)
+	assert.True(t, strings.HasSuffix(client.deleteInputs[0].Key["sk"].(*types.AttributeValueMemberS).Value, first.ID))
+}
+
+func TestOutboxRelay_RelayHoldsFailedAccountAcrossPages(t *testing.T) {
+	at := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	failing := events.NewUnitEvent(models.HistoryCreate, nil, &models.Unit{AccountID: "account-1", ID: "unit-1", UnitType: "commercialVehicleType", Version: 1}, models.Actor{}, at)
+	later := events.NewUnitEvent(models.HistoryUpdate, nil, &models.Unit{AccountID: "account-1", ID: "unit-1", UnitType: "commercialVehicleType", Version: 2}, models.Actor{}, at.Add(time.Second))
+	other := events.NewUnitEvent(models.HistoryCreate, nil, &models.Unit{AccountID: "account-2", ID: "unit-2", UnitType: "commercialVehicleType", Version: 1}, models.Actor{}, at)
+	otherLater := events.NewUnitEvent(models.HistoryUpdate, nil, &models.Unit{AccountID: "account-2", ID: "unit-2", UnitType: "commercialVehicleType", Version: 2}, models.Actor{}, at.Add(time.Second))
+
+	pages := [][]map[string]types.AttributeValue{
+		{storedOutboxItem(t, *failing), storedOutboxItem(t, *other), storedOutboxItem(t, *otherLater)},
+		{storedOutboxItem(t, *later)},
+	}
+	client := &fakeDynamoDB{
+		scan: func(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+			output := &dynamodb.ScanOutput{Items: pages[0], ScannedCount: int32(len(pages[0]))}
+			if input.ExclusiveStartKey == nil {
+				output.LastEvaluatedKey = map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: "page-2"}}
+			} else {
+				output.Items, output.ScannedCount = pages[1], int32(len(pages[1]))
+			}
+			return output, nil
+		},
+	}
+	var batches [][]string
+	publisher := events.NewMemoryPublisher()
+	publisher.Fail = func(event events.Event) error {
+		if event.ID == failing.ID {
+			return errors.New("throttled")
+		}
+		return nil
+	}
+
+	result, err := NewOutboxRelay(client, "units", recordingPublisher{publisher, &batches}).Relay(context.Background(), OutboxRelayOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, &OutboxRelayResult{Scanned: 4, Waiting: 4, Published: 2, Failed: 1, Held: 1}, result)
+
+	// Each call carries at most one event per account, and account-1 is not
+	// published again once its first event failed, even on a later page
+	assert.Equal(t, [][]string{{failing.ID, other.ID}, {otherLater.ID}}, batches)
+	require.Len(t, client.deleteInputs, 2)
+	assert.True(t, strings.HasSuffix(client.deleteInputs[0].Key["sk"].(*types.AttributeValueMemberS).Value, other.ID))
+	assert.True(t, strings.HasSuffix(client.deleteInputs[1].Key["sk"].(*types.AttributeValueMemberS).Value, otherLater.ID))
+}
+
+// recordingPublisher records the event IDs of each Publish call before passing it on
+type recordingPublisher struct {
+	events.Publisher
+	batches *[][]string
+}
+
+func (p recordingPublisher) Publish(ctx context.Context, batch []events.Event) error {
+	var ids []string
+	for _, event := range batch {
+		ids = append(ids, event.ID)
+	}
+	*p.batches = append(*p.batches, ids)
+	return p.Publisher.Publish(ctx, batch)
+}
+
+func TestOutboxRelay_RelayDryRun(t *testing.T) {
+	event := events.NewUnitEvent(models.HistoryDelete, nil, &models.Unit{AccountID: "account-2", ID: "unit-1", UnitType: "commercialVehicleType", Version: 2}, models.Actor{}, time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC))
+
+	var scan *dynamodb.ScanInput
+	client := &fakeDynamoDB{
+		scan: func(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+			scan = input
+			return &dynamodb.ScanOutput{Items: []map[string]types.AttributeValue{storedOutboxItem(t, *event)}, ScannedCount: 40}, nil
+		},
+	}
+	publisher := events.NewMemoryPublisher()
+
+	result, err := NewOutboxRelay(client, "units", publisher).Relay(context.Background(), OutboxRelayOptions{DryRun: true})
+	require.NoError(t, err)
+
+	require.NotNil(t, scan)
+	assert.Equal(t, "begins_with(pk, :outbox)", *scan.FilterExpression)
+	assert.Equal(t, &OutboxRelayResult{Scanned: 40, Waiting: 1}, result)
+	assert.Empty(t, publisher.Events())
+	assert.Empty(t, client.deleteInputs)
+}
@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// purgeDeletedItem permanently deletes an item, guarded on it being soft deleted
+func purgeDeletedItem(ctx context.Context, client DynamoDBAPI, tableName string, key map[string]types.AttributeValue, accountID, unitID, unitType string) error {
+	_, err := client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(tableName),
+		Key:                 key,
+		ConditionExpression: aws.String("attribute_exists(pk) AND deletedAt > :zero"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":zero": &types.AttributeValueMemberN{Value: "0"},
+		},
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err != nil {
+		var conditionalCheckFailedException *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailedException) {
+			if len(conditionalCheckFailedException.Item) == 0 {
+				return fmt.Errorf("%w: unit with id %s and type %s for account %s", ErrUnitNotFound, unitID, unitType, accountID)
+			}
+			return fmt.Errorf("%w: unit with id %s and type %s for account %s", ErrUnitNotDeleted, unitID, unitType, accountID)
+		}
+		return fmt.Errorf("failed to purge unit: %w", err)
+	}
+
+	return nil
+}
+
+// PurgeOptions controls a purge run
+type PurgeOptions struct {
+	// AccountID restricts the run to one account partition (Query); empty scans the whole table
+	AccountID string
+	// Retention is how long a unit must have been deleted before it is purged
+	Retention time.Duration
+	// DryRun counts expired units without deleting them
+	DryRun bool
+	// PageSize is the DynamoDB page size for each Query/Scan call
+	PageSize int32
+	// Now overrides the current time, for tests
+	Now time.Time
+}
+
+// PurgeResult summarizes a purge run
+type PurgeResult struct {
+	Scanned int `json:"scanned"`
+	Expired int `json:"expired"`
+	Purged  int `json:"purged"`
+	Skipped int `json:"skipped"`
+	Failed  int `json:"failed"`
+}
+
+// Purger permanently removes units that have been soft deleted for longer than
+// the retention period. It works on raw table items so it covers both legacy and
+// schema-driven units, and complements the DynamoDB TTL, which only removes items
+// within a few days of expiring and not those deleted before TTL was enabled.
+type Purger struct {
+	client    DynamoDBAPI
+	tableName string
+}
+
+// NewPurger creates a new purger for the units table
+func NewPurger(client DynamoDBAPI, tableName string) *Purger {
+	return &Purger{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+// PurgeExpired walks the table and deletes units soft deleted before now minus the retention period
+func (p *Purger) PurgeExpired(ctx context.Context, opts PurgeOptions) (*PurgeResult, error) {
+	if opts.Retention <= 0 {
+		return nil, errors.New("purge requires a positive retention period")
+	}
+
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	cutoff := strconv.FormatInt(now.Add(-opts.Retention).Unix(), 10)
+
+	result := &PurgeResult{}
+	var startKey map[string]types.AttributeValue
+
+	for {
+		items, scanned, lastKey, err := p.purgePage(ctx, opts.AccountID, cutoff, pageSize, startKey)
+		if err != nil {
+			return result, err
+		}
+		result.Scanned += scanned
+
+		for _, item := range items {
+			result.Expired++
+			if opts.DryRun {
+				continue
+			}
+			p.purgeItem(ctx, item, cutoff, result)
+		}
+
+		if lastKey == nil {
+			break
+		}
+		startKey = lastKey
+	}
+
+	return result, nil
+}
+
+// purgePage reads one page of expired item keys, querying a single partition when an account is given
+func (p *Purger) purgePage(ctx context.Context, accountID, cutoff string, pageSize int32, startKey map[string]types.AttributeValue) ([]map[string]types.AttributeValue, int, map[string]types.AttributeValue, error) {
+	filterExpression := "deletedAt > :zero AND deletedAt <= :cutoff"
+	values := map[string]types.AttributeValue{
+		":zero":   &types.AttributeValueMemberN{Value: "0"},
+		":cutoff": &types.AttributeValueMemberN{Value: cutoff},
+	}
+
+	if accountID != "" {
+		values[":accountId"] = &types.AttributeValueMemberS{Value: accountID}
+		output, err := p.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:                 aws.String(p.tableName),
+			KeyConditionExpression:    aws.String("pk = :accountId"),
+			FilterExpression:          aws.String(filterExpression),
+			ProjectionExpression:      aws.String("pk, sk"),
+			ExpressionAttributeValues: values,
+			Limit:                     aws.Int32(pageSize),
+			ExclusiveStartKey:         startKey,
+		})
+		if err != nil {
+			return nil, 0, nil, fmt.Errorf("failed to query units: %w", err)
+		}
+		return output.Items, int(output.ScannedCount), output.LastEvaluatedKey, nil
+	}
+
+	output, err := p.client.Scan(ctx, &dynamodb.ScanInput{
+		TableName:                 aws.String(p.tableName),
+		FilterExpression:          aws.String(filterExpression),
+		ProjectionExpression:      aws.String("pk, sk"),
+		ExpressionAttributeValues: values,
+		Limit:                     aws.Int32(pageSize),
+		ExclusiveStartKey:         startKey,
+	})
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to scan units: %w", err)
+	}
+	return output.Items, int(output.ScannedCount), output.LastEvaluatedKey, nil
+}
+
+// purgeItem deletes one expired item. The delete is guarded on the item still being
+// expired, so a unit restored since the page was read is skipped rather than lost.
+func (p *Purger) purgeItem(ctx context.Context, key map[string]types.AttributeValue, cutoff string, result *PurgeResult) {
+	_, err := p.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(p.tableName),
+		Key:                 map[string]types.AttributeValue{"pk": key["pk"], "sk": key["sk"]},
+		ConditionExpression: aws.String("deletedAt > :zero AND deletedAt <= :cutoff"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":zero":   &types.AttributeValueMemberN{Value: "0"},
+			":cutoff": &types.AttributeValueMemberN{Value: cutoff},
+		},
+	})
+	if err != nil {
+		var conditionalCheckFailedException *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailedException) {
+			result.Skipped++
+			return
+		}
+		log.Printf("Failed to purge item %v: %v", key["sk"], err)
+		result.Failed++
+		return
+	}
+	result.Purged++
+}
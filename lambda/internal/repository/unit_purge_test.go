@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func purgeKey(sk string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: "account-1"},
+		"sk": &types.AttributeValueMemberS{Value: sk},
+	}
+}
+
+func TestPurger_PurgeExpired(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	scanCalls := 0
+	client := &fakeDynamoDB{
+		scan: func(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+			scanCalls++
+			assert.Equal(t, "deletedAt > :zero AND deletedAt <= :cutoff", *input.FilterExpression)
+			assert.Equal(t, &types.AttributeValueMemberN{Value: "1699913600"}, input.ExpressionAttributeValues[":cutoff"])
+			if input.ExclusiveStartKey == nil {
+				return &dynamodb.ScanOutput{
+					Items:            []map[string]types.AttributeValue{purgeKey("unit-1#truck"), purgeKey("unit-2#truck")},
+					ScannedCount:     5,
+					LastEvaluatedKey: purgeKey("unit-2#truck"),
+				}, nil
+			}
+			return &dynamodb.ScanOutput{
+				Items:        []map[string]types.AttributeValue{purgeKey("trailerType#unit-3")},
+				ScannedCount: 3,
+			}, nil
+		},
+		deleteItem: func(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+			switch input.Key["sk"].(*types.AttributeValueMemberS).Value {
+			case "unit-2#truck":
+				// Restored after the page was read
+				return nil, &types.ConditionalCheckFailedException{}
+			case "trailerType#unit-3":
+				return nil, errors.New("throttled")
+			}
+			return &dynamodb.DeleteItemOutput{}, nil
+		},
+	}
+
+	result, err := NewPurger(client, "units").PurgeExpired(context.Background(), PurgeOptions{Retention: 24 * time.Hour, Now: now})
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, scanCalls)
+	assert.Equal(t, &PurgeResult{Scanned: 8, Expired: 3, Purged: 1, Skipped: 1, Failed: 1}, result)
+	require.Len(t, client.deleteInputs, 3)
+	assert.Equal(t, "deletedAt > :zero AND deletedAt <= :cutoff", *client.deleteInputs[0].ConditionExpression)
+}
+
+func TestPurger_PurgeExpiredAccountDryRun(t *testing.T) {
+	var captured *dynamodb.QueryInput
+	client := &fakeDynamoDB{
+		query: func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+			captured = input
+			return &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{purgeKey("unit-1#truck")}, ScannedCount: 1}, nil
+		},
+	}
+
+	result, err := NewPurger(client, "units").PurgeExpired(context.Background(), PurgeOptions{AccountID: "account-1", Retention: time.Hour, DryRun: true})
+	require.NoError(t, err)
+
+	require.NotNil(t, captured)
+	assert.Equal(t, "pk = :accountId", *captured.KeyConditionExpression)
+	assert.Equal(t, &PurgeResult{Scanned: 1, Expired: 1}, result)
+	assert.Empty(t, client.deleteInputs)
+}
+
+func TestPurger_RequiresRetention(t *testing.T) {
+	_, err := NewPurger(&fakeDynamoDB{}, "units").PurgeExpired(context.Background(), PurgeOptions{})
+	require.Error(t, err)
+}
+
+func TestDynamoDBUnitRepository_Purge(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantErr error
+	}{
+		{name: "deleted unit"},
+		{name: "missing unit", err: &types.ConditionalCheckFailedException{}, wantErr: ErrUnitNotFound},
+		{
+			name:    "live unit",
+			err:     &types.ConditionalCheckFailedException{Item: map[string]types.AttributeValue{"deletedAt": &types.AttributeValueMemberN{Value: "0"}}},
+			wantErr: ErrUnitNotDeleted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeDynamoDB{
+				deleteItem: func(*dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+					return &dynamodb.DeleteItemOutput{}, tt.err
+				},
+			}
+			repo := NewDynamoDBUnitRepository(client, "units")
+
+			err := repo.Purge(context.Background(), "account-1", "unit-1", "commercialVehicleType")
+			if tt.wantErr == nil {
+				require.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+
+			require.Len(t, client.deleteInputs, 1)
+			assert.Equal(t, "attribute_exists(pk) AND deletedAt > :zero", *client.deleteInputs[0].ConditionExpression)
+			assert.Equal(t, &types.AttributeValueMemberS{Value: "unit-1#commercialVehicleType"}, client.deleteInputs[0].Key["sk"])
+		})
+	}
+}
@@ -2,6 +2,10 @@ package repository
 
 import (
 	"context"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 
 	"github.com/steverhoton/unt-units-svc/internal/models"
 	"github.com/steverhoton/unt-units-svc/pkg/appsync"
@@ -15,18 +19,70 @@ type UnitRepository interface {
 	// GetByKey retrieves a unit by its composite primary key (accountID + unitID + unitType)
 	GetByKey(ctx context.Context, accountID, unitID, unitType string) (*models.Unit, error)
 
-	// Update updates an existing unit in the repository
+	// GetAsOf rebuilds a unit as it was at asOf from its history, or returns nil if it did not exist or was deleted then
+	GetAsOf(ctx context.Context, accountID, unitID, unitType string, asOf time.Time) (*models.Unit, error)
+
+	// Update updates an existing unit in the repository, expecting unit.Version to be current
 	Update(ctx context.Context, unit *models.Unit) error
 
-	// Delete soft deletes a unit (marks deletedAt timestamp)
-	Delete(ctx context.Context, accountID, unitID, unitType string) error
+	// Patch applies a partial update to an existing unit at expectedVersion and returns the updated unit
+	Patch(ctx context.Context, accountID, unitID, unitType string, expectedVersion int64, patch *models.UnitPatch) (*models.Unit, error)
+
+	// Delete soft deletes a unit at expectedVersion (marks deletedAt and deletedBy)
+	Delete(ctx context.Context, accountID, unitID, unitType string, expectedVersion int64, deletedBy string) error
+
+	// Restore undeletes a soft deleted unit at expectedVersion and returns the restored unit
+	Restore(ctx context.Context, accountID, unitID, unitType string, expectedVersion int64) (*models.Unit, error)
+
+	// Purge permanently removes a soft deleted unit
+	Purge(ctx context.Context, accountID, unitID, unitType string) error
 
 	// List retrieves a paginated list of units for an account
 	List(ctx context.Context, input *appsync.ListUnitsInput) (*appsync.ListUnitsResponse, error)
 
+	// ListDeleted retrieves a paginated list of the soft deleted units for an account
+	ListDeleted(ctx context.Context, input *appsync.ListUnitsInput) (*appsync.ListUnitsResponse, error)
+
 	// Exists checks if a unit exists by its composite primary key
 	Exists(ctx context.Context, accountID, unitID, unitType string) (bool, error)
 
 	// GetByUnitID retrieves all units with the given unit ID across all accounts and types
 	GetByUnitID(ctx context.Context, unitID string) ([]models.Unit, error)
+
+	// GetByVin retrieves the live unit with the given VIN in an account, or nil if there is none
+	GetByVin(ctx context.Context, accountID, vin string) (*models.Unit, error)
+
+	// SearchByVin retrieves a paginated list of the live units whose VIN starts with a prefix
+	SearchByVin(ctx context.Context, input *appsync.SearchUnitsByVinInput) (*appsync.ListUnitsResponse, error)
+
+	// BatchGet retrieves many live units of an account by key, returning one unit and one error per key; the unit is nil where the key was not found
+	BatchGet(ctx context.Context, accountID string, keys []UnitKey) ([]*models.Unit, []error)
+
+	// BatchCreate creates many new units with batched writes and returns one error per unit, nil where it was created
+	BatchCreate(ctx context.Context, units []*models.Unit) []error
+
+	// BatchDelete soft deletes many units of an account, each at its expected version, and returns one error per key, nil where it was deleted
+	BatchDelete(ctx context.Context, accountID string, keys []DeleteKey, deletedBy string) []error
+
+	// TransactWrite applies creates, updates, deletes and condition checks to units of an account all together or not at all
+	TransactWrite(ctx context.Context, accountID string, ops []TransactOp, deletedBy string) error
+
+	// Export writes every live unit of an account to w in the requested format
+	Export(ctx context.Context, opts ExportOptions, w io.Writer) (*ExportResult, error)
+
+	// GetHistory retrieves a paginated list of the recorded changes to a unit, newest first
+	GetHistory(ctx context.Context, input *appsync.GetUnitHistoryInput) (*appsync.UnitHistoryResponse, error)
+}
+
+// DynamoDBAPI is the subset of the DynamoDB client used by the repositories
+type DynamoDBAPI interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+	BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+	TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
 }
@@ -0,0 +1,348 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+)
+
+// MaxTransactItems is the most items DynamoDB accepts in one TransactWriteItems call
+const MaxTransactItems = 100
+
+// TransactOpType is the kind of an operation in a transaction
+type TransactOpType string
+
+const (
+	TransactCreate         TransactOpType = "CREATE"
+	TransactUpdate         TransactOpType = "UPDATE"
+	TransactDelete         TransactOpType = "DELETE"
+	TransactConditionCheck TransactOpType = "CONDITION_CHECK"
+)
+
+// TransactOp is one operation of a transaction on the units of an account
+type TransactOp struct {
+	Type TransactOpType
+
+	// UnitKey is the unit updated, deleted or checked. A created unit takes its key
+	// from Unit, and is given a new ID when it has none.
+	UnitKey
+
+	// ExpectedVersion is the version an updated, deleted or checked unit must be at
+	ExpectedVersion int64
+
+	Unit  *models.Unit      // The unit to create
+	Patch *models.UnitPatch // The fields to change on update
+}
+
+// transactItem is an item of a transaction and the operation it belongs to. A
+// created unit with a VIN has a second item reserving the VIN, an update changing
+// the VIN has items reserving the new VIN and releasing the old one, and when
+// history or the event outbox is on every write has one more item for each
+// recording it.
+type transactItem struct {
+	op        int
+	vinGuard  bool
+	record    bool
+	writeItem types.TransactWriteItem
+}
+
+// TransactWrite applies ops to units of an account with one TransactWriteItems
+// call, so either every operation is applied or none is. Updates patch the unit
+// and deletes are soft deletes, as Patch and Delete do; a condition check only
+// requires a live unit at its expected version. Each created unit with a VIN
+// also reserves the VIN, which takes one more of the MaxTransactItems items, as
+// do the history and outbox items of each write when those are on, and the
+// reservation and release of the VIN of an update that changes it. Updated and
+// deleted units are then read first, and operations on units that are missing,
+// deleted or at another version fail without sending the transaction.
+//
+// When the transaction is canceled the error is a TransactionCanceledError that
+// explains the failure of each operation at fault.
+func (r *DynamoDBUnitRepository) TransactWrite(ctx context.Context, accountID string, ops []TransactOp, deletedBy string) error {
+	if accountID == "" {
+		return errors.New("accountID is required")
+	}
+	if len(ops) == 0 {
+		return errors.New("transaction has no operations")
+	}
+
+	opErrs := make([]error, len(ops))
+	var items []transactItem
+	units := make(map[string]int, len(ops))
+	vins := make(map[string]string)
+	failed := false
+
+	// Recording writes, or moving the reservation of a VIN an update changes, needs
+	// the stored units
+	var stored []*models.Unit
+	if r.recording() || changesVin(ops) {
+		stored, opErrs = r.readTransactUnits(ctx, accountID, ops)
+	}
+
+	for i, op := range ops {
+		if opErrs[i] != nil {
+			failed = true
+			continue
+		}
+		opItems, err := r.transactItems(ctx, accountID, i, op, deletedBy)
+		if err == nil {
+			// DynamoDB rejects a transaction that writes an item twice
+			unit := op.ID + "#" + op.UnitType
+			if op.Type == TransactCreate {
+				unit = op.Unit.ID + "#" + op.Unit.UnitType
+			}
+			if first, ok := units[unit]; ok {
+				err = fmt.Errorf("unit is already written by operation %d", first)
+			} else {
+				units[unit] = i
+			}
+		}
+		if err == nil && op.Type == TransactUpdate && op.Patch.ChangesVin() {
+			var moves []transactItem
+			moves, err = r.transactVinItems(ctx, i, stored[i], op.Patch, opItems[0].writeItem)
+			opItems = append(opItems, moves...)
+		}
+		if err == nil {
+			// Two operations cannot reserve the same VIN
+			for _, item := range opItems {
+				if !item.vinGuard || item.writeItem.Put == nil {
+					continue
+				}
+				var reserved vinHolder
+				if err = attributevalue.UnmarshalMap(item.writeItem.Put.Item, &reserved); err != nil {
+					err = fmt.Errorf("failed to read VIN reservation: %w", err)
+					break
+				}
+				if holder, ok := vins[reserved.Vin]; ok {
+					err = &DuplicateVinError{Vin: reserved.Vin, UnitID: holder}
+					break
+				}
+				vins[reserved.Vin] = reserved.UnitID
+			}
+		}
+		if err == nil && r.recording() && op.Type != TransactConditionCheck {
+			var records []transactItem
+			records, err = r.transactRecordItems(ctx, i, op, stored[i], opItems[0].writeItem, deletedBy)
+			opItems = append(opItems, records...)
+		}
+		if err != nil {
+			opErrs[i] = err
+			failed = true
+			continue
+		}
+		items = append(items, opItems...)
+	}
+	if failed {
+		return &TransactionCanceledError{Errors: opErrs}
+	}
+	if len(items) > MaxTransactItems {
+		return fmt.Errorf("transaction has %d items; at most %d are allowed", len(items), MaxTransactItems)
+	}
+
+	writeItems := make([]types.TransactWriteItem, len(items))
+	for k, item := range items {
+		writeItems[k] = item.writeItem
+	}
+	_, err := r.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: writeItems})
+	if err != nil {
+		var canceled *types.TransactionCanceledException
+		if !errors.As(err, &canceled) || len(canceled.CancellationReasons) != len(items) {
+			return fmt.Errorf("failed to write transaction: %w", err)
+		}
+
+		for k, reason := range canceled.CancellationReasons {
+			item := items[k]
+			// A unit's own failure explains more than that of its VIN reservation or records
+			if opErrs[item.op] != nil && (item.vinGuard || item.record) {
+				continue
+			}
+			if reasonErr := transactFailure(accountID, ops[item.op], item, reason); reasonErr != nil {
+				opErrs[item.op] = reasonErr
+			}
+		}
+		return &TransactionCanceledError{Errors: opErrs}
+	}
+
+	log.Printf("Transaction of %d operations applied for account %s", len(ops), accountID)
+	return nil
+}
+
+// transactItems builds the items of operation i of a transaction
+func (r *DynamoDBUnitRepository) transactItems(ctx context.Context, accountID string, i int, op TransactOp, deletedBy string) ([]transactItem, error) {
+	switch op.Type {
+	case TransactCreate:
+		return r.transactCreateItems(ctx, accountID, i, op.Unit)
+
+	case TransactUpdate:
+		input, err := r.patchInput(accountID, op.ID, op.UnitType, op.ExpectedVersion, op.Patch)
+		if err != nil {
+			return nil, err
+		}
+		return []transactItem{{op: i, writeItem: types.TransactWriteItem{Update: transactUpdate(input)}}}, nil
+
+	case TransactDelete:
+		input, err := r.softDeleteInput(accountID, op.ID, op.UnitType, op.ExpectedVersion, deletedBy)
+		if err != nil {
+			return nil, err
+		}
+		return []transactItem{{op: i, writeItem: types.TransactWriteItem{Update: transactUpdate(input)}}}, nil
+
+	case TransactConditionCheck:
+		if op.ID == "" {
+			return nil, errors.New("unitID is required")
+		}
+		if op.UnitType == "" {
+			return nil, errors.New("unitType is required")
+		}
+		names := map[string]string{}
+		values := map[string]types.AttributeValue{
+			":zero": &types.AttributeValueMemberN{Value: "0"},
+		}
+		condition := "attribute_exists(pk) AND attribute_exists(sk) AND (attribute_not_exists(deletedAt) OR deletedAt = :zero) AND " +
+			versionCondition(op.ExpectedVersion, names, values)
+		return []transactItem{{op: i, writeItem: types.TransactWriteItem{ConditionCheck: &types.ConditionCheck{
+			TableName:                           aws.String(r.tableName),
+			Key:                                 (&models.Unit{AccountID: accountID, ID: op.ID, UnitType: op.UnitType}).GetKey(),
+			ConditionExpression:                 aws.String(condition),
+			ExpressionAttributeNames:            names,
+			ExpressionAttributeValues:           values,
+			ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+		}}}}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported operation type: %s", op.Type)
+	}
+}
+
+// transactCreateItems builds the put of a new unit, as Create writes it, and the put
+// reserving its VIN. The VIN is checked first so that a stale reservation can be
+// taken over within the transaction.
+func (r *DynamoDBUnitRepository) transactCreateItems(ctx context.Context, accountID string, i int, unit *models.Unit) ([]transactItem, error) {
+	if unit == nil {
+		return nil, errors.New("unit cannot be nil")
+	}
+	unit.AccountID = accountID
+	if unit.UnitType == "" {
+		return nil, errors.New("unitType is required")
+	}
+	if unit.ID == "" {
+		unit.GenerateID()
+	}
+	unit.SetTimestamps()
+	unit.Version = 1
+	unit.ClearDeletion()
+	unit.SortKey = unit.GetSortKey()
+	unit.SetVin()
+
+	item, err := attributevalue.MarshalMap(unit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal unit: %w", err)
+	}
+	items := []transactItem{{op: i, writeItem: types.TransactWriteItem{Put: &types.Put{
+		TableName:           aws.String(r.tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(pk) AND attribute_not_exists(sk)"),
+	}}}}
+	if unit.Vin == "" {
+		return items, nil
+	}
+
+	put, err := r.vinGuardPut(ctx, unit)
+	if err != nil {
+		return nil, err
+	}
+	return append(items, transactItem{op: i, vinGuard: true, writeItem: types.TransactWriteItem{Put: put}}), nil
+}
+
+// changesVin reports whether any update of a transaction sets or clears a VIN
+func changesVin(ops []TransactOp) bool {
+	for _, op := range ops {
+		if op.Type == TransactUpdate && op.Patch != nil && op.Patch.ChangesVin() {
+			return true
+		}
+	}
+	return false
+}
+
+// transactVinItems builds the items of operation i of a transaction that move the
+// VIN reservation of the unit its patch updates, whose stored unit is before and
+// whose write to the unit is write
+func (r *DynamoDBUnitRepository) transactVinItems(ctx context.Context, i int, before *models.Unit, patch *models.UnitPatch, write types.TransactWriteItem) ([]transactItem, error) {
+	after, err := patchedUnit(before, patch, write.Update.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	moves, err := r.vinMoveItems(ctx, before, after)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]transactItem, 0, len(moves))
+	for _, move := range moves {
+		items = append(items, transactItem{op: i, vinGuard: true, writeItem: move})
+	}
+	return items, nil
+}
+
+// transactUpdate turns an UpdateItem input into a transaction item
+func transactUpdate(input *dynamodb.UpdateItemInput) *types.Update {
+	return &types.Update{
+		TableName:                           input.TableName,
+		Key:                                 input.Key,
+		UpdateExpression:                    input.UpdateExpression,
+		ConditionExpression:                 input.ConditionExpression,
+		ExpressionAttributeNames:            input.ExpressionAttributeNames,
+		ExpressionAttributeValues:           input.ExpressionAttributeValues,
+		ReturnValuesOnConditionCheckFailure: input.ReturnValuesOnConditionCheckFailure,
+	}
+}
+
+// transactPut turns a PutItem input into a transaction item
+func transactPut(input *dynamodb.PutItemInput) *types.Put {
+	return &types.Put{
+		TableName:                           input.TableName,
+		Item:                                input.Item,
+		ConditionExpression:                 input.ConditionExpression,
+		ExpressionAttributeNames:            input.ExpressionAttributeNames,
+		ExpressionAttributeValues:           input.ExpressionAttributeValues,
+		ReturnValuesOnConditionCheckFailure: input.ReturnValuesOnConditionCheckFailure,
+	}
+}
+
+// transactFailure explains the cancellation reason of one item of a transaction,
+// or returns nil when the item did not cause the cancellation
+func transactFailure(accountID string, op TransactOp, item transactItem, reason types.CancellationReason) error {
+	switch code := aws.ToString(reason.Code); code {
+	case "", "None":
+		return nil
+
+	case "ConditionalCheckFailed":
+		switch {
+		case item.record && isOutboxItem(item.writeItem.Put.Item):
+			return fmt.Errorf("outbox already has an event for this change of unit %s", op.ID)
+		case item.record:
+			return fmt.Errorf("history of unit %s already has an entry for this change", op.ID)
+		case item.vinGuard:
+			return vinGuardFailure(item.writeItem, reason)
+		case op.Type == TransactCreate:
+			return fmt.Errorf("%w: unit with id %s and type %s for account %s", ErrUnitAlreadyExists, op.Unit.ID, op.Unit.UnitType, accountID)
+		case op.Type == TransactDelete:
+			return deleteConditionFailure(reason.Item, op.ExpectedVersion, accountID, op.ID, op.UnitType)
+		default:
+			return conditionFailure(reason.Item, op.ExpectedVersion, accountID, op.ID, op.UnitType)
+		}
+
+	case "TransactionConflict":
+		return ErrTransactionConflict
+
+	default:
+		return fmt.Errorf("%s: %s", code, aws.ToString(reason.Message))
+	}
+}
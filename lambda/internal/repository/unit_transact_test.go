@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+)
+
+// swapOps moves a trailer from one tractor to another and checks the trailer is unchanged
+func swapOps() []TransactOp {
+	return []TransactOp{
+		{Type: TransactUpdate, UnitKey: UnitKey{ID: "tractor-1", UnitType: "commercialVehicleType"}, ExpectedVersion: 3,
+			Patch: &models.UnitPatch{Set: map[string]interface{}{"note": ""}}},
+		{Type: TransactUpdate, UnitKey: UnitKey{ID: "tractor-2", UnitType: "commercialVehicleType"}, ExpectedVersion: 7,
+			Patch: &models.UnitPatch{Set: map[string]interface{}{"note": "trailer-9"}}},
+		{Type: TransactConditionCheck, UnitKey: UnitKey{ID: "trailer-9", UnitType: "commercialVehicleType"}, ExpectedVersion: 2},
+	}
+}
+
+func TestDynamoDBUnitRepository_TransactWrite(t *testing.T) {
+	client := &fakeDynamoDB{}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	created := &models.Unit{UnitType: "commercialVehicleType", SuggestedVin: "1m1an07y9gm012345", Make: "Mack"}
+	ops := append(swapOps(),
+		TransactOp{Type: TransactCreate, Unit: created},
+		TransactOp{Type: TransactDelete, UnitKey: UnitKey{ID: "tractor-3", UnitType: "commercialVehicleType"}, ExpectedVersion: 1},
+	)
+
+	err := repo.TransactWrite(context.Background(), "account-1", ops, "user-1")
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, created.ID)
+	assert.Equal(t, "account-1", created.AccountID)
+	assert.Equal(t, int64(1), created.Version)
+
+	require.Len(t, client.transactInputs, 1)
+	items := client.transactInputs[0].TransactItems
+	require.Len(t, items, 6)
+
+	require.NotNil(t, items[0].Update)
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "3"}, items[0].Update.ExpressionAttributeValues[":expectedVersion"])
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "tractor-2#commercialVehicleType"}, items[1].Update.Key["sk"])
+
+	require.NotNil(t, items[2].ConditionCheck)
+	assert.Equal(t, "attribute_exists(pk) AND attribute_exists(sk) AND (attribute_not_exists(deletedAt) OR deletedAt = :zero) AND #version = :expectedVersion",
+		*items[2].ConditionCheck.ConditionExpression)
+
+	require.NotNil(t, items[3].Put)
+	assert.Equal(t, "attribute_not_exists(pk) AND attribute_not_exists(sk)", *items[3].Put.ConditionExpression)
+	require.NotNil(t, items[4].Put)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "VIN#account-1"}, items[4].Put.Item["pk"])
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "1M1AN07Y9GM012345"}, items[4].Put.Item["sk"])
+	assert.Equal(t, "attribute_not_exists(pk)", *items[4].Put.ConditionExpression)
+
+	require.NotNil(t, items[5].Update)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "user-1"}, items[5].Update.ExpressionAttributeValues[":deletedBy"])
+}
+
+func TestDynamoDBUnitRepository_TransactWriteMapsCancellationReasons(t *testing.T) {
+	current := mustMarshalItem(t, map[string]interface{}{
+		"pk": "account-1", "sk": "tractor-2#commercialVehicleType", "id": "tractor-2", "unitType": "commercialVehicleType", "version": 8,
+	})
+	client := &fakeDynamoDB{
+		transact: func(*dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+			return nil, &types.TransactionCanceledException{CancellationReasons: []types.CancellationReason{
+				{Code: aws.String("None")},
+				{Code: aws.String("ConditionalCheckFailed"), Item: current},
+				{Code: aws.String("ConditionalCheckFailed")},
+			}}
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	err := repo.TransactWrite(context.Background(), "account-1", swapOps(), "user-1")
+
+	var canceled *TransactionCanceledError
+	require.ErrorAs(t, err, &canceled)
+	require.Len(t, canceled.Errors, 3)
+	assert.NoError(t, canceled.Errors[0])
+	var conflict *VersionConflictError
+	require.ErrorAs(t, canceled.Errors[1], &conflict)
+	assert.Equal(t, int64(7), conflict.ExpectedVersion)
+	assert.Equal(t, int64(8), conflict.CurrentVersion)
+	assert.ErrorIs(t, canceled.Errors[2], ErrUnitNotFound)
+	assert.Contains(t, err.Error(), "transaction canceled: operation 1: version conflict")
+
+	client.transact = func(*dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+		return nil, &types.TransactionCanceledException{CancellationReasons: []types.CancellationReason{
+			{Code: aws.String("TransactionConflict")},
+			{Code: aws.String("None")},
+			{Code: aws.String("ValidationError"), Message: aws.String("item too large")},
+		}}
+	}
+	err = repo.TransactWrite(context.Background(), "account-1", swapOps(), "user-1")
+	require.ErrorAs(t, err, &canceled)
+	assert.ErrorIs(t, canceled.Errors[0], ErrTransactionConflict)
+	assert.NoError(t, canceled.Errors[1])
+	assert.EqualError(t, canceled.Errors[2], "ValidationError: item too large")
+
+	client.transact = func(*dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+		return nil, errors.New("throttled")
+	}
+	err = repo.TransactWrite(context.Background(), "account-1", swapOps(), "user-1")
+	assert.EqualError(t, err, "failed to write transaction: throttled")
+}
+
+func TestDynamoDBUnitRepository_TransactWriteCreateFailures(t *testing.T) {
+	guard := mustMarshalItem(t, map[string]interface{}{
+		"pk": "VIN#account-1", "sk": "1M1AN07Y9GM012345", "unitId": "unit-0", "unitType": "commercialVehicleType",
+	})
+	client := &fakeDynamoDB{
+		transact: func(*dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+			return nil, &types.TransactionCanceledException{CancellationReasons: []types.CancellationReason{
+				{Code: aws.String("ConditionalCheckFailed")},
+				{Code: aws.String("None")},
+				{Code: aws.String("None")},
+				{Code: aws.String("ConditionalCheckFailed"), Item: guard},
+			}}
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	ops := []TransactOp{
+		{Type: TransactCreate, Unit: &models.Unit{ID: "unit-1", UnitType: "commercialVehicleType", SuggestedVin: "1HGBH41JXMN109186"}},
+		{Type: TransactCreate, Unit: &models.Unit{ID: "unit-2", UnitType: "commercialVehicleType", SuggestedVin: "1M1AN07Y9GM012345"}},
+	}
+	err := repo.TransactWrite(context.Background(), "account-1", ops, "user-1")
+
+	var canceled *TransactionCanceledError
+	require.ErrorAs(t, err, &canceled)
+	assert.ErrorIs(t, canceled.Errors[0], ErrUnitAlreadyExists, "the unit's own failure wins over its VIN reservation's")
+	var duplicate *DuplicateVinError
+	require.ErrorAs(t, canceled.Errors[1], &duplicate)
+	assert.Equal(t, "unit-0", duplicate.UnitID)
+}
+
+func TestDynamoDBUnitRepository_TransactWriteRejectsBeforeSending(t *testing.T) {
+	client := &fakeDynamoDB{
+		getItem: func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			if input.Key["pk"].(*types.AttributeValueMemberS).Value == "VIN#account-1" {
+				return &dynamodb.GetItemOutput{Item: mustMarshalItem(t, map[string]interface{}{
+					"pk": "VIN#account-1", "sk": "1M1AN07Y9GM012345", "unitId": "unit-0", "unitType": "commercialVehicleType",
+				})}, nil
+			}
+			// The reservation's unit still holds the VIN
+			return &dynamodb.GetItemOutput{Item: mustMarshalItem(t, map[string]interface{}{"suggestedVin": "1M1AN07Y9GM012345"})}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	ops := append(swapOps(),
+		TransactOp{Type: TransactDelete, UnitKey: UnitKey{ID: "tractor-1", UnitType: "commercialVehicleType"}, ExpectedVersion: 3},
+		TransactOp{Type: TransactCreate, Unit: &models.Unit{UnitType: "commercialVehicleType", SuggestedVin: "1M1AN07Y9GM012345"}},
+		TransactOp{Type: "UPSERT"},
+		TransactOp{Type: TransactUpdate, UnitKey: UnitKey{ID: "tractor-4", UnitType: "commercialVehicleType"}, ExpectedVersion: 1, Patch: &models.UnitPatch{}},
+	)
+	err := repo.TransactWrite(context.Background(), "account-1", ops, "user-1")
+
+	var canceled *TransactionCanceledError
+	require.ErrorAs(t, err, &canceled)
+	require.Len(t, canceled.Errors, 7)
+	assert.NoError(t, canceled.Errors[0])
+	assert.EqualError(t, canceled.Errors[3], "unit is already written by operation 0")
+	var duplicate *DuplicateVinError
+	assert.ErrorAs(t, canceled.Errors[4], &duplicate)
+	assert.EqualError(t, canceled.Errors[5], "unsupported operation type: UPSERT")
+	assert.EqualError(t, canceled.Errors[6], "patch has no fields to update")
+	assert.Empty(t, client.transactInputs)
+
+	err = repo.TransactWrite(context.Background(), "account-1", nil, "user-1")
+	assert.EqualError(t, err, "transaction has no operations")
+
+	many := make([]TransactOp, MaxTransactItems+1)
+	for i := range many {
+		many[i] = TransactOp{Type: TransactCreate, Unit: &models.Unit{UnitType: "commercialVehicleType"}}
+	}
+	err = repo.TransactWrite(context.Background(), "account-1", many, "user-1")
+	assert.EqualError(t, err, "transaction has 101 items; at most 100 are allowed")
+}
@@ -0,0 +1,374 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+const (
+	// vinIndexName is the GSI on account (pk) and normalized VIN (vin)
+	vinIndexName = "account-vin-index"
+
+	// vinGuardPrefix starts the partition key of the items that reserve a VIN within
+	// an account. They live outside the account partition so listings never see them.
+	vinGuardPrefix = "VIN#"
+
+	// MinVinPrefixLength and MaxVinPrefixLength bound searchUnitsByVin prefixes: the
+	// manufacturer and vehicle descriptor (8) up to the plant code (11)
+	MinVinPrefixLength = 8
+	MaxVinPrefixLength = 11
+)
+
+// vinGuardKey returns the key of the item reserving vin in an account
+func vinGuardKey(accountID, vin string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: vinGuardPrefix + accountID},
+		"sk": &types.AttributeValueMemberS{Value: vin},
+	}
+}
+
+// createWithVinGuard writes a new unit together with the item reserving its VIN in
+// one transaction, so two units in an account cannot be created with the same VIN.
+// A reservation left by a unit that no longer holds the VIN (expired, purged or
+// given a new VIN) is taken over. extra items, such as the unit's history and
+// outbox items, are written in the same transaction.
+func (r *DynamoDBUnitRepository) createWithVinGuard(ctx context.Context, unit *models.Unit, item map[string]types.AttributeValue, extra ...types.TransactWriteItem) error {
+	guard := vinGuardKey(unit.AccountID, unit.Vin)
+	guard["unitId"] = &types.AttributeValueMemberS{Value: unit.ID}
+	guard["unitType"] = &types.AttributeValueMemberS{Value: unit.UnitType}
+
+	guardCondition := "attribute_not_exists(pk)"
+	var guardValues map[string]types.AttributeValue
+
+	// At most one takeover of a stale reservation
+	for attempt := 0; attempt < 2; attempt++ {
+		items := []types.TransactWriteItem{
+			{Put: &types.Put{
+				TableName:           aws.String(r.tableName),
+				Item:                item,
+				ConditionExpression: aws.String("attribute_not_exists(pk) AND attribute_not_exists(sk)"),
+			}},
+			{Put: &types.Put{
+				TableName:                           aws.String(r.tableName),
+				Item:                                guard,
+				ConditionExpression:                 aws.String(guardCondition),
+				ExpressionAttributeValues:           guardValues,
+				ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+			}},
+		}
+		_, err := r.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: append(items, extra...),
+		})
+		if err == nil {
+			return nil
+		}
+
+		var canceled *types.TransactionCanceledException
+		if !errors.As(err, &canceled) || len(canceled.CancellationReasons) != len(items)+len(extra) {
+			return fmt.Errorf("failed to create unit: %w", err)
+		}
+		if aws.ToString(canceled.CancellationReasons[0].Code) == "ConditionalCheckFailed" {
+			return fmt.Errorf("unit with id %s and type %s already exists for account %s", unit.ID, unit.UnitType, unit.AccountID)
+		}
+		if aws.ToString(canceled.CancellationReasons[1].Code) != "ConditionalCheckFailed" {
+			return fmt.Errorf("failed to create unit: %w", err)
+		}
+
+		var holder vinHolder
+		if err := attributevalue.UnmarshalMap(canceled.CancellationReasons[1].Item, &holder); err != nil {
+			return fmt.Errorf("failed to read VIN reservation: %w", err)
+		}
+
+		held, err := r.holdsVin(ctx, unit.AccountID, holder.UnitID, holder.UnitType, unit.Vin)
+		if err != nil {
+			return err
+		}
+		if held {
+			return &DuplicateVinError{Vin: unit.Vin, UnitID: holder.UnitID}
+		}
+
+		log.Printf("Taking over stale VIN %s reservation from unit %s for account %s", unit.Vin, holder.UnitID, unit.AccountID)
+		guardCondition = "unitId = :heldBy AND unitType = :heldType"
+		guardValues = map[string]types.AttributeValue{
+			":heldBy":   &types.AttributeValueMemberS{Value: holder.UnitID},
+			":heldType": &types.AttributeValueMemberS{Value: holder.UnitType},
+		}
+	}
+
+	return fmt.Errorf("failed to create unit: VIN %s reservation changed concurrently", unit.Vin)
+}
+
+// vinGuardPut builds the put reserving a unit's VIN. The reservation is read
+// first: a VIN another unit holds fails with a DuplicateVinError, and a stale
+// reservation is taken over by conditioning the put on its holder.
+func (r *DynamoDBUnitRepository) vinGuardPut(ctx context.Context, unit *models.Unit) (*types.Put, error) {
+	stale, err := r.staleVinReservation(ctx, unit.AccountID, unit.Vin)
+	if err != nil {
+		return nil, err
+	}
+	guard := vinGuardKey(unit.AccountID, unit.Vin)
+	guard["unitId"] = &types.AttributeValueMemberS{Value: unit.ID}
+	guard["unitType"] = &types.AttributeValueMemberS{Value: unit.UnitType}
+	put := &types.Put{
+		TableName:                           aws.String(r.tableName),
+		Item:                                guard,
+		ConditionExpression:                 aws.String("attribute_not_exists(pk)"),
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}
+	if stale != nil {
+		put.ConditionExpression = aws.String("unitId = :heldBy AND unitType = :heldType")
+		put.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":heldBy":   &types.AttributeValueMemberS{Value: stale.UnitID},
+			":heldType": &types.AttributeValueMemberS{Value: stale.UnitType},
+		}
+	}
+	return put, nil
+}
+
+// vinMoveItems builds the items that move a unit's VIN reservation along with a
+// write turning before into after: the put reserving the new VIN and the delete
+// releasing the old one. A write that keeps the VIN needs neither.
+func (r *DynamoDBUnitRepository) vinMoveItems(ctx context.Context, before, after *models.Unit) ([]types.TransactWriteItem, error) {
+	if before == nil || before.Vin == after.Vin {
+		return nil, nil
+	}
+
+	var items []types.TransactWriteItem
+	if after.Vin != "" {
+		put, err := r.vinGuardPut(ctx, after)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, types.TransactWriteItem{Put: put})
+	}
+	if before.Vin != "" {
+		release, err := r.vinRelease(ctx, before)
+		if err != nil {
+			return nil, err
+		}
+		if release != nil {
+			items = append(items, types.TransactWriteItem{Delete: release})
+		}
+	}
+	return items, nil
+}
+
+// vinRelease builds the delete of the reservation of a unit's VIN, conditioned on
+// the unit still holding it, or returns nil when the unit does not hold it
+func (r *DynamoDBUnitRepository) vinRelease(ctx context.Context, unit *models.Unit) (*types.Delete, error) {
+	key := vinGuardKey(unit.AccountID, unit.Vin)
+	output, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(r.tableName),
+		Key:            key,
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to check VIN reservation: %w", err)
+	}
+	if output.Item == nil {
+		return nil, nil
+	}
+
+	var holder vinHolder
+	if err := attributevalue.UnmarshalMap(output.Item, &holder); err != nil {
+		return nil, fmt.Errorf("failed to read VIN reservation: %w", err)
+	}
+	if holder.UnitID != unit.ID || holder.UnitType != unit.UnitType {
+		return nil, nil
+	}
+
+	return &types.Delete{
+		TableName:           aws.String(r.tableName),
+		Key:                 key,
+		ConditionExpression: aws.String("unitId = :unitId AND unitType = :unitType"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":unitId":   &types.AttributeValueMemberS{Value: unit.ID},
+			":unitType": &types.AttributeValueMemberS{Value: unit.UnitType},
+		},
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}, nil
+}
+
+// vinGuardFailure explains why an item reserving or releasing a VIN failed its
+// condition, or returns nil when the item is not a VIN reservation
+func vinGuardFailure(write types.TransactWriteItem, reason types.CancellationReason) error {
+	if write.Delete != nil && isVinGuardItem(write.Delete.Key) {
+		var released vinHolder
+		if err := attributevalue.UnmarshalMap(write.Delete.Key, &released); err != nil {
+			return fmt.Errorf("failed to read VIN reservation: %w", err)
+		}
+		return fmt.Errorf("VIN %s reservation changed concurrently", released.Vin)
+	}
+	if write.Put == nil || !isVinGuardItem(write.Put.Item) {
+		return nil
+	}
+
+	var reserved, holder vinHolder
+	if err := attributevalue.UnmarshalMap(write.Put.Item, &reserved); err != nil {
+		return fmt.Errorf("failed to read VIN reservation: %w", err)
+	}
+	if err := attributevalue.UnmarshalMap(reason.Item, &holder); err != nil {
+		return fmt.Errorf("failed to read VIN reservation: %w", err)
+	}
+	return &DuplicateVinError{Vin: reserved.Vin, UnitID: holder.UnitID}
+}
+
+// isVinGuardItem reports whether a table item or key is a VIN reservation
+func isVinGuardItem(item map[string]types.AttributeValue) bool {
+	pk, ok := item["pk"].(*types.AttributeValueMemberS)
+	return ok && strings.HasPrefix(pk.Value, vinGuardPrefix)
+}
+
+// holdsVin reports whether a unit still exists, deleted or not, with the given VIN.
+// Soft deleted units keep their VIN so they can be restored.
+func (r *DynamoDBUnitRepository) holdsVin(ctx context.Context, accountID, unitID, unitType, vin string) (bool, error) {
+	key := (&models.Unit{AccountID: accountID, ID: unitID, UnitType: unitType}).GetKey()
+	output, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:            aws.String(r.tableName),
+		Key:                  key,
+		ConsistentRead:       aws.Bool(true),
+		ProjectionExpression: aws.String("suggestedVin"),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to check VIN reservation: %w", err)
+	}
+	if output.Item == nil {
+		return false, nil
+	}
+
+	var holder models.Unit
+	if err := attributevalue.UnmarshalMap(output.Item, &holder); err != nil {
+		return false, fmt.Errorf("failed to unmarshal unit: %w", err)
+	}
+	return models.NormalizeVin(holder.SuggestedVin) == vin, nil
+}
+
+// GetByVin retrieves the live unit with the given VIN in an account using the VIN index
+func (r *DynamoDBUnitRepository) GetByVin(ctx context.Context, accountID, vin string) (*models.Unit, error) {
+	if accountID == "" {
+		return nil, errors.New("accountID is required")
+	}
+	vin = models.NormalizeVin(vin)
+	if vin == "" {
+		return nil, errors.New("vin is required")
+	}
+
+	queryInput := &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		IndexName:              aws.String(vinIndexName),
+		KeyConditionExpression: aws.String("pk = :accountId AND vin = :vin"),
+		FilterExpression:       aws.String("attribute_not_exists(deletedAt) OR deletedAt = :zero"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":accountId": &types.AttributeValueMemberS{Value: accountID},
+			":vin":       &types.AttributeValueMemberS{Value: vin},
+			":zero":      &types.AttributeValueMemberN{Value: "0"},
+		},
+	}
+
+	// Deleted units sharing the VIN are filtered after the read, so keep paging
+	// until a live unit turns up
+	for {
+		result, err := r.client.Query(ctx, queryInput)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query units by VIN: %w", err)
+		}
+
+		if len(result.Items) > 0 {
+			if len(result.Items) > 1 {
+				log.Printf("Found %d live units with VIN %s for account %s", len(result.Items), vin, accountID)
+			}
+			var unit models.Unit
+			if err := attributevalue.UnmarshalMap(result.Items[0], &unit); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal unit: %w", err)
+			}
+			return &unit, nil
+		}
+
+		if result.LastEvaluatedKey == nil {
+			return nil, nil
+		}
+		queryInput.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+// SearchByVin retrieves a page of the live units in an account whose VIN begins
+// with the given prefix of MinVinPrefixLength to MaxVinPrefixLength characters
+func (r *DynamoDBUnitRepository) SearchByVin(ctx context.Context, input *appsync.SearchUnitsByVinInput) (*appsync.ListUnitsResponse, error) {
+	if input == nil {
+		return nil, errors.New("input is required")
+	}
+	if input.AccountID == "" {
+		return nil, errors.New("accountID is required")
+	}
+	prefix := models.NormalizeVin(input.VinPrefix)
+	if len(prefix) < MinVinPrefixLength || len(prefix) > MaxVinPrefixLength {
+		return nil, fmt.Errorf("vin prefix must be %d to %d characters, got %d", MinVinPrefixLength, MaxVinPrefixLength, len(prefix))
+	}
+
+	// Default limit
+	limit := int32(20)
+	if input.Limit != nil && *input.Limit > 0 && *input.Limit <= 100 {
+		limit = int32(*input.Limit)
+	}
+
+	queryInput := &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		IndexName:              aws.String(vinIndexName),
+		KeyConditionExpression: aws.String("pk = :accountId AND begins_with(vin, :prefix)"),
+		FilterExpression:       aws.String("attribute_not_exists(deletedAt) OR deletedAt = :zero"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":accountId": &types.AttributeValueMemberS{Value: input.AccountID},
+			":prefix":    &types.AttributeValueMemberS{Value: prefix},
+			":zero":      &types.AttributeValueMemberN{Value: "0"},
+		},
+		Limit: aws.Int32(limit),
+	}
+
+	scope := vinSearchScope(input.AccountID, prefix)
+	if input.NextToken != nil && *input.NextToken != "" {
+		exclusiveStartKey, err := r.decodePaginationToken(*input.NextToken, scope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode pagination token: %w", err)
+		}
+		queryInput.ExclusiveStartKey = exclusiveStartKey
+	}
+
+	result, err := r.client.Query(ctx, queryInput)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search units by VIN: %w", err)
+	}
+
+	// Initialize as empty slice to ensure it marshals to [] instead of null
+	units := make([]models.Unit, 0)
+	if err := attributevalue.UnmarshalListOfMaps(result.Items, &units); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal units: %w", err)
+	}
+
+	response := &appsync.ListUnitsResponse{
+		Items: units,
+		Count: len(units),
+	}
+
+	if result.LastEvaluatedKey != nil {
+		nextToken, err := r.encodePaginationToken(result.LastEvaluatedKey, scope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode pagination token: %w", err)
+		}
+		if nextToken != "" {
+			response.NextToken = &nextToken
+		}
+	}
+
+	return response, nil
+}
@@ -0,0 +1,363 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+func vinTestUnit() *models.Unit {
+	return &models.Unit{
+		ID:           "unit-2",
+		AccountID:    "account-1",
+		UnitType:     "commercialVehicleType",
+		SuggestedVin: "1hgbh41jxmn-109186",
+		Make:         "Honda",
+		Model:        "Civic",
+	}
+}
+
+// vinReservationCanceled is the error returned when the VIN guard condition fails
+func vinReservationCanceled(holderID string) error {
+	return &types.TransactionCanceledException{
+		Message: aws.String("Transaction cancelled"),
+		CancellationReasons: []types.CancellationReason{
+			{Code: aws.String("None")},
+			{Code: aws.String("ConditionalCheckFailed"), Item: map[string]types.AttributeValue{
+				"unitId":   &types.AttributeValueMemberS{Value: holderID},
+				"unitType": &types.AttributeValueMemberS{Value: "commercialVehicleType"},
+			}},
+		},
+	}
+}
+
+func TestDynamoDBUnitRepository_CreateReservesVin(t *testing.T) {
+	client := &fakeDynamoDB{}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	unit := vinTestUnit()
+	require.NoError(t, repo.Create(context.Background(), unit))
+
+	assert.Equal(t, "1HGBH41JXMN109186", unit.Vin)
+	assert.Empty(t, client.putInputs)
+	require.Len(t, client.transactInputs, 1)
+
+	items := client.transactInputs[0].TransactItems
+	require.Len(t, items, 2)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "1HGBH41JXMN109186"}, items[0].Put.Item["vin"])
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "VIN#account-1"}, items[1].Put.Item["pk"])
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "1HGBH41JXMN109186"}, items[1].Put.Item["sk"])
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "unit-2"}, items[1].Put.Item["unitId"])
+	assert.Equal(t, "attribute_not_exists(pk)", *items[1].Put.ConditionExpression)
+}
+
+func TestDynamoDBUnitRepository_CreateRejectsDuplicateVin(t *testing.T) {
+	client := &fakeDynamoDB{
+		transact: func(*dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+			return nil, vinReservationCanceled("unit-1")
+		},
+		getItem: func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			assert.True(t, *input.ConsistentRead)
+			assert.Equal(t, &types.AttributeValueMemberS{Value: "unit-1#commercialVehicleType"}, input.Key["sk"])
+			return &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{
+				"suggestedVin": &types.AttributeValueMemberS{Value: "1HGBH41JXMN109186"},
+			}}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	err := repo.Create(context.Background(), vinTestUnit())
+
+	var duplicate *DuplicateVinError
+	require.True(t, errors.As(err, &duplicate))
+	assert.Equal(t, "unit-1", duplicate.UnitID)
+	assert.Equal(t, "1HGBH41JXMN109186", duplicate.Vin)
+	assert.Len(t, client.transactInputs, 1)
+}
+
+func TestDynamoDBUnitRepository_CreateTakesOverStaleVinReservation(t *testing.T) {
+	client := &fakeDynamoDB{
+		getItem: func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			// The reserving unit has since been purged
+			return &dynamodb.GetItemOutput{}, nil
+		},
+	}
+	client.transact = func(*dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+		if len(client.transactInputs) == 1 {
+			return nil, vinReservationCanceled("unit-1")
+		}
+		return &dynamodb.TransactWriteItemsOutput{}, nil
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	require.NoError(t, repo.Create(context.Background(), vinTestUnit()))
+
+	require.Len(t, client.transactInputs, 2)
+	guard := client.transactInputs[1].TransactItems[1].Put
+	assert.Equal(t, "unitId = :heldBy AND unitType = :heldType", *guard.ConditionExpression)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "unit-1"}, guard.ExpressionAttributeValues[":heldBy"])
+}
+
+func TestDynamoDBUnitRepository_CreateExistingUnitWithVin(t *testing.T) {
+	client := &fakeDynamoDB{
+		transact: func(*dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+			return nil, &types.TransactionCanceledException{CancellationReasons: []types.CancellationReason{
+				{Code: aws.String("ConditionalCheckFailed")},
+				{Code: aws.String("None")},
+			}}
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	err := repo.Create(context.Background(), vinTestUnit())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already exists")
+}
+
+func TestDynamoDBUnitRepository_GetByVin(t *testing.T) {
+	live := map[string]types.AttributeValue{
+		"pk":  &types.AttributeValueMemberS{Value: "account-1"},
+		"sk":  &types.AttributeValueMemberS{Value: "unit-1#commercialVehicleType"},
+		"id":  &types.AttributeValueMemberS{Value: "unit-1"},
+		"vin": &types.AttributeValueMemberS{Value: "1HGBH41JXMN109186"},
+	}
+	lastKey := map[string]types.AttributeValue{"pk": live["pk"], "sk": live["sk"], "vin": live["vin"]}
+
+	var inputs []*dynamodb.QueryInput
+	client := &fakeDynamoDB{
+		query: func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+			inputs = append(inputs, input)
+			// The first page only held deleted units, which the filter dropped
+			if input.ExclusiveStartKey == nil {
+				return &dynamodb.QueryOutput{LastEvaluatedKey: lastKey}, nil
+			}
+			return &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{live}}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	unit, err := repo.GetByVin(context.Background(), "account-1", "1hgbh41jxmn109186")
+	require.NoError(t, err)
+	require.NotNil(t, unit)
+	assert.Equal(t, "unit-1", unit.ID)
+
+	require.Len(t, inputs, 2)
+	assert.Equal(t, "account-vin-index", *inputs[0].IndexName)
+	assert.Equal(t, "pk = :accountId AND vin = :vin", *inputs[0].KeyConditionExpression)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "1HGBH41JXMN109186"}, inputs[0].ExpressionAttributeValues[":vin"])
+
+	client.query = func(*dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+		return &dynamodb.QueryOutput{}, nil
+	}
+	unit, err = repo.GetByVin(context.Background(), "account-1", "1HGBH41JXMN109186")
+	require.NoError(t, err)
+	assert.Nil(t, unit)
+}
+
+func TestDynamoDBUnitRepository_SearchByVin(t *testing.T) {
+	lastKey := map[string]types.AttributeValue{
+		"pk":  &types.AttributeValueMemberS{Value: "account-1"},
+		"sk":  &types.AttributeValueMemberS{Value: "unit-1#commercialVehicleType"},
+		"vin": &types.AttributeValueMemberS{Value: "1HGBH41JXMN109186"},
+	}
+
+	var inputs []*dynamodb.QueryInput
+	client := &fakeDynamoDB{
+		query: func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+			inputs = append(inputs, input)
+			if input.ExclusiveStartKey == nil {
+				return &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{{"id": &types.AttributeValueMemberS{Value: "unit-1"}}}, LastEvaluatedKey: lastKey}, nil
+			}
+			return &dynamodb.QueryOutput{}, nil
+		},
+	}
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	input := &appsync.SearchUnitsByVinInput{AccountID: "account-1", VinPrefix: "1hgbh41j"}
+	page, err := repo.SearchByVin(context.Background(), input)
+	require.NoError(t, err)
+	assert.Equal(t, 1, page.Count)
+	require.NotNil(t, page.NextToken)
+	assert.Equal(t, "pk = :accountId AND begins_with(vin, :prefix)", *inputs[0].KeyConditionExpression)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "1HGBH41J"}, inputs[0].ExpressionAttributeValues[":prefix"])
+	assert.Equal(t, int32(20), *inputs[0].Limit)
+
+	// The token continues the same search
+	input.NextToken = page.NextToken
+	page, err = repo.SearchByVin(context.Background(), input)
+	require.NoError(t, err)
+	assert.Equal(t, 0, page.Count)
+	assert.Equal(t, lastKey, inputs[1].ExclusiveStartKey)
+
+	// but not a search for another prefix
+	_, err = repo.SearchByVin(context.Background(), &appsync.SearchUnitsByVinInput{AccountID: "account-1", VinPrefix: "1HGBH41JX", NextToken: input.NextToken})
+	assert.ErrorIs(t, err, ErrInvalidPaginationToken)
+
+	for _, prefix := range []string{"1HGBH41", "1HGBH41JXMN1"} {
+		_, err = repo.SearchByVin(context.Background(), &appsync.SearchUnitsByVinInput{AccountID: "account-1", VinPrefix: prefix})
+		assert.Error(t, err, prefix)
+	}
+}
+
+// vinTable is an in-memory table of units and VIN reservations, keyed by pk and
+// sk, that applies the transactions and reads VIN reservations depend on
+type vinTable map[string]map[string]types.AttributeValue
+
+func vinTableKey(key map[string]types.AttributeValue) string {
+	return key["pk"].(*types.AttributeValueMemberS).Value + "|" + key["sk"].(*types.AttributeValueMemberS).Value
+}
+
+// client returns a fake client reading and transactionally writing the table. Only
+// the "attribute_not_exists(pk)" condition of reservations is checked, and updates
+// only apply their "#name = :value" SET clauses.
+func (table vinTable) client() *fakeDynamoDB {
+	return &fakeDynamoDB{
+		getItem: func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{Item: table[vinTableKey(input.Key)]}, nil
+		},
+		transact: func(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+			reasons := make([]types.CancellationReason, len(input.TransactItems))
+			canceled := false
+			for k, item := range input.TransactItems {
+				reasons[k].Code = aws.String("None")
+				if item.Put != nil && aws.ToString(item.Put.ConditionExpression) == "attribute_not_exists(pk)" {
+					if old, ok := table[vinTableKey(item.Put.Item)]; ok {
+						reasons[k] = types.CancellationReason{Code: aws.String("ConditionalCheckFailed"), Item: old}
+						canceled = true
+					}
+				}
+			}
+			if canceled {
+				return nil, &types.TransactionCanceledException{CancellationReasons: reasons}
+			}
+
+			for _, item := range input.TransactItems {
+				switch {
+				case item.Put != nil:
+					table[vinTableKey(item.Put.Item)] = item.Put.Item
+				case item.Delete != nil:
+					delete(table, vinTableKey(item.Delete.Key))
+				case item.Update != nil:
+					stored := table[vinTableKey(item.Update.Key)]
+					clauses := strings.Split(strings.SplitN(strings.TrimPrefix(*item.Update.UpdateExpression, "SET "), " REMOVE ", 2)[0], ", ")
+					for _, clause := range clauses {
+						parts := strings.SplitN(clause, " = ", 2)
+						stored[item.Update.ExpressionAttributeNames[parts[0]]] = item.Update.ExpressionAttributeValues[parts[1]]
+					}
+				}
+			}
+			return &dynamodb.TransactWriteItemsOutput{}, nil
+		},
+	}
+}
+
+func TestDynamoDBUnitRepository_PatchMovesVinReservation(t *testing.T) {
+	table := vinTable{}
+	client := table.client()
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	unitA := vinTestUnit()
+	unitA.ID = "unit-a"
+	require.NoError(t, repo.Create(context.Background(), unitA))
+	require.Contains(t, table, "VIN#account-1|1HGBH41JXMN109186")
+
+	patch, err := models.NewUnitPatch(map[string]json.RawMessage{"suggestedVin": json.RawMessage(`"1XKAD49X0RJ123456"`)})
+	require.NoError(t, err)
+	patched, err := repo.Patch(context.Background(), "account-1", "unit-a", "commercialVehicleType", 1, patch)
+	require.NoError(t, err)
+	assert.Equal(t, "1XKAD49X0RJ123456", patched.Vin)
+
+	// The new VIN is reserved and the old one released with the unit's write
+	items := client.transactInputs[1].TransactItems
+	require.Len(t, items, 3)
+	assert.NotNil(t, items[0].Update)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "1XKAD49X0RJ123456"}, items[1].Put.Item["sk"])
+	assert.Equal(t, "attribute_not_exists(pk)", *items[1].Put.ConditionExpression)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "1HGBH41JXMN109186"}, items[2].Delete.Key["sk"])
+	assert.NotContains(t, table, "VIN#account-1|1HGBH41JXMN109186")
+
+	// Another unit cannot then be created with the VIN unit A took
+	unitB := vinTestUnit()
+	unitB.ID = "unit-b"
+	unitB.SuggestedVin = "1xkad49x0rj123456"
+	err = repo.Create(context.Background(), unitB)
+	var duplicate *DuplicateVinError
+	require.ErrorAs(t, err, &duplicate)
+	assert.Equal(t, "unit-a", duplicate.UnitID)
+	assert.Equal(t, "1XKAD49X0RJ123456", duplicate.Vin)
+
+	// but it can take the VIN unit A gave up
+	unitC := vinTestUnit()
+	unitC.ID = "unit-c"
+	require.NoError(t, repo.Create(context.Background(), unitC))
+}
+
+func TestDynamoDBUnitRepository_UpdateRejectsVinOfAnotherUnit(t *testing.T) {
+	table := vinTable{}
+	repo := NewDynamoDBUnitRepository(table.client(), "units")
+
+	unitA := vinTestUnit()
+	unitA.ID = "unit-a"
+	require.NoError(t, repo.Create(context.Background(), unitA))
+	unitB := vinTestUnit()
+	unitB.ID = "unit-b"
+	unitB.SuggestedVin = "1XKAD49X0RJ123456"
+	require.NoError(t, repo.Create(context.Background(), unitB))
+
+	unitB.SuggestedVin = unitA.SuggestedVin
+	err := repo.Update(context.Background(), unitB)
+	var duplicate *DuplicateVinError
+	require.ErrorAs(t, err, &duplicate)
+	assert.Equal(t, "unit-a", duplicate.UnitID)
+	assert.Equal(t, int64(1), unitB.Version, "failed update must not advance the caller's version")
+	assert.Contains(t, table, "VIN#account-1|1XKAD49X0RJ123456", "unit B keeps its own VIN")
+}
+
+func TestDynamoDBUnitRepository_TransactWriteMovesVinReservation(t *testing.T) {
+	table := vinTable{}
+	client := table.client()
+	repo := NewDynamoDBUnitRepository(client, "units")
+
+	unitA := vinTestUnit()
+	unitA.ID = "unit-a"
+	require.NoError(t, repo.Create(context.Background(), unitA))
+	client.batchGet = func(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+		var items []map[string]types.AttributeValue
+		for _, key := range input.RequestItems["units"].Keys {
+			items = append(items, table[vinTableKey(key)])
+		}
+		return &dynamodb.BatchGetItemOutput{Responses: map[string][]map[string]types.AttributeValue{"units": items}}, nil
+	}
+
+	patch, err := models.NewUnitPatch(map[string]json.RawMessage{"suggestedVin": json.RawMessage(`"1XKAD49X0RJ123456"`)})
+	require.NoError(t, err)
+	err = repo.TransactWrite(context.Background(), "account-1", []TransactOp{
+		{Type: TransactUpdate, UnitKey: UnitKey{ID: "unit-a", UnitType: "commercialVehicleType"}, ExpectedVersion: 1, Patch: patch},
+	}, "")
+	require.NoError(t, err)
+
+	assert.Len(t, client.transactInputs[1].TransactItems, 3)
+	assert.Contains(t, table, "VIN#account-1|1XKAD49X0RJ123456")
+	assert.NotContains(t, table, "VIN#account-1|1HGBH41JXMN109186")
+
+	unitB := vinTestUnit()
+	unitB.ID = "unit-b"
+	unitB.SuggestedVin = "1XKAD49X0RJ123456"
+	err = repo.TransactWrite(context.Background(), "account-1", []TransactOp{{Type: TransactCreate, Unit: unitB}}, "")
+	var canceled *TransactionCanceledError
+	require.ErrorAs(t, err, &canceled)
+	var duplicate *DuplicateVinError
+	require.ErrorAs(t, canceled.Errors[0], &duplicate)
+	assert.Equal(t, "unit-a", duplicate.UnitID)
+}
@@ -0,0 +1,562 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+const (
+	// DefaultWebhookPageSize and MaxWebhookPageSize bound listWebhookSubscriptions
+	// and listWebhookDeliveries pages
+	DefaultWebhookPageSize = 20
+	MaxWebhookPageSize     = 100
+
+	// DefaultWebhookDeliveryRetention is how long delivery attempts are kept before their TTL expires
+	DefaultWebhookDeliveryRetention = 14 * 24 * time.Hour
+)
+
+// WebhookRepository defines the interface for webhook subscription and delivery data access
+type WebhookRepository interface {
+	// Create stores a new subscription
+	Create(ctx context.Context, subscription *models.WebhookSubscription) error
+
+	// Get retrieves a subscription, or nil when it does not exist
+	Get(ctx context.Context, accountID, subscriptionID string) (*models.WebhookSubscription, error)
+
+	// List retrieves a paginated list of an account's subscriptions
+	List(ctx context.Context, input *appsync.ListWebhookSubscriptionsInput) (*appsync.ListWebhookSubscriptionsResponse, error)
+
+	// ListActive retrieves every subscription of an account that receives deliveries
+	ListActive(ctx context.Context, accountID string) ([]models.WebhookSubscription, error)
+
+	// Update applies a patch to a subscription and returns it as it now is
+	Update(ctx context.Context, accountID, subscriptionID string, patch *models.WebhookSubscriptionPatch) (*models.WebhookSubscription, error)
+
+	// Delete removes a subscription; its delivery attempts expire on their own
+	Delete(ctx context.Context, accountID, subscriptionID string) error
+
+	// RecordDelivery stores one delivery attempt
+	RecordDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+
+	// ListDeliveries retrieves a paginated list of a subscription's delivery attempts, newest first
+	ListDeliveries(ctx context.Context, input *appsync.ListWebhookDeliveriesInput) (*appsync.ListWebhookDeliveriesResponse, error)
+
+	// RecordSuccess clears a subscription's consecutive failures after an event was delivered
+	RecordSuccess(ctx context.Context, accountID, subscriptionID string, at time.Time) error
+
+	// RecordFailure counts an event that could not be delivered and disables the
+	// subscription once disableAfter deliveries in a row have failed
+	RecordFailure(ctx context.Context, accountID, subscriptionID string, at time.Time, disableAfter int) (*models.WebhookSubscription, error)
+}
+
+// DynamoDBWebhookRepository implements WebhookRepository in the units table.
+// Subscriptions live under WEBHOOK#{accountId} and delivery attempts under
+// WEBHOOKDELIVERY#{accountId}#{subscriptionId}, apart from the account's units.
+type DynamoDBWebhookRepository struct {
+	client    DynamoDBAPI
+	tableName string
+
+	// tokens signs and verifies pagination tokens
+	tokens *PaginationTokenSigner
+
+	// deliveryRetention is how long delivery attempts are kept before their TTL expires
+	deliveryRetention time.Duration
+}
+
+// NewDynamoDBWebhookRepository creates a new DynamoDB webhook repository. Pagination
+// tokens are signed with a per-process key until WithPaginationTokenSigner sets a shared one.
+func NewDynamoDBWebhookRepository(client DynamoDBAPI, tableName string) *DynamoDBWebhookRepository {
+	return &DynamoDBWebhookRepository{
+		client:            client,
+		tableName:         tableName,
+		tokens:            NewPaginationTokenSigner(nil, 0),
+		deliveryRetention: DefaultWebhookDeliveryRetention,
+	}
+}
+
+// WithPaginationTokenSigner sets the signer used to issue and verify nextToken values
+func (r *DynamoDBWebhookRepository) WithPaginationTokenSigner(signer *PaginationTokenSigner) *DynamoDBWebhookRepository {
+	r.tokens = signer
+	return r
+}
+
+// WithDeliveryRetention sets how long delivery attempts are kept before DynamoDB
+// expires them. Zero keeps them forever.
+func (r *DynamoDBWebhookRepository) WithDeliveryRetention(retention time.Duration) *DynamoDBWebhookRepository {
+	r.deliveryRetention = retention
+	return r
+}
+
+// subscriptionKey returns the key of a subscription item
+func subscriptionKey(accountID, subscriptionID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: models.WebhookSubscriptionPrefix + accountID},
+		"sk": &types.AttributeValueMemberS{Value: subscriptionID},
+	}
+}
+
+// requireSubscriptionKey checks that a subscription's key is complete
+func requireSubscriptionKey(accountID, subscriptionID string) error {
+	if accountID == "" {
+		return errors.New("accountID is required")
+	}
+	if subscriptionID == "" {
+		return errors.New("subscriptionID is required")
+	}
+	return nil
+}
+
+// isConditionalCheckFailed reports whether a write was rejected by its condition
+func isConditionalCheckFailed(err error) bool {
+	var conditionalCheckFailedException *types.ConditionalCheckFailedException
+	return errors.As(err, &conditionalCheckFailedException)
+}
+
+// Create stores a new subscription; it never overwrites an existing one
+func (r *DynamoDBWebhookRepository) Create(ctx context.Context, subscription *models.WebhookSubscription) error {
+	if subscription == nil {
+		return errors.New("subscription is required")
+	}
+	if err := requireSubscriptionKey(subscription.AccountID, subscription.ID); err != nil {
+		return err
+	}
+	subscription.SetKeys()
+
+	item, err := attributevalue.MarshalMap(subscription)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook subscription: %w", err)
+	}
+
+	_, err = r.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(r.tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(sk)"),
+	})
+	if err != nil {
+		if isConditionalCheckFailed(err) {
+			return fmt.Errorf("webhook subscription %s already exists", subscription.ID)
+		}
+		return fmt.Errorf("failed to create webhook subscription: %w", err)
+	}
+	return nil
+}
+
+// Get retrieves a subscription, or nil when it does not exist
+func (r *DynamoDBWebhookRepository) Get(ctx context.Context, accountID, subscriptionID string) (*models.WebhookSubscription, error) {
+	if err := requireSubscriptionKey(accountID, subscriptionID); err != nil {
+		return nil, err
+	}
+
+	result, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.tableName),
+		Key:       subscriptionKey(accountID, subscriptionID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook subscription: %w", err)
+	}
+	if result.Item == nil {
+		return nil, nil // Subscription not found
+	}
+
+	var subscription models.WebhookSubscription
+	if err := attributevalue.UnmarshalMap(result.Item, &subscription); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal webhook subscription: %w", err)
+	}
+	return &subscription, nil
+}
+
+// List retrieves a paginated list of an account's subscriptions
+func (r *DynamoDBWebhookRepository) List(ctx context.Context, input *appsync.ListWebhookSubscriptionsInput) (*appsync.ListWebhookSubscriptionsResponse, error) {
+	if input == nil {
+		return nil, errors.New("input is required")
+	}
+	if input.AccountID == "" {
+		return nil, errors.New("accountID is required")
+	}
+
+	queryInput := &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		KeyConditionExpression: aws.String("pk = :webhooks"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":webhooks": &types.AttributeValueMemberS{Value: models.WebhookSubscriptionPrefix + input.AccountID},
+		},
+		Limit: aws.Int32(webhookPageSize(input.Limit)),
+	}
+
+	var subscriptions []models.WebhookSubscription
+	nextToken, err := r.queryPage(ctx, queryInput, input.NextToken, webhookSubscriptionScope(input.AccountID), &subscriptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook subscriptions: %w", err)
+	}
+
+	// Initialize as empty slice to ensure it marshals to [] instead of null
+	if subscriptions == nil {
+		subscriptions = []models.WebhookSubscription{}
+	}
+	return &appsync.ListWebhookSubscriptionsResponse{
+		Items:     subscriptions,
+		NextToken: nextToken,
+		Count:     len(subscriptions),
+	}, nil
+}
+
+// ListActive retrieves every subscription of an account that receives deliveries,
+// reading every page
+func (r *DynamoDBWebhookRepository) ListActive(ctx context.Context, accountID string) ([]models.WebhookSubscription, error) {
+	if accountID == "" {
+		return nil, errors.New("accountID is required")
+	}
+
+	queryInput := &dynamodb.QueryInput{
+		TableName:                aws.String(r.tableName),
+		KeyConditionExpression:   aws.String("pk = :webhooks"),
+		FilterExpression:         aws.String("#status = :active"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":webhooks": &types.AttributeValueMemberS{Value: models.WebhookSubscriptionPrefix + accountID},
+			":active":   &types.AttributeValueMemberS{Value: string(models.WebhookActive)},
+		},
+	}
+
+	subscriptions := make([]models.WebhookSubscription, 0)
+	for {
+		result, err := r.client.Query(ctx, queryInput)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query webhook subscriptions: %w", err)
+		}
+
+		var page []models.WebhookSubscription
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal webhook subscriptions: %w", err)
+		}
+		subscriptions = append(subscriptions, page...)
+
+		if result.LastEvaluatedKey == nil {
+			return subscriptions, nil
+		}
+		queryInput.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+// Update applies a patch to an existing subscription. Re-activating a subscription
+// clears its failures; disabling it records when.
+func (r *DynamoDBWebhookRepository) Update(ctx context.Context, accountID, subscriptionID string, patch *models.WebhookSubscriptionPatch) (*models.WebhookSubscription, error) {
+	if err := requireSubscriptionKey(accountID, subscriptionID); err != nil {
+		return nil, err
+	}
+	if patch == nil {
+		return nil, errors.New("patch is required")
+	}
+
+	names := map[string]string{"#updatedAt": "updatedAt"}
+	values := map[string]types.AttributeValue{
+		":updatedAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+	}
+	sets := []string{"#updatedAt = :updatedAt"}
+	var removes []string
+
+	set := func(name string, value types.AttributeValue) {
+		names["#"+name] = name
+		values[":"+name] = value
+		sets = append(sets, "#"+name+" = :"+name)
+	}
+	setList := func(name string, list []string) error {
+		value, err := attributevalue.Marshal(list)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s: %w", name, err)
+		}
+		set(name, value)
+		return nil
+	}
+
+	if patch.URL != nil {
+		set("url", &types.AttributeValueMemberS{Value: *patch.URL})
+	}
+	if patch.Secret != nil {
+		set("secret", &types.AttributeValueMemberS{Value: *patch.Secret})
+	}
+	if patch.EventTypes != nil {
+		if err := setList("eventTypes", append([]string{}, *patch.EventTypes...)); err != nil {
+			return nil, err
+		}
+	}
+	if patch.UnitTypes != nil {
+		if err := setList("unitTypes", append([]string{}, *patch.UnitTypes...)); err != nil {
+			return nil, err
+		}
+	}
+	if patch.Status != nil {
+		set("status", &types.AttributeValueMemberS{Value: string(*patch.Status)})
+		names["#disabledAt"] = "disabledAt"
+		names["#disabledReason"] = "disabledReason"
+		switch *patch.Status {
+		case models.WebhookActive:
+			set("consecutiveFailures", &types.AttributeValueMemberN{Value: "0"})
+			removes = append(removes, "#disabledAt", "#disabledReason")
+		case models.WebhookDisabled:
+			values[":disabledAt"] = values[":updatedAt"]
+			values[":disabledReason"] = &types.AttributeValueMemberS{Value: "Disabled by the account"}
+			sets = append(sets, "#disabledAt = :disabledAt", "#disabledReason = :disabledReason")
+		default:
+			return nil, fmt.Errorf("unknown webhook status %q", *patch.Status)
+		}
+	}
+
+	expression := "SET " + strings.Join(sets, ", ")
+	if len(removes) > 0 {
+		expression += " REMOVE " + strings.Join(removes, ", ")
+	}
+
+	result, err := r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(r.tableName),
+		Key:                       subscriptionKey(accountID, subscriptionID),
+		UpdateExpression:          aws.String(expression),
+		ConditionExpression:       aws.String("attribute_exists(sk)"),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		ReturnValues:              types.ReturnValueAllNew,
+	})
+	if err != nil {
+		if isConditionalCheckFailed(err) {
+			return nil, ErrWebhookSubscriptionNotFound
+		}
+		return nil, fmt.Errorf("failed to update webhook subscription: %w", err)
+	}
+
+	var subscription models.WebhookSubscription
+	if err := attributevalue.UnmarshalMap(result.Attributes, &subscription); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal webhook subscription: %w", err)
+	}
+	return &subscription, nil
+}
+
+// Delete removes a subscription
+func (r *DynamoDBWebhookRepository) Delete(ctx context.Context, accountID, subscriptionID string) error {
+	if err := requireSubscriptionKey(accountID, subscriptionID); err != nil {
+		return err
+	}
+
+	_, err := r.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(r.tableName),
+		Key:                 subscriptionKey(accountID, subscriptionID),
+		ConditionExpression: aws.String("attribute_exists(sk)"),
+	})
+	if err != nil {
+		if isConditionalCheckFailed(err) {
+			return ErrWebhookSubscriptionNotFound
+		}
+		return fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+	return nil
+}
+
+// RecordDelivery stores one delivery attempt, to expire after the delivery retention
+func (r *DynamoDBWebhookRepository) RecordDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	if delivery == nil {
+		return errors.New("delivery is required")
+	}
+	if err := requireSubscriptionKey(delivery.AccountID, delivery.SubscriptionID); err != nil {
+		return err
+	}
+	if delivery.AttemptedAt == "" {
+		delivery.AttemptedAt = time.Now().UTC().Format(models.HistoryTimeFormat)
+	}
+	if r.deliveryRetention > 0 {
+		delivery.ExpiresAt = time.Now().Add(r.deliveryRetention).Unix()
+	}
+	delivery.SetKeys()
+
+	item, err := attributevalue.MarshalMap(delivery)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook delivery: %w", err)
+	}
+
+	if _, err := r.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(r.tableName),
+		Item:      item,
+	}); err != nil {
+		return fmt.Errorf("failed to record webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// ListDeliveries retrieves a paginated list of a subscription's delivery attempts, newest first
+func (r *DynamoDBWebhookRepository) ListDeliveries(ctx context.Context, input *appsync.ListWebhookDeliveriesInput) (*appsync.ListWebhookDeliveriesResponse, error) {
+	if input == nil {
+		return nil, errors.New("input is required")
+	}
+	if err := requireSubscriptionKey(input.AccountID, input.ID); err != nil {
+		return nil, err
+	}
+
+	queryInput := &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		KeyConditionExpression: aws.String("pk = :deliveries"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":deliveries": &types.AttributeValueMemberS{Value: models.WebhookDeliveryPartition(input.AccountID, input.ID)},
+		},
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int32(webhookPageSize(input.Limit)),
+	}
+
+	var deliveries []models.WebhookDelivery
+	nextToken, err := r.queryPage(ctx, queryInput, input.NextToken, webhookDeliveryScope(input.AccountID, input.ID), &deliveries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+
+	// Initialize as empty slice to ensure it marshals to [] instead of null
+	if deliveries == nil {
+		deliveries = []models.WebhookDelivery{}
+	}
+	return &appsync.ListWebhookDeliveriesResponse{
+		Items:     deliveries,
+		NextToken: nextToken,
+		Count:     len(deliveries),
+	}, nil
+}
+
+// RecordSuccess clears a subscription's consecutive failures and records when it was
+// last delivered to. It returns ErrWebhookSubscriptionNotFound when the subscription
+// was deleted meanwhile.
+func (r *DynamoDBWebhookRepository) RecordSuccess(ctx context.Context, accountID, subscriptionID string, at time.Time) error {
+	if err := requireSubscriptionKey(accountID, subscriptionID); err != nil {
+		return err
+	}
+
+	_, err := r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(r.tableName),
+		Key:                 subscriptionKey(accountID, subscriptionID),
+		UpdateExpression:    aws.String("SET consecutiveFailures = :zero, lastDeliveredAt = :at"),
+		ConditionExpression: aws.String("attribute_exists(sk)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":zero": &types.AttributeValueMemberN{Value: "0"},
+			":at":   &types.AttributeValueMemberN{Value: strconv.FormatInt(at.Unix(), 10)},
+		},
+	})
+	if err != nil {
+		if isConditionalCheckFailed(err) {
+			return ErrWebhookSubscriptionNotFound
+		}
+		return fmt.Errorf("failed to record webhook success: %w", err)
+	}
+	return nil
+}
+
+// RecordFailure adds one to a subscription's consecutive failures and, once they
+// reach disableAfter, disables it. The count is incremented atomically, so concurrent
+// deliveries never lose a failure, and the subscription is only disabled while it is
+// still active with that many failures, so a success or re-enable in between wins.
+// A non-positive disableAfter never disables it.
+func (r *DynamoDBWebhookRepository) RecordFailure(ctx context.Context, accountID, subscriptionID string, at time.Time, disableAfter int) (*models.WebhookSubscription, error) {
+	if err := requireSubscriptionKey(accountID, subscriptionID); err != nil {
+		return nil, err
+	}
+	key := subscriptionKey(accountID, subscriptionID)
+	now := &types.AttributeValueMemberN{Value: strconv.FormatInt(at.Unix(), 10)}
+
+	result, err := r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(r.tableName),
+		Key:                 key,
+		UpdateExpression:    aws.String("SET lastFailedAt = :at ADD consecutiveFailures :one"),
+		ConditionExpression: aws.String("attribute_exists(sk)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":at":  now,
+			":one": &types.AttributeValueMemberN{Value: "1"},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	if err != nil {
+		if isConditionalCheckFailed(err) {
+			return nil, ErrWebhookSubscriptionNotFound
+		}
+		return nil, fmt.Errorf("failed to record webhook failure: %w", err)
+	}
+
+	var subscription models.WebhookSubscription
+	if err := attributevalue.UnmarshalMap(result.Attributes, &subscription); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal webhook subscription: %w", err)
+	}
+	if disableAfter <= 0 || !subscription.IsActive() || subscription.ConsecutiveFailures < disableAfter {
+		return &subscription, nil
+	}
+
+	reason := fmt.Sprintf("Disabled after %d consecutive failed deliveries", subscription.ConsecutiveFailures)
+	result, err = r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(r.tableName),
+		Key:                 key,
+		UpdateExpression:    aws.String("SET #status = :disabled, disabledAt = :at, disabledReason = :reason"),
+		ConditionExpression: aws.String("#status = :active AND consecutiveFailures >= :threshold"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":disabled":  &types.AttributeValueMemberS{Value: string(models.WebhookDisabled)},
+			":active":    &types.AttributeValueMemberS{Value: string(models.WebhookActive)},
+			":at":        now,
+			":reason":    &types.AttributeValueMemberS{Value: reason},
+			":threshold": &types.AttributeValueMemberN{Value: strconv.Itoa(disableAfter)},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	if err != nil {
+		if isConditionalCheckFailed(err) {
+			return &subscription, nil // Recovered, re-enabled or deleted meanwhile
+		}
+		return nil, fmt.Errorf("failed to disable webhook subscription: %w", err)
+	}
+
+	if err := attributevalue.UnmarshalMap(result.Attributes, &subscription); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal webhook subscription: %w", err)
+	}
+	return &subscription, nil
+}
+
+// queryPage runs one page of a query, resuming from nextToken, unmarshals its items
+// into out and returns the token of the next page
+func (r *DynamoDBWebhookRepository) queryPage(ctx context.Context, queryInput *dynamodb.QueryInput, nextToken *string, scope paginationScope, out interface{}) (*string, error) {
+	if nextToken != nil && *nextToken != "" {
+		exclusiveStartKey, err := r.tokens.decode(*nextToken, scope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode pagination token: %w", err)
+		}
+		queryInput.ExclusiveStartKey = exclusiveStartKey
+	}
+
+	result, err := r.client.Query(ctx, queryInput)
+	if err != nil {
+		return nil, err
+	}
+	if err := attributevalue.UnmarshalListOfMaps(result.Items, out); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal items: %w", err)
+	}
+
+	token, err := r.tokens.encode(result.LastEvaluatedKey, scope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode pagination token: %w", err)
+	}
+	if token == "" {
+		return nil, nil
+	}
+	return &token, nil
+}
+
+// webhookPageSize returns the requested page size, or the default when it is out of range
+func webhookPageSize(limit *int) int32 {
+	if limit != nil && *limit > 0 && *limit <= MaxWebhookPageSize {
+		return int32(*limit)
+	}
+	return DefaultWebhookPageSize
+}
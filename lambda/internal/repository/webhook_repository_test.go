@@ -0,0 +1,209 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/pkg/appsync"
+)
+
+// storedSubscription is the item of subscription sub-1 of account-1 in status with failures
+func storedSubscription(t *testing.T, status models.WebhookStatus, failures int) map[string]types.AttributeValue {
+	return mustMarshalItem(t, map[string]interface{}{
+		"pk": "WEBHOOK#account-1", "sk": "sub-1", "accountId": "account-1", "subscriptionId": "sub-1",
+		"url": "https://hooks.example.com/units", "secret": "whsec_0123456789abcdef",
+		"eventTypes": []string{"UnitDeleted"}, "unitTypes": []string{},
+		"status": string(status), "consecutiveFailures": failures,
+	})
+}
+
+func TestDynamoDBWebhookRepository_Create(t *testing.T) {
+	client := &fakeDynamoDB{}
+	repo := NewDynamoDBWebhookRepository(client, "units")
+
+	subscription, err := models.NewWebhookSubscription("account-1", "https://hooks.example.com/units", "", nil, []string{"trailerType"})
+	require.NoError(t, err)
+	require.NoError(t, repo.Create(context.Background(), subscription))
+
+	require.Len(t, client.putInputs, 1)
+	put := client.putInputs[0]
+	assert.Equal(t, "attribute_not_exists(sk)", *put.ConditionExpression)
+	assert.Equal(t, "WEBHOOK#account-1", put.Item["pk"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, subscription.ID, put.Item["sk"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "ACTIVE", put.Item["status"].(*types.AttributeValueMemberS).Value)
+
+	// The unit ID index and the stream tell units apart by these attributes
+	assert.NotContains(t, put.Item, "id")
+	assert.NotContains(t, put.Item, "unitType")
+}
+
+func TestDynamoDBWebhookRepository_Get(t *testing.T) {
+	client := &fakeDynamoDB{
+		getItem: func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			if input.Key["sk"].(*types.AttributeValueMemberS).Value != "sub-1" {
+				return &dynamodb.GetItemOutput{}, nil
+			}
+			return &dynamodb.GetItemOutput{Item: storedSubscription(t, models.WebhookActive, 0)}, nil
+		},
+	}
+	repo := NewDynamoDBWebhookRepository(client, "units")
+
+	subscription, err := repo.Get(context.Background(), "account-1", "sub-1")
+	require.NoError(t, err)
+	require.NotNil(t, subscription)
+	assert.Equal(t, "sub-1", subscription.ID)
+	assert.Equal(t, "account-1", subscription.AccountID)
+	assert.Equal(t, []string{"UnitDeleted"}, subscription.EventTypes)
+
+	missing, err := repo.Get(context.Background(), "account-1", "sub-2")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+func TestDynamoDBWebhookRepository_ListPaginates(t *testing.T) {
+	var queries []*dynamodb.QueryInput
+	client := &fakeDynamoDB{
+		query: func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+			queries = append(queries, input)
+			output := &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{storedSubscription(t, models.WebhookActive, 0)}}
+			if len(queries) == 1 {
+				output.LastEvaluatedKey = map[string]types.AttributeValue{
+					"pk": &types.AttributeValueMemberS{Value: "WEBHOOK#account-1"},
+					"sk": &types.AttributeValueMemberS{Value: "sub-1"},
+				}
+			}
+			return output, nil
+		},
+	}
+	repo := NewDynamoDBWebhookRepository(client, "units")
+
+	limit := 1
+	page, err := repo.List(context.Background(), &appsync.ListWebhookSubscriptionsInput{AccountID: "account-1", Limit: &limit})
+	require.NoError(t, err)
+	assert.Equal(t, 1, page.Count)
+	assert.Equal(t, int32(1), *queries[0].Limit)
+	require.NotNil(t, page.NextToken)
+
+	// The token only resumes listings of the account it was issued for
+	_, err = repo.List(context.Background(), &appsync.ListWebhookSubscriptionsInput{AccountID: "account-2", NextToken: page.NextToken})
+	assert.ErrorIs(t, err, ErrInvalidPaginationToken)
+
+	page, err = repo.List(context.Background(), &appsync.ListWebhookSubscriptionsInput{AccountID: "account-1", NextToken: page.NextToken})
+	require.NoError(t, err)
+	assert.Nil(t, page.NextToken)
+	require.Len(t, queries, 2)
+	assert.Equal(t, "sub-1", queries[1].ExclusiveStartKey["sk"].(*types.AttributeValueMemberS).Value)
+}
+
+func TestDynamoDBWebhookRepository_UpdateReenables(t *testing.T) {
+	client := &fakeDynamoDB{
+		updateItem: func(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+			return &dynamodb.UpdateItemOutput{Attributes: storedSubscription(t, models.WebhookActive, 0)}, nil
+		},
+	}
+	repo := NewDynamoDBWebhookRepository(client, "units")
+
+	active := models.WebhookActive
+	eventTypes := []string{"UnitDeleted"}
+	subscription, err := repo.Update(context.Background(), "account-1", "sub-1", &models.WebhookSubscriptionPatch{
+		EventTypes: &eventTypes,
+		Status:     &active,
+	})
+	require.NoError(t, err)
+	assert.True(t, subscription.IsActive())
+
+	require.Len(t, client.updateInputs, 1)
+	update := client.updateInputs[0]
+	assert.Equal(t, "attribute_exists(sk)", *update.ConditionExpression)
+	assert.Contains(t, *update.UpdateExpression, "#status = :status")
+	assert.Contains(t, *update.UpdateExpression, "#consecutiveFailures = :consecutiveFailures")
+	assert.Contains(t, *update.UpdateExpression, "#eventTypes = :eventTypes")
+	assert.Contains(t, *update.UpdateExpression, "REMOVE #disabledAt, #disabledReason")
+	assert.NotContains(t, *update.UpdateExpression, "#url")
+	assert.Equal(t, "0", update.ExpressionAttributeValues[":consecutiveFailures"].(*types.AttributeValueMemberN).Value)
+}
+
+func TestDynamoDBWebhookRepository_UpdateMissing(t *testing.T) {
+	client := &fakeDynamoDB{
+		updateItem: func(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+			return nil, &types.ConditionalCheckFailedException{}
+		},
+		deleteItem: func(*dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+			return nil, &types.ConditionalCheckFailedException{}
+		},
+	}
+	repo := NewDynamoDBWebhookRepository(client, "units")
+
+	url := "https://hooks.example.com/v2"
+	_, err := repo.Update(context.Background(), "account-1", "sub-9", &models.WebhookSubscriptionPatch{URL: &url})
+	assert.ErrorIs(t, err, ErrWebhookSubscriptionNotFound)
+	assert.ErrorIs(t, repo.Delete(context.Background(), "account-1", "sub-9"), ErrWebhookSubscriptionNotFound)
+	assert.ErrorIs(t, repo.RecordSuccess(context.Background(), "account-1", "sub-9", time.Now()), ErrWebhookSubscriptionNotFound)
+}
+
+func TestDynamoDBWebhookRepository_RecordFailureDisables(t *testing.T) {
+	client := &fakeDynamoDB{}
+	client.updateItem = func(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+		if len(client.updateInputs) == 1 {
+			return &dynamodb.UpdateItemOutput{Attributes: storedSubscription(t, models.WebhookActive, 3)}, nil
+		}
+		return &dynamodb.UpdateItemOutput{Attributes: storedSubscription(t, models.WebhookDisabled, 3)}, nil
+	}
+	repo := NewDynamoDBWebhookRepository(client, "units")
+
+	subscription, err := repo.RecordFailure(context.Background(), "account-1", "sub-1", time.Unix(1772359200, 0), 3)
+	require.NoError(t, err)
+	assert.Equal(t, models.WebhookDisabled, subscription.Status)
+
+	require.Len(t, client.updateInputs, 2)
+	assert.Equal(t, "SET lastFailedAt = :at ADD consecutiveFailures :one", *client.updateInputs[0].UpdateExpression)
+	disable := client.updateInputs[1]
+	assert.Equal(t, "#status = :active AND consecutiveFailures >= :threshold", *disable.ConditionExpression)
+	assert.Equal(t, "3", disable.ExpressionAttributeValues[":threshold"].(*types.AttributeValueMemberN).Value)
+	assert.Equal(t, "1772359200", disable.ExpressionAttributeValues[":at"].(*types.AttributeValueMemberN).Value)
+}
+
+func TestDynamoDBWebhookRepository_RecordFailureBelowThreshold(t *testing.T) {
+	client := &fakeDynamoDB{
+		updateItem: func(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+			return &dynamodb.UpdateItemOutput{Attributes: storedSubscription(t, models.WebhookActive, 2)}, nil
+		},
+	}
+	repo := NewDynamoDBWebhookRepository(client, "units")
+
+	subscription, err := repo.RecordFailure(context.Background(), "account-1", "sub-1", time.Now(), 3)
+	require.NoError(t, err)
+	assert.True(t, subscription.IsActive())
+	assert.Equal(t, 2, subscription.ConsecutiveFailures)
+	assert.Len(t, client.updateInputs, 1)
+}
+
+func TestDynamoDBWebhookRepository_RecordDelivery(t *testing.T) {
+	client := &fakeDynamoDB{}
+	repo := NewDynamoDBWebhookRepository(client, "units").WithDeliveryRetention(24 * time.Hour)
+
+	require.NoError(t, repo.RecordDelivery(context.Background(), &models.WebhookDelivery{
+		AccountID:      "account-1",
+		SubscriptionID: "sub-1",
+		EventID:        "event-1",
+		Attempt:        2,
+		AttemptedAt:    "2026-03-01T10:00:00.000000000Z",
+		StatusCode:     503,
+	}))
+
+	require.Len(t, client.putInputs, 1)
+	var stored models.WebhookDelivery
+	require.NoError(t, attributevalue.UnmarshalMap(client.putInputs[0].Item, &stored))
+	assert.Equal(t, "WEBHOOKDELIVERY#account-1#sub-1", stored.PartitionKey)
+	assert.Equal(t, "2026-03-01T10:00:00.000000000Z#event-1#002", stored.SortKey)
+	assert.InDelta(t, time.Now().Add(24*time.Hour).Unix(), stored.ExpiresAt, 5)
+	assert.NotContains(t, client.putInputs[0].Item, "id")
+}
@@ -0,0 +1,196 @@
+// Package streams turns the DynamoDB stream records of the units table into unit
+// domain events and dispatches them to sinks.
+package streams
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	lambdaevents "github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/steverhoton/unt-units-svc/internal/events"
+	"github.com/steverhoton/unt-units-svc/internal/models"
+)
+
+// Handler consumes batches of stream records and publishes an event for each
+// change of a unit to its sink
+type Handler struct {
+	sink events.Publisher
+}
+
+// NewHandler creates a stream handler publishing to sink
+func NewHandler(sink events.Publisher) *Handler {
+	return &Handler{sink: sink}
+}
+
+// Handle publishes the events of a batch of stream records. Records of items that
+// are not units, such as history, outbox, webhook and VIN reservation items, and of units
+// removed from the table are skipped. The records whose event was not published
+// are reported as batch item failures, so Lambda retries the batch from the first
+// of them; events that were published are then published again, and sinks should
+// dedupe on the event ID, which is the stream record's.
+func (h *Handler) Handle(ctx context.Context, batch lambdaevents.DynamoDBEvent) (lambdaevents.DynamoDBEventResponse, error) {
+	var pending []lambdaevents.DynamoDBEventRecord
+	var changes []events.Event
+	for _, record := range batch.Records {
+		event, err := RecordEvent(record)
+		if err != nil {
+			// An image that cannot be read never will be, so retrying it would only block the shard
+			log.Printf("Skipping stream record %s: %v", record.EventID, err)
+			continue
+		}
+		if event == nil {
+			continue
+		}
+		pending = append(pending, record)
+		changes = append(changes, *event)
+	}
+
+	response := lambdaevents.DynamoDBEventResponse{
+		BatchItemFailures: []lambdaevents.DynamoDBBatchItemFailure{},
+	}
+	if len(changes) == 0 {
+		return response, nil
+	}
+
+	errs := events.Failed(h.sink.Publish(ctx, changes), len(changes))
+	for i, record := range pending {
+		if errs[i] != nil {
+			log.Printf("Failed to publish %s of unit %s from stream record %s: %v", changes[i].Type, changes[i].UnitID, record.EventID, errs[i])
+			response.BatchItemFailures = append(response.BatchItemFailures, lambdaevents.DynamoDBBatchItemFailure{
+				ItemIdentifier: record.Change.SequenceNumber,
+			})
+		}
+	}
+	log.Printf("Published %d of %d unit changes from %d stream records", len(changes)-len(response.BatchItemFailures), len(changes), len(batch.Records))
+
+	return response, nil
+}
+
+// RecordEvent returns the event of a stream record, or nil when the record is not
+// a create, update, soft delete or restore of a unit
+func RecordEvent(record lambdaevents.DynamoDBEventRecord) (*events.Event, error) {
+	if !isUnitImage(record.Change.NewImage) {
+		return nil, nil
+	}
+	after, err := ImageUnit(record.Change.NewImage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read new image: %w", err)
+	}
+	var before *models.Unit
+	if isUnitImage(record.Change.OldImage) {
+		if before, err = ImageUnit(record.Change.OldImage); err != nil {
+			return nil, fmt.Errorf("failed to read old image: %w", err)
+		}
+	}
+
+	action, ok := Classify(before, after)
+	if !ok {
+		return nil, nil
+	}
+	event := events.NewUnitEvent(action, before, after, models.Actor{}, record.Change.ApproximateCreationDateTime.Time)
+	event.ID = record.EventID
+	return event, nil
+}
+
+// Classify returns the write that turned before into after: a create when there
+// was no unit before, a soft delete or restore when the unit's deletedAt was set or
+// cleared, and otherwise an update. Writes to a unit that stays deleted are not
+// changes to report.
+func Classify(before, after *models.Unit) (models.HistoryAction, bool) {
+	switch {
+	case after == nil:
+		return "", false
+	case before == nil:
+		return models.HistoryCreate, true
+	case !before.IsDeleted() && after.IsDeleted():
+		return models.HistoryDelete, true
+	case before.IsDeleted() && !after.IsDeleted():
+		return models.HistoryRestore, true
+	case after.IsDeleted():
+		return "", false
+	default:
+		return models.HistoryUpdate, true
+	}
+}
+
+// isUnitImage reports whether a stream image is of a unit. Units are the only
+// items with both an id and a unitType; history items have no id, and VIN
+// reservations, outbox items and webhook subscriptions and deliveries have neither.
+func isUnitImage(image map[string]lambdaevents.DynamoDBAttributeValue) bool {
+	if len(image) == 0 {
+		return false
+	}
+	_, hasID := image["id"]
+	_, hasType := image["unitType"]
+	return hasID && hasType
+}
+
+// ImageUnit unmarshals a stream image into a unit
+func ImageUnit(image map[string]lambdaevents.DynamoDBAttributeValue) (*models.Unit, error) {
+	item, err := imageItem(image)
+	if err != nil {
+		return nil, err
+	}
+	var unit models.Unit
+	if err := attributevalue.UnmarshalMap(item, &unit); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal unit: %w", err)
+	}
+	return &unit, nil
+}
+
+// imageItem converts a stream image into the attribute values of a table item
+func imageItem(image map[string]lambdaevents.DynamoDBAttributeValue) (map[string]types.AttributeValue, error) {
+	item := make(map[string]types.AttributeValue, len(image))
+	for name, value := range image {
+		av, err := attributeValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s: %w", name, err)
+		}
+		item[name] = av
+	}
+	return item, nil
+}
+
+// attributeValue converts a stream attribute value into a table attribute value
+func attributeValue(value lambdaevents.DynamoDBAttributeValue) (types.AttributeValue, error) {
+	switch value.DataType() {
+	case lambdaevents.DataTypeString:
+		return &types.AttributeValueMemberS{Value: value.String()}, nil
+	case lambdaevents.DataTypeNumber:
+		return &types.AttributeValueMemberN{Value: value.Number()}, nil
+	case lambdaevents.DataTypeBinary:
+		return &types.AttributeValueMemberB{Value: value.Binary()}, nil
+	case lambdaevents.DataTypeBoolean:
+		return &types.AttributeValueMemberBOOL{Value: value.Boolean()}, nil
+	case lambdaevents.DataTypeNull:
+		return &types.AttributeValueMemberNULL{Value: true}, nil
+	case lambdaevents.DataTypeStringSet:
+		return &types.AttributeValueMemberSS{Value: value.StringSet()}, nil
+	case lambdaevents.DataTypeNumberSet:
+		return &types.AttributeValueMemberNS{Value: value.NumberSet()}, nil
+	case lambdaevents.DataTypeBinarySet:
+		return &types.AttributeValueMemberBS{Value: value.BinarySet()}, nil
+	case lambdaevents.DataTypeList:
+		list := make([]types.AttributeValue, 0, len(value.List()))
+		for i, element := range value.List() {
+			av, err := attributeValue(element)
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %w", i, err)
+			}
+			list = append(list, av)
+		}
+		return &types.AttributeValueMemberL{Value: list}, nil
+	case lambdaevents.DataTypeMap:
+		m, err := imageItem(value.Map())
+		if err != nil {
+			return nil, err
+		}
+		return &types.AttributeValueMemberM{Value: m}, nil
+	default:
+		return nil, fmt.Errorf("unsupported attribute type %d", value.DataType())
+	}
+}
@@ -0,0 +1,160 @@
+package streams
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	lambdaevents "github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/steverhoton/unt-units-svc/internal/events"
+	"github.com/steverhoton/unt-units-svc/internal/models"
+)
+
+// tractorImage is the stream image of unit-1 at version with deletedAt
+func tractorImage(version, deletedAt string) map[string]lambdaevents.DynamoDBAttributeValue {
+	return map[string]lambdaevents.DynamoDBAttributeValue{
+		"pk":        lambdaevents.NewStringAttribute("account-1"),
+		"sk":        lambdaevents.NewStringAttribute("unit-1#commercialVehicleType"),
+		"id":        lambdaevents.NewStringAttribute("unit-1"),
+		"unitType":  lambdaevents.NewStringAttribute("commercialVehicleType"),
+		"make":      lambdaevents.NewStringAttribute("Mack"),
+		"version":   lambdaevents.NewNumberAttribute(version),
+		"deletedAt": lambdaevents.NewNumberAttribute(deletedAt),
+		"extendedAttributes": lambdaevents.NewListAttribute([]lambdaevents.DynamoDBAttributeValue{
+			lambdaevents.NewMapAttribute(map[string]lambdaevents.DynamoDBAttributeValue{
+				"attributeName":  lambdaevents.NewStringAttribute("axles"),
+				"attributeValue": lambdaevents.NewStringAttribute("3"),
+			}),
+		}),
+	}
+}
+
+// streamRecord is a stream record with the given images
+func streamRecord(eventID, sequence, eventName string, oldImage, newImage map[string]lambdaevents.DynamoDBAttributeValue) lambdaevents.DynamoDBEventRecord {
+	return lambdaevents.DynamoDBEventRecord{
+		EventID:   eventID,
+		EventName: eventName,
+		Change: lambdaevents.DynamoDBStreamRecord{
+			ApproximateCreationDateTime: lambdaevents.SecondsEpochTime{Time: time.Unix(1772359200, 0)},
+			SequenceNumber:              sequence,
+			OldImage:                    oldImage,
+			NewImage:                    newImage,
+		},
+	}
+}
+
+func TestClassify(t *testing.T) {
+	live := &models.Unit{Version: 1}
+	deleted := &models.Unit{Version: 2, DeletedAt: 1700000000}
+
+	tests := []struct {
+		name          string
+		before, after *models.Unit
+		want          models.HistoryAction
+		ok            bool
+	}{
+		{"create", nil, live, models.HistoryCreate, true},
+		{"update", live, &models.Unit{Version: 2}, models.HistoryUpdate, true},
+		{"soft delete", live, deleted, models.HistoryDelete, true},
+		{"restore", deleted, &models.Unit{Version: 3}, models.HistoryRestore, true},
+		{"write to a deleted unit", deleted, &models.Unit{Version: 2, DeletedAt: 1700000000}, "", false},
+		{"remove", live, nil, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, ok := Classify(tt.before, tt.after)
+			assert.Equal(t, tt.want, action)
+			assert.Equal(t, tt.ok, ok)
+		})
+	}
+}
+
+func TestRecordEvent(t *testing.T) {
+	record := streamRecord("event-1", "100", "MODIFY", tractorImage("3", "0"), tractorImage("4", "1772359200"))
+
+	event, err := RecordEvent(record)
+	require.NoError(t, err)
+	require.NotNil(t, event)
+
+	assert.Equal(t, "event-1", event.ID)
+	assert.Equal(t, events.UnitDeleted, event.Type)
+	assert.Equal(t, models.HistoryDelete, event.Action)
+	assert.Equal(t, "account-1", event.AccountID)
+	assert.Equal(t, "unit-1", event.UnitID)
+	assert.Equal(t, int64(4), event.Version)
+	assert.Equal(t, time.Unix(1772359200, 0).UTC(), event.OccurredAt)
+	require.NotNil(t, event.Before)
+	assert.Equal(t, "Mack", event.Before.Make)
+	assert.False(t, event.Before.IsDeleted())
+	assert.True(t, event.After.IsDeleted())
+	assert.Equal(t, []models.ExtendedAttribute{{AttributeName: "axles", AttributeValue: "3"}}, event.After.ExtendedAttributes)
+}
+
+func TestRecordEvent_SkipsOtherItems(t *testing.T) {
+	history := map[string]lambdaevents.DynamoDBAttributeValue{
+		"pk":       lambdaevents.NewStringAttribute("account-1"),
+		"sk":       lambdaevents.NewStringAttribute("unit-1#commercialVehicleType#HIST#2026-03-01T10:00:00.000000000Z"),
+		"unitId":   lambdaevents.NewStringAttribute("unit-1"),
+		"unitType": lambdaevents.NewStringAttribute("commercialVehicleType"),
+	}
+	vinGuard := map[string]lambdaevents.DynamoDBAttributeValue{
+		"pk":     lambdaevents.NewStringAttribute("VIN#account-1"),
+		"sk":     lambdaevents.NewStringAttribute("1M2AX07C0XM000001"),
+		"unitId": lambdaevents.NewStringAttribute("unit-1"),
+	}
+
+	for name, record := range map[string]lambdaevents.DynamoDBEventRecord{
+		"history item":      streamRecord("event-1", "100", "INSERT", nil, history),
+		"VIN reservation":   streamRecord("event-2", "101", "INSERT", nil, vinGuard),
+		"purged unit":       streamRecord("event-3", "102", "REMOVE", tractorImage("4", "1772359200"), nil),
+		"deleted unit kept": streamRecord("event-4", "103", "MODIFY", tractorImage("4", "1772359200"), tractorImage("4", "1772359200")),
+	} {
+		event, err := RecordEvent(record)
+		require.NoError(t, err, name)
+		assert.Nil(t, event, name)
+	}
+}
+
+func TestHandler_Handle(t *testing.T) {
+	sink := events.NewMemoryPublisher()
+	sink.Fail = func(event events.Event) error {
+		if event.ID == "event-3" {
+			return errors.New("throttled")
+		}
+		return nil
+	}
+	broken := tractorImage("1", "0")
+	broken["version"] = lambdaevents.NewStringAttribute("one")
+
+	batch := lambdaevents.DynamoDBEvent{Records: []lambdaevents.DynamoDBEventRecord{
+		streamRecord("event-1", "100", "INSERT", nil, tractorImage("1", "0")),
+		streamRecord("event-2", "101", "INSERT", nil, broken),
+		streamRecord("event-3", "102", "MODIFY", tractorImage("1", "0"), tractorImage("2", "0")),
+		streamRecord("event-4", "103", "MODIFY", tractorImage("2", "1772359200"), tractorImage("3", "0")),
+	}}
+
+	response, err := NewHandler(sink).Handle(context.Background(), batch)
+	require.NoError(t, err)
+
+	assert.Equal(t, []lambdaevents.DynamoDBBatchItemFailure{{ItemIdentifier: "102"}}, response.BatchItemFailures)
+
+	published := sink.Events()
+	require.Len(t, published, 2)
+	assert.Equal(t, models.HistoryCreate, published[0].Action)
+	assert.Equal(t, models.HistoryRestore, published[1].Action)
+	assert.Equal(t, events.UnitUpdated, published[1].Type)
+}
+
+func TestHandler_HandleWithoutChanges(t *testing.T) {
+	sink := events.NewMemoryPublisher()
+
+	response, err := NewHandler(sink).Handle(context.Background(), lambdaevents.DynamoDBEvent{})
+	require.NoError(t, err)
+	assert.NotNil(t, response.BatchItemFailures)
+	assert.Empty(t, response.BatchItemFailures)
+	assert.Empty(t, sink.Events())
+}
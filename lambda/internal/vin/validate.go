@@ -0,0 +1,217 @@
+package vin
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Exemption opts a VIN out of the checks that only apply to standardized North
+// American VINs
+type Exemption string
+
+const (
+	// ExemptionNone applies every check
+	ExemptionNone Exemption = ""
+	// ExemptionPre1981 accepts a VIN from before the 17-character standard: any
+	// letters and digits, at most 17 of them
+	ExemptionPre1981 Exemption = "PRE_1981"
+	// ExemptionNonNorthAmerican accepts a 17-character VIN without verifying the
+	// check digit, model year or make, which are not mandatory outside North America
+	ExemptionNonNorthAmerican Exemption = "NON_NORTH_AMERICAN"
+)
+
+// Field names reported in issues, matching the createUnit arguments
+const (
+	FieldVin       = "suggestedVin"
+	FieldMake      = "make"
+	FieldModelYear = "modelYear"
+	FieldExemption = "vinExemption"
+)
+
+// Issue codes
+const (
+	CodeInvalidLength          = "INVALID_LENGTH"
+	CodeInvalidCharacter       = "INVALID_CHARACTER"
+	CodeInvalidModelYearCode   = "INVALID_MODEL_YEAR_CODE"
+	CodeCheckDigitMismatch     = "CHECK_DIGIT_MISMATCH"
+	CodeModelYearMismatch      = "MODEL_YEAR_MISMATCH"
+	CodeMakeMismatch           = "MAKE_MISMATCH"
+	CodeInvalidExemption       = "INVALID_EXEMPTION"
+	CodeExemptionNotApplicable = "EXEMPTION_NOT_APPLICABLE"
+)
+
+// firstStandardModelYear is the first model year the 17-character VIN was required for
+const firstStandardModelYear = 1981
+
+// Issue is one problem found with a VIN or the vehicle details submitted with it
+type Issue struct {
+	Field    string `json:"field"`
+	Position int    `json:"position,omitempty"` // 1-based VIN position, when the issue is about one character
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+}
+
+// ValidationError lists every issue found with a VIN
+type ValidationError struct {
+	Issues []Issue
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Issues))
+	for _, issue := range e.Issues {
+		messages = append(messages, issue.Message)
+	}
+	return "invalid VIN: " + strings.Join(messages, "; ")
+}
+
+// Vehicle is a VIN together with the details submitted alongside it
+type Vehicle struct {
+	VIN       string
+	Make      string // Checked against the WMI when set
+	ModelYear string // Checked against position 10 when set
+	Exemption Exemption
+}
+
+// Validate checks a VIN and the vehicle details submitted with it. It returns a
+// *ValidationError listing every issue found, or nil.
+func Validate(vehicle Vehicle) error {
+	vin := Normalize(vehicle.VIN)
+
+	var issues []Issue
+	switch vehicle.Exemption {
+	case ExemptionNone:
+		issues = validateStandard(vin, vehicle)
+	case ExemptionPre1981:
+		issues = validatePre1981(vin, vehicle)
+	case ExemptionNonNorthAmerican:
+		issues = validateNonNorthAmerican(vin)
+	default:
+		issues = []Issue{{
+			Field:   FieldExemption,
+			Code:    CodeInvalidExemption,
+			Message: fmt.Sprintf("unknown VIN exemption %q; use %s or %s", vehicle.Exemption, ExemptionPre1981, ExemptionNonNorthAmerican),
+		}}
+	}
+
+	if len(issues) > 0 {
+		return &ValidationError{Issues: issues}
+	}
+	return nil
+}
+
+// validateStandard applies every check for a North American VIN
+func validateStandard(vin string, vehicle Vehicle) []Issue {
+	decoded, err := Decode(vin)
+	if err != nil {
+		if invalid, ok := err.(*ValidationError); ok {
+			return invalid.Issues
+		}
+		return []Issue{{Field: FieldVin, Code: CodeInvalidCharacter, Message: err.Error()}}
+	}
+
+	var issues []Issue
+	if actual := vin[CheckDigitPosition-1]; actual != decoded.CheckDigit {
+		issues = append(issues, Issue{
+			Field:    FieldVin,
+			Position: CheckDigitPosition,
+			Code:     CodeCheckDigitMismatch,
+			Message:  fmt.Sprintf("check digit at position %d is %c, expected %c", CheckDigitPosition, actual, decoded.CheckDigit),
+		})
+	}
+
+	code := vin[ModelYearPosition-1]
+	switch {
+	case len(decoded.ModelYears) == 0:
+		issues = append(issues, Issue{
+			Field:    FieldVin,
+			Position: ModelYearPosition,
+			Code:     CodeInvalidModelYearCode,
+			Message:  fmt.Sprintf("character %c at position %d is not a model year code", code, ModelYearPosition),
+		})
+	case vehicle.ModelYear != "":
+		if issue, ok := modelYearIssue(code, decoded.ModelYears, vehicle.ModelYear); !ok {
+			issues = append(issues, issue)
+		}
+	}
+
+	if vehicle.Make != "" && !makeMatches(decoded.WMI, vehicle.Make) {
+		issues = append(issues, Issue{
+			Field:   FieldMake,
+			Code:    CodeMakeMismatch,
+			Message: fmt.Sprintf("WMI %s belongs to %s, not %s", decoded.WMI, decoded.Manufacturer, vehicle.Make),
+		})
+	}
+
+	return issues
+}
+
+// modelYearIssue checks a submitted model year against the years position 10 encodes
+func modelYearIssue(code byte, candidates []int, submitted string) (Issue, bool) {
+	year, err := strconv.Atoi(strings.TrimSpace(submitted))
+	if err == nil {
+		for _, candidate := range candidates {
+			if candidate == year {
+				return Issue{}, true
+			}
+		}
+	}
+
+	years := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		years[i] = strconv.Itoa(candidate)
+	}
+	return Issue{
+		Field:    FieldModelYear,
+		Position: ModelYearPosition,
+		Code:     CodeModelYearMismatch,
+		Message:  fmt.Sprintf("model year code %c encodes %s, not %s", code, strings.Join(years, " or "), submitted),
+	}, false
+}
+
+// validatePre1981 accepts any letters and digits up to 17 characters for a vehicle
+// built before the standard, as long as its model year does not say otherwise
+func validatePre1981(vin string, vehicle Vehicle) []Issue {
+	var issues []Issue
+	if vin == "" || len(vin) > Length {
+		issues = append(issues, Issue{
+			Field:   FieldVin,
+			Code:    CodeInvalidLength,
+			Message: fmt.Sprintf("VIN must be 1 to %d characters, got %d", Length, len(vin)),
+		})
+	}
+	for i := 0; i < len(vin); i++ {
+		if c := vin[i]; !(c >= '0' && c <= '9' || c >= 'A' && c <= 'Z') {
+			issues = append(issues, Issue{
+				Field:    FieldVin,
+				Position: i + 1,
+				Code:     CodeInvalidCharacter,
+				Message:  fmt.Sprintf("character %q at position %d is not allowed in a VIN", c, i+1),
+			})
+		}
+	}
+
+	if year, err := strconv.Atoi(strings.TrimSpace(vehicle.ModelYear)); err == nil && year >= firstStandardModelYear {
+		issues = append(issues, Issue{
+			Field:   FieldExemption,
+			Code:    CodeExemptionNotApplicable,
+			Message: fmt.Sprintf("%s does not apply to model year %d", ExemptionPre1981, year),
+		})
+	}
+
+	return issues
+}
+
+// validateNonNorthAmerican checks only the length and alphabet of a VIN assigned
+// outside North America
+func validateNonNorthAmerican(vin string) []Issue {
+	issues := structuralIssues(vin)
+	if IsNorthAmerican(vin) {
+		issues = append(issues, Issue{
+			Field:   FieldExemption,
+			Code:    CodeExemptionNotApplicable,
+			Message: fmt.Sprintf("%s does not apply to a VIN assigned in North America", ExemptionNonNorthAmerican),
+		})
+	}
+	return issues
+}
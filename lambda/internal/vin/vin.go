@@ -0,0 +1,190 @@
+// Package vin validates and decodes 17-character vehicle identification numbers
+// using the structure 49 CFR 565 prescribes for vehicles sold in North America:
+//
+//	positions 1-3   world manufacturer identifier (WMI)
+//	positions 4-8   vehicle descriptor section
+//	position  9     check digit
+//	position  10    model year
+//	position  11    plant of manufacture
+//	positions 12-17 sequential number
+package vin
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Length is the number of characters in a standardized VIN
+const Length = 17
+
+// Position numbers (1-based) of the VIN elements that are decoded
+const (
+	CheckDigitPosition = 9
+	ModelYearPosition  = 10
+)
+
+// transliteration maps each VIN character to its value in the check digit
+// calculation. I, O and Q are not part of the VIN alphabet.
+var transliteration = map[byte]int{
+	'0': 0, '1': 1, '2': 2, '3': 3, '4': 4, '5': 5, '6': 6, '7': 7, '8': 8, '9': 9,
+	'A': 1, 'B': 2, 'C': 3, 'D': 4, 'E': 5, 'F': 6, 'G': 7, 'H': 8,
+	'J': 1, 'K': 2, 'L': 3, 'M': 4, 'N': 5, 'P': 7, 'R': 9,
+	'S': 2, 'T': 3, 'U': 4, 'V': 5, 'W': 6, 'X': 7, 'Y': 8, 'Z': 9,
+}
+
+// weights are the check digit weight factors for positions 1 through 17
+var weights = [Length]int{8, 7, 6, 5, 4, 3, 2, 10, 0, 9, 8, 7, 6, 5, 4, 3, 2}
+
+// modelYearCodes maps the position 10 character to the first model year it encoded.
+// The codes repeat every 30 years; U, Z and 0 are never used.
+var modelYearCodes = map[byte]int{
+	'A': 1980, 'B': 1981, 'C': 1982, 'D': 1983, 'E': 1984, 'F': 1985, 'G': 1986, 'H': 1987,
+	'J': 1988, 'K': 1989, 'L': 1990, 'M': 1991, 'N': 1992, 'P': 1993, 'R': 1994, 'S': 1995,
+	'T': 1996, 'V': 1997, 'W': 1998, 'X': 1999, 'Y': 2000,
+	'1': 2001, '2': 2002, '3': 2003, '4': 2004, '5': 2005, '6': 2006, '7': 2007, '8': 2008, '9': 2009,
+}
+
+// modelYearCycle is how often the position 10 codes repeat
+const modelYearCycle = 30
+
+// modelYearCycles is how many cycles of model year codes are decoded, from 1980
+const modelYearCycles = 2
+
+// Decoded holds the elements decoded from a structurally valid VIN
+type Decoded struct {
+	VIN          string
+	WMI          string
+	Region       string
+	Manufacturer string // Empty when the WMI is not in the built-in table
+	CheckDigit   byte
+	ModelYears   []int // Candidate model years for the position 10 code, oldest first
+}
+
+// Normalize returns a VIN upper case with whitespace and hyphens removed
+func Normalize(vin string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '-' {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, vin)
+}
+
+// CheckDigit computes the position 9 check digit of a 17-character VIN: the sum of
+// each character's transliterated value times its weight, modulo 11, with 10
+// written as X. The character already in position 9 is ignored.
+func CheckDigit(vin string) (byte, error) {
+	if len(vin) != Length {
+		return 0, fmt.Errorf("VIN must be %d characters, got %d", Length, len(vin))
+	}
+
+	sum := 0
+	for i := 0; i < Length; i++ {
+		value, ok := transliteration[vin[i]]
+		if !ok {
+			return 0, fmt.Errorf("invalid VIN character %q at position %d", vin[i], i+1)
+		}
+		sum += value * weights[i]
+	}
+
+	remainder := sum % 11
+	if remainder == 10 {
+		return 'X', nil
+	}
+	return byte('0' + remainder), nil
+}
+
+// ModelYears returns the model years a position 10 code can stand for, or nil
+// for a character that is not a model year code
+func ModelYears(code byte) []int {
+	first, ok := modelYearCodes[code]
+	if !ok {
+		return nil
+	}
+
+	years := make([]int, 0, modelYearCycles)
+	for i := 0; i < modelYearCycles; i++ {
+		years = append(years, first+i*modelYearCycle)
+	}
+	return years
+}
+
+// Region returns the region of the world a VIN was assigned in, from its first character
+func Region(vin string) string {
+	if vin == "" {
+		return ""
+	}
+
+	switch c := vin[0]; {
+	case c >= '1' && c <= '5':
+		return "North America"
+	case c >= '6' && c <= '7':
+		return "Oceania"
+	case c >= '8' && c <= '9':
+		return "South America"
+	case c >= 'A' && c <= 'H':
+		return "Africa"
+	case c >= 'J' && c <= 'R':
+		return "Asia"
+	case c >= 'S' && c <= 'Z':
+		return "Europe"
+	default:
+		return ""
+	}
+}
+
+// IsNorthAmerican reports whether a VIN was assigned in North America, where the
+// check digit and model year code are mandatory
+func IsNorthAmerican(vin string) bool {
+	return Region(vin) == "North America"
+}
+
+// Decode decodes a VIN after normalizing it. It returns a *ValidationError when the
+// VIN is not 17 characters from the VIN alphabet; the check digit is not verified.
+func Decode(vin string) (*Decoded, error) {
+	vin = Normalize(vin)
+	if issues := structuralIssues(vin); len(issues) > 0 {
+		return nil, &ValidationError{Issues: issues}
+	}
+
+	checkDigit, err := CheckDigit(vin)
+	if err != nil {
+		return nil, err
+	}
+
+	wmi := vin[:3]
+	return &Decoded{
+		VIN:          vin,
+		WMI:          wmi,
+		Region:       Region(vin),
+		Manufacturer: manufacturer(wmi),
+		CheckDigit:   checkDigit,
+		ModelYears:   ModelYears(vin[ModelYearPosition-1]),
+	}, nil
+}
+
+// structuralIssues reports a wrong length and every character outside the VIN alphabet
+func structuralIssues(vin string) []Issue {
+	var issues []Issue
+	if len(vin) != Length {
+		issues = append(issues, Issue{
+			Field:   FieldVin,
+			Code:    CodeInvalidLength,
+			Message: fmt.Sprintf("VIN must be %d characters, got %d", Length, len(vin)),
+		})
+	}
+
+	for i := 0; i < len(vin); i++ {
+		if _, ok := transliteration[vin[i]]; !ok {
+			issues = append(issues, Issue{
+				Field:    FieldVin,
+				Position: i + 1,
+				Code:     CodeInvalidCharacter,
+				Message:  fmt.Sprintf("character %q at position %d is not allowed in a VIN", vin[i], i+1),
+			})
+		}
+	}
+
+	return issues
+}
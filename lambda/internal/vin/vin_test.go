@@ -0,0 +1,135 @@
+package vin
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckDigit(t *testing.T) {
+	tests := []struct {
+		vin  string
+		want byte
+	}{
+		{vin: "1HGBH41JXMN109186", want: 'X'},
+		{vin: "1M8GDM9AXKP042788", want: 'X'},
+		{vin: "1XKAD49X4RJ123456", want: '4'},
+		{vin: "1M1AN07Y9GM012345", want: '9'},
+		// Position 9 does not take part in the calculation
+		{vin: "1XKAD49X0RJ123456", want: '4'},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.vin, func(t *testing.T) {
+			got, err := CheckDigit(tt.vin)
+			require.NoError(t, err)
+			assert.Equal(t, string(tt.want), string(got))
+		})
+	}
+
+	_, err := CheckDigit("1HGBH41JXMN10918")
+	assert.Error(t, err)
+	_, err = CheckDigit("1HGBH41JXMN10918O")
+	assert.Error(t, err)
+}
+
+func TestModelYears(t *testing.T) {
+	assert.Equal(t, []int{1980, 2010}, ModelYears('A'))
+	assert.Equal(t, []int{1991, 2021}, ModelYears('M'))
+	assert.Equal(t, []int{2000, 2030}, ModelYears('Y'))
+	assert.Equal(t, []int{2009, 2039}, ModelYears('9'))
+	assert.Nil(t, ModelYears('U'))
+	assert.Nil(t, ModelYears('Z'))
+	assert.Nil(t, ModelYears('0'))
+}
+
+func TestDecode(t *testing.T) {
+	decoded, err := Decode("1hgbh41jxmn-109186")
+	require.NoError(t, err)
+	assert.Equal(t, &Decoded{
+		VIN:          "1HGBH41JXMN109186",
+		WMI:          "1HG",
+		Region:       "North America",
+		Manufacturer: "Honda",
+		CheckDigit:   'X',
+		ModelYears:   []int{1991, 2021},
+	}, decoded)
+
+	decoded, err = Decode("WDB9634031L123456")
+	require.NoError(t, err)
+	assert.Equal(t, "Europe", decoded.Region)
+	assert.Empty(t, decoded.Manufacturer)
+
+	_, err = Decode("1HGBH41JXMNI0918")
+	var invalid *ValidationError
+	require.True(t, errors.As(err, &invalid))
+	assert.Equal(t, []Issue{
+		{Field: FieldVin, Code: CodeInvalidLength, Message: "VIN must be 17 characters, got 16"},
+		{Field: FieldVin, Position: 12, Code: CodeInvalidCharacter, Message: `character 'I' at position 12 is not allowed in a VIN`},
+	}, invalid.Issues)
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		vehicle Vehicle
+		want    []string // issue codes, in order
+	}{
+		{name: "valid", vehicle: Vehicle{VIN: "1HGBH41JXMN109186", Make: "HONDA", ModelYear: "2021"}},
+		{name: "valid without details", vehicle: Vehicle{VIN: "1hgbh41jxmn109186"}},
+		{name: "make with punctuation", vehicle: Vehicle{VIN: "1M1AN07Y9GM012345", Make: "mack"}},
+		{name: "unknown WMI accepts any make", vehicle: Vehicle{VIN: "1ZVBP8AM1D5123459", Make: "Anything"}},
+		{name: "too short", vehicle: Vehicle{VIN: "1HGBH41JXMN10918"}, want: []string{CodeInvalidLength}},
+		{name: "letter O", vehicle: Vehicle{VIN: "1HGBH41JXMNO09186"}, want: []string{CodeInvalidCharacter}},
+		{name: "wrong check digit", vehicle: Vehicle{VIN: "1HGBH41J1MN109186"}, want: []string{CodeCheckDigitMismatch}},
+		{name: "invalid model year code", vehicle: Vehicle{VIN: "1HGBH41JXUN109186"}, want: []string{CodeInvalidModelYearCode}},
+		{name: "model year mismatch", vehicle: Vehicle{VIN: "1HGBH41JXMN109186", ModelYear: "2019"}, want: []string{CodeModelYearMismatch}},
+		{name: "model year not a number", vehicle: Vehicle{VIN: "1HGBH41JXMN109186", ModelYear: "new"}, want: []string{CodeModelYearMismatch}},
+		{name: "make mismatch", vehicle: Vehicle{VIN: "1HGBH41JXMN109186", Make: "Ford"}, want: []string{CodeMakeMismatch}},
+		{
+			name:    "every mismatch",
+			vehicle: Vehicle{VIN: "1HGBH41J1MN109186", Make: "Ford", ModelYear: "2019"},
+			want:    []string{CodeCheckDigitMismatch, CodeModelYearMismatch, CodeMakeMismatch},
+		},
+		{name: "pre-1981", vehicle: Vehicle{VIN: "2J57H5B123456", ModelYear: "1972", Exemption: ExemptionPre1981}},
+		{name: "pre-1981 too long", vehicle: Vehicle{VIN: "2J57H5B1234567890X", Exemption: ExemptionPre1981}, want: []string{CodeInvalidLength}},
+		{name: "pre-1981 for a later model year", vehicle: Vehicle{VIN: "2J57H5B123456", ModelYear: "1995", Exemption: ExemptionPre1981}, want: []string{CodeExemptionNotApplicable}},
+		{name: "non-North American", vehicle: Vehicle{VIN: "WDB9634031L123456", Make: "Mercedes-Benz", ModelYear: "1990", Exemption: ExemptionNonNorthAmerican}},
+		{name: "non-North American alphabet", vehicle: Vehicle{VIN: "WDB9634031L12345Q", Exemption: ExemptionNonNorthAmerican}, want: []string{CodeInvalidCharacter}},
+		{name: "non-North American for a North American VIN", vehicle: Vehicle{VIN: "1HGBH41J1MN109186", Exemption: ExemptionNonNorthAmerican}, want: []string{CodeExemptionNotApplicable}},
+		{name: "unknown exemption", vehicle: Vehicle{VIN: "1HGBH41JXMN109186", Exemption: "SOMETIMES"}, want: []string{CodeInvalidExemption}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.vehicle)
+			if len(tt.want) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+
+			var invalid *ValidationError
+			require.True(t, errors.As(err, &invalid), "expected a ValidationError, got %v", err)
+			codes := make([]string, len(invalid.Issues))
+			for i, issue := range invalid.Issues {
+				codes[i] = issue.Code
+			}
+			assert.Equal(t, tt.want, codes)
+		})
+	}
+}
+
+func TestValidate_ReportsFieldsAndMessages(t *testing.T) {
+	err := Validate(Vehicle{VIN: "1HGBH41J1MN109186", Make: "Ford", ModelYear: "2019"})
+
+	var invalid *ValidationError
+	require.True(t, errors.As(err, &invalid))
+	assert.Equal(t, []Issue{
+		{Field: FieldVin, Position: 9, Code: CodeCheckDigitMismatch, Message: "check digit at position 9 is 1, expected X"},
+		{Field: FieldModelYear, Position: 10, Code: CodeModelYearMismatch, Message: "model year code M encodes 1991 or 2021, not 2019"},
+		{Field: FieldMake, Code: CodeMakeMismatch, Message: "WMI 1HG belongs to Honda, not Ford"},
+	}, invalid.Issues)
+	assert.Equal(t, "invalid VIN: check digit at position 9 is 1, expected X; model year code M encodes 1991 or 2021, not 2019; WMI 1HG belongs to Honda, not Ford", err.Error())
+}
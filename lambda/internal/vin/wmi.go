@@ -0,0 +1,81 @@
+package vin
+
+import (
+	"strings"
+	"unicode"
+)
+
+// wmiMakes maps the world manufacturer identifiers of common North American truck
+// and passenger vehicle makers to the makes they build. The first make is the
+// manufacturer's name; every listed make is accepted as a match.
+var wmiMakes = map[string][]string{
+	"1FA": {"Ford"},
+	"1FD": {"Ford"},
+	"1FM": {"Ford"},
+	"1FT": {"Ford"},
+	"1FU": {"Freightliner"},
+	"1FV": {"Freightliner"},
+	"1G1": {"Chevrolet"},
+	"1GB": {"Chevrolet"},
+	"1GC": {"Chevrolet"},
+	"1GD": {"GMC"},
+	"1GT": {"GMC"},
+	"1HG": {"Honda"},
+	"1HS": {"International", "Navistar"},
+	"1HT": {"International", "Navistar"},
+	"1M1": {"Mack"},
+	"1M2": {"Mack"},
+	"1N6": {"Nissan"},
+	"1NK": {"Kenworth"},
+	"1NP": {"Peterbilt"},
+	"1XK": {"Kenworth"},
+	"1XP": {"Peterbilt"},
+	"2FU": {"Freightliner"},
+	"2HG": {"Honda"},
+	"2NK": {"Kenworth"},
+	"2NP": {"Peterbilt"},
+	"3AK": {"Freightliner"},
+	"3HS": {"International", "Navistar"},
+	"3HT": {"International", "Navistar"},
+	"4UZ": {"Freightliner"},
+	"4V4": {"Volvo"},
+	"4V5": {"Volvo"},
+	"5KJ": {"Western Star"},
+	"5KK": {"Western Star"},
+}
+
+// manufacturer returns the manufacturer name for a WMI, or "" when it is unknown
+func manufacturer(wmi string) string {
+	if makes, ok := wmiMakes[wmi]; ok {
+		return makes[0]
+	}
+	return ""
+}
+
+// makeMatches reports whether a submitted make is one the WMI's manufacturer builds.
+// Unknown WMIs match every make.
+func makeMatches(wmi, submittedMake string) bool {
+	makes, ok := wmiMakes[wmi]
+	if !ok {
+		return true
+	}
+
+	submitted := foldMake(submittedMake)
+	for _, known := range makes {
+		if foldMake(known) == submitted {
+			return true
+		}
+	}
+	return false
+}
+
+// foldMake reduces a make to upper case letters and digits so that "Western Star"
+// and "WESTERN-STAR" compare equal
+func foldMake(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return -1
+	}, name)
+}
@@ -0,0 +1,296 @@
+// Package webhooks delivers unit events to the webhook subscriptions of their
+// account, signing each request and retrying the ones that fail.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/steverhoton/unt-units-svc/internal/events"
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/internal/repository"
+)
+
+const (
+	// DefaultMaxAttempts is how many times an event is posted to an endpoint before it counts as a failure
+	DefaultMaxAttempts = 4
+
+	// DefaultBaseDelay and DefaultMaxDelay bound the exponential backoff between attempts
+	DefaultBaseDelay = 500 * time.Millisecond
+	DefaultMaxDelay  = 10 * time.Second
+
+	// DefaultDisableAfter is how many events in a row may fail before a subscription is disabled
+	DefaultDisableAfter = 10
+)
+
+// userAgent identifies deliveries to receivers
+const userAgent = "unt-units-webhooks/1"
+
+// Store is the part of the webhook repository that deliveries read and record
+type Store interface {
+	ListActive(ctx context.Context, accountID string) ([]models.WebhookSubscription, error)
+	RecordDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	RecordSuccess(ctx context.Context, accountID, subscriptionID string, at time.Time) error
+	RecordFailure(ctx context.Context, accountID, subscriptionID string, at time.Time, disableAfter int) (*models.WebhookSubscription, error)
+}
+
+// Deliverer is an events.Publisher that posts each event to the active webhook
+// subscriptions of its account whose filters match it. Every attempt is signed with
+// the subscription's secret and recorded. Failed attempts are retried with
+// exponential backoff; an event still not delivered after the last attempt counts
+// as a failure of the subscription, which is disabled after too many in a row.
+type Deliverer struct {
+	store  Store
+	client *http.Client
+
+	maxAttempts  int
+	baseDelay    time.Duration
+	maxDelay     time.Duration
+	disableAfter int
+}
+
+// NewDeliverer creates a deliverer reading subscriptions from store and posting
+// with client. A nil client uses http.DefaultClient; callers should give it a
+// timeout and stop it following redirects.
+func NewDeliverer(store Store, client *http.Client) *Deliverer {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Deliverer{
+		store:        store,
+		client:       client,
+		maxAttempts:  DefaultMaxAttempts,
+		baseDelay:    DefaultBaseDelay,
+		maxDelay:     DefaultMaxDelay,
+		disableAfter: DefaultDisableAfter,
+	}
+}
+
+// WithRetry sets how many times an event is posted before it fails, and the delay
+// before the first retry, which doubles with each retry up to maxDelay
+func (d *Deliverer) WithRetry(maxAttempts int, baseDelay, maxDelay time.Duration) *Deliverer {
+	d.maxAttempts = max(maxAttempts, 1)
+	d.baseDelay = baseDelay
+	d.maxDelay = maxDelay
+	return d
+}
+
+// WithDisableAfter sets how many events in a row may fail before a subscription is
+// disabled. Zero never disables subscriptions.
+func (d *Deliverer) WithDisableAfter(failures int) *Deliverer {
+	d.disableAfter = failures
+	return d
+}
+
+// Publish delivers each event to the matching subscriptions of its account. The
+// subscriptions are served concurrently, each receiving its events in order. An
+// endpoint that fails an event is not retried again within the same call, so a
+// dead endpoint cannot hold up the batch; its later events get one attempt each.
+//
+// Events an endpoint would not accept are recorded as failed deliveries, not
+// returned as errors: retrying the stream batch would not help and would block the
+// other subscriptions. Only events whose subscriptions could not be read or whose
+// attempts could not be recorded fail, so the batch is retried from them.
+func (d *Deliverer) Publish(ctx context.Context, batch []events.Event) error {
+	// Group the events by account so each account's subscriptions are read once
+	var accounts []string
+	byAccount := make(map[string][]int)
+	for i, event := range batch {
+		if _, ok := byAccount[event.AccountID]; !ok {
+			accounts = append(accounts, event.AccountID)
+		}
+		byAccount[event.AccountID] = append(byAccount[event.AccountID], i)
+	}
+
+	errs := make([]error, len(batch))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, accountID := range accounts {
+		indexes := byAccount[accountID]
+		subscriptions, err := d.store.ListActive(ctx, accountID)
+		if err != nil {
+			for _, i := range indexes {
+				errs[i] = fmt.Errorf("failed to read webhook subscriptions: %w", err)
+			}
+			continue
+		}
+
+		for _, subscription := range subscriptions {
+			wg.Add(1)
+			go func(subscription models.WebhookSubscription) {
+				defer wg.Done()
+				failing := false
+				for _, i := range indexes {
+					event := batch[i]
+					if !subscription.Matches(string(event.Type), event.UnitType) {
+						continue
+					}
+					attempts := d.maxAttempts
+					if failing {
+						attempts = 1
+					}
+					delivered, stop, err := d.deliver(ctx, subscription, event, attempts)
+					if err != nil {
+						mu.Lock()
+						errs[i] = errors.Join(errs[i], fmt.Errorf("webhook subscription %s: %w", subscription.ID, err))
+						mu.Unlock()
+						return // The batch is retried from this event, so later ones would be sent twice
+					}
+					if stop {
+						return
+					}
+					failing = !delivered
+				}
+			}(subscription)
+		}
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return &events.PublishError{Errors: errs}
+		}
+	}
+	return nil
+}
+
+// deliver makes up to attempts attempts to post event, records each of them and
+// the outcome, and reports whether the event was delivered. stop reports that the
+// subscription no longer takes deliveries, because it was disabled or deleted.
+func (d *Deliverer) deliver(ctx context.Context, subscription models.WebhookSubscription, event events.Event, attempts int) (delivered, stop bool, err error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return false, false, fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			if err := sleep(ctx, d.backoff(attempt-1)); err != nil {
+				return false, false, err
+			}
+		}
+
+		delivery, retry := d.attempt(ctx, subscription, event, body, attempt)
+		if err := d.store.RecordDelivery(ctx, delivery); err != nil {
+			return false, false, fmt.Errorf("failed to record delivery attempt: %w", err)
+		}
+		if delivery.Success {
+			err := d.store.RecordSuccess(ctx, subscription.AccountID, subscription.ID, time.Now())
+			if errors.Is(err, repository.ErrWebhookSubscriptionNotFound) {
+				return true, true, nil
+			}
+			if err != nil {
+				return true, false, fmt.Errorf("failed to record delivery: %w", err)
+			}
+			return true, false, nil
+		}
+		log.Printf("Delivery attempt %d of %s %s to webhook subscription %s failed: %s", attempt, event.Type, event.ID, subscription.ID, delivery.Error)
+		if !retry {
+			break
+		}
+	}
+
+	updated, err := d.store.RecordFailure(ctx, subscription.AccountID, subscription.ID, time.Now(), d.disableAfter)
+	if errors.Is(err, repository.ErrWebhookSubscriptionNotFound) {
+		return false, true, nil
+	}
+	if err != nil {
+		return false, false, fmt.Errorf("failed to record delivery failure: %w", err)
+	}
+	if !updated.IsActive() {
+		log.Printf("Webhook subscription %s of account %s is disabled: %s", updated.ID, updated.AccountID, updated.DisabledReason)
+		return false, true, nil
+	}
+	return false, false, nil
+}
+
+// attempt posts the event once and returns the record of the attempt and whether
+// a failure may succeed if retried
+func (d *Deliverer) attempt(ctx context.Context, subscription models.WebhookSubscription, event events.Event, body []byte, attempt int) (*models.WebhookDelivery, bool) {
+	started := time.Now()
+	delivery := &models.WebhookDelivery{
+		AccountID:      subscription.AccountID,
+		SubscriptionID: subscription.ID,
+		EventID:        event.ID,
+		EventType:      string(event.Type),
+		UnitID:         event.UnitID,
+		Attempt:        attempt,
+		AttemptedAt:    started.UTC().Format(models.HistoryTimeFormat),
+	}
+
+	status, err := d.post(ctx, subscription, event, body, attempt, started)
+	delivery.DurationMs = time.Since(started).Milliseconds()
+	delivery.StatusCode = status
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery, retryable(status)
+	}
+	delivery.Success = true
+	return delivery, false
+}
+
+// post sends one signed request and returns the response status, 0 when none came back
+func (d *Deliverer) post(ctx context.Context, subscription models.WebhookSubscription, event events.Event, body []byte, attempt int, sentAt time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("X-Unit-Event-Id", event.ID)
+	req.Header.Set("X-Unit-Event-Type", string(event.Type))
+	req.Header.Set("X-Unit-Subscription-Id", subscription.ID)
+	req.Header.Set("X-Unit-Delivery-Attempt", strconv.Itoa(attempt))
+	req.Header.Set(SignatureHeader, Sign(subscription.Secret, sentAt, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to post event: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return resp.StatusCode, fmt.Errorf("endpoint responded %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay before the given retry: the base delay doubled for
+// each earlier retry, capped at the maximum delay
+func (d *Deliverer) backoff(retry int) time.Duration {
+	delay := d.baseDelay
+	for i := 1; i < retry && delay < d.maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, d.maxDelay)
+}
+
+// retryable reports whether a failed post may succeed later: when no response came
+// back, or the endpoint timed out, throttled or failed itself. Other responses,
+// such as 404 or a redirect, are not retried.
+func retryable(status int) bool {
+	return status == 0 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500
+}
+
+// sleep waits for d, or returns the context's error if it is done first
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
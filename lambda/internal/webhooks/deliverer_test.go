@@ -0,0 +1,329 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/steverhoton/unt-units-svc/internal/events"
+	"github.com/steverhoton/unt-units-svc/internal/models"
+	"github.com/steverhoton/unt-units-svc/internal/repository"
+)
+
+const testSecret = "whsec_0123456789abcdef"
+
+// memoryStore is a Store keeping subscriptions and delivery attempts in memory
+type memoryStore struct {
+	mu            sync.Mutex
+	subscriptions map[string]*models.WebhookSubscription
+	deliveries    []models.WebhookDelivery
+	listErr       error
+	recordErr     error
+}
+
+func newMemoryStore(subscriptions ...models.WebhookSubscription) *memoryStore {
+	store := &memoryStore{subscriptions: make(map[string]*models.WebhookSubscription)}
+	for i := range subscriptions {
+		store.subscriptions[subscriptions[i].ID] = &subscriptions[i]
+	}
+	return store
+}
+
+func (s *memoryStore) ListActive(_ context.Context, accountID string) ([]models.WebhookSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listErr != nil {
+		return nil, s.listErr
+	}
+	var active []models.WebhookSubscription
+	for _, subscription := range s.subscriptions {
+		if subscription.AccountID == accountID && subscription.IsActive() {
+			active = append(active, *subscription)
+		}
+	}
+	return active, nil
+}
+
+func (s *memoryStore) RecordDelivery(_ context.Context, delivery *models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.recordErr != nil {
+		return s.recordErr
+	}
+	s.deliveries = append(s.deliveries, *delivery)
+	return nil
+}
+
+func (s *memoryStore) RecordSuccess(_ context.Context, _, subscriptionID string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subscription, ok := s.subscriptions[subscriptionID]
+	if !ok {
+		return repository.ErrWebhookSubscriptionNotFound
+	}
+	subscription.ConsecutiveFailures = 0
+	subscription.LastDeliveredAt = at.Unix()
+	return nil
+}
+
+func (s *memoryStore) RecordFailure(_ context.Context, _, subscriptionID string, at time.Time, disableAfter int) (*models.WebhookSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subscription, ok := s.subscriptions[subscriptionID]
+	if !ok {
+		return nil, repository.ErrWebhookSubscriptionNotFound
+	}
+	subscription.ConsecutiveFailures++
+	subscription.LastFailedAt = at.Unix()
+	if disableAfter > 0 && subscription.ConsecutiveFailures >= disableAfter {
+		subscription.Status = models.WebhookDisabled
+		subscription.DisabledReason = "too many failures"
+	}
+	updated := *subscription
+	return &updated, nil
+}
+
+// subscription returns the stored state of a subscription
+func (s *memoryStore) subscription(id string) models.WebhookSubscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.subscriptions[id]
+}
+
+// attempts returns the recorded delivery attempts
+func (s *memoryStore) attempts() []models.WebhookDelivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]models.WebhookDelivery(nil), s.deliveries...)
+}
+
+// receiver is a test endpoint answering with the next status in its script, then 200
+type receiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	r := &receiver{statuses: statuses}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		r.requests = append(r.requests, req)
+		r.bodies = append(r.bodies, body)
+		status := http.StatusOK
+		if len(r.statuses) > 0 {
+			status, r.statuses = r.statuses[0], r.statuses[1:]
+		}
+		r.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *receiver) received() ([]*http.Request, [][]byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*http.Request(nil), r.requests...), append([][]byte(nil), r.bodies...)
+}
+
+func testSubscription(id, url string) models.WebhookSubscription {
+	return models.WebhookSubscription{
+		AccountID: "account-1",
+		ID:        id,
+		URL:       url,
+		Secret:    testSecret,
+		Status:    models.WebhookActive,
+	}
+}
+
+func testEvent(id string, eventType events.Type, unitType string) events.Event {
+	return events.Event{
+		ID:        id,
+		Type:      eventType,
+		AccountID: "account-1",
+		UnitID:    "unit-1",
+		UnitType:  unitType,
+		Version:   1,
+		After:     &models.Unit{AccountID: "account-1", ID: "unit-1", UnitType: unitType},
+	}
+}
+
+// fastDeliverer retries without waiting long
+func fastDeliverer(store Store) *Deliverer {
+	return NewDeliverer(store, nil).WithRetry(3, time.Millisecond, 4*time.Millisecond)
+}
+
+func TestDeliverer_SignsDeliveries(t *testing.T) {
+	endpoint := newReceiver(t)
+	store := newMemoryStore(testSubscription("sub-1", endpoint.URL))
+
+	err := fastDeliverer(store).Publish(context.Background(), []events.Event{testEvent("event-1", events.UnitCreated, "commercialVehicleType")})
+	require.NoError(t, err)
+
+	requests, bodies := endpoint.received()
+	require.Len(t, requests, 1)
+	req := requests[0]
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	assert.Equal(t, "event-1", req.Header.Get("X-Unit-Event-Id"))
+	assert.Equal(t, "UnitCreated", req.Header.Get("X-Unit-Event-Type"))
+	assert.Equal(t, "sub-1", req.Header.Get("X-Unit-Subscription-Id"))
+	assert.Equal(t, "1", req.Header.Get("X-Unit-Delivery-Attempt"))
+	require.NoError(t, Verify(testSecret, req.Header.Get(SignatureHeader), bodies[0], time.Now(), time.Minute))
+	assert.ErrorIs(t, Verify("whsec_another_secret_value", req.Header.Get(SignatureHeader), bodies[0], time.Now(), time.Minute), ErrInvalidSignature)
+
+	var event events.Event
+	require.NoError(t, json.Unmarshal(bodies[0], &event))
+	assert.Equal(t, "event-1", event.ID)
+
+	attempts := store.attempts()
+	require.Len(t, attempts, 1)
+	assert.True(t, attempts[0].Success)
+	assert.Equal(t, http.StatusOK, attempts[0].StatusCode)
+	assert.Equal(t, "event-1", attempts[0].EventID)
+	assert.Equal(t, "sub-1", attempts[0].SubscriptionID)
+	assert.NotZero(t, store.subscription("sub-1").LastDeliveredAt)
+}
+
+func TestDeliverer_RetriesWithBackoff(t *testing.T) {
+	endpoint := newReceiver(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	subscription := testSubscription("sub-1", endpoint.URL)
+	subscription.ConsecutiveFailures = 2
+	store := newMemoryStore(subscription)
+
+	err := fastDeliverer(store).Publish(context.Background(), []events.Event{testEvent("event-1", events.UnitUpdated, "commercialVehicleType")})
+	require.NoError(t, err)
+
+	requests, _ := endpoint.received()
+	require.Len(t, requests, 3)
+	for i, req := range requests {
+		assert.Equal(t, []string{"1", "2", "3"}[i], req.Header.Get("X-Unit-Delivery-Attempt"))
+	}
+
+	attempts := store.attempts()
+	require.Len(t, attempts, 3)
+	assert.Equal(t, http.StatusServiceUnavailable, attempts[0].StatusCode)
+	assert.False(t, attempts[0].Success)
+	assert.Contains(t, attempts[0].Error, "503")
+	assert.Equal(t, http.StatusTooManyRequests, attempts[1].StatusCode)
+	assert.True(t, attempts[2].Success)
+	assert.Equal(t, 3, attempts[2].Attempt)
+
+	// A delivered event clears the failures counted before it
+	assert.Zero(t, store.subscription("sub-1").ConsecutiveFailures)
+}
+
+func TestDeliverer_DoesNotRetryRejectedEvents(t *testing.T) {
+	endpoint := newReceiver(t, http.StatusNotFound)
+	store := newMemoryStore(testSubscription("sub-1", endpoint.URL))
+
+	err := fastDeliverer(store).Publish(context.Background(), []events.Event{testEvent("event-1", events.UnitDeleted, "commercialVehicleType")})
+	require.NoError(t, err, "failed deliveries are recorded, not returned")
+
+	requests, _ := endpoint.received()
+	assert.Len(t, requests, 1)
+	require.Len(t, store.attempts(), 1)
+	assert.Equal(t, http.StatusNotFound, store.attempts()[0].StatusCode)
+	assert.Equal(t, 1, store.subscription("sub-1").ConsecutiveFailures)
+}
+
+func TestDeliverer_DisablesFailingSubscription(t *testing.T) {
+	endpoint := newReceiver(t, 500, 500, 500, 500, 500, 500, 500, 500, 500, 500)
+	subscription := testSubscription("sub-1", endpoint.URL)
+	subscription.ConsecutiveFailures = 1
+	store := newMemoryStore(subscription)
+
+	batch := []events.Event{
+		testEvent("event-1", events.UnitCreated, "commercialVehicleType"),
+		testEvent("event-2", events.UnitUpdated, "commercialVehicleType"),
+		testEvent("event-3", events.UnitUpdated, "commercialVehicleType"),
+		testEvent("event-4", events.UnitDeleted, "commercialVehicleType"),
+	}
+	err := fastDeliverer(store).WithDisableAfter(3).Publish(context.Background(), batch)
+	require.NoError(t, err)
+
+	stored := store.subscription("sub-1")
+	assert.Equal(t, models.WebhookDisabled, stored.Status)
+	assert.Equal(t, 3, stored.ConsecutiveFailures)
+
+	// event-1 is tried three times; once the endpoint has failed an event, event-2
+	// is tried once, and the subscription is disabled before event-3
+	requests, _ := endpoint.received()
+	require.Len(t, requests, 4)
+	assert.Equal(t, "event-2", requests[3].Header.Get("X-Unit-Event-Id"))
+	assert.Len(t, store.attempts(), 4)
+}
+
+func TestDeliverer_MatchesFilters(t *testing.T) {
+	endpoint := newReceiver(t)
+	deletions := testSubscription("sub-deletions", endpoint.URL)
+	deletions.EventTypes = []string{"UnitDeleted"}
+	trailers := testSubscription("sub-trailers", endpoint.URL)
+	trailers.UnitTypes = []string{"trailerType"}
+	disabled := testSubscription("sub-disabled", endpoint.URL)
+	disabled.Status = models.WebhookDisabled
+	otherAccount := testSubscription("sub-other", endpoint.URL)
+	otherAccount.AccountID = "account-2"
+	store := newMemoryStore(deletions, trailers, disabled, otherAccount)
+
+	batch := []events.Event{
+		testEvent("event-1", events.UnitCreated, "commercialVehicleType"),
+		testEvent("event-2", events.UnitDeleted, "commercialVehicleType"),
+		testEvent("event-3", events.UnitUpdated, "trailerType"),
+	}
+	require.NoError(t, fastDeliverer(store).Publish(context.Background(), batch))
+
+	delivered := map[string]string{}
+	requests, _ := endpoint.received()
+	for _, req := range requests {
+		delivered[req.Header.Get("X-Unit-Event-Id")] = req.Header.Get("X-Unit-Subscription-Id")
+	}
+	assert.Equal(t, map[string]string{"event-2": "sub-deletions", "event-3": "sub-trailers"}, delivered)
+}
+
+func TestDeliverer_ReportsStoreFailures(t *testing.T) {
+	endpoint := newReceiver(t)
+	store := newMemoryStore(testSubscription("sub-1", endpoint.URL))
+	store.recordErr = errors.New("throttled")
+
+	batch := []events.Event{
+		testEvent("event-1", events.UnitCreated, "commercialVehicleType"),
+		testEvent("event-2", events.UnitUpdated, "commercialVehicleType"),
+	}
+	err := fastDeliverer(store).Publish(context.Background(), batch)
+	require.Error(t, err)
+
+	errs := events.Failed(err, len(batch))
+	require.Error(t, errs[0])
+	assert.Contains(t, errs[0].Error(), "throttled")
+	assert.NoError(t, errs[1], "the batch is retried from the first failed event")
+
+	store.recordErr = nil
+	store.listErr = errors.New("unavailable")
+	errs = events.Failed(fastDeliverer(store).Publish(context.Background(), batch), len(batch))
+	assert.Error(t, errs[0])
+	assert.Error(t, errs[1])
+}
+
+func TestDeliverer_Backoff(t *testing.T) {
+	deliverer := NewDeliverer(newMemoryStore(), nil).WithRetry(6, time.Second, 5*time.Second)
+
+	assert.Equal(t, time.Second, deliverer.backoff(1))
+	assert.Equal(t, 2*time.Second, deliverer.backoff(2))
+	assert.Equal(t, 4*time.Second, deliverer.backoff(3))
+	assert.Equal(t, 5*time.Second, deliverer.backoff(4))
+	assert.Equal(t, 5*time.Second, deliverer.backoff(10))
+}
@@ -0,0 +1,37 @@
+package webhooks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSign(t *testing.T) {
+	sentAt := time.Unix(1772359200, 0)
+	body := []byte(`{"id":"event-1"}`)
+
+	// HMAC-SHA256 of "1772359200.{"id":"event-1"}" with the key "secret"
+	header := Sign("secret", sentAt, body)
+	assert.Equal(t, "t=1772359200,v1=bb0053bfd7aa2d2cebc318ea84c10730dd8258cf2555a506c03fd440215766ed", header)
+	assert.NotEqual(t, header, Sign("secret", sentAt.Add(time.Second), body))
+}
+
+func TestVerify(t *testing.T) {
+	sentAt := time.Unix(1772359200, 0)
+	body := []byte(`{"id":"event-1"}`)
+	header := Sign("secret", sentAt, body)
+
+	assert.NoError(t, Verify("secret", header, body, sentAt.Add(time.Minute), 5*time.Minute))
+	assert.NoError(t, Verify("secret", "v1=00,"+header, body, sentAt, 0), "any one matching signature is enough")
+
+	for name, check := range map[string]error{
+		"tampered body":  Verify("secret", header, []byte(`{"id":"event-2"}`), sentAt, 5*time.Minute),
+		"wrong secret":   Verify("other", header, body, sentAt, 5*time.Minute),
+		"replayed later": Verify("secret", header, body, sentAt.Add(time.Hour), 5*time.Minute),
+		"missing":        Verify("secret", "", body, sentAt, 5*time.Minute),
+		"malformed time": Verify("secret", "t=soon,v1=00", body, sentAt, 5*time.Minute),
+	} {
+		assert.ErrorIs(t, check, ErrInvalidSignature, name)
+	}
+}
@@ -2,6 +2,7 @@ package appsync
 
 import (
 	"encoding/json"
+	"strings"
 
 	"github.com/steverhoton/unt-units-svc/internal/models"
 )
@@ -32,6 +33,29 @@ type Identity struct {
 	CognitoIdentityID     string   `json:"cognitoIdentityId,omitempty"`
 }
 
+// Principal returns the name recorded for the caller in audit attributes:
+// the username when present, otherwise the subject or IAM ARN
+func (i Identity) Principal() string {
+	switch {
+	case i.Username != "":
+		return i.Username
+	case i.Sub != "":
+		return i.Sub
+	default:
+		return i.UserArn
+	}
+}
+
+// InGroup reports whether the caller belongs to the named identity group
+func (i Identity) InGroup(group string) bool {
+	for _, g := range i.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
 // Claims represents the JWT claims
 type Claims struct {
 	Sub           string `json:"sub"`
@@ -48,6 +72,47 @@ type Claims struct {
 	Username      string `json:"username"`
 	Email         string `json:"email,omitempty"`
 	EmailVerified bool   `json:"email_verified,omitempty"`
+
+	// Raw holds every claim in the token, including custom claims such as
+	// custom:accountId that have no field of their own
+	Raw map[string]interface{} `json:"-"`
+}
+
+// UnmarshalJSON decodes the known claims and keeps the full claim set in Raw
+func (c *Claims) UnmarshalJSON(data []byte) error {
+	type claims Claims
+	var known claims
+	if err := json.Unmarshal(data, &known); err != nil {
+		return err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*c = Claims(known)
+	c.Raw = raw
+	return nil
+}
+
+// Values returns the values of the named claim. A string claim may hold a single
+// value or a comma-separated list; a list claim contributes each of its strings.
+func (c Claims) Values(name string) []string {
+	var values []string
+	switch v := c.Raw[name].(type) {
+	case string:
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				values = append(values, s)
+			}
+		}
+	}
+	return values
 }
 
 // RequestHeaders represents HTTP request headers
@@ -73,25 +138,71 @@ const (
 	OperationTypeUpdate OperationType = "UPDATE"
 	OperationTypeDelete OperationType = "DELETE"
 	OperationTypeList   OperationType = "LIST"
+
+	OperationTypeRestore     OperationType = "RESTORE"
+	OperationTypeListDeleted OperationType = "LIST_DELETED"
+	OperationTypePurge       OperationType = "PURGE"
+	OperationTypeGetByID     OperationType = "GET_BY_ID"
+	OperationTypeGetByVin    OperationType = "GET_BY_VIN"
+	OperationTypeSearchByVin OperationType = "SEARCH_BY_VIN"
+	OperationTypeDecodeVin   OperationType = "DECODE_VIN"
+	OperationTypeImport      OperationType = "IMPORT"
+	OperationTypeExport      OperationType = "EXPORT"
+	OperationTypeBatchGet    OperationType = "BATCH_GET"
+	OperationTypeBatchCreate OperationType = "BATCH_CREATE"
+	OperationTypeBatchDelete OperationType = "BATCH_DELETE"
+	OperationTypeTransact    OperationType = "TRANSACT"
+	OperationTypeGetHistory  OperationType = "GET_HISTORY"
+
+	OperationTypeListUnitTypes     OperationType = "LIST_UNIT_TYPES"
+	OperationTypeGetUnitTypeSchema OperationType = "GET_UNIT_TYPE_SCHEMA"
+
+	OperationTypeCreateWebhookSubscription OperationType = "CREATE_WEBHOOK_SUBSCRIPTION"
+	OperationTypeGetWebhookSubscription    OperationType = "GET_WEBHOOK_SUBSCRIPTION"
+	OperationTypeListWebhookSubscriptions  OperationType = "LIST_WEBHOOK_SUBSCRIPTIONS"
+	OperationTypeUpdateWebhookSubscription OperationType = "UPDATE_WEBHOOK_SUBSCRIPTION"
+	OperationTypeDeleteWebhookSubscription OperationType = "DELETE_WEBHOOK_SUBSCRIPTION"
+	OperationTypeListWebhookDeliveries     OperationType = "LIST_WEBHOOK_DELIVERIES"
 )
 
 // CreateUnitInput represents input for creating a unit
 type CreateUnitInput struct {
-	AccountID   string `json:"accountId"`
-	UnitType    string `json:"unitType"` // Type of unit (e.g., commercialVehicleType)
-	models.Unit        // Embed Unit fields directly
+	AccountID    string                 `json:"accountId"`
+	UnitType     string                 `json:"unitType"`               // Type of unit (e.g., commercialVehicleType)
+	Data         map[string]interface{} `json:"data,omitempty"`         // Schema-driven unit data (dynamic unit types)
+	VinExemption string                 `json:"vinExemption,omitempty"` // Opts out of VIN checks: PRE_1981 or NON_NORTH_AMERICAN
+	DecodeVin    bool                   `json:"decodeVin,omitempty"`    // Fills empty unit fields from the decoded VIN
+	models.Unit                         // Embed Unit fields directly
 }
 
 // UpdateUnitInput represents input for updating a unit
 type UpdateUnitInput struct {
-	ID          string `json:"id"`
-	AccountID   string `json:"accountId"`
-	UnitType    string `json:"unitType"` // Type of unit (required to form the SK)
-	models.Unit        // Embed Unit fields directly
+	ID              string                 `json:"id"`
+	AccountID       string                 `json:"accountId"`
+	UnitType        string                 `json:"unitType"`                  // Type of unit (required to form the SK)
+	ExpectedVersion *int64                 `json:"expectedVersion,omitempty"` // Version the client last read (required for units)
+	Data            map[string]interface{} `json:"data,omitempty"`            // Schema-driven unit data (dynamic unit types)
+	models.Unit                            // Embed Unit fields directly
 }
 
 // DeleteUnitInput represents input for deleting a unit
 type DeleteUnitInput struct {
+	ID              string `json:"id"`
+	AccountID       string `json:"accountId"`
+	UnitType        string `json:"unitType"`                  // Type of unit (required to form the SK)
+	ExpectedVersion *int64 `json:"expectedVersion,omitempty"` // Version the client last read (required for units)
+}
+
+// RestoreUnitInput represents input for restoring a soft deleted unit
+type RestoreUnitInput struct {
+	ID              string `json:"id"`
+	AccountID       string `json:"accountId"`
+	UnitType        string `json:"unitType"`                  // Type of unit (required to form the SK)
+	ExpectedVersion *int64 `json:"expectedVersion,omitempty"` // Version of the deleted unit (required for units)
+}
+
+// PurgeUnitInput represents input for permanently removing a soft deleted unit
+type PurgeUnitInput struct {
 	ID        string `json:"id"`
 	AccountID string `json:"accountId"`
 	UnitType  string `json:"unitType"` // Type of unit (required to form the SK)
@@ -99,19 +210,168 @@ type DeleteUnitInput struct {
 
 // GetUnitInput represents input for getting a single unit
 type GetUnitInput struct {
-	ID        string `json:"id"`
+	ID        string  `json:"id"`
+	AccountID string  `json:"accountId"`
+	UnitType  string  `json:"unitType"`       // Type of unit (required to form the SK)
+	AsOf      *string `json:"asOf,omitempty"` // RFC 3339 time to read the unit as it was then, from its history
+}
+
+// GetUnitHistoryInput represents input for reading a page of a unit's change history
+type GetUnitHistoryInput struct {
+	AccountID string  `json:"accountId"`
+	ID        string  `json:"id"`
+	UnitType  string  `json:"unitType"`
+	Limit     *int    `json:"limit,omitempty"`
+	NextToken *string `json:"nextToken,omitempty"`
+}
+
+// GetUnitByIDInput represents input for looking a unit up by ID alone, across the
+// caller's accounts and every unit type
+type GetUnitByIDInput struct {
+	ID string `json:"id"`
+}
+
+// GetUnitByVinInput represents input for looking a unit up by VIN within an account
+type GetUnitByVinInput struct {
 	AccountID string `json:"accountId"`
-	UnitType  string `json:"unitType"` // Type of unit (required to form the SK)
+	Vin       string `json:"vin"`
+}
+
+// SearchUnitsByVinInput represents input for finding units by the start of their VIN
+type SearchUnitsByVinInput struct {
+	AccountID string  `json:"accountId"`
+	VinPrefix string  `json:"vinPrefix"`
+	Limit     *int    `json:"limit,omitempty"`
+	NextToken *string `json:"nextToken,omitempty"`
 }
 
 // ListUnitsInput represents input for listing units
 type ListUnitsInput struct {
 	AccountID string  `json:"accountId"`
+	UnitType  *string `json:"unitType,omitempty"` // Optional unit type to restrict the listing to
 	Limit     *int    `json:"limit,omitempty"`
 	NextToken *string `json:"nextToken,omitempty"`
 	Filter    *string `json:"filter,omitempty"`
 }
 
+// DecodeVinInput represents input for decoding a VIN
+type DecodeVinInput struct {
+	Vin       string `json:"vin"`
+	ModelYear string `json:"modelYear,omitempty"` // Optional hint for VINs with an ambiguous model year code
+}
+
+// ImportUnitsInput represents input for creating units in bulk from an inline payload
+type ImportUnitsInput struct {
+	AccountID string `json:"accountId"`
+	UnitType  string `json:"unitType"`
+	Format    string `json:"format"`  // CSV or NDJSON
+	Payload   string `json:"payload"` // CSV with a header row of unit field names, or one JSON unit per line
+}
+
+// UnitKeyInput identifies one unit of a batch operation
+type UnitKeyInput struct {
+	ID              string `json:"id"`
+	UnitType        string `json:"unitType"`
+	ExpectedVersion *int64 `json:"expectedVersion,omitempty"` // Required by batchDeleteUnits
+}
+
+// BatchGetUnitsInput represents input for retrieving many units of an account at once
+type BatchGetUnitsInput struct {
+	AccountID string         `json:"accountId"`
+	Keys      []UnitKeyInput `json:"keys"`
+}
+
+// BatchCreateUnitInput represents one unit of a batchCreateUnits request
+type BatchCreateUnitInput struct {
+	VinExemption string `json:"vinExemption,omitempty"` // Opts out of VIN checks: PRE_1981 or NON_NORTH_AMERICAN
+	models.Unit         // Embed Unit fields directly
+}
+
+// BatchCreateUnitsInput represents input for creating many units of one type at once
+type BatchCreateUnitsInput struct {
+	AccountID string                 `json:"accountId"`
+	UnitType  string                 `json:"unitType"`
+	Units     []BatchCreateUnitInput `json:"units"`
+}
+
+// BatchDeleteUnitsInput represents input for soft deleting many units of an account at once
+type BatchDeleteUnitsInput struct {
+	AccountID string         `json:"accountId"`
+	Keys      []UnitKeyInput `json:"keys"`
+}
+
+// TransactOperationInput represents one operation of a transactUnits request
+type TransactOperationInput struct {
+	Type            string          `json:"type"` // CREATE, UPDATE, DELETE or CONDITION_CHECK
+	ID              string          `json:"id,omitempty"`
+	UnitType        string          `json:"unitType"`
+	ExpectedVersion *int64          `json:"expectedVersion,omitempty"` // Required except on CREATE
+	VinExemption    string          `json:"vinExemption,omitempty"`    // Opts a created unit out of VIN checks
+	Unit            json.RawMessage `json:"unit,omitempty"`            // Fields of a created unit, or the fields an update changes
+}
+
+// TransactUnitsInput represents input for writing many units of an account all together or not at all
+type TransactUnitsInput struct {
+	AccountID  string                   `json:"accountId"`
+	Operations []TransactOperationInput `json:"operations"`
+}
+
+// ExportUnitsInput represents input for exporting an account's live units to a file
+type ExportUnitsInput struct {
+	AccountID string  `json:"accountId"`
+	UnitType  *string `json:"unitType,omitempty"` // Optional for standard units, required for schema-driven unit types
+	Format    string  `json:"format"`             // CSV, NDJSON or PARQUET
+}
+
+// GetUnitTypeSchemaInput represents input for retrieving a unit type schema
+type GetUnitTypeSchemaInput struct {
+	UnitType string `json:"unitType"`
+	Version  *int   `json:"version,omitempty"` // Defaults to the latest version
+}
+
+// CreateWebhookSubscriptionInput represents input for subscribing an endpoint to an account's unit changes
+type CreateWebhookSubscriptionInput struct {
+	AccountID  string   `json:"accountId"`
+	URL        string   `json:"url"`                  // https endpoint each event is posted to
+	Secret     string   `json:"secret,omitempty"`     // Signing secret; generated when empty
+	EventTypes []string `json:"eventTypes,omitempty"` // UnitCreated, UnitUpdated and/or UnitDeleted; empty receives all
+	UnitTypes  []string `json:"unitTypes,omitempty"`  // Unit types to receive events about; empty receives all
+}
+
+// WebhookSubscriptionKeyInput identifies one webhook subscription of an account
+type WebhookSubscriptionKeyInput struct {
+	AccountID string `json:"accountId"`
+	ID        string `json:"id"`
+}
+
+// ListWebhookSubscriptionsInput represents input for listing an account's webhook subscriptions
+type ListWebhookSubscriptionsInput struct {
+	AccountID string  `json:"accountId"`
+	Limit     *int    `json:"limit,omitempty"`
+	NextToken *string `json:"nextToken,omitempty"`
+}
+
+// UpdateWebhookSubscriptionInput represents input for changing a webhook subscription;
+// fields left out are not changed
+type UpdateWebhookSubscriptionInput struct {
+	AccountID    string    `json:"accountId"`
+	ID           string    `json:"id"`
+	URL          *string   `json:"url,omitempty"`
+	Secret       *string   `json:"secret,omitempty"`
+	RotateSecret bool      `json:"rotateSecret,omitempty"` // Replaces the secret with a generated one, returned in the response
+	EventTypes   *[]string `json:"eventTypes,omitempty"`
+	UnitTypes    *[]string `json:"unitTypes,omitempty"`
+	Enabled      *bool     `json:"enabled,omitempty"` // true re-enables a disabled subscription and clears its failures
+}
+
+// ListWebhookDeliveriesInput represents input for reading a page of a subscription's delivery attempts
+type ListWebhookDeliveriesInput struct {
+	AccountID string  `json:"accountId"`
+	ID        string  `json:"id"` // Subscription ID
+	Limit     *int    `json:"limit,omitempty"`
+	NextToken *string `json:"nextToken,omitempty"`
+}
+
 // Response represents a standard response structure
 type Response struct {
 	Success bool        `json:"success"`
@@ -134,6 +394,109 @@ type ListUnitsResponse struct {
 	Count     int           `json:"count"`
 }
 
+// UnitHistoryResponse represents a page of a unit's change history, newest first
+type UnitHistoryResponse struct {
+	Items     []models.UnitHistoryEntry `json:"items"`
+	NextToken *string                   `json:"nextToken,omitempty"`
+	Count     int                       `json:"count"`
+}
+
+// ListDynamicUnitsResponse represents the response for list operations on schema-driven units
+type ListDynamicUnitsResponse struct {
+	Items     []models.DynamicUnit `json:"items"`
+	NextToken *string              `json:"nextToken,omitempty"`
+	Count     int                  `json:"count"`
+}
+
+// BatchUnitResult is the outcome of one key or unit of a batch operation
+type BatchUnitResult struct {
+	Index    int          `json:"index"` // Position of the key or unit in the request
+	ID       string       `json:"id,omitempty"`
+	UnitType string       `json:"unitType,omitempty"`
+	Success  bool         `json:"success"`
+	Unit     *models.Unit `json:"unit,omitempty"`  // Unit read or created
+	Code     string       `json:"code,omitempty"`  // Why the key or unit failed, as the single-unit operation reports it
+	Error    string       `json:"error,omitempty"` // Details of the failure
+}
+
+// BatchUnitsResponse represents the response for batch operations, with one result
+// per key or unit in request order
+type BatchUnitsResponse struct {
+	Total     int               `json:"total"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Results   []BatchUnitResult `json:"results"`
+}
+
+// NewBatchUnitsResponse counts the outcomes of results
+func NewBatchUnitsResponse(results []BatchUnitResult) *BatchUnitsResponse {
+	response := &BatchUnitsResponse{Total: len(results), Results: results}
+	for _, result := range results {
+		if result.Success {
+			response.Succeeded++
+		} else {
+			response.Failed++
+		}
+	}
+	return response
+}
+
+// TransactOperationResult is the outcome of one operation of a transactUnits request.
+// A failed transaction reports the operations at fault, with Code and Error set.
+type TransactOperationResult struct {
+	Index    int          `json:"index"` // Position of the operation in the request
+	Type     string       `json:"type"`
+	ID       string       `json:"id,omitempty"`
+	UnitType string       `json:"unitType,omitempty"`
+	Version  int64        `json:"version,omitempty"` // Version of the unit after the transaction
+	Unit     *models.Unit `json:"unit,omitempty"`    // The created unit
+	Code     string       `json:"code,omitempty"`    // Why the operation failed
+	Error    string       `json:"error,omitempty"`   // Details of the failure
+}
+
+// TransactUnitsResponse represents the response for an applied transactUnits request
+type TransactUnitsResponse struct {
+	Results []TransactOperationResult `json:"results"`
+}
+
+// ExportUnitsResponse represents the response for the exportUnits mutation
+type ExportUnitsResponse struct {
+	Key      string `json:"key"`           // Object key of the export in the export store
+	Location string `json:"location"`      // Where the export was written, such as s3://bucket/key
+	URL      string `json:"url,omitempty"` // Temporary download link, when the store can issue one
+	Format   string `json:"format"`
+	Count    int    `json:"count"`
+}
+
+// UnitTypeSummary describes an available unit type and its schema versions
+type UnitTypeSummary struct {
+	UnitType      string `json:"unitType"`
+	Title         string `json:"title,omitempty"`
+	Description   string `json:"description,omitempty"`
+	LatestVersion int    `json:"latestVersion"`
+	Versions      []int  `json:"versions"`
+}
+
+// ListUnitTypesResponse represents the response for the listUnitTypes query
+type ListUnitTypesResponse struct {
+	Items []UnitTypeSummary `json:"items"`
+	Count int               `json:"count"`
+}
+
+// ListWebhookSubscriptionsResponse represents a page of an account's webhook subscriptions
+type ListWebhookSubscriptionsResponse struct {
+	Items     []models.WebhookSubscription `json:"items"`
+	NextToken *string                      `json:"nextToken,omitempty"`
+	Count     int                          `json:"count"`
+}
+
+// ListWebhookDeliveriesResponse represents a page of a subscription's delivery attempts, newest first
+type ListWebhookDeliveriesResponse struct {
+	Items     []models.WebhookDelivery `json:"items"`
+	NextToken *string                  `json:"nextToken,omitempty"`
+	Count     int                      `json:"count"`
+}
+
 // GetOperationType determines the operation type based on the field name
 func (e *AppSyncEvent) GetOperationType() OperationType {
 	switch e.FieldName {
@@ -147,11 +510,77 @@ func (e *AppSyncEvent) GetOperationType() OperationType {
 		return OperationTypeDelete
 	case "listUnits":
 		return OperationTypeList
+	case "restoreUnit":
+		return OperationTypeRestore
+	case "listDeletedUnits":
+		return OperationTypeListDeleted
+	case "purgeUnit":
+		return OperationTypePurge
+	case "getUnitById":
+		return OperationTypeGetByID
+	case "getUnitByVin":
+		return OperationTypeGetByVin
+	case "searchUnitsByVin":
+		return OperationTypeSearchByVin
+	case "decodeVin":
+		return OperationTypeDecodeVin
+	case "importUnits":
+		return OperationTypeImport
+	case "exportUnits":
+		return OperationTypeExport
+	case "batchGetUnits":
+		return OperationTypeBatchGet
+	case "batchCreateUnits":
+		return OperationTypeBatchCreate
+	case "batchDeleteUnits":
+		return OperationTypeBatchDelete
+	case "transactUnits":
+		return OperationTypeTransact
+	case "getUnitHistory":
+		return OperationTypeGetHistory
+	case "listUnitTypes":
+		return OperationTypeListUnitTypes
+	case "getUnitTypeSchema":
+		return OperationTypeGetUnitTypeSchema
+	case "createWebhookSubscription":
+		return OperationTypeCreateWebhookSubscription
+	case "getWebhookSubscription":
+		return OperationTypeGetWebhookSubscription
+	case "listWebhookSubscriptions":
+		return OperationTypeListWebhookSubscriptions
+	case "updateWebhookSubscription":
+		return OperationTypeUpdateWebhookSubscription
+	case "deleteWebhookSubscription":
+		return OperationTypeDeleteWebhookSubscription
+	case "listWebhookDeliveries":
+		return OperationTypeListWebhookDeliveries
 	default:
 		return OperationTypeRead
 	}
 }
 
+// GetUnitType extracts the unitType argument, if any, without parsing the full input
+func (e *AppSyncEvent) GetUnitType() string {
+	var args struct {
+		UnitType *string `json:"unitType"`
+	}
+	if err := json.Unmarshal(e.Arguments, &args); err != nil || args.UnitType == nil {
+		return ""
+	}
+	return *args.UnitType
+}
+
+// GetAccountID extracts the accountId argument, if any, without parsing the full input
+func (e *AppSyncEvent) GetAccountID() string {
+	var args struct {
+		AccountID string `json:"accountId"`
+	}
+	if err := json.Unmarshal(e.Arguments, &args); err != nil {
+		return ""
+	}
+	return args.AccountID
+}
+
 // ParseArguments parses the arguments based on operation type
 func (e *AppSyncEvent) ParseArguments() (interface{}, error) {
 	switch e.GetOperationType() {
@@ -179,12 +608,126 @@ func (e *AppSyncEvent) ParseArguments() (interface{}, error) {
 			return nil, err
 		}
 		return input, nil
-	case OperationTypeList:
+	case OperationTypeRestore:
+		var input RestoreUnitInput
+		if err := json.Unmarshal(e.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return input, nil
+	case OperationTypePurge:
+		var input PurgeUnitInput
+		if err := json.Unmarshal(e.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return input, nil
+	case OperationTypeGetByID:
+		var input GetUnitByIDInput
+		if err := json.Unmarshal(e.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return input, nil
+	case OperationTypeGetByVin:
+		var input GetUnitByVinInput
+		if err := json.Unmarshal(e.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return input, nil
+	case OperationTypeSearchByVin:
+		var input SearchUnitsByVinInput
+		if err := json.Unmarshal(e.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return input, nil
+	case OperationTypeList, OperationTypeListDeleted:
 		var input ListUnitsInput
 		if err := json.Unmarshal(e.Arguments, &input); err != nil {
 			return nil, err
 		}
 		return input, nil
+	case OperationTypeDecodeVin:
+		var input DecodeVinInput
+		if err := json.Unmarshal(e.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return input, nil
+	case OperationTypeImport:
+		var input ImportUnitsInput
+		if err := json.Unmarshal(e.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return input, nil
+	case OperationTypeExport:
+		var input ExportUnitsInput
+		if err := json.Unmarshal(e.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return input, nil
+	case OperationTypeBatchGet:
+		var input BatchGetUnitsInput
+		if err := json.Unmarshal(e.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return input, nil
+	case OperationTypeBatchCreate:
+		var input BatchCreateUnitsInput
+		if err := json.Unmarshal(e.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return input, nil
+	case OperationTypeBatchDelete:
+		var input BatchDeleteUnitsInput
+		if err := json.Unmarshal(e.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return input, nil
+	case OperationTypeTransact:
+		var input TransactUnitsInput
+		if err := json.Unmarshal(e.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return input, nil
+	case OperationTypeGetHistory:
+		var input GetUnitHistoryInput
+		if err := json.Unmarshal(e.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return input, nil
+	case OperationTypeGetUnitTypeSchema:
+		var input GetUnitTypeSchemaInput
+		if err := json.Unmarshal(e.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return input, nil
+	case OperationTypeCreateWebhookSubscription:
+		var input CreateWebhookSubscriptionInput
+		if err := json.Unmarshal(e.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return input, nil
+	case OperationTypeGetWebhookSubscription, OperationTypeDeleteWebhookSubscription:
+		var input WebhookSubscriptionKeyInput
+		if err := json.Unmarshal(e.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return input, nil
+	case OperationTypeListWebhookSubscriptions:
+		var input ListWebhookSubscriptionsInput
+		if err := json.Unmarshal(e.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return input, nil
+	case OperationTypeUpdateWebhookSubscription:
+		var input UpdateWebhookSubscriptionInput
+		if err := json.Unmarshal(e.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return input, nil
+	case OperationTypeListWebhookDeliveries:
+		var input ListWebhookDeliveriesInput
+		if err := json.Unmarshal(e.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return input, nil
 	default:
 		return nil, nil
 	}
@@ -6,6 +6,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/steverhoton/unt-units-svc/internal/models"
 )
 
 func TestAppSyncEvent_GetOperationType(t *testing.T) {
@@ -39,6 +41,116 @@ func TestAppSyncEvent_GetOperationType(t *testing.T) {
 			fieldName: "listUnits",
 			want:      OperationTypeList,
 		},
+		{
+			name:      "Restore operation",
+			fieldName: "restoreUnit",
+			want:      OperationTypeRestore,
+		},
+		{
+			name:      "List deleted operation",
+			fieldName: "listDeletedUnits",
+			want:      OperationTypeListDeleted,
+		},
+		{
+			name:      "Purge operation",
+			fieldName: "purgeUnit",
+			want:      OperationTypePurge,
+		},
+		{
+			name:      "Get by ID operation",
+			fieldName: "getUnitById",
+			want:      OperationTypeGetByID,
+		},
+		{
+			name:      "Get by VIN operation",
+			fieldName: "getUnitByVin",
+			want:      OperationTypeGetByVin,
+		},
+		{
+			name:      "Search by VIN operation",
+			fieldName: "searchUnitsByVin",
+			want:      OperationTypeSearchByVin,
+		},
+		{
+			name:      "Decode VIN operation",
+			fieldName: "decodeVin",
+			want:      OperationTypeDecodeVin,
+		},
+		{
+			name:      "Import units operation",
+			fieldName: "importUnits",
+			want:      OperationTypeImport,
+		},
+		{
+			name:      "Export units operation",
+			fieldName: "exportUnits",
+			want:      OperationTypeExport,
+		},
+		{
+			name:      "Batch get units operation",
+			fieldName: "batchGetUnits",
+			want:      OperationTypeBatchGet,
+		},
+		{
+			name:      "Batch create units operation",
+			fieldName: "batchCreateUnits",
+			want:      OperationTypeBatchCreate,
+		},
+		{
+			name:      "Batch delete units operation",
+			fieldName: "batchDeleteUnits",
+			want:      OperationTypeBatchDelete,
+		},
+		{
+			name:      "Transact units operation",
+			fieldName: "transactUnits",
+			want:      OperationTypeTransact,
+		},
+		{
+			name:      "Get unit history operation",
+			fieldName: "getUnitHistory",
+			want:      OperationTypeGetHistory,
+		},
+		{
+			name:      "List unit types operation",
+			fieldName: "listUnitTypes",
+			want:      OperationTypeListUnitTypes,
+		},
+		{
+			name:      "Get unit type schema operation",
+			fieldName: "getUnitTypeSchema",
+			want:      OperationTypeGetUnitTypeSchema,
+		},
+		{
+			name:      "Create webhook subscription operation",
+			fieldName: "createWebhookSubscription",
+			want:      OperationTypeCreateWebhookSubscription,
+		},
+		{
+			name:      "Get webhook subscription operation",
+			fieldName: "getWebhookSubscription",
+			want:      OperationTypeGetWebhookSubscription,
+		},
+		{
+			name:      "List webhook subscriptions operation",
+			fieldName: "listWebhookSubscriptions",
+			want:      OperationTypeListWebhookSubscriptions,
+		},
+		{
+			name:      "Update webhook subscription operation",
+			fieldName: "updateWebhookSubscription",
+			want:      OperationTypeUpdateWebhookSubscription,
+		},
+		{
+			name:      "Delete webhook subscription operation",
+			fieldName: "deleteWebhookSubscription",
+			want:      OperationTypeDeleteWebhookSubscription,
+		},
+		{
+			name:      "List webhook deliveries operation",
+			fieldName: "listWebhookDeliveries",
+			want:      OperationTypeListWebhookDeliveries,
+		},
 		{
 			name:      "Unknown operation defaults to read",
 			fieldName: "unknownOperation",
@@ -200,6 +312,184 @@ func TestAppSyncEvent_ParseArguments_List(t *testing.T) {
 	assert.Equal(t, *input.Filter, *parsedInput.Filter)
 }
 
+func TestAppSyncEvent_ParseArguments_GetByID(t *testing.T) {
+	event := &AppSyncEvent{
+		FieldName: "getUnitById",
+		Arguments: json.RawMessage(`{"id":"550e8400-e29b-41d4-a716-446655440000"}`),
+	}
+
+	result, err := event.ParseArguments()
+	require.NoError(t, err)
+
+	parsedInput, ok := result.(GetUnitByIDInput)
+	require.True(t, ok)
+	assert.Equal(t, "550e8400-e29b-41d4-a716-446655440000", parsedInput.ID)
+}
+
+func TestAppSyncEvent_ParseArguments_VinLookups(t *testing.T) {
+	event := &AppSyncEvent{
+		FieldName: "getUnitByVin",
+		Arguments: json.RawMessage(`{"accountId":"account-123","vin":"1XKAD49X0RJ123456"}`),
+	}
+	result, err := event.ParseArguments()
+	require.NoError(t, err)
+	assert.Equal(t, GetUnitByVinInput{AccountID: "account-123", Vin: "1XKAD49X0RJ123456"}, result)
+
+	event = &AppSyncEvent{
+		FieldName: "searchUnitsByVin",
+		Arguments: json.RawMessage(`{"accountId":"account-123","vinPrefix":"1XKAD49X","limit":5}`),
+	}
+	result, err = event.ParseArguments()
+	require.NoError(t, err)
+	search, ok := result.(SearchUnitsByVinInput)
+	require.True(t, ok)
+	assert.Equal(t, "1XKAD49X", search.VinPrefix)
+	require.NotNil(t, search.Limit)
+	assert.Equal(t, 5, *search.Limit)
+
+	event = &AppSyncEvent{
+		FieldName: "decodeVin",
+		Arguments: json.RawMessage(`{"vin":"1HGBH41JXMN109186","modelYear":"1991"}`),
+	}
+	result, err = event.ParseArguments()
+	require.NoError(t, err)
+	assert.Equal(t, DecodeVinInput{Vin: "1HGBH41JXMN109186", ModelYear: "1991"}, result)
+}
+
+func TestAppSyncEvent_ParseArguments_ImportUnits(t *testing.T) {
+	event := &AppSyncEvent{
+		FieldName: "importUnits",
+		Arguments: json.RawMessage(`{"accountId":"account-1","unitType":"commercialVehicleType","format":"CSV","payload":"suggestedVin\n1HGBH41JXMN109186\n"}`),
+	}
+
+	result, err := event.ParseArguments()
+	require.NoError(t, err)
+	assert.Equal(t, ImportUnitsInput{
+		AccountID: "account-1",
+		UnitType:  "commercialVehicleType",
+		Format:    "CSV",
+		Payload:   "suggestedVin\n1HGBH41JXMN109186\n",
+	}, result)
+}
+
+func TestAppSyncEvent_ParseArguments_ExportUnits(t *testing.T) {
+	event := &AppSyncEvent{
+		FieldName: "exportUnits",
+		Arguments: json.RawMessage(`{"accountId":"account-1","unitType":"trailerType","format":"PARQUET"}`),
+	}
+
+	result, err := event.ParseArguments()
+	require.NoError(t, err)
+	unitType := "trailerType"
+	assert.Equal(t, ExportUnitsInput{AccountID: "account-1", UnitType: &unitType, Format: "PARQUET"}, result)
+}
+
+func TestAppSyncEvent_ParseArguments_BatchUnits(t *testing.T) {
+	event := &AppSyncEvent{
+		FieldName: "batchDeleteUnits",
+		Arguments: json.RawMessage(`{"accountId":"account-1","keys":[{"id":"unit-1","unitType":"commercialVehicleType","expectedVersion":2}]}`),
+	}
+
+	result, err := event.ParseArguments()
+	require.NoError(t, err)
+	version := int64(2)
+	assert.Equal(t, BatchDeleteUnitsInput{
+		AccountID: "account-1",
+		Keys:      []UnitKeyInput{{ID: "unit-1", UnitType: "commercialVehicleType", ExpectedVersion: &version}},
+	}, result)
+
+	event = &AppSyncEvent{
+		FieldName: "batchCreateUnits",
+		Arguments: json.RawMessage(`{"accountId":"account-1","unitType":"commercialVehicleType","units":[{"suggestedVin":"1HGBH41JXMN109186","make":"Honda","vinExemption":"PRE_1981"}]}`),
+	}
+
+	result, err = event.ParseArguments()
+	require.NoError(t, err)
+	input, ok := result.(BatchCreateUnitsInput)
+	require.True(t, ok)
+	require.Len(t, input.Units, 1)
+	assert.Equal(t, "1HGBH41JXMN109186", input.Units[0].SuggestedVin)
+	assert.Equal(t, "Honda", input.Units[0].Make)
+	assert.Equal(t, "PRE_1981", input.Units[0].VinExemption)
+}
+
+func TestAppSyncEvent_ParseArguments_TransactUnits(t *testing.T) {
+	event := &AppSyncEvent{
+		FieldName: "transactUnits",
+		Arguments: json.RawMessage(`{"accountId":"account-1","operations":[{"type":"UPDATE","id":"unit-1","unitType":"commercialVehicleType","expectedVersion":3,"unit":{"note":null}}]}`),
+	}
+
+	result, err := event.ParseArguments()
+	require.NoError(t, err)
+	version := int64(3)
+	assert.Equal(t, TransactUnitsInput{
+		AccountID: "account-1",
+		Operations: []TransactOperationInput{{
+			Type: "UPDATE", ID: "unit-1", UnitType: "commercialVehicleType", ExpectedVersion: &version, Unit: json.RawMessage(`{"note":null}`),
+		}},
+	}, result)
+}
+
+func TestAppSyncEvent_ParseArguments_GetUnitHistory(t *testing.T) {
+	event := &AppSyncEvent{
+		FieldName: "getUnitHistory",
+		Arguments: json.RawMessage(`{"accountId":"account-1","id":"unit-1","unitType":"commercialVehicleType","limit":5,"nextToken":"abc"}`),
+	}
+
+	result, err := event.ParseArguments()
+	require.NoError(t, err)
+	limit, nextToken := 5, "abc"
+	assert.Equal(t, GetUnitHistoryInput{
+		AccountID: "account-1", ID: "unit-1", UnitType: "commercialVehicleType", Limit: &limit, NextToken: &nextToken,
+	}, result)
+}
+
+func TestNewBatchUnitsResponse(t *testing.T) {
+	response := NewBatchUnitsResponse([]BatchUnitResult{{Index: 0, Success: true}, {Index: 1, Code: "NOT_FOUND"}, {Index: 2, Success: true}})
+	assert.Equal(t, 3, response.Total)
+	assert.Equal(t, 2, response.Succeeded)
+	assert.Equal(t, 1, response.Failed)
+}
+
+func TestAppSyncEvent_ParseArguments_GetUnitTypeSchema(t *testing.T) {
+	event := &AppSyncEvent{
+		FieldName: "getUnitTypeSchema",
+		Arguments: json.RawMessage(`{"unitType":"commercialVehicleType","version":2}`),
+	}
+
+	result, err := event.ParseArguments()
+	require.NoError(t, err)
+
+	parsedInput, ok := result.(GetUnitTypeSchemaInput)
+	require.True(t, ok)
+
+	assert.Equal(t, "commercialVehicleType", parsedInput.UnitType)
+	require.NotNil(t, parsedInput.Version)
+	assert.Equal(t, 2, *parsedInput.Version)
+}
+
+func TestAppSyncEvent_ParseArguments_UpdateWebhookSubscription(t *testing.T) {
+	event := &AppSyncEvent{
+		FieldName: "updateWebhookSubscription",
+		Arguments: json.RawMessage(`{"accountId":"account-1","id":"sub-1","eventTypes":["UnitDeleted"],"enabled":true}`),
+	}
+
+	result, err := event.ParseArguments()
+	require.NoError(t, err)
+
+	parsedInput, ok := result.(UpdateWebhookSubscriptionInput)
+	require.True(t, ok)
+
+	assert.Equal(t, "account-1", parsedInput.AccountID)
+	assert.Equal(t, "sub-1", parsedInput.ID)
+	assert.Nil(t, parsedInput.URL)
+	assert.Nil(t, parsedInput.UnitTypes)
+	require.NotNil(t, parsedInput.EventTypes)
+	assert.Equal(t, []string{"UnitDeleted"}, *parsedInput.EventTypes)
+	require.NotNil(t, parsedInput.Enabled)
+	assert.True(t, *parsedInput.Enabled)
+}
+
 func TestAppSyncEvent_ParseArguments_InvalidJSON(t *testing.T) {
 	event := &AppSyncEvent{
 		FieldName: "createUnit",
@@ -257,9 +547,9 @@ func TestIdentity(t *testing.T) {
 }
 
 func TestListUnitsResponse(t *testing.T) {
-	units := []map[string]interface{}{
-		{"id": "unit-1", "suggestedVin": "VIN1"},
-		{"id": "unit-2", "suggestedVin": "VIN2"},
+	units := []models.Unit{
+		{ID: "unit-1", SuggestedVin: "VIN1"},
+		{ID: "unit-2", SuggestedVin: "VIN2"},
 	}
 	nextToken := "token123"
 
@@ -275,6 +565,53 @@ func TestListUnitsResponse(t *testing.T) {
 	assert.Equal(t, nextToken, *response.NextToken)
 }
 
+func TestListDynamicUnitsResponse(t *testing.T) {
+	units := []models.DynamicUnit{
+		{ID: "unit-1", UnitType: "commercialVehicleType", Data: map[string]interface{}{"suggestedVin": "VIN1"}},
+		{ID: "unit-2", UnitType: "commercialVehicleType", Data: map[string]interface{}{"suggestedVin": "VIN2"}},
+	}
+
+	response := ListDynamicUnitsResponse{
+		Items: units,
+		Count: len(units),
+	}
+
+	assert.Len(t, response.Items, 2)
+	assert.Equal(t, 2, response.Count)
+	assert.Nil(t, response.NextToken)
+}
+
+func TestAppSyncEvent_GetUnitType(t *testing.T) {
+	tests := []struct {
+		name      string
+		arguments string
+		want      string
+	}{
+		{
+			name:      "unit type present",
+			arguments: `{"accountId":"account-123","unitType":"commercialVehicleType"}`,
+			want:      "commercialVehicleType",
+		},
+		{
+			name:      "unit type absent",
+			arguments: `{"accountId":"account-123"}`,
+			want:      "",
+		},
+		{
+			name:      "invalid JSON",
+			arguments: `{"invalid": json}`,
+			want:      "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &AppSyncEvent{Arguments: json.RawMessage(tt.arguments)}
+			assert.Equal(t, tt.want, event.GetUnitType())
+		})
+	}
+}
+
 func TestOperationTypeConstants(t *testing.T) {
 	assert.Equal(t, OperationType("CREATE"), OperationTypeCreate)
 	assert.Equal(t, OperationType("READ"), OperationTypeRead)
@@ -282,3 +619,48 @@ func TestOperationTypeConstants(t *testing.T) {
 	assert.Equal(t, OperationType("DELETE"), OperationTypeDelete)
 	assert.Equal(t, OperationType("LIST"), OperationTypeList)
 }
+
+func TestIdentity_Principal(t *testing.T) {
+	assert.Equal(t, "fleet-admin", Identity{Sub: "sub-1", Username: "fleet-admin"}.Principal())
+	assert.Equal(t, "sub-1", Identity{Sub: "sub-1"}.Principal())
+	assert.Equal(t, "arn:aws:iam::123456789012:role/support", Identity{UserArn: "arn:aws:iam::123456789012:role/support"}.Principal())
+	assert.Equal(t, "", Identity{}.Principal())
+}
+
+func TestIdentity_InGroup(t *testing.T) {
+	identity := Identity{Groups: []string{"dispatch", "admin"}}
+
+	assert.True(t, identity.InGroup("admin"))
+	assert.False(t, identity.InGroup("Admin"))
+	assert.False(t, Identity{}.InGroup("admin"))
+}
+
+func TestAppSyncEvent_GetAccountID(t *testing.T) {
+	assert.Equal(t, "account-123", (&AppSyncEvent{Arguments: json.RawMessage(`{"accountId":"account-123","unitType":"commercialVehicleType"}`)}).GetAccountID())
+	assert.Equal(t, "", (&AppSyncEvent{Arguments: json.RawMessage(`{"unitType":"commercialVehicleType"}`)}).GetAccountID())
+	assert.Equal(t, "", (&AppSyncEvent{Arguments: json.RawMessage(`{"invalid": json}`)}).GetAccountID())
+}
+
+func TestClaims_Values(t *testing.T) {
+	var identity Identity
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"sub": "sub-1",
+		"claims": {
+			"sub": "sub-1",
+			"username": "dispatcher",
+			"custom:accountId": "account-1, account-2",
+			"accounts": ["account-3", "", 7],
+			"custom:tier": 3
+		}
+	}`), &identity))
+
+	// Known claims are still decoded into their fields
+	assert.Equal(t, "dispatcher", identity.Claims.Username)
+
+	assert.Equal(t, []string{"account-1", "account-2"}, identity.Claims.Values("custom:accountId"))
+	assert.Equal(t, []string{"account-3"}, identity.Claims.Values("accounts"))
+	assert.Equal(t, []string{"sub-1"}, identity.Claims.Values("sub"))
+	assert.Empty(t, identity.Claims.Values("custom:tier"))
+	assert.Empty(t, identity.Claims.Values("missing"))
+	assert.Empty(t, Claims{}.Values("custom:accountId"))
+}
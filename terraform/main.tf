@@ -12,15 +12,24 @@ locals {
   lambda_source_dir = "${path.module}/../lambda"
   lambda_build_dir  = "${path.module}/build"
   lambda_zip_path   = "${local.lambda_build_dir}/lambda.zip"
+
+  streams_build_dir = "${local.lambda_build_dir}/streams"
+  streams_zip_path  = "${local.lambda_build_dir}/streams.zip"
+
+  # The streams Lambda only runs when it has somewhere to publish unit changes
+  streams_enabled = length(var.stream_sinks) > 0
 }
 
 # DynamoDB table for storing unit data
 resource "aws_dynamodb_table" "units_table" {
-  name           = "${local.name_prefix}-units"
-  billing_mode   = var.dynamodb_billing_mode
-  hash_key       = "pk"
-  range_key      = "sk"
-  stream_enabled = false
+  name         = "${local.name_prefix}-units"
+  billing_mode = var.dynamodb_billing_mode
+  hash_key     = "pk"
+  range_key    = "sk"
+
+  # Unit changes are fanned out by the streams Lambda, which needs both images
+  stream_enabled   = true
+  stream_view_type = "NEW_AND_OLD_IMAGES"
 
   # Only set capacity if using PROVISIONED billing mode
   read_capacity  = var.dynamodb_billing_mode == "PROVISIONED" ? var.dynamodb_read_capacity : null
@@ -41,6 +50,11 @@ resource "aws_dynamodb_table" "units_table" {
     type = "S"
   }
 
+  attribute {
+    name = "vin"
+    type = "S"
+  }
+
   # Global Secondary Index for querying by unit ID across accounts
   global_secondary_index {
     name            = "unit-id-index"
@@ -52,6 +66,25 @@ resource "aws_dynamodb_table" "units_table" {
     write_capacity = var.dynamodb_billing_mode == "PROVISIONED" ? var.dynamodb_write_capacity : null
   }
 
+  # Sparse Global Secondary Index for looking up units by normalized VIN within an account
+  global_secondary_index {
+    name            = "account-vin-index"
+    hash_key        = "pk"
+    range_key       = "vin"
+    projection_type = "ALL"
+
+    # Only set capacity if using PROVISIONED billing mode
+    read_capacity  = var.dynamodb_billing_mode == "PROVISIONED" ? var.dynamodb_read_capacity : null
+    write_capacity = var.dynamodb_billing_mode == "PROVISIONED" ? var.dynamodb_write_capacity : null
+  }
+
+  # Soft deleted units and webhook delivery attempts carry an expiresAt TTL once
+  # their retention period is configured
+  ttl {
+    attribute_name = "expiresAt"
+    enabled        = var.deleted_unit_retention_days > 0 || var.webhook_delivery_retention_days > 0
+  }
+
   point_in_time_recovery {
     enabled = var.enable_point_in_time_recovery
   }
@@ -63,6 +96,52 @@ resource "aws_dynamodb_table" "units_table" {
   })
 }
 
+# S3 bucket for unit exports written by the exportUnits mutation
+resource "aws_s3_bucket" "exports" {
+  bucket = "${local.name_prefix}-unit-exports-${data.aws_caller_identity.current.account_id}"
+
+  tags = merge(local.common_tags, {
+    Name = "${local.name_prefix}-unit-exports"
+  })
+}
+
+resource "aws_s3_bucket_public_access_block" "exports" {
+  bucket = aws_s3_bucket.exports.id
+
+  block_public_acls       = true
+  block_public_policy     = true
+  ignore_public_acls      = true
+  restrict_public_buckets = true
+}
+
+resource "aws_s3_bucket_server_side_encryption_configuration" "exports" {
+  bucket = aws_s3_bucket.exports.id
+
+  rule {
+    apply_server_side_encryption_by_default {
+      sse_algorithm = "AES256"
+    }
+  }
+}
+
+# Exports are downloaded shortly after they are made, so they expire
+resource "aws_s3_bucket_lifecycle_configuration" "exports" {
+  bucket = aws_s3_bucket.exports.id
+
+  rule {
+    id     = "expire-exports"
+    status = "Enabled"
+
+    filter {
+      prefix = "exports/"
+    }
+
+    expiration {
+      days = var.export_retention_days
+    }
+  }
+}
+
 # IAM role for Lambda function
 resource "aws_iam_role" "lambda_role" {
   name = "${local.name_prefix}-lambda-role"
@@ -85,6 +164,19 @@ resource "aws_iam_role" "lambda_role" {
   })
 }
 
+data "aws_caller_identity" "current" {}
+
+locals {
+  # Read access to the optional account membership table used for authorization
+  membership_table_statements = var.account_membership_table_name == "" ? [] : [
+    {
+      Effect   = "Allow"
+      Action   = ["dynamodb:Query"]
+      Resource = ["arn:aws:dynamodb:${var.aws_region}:${data.aws_caller_identity.current.account_id}:table/${var.account_membership_table_name}"]
+    }
+  ]
+}
+
 # IAM policy for DynamoDB access
 resource "aws_iam_policy" "lambda_dynamodb_policy" {
   name        = "${local.name_prefix}-lambda-dynamodb-policy"
@@ -92,7 +184,7 @@ resource "aws_iam_policy" "lambda_dynamodb_policy" {
 
   policy = jsonencode({
     Version = "2012-10-17"
-    Statement = [
+    Statement = concat([
       {
         Effect = "Allow"
         Action = [
@@ -100,6 +192,9 @@ resource "aws_iam_policy" "lambda_dynamodb_policy" {
           "dynamodb:PutItem",
           "dynamodb:UpdateItem",
           "dynamodb:DeleteItem",
+          "dynamodb:ConditionCheckItem",
+          "dynamodb:BatchGetItem",
+          "dynamodb:BatchWriteItem",
           "dynamodb:Query",
           "dynamodb:Scan"
         ]
@@ -107,8 +202,17 @@ resource "aws_iam_policy" "lambda_dynamodb_policy" {
           aws_dynamodb_table.units_table.arn,
           "${aws_dynamodb_table.units_table.arn}/index/*"
         ]
+      },
+      {
+        # Upload exports and sign their download links
+        Effect = "Allow"
+        Action = [
+          "s3:PutObject",
+          "s3:GetObject"
+        ]
+        Resource = ["${aws_s3_bucket.exports.arn}/exports/*"]
       }
-    ]
+    ], local.membership_table_statements)
   })
 
   tags = merge(local.common_tags, {
@@ -151,6 +255,8 @@ resource "null_resource" "lambda_build" {
       mkdir -p ${local.lambda_build_dir}
       cd ${local.lambda_source_dir}
       GOOS=linux GOARCH=${var.lambda_architecture} CGO_ENABLED=0 go build -o ${abspath(local.lambda_build_dir)}/bootstrap ./cmd/lambda/
+      mkdir -p ${abspath(local.streams_build_dir)}
+      GOOS=linux GOARCH=${var.lambda_architecture} CGO_ENABLED=0 go build -o ${abspath(local.streams_build_dir)}/bootstrap ./cmd/streams/
       echo "Build completed successfully"
     EOT
   }
@@ -196,8 +302,24 @@ resource "aws_lambda_function" "units_lambda" {
 
   environment {
     variables = {
-      TABLE_NAME = aws_dynamodb_table.units_table.name
-      LOG_LEVEL  = var.log_level
+      TABLE_NAME                      = aws_dynamodb_table.units_table.name
+      LOG_LEVEL                       = var.log_level
+      DYNAMIC_UNIT_TYPES              = join(",", var.dynamic_unit_types)
+      SCHEMA_MIGRATION_WRITE_BACK     = tostring(var.schema_migration_write_back)
+      DELETED_UNIT_RETENTION_DAYS     = tostring(var.deleted_unit_retention_days)
+      ADMIN_GROUP                     = var.admin_group
+      PAGINATION_TOKEN_KEY            = var.pagination_token_key
+      PAGINATION_TOKEN_TTL_MINUTES    = tostring(var.pagination_token_ttl_minutes)
+      ACCOUNT_CLAIM                   = var.account_claim
+      ACCOUNT_MEMBERSHIP_TABLE        = var.account_membership_table_name
+      VIN_DECODER_URL                 = var.vin_decoder_url
+      VIN_DECODER_TIMEOUT_SECONDS     = tostring(var.vin_decoder_timeout_seconds)
+      EXPORT_BUCKET                   = aws_s3_bucket.exports.bucket
+      EXPORT_URL_TTL_MINUTES          = tostring(var.export_url_ttl_minutes)
+      UNIT_HISTORY_ENABLED            = tostring(var.unit_history_enabled)
+      UNIT_EVENTS_ENABLED             = tostring(var.unit_events_enabled)
+      EVENT_BUS_NAME                  = var.event_bus_name
+      WEBHOOK_DELIVERY_RETENTION_DAYS = tostring(var.webhook_delivery_retention_days)
     }
   }
 
@@ -211,4 +333,158 @@ resource "aws_lambda_function" "units_lambda" {
   tags = merge(local.common_tags, {
     Name = "${local.name_prefix}-lambda"
   })
-}
\ No newline at end of file
+}
+
+# Streams Lambda publishing unit changes from the table's stream to the configured sinks
+data "archive_file" "streams_zip" {
+  count       = local.streams_enabled ? 1 : 0
+  type        = "zip"
+  output_path = local.streams_zip_path
+  source_file = "${local.streams_build_dir}/bootstrap"
+
+  depends_on = [null_resource.lambda_build]
+}
+
+resource "aws_iam_role" "streams_lambda_role" {
+  count = local.streams_enabled ? 1 : 0
+  name  = "${local.name_prefix}-streams-lambda-role"
+
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Action = "sts:AssumeRole"
+        Effect = "Allow"
+        Principal = {
+          Service = "lambda.amazonaws.com"
+        }
+      }
+    ]
+  })
+
+  tags = merge(local.common_tags, {
+    Name = "${local.name_prefix}-streams-lambda-role"
+  })
+}
+
+locals {
+  # Publish access for the sinks that are configured
+  streams_sink_statements = concat(
+    contains(var.stream_sinks, "sns") ? [
+      {
+        Effect   = "Allow"
+        Action   = ["sns:Publish"]
+        Resource = [var.sns_topic_arn]
+      }
+    ] : [],
+    contains(var.stream_sinks, "eventbridge") ? [
+      {
+        Effect   = "Allow"
+        Action   = ["events:PutEvents"]
+        Resource = ["arn:aws:events:${var.aws_region}:${data.aws_caller_identity.current.account_id}:event-bus/${var.event_bus_name}"]
+      }
+    ] : [],
+    # Webhook subscriptions are read from the table, and delivery attempts and
+    # failures written back to it
+    contains(var.stream_sinks, "subscriptions") ? [
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:Query",
+          "dynamodb:PutItem",
+          "dynamodb:UpdateItem"
+        ]
+        Resource = [aws_dynamodb_table.units_table.arn]
+      }
+    ] : []
+  )
+}
+
+resource "aws_iam_role_policy" "streams_lambda_policy" {
+  count = local.streams_enabled ? 1 : 0
+  name  = "${local.name_prefix}-streams-lambda-policy"
+  role  = aws_iam_role.streams_lambda_role[0].id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = concat([
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:DescribeStream",
+          "dynamodb:GetRecords",
+          "dynamodb:GetShardIterator",
+          "dynamodb:ListStreams"
+        ]
+        Resource = [aws_dynamodb_table.units_table.stream_arn]
+      }
+    ], local.streams_sink_statements)
+  })
+}
+
+resource "aws_iam_role_policy_attachment" "streams_lambda_basic_execution" {
+  count      = local.streams_enabled ? 1 : 0
+  role       = aws_iam_role.streams_lambda_role[0].name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+resource "aws_cloudwatch_log_group" "streams_lambda_log_group" {
+  count             = local.streams_enabled ? 1 : 0
+  name              = "/aws/lambda/${local.name_prefix}-streams-lambda"
+  retention_in_days = 14
+
+  tags = merge(local.common_tags, {
+    Name = "${local.name_prefix}-streams-lambda-logs"
+  })
+}
+
+resource "aws_lambda_function" "streams_lambda" {
+  count            = local.streams_enabled ? 1 : 0
+  filename         = local.streams_zip_path
+  function_name    = "${local.name_prefix}-streams-lambda"
+  role             = aws_iam_role.streams_lambda_role[0].arn
+  handler          = "bootstrap"
+  source_code_hash = data.archive_file.streams_zip[0].output_base64sha256
+  runtime          = "provided.al2"
+  architectures    = [var.lambda_architecture]
+  timeout          = var.streams_lambda_timeout
+  memory_size      = var.lambda_memory_size
+
+  environment {
+    variables = {
+      TABLE_NAME                      = aws_dynamodb_table.units_table.name
+      LOG_LEVEL                       = var.log_level
+      STREAM_SINKS                    = join(",", var.stream_sinks)
+      SNS_TOPIC_ARN                   = var.sns_topic_arn
+      EVENT_BUS_NAME                  = var.event_bus_name
+      STREAM_WEBHOOK_URL              = var.stream_webhook_url
+      WEBHOOK_MAX_ATTEMPTS            = tostring(var.webhook_max_attempts)
+      WEBHOOK_DISABLE_AFTER_FAILURES  = tostring(var.webhook_disable_after_failures)
+      WEBHOOK_DELIVERY_RETENTION_DAYS = tostring(var.webhook_delivery_retention_days)
+    }
+  }
+
+  depends_on = [
+    aws_iam_role_policy_attachment.streams_lambda_basic_execution,
+    aws_iam_role_policy.streams_lambda_policy,
+    aws_cloudwatch_log_group.streams_lambda_log_group,
+    data.archive_file.streams_zip
+  ]
+
+  tags = merge(local.common_tags, {
+    Name = "${local.name_prefix}-streams-lambda"
+  })
+}
+
+# Records whose change could not be published are reported back, so only the
+# batch from the first of them is retried
+resource "aws_lambda_event_source_mapping" "units_stream" {
+  count                          = local.streams_enabled ? 1 : 0
+  event_source_arn               = aws_dynamodb_table.units_table.stream_arn
+  function_name                  = aws_lambda_function.streams_lambda[0].arn
+  starting_position              = "LATEST"
+  batch_size                     = var.stream_batch_size
+  maximum_retry_attempts         = var.stream_maximum_retry_attempts
+  bisect_batch_on_function_error = true
+  function_response_types        = ["ReportBatchItemFailures"]
+}
@@ -18,6 +18,11 @@ output "dynamodb_gsi_name" {
   value       = "unit-id-index"
 }
 
+output "dynamodb_vin_gsi_name" {
+  description = "Name of the DynamoDB Global Secondary Index for VIN lookups within an account"
+  value       = "account-vin-index"
+}
+
 output "lambda_function_name" {
   description = "Name of the Lambda function"
   value       = aws_lambda_function.units_lambda.function_name
@@ -51,4 +56,19 @@ output "cloudwatch_log_group_name" {
 output "cloudwatch_log_group_arn" {
   description = "ARN of the CloudWatch log group for Lambda"
   value       = aws_cloudwatch_log_group.lambda_log_group.arn
-}
\ No newline at end of file
+}
+
+output "exports_bucket_name" {
+  description = "Name of the S3 bucket unit exports are written to"
+  value       = aws_s3_bucket.exports.bucket
+}
+
+output "dynamodb_stream_arn" {
+  description = "ARN of the DynamoDB stream of the units table"
+  value       = aws_dynamodb_table.units_table.stream_arn
+}
+
+output "streams_lambda_function_name" {
+  description = "Name of the streams Lambda function, empty when no stream sinks are configured"
+  value       = local.streams_enabled ? aws_lambda_function.streams_lambda[0].function_name : ""
+}
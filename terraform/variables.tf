@@ -120,6 +120,201 @@ variable "enable_deletion_protection" {
   default     = true
 }
 
+variable "dynamic_unit_types" {
+  description = "Unit types served by the schema-driven dynamic unit handlers"
+  type        = list(string)
+  default     = []
+}
+
+variable "schema_migration_write_back" {
+  description = "Persist dynamic units upgraded to the latest schema version when they are read"
+  type        = bool
+  default     = false
+}
+
+variable "deleted_unit_retention_days" {
+  description = "Days soft deleted units are kept before they expire and can be purged (0 keeps them forever)"
+  type        = number
+  default     = 30
+
+  validation {
+    condition     = var.deleted_unit_retention_days >= 0
+    error_message = "Deleted unit retention must be zero or a positive number of days."
+  }
+}
+
+variable "admin_group" {
+  description = "Identity group allowed to run administrative operations such as purgeUnit"
+  type        = string
+  default     = "admin"
+}
+
+variable "account_claim" {
+  description = "Identity token claim listing the accounts a caller may act on"
+  type        = string
+  default     = "custom:accountId"
+}
+
+variable "account_membership_table_name" {
+  description = "Optional DynamoDB table (principal, accountId) consulted instead of account_claim"
+  type        = string
+  default     = ""
+}
+
+variable "vin_decoder_url" {
+  description = "Base URL of the vPIC-compatible API used to decode VINs"
+  type        = string
+  default     = "https://vpic.nhtsa.dot.gov/api/vehicles"
+}
+
+variable "vin_decoder_timeout_seconds" {
+  description = "Timeout in seconds for each VIN decode request"
+  type        = number
+  default     = 10
+
+  validation {
+    condition     = var.vin_decoder_timeout_seconds > 0
+    error_message = "VIN decoder timeout must be a positive number of seconds."
+  }
+}
+
+variable "pagination_token_key" {
+  description = "HMAC key used to sign list nextToken values (empty uses a per-instance random key)"
+  type        = string
+  default     = ""
+  sensitive   = true
+}
+
+variable "pagination_token_ttl_minutes" {
+  description = "Minutes a list nextToken stays valid"
+  type        = number
+  default     = 60
+
+  validation {
+    condition     = var.pagination_token_ttl_minutes > 0
+    error_message = "Pagination token TTL must be a positive number of minutes."
+  }
+}
+
+variable "export_retention_days" {
+  description = "Days unit exports are kept in the exports bucket before they expire"
+  type        = number
+  default     = 7
+
+  validation {
+    condition     = var.export_retention_days > 0
+    error_message = "Export retention must be a positive number of days."
+  }
+}
+
+variable "export_url_ttl_minutes" {
+  description = "Minutes the download link returned by exportUnits stays valid"
+  type        = number
+  default     = 60
+
+  validation {
+    condition     = var.export_url_ttl_minutes > 0 && var.export_url_ttl_minutes <= 10080
+    error_message = "Export URL TTL must be between 1 minute and 7 days."
+  }
+}
+
+variable "unit_history_enabled" {
+  description = "Record an immutable history item for every create, update, delete and restore of a unit"
+  type        = bool
+  default     = true
+}
+
+variable "unit_events_enabled" {
+  description = "Write a UnitCreated, UnitUpdated or UnitDeleted event to the outbox with every write to a unit"
+  type        = bool
+  default     = false
+}
+
+variable "event_bus_name" {
+  description = "EventBridge event bus the outbox relay and the eventbridge stream sink publish unit events to"
+  type        = string
+  default     = "default"
+}
+
+variable "stream_sinks" {
+  description = "Sinks the streams Lambda publishes unit changes to: sns, eventbridge, webhook and/or subscriptions (empty disables the streams Lambda)"
+  type        = list(string)
+  default     = []
+
+  validation {
+    condition     = alltrue([for sink in var.stream_sinks : contains(["sns", "eventbridge", "webhook", "subscriptions"], sink)])
+    error_message = "Stream sinks must be sns, eventbridge, webhook or subscriptions."
+  }
+}
+
+variable "sns_topic_arn" {
+  description = "SNS topic the sns stream sink publishes unit changes to"
+  type        = string
+  default     = ""
+}
+
+variable "stream_webhook_url" {
+  description = "URL the webhook stream sink posts each unit change to"
+  type        = string
+  default     = ""
+}
+
+variable "stream_batch_size" {
+  description = "Most stream records the streams Lambda receives in one batch"
+  type        = number
+  default     = 100
+}
+
+variable "stream_maximum_retry_attempts" {
+  description = "Times a failed batch of stream records is retried before it is skipped"
+  type        = number
+  default     = 10
+}
+
+variable "streams_lambda_timeout" {
+  description = "Streams Lambda timeout in seconds; webhook retries to slow endpoints need more than the API Lambda"
+  type        = number
+  default     = 120
+
+  validation {
+    condition     = var.streams_lambda_timeout >= 1 && var.streams_lambda_timeout <= 900
+    error_message = "Streams Lambda timeout must be between 1 and 900 seconds."
+  }
+}
+
+variable "webhook_max_attempts" {
+  description = "Times the subscriptions stream sink posts an event to a webhook before the delivery fails"
+  type        = number
+  default     = 4
+
+  validation {
+    condition     = var.webhook_max_attempts >= 1
+    error_message = "Webhook attempts must be at least 1."
+  }
+}
+
+variable "webhook_disable_after_failures" {
+  description = "Failed deliveries in a row after which a webhook subscription is disabled (0 never disables)"
+  type        = number
+  default     = 10
+
+  validation {
+    condition     = var.webhook_disable_after_failures >= 0
+    error_message = "Webhook failures before disabling must be zero or a positive number."
+  }
+}
+
+variable "webhook_delivery_retention_days" {
+  description = "Days webhook delivery attempts are kept for listWebhookDeliveries (0 keeps them forever)"
+  type        = number
+  default     = 14
+
+  validation {
+    condition     = var.webhook_delivery_retention_days >= 0
+    error_message = "Webhook delivery retention must be zero or a positive number of days."
+  }
+}
+
 variable "tags" {
   description = "Additional tags to apply to all resources"
   type        = map(string)